@@ -0,0 +1,431 @@
+package myhome
+
+// RPC authentication (API tokens, HMAC signatures) & per-verb authorization
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Role is what an authenticated caller is allowed to do. Roles are ordered:
+// each one may call every verb the previous one may.
+type Role string
+
+const (
+	RoleNone     Role = ""          // No access at all
+	RoleReadOnly Role = "read-only" // Verbs that only read state
+	RoleOperator Role = "operator"  // Day-to-day control: switches, rooms, temperatures...
+	RoleAdmin    Role = "admin"     // Device setup, update & removal
+)
+
+func (r Role) rank() int {
+	switch r {
+	case RoleReadOnly:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+// Allows reports whether r is at least min.
+func (r Role) Allows(min Role) bool {
+	return r.rank() >= min.rank()
+}
+
+// ParseRole parses a role name as found in the configuration file.
+func ParseRole(s string) (Role, error) {
+	switch r := Role(strings.ToLower(strings.TrimSpace(s))); r {
+	case RoleNone, RoleReadOnly, RoleOperator, RoleAdmin:
+		return r, nil
+	}
+	return RoleNone, fmt.Errorf("unknown role %q: must be read-only|operator|admin", s)
+}
+
+// verbRoles is the per-verb policy: the minimum role allowed to call each
+// verb. Verbs not listed here require RoleOperator.
+var verbRoles = map[Verb]Role{
+	DevicesMatch:                  RoleReadOnly,
+	DeviceLookup:                  RoleReadOnly,
+	DeviceShow:                    RoleReadOnly,
+	DeviceHistory:                 RoleReadOnly,
+	DeviceListByRoom:              RoleReadOnly,
+	TemperatureGet:                RoleReadOnly,
+	TemperatureList:               RoleReadOnly,
+	TemperatureGetSchedule:        RoleReadOnly,
+	TemperatureGetWeekdayDefaults: RoleReadOnly,
+	TemperatureGetKindSchedules:   RoleReadOnly,
+	OccupancyGetStatus:            RoleReadOnly,
+	HeaterGetConfig:               RoleReadOnly,
+	ThermometerList:               RoleReadOnly,
+	DoorList:                      RoleReadOnly,
+	RoomList:                      RoleReadOnly,
+	SwitchStatus:                  RoleReadOnly,
+	SwitchAll:                     RoleReadOnly,
+	EventList:                     RoleReadOnly,
+	EventSubscribe:                RoleReadOnly,
+	DeviceWatch:                   RoleReadOnly,
+	Unsubscribe:                   RoleReadOnly,
+	RpcCancel:                     RoleReadOnly,
+	RpcBatch:                      RoleReadOnly, // each call of the batch is checked on its own
+	RpcList:                       RoleReadOnly,
+	RpcDescribe:                   RoleReadOnly,
+	PoolGetStatus:                 RoleReadOnly,
+	SolarClaimersList:             RoleReadOnly,
+	FetchList:                     RoleReadOnly,
+	DeviceForget:                  RoleAdmin,
+	DeviceSetup:                   RoleAdmin,
+	DeviceUpdate:                  RoleAdmin,
+	DeviceSetAuth:                 RoleAdmin,
+	EventRecord:                   RoleAdmin,
+	HeaterSetConfig:               RoleAdmin,
+}
+
+// VerbRole returns the minimum role allowed to call verb.
+func VerbRole(verb Verb) Role {
+	if r, exists := verbRoles[verb]; exists {
+		return r
+	}
+	return RoleOperator
+}
+
+// AuthMaxSkew bounds how far the timestamp of a signed request may be from
+// the server clock. Within that window the server remembers the signatures it
+// accepted and rejects them if seen again, so a captured signed request cannot
+// be replayed. API tokens get no such protection: anyone who captures one can
+// use it until it is removed from MYHOME_RPC_TOKENS.
+const AuthMaxSkew = 5 * time.Minute
+
+// Token is a credential configured on the server (see ParseTokens). A client
+// presents it either as an API token (Secret sent as-is, e.g. as an HTTP
+// bearer token) or as an HMAC key (Name sent, requests signed with Secret).
+type Token struct {
+	Name   string
+	Secret string
+	Role   Role
+}
+
+// Auth is the authentication member of a request envelope: either Token, or
+// Key/Ts/Sig for a signed request (see Credentials.Auth).
+type Auth struct {
+	Token string `json:"token,omitempty"` // API token
+	Key   string `json:"key,omitempty"`   // Name of the token whose secret signed the request
+	Ts    int64  `json:"ts,omitempty"`    // Signature time, in Unix seconds
+	Sig   string `json:"sig,omitempty"`   // Hex HMAC-SHA256 of the request (see signedPayload)
+}
+
+// Credentials authenticate the requests sent by this process's client. With
+// Key set, requests are HMAC-signed with Secret, which then never goes on the
+// wire; otherwise Secret is sent as an API token. Empty credentials send
+// anonymous requests.
+type Credentials struct {
+	Key    string
+	Secret string
+}
+
+// TheCredentials are the credentials used by TheClient.
+var TheCredentials Credentials
+
+// signedPayload is what a request signature covers: the dialog, the verb, the
+// timestamp and the exact params bytes as found in the envelope.
+func signedPayload(d Dialog, method Verb, ts int64, params []byte) []byte {
+	h := sha256.Sum256(params)
+	return []byte(strings.Join([]string{d.Id, d.Src, d.Dst, string(method), strconv.FormatInt(ts, 10), hex.EncodeToString(h[:])}, "\n"))
+}
+
+func sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Auth returns the envelope member for a request carrying the given dialog,
+// verb and marshalled params, or nil for empty credentials.
+func (c Credentials) Auth(d Dialog, method Verb, params []byte, now time.Time) *Auth {
+	switch {
+	case c.Secret == "":
+		return nil
+	case c.Key == "":
+		return &Auth{Token: c.Secret}
+	default:
+		ts := now.Unix()
+		return &Auth{Key: c.Key, Ts: ts, Sig: sign(c.Secret, signedPayload(d, method, ts, params))}
+	}
+}
+
+// seal sets the Auth member of req. Signed requests carry their params as
+// the exact bytes the signature covers.
+func (c Credentials) seal(req *request) error {
+	if c.Secret == "" {
+		return nil
+	}
+	var params []byte
+	if req.Params != nil {
+		var err error
+		if params, err = json.Marshal(req.Params); err != nil {
+			return err
+		}
+		req.Params = json.RawMessage(params)
+	}
+	req.Auth = c.Auth(req.Dialog, req.Method, params, time.Now())
+	return nil
+}
+
+// Caller identifies who sent the request being served.
+type Caller struct {
+	Principal string `json:"principal"` // Token name, or "anonymous"
+	Role      Role   `json:"role"`
+	Src       string `json:"src"` // Dialog source (MQTT) or remote address (HTTP)
+}
+
+// Denial describes a rejected request, as reported to the OnAuthDenied hook.
+type Denial struct {
+	Caller
+	Method Verb   `json:"method"`
+	Reason string `json:"reason"`
+}
+
+// authorizer holds the server-side token set. Until ConfigureAuth is called
+// with tokens, authentication is disabled and every caller is admin, which
+// is how the RPC bus behaved before authentication existed.
+type authorizer struct {
+	mu        sync.RWMutex
+	tokens    []Token
+	anonymous Role
+	denied    func(ctx context.Context, d Denial)
+	now       func() time.Time
+
+	replayMu sync.Mutex
+	seen     map[string]time.Time // Accepted signature -> when its timestamp goes stale
+}
+
+var theAuth = &authorizer{
+	anonymous: RoleAdmin,
+	now:       time.Now,
+}
+
+// ConfigureAuth sets the tokens accepted by the RPC server (MQTT) and the
+// /rpc HTTP endpoint, and the role given to requests carrying none. With no
+// tokens, authentication is disabled: anonymous is then ignored and every
+// caller is admin.
+func ConfigureAuth(tokens []Token, anonymous Role) error {
+	seen := make(map[string]bool)
+	for _, t := range tokens {
+		if t.Name == "" || t.Secret == "" {
+			return fmt.Errorf("invalid token %q: name and secret are required", t.Name)
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("duplicate token name %q", t.Name)
+		}
+		seen[t.Name] = true
+		if _, err := ParseRole(string(t.Role)); err != nil || t.Role == RoleNone {
+			return fmt.Errorf("invalid role %q for token %q: must be read-only|operator|admin", t.Role, t.Name)
+		}
+	}
+	if _, err := ParseRole(string(anonymous)); err != nil {
+		return err
+	}
+
+	theAuth.mu.Lock()
+	defer theAuth.mu.Unlock()
+	theAuth.tokens = append([]Token(nil), tokens...)
+	if len(tokens) == 0 {
+		theAuth.anonymous = RoleAdmin
+	} else {
+		theAuth.anonymous = anonymous
+	}
+	return nil
+}
+
+// ParseTokens parses a comma-separated list of name:role:secret tokens, as
+// found in MYHOME_RPC_TOKENS.
+func ParseTokens(s string) ([]Token, error) {
+	var tokens []Token
+	for i, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			// Don't quote the entry: without colons, it may be all secret.
+			return nil, fmt.Errorf("invalid token #%d: expected name:role:secret", i+1)
+		}
+		role, err := ParseRole(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("token %s: %w", parts[0], err)
+		}
+		tokens = append(tokens, Token{Name: parts[0], Role: role, Secret: parts[2]})
+	}
+	return tokens, nil
+}
+
+// AuthEnabled reports whether ConfigureAuth installed any token.
+func AuthEnabled() bool {
+	theAuth.mu.RLock()
+	defer theAuth.mu.RUnlock()
+	return len(theAuth.tokens) > 0
+}
+
+// OnAuthDenied sets the hook called on every rejected request, typically to
+// record it as an event.
+func OnAuthDenied(fn func(ctx context.Context, d Denial)) {
+	theAuth.mu.Lock()
+	defer theAuth.mu.Unlock()
+	theAuth.denied = fn
+}
+
+// authenticate resolves the caller of a request. params are the exact params
+// bytes of the envelope, for signature verification.
+func (a *authorizer) authenticate(auth *Auth, d Dialog, method Verb, params []byte) (Caller, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	c := Caller{Principal: "anonymous", Role: a.anonymous, Src: d.Src}
+	switch {
+	case auth == nil || (auth.Token == "" && auth.Key == ""):
+		return c, nil
+	case auth.Token != "":
+		for _, t := range a.tokens {
+			if subtle.ConstantTimeCompare([]byte(t.Secret), []byte(auth.Token)) == 1 {
+				c.Principal, c.Role = t.Name, t.Role
+				return c, nil
+			}
+		}
+		return c, fmt.Errorf("%w: unknown token", ErrUnauthorized)
+	default:
+		for _, t := range a.tokens {
+			if t.Name != auth.Key {
+				continue
+			}
+			now := a.now()
+			skew := now.Sub(time.Unix(auth.Ts, 0))
+			if skew > AuthMaxSkew || skew < -AuthMaxSkew {
+				return c, fmt.Errorf("%w: signature timestamp off by %v", ErrUnauthorized, skew.Round(time.Second))
+			}
+			want := sign(t.Secret, signedPayload(d, method, auth.Ts, params))
+			if !hmac.Equal([]byte(want), []byte(auth.Sig)) {
+				return c, fmt.Errorf("%w: bad signature for key %s", ErrUnauthorized, auth.Key)
+			}
+			if !a.fresh(auth.Sig, time.Unix(auth.Ts, 0), now) {
+				return c, fmt.Errorf("%w: replayed signature for key %s", ErrUnauthorized, auth.Key)
+			}
+			c.Principal, c.Role = t.Name, t.Role
+			return c, nil
+		}
+		return c, fmt.Errorf("%w: unknown key %s", ErrUnauthorized, auth.Key)
+	}
+}
+
+// fresh records sig, signed at ts, as accepted and reports whether it was not
+// already. Signatures are forgotten once their timestamp is stale.
+func (a *authorizer) fresh(sig string, ts time.Time, now time.Time) bool {
+	a.replayMu.Lock()
+	defer a.replayMu.Unlock()
+	for s, stale := range a.seen {
+		if now.After(stale) {
+			delete(a.seen, s)
+		}
+	}
+	if _, replayed := a.seen[sig]; replayed {
+		return false
+	}
+	if a.seen == nil {
+		a.seen = make(map[string]time.Time)
+	}
+	a.seen[sig] = ts.Add(AuthMaxSkew)
+	return true
+}
+
+// bearer resolves the caller of an HTTP request from its Authorization
+// header value.
+func (a *authorizer) bearer(header string, remote string) (Caller, error) {
+	var auth *Auth
+	if header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return Caller{Principal: "anonymous", Src: remote}, fmt.Errorf("%w: unsupported Authorization scheme", ErrUnauthorized)
+		}
+		auth = &Auth{Token: strings.TrimSpace(token)}
+	}
+	return a.authenticate(auth, Dialog{Src: remote}, "", nil)
+}
+
+// deny reports a rejected request to the OnAuthDenied hook.
+func (a *authorizer) deny(ctx context.Context, c Caller, method Verb, err error) {
+	a.mu.RLock()
+	denied := a.denied
+	a.mu.RUnlock()
+	if denied != nil {
+		denied(ctx, Denial{Caller: c, Method: method, Reason: err.Error()})
+	}
+}
+
+type callerKey struct{}
+
+func withCaller(ctx context.Context, c Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, c)
+}
+
+// CallerFromContext returns the authenticated caller of the request being
+// served, if it came through the RPC server or the /rpc HTTP endpoint.
+func CallerFromContext(ctx context.Context) (Caller, bool) {
+	c, ok := ctx.Value(callerKey{}).(Caller)
+	return c, ok
+}
+
+// Authorize checks the caller found in ctx against the policy of verb.
+// In-process calls, which carry no caller, are always allowed.
+func Authorize(ctx context.Context, verb Verb) error {
+	c, ok := CallerFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if min := VerbRole(verb); !c.Role.Allows(min) {
+		err := fmt.Errorf("%w: %s requires role %s, %s is %q", ErrForbidden, verb, min, c.Principal, c.Role)
+		theAuth.deny(ctx, c, verb, err)
+		return err
+	}
+	return nil
+}
+
+// authenticateRequest resolves the caller of an RPC request received as
+// inMsg and returns ctx carrying it, for Authorize. Failures are reported to
+// the OnAuthDenied hook.
+func authenticateRequest(ctx context.Context, req *request, inMsg []byte) (context.Context, error) {
+	var raw struct {
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(inMsg, &raw); err != nil {
+		return ctx, fmt.Errorf("%w: %w", ErrParse, err)
+	}
+	c, err := theAuth.authenticate(req.Auth, req.Dialog, req.Method, raw.Params)
+	if err != nil {
+		theAuth.deny(ctx, c, req.Method, err)
+		return ctx, err
+	}
+	return withCaller(ctx, c), nil
+}
+
+// AuthenticateBearer resolves the caller of an HTTP request from its
+// Authorization header and returns ctx carrying it, for Authorize. Failures
+// are reported to the OnAuthDenied hook.
+func AuthenticateBearer(ctx context.Context, header string, remote string, method Verb) (context.Context, error) {
+	c, err := theAuth.bearer(header, remote)
+	if err != nil {
+		theAuth.deny(ctx, c, method, err)
+		return ctx, err
+	}
+	return withCaller(ctx, c), nil
+}
@@ -0,0 +1,305 @@
+package myhome
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asnowfix/home-automation/myhome/mqtt"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+)
+
+// resetAuth restores the default (disabled) authentication in t.Cleanup.
+// Tests must NOT call t.Parallel(): the authorizer is package-level.
+func resetAuth(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		theAuth.mu.Lock()
+		defer theAuth.mu.Unlock()
+		theAuth.tokens = nil
+		theAuth.anonymous = RoleAdmin
+		theAuth.denied = nil
+		theAuth.now = time.Now
+		theAuth.replayMu.Lock()
+		theAuth.seen = nil
+		theAuth.replayMu.Unlock()
+	})
+}
+
+func TestParseTokens(t *testing.T) {
+	tokens, err := ParseTokens(" ha:read-only:s3cr:et , ops:Operator:x,")
+	if err != nil {
+		t.Fatalf("ParseTokens: %v", err)
+	}
+	want := []Token{{Name: "ha", Role: RoleReadOnly, Secret: "s3cr:et"}, {Name: "ops", Role: RoleOperator, Secret: "x"}}
+	if len(tokens) != len(want) || tokens[0] != want[0] || tokens[1] != want[1] {
+		t.Errorf("got %+v, want %+v", tokens, want)
+	}
+	for _, bad := range []string{"ha:admin", "ha:root:s"} {
+		if _, err := ParseTokens(bad); err == nil {
+			t.Errorf("ParseTokens(%q): expected an error", bad)
+		}
+	}
+	if _, err := ParseTokens("ha:read-only:x,s3cret"); err == nil || strings.Contains(err.Error(), "s3cret") {
+		t.Errorf("ParseTokens: got %v, want an error not quoting the entry", err)
+	}
+}
+
+// TestAuthenticate verifies API token and HMAC signature checks.
+func TestAuthenticate(t *testing.T) {
+	resetAuth(t)
+	if err := ConfigureAuth([]Token{{Name: "ops", Secret: "ops-secret", Role: RoleOperator}}, RoleReadOnly); err != nil {
+		t.Fatalf("ConfigureAuth: %v", err)
+	}
+	now := time.Now()
+	theAuth.now = func() time.Time { return now }
+
+	d := Dialog{Id: "1", Src: "c", Dst: InstanceName}
+	params := []byte(`{"identifier":"d1"}`)
+	signed := Credentials{Key: "ops", Secret: "ops-secret"}.Auth(d, SwitchOn, params, now)
+
+	tests := []struct {
+		name     string
+		auth     *Auth
+		params   []byte
+		wantRole Role
+		wantErr  bool
+	}{
+		{"anonymous", nil, params, RoleReadOnly, false},
+		{"token", &Auth{Token: "ops-secret"}, params, RoleOperator, false},
+		{"unknown token", &Auth{Token: "nope"}, params, "", true},
+		{"signature", signed, params, RoleOperator, false},
+		{"replayed signature", signed, params, "", true},
+		{"tampered params", signed, []byte(`{"identifier":"d2"}`), "", true},
+		{"unknown key", &Auth{Key: "who", Ts: signed.Ts, Sig: signed.Sig}, params, "", true},
+		{"stale signature", Credentials{Key: "ops", Secret: "ops-secret"}.Auth(d, SwitchOn, params, now.Add(-2*AuthMaxSkew)), params, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := theAuth.authenticate(tt.auth, d, SwitchOn, tt.params)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnauthorized) {
+					t.Errorf("got %v, want ErrUnauthorized", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("authenticate: %v", err)
+			}
+			if c.Role != tt.wantRole {
+				t.Errorf("role: got %q, want %q", c.Role, tt.wantRole)
+			}
+		})
+	}
+}
+
+// TestAuthorize_VerbPolicy verifies the per-verb policy and that denials are
+// reported to the OnAuthDenied hook.
+func TestAuthorize_VerbPolicy(t *testing.T) {
+	resetAuth(t)
+	var denials []Denial
+	OnAuthDenied(func(_ context.Context, d Denial) { denials = append(denials, d) })
+
+	tests := []struct {
+		role    Role
+		verb    Verb
+		allowed bool
+	}{
+		{RoleReadOnly, DeviceShow, true},
+		{RoleReadOnly, SwitchAll, true},
+		{RoleReadOnly, SwitchOn, false},
+		{RoleOperator, SwitchOn, true},
+		{RoleOperator, DeviceForget, false},
+		{RoleAdmin, DeviceSetup, true},
+		{RoleNone, DeviceShow, false},
+	}
+	for _, tt := range tests {
+		ctx := withCaller(context.Background(), Caller{Principal: "p", Role: tt.role})
+		err := Authorize(ctx, tt.verb)
+		if tt.allowed && err != nil {
+			t.Errorf("%s calling %s: unexpected %v", tt.role, tt.verb, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrForbidden) {
+			t.Errorf("%s calling %s: got %v, want ErrForbidden", tt.role, tt.verb, err)
+		}
+	}
+	if len(denials) != 3 {
+		t.Errorf("denials: got %d, want 3", len(denials))
+	}
+	if err := Authorize(context.Background(), DeviceForget); err != nil {
+		t.Errorf("in-process call: unexpected %v", err)
+	}
+}
+
+// TestServer_AuthenticatesRequests verifies that the server rejects bad
+// credentials and verbs above the caller's role before running the handler.
+func TestServer_AuthenticatesRequests(t *testing.T) {
+	resetAuth(t)
+	if err := ConfigureAuth([]Token{{Name: "admin", Secret: "admin-secret", Role: RoleAdmin}}, RoleReadOnly); err != nil {
+		t.Fatalf("ConfigureAuth: %v", err)
+	}
+	ctx, cancel := context.WithCancel(newServerCtx())
+	defer cancel()
+
+	forgotten := make(chan string, 4)
+	handler := verbServer{
+		DeviceForget: &Method{
+			Name: DeviceForget,
+			Signature: MethodSignature{
+				NewParams: func() any { return &DeviceShowParams{} },
+				NewResult: func() any { return nil },
+			},
+			ActionE: func(_ context.Context, in any) (any, error) {
+				forgotten <- in.(*DeviceShowParams).Identifier
+				return nil, nil
+			},
+		},
+	}
+	mc := mqtt.NewRecordingMockClient()
+	if _, err := NewServerE(ctx, mc, handler); err != nil {
+		t.Fatalf("NewServerE: %v", err)
+	}
+
+	tests := []struct {
+		src      string
+		creds    Credentials
+		wantCode ErrorCode // 0 for success
+	}{
+		{"anonymous", Credentials{}, ErrCodeForbidden},
+		{"bad-token", Credentials{Secret: "guess"}, ErrCodeUnauthorized},
+		{"bad-signature", Credentials{Key: "admin", Secret: "guess"}, ErrCodeUnauthorized},
+		{"token", Credentials{Secret: "admin-secret"}, 0},
+		{"signed", Credentials{Key: "admin", Secret: "admin-secret"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			req := request{
+				Dialog: Dialog{Id: "auth-" + tt.src, Src: tt.src, Dst: InstanceName},
+				Method: DeviceForget,
+				Params: &DeviceShowParams{Identifier: tt.src},
+			}
+			if err := tt.creds.seal(&req); err != nil {
+				t.Fatalf("seal: %v", err)
+			}
+			feedRequest(t, mc, req)
+
+			var res struct {
+				Error *Error `json:"error"`
+			}
+			if err := json.Unmarshal(waitPublished(t, mc, ClientTopic(tt.src)), &res); err != nil {
+				t.Fatalf("unmarshal response: %v", err)
+			}
+			switch {
+			case tt.wantCode == 0 && res.Error != nil:
+				t.Fatalf("unexpected error: %+v", res.Error)
+			case tt.wantCode != 0 && (res.Error == nil || res.Error.Code != tt.wantCode):
+				t.Fatalf("error: got %+v, want code %d", res.Error, tt.wantCode)
+			case tt.wantCode == 0:
+				if got := <-forgotten; got != tt.src {
+					t.Errorf("handler params: got %q, want %q", got, tt.src)
+				}
+			}
+		})
+	}
+	if len(forgotten) != 0 {
+		t.Errorf("handler ran for a rejected request: %q", <-forgotten)
+	}
+}
+
+// TestServer_CancelIsAuthenticated verifies that rpc.cancel only aborts a
+// request for the principal that sent it, even from the same source, and
+// that no credential ends up in the server log.
+func TestServer_CancelIsAuthenticated(t *testing.T) {
+	resetAuth(t)
+	if err := ConfigureAuth([]Token{
+		{Name: "alice", Secret: "alice-secret", Role: RoleOperator},
+		{Name: "bob", Secret: "bob-secret", Role: RoleOperator},
+	}, RoleNone); err != nil {
+		t.Fatalf("ConfigureAuth: %v", err)
+	}
+	var logs strings.Builder
+	var logsMu sync.Mutex
+	log := funcr.New(func(prefix, args string) {
+		logsMu.Lock()
+		defer logsMu.Unlock()
+		logs.WriteString(args + "\n")
+	}, funcr.Options{Verbosity: 1})
+	ctx, cancel := context.WithCancel(logr.NewContext(context.Background(), log))
+	defer cancel()
+
+	mc := mqtt.NewRecordingMockClient()
+	aborted := make(chan error, 1)
+	if _, err := NewServerE(ctx, mc, verbServer{"test.slow": blockingMethod("test.slow", aborted)}); err != nil {
+		t.Fatalf("NewServerE: %v", err)
+	}
+
+	const src = "shared-client"
+	send := func(id string, method Verb, params any, creds Credentials) {
+		t.Helper()
+		req := request{Dialog: Dialog{Id: id, Src: src, Dst: InstanceName}, Method: method, Params: params}
+		if err := creds.seal(&req); err != nil {
+			t.Fatalf("seal: %v", err)
+		}
+		feedRequest(t, mc, req)
+	}
+	send("s-1", "test.slow", nil, Credentials{Secret: "alice-secret"})
+	send("s-2", RpcCancel, CancelParams{Id: "s-1"}, Credentials{})
+	send("s-3", RpcCancel, CancelParams{Id: "s-1"}, Credentials{Secret: "bob-secret"})
+	select {
+	case err := <-aborted:
+		t.Fatalf("request aborted by another principal's cancel: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	send("s-4", RpcCancel, CancelParams{Id: "s-1"}, Credentials{Secret: "alice-secret"})
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("rpc.cancel did not abort the handler")
+	}
+
+	logsMu.Lock()
+	defer logsMu.Unlock()
+	for _, secret := range []string{"alice-secret", "bob-secret"} {
+		if strings.Contains(logs.String(), secret) {
+			t.Errorf("server log contains the token %q", secret)
+		}
+	}
+}
+
+// TestBatch_AuthorizesEachCall verifies that a batch does not let a caller
+// run verbs its role does not allow.
+func TestBatch_AuthorizesEachCall(t *testing.T) {
+	resetAuth(t)
+	called := false
+	resolve := verbServer{
+		DeviceForget: &Method{
+			Name: DeviceForget,
+			Signature: MethodSignature{
+				NewParams: func() any { return nil },
+				NewResult: func() any { return nil },
+			},
+			ActionE: func(context.Context, any) (any, error) {
+				called = true
+				return nil, nil
+			},
+		},
+	}.MethodE
+	ctx := withCaller(context.Background(), Caller{Principal: "ro", Role: RoleReadOnly})
+	out, err := batchHandler(resolve)(ctx, &BatchParams{Calls: []BatchCall{{Method: DeviceForget}}})
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	items := out.(*BatchResult).Items
+	if len(items) != 1 || items[0].Error == nil || items[0].Error.Code != ErrCodeForbidden {
+		t.Errorf("items: got %+v, want one ErrCodeForbidden", items)
+	}
+	if called {
+		t.Error("forbidden batch call ran")
+	}
+}
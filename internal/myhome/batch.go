@@ -0,0 +1,100 @@
+package myhome
+
+// Batch RPC types & server-side handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// MaxBatchSize bounds the number of calls in one rpc.batch request.
+const MaxBatchSize = 64
+
+// BatchCall is one call of an rpc.batch request.
+type BatchCall struct {
+	Method Verb `json:"method"`
+	Params any  `json:"params,omitempty"`
+}
+
+// BatchParams represents parameters for rpc.batch
+type BatchParams struct {
+	Calls []BatchCall `json:"calls"`
+}
+
+// BatchItem is the outcome of one BatchCall: either Result or Error is set.
+// Over the wire Result is decoded generically; client.BatchE converts it to
+// the call's result type, like CallE does.
+type BatchItem struct {
+	Result any    `json:"result,omitempty"`
+	Error  *Error `json:"error,omitempty"`
+}
+
+// Err returns the item error, or nil (not a typed nil *Error) on success.
+func (i BatchItem) Err() error {
+	if i.Error == nil {
+		return nil
+	}
+	return i.Error
+}
+
+// BatchResult represents the result of rpc.batch: one item per call, in the
+// order of BatchParams.Calls.
+type BatchResult struct {
+	Items []BatchItem `json:"items"`
+}
+
+// batchHandler returns the rpc.batch MethodHandler, resolving each call with
+// resolve. Calls run one after the other, in order, within the deadline of
+// the batch request; a failing call does not stop the ones after it.
+func batchHandler(resolve func(Verb) (*Method, error)) MethodHandler {
+	return func(ctx context.Context, in any) (any, error) {
+		params, ok := in.(*BatchParams)
+		if !ok {
+			return nil, fmt.Errorf("%w: unexpected type %T", ErrInvalidParams, in)
+		}
+		if len(params.Calls) > MaxBatchSize {
+			return nil, fmt.Errorf("%w: %d calls in batch, at most %d allowed", ErrInvalidParams, len(params.Calls), MaxBatchSize)
+		}
+
+		res := &BatchResult{Items: make([]BatchItem, len(params.Calls))}
+		for i, call := range params.Calls {
+			out, err := batchCall(ctx, resolve, call)
+			if err != nil {
+				res.Items[i].Error = ErrorOf(err)
+				continue
+			}
+			res.Items[i].Result = out
+		}
+		return res, nil
+	}
+}
+
+func batchCall(ctx context.Context, resolve func(Verb) (*Method, error), call BatchCall) (any, error) {
+	if call.Method == RpcBatch {
+		return nil, fmt.Errorf("%w: nested %s", ErrInvalidRequest, RpcBatch)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	method, err := resolve(call.Method)
+	if err != nil {
+		return nil, err
+	}
+
+	// call.Params was decoded generically: re-do it with the proper type
+	params := method.Signature.NewParams()
+	if call.Params != nil {
+		raw, err := json.Marshal(call.Params)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidParams, err)
+		}
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidParams, err)
+		}
+	}
+	if err := Authorize(ctx, call.Method); err != nil {
+		return nil, err
+	}
+	return method.ActionE(ctx, params)
+}
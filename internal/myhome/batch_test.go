@@ -0,0 +1,161 @@
+package myhome
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/asnowfix/home-automation/myhome/mqtt"
+	"github.com/go-logr/logr"
+)
+
+// TestServer_Batch verifies that rpc.batch runs every call in order and
+// reports per-call results and errors in a single response.
+func TestServer_Batch(t *testing.T) {
+	ctx, cancel := context.WithCancel(newServerCtx())
+	defer cancel()
+
+	withHandler(t, DeviceShow, func(_ context.Context, in any) (any, error) {
+		p, ok := in.(*DeviceShowParams)
+		if !ok {
+			return nil, fmt.Errorf("%w: unexpected type %T", ErrInvalidParams, in)
+		}
+		if p.Identifier != "known" {
+			return nil, fmt.Errorf("%w: device %s", ErrNotFound, p.Identifier)
+		}
+		return &Device{DeviceSummary: DeviceSummary{DeviceIdentifier: DeviceIdentifier{Id_: "known"}}}, nil
+	})
+
+	mc := mqtt.NewRecordingMockClient()
+	if _, err := NewServerE(ctx, mc, registryServer{}); err != nil {
+		t.Fatalf("NewServerE: %v", err)
+	}
+
+	const src = "batch-client"
+	feedRequest(t, mc, request{
+		Dialog: Dialog{Id: "batch-1", Src: src, Dst: InstanceName},
+		Method: RpcBatch,
+		Params: BatchParams{Calls: []BatchCall{
+			{Method: DeviceShow, Params: DeviceShowParams{Identifier: "known"}},
+			{Method: DeviceShow, Params: DeviceShowParams{Identifier: "unknown"}},
+			{Method: "no.such.verb"},
+			{Method: RpcBatch, Params: BatchParams{}},
+		}},
+	})
+
+	raw := waitPublished(t, mc, ClientTopic(src))
+	var res struct {
+		Result BatchResult `json:"result"`
+		Error  *Error      `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &res); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if res.Error != nil {
+		t.Fatalf("batch failed: %+v", res.Error)
+	}
+	items := res.Result.Items
+	if len(items) != 4 {
+		t.Fatalf("items: got %d, want 4", len(items))
+	}
+	if items[0].Error != nil || items[0].Result == nil {
+		t.Errorf("item 0: got result=%v error=%+v, want a result", items[0].Result, items[0].Error)
+	}
+	wantCodes := []ErrorCode{0, ErrCodeNotFound, ErrCodeMethodNotFound, ErrCodeInvalidRequest}
+	for i := 1; i < len(items); i++ {
+		if items[i].Error == nil || items[i].Error.Code != wantCodes[i] {
+			t.Errorf("item %d: got error %+v, want code %d", i, items[i].Error, wantCodes[i])
+		}
+	}
+}
+
+// TestBatchHandler_TooManyCalls verifies the MaxBatchSize bound.
+func TestBatchHandler_TooManyCalls(t *testing.T) {
+	h := batchHandler(Methods)
+	_, err := h(context.Background(), &BatchParams{Calls: make([]BatchCall, MaxBatchSize+1)})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("got %v, want errors.Is ErrInvalidParams", err)
+	}
+}
+
+// TestClient_BatchETypedResults verifies that BatchE converts each item
+// result to its call's result type, and keeps item errors typed.
+func TestClient_BatchETypedResults(t *testing.T) {
+	ctx, cancel := context.WithCancel(newServerCtx())
+	defer cancel()
+
+	mc := mqtt.NewRecordingMockClient()
+	c, err := NewClientE(ctx, logr.Discard(), mc, time.Second)
+	if err != nil {
+		t.Fatalf("NewClientE: %v", err)
+	}
+
+	type result struct {
+		items []BatchItem
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		items, err := c.BatchE(ctx, []BatchCall{
+			{Method: PoolGetStatus, Params: nil},
+			{Method: DeviceShow, Params: &DeviceShowParams{Identifier: "nope"}},
+		})
+		done <- result{items, err}
+	}()
+
+	raw := waitPublished(t, mc, ServerTopic())
+	var req request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		t.Fatalf("unmarshal request: %v", err)
+	}
+	if req.Method != RpcBatch {
+		t.Fatalf("method: got %q, want %q", req.Method, RpcBatch)
+	}
+	var out any = &BatchResult{Items: []BatchItem{
+		{Result: PoolGetStatusResult{DeviceID: "pool"}},
+		{Error: ErrorOf(fmt.Errorf("%w: device nope", ErrNotFound))},
+	}}
+	res, _ := json.Marshal(response{
+		Dialog: Dialog{Id: req.Id, Src: InstanceName, Dst: mc.Id()},
+		Result: &out,
+	})
+	mc.Feed(ClientTopic(mc.Id()), res)
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatalf("BatchE: %v", r.err)
+		}
+		if len(r.items) != 2 {
+			t.Fatalf("items: got %d, want 2", len(r.items))
+		}
+		if got, ok := r.items[0].Result.(*PoolGetStatusResult); !ok || got.DeviceID != "pool" {
+			t.Errorf("item 0 result: got %#v", r.items[0].Result)
+		}
+		if !errors.Is(r.items[1].Err(), ErrNotFound) {
+			t.Errorf("item 1 error: got %v, want errors.Is ErrNotFound", r.items[1].Err())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BatchE did not return")
+	}
+}
+
+// TestClient_BatchERejectsBadParams verifies that BatchE checks each call's
+// params type before sending anything.
+func TestClient_BatchERejectsBadParams(t *testing.T) {
+	mc := mqtt.NewRecordingMockClient()
+	c, err := NewClientE(newServerCtx(), logr.Discard(), mc, time.Second)
+	if err != nil {
+		t.Fatalf("NewClientE: %v", err)
+	}
+	_, err = c.BatchE(context.Background(), []BatchCall{{Method: DeviceShow, Params: "not-params"}})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("got %v, want errors.Is ErrInvalidParams", err)
+	}
+	if msgs := mc.Published(ServerTopic()); len(msgs) != 0 {
+		t.Errorf("invalid batch was published: %s", msgs[0])
+	}
+}
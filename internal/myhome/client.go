@@ -25,6 +25,11 @@ type client struct {
 	me      string
 	timeout time.Duration
 	mc      mqtt.Client
+	// Frames received on the client topic are demultiplexed by dispatch():
+	// responses by request id, notifications by subscription id.
+	routes  sync.Mutex
+	pending map[string]chan []byte
+	subs    map[string]chan Notification
 }
 
 func NewClientE(ctx context.Context, log logr.Logger, mc mqtt.Client, timeout time.Duration) (Client, error) {
@@ -32,6 +37,8 @@ func NewClientE(ctx context.Context, log logr.Logger, mc mqtt.Client, timeout ti
 		log:     log,
 		timeout: timeout,
 		mc:      mc,
+		pending: make(map[string]chan []byte),
+		subs:    make(map[string]chan Notification),
 	}
 	return c, nil
 }
@@ -54,6 +61,7 @@ func (hc *client) start(ctx context.Context) {
 	}
 	// Note: Subscriber() waits for MQTT subscription ACK via token.WaitTimeout()
 	// so the subscription is guaranteed to be active when it returns successfully
+	go hc.dispatch(hc.from)
 
 	hc.to, err = hc.mc.Publisher(ctx, ServerTopic(), 8, mqtt.AtLeastOnce, false, InstanceName+"/client")
 	if err != nil {
@@ -64,6 +72,49 @@ func (hc *client) start(ctx context.Context) {
 	hc.log.Info("Started client", "me", hc.mc.Id())
 }
 
+// dispatch routes every frame received on the client topic: notifications
+// (which carry a subscription id) to their subscriber channel, responses to
+// the CallE waiting for their request id. Frames nobody waits for anymore
+// (late responses, notifications for a released subscription) are dropped.
+func (hc *client) dispatch(from <-chan []byte) {
+	for msg := range from {
+		var frame struct {
+			Id           string       `json:"id"`
+			Method       NotifyMethod `json:"method"`
+			Subscription string       `json:"subscription"`
+		}
+		if err := json.Unmarshal(msg, &frame); err != nil {
+			hc.log.Error(err, "Failed to unmarshal frame", "payload", string(msg))
+			continue
+		}
+
+		hc.routes.Lock()
+		if frame.Subscription != "" {
+			ch, exists := hc.subs[frame.Subscription]
+			if exists {
+				var n Notification
+				if err := json.Unmarshal(msg, &n); err != nil {
+					hc.log.Error(err, "Failed to unmarshal notification", "payload", string(msg))
+				} else {
+					select {
+					case ch <- n:
+					default:
+						hc.log.Info("Dropping notification: subscriber too slow", "subscription", frame.Subscription, "method", frame.Method)
+					}
+				}
+			} else {
+				hc.log.V(1).Info("Dropping notification for unknown subscription", "subscription", frame.Subscription)
+			}
+		} else if ch, exists := hc.pending[frame.Id]; exists {
+			ch <- msg // buffered, one response per request
+			delete(hc.pending, frame.Id)
+		} else {
+			hc.log.V(1).Info("Dropping response nobody waits for", "request_id", frame.Id)
+		}
+		hc.routes.Unlock()
+	}
+}
+
 // func (hc *client) Shutdown() {
 // 	hc.lock.Lock()
 // 	defer hc.lock.Unlock()
@@ -148,22 +199,32 @@ func (hc *client) CallE(ctx context.Context, method Verb, params any) (any, erro
 
 	m, exists := signatures[method]
 	if !exists {
-		return Method{}, fmt.Errorf("unknown method %s", method)
+		return Method{}, fmt.Errorf("%w: unknown method %s", ErrMethodNotFound, method)
 	}
 
 	if reflect.TypeOf(params) != reflect.TypeOf(m.NewParams()) {
-		err := fmt.Errorf("invalid parameter type for method %s: got %v, should be %v", method, reflect.TypeOf(params), reflect.TypeOf(m.NewParams()))
+		err := fmt.Errorf("%w: invalid parameter type for method %s: got %v, should be %v", ErrInvalidParams, method, reflect.TypeOf(params), reflect.TypeOf(m.NewParams()))
 		hc.log.Error(err, "Invalid parameter type")
 		return nil, err
 	}
+	// The server gets the same deadline the caller waits for: the earliest of
+	// the client timeout and the caller's own context deadline.
+	deadline := time.Now().Add(hc.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
 	req := request{
 		Dialog: Dialog{
 			Id:  requestId,
 			Src: hc.me,
 			Dst: InstanceName,
 		},
-		Method: method,
-		Params: params,
+		Method:   method,
+		Params:   params,
+		Deadline: &deadline,
+	}
+	if err := TheCredentials.seal(&req); err != nil {
+		return nil, err
 	}
 	reqStr, err := json.Marshal(req)
 	if err != nil {
@@ -174,20 +235,35 @@ func (hc *client) CallE(ctx context.Context, method Verb, params any) (any, erro
 		return nil, err
 	}
 
-	hc.log.Info("Calling method", "method", req.Method, "params", req.Params, "request_id", requestId, "dst", req.Dst)
+	resCh := make(chan []byte, 1)
+	hc.routes.Lock()
+	hc.pending[requestId] = resCh
+	hc.routes.Unlock()
+	defer func() {
+		hc.routes.Lock()
+		delete(hc.pending, requestId)
+		hc.routes.Unlock()
+	}()
+
+	hc.log.Info("Calling method", "method", req.Method, "params", params, "request_id", requestId, "dst", req.Dst)
 	hc.to <- reqStr
 	hc.log.Info("Request published", "topic", ServerTopic(), "request_id", requestId)
 
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
 	var resStr []byte
 	select {
 	case <-ctx.Done():
 		// Don't log context cancellation as an error
+		hc.cancel(requestId)
 		return nil, ctx.Err()
-	case resStr = <-hc.from:
+	case resStr = <-resCh:
 		hc.log.Info("Response received", "payload", string(resStr), "request_id", requestId)
 		break
-	case <-time.After(hc.timeout):
-		return nil, fmt.Errorf("timeout waiting for response to method %s after %v (request_id: %s, dst: %s, topic: %s)",
+	case <-timer.C:
+		hc.cancel(requestId)
+		return nil, Errorf(ErrCodeTimeout, "timeout waiting for response to method %s after %v (request_id: %s, dst: %s, topic: %s)",
 			method, hc.timeout, requestId, req.Dst, ClientTopic(hc.me))
 	}
 
@@ -203,6 +279,11 @@ func (hc *client) CallE(ctx context.Context, method Verb, params any) (any, erro
 		return nil, err
 	}
 
+	if res.Error != nil {
+		// *Error: callers can errors.Is it against the sentinels in errors.go
+		return nil, res.Error
+	}
+
 	rs, err := json.Marshal(res.Result)
 	if err != nil {
 		hc.log.Error(err, "Failed to re-marshal response.result", "result", res.Result)
@@ -216,9 +297,153 @@ func (hc *client) CallE(ctx context.Context, method Verb, params any) (any, erro
 		return nil, err
 	}
 
-	if res.Error != nil {
-		return nil, fmt.Errorf("%v (code:%v)", res.Error.Message, res.Error.Code)
+	return result, nil
+}
+
+func (hc *client) BatchE(ctx context.Context, calls []BatchCall) ([]BatchItem, error) {
+	for _, call := range calls {
+		m, exists := signatures[call.Method]
+		if !exists {
+			return nil, fmt.Errorf("%w: unknown method %s", ErrMethodNotFound, call.Method)
+		}
+		if reflect.TypeOf(call.Params) != reflect.TypeOf(m.NewParams()) {
+			return nil, fmt.Errorf("%w: invalid parameter type for method %s: got %v, should be %v", ErrInvalidParams, call.Method, reflect.TypeOf(call.Params), reflect.TypeOf(m.NewParams()))
+		}
 	}
 
-	return result, nil
+	out, err := hc.CallE(ctx, RpcBatch, &BatchParams{Calls: calls})
+	if err != nil {
+		return nil, err
+	}
+	res, ok := out.(*BatchResult)
+	if !ok {
+		return nil, fmt.Errorf("expected *myhome.BatchResult, got %T", out)
+	}
+	if len(res.Items) != len(calls) {
+		return nil, fmt.Errorf("%w: got %d batch items for %d calls", ErrInternal, len(res.Items), len(calls))
+	}
+
+	// Items were decoded generically: re-do it with each call's result type
+	for i, item := range res.Items {
+		if item.Error != nil || item.Result == nil {
+			continue
+		}
+		rs, err := json.Marshal(item.Result)
+		if err != nil {
+			return nil, err
+		}
+		result := signatures[calls[i].Method].NewResult()
+		if err := json.Unmarshal(rs, &result); err != nil {
+			hc.log.Error(err, "Failed to re-unmarshal batch item result", "method", calls[i].Method, "payload", rs)
+			res.Items[i].Error = Errorf(ErrCodeInternal, "failed to decode %s result: %v", calls[i].Method, err)
+			res.Items[i].Result = nil
+			continue
+		}
+		res.Items[i].Result = result
+	}
+	return res.Items, nil
+}
+
+// cancel tells the server to abort request id, which this client no longer
+// waits for. It is best-effort: the message is dropped if the publisher
+// queue is full, and the server's deadline aborts the request anyway.
+func (hc *client) cancel(id string) {
+	requestId, err := RandStringBytesMaskImprRandReaderUnsafe(16)
+	if err != nil {
+		hc.log.Error(err, "Failed to generate cancel request id")
+		return
+	}
+	req := request{
+		Dialog: Dialog{
+			Id:  requestId,
+			Src: hc.me,
+			Dst: InstanceName,
+		},
+		Method: RpcCancel,
+		Params: &CancelParams{Id: id},
+	}
+	if err := TheCredentials.seal(&req); err != nil {
+		hc.log.Error(err, "Failed to sign cancel request")
+		return
+	}
+	reqStr, err := json.Marshal(req)
+	if err != nil {
+		hc.log.Error(err, "Failed to marshal cancel request")
+		return
+	}
+	select {
+	case hc.to <- reqStr:
+		hc.log.V(1).Info("Cancel published", "request_id", id)
+	default:
+		hc.log.Info("Dropping cancel: publisher queue full", "request_id", id)
+	}
+}
+
+func (hc *client) SubscribeE(ctx context.Context, method Verb, params *SubscribeParams) (<-chan Notification, error) {
+	out, err := hc.CallE(ctx, method, params)
+	if err != nil {
+		return nil, err
+	}
+	res, ok := out.(*SubscribeResult)
+	if !ok {
+		return nil, fmt.Errorf("expected *myhome.SubscribeResult, got %T", out)
+	}
+
+	ch := make(chan Notification, 64)
+	id := res.SubscriptionId
+	hc.routes.Lock()
+	hc.subs[id] = ch
+	hc.routes.Unlock()
+	hc.log.Info("Subscribed", "method", method, "subscription", id, "lease", res.Lease)
+
+	lease := res.Lease
+	if lease <= 0 {
+		lease = SubscriptionLease
+	}
+
+	go func() {
+		ticker := time.NewTicker(lease / 2)
+		defer ticker.Stop()
+		defer func() {
+			hc.routes.Lock()
+			delete(hc.subs, id)
+			hc.routes.Unlock()
+			close(ch)
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				// Release the subscription server-side; if this fails the
+				// lease will expire on its own anyway.
+				uctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), hc.timeout)
+				defer cancel()
+				if _, err := hc.CallE(uctx, Unsubscribe, &UnsubscribeParams{SubscriptionId: id}); err != nil {
+					hc.log.Error(err, "Failed to unsubscribe", "subscription", id)
+				}
+				return
+			case <-ticker.C:
+				renew := *params
+				renew.SubscriptionId = id
+				out, err := hc.CallE(ctx, method, &renew)
+				if err != nil {
+					hc.log.Error(err, "Failed to renew subscription", "subscription", id)
+					continue
+				}
+				res, ok := out.(*SubscribeResult)
+				if !ok || res.SubscriptionId == id {
+					continue
+				}
+				// The server forgot us (e.g. it restarted): follow the new id.
+				hc.log.Info("Subscription re-created by server", "old", id, "new", res.SubscriptionId)
+				hc.routes.Lock()
+				delete(hc.subs, id)
+				id = res.SubscriptionId
+				hc.subs[id] = ch
+				hc.routes.Unlock()
+			}
+		}
+	}()
+
+	return ch, nil
 }
@@ -21,6 +21,8 @@ const (
 	DeviceRefresh                 Verb = "device.refresh"
 	DeviceSetup                   Verb = "device.setup"
 	DeviceUpdate                  Verb = "device.update"
+	DeviceHistory                 Verb = "device.history"
+	DeviceSetAuth                 Verb = "device.setauth"
 	TemperatureGet                Verb = "temperature.get"
 	TemperatureSet                Verb = "temperature.set"
 	TemperatureList               Verb = "temperature.list"
@@ -47,6 +49,14 @@ const (
 	SwitchStatus                  Verb = "switch.status"
 	SwitchAll                     Verb = "switch.all"
 	EventList                     Verb = "event.list"
+	EventSubscribe                Verb = "event.subscribe"
+	EventRecord                   Verb = "event.record"
+	DeviceWatch                   Verb = "device.watch"
+	Unsubscribe                   Verb = "rpc.unsubscribe"
+	RpcCancel                     Verb = "rpc.cancel"
+	RpcBatch                      Verb = "rpc.batch"
+	RpcList                       Verb = "rpc.list"
+	RpcDescribe                   Verb = "rpc.describe"
 	PoolGetStatus                 Verb = "pool.getstatus"
 	SolarClaimersList             Verb = "solar.claimerslist"
 	FetchList                     Verb = "fetch.list"
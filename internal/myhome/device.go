@@ -273,6 +273,14 @@ type DeviceSetupParams struct {
 	ApPasswd   string `json:"ap_passwd,omitempty"`   // WiFi AP password
 }
 
+// DeviceSetAuthParams represents parameters for device.setauth RPC. It
+// carries no credentials: the daemon picks the password and sets it on the
+// device itself.
+type DeviceSetAuthParams struct {
+	Identifier string `json:"identifier"` // Device identifier (id/name/host/MAC/IP)
+	Enable     bool   `json:"enable"`     // Enable (or rotate) authentication, or disable it
+}
+
 // DeviceSetRoomParams represents parameters for device.setroom RPC
 type DeviceSetRoomParams struct {
 	Identifier string `json:"identifier"` // Device identifier (id/name/host/MAC/IP)
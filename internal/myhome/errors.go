@@ -0,0 +1,100 @@
+package myhome
+
+// RPC error codes & their Go errors
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrorCode classifies an RPC failure. The protocol-level codes are the
+// JSON-RPC 2.0 ones; the application-level ones use the implementation-defined
+// server error range (-32000 to -32099).
+type ErrorCode int
+
+const (
+	ErrCodeParse          ErrorCode = -32700 // Request payload is not valid JSON
+	ErrCodeInvalidRequest ErrorCode = -32600 // Request envelope is invalid (e.g. missing id/src/dst)
+	ErrCodeMethodNotFound ErrorCode = -32601 // Unknown or unregistered verb
+	ErrCodeInvalidParams  ErrorCode = -32602 // Params do not match the verb signature
+	ErrCodeInternal       ErrorCode = -32603 // Any other failure
+	ErrCodeNotFound       ErrorCode = -32000 // Unknown device, room, subscription...
+	ErrCodeTimeout        ErrorCode = -32001 // Deadline passed
+	ErrCodeUnreachable    ErrorCode = -32002 // Device did not answer
+	ErrCodeConflict       ErrorCode = -32003 // Request clashes with the current state
+	ErrCodeUnauthorized   ErrorCode = -32004 // Missing, unknown or badly signed credentials
+	ErrCodeForbidden      ErrorCode = -32005 // Caller's role may not call this verb
+	ErrCodeCancelled      ErrorCode = -32006 // Caller gave up (rpc.cancel, closed connection)
+	ErrCodeBusy           ErrorCode = -32007 // Too many requests pending: retry later
+)
+
+// Sentinel errors for each code. Handlers return them wrapped, to keep a
+// meaningful message:
+//
+//	return nil, fmt.Errorf("%w: device %s", myhome.ErrNotFound, id)
+//
+// and callers of client.CallE test them with errors.Is:
+//
+//	if errors.Is(err, myhome.ErrNotFound) { ... }
+var (
+	ErrParse          = &Error{Code: ErrCodeParse, Message: "parse error"}
+	ErrInvalidRequest = &Error{Code: ErrCodeInvalidRequest, Message: "invalid request"}
+	ErrMethodNotFound = &Error{Code: ErrCodeMethodNotFound, Message: "method not found"}
+	ErrInvalidParams  = &Error{Code: ErrCodeInvalidParams, Message: "invalid params"}
+	ErrInternal       = &Error{Code: ErrCodeInternal, Message: "internal error"}
+	ErrNotFound       = &Error{Code: ErrCodeNotFound, Message: "not found"}
+	ErrTimeout        = &Error{Code: ErrCodeTimeout, Message: "timeout"}
+	ErrUnreachable    = &Error{Code: ErrCodeUnreachable, Message: "device unreachable"}
+	ErrConflict       = &Error{Code: ErrCodeConflict, Message: "conflict"}
+	ErrUnauthorized   = &Error{Code: ErrCodeUnauthorized, Message: "unauthorized"}
+	ErrForbidden      = &Error{Code: ErrCodeForbidden, Message: "forbidden"}
+	ErrCancelled      = &Error{Code: ErrCodeCancelled, Message: "cancelled"}
+	ErrBusy           = &Error{Code: ErrCodeBusy, Message: "server busy"}
+)
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is an *Error with the same code, so that an
+// error decoded from a response matches the corresponding sentinel.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// ErrorOf converts a handler error into the response error sent to the
+// caller. Wrapped sentinels keep their code; well-known causes that handlers
+// commonly pass through unwrapped are classified too (missing database row,
+// expired or cancelled context, network failure); anything else is
+// ErrCodeInternal.
+func ErrorOf(err error) *Error {
+	code := ErrCodeInternal
+	var e *Error
+	var ne net.Error
+	var oe *net.OpError
+	switch {
+	case errors.As(err, &e):
+		code = e.Code
+	case errors.Is(err, sql.ErrNoRows):
+		code = ErrCodeNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		code = ErrCodeTimeout
+	case errors.Is(err, context.Canceled):
+		code = ErrCodeCancelled
+	case errors.As(err, &oe):
+		code = ErrCodeUnreachable
+	case errors.As(err, &ne) && ne.Timeout():
+		code = ErrCodeTimeout
+	}
+	return &Error{Code: code, Message: err.Error()}
+}
+
+// Errorf returns an error with the given code, for cases no sentinel
+// wrapping fits (e.g. errors rebuilt from a response).
+func Errorf(code ErrorCode, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,100 @@
+package myhome
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/asnowfix/home-automation/myhome/mqtt"
+	"github.com/go-logr/logr"
+)
+
+// TestErrorOf verifies the code derived from handler errors.
+func TestErrorOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCode
+	}{
+		{"wrapped sentinel", fmt.Errorf("%w: device d1", ErrNotFound), ErrCodeNotFound},
+		{"doubly wrapped sentinel", fmt.Errorf("refresh: %w", fmt.Errorf("%w: d1", ErrUnreachable)), ErrCodeUnreachable},
+		{"missing row", fmt.Errorf("lookup: %w", sql.ErrNoRows), ErrCodeNotFound},
+		{"deadline", context.DeadlineExceeded, ErrCodeTimeout},
+		{"cancelled", fmt.Errorf("refresh: %w", context.Canceled), ErrCodeCancelled},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrCodeUnreachable},
+		{"plain", errors.New("boom"), ErrCodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := ErrorOf(tt.err)
+			if e.Code != tt.want {
+				t.Errorf("code: got %d, want %d", e.Code, tt.want)
+			}
+			if e.Message != tt.err.Error() {
+				t.Errorf("message: got %q, want %q", e.Message, tt.err.Error())
+			}
+		})
+	}
+}
+
+// TestError_IsMatchesDecodedCode verifies that an error decoded from a
+// response matches its sentinel with errors.Is, and no other.
+func TestError_IsMatchesDecodedCode(t *testing.T) {
+	var e Error
+	if err := json.Unmarshal([]byte(`{"code":-32000,"message":"not found: device d1"}`), &e); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !errors.Is(&e, ErrNotFound) {
+		t.Error("decoded error does not match ErrNotFound")
+	}
+	if errors.Is(&e, ErrConflict) {
+		t.Error("decoded error matches ErrConflict")
+	}
+}
+
+// TestClient_CallEReturnsTypedError verifies that an error response surfaces
+// from CallE as an error callers can test with errors.Is.
+func TestClient_CallEReturnsTypedError(t *testing.T) {
+	ctx, cancel := context.WithCancel(newServerCtx())
+	defer cancel()
+
+	mc := mqtt.NewRecordingMockClient()
+	c, err := NewClientE(ctx, logr.Discard(), mc, time.Second)
+	if err != nil {
+		t.Fatalf("NewClientE: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.CallE(ctx, DeviceShow, &DeviceShowParams{Identifier: "nope"})
+		done <- err
+	}()
+
+	raw := waitPublished(t, mc, ServerTopic())
+	var req request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		t.Fatalf("unmarshal request: %v", err)
+	}
+	res, _ := json.Marshal(response{
+		Dialog: Dialog{Id: req.Id, Src: InstanceName, Dst: mc.Id()},
+		Error:  ErrorOf(fmt.Errorf("%w: device nope", ErrNotFound)),
+	})
+	mc.Feed(ClientTopic(mc.Id()), res)
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("CallE error: got %v, want errors.Is ErrNotFound", err)
+		}
+		if err == nil || err.Error() != "not found: device nope" {
+			t.Errorf("CallE error message: got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("CallE did not return")
+	}
+}
@@ -1,6 +1,9 @@
 package myhome
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // EventListRequest is the parameter type for the event.list RPC verb.
 type EventListRequest struct {
@@ -18,6 +21,33 @@ type EventListResponse struct {
 	Total  int         `json:"total"`
 }
 
+// EventRecordRequest is the parameter type for the event.record RPC verb,
+// used by tools (e.g. the firmware rollout of myhome ctl) to add to the event
+// log what they did to devices.
+type EventRecordRequest struct {
+	DeviceID  string  `json:"device_id"`
+	Component string  `json:"component"`
+	Event     string  `json:"event"`
+	Severity  string  `json:"severity,omitempty"`
+	Data      *string `json:"data,omitempty"`
+}
+
+// RecordableEventPrefix prefixes the only events event.record accepts: those
+// of the firmware rollout. Device events come from the devices themselves,
+// and cannot be forged.
+const RecordableEventPrefix = "firmware."
+
+// Validate returns an ErrCodeInvalidParams error if r cannot be recorded.
+func (r *EventRecordRequest) Validate() error {
+	if r.DeviceID == "" || r.Event == "" {
+		return Errorf(ErrCodeInvalidParams, "device_id and event are required")
+	}
+	if !strings.HasPrefix(r.Event, RecordableEventPrefix) || len(r.Event) == len(RecordableEventPrefix) {
+		return Errorf(ErrCodeInvalidParams, "event.record only records %s* events, not %q", RecordableEventPrefix, r.Event)
+	}
+	return nil
+}
+
 // EventView is a JSON-serialisable view of a stored event row.
 type EventView struct {
 	ID         int64   `json:"id"`
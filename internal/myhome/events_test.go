@@ -0,0 +1,33 @@
+package myhome
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEventRecordRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		req  EventRecordRequest
+		ok   bool
+	}{
+		{name: "firmware", req: EventRecordRequest{DeviceID: "shellyplus1-abc", Event: "firmware.updated"}, ok: true},
+		{name: "no device", req: EventRecordRequest{Event: "firmware.updated"}},
+		{name: "no event", req: EventRecordRequest{DeviceID: "shellyplus1-abc"}},
+		{name: "device event", req: EventRecordRequest{DeviceID: "shellyplus1-abc", Event: "switch.on"}},
+		{name: "prefix only", req: EventRecordRequest{DeviceID: "shellyplus1-abc", Event: "firmware."}},
+	}
+	for _, tt := range tests {
+		err := tt.req.Validate()
+		if tt.ok {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+		var e *Error
+		if !errors.As(err, &e) || e.Code != ErrCodeInvalidParams {
+			t.Errorf("%s: got %v, want an invalid params error", tt.name, err)
+		}
+	}
+}
@@ -15,19 +15,23 @@ type FakeCall struct {
 
 // FakeClient is a test double for Client. It records every CallE invocation
 // and returns a canned result or error configured per Verb via SetResult and
-// SetError, so CLI command tests can assert which RPC verb and params a
-// command issued without a real MQTT transport.
+// SetError (or computed by SetHandler), so CLI command tests can assert which
+// RPC verb and params a command issued without a real MQTT transport.
 type FakeClient struct {
-	Calls   []FakeCall
-	results map[Verb]any
-	errs    map[Verb]error
+	Calls    []FakeCall
+	results  map[Verb]any
+	errs     map[Verb]error
+	handlers map[Verb]MethodHandler
+	streams  map[Verb]<-chan Notification
 }
 
 // NewFakeClient returns a FakeClient ready for use.
 func NewFakeClient() *FakeClient {
 	return &FakeClient{
-		results: make(map[Verb]any),
-		errs:    make(map[Verb]error),
+		results:  make(map[Verb]any),
+		errs:     make(map[Verb]error),
+		handlers: make(map[Verb]MethodHandler),
+		streams:  make(map[Verb]<-chan Notification),
 	}
 }
 
@@ -45,11 +49,28 @@ func (f *FakeClient) SetError(method Verb, err error) {
 	delete(f.results, method)
 }
 
+// SetHandler configures CallE to return whatever h computes from the call
+// params, for tests needing a different result per call (typically the items
+// of a batch). It takes precedence over SetResult/SetError for method.
+func (f *FakeClient) SetHandler(method Verb, h MethodHandler) {
+	f.handlers[method] = h
+}
+
+// SetStream configures SubscribeE to return stream for method (a subscribe
+// verb such as EventSubscribe). Tests feed notifications into, and close, the
+// channel themselves.
+func (f *FakeClient) SetStream(method Verb, stream <-chan Notification) {
+	f.streams[method] = stream
+}
+
 // CallE implements Client. It records the call and returns whatever was
 // configured via SetResult/SetError; if nothing was configured for method it
 // returns an error naming the unconfigured verb.
 func (f *FakeClient) CallE(ctx context.Context, method Verb, params any) (any, error) {
 	f.Calls = append(f.Calls, FakeCall{Method: method, Params: params})
+	if h, ok := f.handlers[method]; ok {
+		return h(ctx, params)
+	}
 	if err, ok := f.errs[method]; ok {
 		return nil, err
 	}
@@ -59,6 +80,41 @@ func (f *FakeClient) CallE(ctx context.Context, method Verb, params any) (any, e
 	return nil, fmt.Errorf("FakeClient: no result configured for method %s", method)
 }
 
+// BatchE implements Client. Each call is recorded and answered as if issued
+// through CallE; as over the wire, a failing call only yields an item Error
+// (with the code ErrorOf derives), not a batch error. A batch error can be
+// configured with SetError(RpcBatch, err).
+func (f *FakeClient) BatchE(ctx context.Context, calls []BatchCall) ([]BatchItem, error) {
+	if err, ok := f.errs[RpcBatch]; ok {
+		f.Calls = append(f.Calls, FakeCall{Method: RpcBatch, Params: calls})
+		return nil, err
+	}
+	items := make([]BatchItem, len(calls))
+	for i, call := range calls {
+		out, err := f.CallE(ctx, call.Method, call.Params)
+		if err != nil {
+			items[i].Error = ErrorOf(err)
+			continue
+		}
+		items[i].Result = out
+	}
+	return items, nil
+}
+
+// SubscribeE implements Client. It records the call like CallE does and
+// returns the stream configured via SetStream, or the error configured via
+// SetError.
+func (f *FakeClient) SubscribeE(ctx context.Context, method Verb, params *SubscribeParams) (<-chan Notification, error) {
+	f.Calls = append(f.Calls, FakeCall{Method: method, Params: params})
+	if err, ok := f.errs[method]; ok {
+		return nil, err
+	}
+	if stream, ok := f.streams[method]; ok {
+		return stream, nil
+	}
+	return nil, fmt.Errorf("FakeClient: no stream configured for method %s", method)
+}
+
 // LookupDevices implements Client. Not used by CLI command tests today;
 // configure via a wrapper/embedding if a future test needs it.
 func (f *FakeClient) LookupDevices(ctx context.Context, name string) (*[]devices.Device, error) {
@@ -22,6 +22,7 @@ require (
 	github.com/asnowfix/home-automation/pkg/shelly/script v0.0.0-20260509071421-c58ef52aafe2
 	github.com/asnowfix/home-automation/pkg/shelly/shelly v0.0.0-20260509071421-c58ef52aafe2
 	github.com/asnowfix/home-automation/pkg/shelly/sswitch v0.0.0-20260509071421-c58ef52aafe2
+	github.com/asnowfix/home-automation/pkg/shelly/sws v0.0.0-00010101000000-000000000000
 	github.com/asnowfix/home-automation/pkg/shelly/system v0.0.0-20260509071421-c58ef52aafe2
 	github.com/asnowfix/home-automation/pkg/shelly/types v0.0.0-20260509071421-c58ef52aafe2
 	github.com/asnowfix/home-automation/pkg/shelly/wifi v0.0.0-20260509071421-c58ef52aafe2
@@ -106,3 +107,5 @@ replace github.com/asnowfix/home-automation/internal/myhome/net => ./net
 replace github.com/asnowfix/home-automation/myhome/events => ../../myhome/events
 
 replace github.com/asnowfix/home-automation/pkg/shelly/mqtt => ../../pkg/shelly/mqtt
+
+replace github.com/asnowfix/home-automation/pkg/shelly/sws => ../../pkg/shelly/sws
@@ -0,0 +1,68 @@
+package myhome
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// ChangeSource is what caused a change of a device's stored config or info,
+// as recorded in its history.
+type ChangeSource string
+
+const (
+	ChangeSourceRefresh   ChangeSource = "refresh"   // Observed from the device: refresh, MQTT announce...
+	ChangeSourceReconcile ChangeSource = "reconcile" // The daemon's periodic config reconciliation
+	ChangeSourceSetup     ChangeSource = "setup"     // device.setup, or auto-setup of a new device
+	ChangeSourceUser      ChangeSource = "user"      // A client storing a device (device.update)
+)
+
+type changeSourceKey struct{}
+
+// WithChangeSource returns a context storing device changes as caused by
+// source.
+func WithChangeSource(ctx context.Context, source ChangeSource) context.Context {
+	return context.WithValue(ctx, changeSourceKey{}, source)
+}
+
+// ChangeSourceFromContext returns the source of the device changes stored
+// with ctx: refresh unless set by WithChangeSource.
+func ChangeSourceFromContext(ctx context.Context) ChangeSource {
+	if source, ok := ctx.Value(changeSourceKey{}).(ChangeSource); ok {
+		return source
+	}
+	return ChangeSourceRefresh
+}
+
+// ConfigChange is a changed value of a device's stored config or info, at a
+// dotted path such as "config.mqtt.server". Old is absent for an added
+// value, New for a removed one.
+type ConfigChange struct {
+	Path string          `json:"path"`
+	Old  json.RawMessage `json:"old,omitempty"`
+	New  json.RawMessage `json:"new,omitempty"`
+}
+
+// DeviceHistoryEntry is one stored change of a device's config or info.
+type DeviceHistoryEntry struct {
+	Id          int64          `json:"id"`
+	Ts          time.Time      `json:"ts"`
+	DeviceId    string         `json:"device_id"`
+	Source      ChangeSource   `json:"source"`
+	Principal   string         `json:"principal,omitempty"` // RPC caller that caused the change, if any
+	OldRevision uint32         `json:"old_revision"`
+	NewRevision uint32         `json:"new_revision"`
+	Changes     []ConfigChange `json:"changes"`
+}
+
+// DeviceHistoryParams represents parameters for device.history RPC
+type DeviceHistoryParams struct {
+	Identifier string `json:"identifier"`      // Device identifier (id/name/host/MAC/IP)
+	Path       string `json:"path,omitempty"`  // Only changes at or under this path, e.g. "config.mqtt"
+	Limit      int    `json:"limit,omitempty"` // Most recent entries returned (default 100)
+}
+
+// DeviceHistoryResult is the result of device.history RPC, newest first
+type DeviceHistoryResult struct {
+	Entries []DeviceHistoryEntry `json:"entries"`
+}
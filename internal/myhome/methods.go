@@ -3,6 +3,7 @@ package myhome
 import (
 	"context"
 	"fmt"
+	"sort"
 )
 
 type MethodHandler func(ctx context.Context, in any) (any, error)
@@ -21,21 +22,51 @@ type Method struct {
 func Methods(name Verb) (*Method, error) {
 	m, exists := methods[name]
 	if !exists {
-		return nil, fmt.Errorf("unknown or unregistered method %s", name)
+		return nil, fmt.Errorf("%w: unknown or unregistered method %s", ErrMethodNotFound, name)
 	}
 	return m, nil
 }
 
-func RegisterMethodHandler(name Verb, mh MethodHandler) {
+// Signature returns the params & result types of a verb, as known to clients
+// whether or not a handler is registered for it in this process.
+func Signature(name Verb) (MethodSignature, error) {
+	s, exists := signatures[name]
+	if !exists {
+		return MethodSignature{}, fmt.Errorf("%w: unknown method %s", ErrMethodNotFound, name)
+	}
+	return s, nil
+}
+
+// Verbs returns every verb known to clients, sorted.
+func Verbs() []Verb {
+	verbs := make([]Verb, 0, len(signatures))
+	for v := range signatures {
+		verbs = append(verbs, v)
+	}
+	sort.Slice(verbs, func(i, j int) bool { return verbs[i] < verbs[j] })
+	return verbs
+}
+
+// RegisterMethodHandler sets the handler for verb name, replacing any
+// previous one, and returns a function that restores the previous handler.
+func RegisterMethodHandler(name Verb, mh MethodHandler) (restore func()) {
 	s, exists := signatures[name]
 	if !exists {
 		panic(fmt.Errorf("unknown method %s", name))
 	}
+	prev, had := methods[name]
 	methods[name] = &Method{
 		Name:      name,
 		Signature: s,
 		ActionE:   mh,
 	}
+	return func() {
+		if had {
+			methods[name] = prev
+		} else {
+			delete(methods, name)
+		}
+	}
 }
 
 var methods map[Verb]*Method = make(map[Verb]*Method)
@@ -65,6 +96,22 @@ var signatures map[Verb]MethodSignature = map[Verb]MethodSignature{
 			return &Device{}
 		},
 	},
+	DeviceHistory: {
+		NewParams: func() any {
+			return &DeviceHistoryParams{}
+		},
+		NewResult: func() any {
+			return &DeviceHistoryResult{}
+		},
+	},
+	DeviceSetAuth: {
+		NewParams: func() any {
+			return &DeviceSetAuthParams{}
+		},
+		NewResult: func() any {
+			return nil
+		},
+	},
 	DeviceForget: {
 		NewParams: func() any {
 			return ""
@@ -305,6 +352,70 @@ var signatures map[Verb]MethodSignature = map[Verb]MethodSignature{
 			return &EventListResponse{}
 		},
 	},
+	EventSubscribe: {
+		NewParams: func() any {
+			return &SubscribeParams{}
+		},
+		NewResult: func() any {
+			return &SubscribeResult{}
+		},
+	},
+	EventRecord: {
+		NewParams: func() any {
+			return &EventRecordRequest{}
+		},
+		NewResult: func() any {
+			return nil
+		},
+	},
+	DeviceWatch: {
+		NewParams: func() any {
+			return &SubscribeParams{}
+		},
+		NewResult: func() any {
+			return &SubscribeResult{}
+		},
+	},
+	Unsubscribe: {
+		NewParams: func() any {
+			return &UnsubscribeParams{}
+		},
+		NewResult: func() any {
+			return nil
+		},
+	},
+	RpcCancel: {
+		NewParams: func() any {
+			return &CancelParams{}
+		},
+		NewResult: func() any {
+			return nil
+		},
+	},
+	RpcBatch: {
+		NewParams: func() any {
+			return &BatchParams{}
+		},
+		NewResult: func() any {
+			return &BatchResult{}
+		},
+	},
+	RpcList: {
+		NewParams: func() any {
+			return nil
+		},
+		NewResult: func() any {
+			return &ListResult{}
+		},
+	},
+	RpcDescribe: {
+		NewParams: func() any {
+			return &DescribeParams{}
+		},
+		NewResult: func() any {
+			return &MethodDescription{}
+		},
+	},
 	PoolGetStatus: {
 		NewParams: func() any {
 			return nil
@@ -11,15 +11,7 @@ import (
 // package-level global.
 func withHandler(t *testing.T, v Verb, h MethodHandler) {
 	t.Helper()
-	prev := methods[v]
-	RegisterMethodHandler(v, h)
-	t.Cleanup(func() {
-		if prev == nil {
-			delete(methods, v)
-		} else {
-			methods[v] = prev
-		}
-	})
+	t.Cleanup(RegisterMethodHandler(v, h))
 }
 
 // nopHandler is a minimal MethodHandler that returns a non-nil result.
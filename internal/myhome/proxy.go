@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/asnowfix/home-automation/pkg/devices"
+	"time"
 )
 
 var TheClient Client
@@ -16,6 +17,14 @@ type Client interface {
 	LookupDevices(ctx context.Context, name string) (*[]devices.Device, error)
 	ForgetDevices(ctx context.Context, name string) error
 	CallE(ctx context.Context, method Verb, params any) (any, error)
+	// SubscribeE calls a subscribe verb (event.subscribe, device.watch) and
+	// streams the resulting notifications until ctx is done, at which point
+	// the subscription is released and the channel closed.
+	SubscribeE(ctx context.Context, method Verb, params *SubscribeParams) (<-chan Notification, error)
+	// BatchE runs calls server-side in a single rpc.batch round-trip. Item i
+	// holds the outcome of calls[i], its Result typed as CallE would return
+	// it; the returned error is for the batch as a whole.
+	BatchE(ctx context.Context, calls []BatchCall) ([]BatchItem, error)
 }
 
 func ServerTopic() string {
@@ -36,11 +45,27 @@ type request struct {
 	Dialog
 	Method Verb `json:"method"`
 	Params any  `json:"params,omitempty"`
+	// Deadline is when the caller stops waiting for the response. The server
+	// aborts the handler context then, and drops requests still queued past
+	// it. Absent for callers that predate it: the server then applies none.
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// Auth carries the caller's credentials (see auth.go). Absent for
+	// anonymous callers.
+	Auth *Auth `json:"auth,omitempty"`
 }
 
+// CancelParams represents parameters for rpc.cancel, sent by a client that
+// gave up on one of its requests (timeout or cancelled context). It gets no
+// response.
+type CancelParams struct {
+	Id string `json:"id"` // Id of the request to abort, from the same src
+}
+
+// Error is the error member of a response. It is also the Go error returned
+// by client.CallE, so callers can test it with errors.Is (see errors.go).
 type Error struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
 }
 
 type response struct {
@@ -49,6 +74,23 @@ type response struct {
 	Error  *Error `json:"error,omitempty"`
 }
 
+type dialogKey struct{}
+
+// withDialog returns a context carrying the dialog of the request being
+// served, so that handlers needing to know their caller (e.g. subscriptions)
+// can retrieve it with DialogFromContext.
+func withDialog(ctx context.Context, d Dialog) context.Context {
+	return context.WithValue(ctx, dialogKey{}, d)
+}
+
+// DialogFromContext returns the dialog of the MQTT RPC request being served,
+// if any. It is absent for calls that did not come through the RPC server
+// (HTTP /rpc, in-process DeviceManager.CallE).
+func DialogFromContext(ctx context.Context) (Dialog, bool) {
+	d, ok := ctx.Value(dialogKey{}).(Dialog)
+	return d, ok
+}
+
 func ValidateDialog(d Dialog) error {
 	if d.Id == "" {
 		return fmt.Errorf("invalid dialog: id=%v", d.Id)
@@ -0,0 +1,235 @@
+package myhome
+
+// Verb discovery (rpc.list, rpc.describe) & JSON Schema generation by
+// reflection on the Go types of each verb's signature.
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaDialect is the JSON Schema draft the generated schemas follow.
+const SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a (subset of a) JSON Schema, as generated by SchemaOf.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	rawMessageType    = reflect.TypeFor[json.RawMessage]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// SchemaOf returns the JSON Schema of the JSON encoding of v, as produced by
+// encoding/json. Named struct types go to $defs, so that recursive and
+// shared types are described once. A nil v (verbs without params or result)
+// is described as null.
+func SchemaOf(v any) *Schema {
+	if v == nil {
+		return &Schema{Schema: SchemaDialect, Type: "null"}
+	}
+	g := schemaGenerator{defs: make(map[string]*Schema)}
+	s := g.schema(reflect.TypeOf(v))
+	s.Schema = SchemaDialect
+	if len(g.defs) > 0 {
+		s.Defs = g.defs
+	}
+	return s
+}
+
+type schemaGenerator struct {
+	defs map[string]*Schema // $defs name -> schema
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		return &Schema{} // custom encoding: anything goes
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"} // base64
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := defName(t)
+		if _, exists := g.defs[name]; !exists {
+			g.defs[name] = &Schema{} // placeholder, breaks recursion
+			g.defs[name] = g.object(t)
+		}
+		return &Schema{Ref: "#/$defs/" + name}
+	}
+	return &Schema{} // interface{} and anything else
+}
+
+// object describes a struct the way encoding/json encodes it: exported
+// fields under their json name, embedded structs flattened, omitempty fields
+// optional.
+func (g *schemaGenerator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	g.fields(t, s)
+	sort.Strings(s.Required)
+	return s
+}
+
+func (g *schemaGenerator) fields(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, s)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if _, exists := s.Properties[name]; exists {
+			continue // shadowed by a shallower field
+		}
+		s.Properties[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") && f.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// defName names a struct type in $defs: its package name and type name,
+// e.g. "myhome.Device".
+func defName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	name := t.Name()
+	if pkg != "" {
+		name = pkg + "." + name
+	}
+	// Instantiated generic types have brackets & paths in their names
+	return strings.NewReplacer("[", "_", "]", "", "/", "_", "*", "").Replace(name)
+}
+
+// MethodDescription describes one verb for discovery: the JSON Schema of its
+// params & result, and the minimum role allowed to call it.
+type MethodDescription struct {
+	Name   Verb    `json:"name"`
+	Role   Role    `json:"role"`
+	Params *Schema `json:"params"`
+	Result *Schema `json:"result"`
+}
+
+// DescribeParams represents parameters for rpc.describe.
+type DescribeParams struct {
+	Method Verb `json:"method"`
+}
+
+// ListResult represents the result of rpc.list.
+type ListResult struct {
+	Methods []MethodDescription `json:"methods"`
+}
+
+// Describe returns the description of verb, from its signature.
+func Describe(verb Verb) (*MethodDescription, error) {
+	s, exists := signatures[verb]
+	if !exists {
+		return nil, fmt.Errorf("%w: unknown method %s", ErrMethodNotFound, verb)
+	}
+	return &MethodDescription{
+		Name:   verb,
+		Role:   VerbRole(verb),
+		Params: SchemaOf(s.NewParams()),
+		Result: SchemaOf(s.NewResult()),
+	}, nil
+}
+
+// listHandler returns the rpc.list handler: the description of every verb
+// resolve can serve, sorted by name.
+func listHandler(resolve func(Verb) (*Method, error)) MethodHandler {
+	return func(_ context.Context, _ any) (any, error) {
+		res := &ListResult{Methods: make([]MethodDescription, 0, len(signatures))}
+		for verb := range signatures {
+			if _, err := resolve(verb); err != nil {
+				continue
+			}
+			d, err := Describe(verb)
+			if err != nil {
+				return nil, err
+			}
+			res.Methods = append(res.Methods, *d)
+		}
+		sort.Slice(res.Methods, func(i, j int) bool { return res.Methods[i].Name < res.Methods[j].Name })
+		return res, nil
+	}
+}
+
+// describeHandler returns the rpc.describe handler.
+func describeHandler(resolve func(Verb) (*Method, error)) MethodHandler {
+	return func(_ context.Context, in any) (any, error) {
+		params, ok := in.(*DescribeParams)
+		if !ok {
+			return nil, fmt.Errorf("%w: unexpected type %T", ErrInvalidParams, in)
+		}
+		if _, err := resolve(params.Method); err != nil {
+			if !errors.Is(err, ErrMethodNotFound) {
+				err = fmt.Errorf("%w: %w", ErrMethodNotFound, err)
+			}
+			return nil, err
+		}
+		return Describe(params.Method)
+	}
+}
@@ -0,0 +1,111 @@
+package myhome
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type schemaBase struct {
+	Id string `json:"id"`
+}
+
+type schemaNode struct {
+	schemaBase
+	Name     string            `json:"name,omitempty"`
+	When     time.Time         `json:"when"`
+	Parent   *schemaNode       `json:"parent,omitempty"`
+	Children []schemaNode      `json:"children"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Raw      json.RawMessage   `json:"raw,omitempty"`
+	Hidden   string            `json:"-"`
+	private  int
+}
+
+// TestSchemaOf verifies the schema of a struct using embedding, omitempty,
+// pointers, collections and recursion.
+func TestSchemaOf(t *testing.T) {
+	s := SchemaOf(&schemaNode{})
+	if s.Schema != SchemaDialect || s.Ref != "#/$defs/myhome.schemaNode" {
+		t.Fatalf("root: got %+v", s)
+	}
+	node := s.Defs["myhome.schemaNode"]
+	if node == nil || node.Type != "object" {
+		t.Fatalf("$defs: got %+v", s.Defs)
+	}
+
+	var names []string
+	for name := range node.Properties {
+		names = append(names, name)
+	}
+	if len(names) != 7 {
+		t.Errorf("properties: got %v, want id name when parent children tags raw", names)
+	}
+	if want := []string{"children", "id", "when"}; !reflect.DeepEqual(node.Required, want) {
+		t.Errorf("required: got %v, want %v", node.Required, want)
+	}
+	if p := node.Properties["when"]; p.Type != "string" || p.Format != "date-time" {
+		t.Errorf("when: got %+v", p)
+	}
+	if p := node.Properties["parent"]; p.Ref != "#/$defs/myhome.schemaNode" {
+		t.Errorf("parent: got %+v", p)
+	}
+	if p := node.Properties["children"]; p.Type != "array" || p.Items.Ref != "#/$defs/myhome.schemaNode" {
+		t.Errorf("children: got %+v", p)
+	}
+	if p := node.Properties["tags"]; p.Type != "object" || p.AdditionalProperties.Type != "string" {
+		t.Errorf("tags: got %+v", p)
+	}
+
+	if s := SchemaOf(nil); s.Type != "null" {
+		t.Errorf("nil: got %+v", s)
+	}
+	if s := SchemaOf(""); s.Type != "string" {
+		t.Errorf("string: got %+v", s)
+	}
+}
+
+// TestDescribe_AllVerbs verifies that every verb signature can be described
+// and that its schemas marshal.
+func TestDescribe_AllVerbs(t *testing.T) {
+	for verb := range signatures {
+		d, err := Describe(verb)
+		if err != nil {
+			t.Errorf("%s: %v", verb, err)
+			continue
+		}
+		if _, err := json.Marshal(d); err != nil {
+			t.Errorf("%s: marshal: %v", verb, err)
+		}
+	}
+	if _, err := Describe("no.such.verb"); !errors.Is(err, ErrMethodNotFound) {
+		t.Errorf("unknown verb: got %v, want ErrMethodNotFound", err)
+	}
+}
+
+// TestListHandler verifies that rpc.list only lists the verbs the server can
+// resolve, sorted by name.
+func TestListHandler(t *testing.T) {
+	resolve := verbServer{SwitchOn: {}, DeviceShow: {}}.MethodE
+	out, err := listHandler(resolve)(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("rpc.list: %v", err)
+	}
+	methods := out.(*ListResult).Methods
+	if len(methods) != 2 || methods[0].Name != DeviceShow || methods[1].Name != SwitchOn {
+		t.Fatalf("methods: got %+v", methods)
+	}
+	if methods[0].Role != RoleReadOnly || methods[1].Role != RoleOperator {
+		t.Errorf("roles: got %s %s", methods[0].Role, methods[1].Role)
+	}
+	if methods[0].Params.Ref != "#/$defs/myhome.DeviceShowParams" {
+		t.Errorf("device.show params: got %+v", methods[0].Params)
+	}
+
+	if _, err := describeHandler(resolve)(context.Background(), &DescribeParams{Method: SwitchOff}); !errors.Is(err, ErrMethodNotFound) {
+		t.Errorf("rpc.describe of an unserved verb: got %v, want ErrMethodNotFound", err)
+	}
+}
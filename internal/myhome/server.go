@@ -3,18 +3,45 @@ package myhome
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/asnowfix/home-automation/myhome/mqtt"
+	"sync"
 
 	"github.com/go-logr/logr"
 )
 
+// ServerWorkers bounds how many requests the RPC server handles concurrently.
+const ServerWorkers = 8
+
+// ServerQueue bounds how many requests wait for a worker. Requests past it
+// are answered with ErrBusy.
+const ServerQueue = 64
+
 type server struct {
 	// mc      *mymqtt.Client
-	handler Server
-	from    <-chan []byte
+	handler  Server
+	from     <-chan []byte
+	mu       sync.Mutex
+	inflight map[string]inflight // inflightKey(src, id) -> request being handled
 	// to      chan []byte
 }
 
+// inflight is a request being handled, as tracked for rpc.cancel.
+type inflight struct {
+	cancel    context.CancelFunc
+	principal string // Authenticated caller, the only one allowed to cancel it
+	started   bool   // Picked up by a worker; until then, a cancel is answered right away
+}
+
+// queued is a request waiting for a worker.
+type queued struct {
+	ctx    context.Context // Handler context, from track
+	cancel context.CancelFunc
+	req    *request
+	inMsg  []byte
+}
+
 type Server interface {
 	MethodE(method Verb) (*Method, error)
 }
@@ -35,114 +62,296 @@ func NewServerE(ctx context.Context, mc mqtt.Client, handler Server) (Server, er
 	// 	log.Error(err, "Failed to publish to server", "topic", ServerTopic())
 	// 	return nil, err
 	// }
-	s := server{
+	s := &server{
 		// mc:      mc,
-		handler: handler,
-		from:    from,
+		handler:  handler,
+		from:     from,
+		inflight: make(map[string]inflight),
 		// to:      to,
 	}
 
-	go func(ctx context.Context) {
-		log, err := logr.FromContext(ctx)
+	// Bind server-push notifications to this server's MQTT client, and
+	// register the subscription verbs with the shared method registry.
+	theSubscriptions.mu.Lock()
+	theSubscriptions.publish = func(ctx context.Context, n Notification) error {
+		n.Src = mc.Id()
+		outMsg, err := json.Marshal(n)
 		if err != nil {
-			panic(err)
+			return err
 		}
-		log.Info("Server message loop started")
-		for {
-			select {
-			case <-ctx.Done():
-				log.Info("Cancelled", "reason", ctx.Err())
-				return
-			case inMsg := <-from:
-				log.Info("Received message", "payload", string(inMsg))
-				var req request
-				var res response
-				var err error
-
-				err = json.Unmarshal(inMsg, &req)
-				if err != nil {
-					log.Error(err, "Failed to unmarshal request from payload", "payload", string(inMsg))
-					s.fail(ctx, 1, err, &req, mc)
-					continue
-				}
+		return mc.Publish(ctx, ClientTopic(n.Dst), outMsg, mqtt.AtLeastOnce, false, InstanceName+".rpc/Server")
+	}
+	theSubscriptions.mu.Unlock()
+	RegisterMethodHandler(EventSubscribe, theSubscriptions.subscribeHandler(EventSubscribe))
+	RegisterMethodHandler(DeviceWatch, theSubscriptions.subscribeHandler(DeviceWatch))
+	RegisterMethodHandler(Unsubscribe, theSubscriptions.unsubscribeHandler)
+	RegisterMethodHandler(RpcBatch, batchHandler(handler.MethodE))
+	RegisterMethodHandler(RpcList, listHandler(handler.MethodE))
+	RegisterMethodHandler(RpcDescribe, describeHandler(handler.MethodE))
 
-				err = ValidateDialog(req.Dialog)
-				if err != nil {
-					log.Error(err, "Invalid dialog:"+req.Dialog.String())
-					s.fail(ctx, 1, err, &req, mc)
-					continue
-				}
+	go s.loop(logr.NewContext(ctx, log.WithName("Server")), mc)
 
-				method, err := handler.MethodE(req.Method)
-				if err != nil {
-					log.Error(err, "Failed to get action for method", "method", req.Method)
-					s.fail(ctx, 1, err, &req, mc)
-					continue
-				}
+	log.Info("Server started")
+	return s, nil
+}
 
-				// re-do Unmarshalling with proper types in place, if needed
-				req.Params = method.Signature.NewParams()
-				err = json.Unmarshal(inMsg, &req)
-				if err != nil {
-					log.Error(err, "Failed to unmarshal request from payload", "payload", string(inMsg))
-					s.fail(ctx, 1, err, &req, mc)
-					continue
-				}
+// loop reads requests off the server topic and authenticates them, rpc.cancel
+// included. Cancellations are then applied inline; every other request is
+// queued for one of ServerWorkers workers, so that a slow verb (device.setup,
+// device.refresh) no longer holds back the ones queued behind it. The loop
+// itself never waits for a worker: it keeps reading while every worker is
+// busy, so that rpc.cancel still reaches the requests queued or running, and
+// answers ErrBusy to the requests past the ServerQueue already waiting.
+func (s *server) loop(ctx context.Context, mc mqtt.Client) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("Server message loop started", "workers", ServerWorkers, "queue", ServerQueue)
+	queue := make(chan queued, ServerQueue)
+	for range ServerWorkers {
+		go s.work(ctx, mc, queue)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Cancelled", "reason", ctx.Err())
+			return
+		case inMsg := <-s.from:
+			// Never log the payload: its auth member may carry an API token.
+			var req request
 
-				tempResult := method.Signature.NewResult()
-				res.Result = &tempResult
+			err := json.Unmarshal(inMsg, &req)
+			if err != nil {
+				log.Error(err, "Failed to unmarshal request from payload", "bytes", len(inMsg))
+				s.fail(ctx, fmt.Errorf("%w: %w", ErrParse, err), &req, mc)
+				continue
+			}
+			log.Info("Received request", "method", req.Method, "request_id", req.Id, "src", req.Src)
 
-				res.Dialog = Dialog{
-					Id:  req.Id,
-					Src: mc.Id(),
-					Dst: req.Src,
-				}
+			err = ValidateDialog(req.Dialog)
+			if err != nil {
+				log.Error(err, "Invalid dialog:"+req.Dialog.String())
+				s.fail(ctx, fmt.Errorf("%w: %w", ErrInvalidRequest, err), &req, mc)
+				continue
+			}
 
-				out, err := method.ActionE(ctx, req.Params)
-				if err != nil {
-					log.Error(err, "Failed to call action")
-					s.fail(ctx, 1, err, &req, mc)
-					continue
+			actx, err := authenticateRequest(ctx, &req, inMsg)
+			if err != nil {
+				log.Info("Rejecting unauthenticated request", "method", req.Method, "request_id", req.Id, "src", req.Src, "reason", err)
+				if req.Method != RpcCancel {
+					s.fail(ctx, err, &req, mc)
 				}
+				continue
+			}
 
-				// FIXME: produces errors like: `Error: unexpected type returned from action: got *[]devices.Device, want *interface {} (code:1)`
-				// if reflect.TypeOf(out) != reflect.TypeOf(res.Result) {
-				// 	s.fail(ctx, 1, fmt.Errorf("unexpected type returned from action: got %v, want %v", reflect.TypeOf(out), reflect.TypeOf(res.Result)), &req, mc)
-				// 	continue
-				// }
+			if req.Method == RpcCancel {
+				s.cancel(actx, mc, &req, inMsg)
+				continue
+			}
 
-				res.Result = &out
+			// Register the request before queueing it, so that a cancel
+			// arriving while it waits for a worker is not lost.
+			hctx, cancel := s.track(actx, &req)
 
-				outMsg, err := json.Marshal(res)
-				if err != nil {
-					log.Error(err, "Failed to marshal response")
-					s.fail(ctx, 1, err, &req, mc)
-					continue
-				}
-				// to <- outMsg
-				log.Info("Publishing response", "dst", res.Dst, "topic", ClientTopic(req.Src), "request_id", res.Id)
-				mc.Publish(ctx, ClientTopic(req.Src), outMsg, mqtt.AtLeastOnce, false, InstanceName+".rpc/Server")
+			select {
+			case queue <- queued{ctx: hctx, cancel: cancel, req: &req, inMsg: inMsg}:
+			default:
+				log.Info("Rejecting request: server busy", "method", req.Method, "request_id", req.Id, "src", req.Src, "queue", ServerQueue)
+				s.untrack(&req, cancel)
+				s.fail(ctx, fmt.Errorf("%w: %d requests already waiting", ErrBusy, ServerQueue), &req, mc)
 			}
 		}
-	}(logr.NewContext(ctx, log.WithName("Server")))
+	}
+}
 
-	log.Info("Server started")
-	return &s, nil
+// work handles the queued requests, one at a time, until ctx is done.
+// Requests cancelled or expired while queued are answered with the reason by
+// handle, unless rpc.cancel answered them already.
+func (s *server) work(ctx context.Context, mc mqtt.Client, queue <-chan queued) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case q := <-queue:
+			if !s.start(q.req) {
+				q.cancel()
+				continue
+			}
+			s.handle(q.ctx, mc, q.req, q.inMsg)
+			s.untrack(q.req, q.cancel)
+		}
+	}
+}
+
+// handle serves one request, authenticated by loop, and publishes its
+// response.
+func (s *server) handle(ctx context.Context, mc mqtt.Client, req *request, inMsg []byte) {
+	log := logr.FromContextOrDiscard(ctx).WithValues("method", req.Method, "request_id", req.Id, "src", req.Src)
+
+	if err := ctx.Err(); err != nil {
+		log.Info("Dropping request aborted while queued", "reason", err)
+		s.fail(ctx, err, req, mc)
+		return
+	}
+
+	method, err := s.handler.MethodE(req.Method)
+	if err != nil {
+		log.Error(err, "Failed to get action for method")
+		if !errors.Is(err, ErrMethodNotFound) {
+			err = fmt.Errorf("%w: %w", ErrMethodNotFound, err)
+		}
+		s.fail(ctx, err, req, mc)
+		return
+	}
+
+	// re-do Unmarshalling with proper types in place, if needed
+	req.Params = method.Signature.NewParams()
+	err = json.Unmarshal(inMsg, req)
+	if err != nil {
+		log.Error(err, "Failed to unmarshal request params")
+		s.fail(ctx, fmt.Errorf("%w: %w", ErrInvalidParams, err), req, mc)
+		return
+	}
+
+	var res response
+	tempResult := method.Signature.NewResult()
+	res.Result = &tempResult
+
+	res.Dialog = Dialog{
+		Id:  req.Id,
+		Src: mc.Id(),
+		Dst: req.Src,
+	}
+
+	if err := Authorize(ctx, req.Method); err != nil {
+		log.Info("Rejecting unauthorized request", "reason", err)
+		s.fail(ctx, err, req, mc)
+		return
+	}
+
+	out, err := method.ActionE(withDialog(ctx, req.Dialog), req.Params)
+	if err != nil {
+		log.Error(err, "Failed to call action")
+		s.fail(ctx, err, req, mc)
+		return
+	}
+
+	// FIXME: produces errors like: `Error: unexpected type returned from action: got *[]devices.Device, want *interface {} (code:1)`
+	// if reflect.TypeOf(out) != reflect.TypeOf(res.Result) {
+	// 	s.fail(ctx, fmt.Errorf("unexpected type returned from action: got %v, want %v", reflect.TypeOf(out), reflect.TypeOf(res.Result)), &req, mc)
+	// 	return
+	// }
+
+	res.Result = &out
+
+	outMsg, err := json.Marshal(res)
+	if err != nil {
+		log.Error(err, "Failed to marshal response")
+		s.fail(ctx, fmt.Errorf("%w: %w", ErrInternal, err), req, mc)
+		return
+	}
+	log.Info("Publishing response", "dst", res.Dst, "topic", ClientTopic(req.Src))
+	mc.Publish(context.WithoutCancel(ctx), ClientTopic(req.Src), outMsg, mqtt.AtLeastOnce, false, InstanceName+".rpc/Server")
+}
+
+func inflightKey(src string, id string) string {
+	return src + "/" + id
+}
+
+// track derives the handler context of req, bounded by its deadline if any,
+// and records it so that rpc.cancel from the same caller can abort it.
+func (s *server) track(ctx context.Context, req *request) (context.Context, context.CancelFunc) {
+	var hctx context.Context
+	var cancel context.CancelFunc
+	if req.Deadline != nil {
+		hctx, cancel = context.WithDeadline(ctx, *req.Deadline)
+	} else {
+		hctx, cancel = context.WithCancel(ctx)
+	}
+	s.mu.Lock()
+	c, _ := CallerFromContext(ctx)
+	s.inflight[inflightKey(req.Src, req.Id)] = inflight{cancel: cancel, principal: c.Principal}
+	s.mu.Unlock()
+	return hctx, cancel
+}
+
+// start marks req as picked up by a worker, and reports whether it is still
+// to be handled: a request cancelled while queued was answered by cancel.
+func (s *server) start(req *request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := inflightKey(req.Src, req.Id)
+	r, exists := s.inflight[key]
+	if !exists {
+		return false
+	}
+	r.started = true
+	s.inflight[key] = r
+	return true
+}
+
+func (s *server) untrack(req *request, cancel context.CancelFunc) {
+	s.mu.Lock()
+	delete(s.inflight, inflightKey(req.Src, req.Id))
+	s.mu.Unlock()
+	cancel()
+}
+
+// cancel aborts the in-flight request named by rpc.cancel req, received as
+// inMsg and authenticated into ctx. Only the request's own caller may cancel
+// it: same source, same principal. A request still waiting for a worker is
+// answered right away, rather than once a worker picks it up. Unknown ids are
+// ignored: the request most likely completed already.
+func (s *server) cancel(ctx context.Context, mc mqtt.Client, req *request, inMsg []byte) {
+	log := logr.FromContextOrDiscard(ctx).WithValues("src", req.Src)
+	params := CancelParams{}
+	req.Params = &params
+	if err := json.Unmarshal(inMsg, req); err != nil {
+		log.Error(err, "Failed to unmarshal cancel request")
+		return
+	}
+	log = log.WithValues("request_id", params.Id)
+	if err := Authorize(ctx, RpcCancel); err != nil {
+		log.Info("Ignoring unauthorized cancel", "reason", err)
+		return
+	}
+	caller, _ := CallerFromContext(ctx)
+	key := inflightKey(req.Src, params.Id)
+	s.mu.Lock()
+	r, exists := s.inflight[key]
+	if exists && r.principal == caller.Principal && !r.started {
+		delete(s.inflight, key) // The worker that picks it up skips it
+	}
+	s.mu.Unlock()
+	if !exists {
+		log.V(1).Info("Ignoring cancel for unknown request")
+		return
+	}
+	if r.principal != caller.Principal {
+		log.Info("Ignoring cancel from another principal", "principal", caller.Principal)
+		return
+	}
+	log.Info("Cancelling request", "queued", !r.started)
+	r.cancel()
+	if !r.started {
+		s.fail(ctx, fmt.Errorf("%w: while queued", context.Canceled), &request{Dialog: Dialog{Id: params.Id, Src: req.Src}}, mc)
+	}
 }
 
-func (sp *server) fail(ctx context.Context, code int, err error, req *request, mc mqtt.Client) {
+// fail publishes an error response to req, its code derived from err by
+// ErrorOf.
+func (sp *server) fail(ctx context.Context, err error, req *request, mc mqtt.Client) {
 	var res response = response{
 		Dialog: Dialog{
 			Id:  req.Id,
 			Src: mc.Id(),
 			Dst: req.Src,
 		},
-		Error:  &Error{Code: code, Message: err.Error()},
+		Error:  ErrorOf(err),
 		Result: nil,
 	}
 	outMsg, _ := json.Marshal(res)
 	// sp.to <- outMsg
-	mc.Publish(ctx, ClientTopic(res.Dst), outMsg, mqtt.AtLeastOnce, false, InstanceName+".rpc/Server")
+	// The handler context may be the one that just expired: reply anyway.
+	mc.Publish(context.WithoutCancel(ctx), ClientTopic(res.Dst), outMsg, mqtt.AtLeastOnce, false, InstanceName+".rpc/Server")
 }
 
 func (sp *server) MethodE(method Verb) (*Method, error) {
@@ -179,8 +179,8 @@ func TestServer_UnknownMethod_ReturnsError(t *testing.T) {
 	if res.Error == nil {
 		t.Fatal("expected error in response, got nil")
 	}
-	if res.Error.Code != 1 {
-		t.Errorf("error code: got %d, want 1", res.Error.Code)
+	if res.Error.Code != ErrCodeMethodNotFound {
+		t.Errorf("error code: got %d, want %d", res.Error.Code, ErrCodeMethodNotFound)
 	}
 }
 
@@ -210,6 +210,9 @@ func TestServer_InvalidJSON_ReturnsError(t *testing.T) {
 	if res.Error == nil {
 		t.Fatal("expected error field in response")
 	}
+	if res.Error.Code != ErrCodeParse {
+		t.Errorf("error code: got %d, want %d", res.Error.Code, ErrCodeParse)
+	}
 }
 
 // TestServer_InvalidDialog_ReturnsError verifies that a request with an empty
@@ -242,6 +245,9 @@ func TestServer_InvalidDialog_ReturnsError(t *testing.T) {
 	if res.Error == nil {
 		t.Fatal("expected error in response for invalid dialog")
 	}
+	if res.Error.Code != ErrCodeInvalidRequest {
+		t.Errorf("error code: got %d, want %d", res.Error.Code, ErrCodeInvalidRequest)
+	}
 }
 
 // TestServer_ContextCancellation verifies that cancelling the context does not
@@ -278,3 +284,252 @@ func TestServer_ContextCancellation(t *testing.T) {
 		t.Error("Feed after context cancellation deadlocked")
 	}
 }
+
+// verbServer is a Server dispatching each verb to its own Method.
+type verbServer map[Verb]*Method
+
+func (s verbServer) MethodE(v Verb) (*Method, error) {
+	m, exists := s[v]
+	if !exists {
+		return nil, fmt.Errorf("method not found: %s", v)
+	}
+	return m, nil
+}
+
+// blockingMethod returns a Method whose action blocks until its context is
+// done, reporting the context error on aborted.
+func blockingMethod(name Verb, aborted chan<- error) *Method {
+	return &Method{
+		Name: name,
+		Signature: MethodSignature{
+			NewParams: func() any { return nil },
+			NewResult: func() any { return nil },
+		},
+		ActionE: func(ctx context.Context, _ any) (any, error) {
+			<-ctx.Done()
+			aborted <- ctx.Err()
+			return nil, ctx.Err()
+		},
+	}
+}
+
+// TestServer_ConcurrentDispatch verifies that a slow request does not hold
+// back the requests queued behind it.
+func TestServer_ConcurrentDispatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(newServerCtx())
+	defer cancel()
+
+	mc := mqtt.NewRecordingMockClient()
+	aborted := make(chan error, 1)
+	handler := verbServer{
+		"test.slow": blockingMethod("test.slow", aborted),
+		"test.fast": &Method{
+			Name: "test.fast",
+			Signature: MethodSignature{
+				NewParams: func() any { return nil },
+				NewResult: func() any { return nil },
+			},
+			ActionE: func(_ context.Context, _ any) (any, error) {
+				return "fast", nil
+			},
+		},
+	}
+	if _, err := NewServerE(ctx, mc, handler); err != nil {
+		t.Fatalf("NewServerE: %v", err)
+	}
+
+	feedRequest(t, mc, request{
+		Dialog: Dialog{Id: "slow-1", Src: "slow-client", Dst: InstanceName},
+		Method: "test.slow",
+	})
+	feedRequest(t, mc, request{
+		Dialog: Dialog{Id: "fast-1", Src: "fast-client", Dst: InstanceName},
+		Method: "test.fast",
+	})
+
+	raw := waitPublished(t, mc, ClientTopic("fast-client"))
+	var res response
+	if err := json.Unmarshal(raw, &res); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if res.Error != nil || res.Id != "fast-1" {
+		t.Errorf("fast response: got id=%q error=%+v", res.Id, res.Error)
+	}
+	if msgs := mc.Published(ClientTopic("slow-client")); len(msgs) != 0 {
+		t.Errorf("slow request answered before being aborted: %s", msgs[0])
+	}
+}
+
+// TestServer_DeadlineAbortsHandler verifies that the handler context expires
+// at the request deadline, and that the caller gets an error response.
+func TestServer_DeadlineAbortsHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(newServerCtx())
+	defer cancel()
+
+	mc := mqtt.NewRecordingMockClient()
+	aborted := make(chan error, 1)
+	if _, err := NewServerE(ctx, mc, verbServer{"test.slow": blockingMethod("test.slow", aborted)}); err != nil {
+		t.Fatalf("NewServerE: %v", err)
+	}
+
+	const src = "deadline-client"
+	deadline := time.Now().Add(50 * time.Millisecond)
+	feedRequest(t, mc, request{
+		Dialog:   Dialog{Id: "dl-1", Src: src, Dst: InstanceName},
+		Method:   "test.slow",
+		Deadline: &deadline,
+	})
+
+	select {
+	case err := <-aborted:
+		if err != context.DeadlineExceeded {
+			t.Errorf("handler context error: got %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler context did not expire at the request deadline")
+	}
+
+	raw := waitPublished(t, mc, ClientTopic(src))
+	var res response
+	if err := json.Unmarshal(raw, &res); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if res.Error == nil {
+		t.Error("expected an error response after the deadline")
+	}
+}
+
+// TestServer_CancelAbortsHandler verifies that rpc.cancel from the caller
+// aborts its in-flight request, while a cancel from another client does not.
+func TestServer_CancelAbortsHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(newServerCtx())
+	defer cancel()
+
+	mc := mqtt.NewRecordingMockClient()
+	aborted := make(chan error, 1)
+	if _, err := NewServerE(ctx, mc, verbServer{"test.slow": blockingMethod("test.slow", aborted)}); err != nil {
+		t.Fatalf("NewServerE: %v", err)
+	}
+
+	const src = "cancel-client"
+	feedRequest(t, mc, request{
+		Dialog: Dialog{Id: "c-1", Src: src, Dst: InstanceName},
+		Method: "test.slow",
+	})
+
+	feedRequest(t, mc, request{
+		Dialog: Dialog{Id: "c-2", Src: "intruder", Dst: InstanceName},
+		Method: RpcCancel,
+		Params: CancelParams{Id: "c-1"},
+	})
+	select {
+	case err := <-aborted:
+		t.Fatalf("request aborted by another client's cancel: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	feedRequest(t, mc, request{
+		Dialog: Dialog{Id: "c-3", Src: src, Dst: InstanceName},
+		Method: RpcCancel,
+		Params: CancelParams{Id: "c-1"},
+	})
+	select {
+	case err := <-aborted:
+		if err != context.Canceled {
+			t.Errorf("handler context error: got %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("rpc.cancel did not abort the handler")
+	}
+
+	if msgs := mc.Published(ClientTopic("intruder")); len(msgs) != 0 {
+		t.Errorf("rpc.cancel got a response: %s", msgs[0])
+	}
+}
+
+// TestServer_CancelWhileWorkersBusy verifies that the server keeps reading
+// while every worker is busy: a request queued behind them can still be
+// cancelled, and its caller gets an error response without waiting for a
+// worker.
+func TestServer_CancelWhileWorkersBusy(t *testing.T) {
+	ctx, cancel := context.WithCancel(newServerCtx())
+	defer cancel()
+
+	mc := mqtt.NewRecordingMockClient()
+	aborted := make(chan error, ServerWorkers+1)
+	if _, err := NewServerE(ctx, mc, verbServer{"test.slow": blockingMethod("test.slow", aborted)}); err != nil {
+		t.Fatalf("NewServerE: %v", err)
+	}
+
+	for i := 0; i < ServerWorkers; i++ {
+		feedRequest(t, mc, request{
+			Dialog: Dialog{Id: fmt.Sprintf("busy-%d", i), Src: "busy-client", Dst: InstanceName},
+			Method: "test.slow",
+		})
+	}
+
+	const src = "queued-client"
+	feedRequest(t, mc, request{
+		Dialog: Dialog{Id: "q-1", Src: src, Dst: InstanceName},
+		Method: "test.slow",
+	})
+	feedRequest(t, mc, request{
+		Dialog: Dialog{Id: "q-2", Src: src, Dst: InstanceName},
+		Method: RpcCancel,
+		Params: CancelParams{Id: "q-1"},
+	})
+
+	raw := waitPublished(t, mc, ClientTopic(src))
+	var res response
+	if err := json.Unmarshal(raw, &res); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if res.Id != "q-1" || res.Error == nil {
+		t.Errorf("queued request: got id=%q error=%+v, want an error response to q-1", res.Id, res.Error)
+	}
+	if msgs := mc.Published(ClientTopic("busy-client")); len(msgs) != 0 {
+		t.Errorf("busy requests answered before being aborted: %s", msgs[0])
+	}
+}
+
+// TestServer_BusyWhenQueueFull verifies that once every worker is busy and
+// ServerQueue requests wait for one, further requests are answered with
+// ErrBusy right away instead of piling up.
+func TestServer_BusyWhenQueueFull(t *testing.T) {
+	ctx, cancel := context.WithCancel(newServerCtx())
+	defer cancel()
+
+	mc := mqtt.NewRecordingMockClient()
+	aborted := make(chan error, ServerWorkers)
+	if _, err := NewServerE(ctx, mc, verbServer{"test.slow": blockingMethod("test.slow", aborted)}); err != nil {
+		t.Fatalf("NewServerE: %v", err)
+	}
+
+	// The mock drops messages past the subscription buffer: feed in batches.
+	for i := 0; i < ServerWorkers+ServerQueue; i++ {
+		feedRequest(t, mc, request{
+			Dialog: Dialog{Id: fmt.Sprintf("busy-%d", i), Src: "busy-client", Dst: InstanceName},
+			Method: "test.slow",
+		})
+		if i%8 == 7 {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	if msgs := mc.Published(ClientTopic("busy-client")); len(msgs) != 0 {
+		t.Fatalf("request answered while the queue had room: %s", msgs[0])
+	}
+
+	const src = "overflow-client"
+	feedRequest(t, mc, request{
+		Dialog: Dialog{Id: "o-1", Src: src, Dst: InstanceName},
+		Method: "test.slow",
+	})
+	raw := waitPublished(t, mc, ClientTopic(src))
+	var res response
+	if err := json.Unmarshal(raw, &res); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if res.Id != "o-1" || res.Error == nil || res.Error.Code != ErrCodeBusy {
+		t.Errorf("overflow request: got id=%q error=%+v, want ErrCodeBusy", res.Id, res.Error)
+	}
+}
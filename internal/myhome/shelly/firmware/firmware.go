@@ -0,0 +1,217 @@
+package firmware
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+// Events recorded for each device of a rollout, see Rollout.Record
+const (
+	EventUpdated = "firmware.updated"
+	EventFailed  = "firmware.failed"
+)
+
+// Firmware stages, as accepted by Shelly.Update
+const (
+	StageStable = "stable"
+	StageBeta   = "beta"
+)
+
+// Status is the firmware a device runs, and the ones it could update to.
+type Status struct {
+	Id      string `json:"id" yaml:"id"`
+	Name    string `json:"name" yaml:"name"`
+	Model   string `json:"model" yaml:"model"`
+	Version string `json:"version" yaml:"version"`
+	Stable  string `json:"stable,omitempty" yaml:"stable,omitempty"`
+	Beta    string `json:"beta,omitempty" yaml:"beta,omitempty"`
+}
+
+// Available returns the version the device would update to on stage, if any.
+func (s *Status) Available(stage string) string {
+	switch stage {
+	case StageStable:
+		return s.Stable
+	case StageBeta:
+		return s.Beta
+	}
+	return ""
+}
+
+// GetStatus returns the current firmware of d, and the updates it sees with
+// Shelly.CheckForUpdate.
+func GetStatus(ctx context.Context, via types.Channel, d types.Device) (*Status, error) {
+	info, err := shelly.GetDeviceInfo(ctx, d, via)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device info: %w", err)
+	}
+	updates, err := shelly.DoCheckForUpdate(ctx, via, d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for updates: %w", err)
+	}
+	s := &Status{
+		Id:      d.Id(),
+		Name:    d.Name(),
+		Model:   info.Model,
+		Version: info.Version,
+	}
+	if updates.Stable != nil {
+		s.Stable = updates.Stable.Version
+	}
+	if updates.Beta != nil {
+		s.Beta = updates.Beta.Version
+	}
+	return s, nil
+}
+
+// DefaultTimeout is how long a device usually takes at most to download a
+// firmware, reboot and come back online.
+const DefaultTimeout = 5 * time.Minute
+
+// pollInterval is how often Apply checks whether the device is back online
+var pollInterval = 5 * time.Second
+
+// Apply updates d to the latest firmware of stage, and waits (at most
+// timeout) for it to download it, reboot and come back online running a
+// version other than from. It returns the new version.
+func Apply(ctx context.Context, log logr.Logger, via types.Channel, d types.Device, stage string, from string, timeout time.Duration) (string, error) {
+	log.Info("Updating firmware", "device", d.Id(), "from", from, "stage", stage)
+	if err := shelly.DoUpdate(ctx, via, d, stage); err != nil {
+		return "", fmt.Errorf("failed to initiate update: %w", err)
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-deadline.C:
+			return "", fmt.Errorf("device did not come back online with a new firmware within %v", timeout)
+		case <-ticker.C:
+			// Failures are expected while the device is rebooting
+			info, err := shelly.GetDeviceInfo(ctx, d, via)
+			if err != nil {
+				log.V(1).Info("Device not back online yet", "device", d.Id(), "error", err)
+				continue
+			}
+			if info.Version != from {
+				log.Info("Firmware updated", "device", d.Id(), "from", from, "to", info.Version)
+				return info.Version, nil
+			}
+		}
+	}
+}
+
+// Plan selects the devices of fleet that have an update on stage, and splits
+// them in stages: one canary per model, then the others. Both are sorted by
+// model then name, so that the order of a rollout is predictable.
+func Plan(fleet []Status, stage string) (canaries []Status, others []Status) {
+	candidates := make([]Status, 0, len(fleet))
+	for _, s := range fleet {
+		if s.Available(stage) != "" {
+			candidates = append(candidates, s)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Model != candidates[j].Model {
+			return candidates[i].Model < candidates[j].Model
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+	models := make(map[string]bool)
+	for _, s := range candidates {
+		if !models[s.Model] {
+			models[s.Model] = true
+			canaries = append(canaries, s)
+		} else {
+			others = append(others, s)
+		}
+	}
+	return canaries, others
+}
+
+// Rollout updates a fleet one device at a time: first one canary per model,
+// then the other devices, so that a broken firmware stops at its canary. It
+// aborts at the first failure, and starts each device only when its update
+// (at most Timeout) ends before the next quiet window.
+type Rollout struct {
+	Log     logr.Logger
+	Stage   string
+	Quiet   []Window
+	Timeout time.Duration // The longest an update can take, see Apply
+
+	// Update updates one device, returning once it is back online with its
+	// new version (see Apply).
+	Update func(ctx context.Context, s Status) (version string, err error)
+
+	// Record, if set, is called after each device with EventUpdated or
+	// EventFailed and the details of the update.
+	Record func(ctx context.Context, s Status, event string, data map[string]string)
+
+	now func() time.Time
+}
+
+// Run updates the devices of fleet that have an update on r.Stage. It
+// returns the devices it updated, and the error that aborted the rollout.
+func (r *Rollout) Run(ctx context.Context, fleet []Status) ([]Status, error) {
+	canaries, others := Plan(fleet, r.Stage)
+	r.Log.Info("Starting firmware rollout", "stage", r.Stage, "canaries", len(canaries), "others", len(others))
+
+	updated := make([]Status, 0, len(canaries)+len(others))
+	for _, s := range append(canaries, others...) {
+		if err := r.waitQuiet(ctx); err != nil {
+			return updated, err
+		}
+		to := s.Available(r.Stage)
+		version, err := r.Update(ctx, s)
+		if err != nil {
+			r.record(ctx, s, EventFailed, map[string]string{"from": s.Version, "to": to, "error": err.Error()})
+			return updated, fmt.Errorf("device %s (%s) failed to update from %s to %s, rollout aborted: %w", s.Name, s.Id, s.Version, to, err)
+		}
+		r.record(ctx, s, EventUpdated, map[string]string{"from": s.Version, "to": version})
+		updated = append(updated, s)
+	}
+	return updated, nil
+}
+
+func (r *Rollout) record(ctx context.Context, s Status, event string, data map[string]string) {
+	data["model"] = s.Model
+	data["stage"] = r.Stage
+	if r.Record != nil {
+		r.Record(ctx, s, event, data)
+	}
+}
+
+// waitQuiet returns once an update started now would neither run in a
+// quiet window nor into the next one, i.e. [now, now+r.Timeout] is clear.
+func (r *Rollout) waitQuiet(ctx context.Context) error {
+	now := time.Now
+	if r.now != nil {
+		now = r.now
+	}
+	t := now()
+	slot, ok := NextSlot(r.Quiet, t, r.Timeout)
+	if !ok {
+		return fmt.Errorf("quiet windows leave no %v for an update", r.Timeout)
+	}
+	if !slot.After(t) {
+		return nil
+	}
+	r.Log.Info("Waiting for a slot clear of quiet windows", "until", slot, "timeout", r.Timeout)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(slot.Sub(t)):
+		return nil
+	}
+}
@@ -0,0 +1,296 @@
+package firmware
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/schedule"
+
+	"github.com/go-logr/logr"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Window
+		wantErr bool
+	}{
+		{in: "10:00-18:30", want: Window{From: 10 * time.Hour, To: 18*time.Hour + 30*time.Minute}},
+		{in: "22:00-06:00", want: Window{From: 22 * time.Hour, To: 6 * time.Hour}},
+		{in: " 07:15 - 07:45 ", want: Window{From: 7*time.Hour + 15*time.Minute, To: 7*time.Hour + 45*time.Minute}},
+		{in: "10:00", wantErr: true},
+		{in: "10:00-25:00", wantErr: true},
+		{in: "10:00-10:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseWindow(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseWindow(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("ParseWindow(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	if s := (Window{From: 22 * time.Hour, To: 6*time.Hour + 5*time.Minute}).String(); s != "22:00-06:05" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestQuietUntil(t *testing.T) {
+	day := func(h, m int) time.Time { return time.Date(2024, 6, 1, h, m, 0, 0, time.Local) }
+	windows, err := ParseWindows([]string{"10:00-12:00", "12:00-13:00", "22:00-06:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		at        time.Time
+		wantQuiet bool
+		wantUntil time.Time
+	}{
+		{at: day(9, 59)},
+		{at: day(10, 0), wantQuiet: true, wantUntil: day(13, 0)}, // Back-to-back windows
+		{at: day(12, 30), wantQuiet: true, wantUntil: day(13, 0)},
+		{at: day(13, 0)},
+		{at: day(23, 0), wantQuiet: true, wantUntil: day(6, 0).AddDate(0, 0, 1)}, // Across midnight
+		{at: day(5, 0), wantQuiet: true, wantUntil: day(6, 0)},
+	}
+	for _, tt := range tests {
+		until, quiet := QuietUntil(windows, tt.at)
+		if quiet != tt.wantQuiet {
+			t.Errorf("QuietUntil(%v) quiet = %v, want %v", tt.at, quiet, tt.wantQuiet)
+			continue
+		}
+		if quiet && !until.Equal(tt.wantUntil) {
+			t.Errorf("QuietUntil(%v) = %v, want %v", tt.at, until, tt.wantUntil)
+		}
+	}
+}
+
+func TestNextSlot(t *testing.T) {
+	day := func(h, m int) time.Time { return time.Date(2024, 6, 1, h, m, 0, 0, time.Local) }
+	windows, err := ParseWindows([]string{"10:00-12:00", "12:10-13:00", "22:00-06:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		at   time.Time
+		d    time.Duration
+		want time.Time
+	}{
+		{at: day(8, 0), d: 5 * time.Minute, want: day(8, 0)},
+		{at: day(9, 58), d: 5 * time.Minute, want: day(12, 0)},  // Would run into 10:00, fits between the windows
+		{at: day(9, 58), d: 15 * time.Minute, want: day(13, 0)}, // Does not fit between them
+		{at: day(12, 8), d: 5 * time.Minute, want: day(13, 0)},
+		{at: day(21, 0), d: 2 * time.Hour, want: day(6, 0).AddDate(0, 0, 1)},
+	}
+	for _, tt := range tests {
+		got, ok := NextSlot(windows, tt.at, tt.d)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("NextSlot(%v, %v) = %v, %v, want %v", tt.at, tt.d, got, ok, tt.want)
+		}
+	}
+	if got, ok := NextSlot(windows, day(8, 0), 10*time.Hour); ok {
+		t.Errorf("NextSlot() = %v, want no slot", got)
+	}
+	if got, ok := NextSlot(nil, day(8, 0), time.Hour); !ok || !got.Equal(day(8, 0)) {
+		t.Errorf("NextSlot() without windows = %v, %v", got, ok)
+	}
+}
+
+func job(enable bool, timespec string, method string, code string) schedule.Job {
+	var j schedule.Job
+	j.Enable = enable
+	j.Timespec = timespec
+	call := schedule.JobCall{Method: method}
+	if code != "" {
+		call.Params = map[string]any{"id": 1, "code": code}
+	}
+	j.Calls = []schedule.JobCall{call}
+	return j
+}
+
+func TestScheduleWindows(t *testing.T) {
+	wrap := func(h string) string {
+		return "(function(){try{" + h + "}catch(e){log('schedule handler error:',e)}})()"
+	}
+	jobs := []schedule.Job{
+		job(true, "0 30 8 * * SUN,MON,TUE,WED,THU,FRI,SAT", "script.eval", wrap("handleMorningStart()")),
+		job(true, "0 0 19 * * SUN,MON,TUE,WED,THU,FRI,SAT", "script.eval", wrap("handleEveningStop()")),
+		job(false, "0 15 23 * * SUN,MON,TUE,WED,THU,FRI,SAT", "script.eval", wrap("handleNightStart()")), // Winter, disabled
+		job(false, "0 15 0 * * SUN,MON,TUE,WED,THU,FRI,SAT", "script.eval", wrap("handleNightStop()")),
+		job(true, "0 45 23 * * SUN,MON,TUE,WED,THU,FRI,SAT", "script.eval", wrap("handleWateringStart()")),
+		job(true, "0 30 0 * * SUN,MON,TUE,WED,THU,FRI,SAT", "script.eval", wrap("handlePlan()")),
+		job(true, "0 12 3 * * SUN,MON,TUE,WED,THU,FRI,SAT", "Shelly.Update", ""),
+	}
+	got := ScheduleWindows(jobs, DefaultGardenRun)
+	want := []Window{
+		{From: 8*time.Hour + 30*time.Minute, To: 19 * time.Hour},
+		{From: 23*time.Hour + 45*time.Minute, To: 1*time.Hour + 45*time.Minute},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ScheduleWindows() = %v, want %v", got, want)
+	}
+
+	if j, ok := AutoUpdateJob(jobs); !ok || j.Timespec != jobs[6].Timespec {
+		t.Errorf("AutoUpdateJob() = %v, %v", j, ok)
+	}
+	if _, ok := AutoUpdateJob(jobs[:6]); ok {
+		t.Error("AutoUpdateJob() found a job without Shelly.Update")
+	}
+}
+
+func testFleet() []Status {
+	return []Status{
+		{Id: "plug-3", Name: "plug-c", Model: "SNPL-00112EU", Version: "1.3.0", Stable: "1.4.0"},
+		{Id: "plus1-1", Name: "pump", Model: "SNSW-001X16EU", Version: "1.3.0", Stable: "1.4.0"},
+		{Id: "plug-1", Name: "plug-a", Model: "SNPL-00112EU", Version: "1.3.0", Stable: "1.4.0", Beta: "1.5.0-beta1"},
+		{Id: "plug-2", Name: "plug-b", Model: "SNPL-00112EU", Version: "1.4.0"},
+		{Id: "plus1-2", Name: "garden", Model: "SNSW-001X16EU", Version: "1.3.0", Stable: "1.4.0"},
+	}
+}
+
+func ids(ss []Status) []string {
+	out := make([]string, 0, len(ss))
+	for _, s := range ss {
+		out = append(out, s.Id)
+	}
+	return out
+}
+
+func TestPlan(t *testing.T) {
+	canaries, others := Plan(testFleet(), StageStable)
+	if got, want := ids(canaries), []string{"plug-1", "plus1-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("canaries = %v, want %v", got, want)
+	}
+	if got, want := ids(others), []string{"plug-3", "plus1-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("others = %v, want %v", got, want)
+	}
+
+	canaries, others = Plan(testFleet(), StageBeta)
+	if got, want := ids(canaries), []string{"plug-1"}; !reflect.DeepEqual(got, want) || len(others) != 0 {
+		t.Errorf("beta plan = %v, %v, want %v and none", got, ids(others), want)
+	}
+}
+
+type recorded struct {
+	id    string
+	event string
+}
+
+func TestRollout_Run(t *testing.T) {
+	var updates []string
+	var events []recorded
+	r := &Rollout{
+		Log:   logr.Discard(),
+		Stage: StageStable,
+		Update: func(ctx context.Context, s Status) (string, error) {
+			updates = append(updates, s.Id)
+			return s.Stable, nil
+		},
+		Record: func(ctx context.Context, s Status, event string, data map[string]string) {
+			if data["from"] != s.Version || data["to"] != s.Stable || data["model"] != s.Model {
+				t.Errorf("unexpected event data %v for %v", data, s)
+			}
+			events = append(events, recorded{s.Id, event})
+		},
+	}
+	updated, err := r.Run(context.Background(), testFleet())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []string{"plug-1", "plus1-2", "plug-3", "plus1-1"}
+	if !reflect.DeepEqual(updates, want) || !reflect.DeepEqual(ids(updated), want) {
+		t.Errorf("updated %v (returned %v), want %v", updates, ids(updated), want)
+	}
+	if len(events) != len(want) {
+		t.Fatalf("recorded %v", events)
+	}
+	for _, e := range events {
+		if e.event != EventUpdated {
+			t.Errorf("recorded %v, want %s", e, EventUpdated)
+		}
+	}
+}
+
+func TestRollout_AbortsOnCanaryFailure(t *testing.T) {
+	broken := errors.New("did not come back")
+	var updates []string
+	var events []recorded
+	r := &Rollout{
+		Log:   logr.Discard(),
+		Stage: StageStable,
+		Update: func(ctx context.Context, s Status) (string, error) {
+			updates = append(updates, s.Id)
+			if s.Model == "SNSW-001X16EU" {
+				return "", broken
+			}
+			return s.Stable, nil
+		},
+		Record: func(ctx context.Context, s Status, event string, data map[string]string) {
+			events = append(events, recorded{s.Id, event})
+		},
+	}
+	updated, err := r.Run(context.Background(), testFleet())
+	if !errors.Is(err, broken) {
+		t.Fatalf("Run error = %v, want %v", err, broken)
+	}
+	// The second canary failed: no other device is updated
+	if want := []string{"plug-1", "plus1-2"}; !reflect.DeepEqual(updates, want) {
+		t.Errorf("updates = %v, want %v", updates, want)
+	}
+	if want := []string{"plug-1"}; !reflect.DeepEqual(ids(updated), want) {
+		t.Errorf("updated = %v, want %v", ids(updated), want)
+	}
+	if want := []recorded{{"plug-1", EventUpdated}, {"plus1-2", EventFailed}}; !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+func TestRollout_WaitsForQuietWindow(t *testing.T) {
+	quiet, err := ParseWindows([]string{"10:00-12:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Rollout{
+		Log:   logr.Discard(),
+		Stage: StageStable,
+		Quiet: quiet,
+		Update: func(ctx context.Context, s Status) (string, error) {
+			t.Errorf("updated %s during a quiet window", s.Id)
+			return s.Stable, nil
+		},
+		now: func() time.Time { return time.Date(2024, 6, 1, 11, 0, 0, 0, time.Local) },
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := r.Run(ctx, testFleet()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRollout_WaitsBeforeQuietWindow(t *testing.T) {
+	quiet, err := ParseWindows([]string{"10:00-12:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Rollout{
+		Log:     logr.Discard(),
+		Stage:   StageStable,
+		Quiet:   quiet,
+		Timeout: 5 * time.Minute,
+		Update: func(ctx context.Context, s Status) (string, error) {
+			t.Errorf("updated %s so close to a quiet window it could run into it", s.Id)
+			return s.Stable, nil
+		},
+		now: func() time.Time { return time.Date(2024, 6, 1, 9, 57, 0, 0, time.Local) },
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := r.Run(ctx, testFleet()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
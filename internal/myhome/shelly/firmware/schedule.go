@@ -0,0 +1,121 @@
+package firmware
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/schedule"
+	"github.com/asnowfix/home-automation/pkg/shelly/shelly"
+)
+
+// The handlers pool-pump.js and garden.js schedule with Schedule.Create: the
+// pump runs from a start to the following stop of the same mode (only the
+// jobs of the current mode are enabled), the garden watering from its start
+// for at most DefaultGardenRun.
+var (
+	poolRuns = [][2]string{
+		{"handleMorningStart()", "handleEveningStop()"}, // Summer
+		{"handleNightStart()", "handleNightStop()"},     // Winter
+	}
+	gardenStart = "handleWateringStart()"
+)
+
+// DefaultGardenRun bounds the garden watering that follows its scheduled
+// start, whose actual length depends on the day's plan.
+const DefaultGardenRun = 2 * time.Hour
+
+// ScheduleWindows returns the quiet windows of the enabled pool-pump and
+// garden jobs among jobs, the garden watering lasting gardenRun.
+func ScheduleWindows(jobs []schedule.Job, gardenRun time.Duration) []Window {
+	starts := make(map[string]time.Duration)
+	for _, job := range jobs {
+		if !job.Enable {
+			continue
+		}
+		at, ok := timeOfDay(job.Timespec)
+		if !ok {
+			continue
+		}
+		for _, handler := range handlers(job) {
+			starts[handler] = at
+		}
+	}
+
+	var windows []Window
+	for _, run := range poolRuns {
+		from, okFrom := starts[run[0]]
+		to, okTo := starts[run[1]]
+		if okFrom && okTo && from != to {
+			windows = append(windows, Window{From: from, To: to})
+		}
+	}
+	if from, ok := starts[gardenStart]; ok && gardenRun > 0 {
+		windows = append(windows, Window{From: from, To: (from + gardenRun) % (24 * time.Hour)})
+	}
+	return windows
+}
+
+// AutoUpdateJob returns the job that setup schedules on each device to
+// install the latest stable firmware every night, if it is among jobs.
+func AutoUpdateJob(jobs []schedule.Job) (schedule.Job, bool) {
+	for _, job := range jobs {
+		for _, call := range job.Calls {
+			if call.Method == string(shelly.Update) {
+				return job, true
+			}
+		}
+	}
+	return schedule.Job{}, false
+}
+
+// handlers returns the script handlers job calls, among those of poolRuns
+// and gardenStart. Scripts wrap the call in a try/catch, hence the match by
+// containment.
+func handlers(job schedule.Job) []string {
+	var found []string
+	for _, call := range job.Calls {
+		params, ok := call.Params.(map[string]any)
+		if !ok {
+			continue
+		}
+		code, ok := params["code"].(string)
+		if !ok {
+			continue
+		}
+		for _, run := range poolRuns {
+			for _, h := range run {
+				if strings.Contains(code, h) {
+					found = append(found, h)
+				}
+			}
+		}
+		if strings.Contains(code, gardenStart) {
+			found = append(found, gardenStart)
+		}
+	}
+	return found
+}
+
+// timeOfDay returns the time of day of a daily timespec "<sec> <min> <hour>
+// ...", as written by the scripts. Symbolic (@sunrise...) and wildcard
+// timespecs have none.
+func timeOfDay(timespec string) (time.Duration, bool) {
+	fields := strings.Fields(timespec)
+	if len(fields) < 3 {
+		return 0, false
+	}
+	var hms [3]int
+	for i := range hms {
+		n, err := strconv.Atoi(fields[i])
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		hms[i] = n
+	}
+	sec, min, hour := hms[0], hms[1], hms[2]
+	if sec > 59 || min > 59 || hour > 23 {
+		return 0, false
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec)*time.Second, true
+}
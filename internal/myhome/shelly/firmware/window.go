@@ -0,0 +1,134 @@
+package firmware
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a daily quiet window, during which no device is updated, e.g.
+// while the pool pump or the garden watering runs: a device rebooting then
+// would stop them. Times are local; a window ending before it starts spans
+// midnight.
+type Window struct {
+	From time.Duration // Since midnight
+	To   time.Duration // Since midnight
+}
+
+// ParseWindow parses a window as HH:MM-HH:MM, e.g. 22:30-06:00.
+func ParseWindow(s string) (Window, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return Window{}, fmt.Errorf("invalid quiet window %q: expected HH:MM-HH:MM", s)
+	}
+	var w Window
+	var err error
+	if w.From, err = parseTimeOfDay(from); err != nil {
+		return Window{}, fmt.Errorf("invalid quiet window %q: %w", s, err)
+	}
+	if w.To, err = parseTimeOfDay(to); err != nil {
+		return Window{}, fmt.Errorf("invalid quiet window %q: %w", s, err)
+	}
+	if w.From == w.To {
+		return Window{}, fmt.Errorf("invalid quiet window %q: empty", s)
+	}
+	return w, nil
+}
+
+// ParseWindows parses a list of windows, as given on the command line.
+func ParseWindows(ss []string) ([]Window, error) {
+	windows := make([]Window, 0, len(ss))
+	for _, s := range ss {
+		w, err := ParseWindow(s)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", int(w.From.Hours()), int(w.From.Minutes())%60, int(w.To.Hours()), int(w.To.Minutes())%60)
+}
+
+// end returns the end of the occurrence of w in progress at t, if any.
+func (w Window) end(t time.Time) (time.Time, bool) {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	since := t.Sub(midnight)
+	switch {
+	case w.From < w.To && w.From <= since && since < w.To:
+		return midnight.Add(w.To), true
+	case w.From > w.To && since >= w.From:
+		return midnight.AddDate(0, 0, 1).Add(w.To), true
+	case w.From > w.To && since < w.To:
+		return midnight.Add(w.To), true
+	}
+	return time.Time{}, false
+}
+
+// QuietUntil returns whether t is within one of windows, and if so when
+// the last of the overlapping or back-to-back windows ends.
+func QuietUntil(windows []Window, t time.Time) (time.Time, bool) {
+	until := t
+	quiet := false
+	// Each window can extend the quiet period at most once
+	for range windows {
+		extended := false
+		for _, w := range windows {
+			if end, ok := w.end(until); ok && end.After(until) {
+				until = end
+				extended = true
+				quiet = true
+			}
+		}
+		if !extended {
+			break
+		}
+	}
+	return until, quiet
+}
+
+// nextStart returns the first start of w at or after t.
+func (w Window) nextStart(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	start := midnight.Add(w.From)
+	if start.Before(t) {
+		start = midnight.AddDate(0, 0, 1).Add(w.From)
+	}
+	return start
+}
+
+// NextSlot returns the first time at or after t from which d elapses
+// entirely outside of windows, e.g. the soonest a device may be updated
+// without its reboot running into the pool pump start. ok is false if the
+// windows leave no such gap in the day.
+func NextSlot(windows []Window, t time.Time, d time.Duration) (slot time.Time, ok bool) {
+	slot = t
+	// Windows repeat daily: a slot not found within a day never will be
+	for slot.Before(t.AddDate(0, 0, 1)) {
+		if until, quiet := QuietUntil(windows, slot); quiet {
+			slot = until
+		}
+		// slot is outside of all windows, so any next start is after it
+		next, found := time.Time{}, false
+		for _, w := range windows {
+			if s := w.nextStart(slot); s.Before(slot.Add(d)) && (!found || s.Before(next)) {
+				next, found = s, true
+			}
+		}
+		if !found {
+			return slot, true
+		}
+		slot = next
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,271 @@
+package fleet
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/schedule"
+	"github.com/asnowfix/home-automation/pkg/shelly/wifi"
+
+	"sigs.k8s.io/yaml"
+)
+
+// File is a fleet declaration: the desired state of each device, by device
+// name, id or glob pattern (e.g. shellyplus1-*):
+//
+//	devices:
+//	  "shellyplus1-*":
+//	    ble:
+//	      observer: true
+//	  front-door:
+//	    room: entrance
+//	    scripts: [watchdog.js]
+//	    kvs:
+//	      script/front-door/delay: "30"
+//	    switches:
+//	      0: {in_mode: detached}
+//
+// A device gets the settings of every pattern it matches, in lexical order,
+// then the settings of its own entry. Settings left out are not managed.
+type File struct {
+	Devices map[string]*Spec `json:"devices"`
+}
+
+// Spec is the desired state of a device.
+type Spec struct {
+	Name      *string            `json:"name,omitempty"`      // Device name (Sys device.name), only for a single device
+	Room      *string            `json:"room,omitempty"`      // Room the device is assigned to in MyHome
+	Scripts   []string           `json:"scripts,omitempty"`   // Embedded scripts to keep uploaded at their current version
+	KVS       map[string]string  `json:"kvs,omitempty"`       // KVS values, by key
+	Schedules []Schedule         `json:"schedules,omitempty"` // Scheduled jobs, by timespec
+	Switches  map[int]SwitchSpec `json:"switches,omitempty"`  // Switch settings, by switch id
+	Inputs    map[int]InputSpec  `json:"inputs,omitempty"`    // Input settings, by input id
+	WiFi      *WiFiSpec          `json:"wifi,omitempty"`      // WiFi settings
+	BLE       *BLESpec           `json:"ble,omitempty"`       // Bluetooth settings
+}
+
+// Schedule is a scheduled job, identified by its timespec.
+type Schedule struct {
+	Timespec string             `json:"timespec"`         // As defined by mongoose cron, e.g. "0 0 8 * * *"
+	Calls    []schedule.JobCall `json:"calls"`            // RPC methods to call
+	Enable   *bool              `json:"enable,omitempty"` // Default: true
+}
+
+func (s Schedule) jobSpec() schedule.JobSpec {
+	return schedule.JobSpec{
+		Enable:   s.Enable == nil || *s.Enable,
+		Timespec: s.Timespec,
+		Calls:    s.Calls,
+	}
+}
+
+type SwitchSpec struct {
+	Name         *string `json:"name,omitempty"`          // Name of the switch
+	InMode       *string `json:"in_mode,omitempty"`       // momentary, follow, flip, detached or cycle
+	InitialState *string `json:"initial_state,omitempty"` // off, on, restore_last or match_input
+}
+
+type InputSpec struct {
+	Name   *string `json:"name,omitempty"`   // Name of the input
+	Type   *string `json:"type,omitempty"`   // switch, button, analog or count
+	Enable *bool   `json:"enable,omitempty"` // False to silence the input
+	Invert *bool   `json:"invert,omitempty"` // True to invert the logical state of the input
+}
+
+type WiFiSpec struct {
+	AP       *bool            `json:"ap,omitempty"`   // True to keep the device access point enabled
+	SSID     *string          `json:"ssid,omitempty"` // SSID of the network to join
+	Password *string          `json:"pass,omitempty"` // Password of the network, only set along with the SSID
+	Roam     *wifi.RoamConfig `json:"roam,omitempty"` // Roaming settings
+}
+
+type BLESpec struct {
+	Enable   *bool `json:"enable,omitempty"`   // True to enable Bluetooth
+	Observer *bool `json:"observer,omitempty"` // True to enable the BLE observer (e.g. to receive BLU devices events)
+}
+
+// Load reads and parses a fleet declaration (YAML or JSON).
+func Load(filename string) (*File, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	f, err := Parse(buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	return f, nil
+}
+
+// Parse parses and checks a fleet declaration.
+func Parse(buf []byte) (*File, error) {
+	var f File
+	if err := yaml.UnmarshalStrict(buf, &f); err != nil {
+		return nil, err
+	}
+	for key, spec := range f.Devices {
+		if spec == nil {
+			return nil, fmt.Errorf("device %q: empty declaration", key)
+		}
+		if isPattern(key) {
+			if _, err := path.Match(key, ""); err != nil {
+				return nil, fmt.Errorf("device %q: invalid pattern: %w", key, err)
+			}
+			if spec.Name != nil {
+				return nil, fmt.Errorf("device %q: a name cannot be given to several devices", key)
+			}
+		}
+		timespecs := make(map[string]bool)
+		for _, s := range spec.Schedules {
+			if s.Timespec == "" {
+				return nil, fmt.Errorf("device %q: schedule without timespec", key)
+			}
+			if timespecs[s.Timespec] {
+				return nil, fmt.Errorf("device %q: duplicate schedule %q", key, s.Timespec)
+			}
+			timespecs[s.Timespec] = true
+		}
+		if w := spec.WiFi; w != nil && w.Password != nil && w.SSID == nil {
+			return nil, fmt.Errorf("device %q: wifi password without ssid", key)
+		}
+	}
+	return &f, nil
+}
+
+func isPattern(key string) bool {
+	return strings.ContainsAny(key, "*?[")
+}
+
+// Lookup returns the desired state of the device with the given id and
+// name, merged from every entry matching it, or nil if none does.
+func (f *File) Lookup(id, name string) *Spec {
+	var patterns []string
+	var exact *Spec
+	for key, spec := range f.Devices {
+		if !isPattern(key) {
+			if key == id || key == name {
+				exact = spec
+			}
+			continue
+		}
+		if m, _ := path.Match(key, id); m {
+			patterns = append(patterns, key)
+		} else if m, _ := path.Match(key, name); m {
+			patterns = append(patterns, key)
+		}
+	}
+	if exact == nil && len(patterns) == 0 {
+		return nil
+	}
+	sort.Strings(patterns)
+
+	out := &Spec{}
+	for _, key := range patterns {
+		out.merge(f.Devices[key])
+	}
+	if exact != nil {
+		out.merge(exact)
+	}
+	return out
+}
+
+// merge overrides s with the settings given in o.
+func (s *Spec) merge(o *Spec) {
+	if o.Name != nil {
+		s.Name = o.Name
+	}
+	if o.Room != nil {
+		s.Room = o.Room
+	}
+	for _, name := range o.Scripts {
+		found := false
+		for _, n := range s.Scripts {
+			found = found || n == name
+		}
+		if !found {
+			s.Scripts = append(s.Scripts, name)
+		}
+	}
+	for k, v := range o.KVS {
+		if s.KVS == nil {
+			s.KVS = make(map[string]string)
+		}
+		s.KVS[k] = v
+	}
+	for _, job := range o.Schedules {
+		replaced := false
+		for i := range s.Schedules {
+			if s.Schedules[i].Timespec == job.Timespec {
+				s.Schedules[i] = job
+				replaced = true
+			}
+		}
+		if !replaced {
+			s.Schedules = append(s.Schedules, job)
+		}
+	}
+	for id, sw := range o.Switches {
+		if s.Switches == nil {
+			s.Switches = make(map[int]SwitchSpec)
+		}
+		cur := s.Switches[id]
+		if sw.Name != nil {
+			cur.Name = sw.Name
+		}
+		if sw.InMode != nil {
+			cur.InMode = sw.InMode
+		}
+		if sw.InitialState != nil {
+			cur.InitialState = sw.InitialState
+		}
+		s.Switches[id] = cur
+	}
+	for id, in := range o.Inputs {
+		if s.Inputs == nil {
+			s.Inputs = make(map[int]InputSpec)
+		}
+		cur := s.Inputs[id]
+		if in.Name != nil {
+			cur.Name = in.Name
+		}
+		if in.Type != nil {
+			cur.Type = in.Type
+		}
+		if in.Enable != nil {
+			cur.Enable = in.Enable
+		}
+		if in.Invert != nil {
+			cur.Invert = in.Invert
+		}
+		s.Inputs[id] = cur
+	}
+	if o.WiFi != nil {
+		if s.WiFi == nil {
+			s.WiFi = &WiFiSpec{}
+		}
+		if o.WiFi.AP != nil {
+			s.WiFi.AP = o.WiFi.AP
+		}
+		if o.WiFi.SSID != nil {
+			s.WiFi.SSID = o.WiFi.SSID
+			s.WiFi.Password = o.WiFi.Password
+		}
+		if o.WiFi.Roam != nil {
+			s.WiFi.Roam = o.WiFi.Roam
+		}
+	}
+	if o.BLE != nil {
+		if s.BLE == nil {
+			s.BLE = &BLESpec{}
+		}
+		if o.BLE.Enable != nil {
+			s.BLE.Enable = o.BLE.Enable
+		}
+		if o.BLE.Observer != nil {
+			s.BLE.Observer = o.BLE.Observer
+		}
+	}
+}
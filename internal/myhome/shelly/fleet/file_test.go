@@ -0,0 +1,87 @@
+package fleet
+
+import (
+	"testing"
+)
+
+const testFile = `
+devices:
+  "shellyplus1-*":
+    ble:
+      observer: true
+    kvs:
+      a: "1"
+      b: "2"
+    switches:
+      0: {in_mode: follow}
+  "shellyplus1-a*":
+    scripts: [watchdog.js]
+  front-door:
+    name: front-door
+    room: entrance
+    kvs:
+      b: "3"
+    switches:
+      0: {initial_state: "off"}
+    schedules:
+      - timespec: "0 0 8 * * *"
+        calls:
+          - method: Switch.Set
+            params: {id: 0, on: true}
+`
+
+func TestParse_Errors(t *testing.T) {
+	for name, in := range map[string]string{
+		"unknown field":     "devices:\n  a:\n    color: red\n",
+		"named pattern":     "devices:\n  \"a-*\":\n    name: a\n",
+		"bad pattern":       "devices:\n  \"a-[\":\n    room: r\n",
+		"no timespec":       "devices:\n  a:\n    schedules:\n      - calls: []\n",
+		"duplicate job":     "devices:\n  a:\n    schedules:\n      - timespec: \"* * * * * *\"\n      - timespec: \"* * * * * *\"\n",
+		"password, no ssid": "devices:\n  a:\n    wifi:\n      pass: secret\n",
+	} {
+		if _, err := Parse([]byte(in)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	f, err := Parse([]byte(testFile))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if spec := f.Lookup("shellypro4pm-000000000000", "kitchen"); spec != nil {
+		t.Errorf("expected no spec, got %+v", spec)
+	}
+
+	// Matched by id through both patterns, and by name
+	spec := f.Lookup("shellyplus1-a0b1c2d3e4f5", "front-door")
+	if spec == nil {
+		t.Fatal("expected a spec")
+	}
+	if spec.Name == nil || *spec.Name != "front-door" || spec.Room == nil || *spec.Room != "entrance" {
+		t.Errorf("unexpected name/room: %v/%v", spec.Name, spec.Room)
+	}
+	if spec.BLE == nil || spec.BLE.Observer == nil || !*spec.BLE.Observer {
+		t.Errorf("expected the BLE observer from the pattern, got %+v", spec.BLE)
+	}
+	if spec.KVS["a"] != "1" || spec.KVS["b"] != "3" {
+		t.Errorf("expected the device entry to override the pattern KVS, got %v", spec.KVS)
+	}
+	if len(spec.Scripts) != 1 || spec.Scripts[0] != "watchdog.js" {
+		t.Errorf("unexpected scripts %v", spec.Scripts)
+	}
+	sw := spec.Switches[0]
+	if sw.InMode == nil || *sw.InMode != "follow" || sw.InitialState == nil || *sw.InitialState != "off" {
+		t.Errorf("expected merged switch settings, got %+v", sw)
+	}
+	if len(spec.Schedules) != 1 || !spec.Schedules[0].jobSpec().Enable {
+		t.Errorf("expected one enabled schedule, got %+v", spec.Schedules)
+	}
+
+	// The pattern entries are not modified by the merge
+	if f.Devices["shellyplus1-*"].KVS["b"] != "2" {
+		t.Error("merge modified the pattern entry")
+	}
+}
@@ -0,0 +1,447 @@
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	mhscript "github.com/asnowfix/home-automation/internal/myhome/shelly/script"
+	"github.com/asnowfix/home-automation/pkg/shelly/ble"
+	"github.com/asnowfix/home-automation/pkg/shelly/input"
+	"github.com/asnowfix/home-automation/pkg/shelly/kvs"
+	"github.com/asnowfix/home-automation/pkg/shelly/schedule"
+	pkgscript "github.com/asnowfix/home-automation/pkg/shelly/script"
+	"github.com/asnowfix/home-automation/pkg/shelly/sswitch"
+	"github.com/asnowfix/home-automation/pkg/shelly/system"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+	"github.com/asnowfix/home-automation/pkg/shelly/wifi"
+
+	"github.com/go-logr/logr"
+)
+
+// Rooms reads and assigns the rooms of devices, which MyHome keeps in its
+// own database rather than on the devices.
+type Rooms interface {
+	GetRoom(ctx context.Context, deviceId string) (string, error)
+	SetRoom(ctx context.Context, deviceId string, room string) error
+}
+
+// Change is one difference between the desired and the live state of a
+// device.
+type Change struct {
+	Component string `json:"component"`       // e.g. sys, switch:0, kvs, script:watchdog.js
+	Field     string `json:"field,omitempty"` // e.g. name, in_mode, or the KVS key
+	From      any    `json:"from,omitempty"`  // Live value, if any
+	To        any    `json:"to"`              // Desired value
+
+	apply func(ctx context.Context) error
+}
+
+func (c Change) String() string {
+	what := c.Component
+	if c.Field != "" {
+		what += "." + c.Field
+	}
+	if c.From == nil {
+		return fmt.Sprintf("%s: set %v", what, c.To)
+	}
+	return fmt.Sprintf("%s: %v -> %v", what, c.From, c.To)
+}
+
+// Plan lists the changes that converge a device to its desired state.
+type Plan struct {
+	Device  string   `json:"device"`
+	Changes []Change `json:"changes"`
+}
+
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// Apply makes the changes of the plan, in order, and stops at the first
+// error.
+func (p *Plan) Apply(ctx context.Context) error {
+	for _, c := range p.Changes {
+		if err := c.apply(ctx); err != nil {
+			return fmt.Errorf("failed to apply %s on %s: %w", c, p.Device, err)
+		}
+	}
+	return nil
+}
+
+// differ accumulates the changes of a device's plan.
+type differ struct {
+	log    logr.Logger
+	via    types.Channel
+	device types.Device
+	plan   *Plan
+}
+
+// once makes fn run only once, for the changes of several fields of a
+// component that are set together.
+func once(fn func(ctx context.Context) error) func(ctx context.Context) error {
+	done := false
+	return func(ctx context.Context) error {
+		if done {
+			return nil
+		}
+		done = true
+		return fn(ctx)
+	}
+}
+
+func (d *differ) add(component, field string, from, to any, apply func(ctx context.Context) error) {
+	d.plan.Changes = append(d.plan.Changes, Change{Component: component, Field: field, From: from, To: to, apply: apply})
+}
+
+// Diff compares the live state of device with spec, and returns the plan
+// converging it. Rooms may be nil, to leave rooms alone.
+func Diff(ctx context.Context, log logr.Logger, via types.Channel, device types.Device, rooms Rooms, spec *Spec) (*Plan, error) {
+	d := &differ{log: log, via: via, device: device, plan: &Plan{Device: device.Id()}}
+	for _, step := range []func(ctx context.Context, spec *Spec) error{
+		d.name,
+		d.wifi,
+		d.ble,
+		d.switches,
+		d.inputs,
+		d.kvs,
+		d.schedules,
+		d.scripts,
+	} {
+		if err := step(ctx, spec); err != nil {
+			return nil, fmt.Errorf("failed to diff %s: %w", device.Id(), err)
+		}
+	}
+	if spec.Room != nil && rooms != nil {
+		room, err := rooms.GetRoom(ctx, device.Id())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get room of %s: %w", device.Id(), err)
+		}
+		if room != *spec.Room {
+			want := *spec.Room
+			d.add("room", "", nonEmpty(room), want, func(ctx context.Context) error {
+				return rooms.SetRoom(ctx, device.Id(), want)
+			})
+		}
+	}
+	return d.plan, nil
+}
+
+// nonEmpty returns nil for an empty string, so that it is shown as unset.
+func nonEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func (d *differ) name(ctx context.Context, spec *Spec) error {
+	if spec.Name == nil {
+		return nil
+	}
+	config, err := system.GetConfig(ctx, d.via, d.device)
+	if err != nil {
+		return err
+	}
+	if config.Device == nil {
+		config.Device = &system.DeviceConfig{}
+	}
+	if config.Device.Name == *spec.Name {
+		return nil
+	}
+	d.add("sys", "name", nonEmpty(config.Device.Name), *spec.Name, func(ctx context.Context) error {
+		config.Device.Name = *spec.Name
+		_, err := system.SetConfig(ctx, d.via, d.device, config)
+		return err
+	})
+	return nil
+}
+
+func (d *differ) wifi(ctx context.Context, spec *Spec) error {
+	w := spec.WiFi
+	if w == nil {
+		return nil
+	}
+	config, err := wifi.DoGetConfig(ctx, d.via, d.device)
+	if err != nil {
+		return err
+	}
+	var want wifi.Config
+	set := once(func(ctx context.Context) error {
+		if want.Roam == nil {
+			want.Roam = config.Roam
+		}
+		_, err := wifi.DoSetConfig(ctx, d.via, d.device, &want)
+		return err
+	})
+	if w.AP != nil {
+		ap := config.AP
+		if ap == nil {
+			ap = &wifi.AP{}
+		}
+		if ap.Enable != *w.AP {
+			d.add("wifi", "ap.enable", ap.Enable, *w.AP, set)
+			ap.Enable = *w.AP
+			want.AP = ap
+		}
+	}
+	if w.SSID != nil {
+		sta := config.STA
+		if sta == nil {
+			sta = &wifi.STA{}
+		}
+		if sta.SSID != *w.SSID || !sta.Enable {
+			d.add("wifi", "sta.ssid", nonEmpty(sta.SSID), *w.SSID, set)
+			sta.Enable = true
+			sta.SSID = *w.SSID
+			sta.Password = w.Password
+			sta.IsOpen = w.Password == nil
+			want.STA = sta
+		}
+	}
+	if w.Roam != nil && (config.Roam == nil || *config.Roam != *w.Roam) {
+		var from any
+		if config.Roam != nil {
+			from = *config.Roam
+		}
+		d.add("wifi", "roam", from, *w.Roam, set)
+		want.Roam = w.Roam
+	}
+	return nil
+}
+
+func (d *differ) ble(ctx context.Context, spec *Spec) error {
+	b := spec.BLE
+	if b == nil {
+		return nil
+	}
+	config, err := ble.DoGetConfig(ctx, d.via, d.device)
+	if err != nil {
+		return err
+	}
+	set := once(func(ctx context.Context) error {
+		_, err := ble.DoSetConfig(ctx, d.via, d.device, config)
+		return err
+	})
+	if b.Enable != nil && config.Enable != *b.Enable {
+		d.add("ble", "enable", config.Enable, *b.Enable, set)
+		config.Enable = *b.Enable
+	}
+	if b.Observer != nil {
+		if config.Observer == nil {
+			config.Observer = &ble.Observer{}
+		}
+		if config.Observer.Enable != *b.Observer {
+			d.add("ble", "observer.enable", config.Observer.Enable, *b.Observer, set)
+			config.Observer.Enable = *b.Observer
+		}
+	}
+	return nil
+}
+
+func sortedIds[T any](m map[int]T) []int {
+	ids := make([]int, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (d *differ) switches(ctx context.Context, spec *Spec) error {
+	for _, id := range sortedIds(spec.Switches) {
+		sw := spec.Switches[id]
+		config, err := sswitch.GetConfig(ctx, d.device, d.via, id)
+		if err != nil {
+			return err
+		}
+		component := fmt.Sprintf("switch:%d", id)
+		set := once(func(ctx context.Context) error {
+			_, err := sswitch.SetConfig(ctx, d.device, d.via, id, config)
+			return err
+		})
+		for _, f := range []struct {
+			field string
+			want  *string
+			live  *string
+		}{
+			{"name", sw.Name, &config.Name},
+			{"in_mode", sw.InMode, &config.InMode},
+			{"initial_state", sw.InitialState, &config.InitialState},
+		} {
+			if f.want != nil && *f.live != *f.want {
+				d.add(component, f.field, nonEmpty(*f.live), *f.want, set)
+				*f.live = *f.want
+			}
+		}
+	}
+	return nil
+}
+
+func (d *differ) inputs(ctx context.Context, spec *Spec) error {
+	for _, id := range sortedIds(spec.Inputs) {
+		in := spec.Inputs[id]
+		out, err := d.device.CallE(ctx, d.via, input.GetConfig.String(), map[string]int{"id": id})
+		if err != nil {
+			return err
+		}
+		config, ok := out.(*input.Configuration)
+		if !ok {
+			return fmt.Errorf("unexpected response type %T (should be *input.Configuration)", out)
+		}
+		component := fmt.Sprintf("input:%d", id)
+		set := once(func(ctx context.Context) error {
+			_, err := d.device.CallE(ctx, d.via, input.SetConfig.String(), &input.ConfigurationRequest{Id: id, Config: *config})
+			return err
+		})
+		if in.Name != nil && config.Name != *in.Name {
+			d.add(component, "name", nonEmpty(config.Name), *in.Name, set)
+			config.Name = *in.Name
+		}
+		if in.Type != nil && config.Type != *in.Type {
+			d.add(component, "type", nonEmpty(config.Type), *in.Type, set)
+			config.Type = *in.Type
+		}
+		if in.Enable != nil && config.Enable != *in.Enable {
+			d.add(component, "enable", config.Enable, *in.Enable, set)
+			config.Enable = *in.Enable
+		}
+		if in.Invert != nil && config.Invert != *in.Invert {
+			d.add(component, "invert", config.Invert, *in.Invert, set)
+			config.Invert = *in.Invert
+		}
+	}
+	return nil
+}
+
+// kvsValue returns the value of a KVS.GetMany item: the value itself, or an
+// object holding it along with its etag, depending on the firmware.
+func kvsValue(item any) string {
+	switch v := item.(type) {
+	case string:
+		return v
+	case map[string]any:
+		if value, ok := v["value"]; ok {
+			return kvsValue(value)
+		}
+	}
+	buf, _ := json.Marshal(item)
+	return string(buf)
+}
+
+func (d *differ) kvs(ctx context.Context, spec *Spec) error {
+	if len(spec.KVS) == 0 {
+		return nil
+	}
+	res, err := kvs.GetManyValues(ctx, d.log, d.via, d.device, "*")
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(spec.KVS))
+	for key := range spec.KVS {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		want := spec.KVS[key]
+		var from any
+		if item, ok := res.Items[key]; ok {
+			live := kvsValue(item)
+			if live == want {
+				continue
+			}
+			from = live
+		}
+		d.add("kvs", key, from, want, func(ctx context.Context) error {
+			_, err := kvs.SetKeyValue(ctx, d.log, d.via, d.device, key, want)
+			return err
+		})
+	}
+	return nil
+}
+
+func sameJob(a, b schedule.JobSpec) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
+
+func (d *differ) schedules(ctx context.Context, spec *Spec) error {
+	if len(spec.Schedules) == 0 {
+		return nil
+	}
+	out, err := d.device.CallE(ctx, d.via, schedule.List.String(), nil)
+	if err != nil {
+		return err
+	}
+	scheduled, ok := out.(*schedule.Scheduled)
+	if !ok {
+		return fmt.Errorf("unexpected response type %T (should be *schedule.Scheduled)", out)
+	}
+	for _, s := range spec.Schedules {
+		want := s.jobSpec()
+		var live *schedule.Job
+		for i := range scheduled.Jobs {
+			if scheduled.Jobs[i].Timespec == want.Timespec {
+				live = &scheduled.Jobs[i]
+				break
+			}
+		}
+		if live == nil {
+			d.add("schedule", want.Timespec, nil, want, func(ctx context.Context) error {
+				_, err := d.device.CallE(ctx, d.via, schedule.Create.String(), &want)
+				return err
+			})
+			continue
+		}
+		if sameJob(live.JobSpec, want) {
+			continue
+		}
+		job := schedule.Job{JobId: schedule.JobId{Id: live.Id}, JobSpec: want}
+		d.add("schedule", want.Timespec, live.JobSpec, want, func(ctx context.Context) error {
+			_, err := d.device.CallE(ctx, d.via, schedule.Update.String(), &job)
+			return err
+		})
+	}
+	return nil
+}
+
+func (d *differ) scripts(ctx context.Context, spec *Spec) error {
+	if len(spec.Scripts) == 0 {
+		return nil
+	}
+	loaded, err := pkgscript.ListLoaded(ctx, d.via, d.device)
+	if err != nil {
+		return err
+	}
+	versions, err := kvs.GetManyValues(ctx, d.log, d.via, d.device, "script/*")
+	if err != nil {
+		return err
+	}
+	for _, name := range spec.Scripts {
+		code, err := pkgscript.ReadEmbeddedFile(name)
+		if err != nil {
+			return fmt.Errorf("unknown script %q: %w", name, err)
+		}
+		want := mhscript.Version(code)
+		var from any
+		for _, s := range loaded {
+			if s.Name == name {
+				from = "unknown"
+				if item, ok := versions.Items["script/"+name]; ok {
+					from = kvsValue(item)
+				}
+			}
+		}
+		if from == want {
+			continue
+		}
+		d.add("script:"+name, "version", from, want, func(ctx context.Context) error {
+			_, err := mhscript.UploadWithVersion(ctx, d.log, d.via, d.device, name, code, true, false)
+			return err
+		})
+	}
+	return nil
+}
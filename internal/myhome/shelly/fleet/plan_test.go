@@ -0,0 +1,180 @@
+package fleet
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/ble"
+	"github.com/asnowfix/home-automation/pkg/shelly/kvs"
+	"github.com/asnowfix/home-automation/pkg/shelly/schedule"
+	"github.com/asnowfix/home-automation/pkg/shelly/sswitch"
+	"github.com/asnowfix/home-automation/pkg/shelly/system"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+type fakeRooms struct {
+	rooms map[string]string
+}
+
+func (r *fakeRooms) GetRoom(ctx context.Context, deviceId string) (string, error) {
+	return r.rooms[deviceId], nil
+}
+
+func (r *fakeRooms) SetRoom(ctx context.Context, deviceId string, room string) error {
+	r.rooms[deviceId] = room
+	return nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func fakeDevice() *types.FakeDevice {
+	d := types.NewFakeDevice()
+	d.IdValue = "shellyplus1-a0b1c2d3e4f5"
+	d.SetResult("Sys.GetConfig", &system.Config{Device: &system.DeviceConfig{Name: "old-name"}})
+	d.SetResult("Sys.SetConfig", &system.SetConfigResponse{})
+	d.SetResult("BLE.GetConfig", &ble.Config{Enable: true, Observer: &ble.Observer{Enable: true}})
+	d.SetResult("Switch.GetConfig", &sswitch.Config{Id: 0, InMode: "momentary", InitialState: "off"})
+	d.SetResult("Switch.SetConfig", &sswitch.ConfigurationResponse{})
+	d.SetResult("KVS.GetMany", &kvs.GetManyResponse{Items: kvs.FlexibleMap{
+		"a": "1",
+		"b": map[string]any{"value": "2", "etag": "x"},
+	}})
+	d.SetResult("KVS.Set", &kvs.Status{})
+	d.SetResult(schedule.List.String(), &schedule.Scheduled{Jobs: []schedule.Job{
+		{JobId: schedule.JobId{Id: 1}, JobSpec: schedule.JobSpec{Enable: true, Timespec: "0 0 8 * * *"}},
+	}})
+	d.SetResult(schedule.Create.String(), &schedule.JobId{Id: 2})
+	d.SetResult(schedule.Update.String(), &schedule.JobsRevision{})
+	return d
+}
+
+func methods(d *types.FakeDevice) []string {
+	out := make([]string, 0, len(d.Calls))
+	for _, c := range d.Calls {
+		out = append(out, c.Method)
+	}
+	return out
+}
+
+func TestDiff_InSync(t *testing.T) {
+	d := fakeDevice()
+	rooms := &fakeRooms{rooms: map[string]string{d.Id(): "entrance"}}
+	spec := &Spec{
+		Name:     ptr("old-name"),
+		Room:     ptr("entrance"),
+		BLE:      &BLESpec{Observer: ptr(true)},
+		Switches: map[int]SwitchSpec{0: {InMode: ptr("momentary")}},
+		KVS:      map[string]string{"a": "1", "b": "2"},
+		Schedules: []Schedule{
+			{Timespec: "0 0 8 * * *"},
+		},
+	}
+	plan, err := Diff(context.Background(), logr.Discard(), types.ChannelDefault, d, rooms, spec)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if !plan.Empty() {
+		t.Errorf("expected an empty plan, got %v", plan.Changes)
+	}
+}
+
+func TestDiff_Apply(t *testing.T) {
+	d := fakeDevice()
+	rooms := &fakeRooms{rooms: map[string]string{}}
+	spec := &Spec{
+		Name:     ptr("front-door"),
+		Room:     ptr("entrance"),
+		BLE:      &BLESpec{Observer: ptr(true)},
+		Switches: map[int]SwitchSpec{0: {InMode: ptr("detached"), InitialState: ptr("on")}},
+		KVS:      map[string]string{"a": "1", "b": "3", "c": "4"},
+		Schedules: []Schedule{
+			{Timespec: "0 0 8 * * *", Enable: ptr(false)},
+			{Timespec: "0 0 20 * * *"},
+		},
+	}
+	plan, err := Diff(context.Background(), logr.Discard(), types.ChannelDefault, d, rooms, spec)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+
+	var got []string
+	for _, c := range plan.Changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"sys.name: old-name -> front-door",
+		"switch:0.in_mode: momentary -> detached",
+		"switch:0.initial_state: off -> on",
+		"kvs.b: 2 -> 3",
+		"kvs.c: set 4",
+		"schedule.0 0 8 * * *: {true 0 0 8 * * * []} -> {false 0 0 8 * * * []}",
+		"schedule.0 0 20 * * *: set {true 0 0 20 * * * []}",
+		"room: set entrance",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got changes %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("change %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	calls := len(d.Calls)
+	if err := plan.Apply(context.Background()); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	applied := methods(d)[calls:]
+	wantMethods := []string{"Sys.SetConfig", "Switch.SetConfig", "KVS.Set", "KVS.Set", schedule.Update.String(), schedule.Create.String()}
+	if len(applied) != len(wantMethods) {
+		t.Fatalf("got calls %v, want %v", applied, wantMethods)
+	}
+	for i := range wantMethods {
+		if applied[i] != wantMethods[i] {
+			t.Errorf("call %d: got %s, want %s", i, applied[i], wantMethods[i])
+		}
+	}
+	req, ok := d.Calls[calls+1].Params.(*sswitch.ConfigurationRequest)
+	if !ok || req.Configuration.InMode != "detached" || req.Configuration.InitialState != "on" {
+		t.Errorf("unexpected Switch.SetConfig params %+v", d.Calls[calls+1].Params)
+	}
+	if rooms.rooms[d.Id()] != "entrance" {
+		t.Errorf("expected the room to be set, got %q", rooms.rooms[d.Id()])
+	}
+}
+
+func TestDiff_Error(t *testing.T) {
+	d := fakeDevice()
+	d.SetError("BLE.GetConfig", errors.New("boom"))
+	_, err := Diff(context.Background(), logr.Discard(), types.ChannelDefault, d, nil, &Spec{BLE: &BLESpec{Enable: ptr(true)}})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestApply_StopsAtFirstError(t *testing.T) {
+	d := fakeDevice()
+	d.SetError("KVS.Set", errors.New("boom"))
+	plan, err := Diff(context.Background(), logr.Discard(), types.ChannelDefault, d, nil, &Spec{
+		KVS:  map[string]string{"x": "1", "y": "2"},
+		Room: ptr("ignored without rooms"),
+	})
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if len(plan.Changes) != 2 {
+		t.Fatalf("expected 2 changes, got %v", plan.Changes)
+	}
+	calls := len(d.Calls)
+	if err := plan.Apply(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if n := len(d.Calls) - calls; n != 1 {
+		t.Errorf("expected Apply to stop after 1 call, got %d", n)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/asnowfix/home-automation/myhome/events"
+	shellyapi "github.com/asnowfix/home-automation/pkg/shelly"
 	mqttclient "github.com/asnowfix/home-automation/pkg/shelly/mqtt"
 	"github.com/go-logr/logr"
 )
@@ -28,7 +29,16 @@ func NewListener(log logr.Logger, mqtt mqttclient.Client, svc *events.Service, t
 	}
 }
 
+// Start records the notifications devices push over MQTT and, for the
+// devices watched over WebSocket (see shelly.WatchWebsocket), over WebSocket.
 func (l *Listener) Start(ctx context.Context) error {
+	if err := shellyapi.SubscribeWebsocket("shelly/gen2/events", func(topic string, payload []byte, _ string) error {
+		return l.handleRpc(ctx, payload)
+	}); err != nil {
+		l.log.Error(err, "Failed to subscribe to WebSocket notifications")
+		return err
+	}
+
 	if err := l.mqtt.SubscribeWithHandler(ctx, "+/events/rpc", 16, "shelly/gen2/events", func(topic string, payload []byte, _ string) error {
 		return l.handleRpc(ctx, payload)
 	}); err != nil {
@@ -6,9 +6,11 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/asnowfix/home-automation/internal/shelly/scripts"
 	"github.com/asnowfix/home-automation/pkg/shelly/kvs"
 	"github.com/asnowfix/home-automation/pkg/shelly/script"
 	"github.com/asnowfix/home-automation/pkg/shelly/types"
+	"github.com/asnowfix/home-automation/pkg/shelly/virtual"
 	"path/filepath"
 	"time"
 
@@ -169,16 +171,21 @@ func UploadWithVersion(ctx context.Context, log logr.Logger, via types.Channel,
 	return id, nil
 }
 
+// Version returns the version of a script as recorded in the device KVS
+// (under script/<name>) by UploadWithVersion: the SHA-1 of its source code.
+func Version(code []byte) string {
+	h := sha1.New()
+	h.Write(code)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 // UploadWithVersionDetailed does the work of UploadWithVersion but also
 // reports an UploadStatus, letting the caller distinguish a fully confirmed
 // upload from one where the code was delivered but a follow-up
 // confirmation step (enabling/starting the script) did not respond. See
 // issue #428.
 func UploadWithVersionDetailed(ctx context.Context, log logr.Logger, via types.Channel, device types.Device, name string, code []byte, minify bool, force bool) (uint32, UploadStatus, error) {
-	// Calculate version hash
-	h := sha1.New()
-	h.Write(code)
-	version := hex.EncodeToString(h.Sum(nil))
+	version := Version(code)
 
 	// Use basename to get just the filename without any directory path
 	basename := filepath.Base(name)
@@ -242,6 +249,9 @@ func UploadWithVersionDetailed(ctx context.Context, log logr.Logger, via types.C
 		log.Info(reason, "name", name, "version", version)
 	}
 
+	// The virtual components the script uses must exist before it starts
+	ensureVirtualComponents(ctx, log, via, device, basename)
+
 	// Now start the script, with a bounded retry: the device is often still
 	// busy for a few seconds right after upload, and a bare timeout on the
 	// first attempt is not evidence the upload failed (issue #428).
@@ -252,6 +262,39 @@ func UploadWithVersionDetailed(ctx context.Context, log logr.Logger, via types.C
 	return id, status, nil
 }
 
+// virtualComponents returns the virtual components declared for a script; a
+// var so tests can declare some without an embedded schema.
+var virtualComponents = scripts.VirtualComponents
+
+// ensureVirtualComponents creates the virtual components declared in the
+// schema of the script name that are missing on the device, and updates the
+// configuration of the existing ones. Like the version marker, failures are
+// logged but do not fail the upload: older firmwares have no virtual
+// components.
+func ensureVirtualComponents(ctx context.Context, log logr.Logger, via types.Channel, device types.Device, name string) {
+	specs, err := virtualComponents(name)
+	if err != nil {
+		log.Error(err, "Unable to read the virtual components of the script", "name", name)
+		return
+	}
+	for _, spec := range specs {
+		key := virtual.Key(spec.Type, *spec.Id)
+		if _, err := virtual.GetConfig(ctx, device, via, spec.Type, *spec.Id); err == nil {
+			if spec.Config != nil {
+				if _, err := virtual.SetConfig(ctx, device, via, spec.Type, *spec.Id, spec.Config); err != nil {
+					log.Error(err, "Unable to configure virtual component", "key", key, "device", device.Name())
+				}
+			}
+			continue
+		}
+		if _, err := virtual.Add(ctx, device, via, spec.Type, *spec.Id, spec.Config); err != nil {
+			log.Error(err, "Unable to add virtual component", "key", key, "device", device.Name())
+			continue
+		}
+		log.Info("Added virtual component", "key", key, "script", name, "device", device.Name())
+	}
+}
+
 // shouldUpload decides whether the script's code must be sent to the device,
 // and returns the reason for the log line.
 //
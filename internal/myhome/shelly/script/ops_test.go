@@ -11,7 +11,9 @@ import (
 	"github.com/asnowfix/home-automation/pkg/shelly/kvs"
 	pkgscript "github.com/asnowfix/home-automation/pkg/shelly/script"
 	"github.com/asnowfix/home-automation/pkg/shelly/types"
+	"github.com/asnowfix/home-automation/pkg/shelly/virtual"
 
+	"github.com/go-logr/logr"
 	"github.com/go-logr/logr/testr"
 )
 
@@ -309,6 +311,7 @@ func (f *fakeUploadDevice) StopDialog(_ context.Context, _ uint32)
 func (f *fakeUploadDevice) IsHttpReady() bool                                          { return false }
 func (f *fakeUploadDevice) IsMqttReady() bool                                          { return true }
 func (f *fakeUploadDevice) Channel(_ context.Context, via types.Channel) types.Channel { return via }
+func (f *fakeUploadDevice) ResolveHost(_ context.Context) bool                         { return false }
 func (f *fakeUploadDevice) UpdateName(_ string)                                        {}
 func (f *fakeUploadDevice) UpdateHost(_ string)                                        {}
 func (f *fakeUploadDevice) ClearHost()                                                 {}
@@ -452,3 +455,40 @@ func (f *failingCallDevice) CallE(ctx context.Context, via types.Channel, method
 	}
 	return f.fakeUploadDevice.CallE(ctx, via, method, params)
 }
+
+// TestEnsureVirtualComponents checks that the virtual components declared in
+// a script schema are added when missing and reconfigured when present.
+func TestEnsureVirtualComponents(t *testing.T) {
+	orig := virtualComponents
+	t.Cleanup(func() { virtualComponents = orig })
+
+	existing, missing := 200, 201
+	name := "Eco speed"
+	virtualComponents = func(string) ([]virtual.AddRequest, error) {
+		return []virtual.AddRequest{
+			{Type: virtual.TypeNumber, Id: &existing, Config: &virtual.Config{Name: &name}},
+			{Type: virtual.TypeBoolean, Id: &missing},
+		}, nil
+	}
+
+	d := types.NewFakeDevice()
+	d.SetResult("Number.GetConfig", &virtual.Config{Id: existing})
+	d.SetResult("Number.SetConfig", &virtual.ConfigurationResponse{})
+	d.SetError("Boolean.GetConfig", fmt.Errorf("-105: Argument 'id', value 201 not found"))
+	d.SetResult("Virtual.Add", &virtual.AddResponse{Id: missing})
+
+	ensureVirtualComponents(context.Background(), logr.Discard(), types.ChannelDefault, d, "pool-pump.js")
+
+	want := []string{"Number.GetConfig", "Number.SetConfig", "Boolean.GetConfig", "Virtual.Add"}
+	if len(d.Calls) != len(want) {
+		t.Fatalf("expected calls %v, got %v", want, d.Calls)
+	}
+	for i, m := range want {
+		if d.Calls[i].Method != m {
+			t.Errorf("call %d: expected %s, got %s", i, m, d.Calls[i].Method)
+		}
+	}
+	if req := d.Calls[3].Params.(*virtual.AddRequest); req.Type != virtual.TypeBoolean || *req.Id != missing {
+		t.Errorf("unexpected Virtual.Add params %#v", req)
+	}
+}
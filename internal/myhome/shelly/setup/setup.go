@@ -13,6 +13,7 @@ import (
 	"github.com/go-logr/logr"
 
 	mynet "github.com/asnowfix/home-automation/internal/myhome/net"
+	"github.com/asnowfix/home-automation/internal/myhome/shelly/firmware"
 	mhscript "github.com/asnowfix/home-automation/internal/myhome/shelly/script"
 	"github.com/asnowfix/home-automation/pkg/devices"
 	shellyapi "github.com/asnowfix/home-automation/pkg/shelly"
@@ -418,7 +419,7 @@ func resolveMqttServer(ctx context.Context, log logr.Logger, cfg Config) (string
 
 // rebootIfRequired reboots the device and waits for it to come back online, if the
 // device reports that a restart is required (e.g. after an MQTT broker change).
-func rebootIfRequired(ctx context.Context, log logr.Logger, via types.Channel, sd *shellyapi.Device, deviceId string) error {
+func rebootIfRequired(ctx context.Context, log logr.Logger, via types.Channel, sd types.Device, deviceId string) error {
 	status, err := system.GetStatus(ctx, via, sd)
 	if err != nil {
 		log.Error(err, "Failed to get device status", "device", deviceId)
@@ -470,51 +471,62 @@ func rebootIfRequired(ctx context.Context, log logr.Logger, via types.Channel, s
 // one, so it can force types.ChannelHttp: if a device's MQTT broker is wrong, its
 // "MQTT ready" flag can look fine while it can't actually reach anything, so only HTTP
 // to the device's own IP is guaranteed to reflect reality.
-func ReconcileConfig(ctx context.Context, log logr.Logger, via types.Channel, sd *shellyapi.Device, cfg Config) error {
+//
+// It reports whether it changed anything on the device, so that the caller only
+// refreshes and records the device when it did.
+func ReconcileConfig(ctx context.Context, log logr.Logger, via types.Channel, sd types.Device, cfg Config) (changed bool, err error) {
 	deviceId := sd.Id()
 
 	config, err := system.GetConfig(ctx, via, sd)
 	if err != nil {
-		return fmt.Errorf("failed to get system config: %w", err)
+		return false, fmt.Errorf("failed to get system config: %w", err)
 	}
 	if config.Sntp.Server != "pool.ntp.org" {
 		config.Sntp.Server = "pool.ntp.org"
 		if _, err := system.SetConfig(ctx, via, sd, config); err != nil {
-			return fmt.Errorf("failed to set system config: %w", err)
+			return false, fmt.Errorf("failed to set system config: %w", err)
 		}
 		log.Info("Reconciled NTP server", "device", deviceId)
+		changed = true
 	}
 
-	if err := matter.Disable(ctx, via, sd); err != nil {
-		log.V(1).Info("Unable to disable Matter during reconciliation (may not be supported)", "device", deviceId, "error", err)
+	if matterCfg, err := matter.GetConfig(ctx, via, sd); err != nil {
+		log.V(1).Info("Unable to get Matter config during reconciliation (may not be supported)", "device", deviceId, "error", err)
+	} else if matterCfg.Enable {
+		if err := matter.Disable(ctx, via, sd); err != nil {
+			log.V(1).Info("Unable to disable Matter during reconciliation", "device", deviceId, "error", err)
+		} else {
+			log.Info("Reconciled Matter (disabled)", "device", deviceId)
+			changed = true
+		}
 	}
 
 	mqttServer, err := resolveMqttServer(ctx, log, cfg)
 	if err != nil {
-		return fmt.Errorf("failed to resolve MQTT broker: %w", err)
+		return changed, fmt.Errorf("failed to resolve MQTT broker: %w", err)
 	}
 	if mqttServer == "" {
-		return nil
+		return changed, nil
 	}
 
 	out, err := sd.CallE(ctx, via, mqtt.GetConfig.String(), nil)
 	if err != nil {
-		return fmt.Errorf("failed to get MQTT config: %w", err)
+		return changed, fmt.Errorf("failed to get MQTT config: %w", err)
 	}
 	mqttCfg, ok := out.(*mqtt.Config)
 	if !ok {
-		return fmt.Errorf("unexpected MQTT config response type: %T", out)
+		return changed, fmt.Errorf("unexpected MQTT config response type: %T", out)
 	}
 	if mqttCfg.Enable && mqttCfg.Server == mqttServer {
-		return nil
+		return changed, nil
 	}
 
 	log.Info("Reconciling MQTT broker", "device", deviceId, "old_server", mqttCfg.Server, "new_server", mqttServer)
 	if _, err := mqtt.SetServer(ctx, via, sd, mqttServer); err != nil {
-		return fmt.Errorf("failed to set MQTT broker: %w", err)
+		return changed, fmt.Errorf("failed to set MQTT broker: %w", err)
 	}
 
-	return rebootIfRequired(ctx, log, via, sd, deviceId)
+	return true, rebootIfRequired(ctx, log, via, sd, deviceId)
 }
 
 // nonAlphanumericRegex matches any non-alphanumeric character
@@ -610,7 +622,9 @@ func transformName(rawName string) string {
 }
 
 // setupAutoUpdateJob creates or updates a scheduled job for Shelly.Update
-// The job runs at a random time between 03:00 and 05:00 every day
+// The job runs at a random time between 03:00 and 05:00 every day, moved
+// past the pool-pump and garden runs scheduled on the device, if any (see
+// firmware.ScheduleWindows): the reboot would stop them.
 func setupAutoUpdateJob(ctx context.Context, log logr.Logger, via types.Channel, sd *shellyapi.Device, deviceId string) error {
 	// Get existing jobs
 	out, err := schedule.ShowJobs(ctx, log, via, sd)
@@ -620,26 +634,26 @@ func setupAutoUpdateJob(ctx context.Context, log logr.Logger, via types.Channel,
 
 	scheduled := out.(*schedule.Scheduled)
 
-	// Generate random time between 03:00 and 05:00
-	randomHour := 3 + rand.Intn(2) // 3 or 4
-	randomMinute := rand.Intn(60)  // 0-59
+	// Generate random time between 03:00 and 05:00, clear of quiet windows
+	at := 3*time.Hour + time.Duration(rand.Intn(120))*time.Minute
+	quiet := firmware.ScheduleWindows(scheduled.Jobs, firmware.DefaultGardenRun)
+	midnight := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	if slot, ok := firmware.NextSlot(quiet, midnight.Add(at), firmware.DefaultTimeout); ok {
+		at = slot.Sub(midnight) % (24 * time.Hour)
+	} else {
+		log.Info("No slot clear of quiet windows for auto-update", "device", deviceId, "quiet", quiet)
+	}
+	randomHour := int(at / time.Hour)
+	randomMinute := int(at%time.Hour) / int(time.Minute)
 
 	// Cron format: second minute hour day month weekday
 	timespec := fmt.Sprintf("0 %d %d * * SUN,MON,TUE,WED,THU,FRI,SAT", randomMinute, randomHour)
 
 	// Look for existing Shelly.Update job
 	var existingJobId *uint32
-	for _, job := range scheduled.Jobs {
-		for _, call := range job.Calls {
-			if call.Method == "Shelly.Update" {
-				existingJobId = &job.JobId.Id
-				log.Info("Found existing Shelly.Update job", "job_id", job.JobId.Id, "timespec", job.Timespec)
-				break
-			}
-		}
-		if existingJobId != nil {
-			break
-		}
+	if job, ok := firmware.AutoUpdateJob(scheduled.Jobs); ok {
+		existingJobId = &job.JobId.Id
+		log.Info("Found existing Shelly.Update job", "job_id", job.JobId.Id, "timespec", job.Timespec)
 	}
 
 	// Create the job spec
@@ -648,7 +662,7 @@ func setupAutoUpdateJob(ctx context.Context, log logr.Logger, via types.Channel,
 		Timespec: timespec,
 		Calls: []schedule.JobCall{
 			{
-				Method: "Shelly.Update",
+				Method: string(shelly.Update),
 				Params: map[string]interface{}{
 					"stage": "stable",
 				},
@@ -0,0 +1,70 @@
+package setup
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/matter"
+	"github.com/asnowfix/home-automation/pkg/shelly/mqtt"
+	"github.com/asnowfix/home-automation/pkg/shelly/system"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+)
+
+// reconciledDevice returns a device whose configuration is already the one
+// ReconcileConfig establishes, with the broker of cfg.
+func reconciledDevice(t *testing.T, ntp string, matterEnabled bool) *types.FakeDevice {
+	t.Helper()
+	var config system.Config
+	if err := json.Unmarshal([]byte(`{"sntp":{"server":"`+ntp+`"}}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	sd := types.NewFakeDevice()
+	sd.IdValue = "shellyplus1-aabbccddeeff"
+	sd.SetResult("Sys.GetConfig", &config)
+	sd.SetResult("Sys.SetConfig", &system.SetConfigResponse{})
+	sd.SetResult("Matter.GetConfig", &matter.Config{Enable: matterEnabled})
+	sd.SetResult("Matter.SetConfig", nil)
+	sd.SetResult(mqtt.GetConfig.String(), &mqtt.Config{Enable: true, Server: "192.168.1.2:1883"})
+	return sd
+}
+
+func TestReconcileConfig_ReportsChanges(t *testing.T) {
+	ctx := context.Background()
+	cfg := Config{MqttBroker: "192.168.1.2:1883"}
+
+	tests := []struct {
+		name    string
+		ntp     string
+		matter  bool
+		changed bool
+		sets    []string
+	}{
+		{"in line", "pool.ntp.org", false, false, nil},
+		{"NTP server drifted", "time.example.org", false, true, []string{"Sys.SetConfig"}},
+		{"Matter enabled", "pool.ntp.org", true, true, []string{"Matter.SetConfig"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd := reconciledDevice(t, tt.ntp, tt.matter)
+			changed, err := ReconcileConfig(ctx, logr.Discard(), types.ChannelHttp, sd, cfg)
+			if err != nil {
+				t.Fatalf("ReconcileConfig: %v", err)
+			}
+			if changed != tt.changed {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+			var sets []string
+			for _, call := range sd.Calls {
+				if call.Method == "Sys.SetConfig" || call.Method == "Matter.SetConfig" || call.Method == mqtt.SetConfig.String() {
+					sets = append(sets, call.Method)
+				}
+			}
+			if len(sets) != len(tt.sets) || (len(sets) == 1 && sets[0] != tt.sets[0]) {
+				t.Errorf("set calls = %v, want %v", sets, tt.sets)
+			}
+		})
+	}
+}
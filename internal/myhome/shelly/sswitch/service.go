@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/asnowfix/home-automation/internal/myhome"
 	"github.com/asnowfix/home-automation/pkg/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/gen1"
 	"github.com/asnowfix/home-automation/pkg/shelly/kvs"
 	pkgshelly "github.com/asnowfix/home-automation/pkg/shelly/shelly"
 	pkgsswitch "github.com/asnowfix/home-automation/pkg/shelly/sswitch"
@@ -19,6 +20,7 @@ import (
 type DeviceProvider interface {
 	GetDeviceByAny(ctx context.Context, identifier string) (*myhome.Device, error)
 	GetShellyDevice(ctx context.Context, device *myhome.Device) (*shelly.Device, error)
+	GetGen1Device(ctx context.Context, device *myhome.Device) (*gen1.Shelly, error)
 }
 
 // Service handles switch RPC methods
@@ -129,7 +131,12 @@ func (s *Service) HandleAll(ctx context.Context, params *myhome.SwitchAllParams)
 		return nil, err
 	}
 
-	switches, err := pkgshelly.GetSwitchesSummary(ctx, sd)
+	var switches map[int]pkgshelly.SwitchSummary
+	if gd, ok := sd.(*gen1.Shelly); ok {
+		switches, err = gd.GetSwitchesSummary(ctx)
+	} else {
+		switches, err = pkgshelly.GetSwitchesSummary(ctx, sd)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get switches summary on device %s: %w", sd.Id(), err)
 	}
@@ -141,12 +148,20 @@ func (s *Service) HandleAll(ctx context.Context, params *myhome.SwitchAllParams)
 	}, nil
 }
 
-func (s *Service) getDevice(ctx context.Context, identifier string) (*myhome.Device, *shelly.Device, error) {
+func (s *Service) getDevice(ctx context.Context, identifier string) (*myhome.Device, types.Device, error) {
 	device, err := s.provider.GetDeviceByAny(ctx, identifier)
 	if err != nil {
 		return nil, nil, fmt.Errorf("device not found: %w", err)
 	}
 
+	if shelly.IsGen1Device(device.Id()) {
+		gd, err := s.provider.GetGen1Device(ctx, device)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get Gen1 device: %w", err)
+		}
+		return device, gd, nil
+	}
+
 	sd, err := s.provider.GetShellyDevice(ctx, device)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get shelly device: %w", err)
@@ -179,8 +194,12 @@ func (s *Service) returnStatus(_ context.Context, log logr.Logger, device *myhom
 
 // OnValue checks the normally-closed KVS key to determine the raw Output value
 // that represents "on" for the given switch (true unless the switch is
-// configured normally-closed via KVS).
-func OnValue(ctx context.Context, log logr.Logger, sd *shelly.Device, switchId int) bool {
+// configured normally-closed via KVS). Gen1 devices have no KVS: their
+// switches are never normally-closed.
+func OnValue(ctx context.Context, log logr.Logger, sd types.Device, switchId int) bool {
+	if shelly.IsGen1Device(sd.Id()) {
+		return true
+	}
 	kv, err := kvs.GetValue(ctx, log, types.ChannelDefault, sd, string(myhome.NormallyClosedKey))
 	if err != nil {
 		log.Info("Unable to get value", "key", string(myhome.NormallyClosedKey), "reason", err)
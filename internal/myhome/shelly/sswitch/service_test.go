@@ -7,6 +7,7 @@ import (
 
 	"github.com/asnowfix/home-automation/internal/myhome"
 	"github.com/asnowfix/home-automation/pkg/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/gen1"
 	"github.com/go-logr/logr"
 )
 
@@ -16,6 +17,7 @@ type fakeProvider struct {
 	deviceErr error
 	sd        *shelly.Device
 	sdErr     error
+	gd        *gen1.Shelly
 }
 
 func (f *fakeProvider) GetDeviceByAny(ctx context.Context, identifier string) (*myhome.Device, error) {
@@ -26,6 +28,10 @@ func (f *fakeProvider) GetShellyDevice(ctx context.Context, device *myhome.Devic
 	return f.sd, f.sdErr
 }
 
+func (f *fakeProvider) GetGen1Device(ctx context.Context, device *myhome.Device) (*gen1.Shelly, error) {
+	return f.gd, nil
+}
+
 func TestGetDevice_DeviceNotFound(t *testing.T) {
 	wantErr := errors.New("no such device")
 	s := NewService(logr.Discard(), &fakeProvider{deviceErr: wantErr})
@@ -55,6 +61,26 @@ func TestGetDevice_ShellyDeviceError(t *testing.T) {
 	}
 }
 
+func TestGetDevice_Gen1(t *testing.T) {
+	gd := gen1.NewShelly("shelly1-34945475FE06", "", nil)
+	s := NewService(logr.Discard(), &fakeProvider{
+		device: (&myhome.Device{}).WithId(gd.Id()),
+		sdErr:  errors.New("not a Gen2+ device"),
+		gd:     gd,
+	})
+
+	_, sd, err := s.getDevice(context.Background(), gd.Id())
+	if err != nil {
+		t.Fatalf("getDevice: %v", err)
+	}
+	if sd != gd {
+		t.Errorf("expected the Gen1 device, got %v", sd)
+	}
+	if !OnValue(context.Background(), logr.Discard(), sd, 0) {
+		t.Error("expected Gen1 switches to never be normally-closed")
+	}
+}
+
 func TestParseOnValue(t *testing.T) {
 	tests := []struct {
 		value string
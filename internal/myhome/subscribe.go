@@ -0,0 +1,308 @@
+package myhome
+
+// Subscription RPC types & server-side registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/shelly"
+	"github.com/go-logr/logr"
+)
+
+// SubscriptionLease is how long a subscription stays alive without being
+// renewed. Clients renew by re-issuing the subscribe verb with the
+// subscription id they were given, every half-lease (see client.SubscribeE).
+// A client that disconnects simply stops renewing, and the server drops its
+// subscription once the lease runs out: MQTT gives the server no reliable
+// per-client disconnect signal on the shared RPC topics.
+const SubscriptionLease = 60 * time.Second
+
+// NotifyMethod names a server-push notification frame, in the same spirit as
+// the NotifyStatus/NotifyEvent frames Shelly devices publish.
+type NotifyMethod string
+
+const (
+	NotifyEvent  NotifyMethod = "NotifyEvent"  // params: EventView, for event.subscribe
+	NotifyDevice NotifyMethod = "NotifyDevice" // params: DeviceNotification, for device.watch
+)
+
+// notifyVerbs maps each notification kind to the subscribe verb whose
+// subscribers receive it.
+var notifyVerbs = map[NotifyMethod]Verb{
+	NotifyEvent:  EventSubscribe,
+	NotifyDevice: DeviceWatch,
+}
+
+// SubscribeParams represents parameters for event.subscribe and
+// device.watch. Every filter is optional; an empty filter matches everything.
+type SubscribeParams struct {
+	DeviceID       string `json:"device_id,omitempty"`       // Exact device id (event.subscribe, device.watch)
+	EventType      string `json:"event,omitempty"`           // Event name prefix, e.g. "switch" (event.subscribe only)
+	Severity       string `json:"severity,omitempty"`        // Exact severity (event.subscribe only)
+	SubscriptionId string `json:"subscription_id,omitempty"` // Set to renew an existing subscription
+}
+
+// SubscribeResult represents the result of event.subscribe and device.watch.
+// SubscriptionId may differ from the one passed in SubscribeParams when the
+// server no longer knew it (e.g. after a daemon restart).
+type SubscribeResult struct {
+	SubscriptionId string        `json:"subscription_id"`
+	Lease          time.Duration `json:"lease"`
+}
+
+// UnsubscribeParams represents parameters for rpc.unsubscribe
+type UnsubscribeParams struct {
+	SubscriptionId string `json:"subscription_id"`
+}
+
+// DeviceNotification is the payload of a NotifyDevice frame: either a single
+// sensor reading (Sensor/Value set) or a refreshed device record.
+type DeviceNotification struct {
+	DeviceID string                       `json:"device_id"`
+	Name     string                       `json:"name,omitempty"`
+	Sensor   string                       `json:"sensor,omitempty"`
+	Value    string                       `json:"value,omitempty"`
+	Switches map[int]shelly.SwitchSummary `json:"switches,omitempty"`
+	Covers   map[int]shelly.CoverSummary  `json:"covers,omitempty"`
+	Lights   map[int]shelly.LightSummary  `json:"lights,omitempty"`
+	Meters   []shelly.MeterSummary        `json:"meters,omitempty"`
+}
+
+// Notification is a server-push frame published on a subscriber's client
+// topic. Unlike a response it carries no request id: it is routed by
+// Subscription instead.
+type Notification struct {
+	Src          string          `json:"src"`
+	Dst          string          `json:"dst"`
+	Method       NotifyMethod    `json:"method"`
+	Subscription string          `json:"subscription"`
+	Params       json.RawMessage `json:"params,omitempty"`
+}
+
+// DecodeParams unmarshals the notification params into v, typically a
+// *EventView or a *DeviceNotification depending on Method.
+func (n Notification) DecodeParams(v any) error {
+	return json.Unmarshal(n.Params, v)
+}
+
+type subscription struct {
+	id      string
+	src     string
+	verb    Verb
+	filter  SubscribeParams
+	expires time.Time
+}
+
+func (s *subscription) matches(params any) bool {
+	switch p := params.(type) {
+	case EventView:
+		if s.filter.DeviceID != "" && p.DeviceID != s.filter.DeviceID {
+			return false
+		}
+		if s.filter.EventType != "" && !strings.HasPrefix(p.Event, s.filter.EventType) {
+			return false
+		}
+		if s.filter.Severity != "" && p.Severity != s.filter.Severity {
+			return false
+		}
+		return true
+	case DeviceNotification:
+		return s.filter.DeviceID == "" || p.DeviceID == s.filter.DeviceID
+	}
+	return false
+}
+
+// subscriptions is the server-side registry of live subscriptions. publish
+// is bound by NewServerE; until then Notify is a no-op (e.g. in ctl
+// processes, which never run a server).
+type subscriptions struct {
+	mu      sync.Mutex
+	byId    map[string]*subscription
+	publish func(ctx context.Context, n Notification) error
+	now     func() time.Time
+}
+
+var theSubscriptions = &subscriptions{
+	byId: make(map[string]*subscription),
+	now:  time.Now,
+}
+
+func (ss *subscriptions) subscribe(verb Verb, src string, p *SubscribeParams) (*SubscribeResult, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if s, exists := ss.byId[p.SubscriptionId]; exists && s.src == src && s.verb == verb {
+		s.filter = *p
+		s.filter.SubscriptionId = ""
+		s.expires = ss.now().Add(SubscriptionLease)
+		return &SubscribeResult{SubscriptionId: s.id, Lease: SubscriptionLease}, nil
+	}
+
+	id, err := RandStringBytesMaskImprRandReaderUnsafe(16)
+	if err != nil {
+		return nil, err
+	}
+	s := &subscription{
+		id:      id,
+		src:     src,
+		verb:    verb,
+		filter:  *p,
+		expires: ss.now().Add(SubscriptionLease),
+	}
+	s.filter.SubscriptionId = ""
+	ss.byId[id] = s
+	return &SubscribeResult{SubscriptionId: id, Lease: SubscriptionLease}, nil
+}
+
+func (ss *subscriptions) unsubscribe(src string, id string) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	s, exists := ss.byId[id]
+	if !exists || s.src != src {
+		return fmt.Errorf("%w: unknown subscription %s", ErrNotFound, id)
+	}
+	delete(ss.byId, id)
+	return nil
+}
+
+// matching returns the live subscriptions of verb accepting params, pruning
+// expired ones on the way.
+func (ss *subscriptions) matching(verb Verb, params any) []subscription {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	now := ss.now()
+	out := make([]subscription, 0)
+	for id, s := range ss.byId {
+		if now.After(s.expires) {
+			delete(ss.byId, id)
+			continue
+		}
+		if s.verb == verb && s.matches(params) {
+			out = append(out, *s)
+		}
+	}
+	return out
+}
+
+// Notify pushes a method notification to every live subscriber whose filter
+// accepts params, and returns the publish failures joined: a subscriber that
+// cannot be reached does not keep the others from being notified. It is safe
+// to call from any goroutine, and is a no-op when no RPC server runs in this
+// process or nobody is subscribed. It blocks while publishing: see Notifier.
+func Notify(ctx context.Context, method NotifyMethod, params any) error {
+	verb, exists := notifyVerbs[method]
+	if !exists {
+		return fmt.Errorf("unknown notification %s", method)
+	}
+	ss := theSubscriptions
+	ss.mu.Lock()
+	publish := ss.publish
+	ss.mu.Unlock()
+	if publish == nil {
+		return nil
+	}
+
+	subs := ss.matching(verb, params)
+	if len(subs) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, s := range subs {
+		err = publish(ctx, Notification{
+			Dst:          s.src,
+			Method:       method,
+			Subscription: s.id,
+			Params:       raw,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.src, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Notifier runs Notify in the background, one notification at a time in the
+// order they were queued, so that a slow or stuck subscriber never holds back
+// the caller (e.g. the dashboard broadcasts). Notifications queued while size
+// others are pending are dropped.
+type Notifier struct {
+	log   logr.Logger
+	queue chan pendingNotification
+}
+
+type pendingNotification struct {
+	method NotifyMethod
+	params any
+}
+
+// NewNotifier starts a Notifier holding up to size pending notifications,
+// until ctx is done.
+func NewNotifier(ctx context.Context, log logr.Logger, size int) *Notifier {
+	n := &Notifier{
+		log:   log,
+		queue: make(chan pendingNotification, size),
+	}
+	go n.run(ctx)
+	return n
+}
+
+func (n *Notifier) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case p := <-n.queue:
+			if err := Notify(ctx, p.method, p.params); err != nil {
+				n.log.Error(err, "Failed to notify subscribers", "method", p.method)
+			}
+		}
+	}
+}
+
+// Notify queues a notification, without waiting for it to be published.
+func (n *Notifier) Notify(method NotifyMethod, params any) {
+	select {
+	case n.queue <- pendingNotification{method: method, params: params}:
+	default:
+		n.log.Info("Dropped notification: too many pending", "method", method, "pending", cap(n.queue))
+	}
+}
+
+// subscribeHandler returns the MethodHandler for a subscribe verb. The
+// subscriber is the caller's dialog source, so subscriptions are only
+// available over the MQTT RPC transport (not over the HTTP /rpc endpoint).
+func (ss *subscriptions) subscribeHandler(verb Verb) MethodHandler {
+	return func(ctx context.Context, in any) (any, error) {
+		params, ok := in.(*SubscribeParams)
+		if !ok {
+			return nil, fmt.Errorf("%w: unexpected type %T", ErrInvalidParams, in)
+		}
+		d, ok := DialogFromContext(ctx)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is only available over the MQTT RPC transport", ErrInvalidRequest, verb)
+		}
+		return ss.subscribe(verb, d.Src, params)
+	}
+}
+
+func (ss *subscriptions) unsubscribeHandler(ctx context.Context, in any) (any, error) {
+	params, ok := in.(*UnsubscribeParams)
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected type %T", ErrInvalidParams, in)
+	}
+	d, ok := DialogFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is only available over the MQTT RPC transport", ErrInvalidRequest, Unsubscribe)
+	}
+	return nil, ss.unsubscribe(d.Src, params.SubscriptionId)
+}
@@ -0,0 +1,345 @@
+package myhome
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asnowfix/home-automation/myhome/mqtt"
+	"github.com/go-logr/logr"
+)
+
+// registryServer is a Server resolving methods through the package-level
+// registry, like the daemon's DeviceManager does.
+type registryServer struct{}
+
+func (registryServer) MethodE(v Verb) (*Method, error) {
+	return Methods(v)
+}
+
+// resetSubscriptions drops every subscription and unbinds the publisher in
+// t.Cleanup. Tests must NOT call t.Parallel(): the registry is package-level.
+func resetSubscriptions(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		theSubscriptions.mu.Lock()
+		defer theSubscriptions.mu.Unlock()
+		theSubscriptions.byId = make(map[string]*subscription)
+		theSubscriptions.publish = nil
+		theSubscriptions.now = time.Now
+	})
+}
+
+// subscribeVia feeds a subscribe request from src and returns the
+// subscription id found in the server's response.
+func subscribeVia(t *testing.T, mc *mqtt.RecordingMockClient, src string, verb Verb, p SubscribeParams) string {
+	t.Helper()
+	feedRequest(t, mc, request{
+		Dialog: Dialog{Id: "sub-" + src, Src: src, Dst: InstanceName},
+		Method: verb,
+		Params: p,
+	})
+	raw := waitPublished(t, mc, ClientTopic(src))
+	var res struct {
+		Result SubscribeResult `json:"result"`
+		Error  *Error          `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &res); err != nil {
+		t.Fatalf("unmarshal subscribe response: %v", err)
+	}
+	if res.Error != nil {
+		t.Fatalf("subscribe failed: %+v", res.Error)
+	}
+	if res.Result.SubscriptionId == "" {
+		t.Fatal("subscribe returned an empty subscription id")
+	}
+	return res.Result.SubscriptionId
+}
+
+// waitPublishedN polls mc.Published(topic) until at least n messages arrived
+// and returns the n-th one, or fails after 200 ms.
+func waitPublishedN(t *testing.T, mc *mqtt.RecordingMockClient, topic string, n int) []byte {
+	t.Helper()
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if msgs := mc.Published(topic); len(msgs) >= n {
+			return msgs[n-1]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timeout: fewer than %d messages published to %q within 200 ms", n, topic)
+	return nil
+}
+
+// TestSubscribe_NotifyMatchingEvent verifies that after event.subscribe,
+// Notify publishes matching events (and only those) to the subscriber's
+// client topic, tagged with its subscription id.
+func TestSubscribe_NotifyMatchingEvent(t *testing.T) {
+	resetSubscriptions(t)
+	ctx, cancel := context.WithCancel(newServerCtx())
+	defer cancel()
+
+	mc := mqtt.NewRecordingMockClient()
+	if _, err := NewServerE(ctx, mc, registryServer{}); err != nil {
+		t.Fatalf("NewServerE: %v", err)
+	}
+
+	const src = "follower"
+	id := subscribeVia(t, mc, src, EventSubscribe, SubscribeParams{EventType: "switch"})
+
+	if err := Notify(ctx, NotifyEvent, EventView{DeviceID: "d1", Event: "input.toggle"}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if msgs := mc.Published(ClientTopic(src)); len(msgs) != 1 {
+		t.Fatalf("filtered-out event was published: %s", msgs[len(msgs)-1])
+	}
+
+	if err := Notify(ctx, NotifyEvent, EventView{DeviceID: "d1", Event: "switch.on"}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	raw := waitPublishedN(t, mc, ClientTopic(src), 2)
+	var n Notification
+	if err := json.Unmarshal(raw, &n); err != nil {
+		t.Fatalf("unmarshal notification: %v", err)
+	}
+	if n.Method != NotifyEvent || n.Subscription != id || n.Dst != src {
+		t.Errorf("notification: got method=%q subscription=%q dst=%q, want %q %q %q", n.Method, n.Subscription, n.Dst, NotifyEvent, id, src)
+	}
+	var ev EventView
+	if err := n.DecodeParams(&ev); err != nil {
+		t.Fatalf("DecodeParams: %v", err)
+	}
+	if ev.Event != "switch.on" {
+		t.Errorf("event: got %q, want %q", ev.Event, "switch.on")
+	}
+}
+
+// TestSubscribe_Unsubscribe verifies that rpc.unsubscribe stops notifications.
+func TestSubscribe_Unsubscribe(t *testing.T) {
+	resetSubscriptions(t)
+	ctx, cancel := context.WithCancel(newServerCtx())
+	defer cancel()
+
+	mc := mqtt.NewRecordingMockClient()
+	if _, err := NewServerE(ctx, mc, registryServer{}); err != nil {
+		t.Fatalf("NewServerE: %v", err)
+	}
+
+	const src = "watcher"
+	id := subscribeVia(t, mc, src, DeviceWatch, SubscribeParams{})
+
+	feedRequest(t, mc, request{
+		Dialog: Dialog{Id: "unsub-1", Src: src, Dst: InstanceName},
+		Method: Unsubscribe,
+		Params: UnsubscribeParams{SubscriptionId: id},
+	})
+	waitPublishedN(t, mc, ClientTopic(src), 2)
+
+	if err := Notify(ctx, NotifyDevice, DeviceNotification{DeviceID: "d1"}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if msgs := mc.Published(ClientTopic(src)); len(msgs) != 2 {
+		t.Fatalf("notification published after unsubscribe: %s", msgs[len(msgs)-1])
+	}
+}
+
+// TestSubscribe_LeaseExpiry verifies that a subscription that is not renewed
+// is dropped once its lease runs out, while a renewal keeps the same id.
+func TestSubscribe_LeaseExpiry(t *testing.T) {
+	resetSubscriptions(t)
+	now := time.Now()
+	theSubscriptions.now = func() time.Time { return now }
+
+	res, err := theSubscriptions.subscribe(DeviceWatch, "c", &SubscribeParams{})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	now = now.Add(SubscriptionLease / 2)
+	renewed, err := theSubscriptions.subscribe(DeviceWatch, "c", &SubscribeParams{SubscriptionId: res.SubscriptionId})
+	if err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	if renewed.SubscriptionId != res.SubscriptionId {
+		t.Errorf("renewal changed the id: got %q, want %q", renewed.SubscriptionId, res.SubscriptionId)
+	}
+
+	now = now.Add(SubscriptionLease - time.Second)
+	if subs := theSubscriptions.matching(DeviceWatch, DeviceNotification{DeviceID: "d1"}); len(subs) != 1 {
+		t.Fatalf("renewed subscription: got %d matches, want 1", len(subs))
+	}
+
+	now = now.Add(2 * time.Second)
+	if subs := theSubscriptions.matching(DeviceWatch, DeviceNotification{DeviceID: "d1"}); len(subs) != 0 {
+		t.Fatalf("expired subscription: got %d matches, want 0", len(subs))
+	}
+}
+
+// TestSubscribe_RequiresDialog verifies that subscribing outside the MQTT RPC
+// transport (no dialog in the context) is rejected.
+func TestSubscribe_RequiresDialog(t *testing.T) {
+	resetSubscriptions(t)
+	h := theSubscriptions.subscribeHandler(EventSubscribe)
+	if _, err := h(context.Background(), &SubscribeParams{}); err == nil {
+		t.Error("expected an error when subscribing without a dialog")
+	}
+}
+
+// TestClient_DispatchesNotificationsAndResponses verifies that the client
+// routes a notification interleaved before a response to the subscriber, and
+// still hands the response to the waiting CallE.
+func TestClient_DispatchesNotificationsAndResponses(t *testing.T) {
+	ctx, cancel := context.WithCancel(newServerCtx())
+	defer cancel()
+
+	mc := mqtt.NewRecordingMockClient()
+	c, err := NewClientE(ctx, logr.Discard(), mc, time.Second)
+	if err != nil {
+		t.Fatalf("NewClientE: %v", err)
+	}
+	hc := c.(*client)
+	hc.start(ctx)
+
+	sub := make(chan Notification, 1)
+	hc.routes.Lock()
+	hc.subs["s1"] = sub
+	hc.routes.Unlock()
+
+	type result struct {
+		out any
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := c.CallE(ctx, PoolGetStatus, nil)
+		done <- result{out, err}
+	}()
+
+	raw := waitPublished(t, mc, ServerTopic())
+	var req request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		t.Fatalf("unmarshal request: %v", err)
+	}
+
+	mc.Feed(ClientTopic(mc.Id()), []byte(`{"src":"myhome","dst":"recording-mock","method":"NotifyEvent","subscription":"s1","params":{"event":"switch.on"}}`))
+	res, _ := json.Marshal(map[string]any{
+		"id": req.Id, "src": InstanceName, "dst": mc.Id(),
+		"result": PoolGetStatusResult{DeviceID: "pool"},
+	})
+	mc.Feed(ClientTopic(mc.Id()), res)
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatalf("CallE: %v", r.err)
+		}
+		if got, ok := r.out.(*PoolGetStatusResult); !ok || got.DeviceID != "pool" {
+			t.Errorf("CallE result: got %#v", r.out)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("CallE did not return")
+	}
+
+	select {
+	case n := <-sub:
+		if n.Method != NotifyEvent {
+			t.Errorf("notification method: got %q, want %q", n.Method, NotifyEvent)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("notification was not routed to its subscriber")
+	}
+}
+
+// TestNotify_ReachesEverySubscriber verifies that a subscriber that cannot be
+// reached does not keep the others from being notified, and is reported.
+func TestNotify_ReachesEverySubscriber(t *testing.T) {
+	resetSubscriptions(t)
+	var reached []string
+	theSubscriptions.mu.Lock()
+	theSubscriptions.publish = func(ctx context.Context, n Notification) error {
+		if n.Dst == "broken" {
+			return errors.New("unreachable")
+		}
+		reached = append(reached, n.Dst)
+		return nil
+	}
+	theSubscriptions.mu.Unlock()
+	for _, src := range []string{"broken", "healthy", "other"} {
+		if _, err := theSubscriptions.subscribe(DeviceWatch, src, &SubscribeParams{}); err != nil {
+			t.Fatalf("subscribe: %v", err)
+		}
+	}
+
+	err := Notify(context.Background(), NotifyDevice, DeviceNotification{DeviceID: "d1"})
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Notify: got %v, want the failure of the broken subscriber", err)
+	}
+	sort.Strings(reached)
+	if len(reached) != 2 || reached[0] != "healthy" || reached[1] != "other" {
+		t.Errorf("reached: got %v, want [healthy other]", reached)
+	}
+}
+
+// TestNotifier_DoesNotBlock verifies that a stuck publish neither blocks the
+// caller nor grows the queue past its size, and that queued notifications
+// are then published in order.
+func TestNotifier_DoesNotBlock(t *testing.T) {
+	resetSubscriptions(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+	published := make(chan string, 10)
+	theSubscriptions.mu.Lock()
+	theSubscriptions.publish = func(ctx context.Context, n Notification) error {
+		<-release
+		var dn DeviceNotification
+		if err := n.DecodeParams(&dn); err != nil {
+			return err
+		}
+		published <- dn.DeviceID
+		return nil
+	}
+	theSubscriptions.mu.Unlock()
+	if _, err := theSubscriptions.subscribe(DeviceWatch, "slow", &SubscribeParams{}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	n := NewNotifier(ctx, logr.Discard(), 2)
+	n.Notify(NotifyDevice, DeviceNotification{DeviceID: "d1"})
+	// Wait for d1 to be taken off the queue, stuck in publish
+	deadline := time.Now().Add(time.Second)
+	for len(n.queue) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan struct{})
+	go func() {
+		for _, id := range []string{"d2", "d3", "d4"} {
+			n.Notify(NotifyDevice, DeviceNotification{DeviceID: id})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Notify blocked on a stuck publish")
+	}
+
+	close(release)
+	var got []string
+	for range 3 {
+		select {
+		case id := <-published:
+			got = append(got, id)
+		case <-time.After(time.Second):
+			t.Fatalf("published: got %v, want [d1 d2 d3]", got)
+		}
+	}
+	if strings.Join(got, " ") != "d1 d2 d3" {
+		t.Errorf("published: got %v, want [d1 d2 d3] (d4 dropped)", got)
+	}
+}
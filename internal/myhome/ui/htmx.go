@@ -453,8 +453,8 @@ func (h *HTMXHandler) renderEventsRows(w http.ResponseWriter, r *http.Request, o
 }
 
 // cardTemplateFuncs returns the template.FuncMap shared by deviceCardsTemplate
-// and deviceCardTemplate. isActive/turnoverText exist because html/template
-// does not auto-dereference *bool/*float64 fields for {{if}} or {{printf}} —
+// and deviceCardTemplate. isActive/turnoverText/f1/pos/kwh exist because
+// html/template does not auto-dereference *bool/*float64 fields for {{if}} or {{printf}} —
 // a non-nil pointer is always "truthy" regardless of the value it points to,
 // and printf on a pointer prints its address, not the pointed-to value.
 func cardTemplateFuncs() template.FuncMap {
@@ -475,6 +475,18 @@ func cardTemplateFuncs() template.FuncMap {
 			}
 			return fmt.Sprintf("%.1f", *f)
 		},
+		"pos": func(p *int) string {
+			if p == nil {
+				return ""
+			}
+			return fmt.Sprintf("%d", *p)
+		},
+		"kwh": func(wh *float32) string {
+			if wh == nil {
+				return ""
+			}
+			return fmt.Sprintf("%.1f", *wh/1000)
+		},
 	}
 }
 
@@ -514,6 +526,25 @@ const deviceCardsTemplate = `
             <span class="level-item">{{$switch.Name}}</span>
           </div>
         {{end}}
+        {{range $coverId, $cover := .Covers}}
+          <div class="level" id="cover-{{$deviceId}}-{{$coverId}}">
+            <span class="tag {{if eq $cover.State "opening" "closing"}}is-warning{{else}}is-light{{end}}" id="cover-{{$deviceId}}-{{$coverId}}-state">{{$cover.State}}{{if $cover.Position}} {{pos $cover.Position}}%{{end}}</span>
+            <span class="level-item">{{$cover.Name}}</span>
+          </div>
+        {{end}}
+        {{range $lightId, $light := .Lights}}
+          <div class="level" id="light-{{$deviceId}}-{{$lightId}}">
+            <span class="tag {{if $light.On}}is-info{{else}}is-light{{end}}" id="light-{{$deviceId}}-{{$lightId}}-state">{{if $light.On}}{{printf "%.0f" $light.Brightness}}%{{else}}off{{end}}</span>
+            <span class="level-item">{{$light.Name}}</span>
+          </div>
+        {{end}}
+        {{range .Meters}}
+          <div class="level" id="meter-{{$deviceId}}-{{.Key}}">
+            <span class="tag is-info is-light">{{printf "%.0f" .Power}} W</span>
+            {{if .Energy}}<span class="tag is-light ml-1">{{kwh .Energy}} kWh</span>{{end}}
+            <span class="level-item">{{.Name}}</span>
+          </div>
+        {{end}}
         
         {{if .HasHumiditySensor}}
           {{if .Humidity}}
@@ -633,6 +664,25 @@ const deviceCardTemplate = `
             <span class="level-item">{{$switch.Name}}</span>
           </div>
         {{end}}
+        {{range $coverId, $cover := .Covers}}
+          <div class="level" id="cover-{{$.Id}}-{{$coverId}}">
+            <span class="tag {{if eq $cover.State "opening" "closing"}}is-warning{{else}}is-light{{end}}" id="cover-{{$.Id}}-{{$coverId}}-state">{{$cover.State}}{{if $cover.Position}} {{pos $cover.Position}}%{{end}}</span>
+            <span class="level-item">{{$cover.Name}}</span>
+          </div>
+        {{end}}
+        {{range $lightId, $light := .Lights}}
+          <div class="level" id="light-{{$.Id}}-{{$lightId}}">
+            <span class="tag {{if $light.On}}is-info{{else}}is-light{{end}}" id="light-{{$.Id}}-{{$lightId}}-state">{{if $light.On}}{{printf "%.0f" $light.Brightness}}%{{else}}off{{end}}</span>
+            <span class="level-item">{{$light.Name}}</span>
+          </div>
+        {{end}}
+        {{range .Meters}}
+          <div class="level" id="meter-{{$.Id}}-{{.Key}}">
+            <span class="tag is-info is-light">{{printf "%.0f" .Power}} W</span>
+            {{if .Energy}}<span class="tag is-light ml-1">{{kwh .Energy}} kWh</span>{{end}}
+            <span class="level-item">{{.Name}}</span>
+          </div>
+        {{end}}
         
         {{if .HasHumiditySensor}}
           {{if .Humidity}}
@@ -0,0 +1,49 @@
+package ui
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"testing"
+
+	pkgshelly "github.com/asnowfix/home-automation/pkg/shelly/shelly"
+)
+
+// TestDeviceCardTemplates_CoversLightsMeters verifies that both card
+// templates render the cover position, light brightness and meter readings
+// of a device, dereferencing their pointer fields.
+func TestDeviceCardTemplates_CoversLightsMeters(t *testing.T) {
+	pos := 40
+	energy := float32(4200)
+	view := DeviceView{
+		Id:     "shellyproem50-abc",
+		Name:   "Pro EM",
+		Covers: map[int]pkgshelly.CoverSummary{0: {Id: 0, Name: "Kitchen", State: "stopped", Position: &pos}},
+		Lights: map[int]pkgshelly.LightSummary{0: {Id: 0, Name: "Porch", On: true, Brightness: 60}},
+		Meters: []pkgshelly.MeterSummary{
+			{Key: "em1:0", Name: "Heat pump", Power: 1200.4, Energy: &energy},
+			{Key: "em1:1", Name: "em1:1", Power: -300},
+		},
+	}
+
+	card := template.Must(template.New("device-card").Funcs(cardTemplateFuncs()).Parse(deviceCardTemplate))
+	cards := template.Must(template.New("device-cards").Funcs(cardTemplateFuncs()).Parse(deviceCardsTemplate))
+	for name, render := range map[string]func(*bytes.Buffer) error{
+		"deviceCardTemplate":  func(buf *bytes.Buffer) error { return card.Execute(buf, view) },
+		"deviceCardsTemplate": func(buf *bytes.Buffer) error { return cards.Execute(buf, []DeviceView{view}) },
+	} {
+		var buf bytes.Buffer
+		if err := render(&buf); err != nil {
+			t.Fatalf("%s: execute: %v", name, err)
+		}
+		out := buf.String()
+		for _, want := range []string{"stopped 40%", "Kitchen", "60%", "Porch", "1200 W", "4.2 kWh", "Heat pump", "-300 W", `id="meter-shellyproem50-abc-em1:1"`} {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s: missing %q:\n%s", name, want, out)
+			}
+		}
+		if strings.Contains(out, "0x") {
+			t.Errorf("%s: leaked a pointer address (dereference bug):\n%s", name, out)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package ui
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/asnowfix/home-automation/internal/myhome"
 	"net/http"
 
@@ -19,7 +20,15 @@ func RpcHandler(ctx context.Context, log logr.Logger) func(w http.ResponseWriter
 		log.Info("RPC request received", "remote", r.RemoteAddr, "content-length", r.ContentLength)
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			rpcError(w, fmt.Errorf("%w: %w", myhome.ErrParse, err))
+			return
+		}
+
+		// Authenticate the caller from its bearer token, if any
+		ctx, err := myhome.AuthenticateBearer(ctx, r.Header.Get("Authorization"), r.RemoteAddr, req.Method)
+		if err != nil {
+			log.Info("unauthenticated request", "remote", r.RemoteAddr, "method", req.Method, "reason", err)
+			rpcError(w, err)
 			return
 		}
 
@@ -27,7 +36,7 @@ func RpcHandler(ctx context.Context, log logr.Logger) func(w http.ResponseWriter
 		mh, err := myhome.Methods(req.Method)
 		if err != nil {
 			log.Error(err, "method not found", "method", req.Method)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			rpcError(w, err)
 			return
 		}
 
@@ -36,18 +45,24 @@ func RpcHandler(ctx context.Context, log logr.Logger) func(w http.ResponseWriter
 		if len(req.Params) > 0 {
 			if err := json.Unmarshal(req.Params, &params); err != nil {
 				log.Error(err, "invalid params", "method", req.Method)
-				http.Error(w, "invalid params: "+err.Error(), http.StatusBadRequest)
+				rpcError(w, fmt.Errorf("%w: %w", myhome.ErrInvalidParams, err))
 				return
 			}
 		}
 
+		if err := myhome.Authorize(ctx, req.Method); err != nil {
+			log.Info("unauthorized request", "remote", r.RemoteAddr, "method", req.Method, "reason", err)
+			rpcError(w, err)
+			return
+		}
+
 		var res any
 
 		// Call method
 		res, err = mh.ActionE(ctx, params)
 		if err != nil {
 			log.Error(err, "method failed", "method", req.Method)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			rpcError(w, err)
 			return
 		}
 
@@ -73,3 +88,45 @@ func RpcHandler(ctx context.Context, log logr.Logger) func(w http.ResponseWriter
 		_ = json.NewEncoder(w).Encode(map[string]any{"result": res})
 	}
 }
+
+// statusClientClosedRequest is the de-facto status (from nginx) for requests
+// the client gave up on; net/http has no constant for it.
+const statusClientClosedRequest = 499
+
+// httpStatus maps an RPC error code to the HTTP status of the /rpc response.
+func httpStatus(code myhome.ErrorCode) int {
+	switch code {
+	case myhome.ErrCodeParse, myhome.ErrCodeInvalidRequest, myhome.ErrCodeInvalidParams:
+		return http.StatusBadRequest
+	case myhome.ErrCodeMethodNotFound, myhome.ErrCodeNotFound:
+		return http.StatusNotFound
+	case myhome.ErrCodeTimeout:
+		return http.StatusGatewayTimeout
+	case myhome.ErrCodeUnreachable:
+		return http.StatusBadGateway
+	case myhome.ErrCodeConflict:
+		return http.StatusConflict
+	case myhome.ErrCodeUnauthorized:
+		return http.StatusUnauthorized
+	case myhome.ErrCodeForbidden:
+		return http.StatusForbidden
+	case myhome.ErrCodeCancelled:
+		return statusClientClosedRequest
+	case myhome.ErrCodeBusy:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// rpcError writes err as a {"error":{"code":...,"message":...}} body, with
+// the HTTP status matching its code.
+func rpcError(w http.ResponseWriter, err error) {
+	e := myhome.ErrorOf(err)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if e.Code == myhome.ErrCodeUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="myhome"`)
+	}
+	w.WriteHeader(httpStatus(e.Code))
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": e})
+}
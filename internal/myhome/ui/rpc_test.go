@@ -0,0 +1,151 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/go-logr/logr"
+)
+
+func TestHttpStatus(t *testing.T) {
+	tests := []struct {
+		code myhome.ErrorCode
+		want int
+	}{
+		{myhome.ErrCodeParse, http.StatusBadRequest},
+		{myhome.ErrCodeInvalidParams, http.StatusBadRequest},
+		{myhome.ErrCodeMethodNotFound, http.StatusNotFound},
+		{myhome.ErrCodeNotFound, http.StatusNotFound},
+		{myhome.ErrCodeTimeout, http.StatusGatewayTimeout},
+		{myhome.ErrCodeUnreachable, http.StatusBadGateway},
+		{myhome.ErrCodeConflict, http.StatusConflict},
+		{myhome.ErrCodeUnauthorized, http.StatusUnauthorized},
+		{myhome.ErrCodeForbidden, http.StatusForbidden},
+		{myhome.ErrCodeCancelled, statusClientClosedRequest},
+		{myhome.ErrCodeBusy, http.StatusServiceUnavailable},
+		{myhome.ErrCodeInternal, http.StatusInternalServerError},
+		{1, http.StatusInternalServerError}, // legacy untyped code
+	}
+	for _, tt := range tests {
+		if got := httpStatus(tt.code); got != tt.want {
+			t.Errorf("httpStatus(%d) = %d, want %d", tt.code, got, tt.want)
+		}
+	}
+}
+
+// TestRpcHandler_TypedErrors verifies that handler errors are returned with
+// the HTTP status and JSON error body matching their code.
+func TestRpcHandler_TypedErrors(t *testing.T) {
+	t.Cleanup(myhome.RegisterMethodHandler(myhome.DeviceRefresh, func(_ context.Context, in any) (any, error) {
+		return nil, fmt.Errorf("%w: %s did not answer", myhome.ErrUnreachable, in)
+	}))
+	h := RpcHandler(context.Background(), logr.Discard())
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   myhome.ErrorCode
+	}{
+		{"invalid JSON", `{`, http.StatusBadRequest, myhome.ErrCodeParse},
+		{"unknown method", `{"method":"no.such.verb"}`, http.StatusNotFound, myhome.ErrCodeMethodNotFound},
+		{"handler error", `{"method":"device.refresh","params":"d1"}`, http.StatusBadGateway, myhome.ErrCodeUnreachable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status: got %d, want %d", w.Code, tt.wantStatus)
+			}
+			var out struct {
+				Error myhome.Error `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+				t.Fatalf("unmarshal body %q: %v", w.Body.String(), err)
+			}
+			if out.Error.Code != tt.wantCode {
+				t.Errorf("code: got %d, want %d", out.Error.Code, tt.wantCode)
+			}
+			if tt.wantCode == myhome.ErrCodeUnreachable && !errors.Is(&out.Error, myhome.ErrUnreachable) {
+				t.Error("decoded error does not match ErrUnreachable")
+			}
+		})
+	}
+}
+
+// TestRpcHandler_BearerAuth verifies that /rpc authenticates bearer tokens
+// and applies the per-verb policy.
+func TestRpcHandler_BearerAuth(t *testing.T) {
+	if err := myhome.ConfigureAuth([]myhome.Token{{Name: "ops", Secret: "ops-secret", Role: myhome.RoleOperator}}, myhome.RoleReadOnly); err != nil {
+		t.Fatalf("ConfigureAuth: %v", err)
+	}
+	var denials []myhome.Denial
+	myhome.OnAuthDenied(func(_ context.Context, d myhome.Denial) { denials = append(denials, d) })
+	t.Cleanup(func() {
+		_ = myhome.ConfigureAuth(nil, myhome.RoleNone)
+		myhome.OnAuthDenied(nil)
+	})
+	t.Cleanup(myhome.RegisterMethodHandler(myhome.SwitchOn, func(_ context.Context, in any) (any, error) {
+		return "on", nil
+	}))
+	h := RpcHandler(context.Background(), logr.Discard())
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{"anonymous", "", http.StatusForbidden},
+		{"unknown token", "Bearer nope", http.StatusUnauthorized},
+		{"wrong scheme", "Basic b3BzOm9wcy1zZWNyZXQ=", http.StatusUnauthorized},
+		{"operator", "Bearer ops-secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(`{"method":"switch.on","params":{"identifier":"d1"}}`))
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status: got %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate header")
+			}
+		})
+	}
+	if len(denials) != 3 {
+		t.Errorf("denials: got %d, want 3", len(denials))
+	}
+}
+
+// TestDashboard_RpcCallsForwardToken verifies that every /rpc call of the
+// dashboard goes through rpcFetch, which sends the saved API token, so that
+// it keeps working once RPC authentication is enabled.
+func TestDashboard_RpcCallsForwardToken(t *testing.T) {
+	index, err := staticFS.ReadFile("static/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(index)
+	if n := strings.Count(page, "fetch('/rpc'"); n != 1 {
+		t.Errorf("found %d direct fetch('/rpc') calls, want only the one in rpcFetch", n)
+	}
+	if !strings.Contains(page, "headers['Authorization'] = 'Bearer ' + token") {
+		t.Error("rpcFetch does not send the API token")
+	}
+	if !strings.Contains(page, "rpcFetch({") {
+		t.Error("dashboard makes no RPC call through rpcFetch")
+	}
+}
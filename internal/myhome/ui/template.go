@@ -69,6 +69,9 @@ type DeviceView struct {
 	Humidity             *float64                        `json:"humidity,omitempty"`     // Current humidity in percentage (nil if not a humidity sensor)
 	DoorOpened           *bool                           `json:"door_opened,omitempty"`  // true if door/window is open, false if closed (nil if not a door/window sensor)
 	Switches             map[int]pkgshelly.SwitchSummary `json:"switches,omitempty"`     // Switches on the device (nil if not a switch)
+	Covers               map[int]pkgshelly.CoverSummary  `json:"covers,omitempty"`       // Covers on the device, from its last known status
+	Lights               map[int]pkgshelly.LightSummary  `json:"lights,omitempty"`       // Lights on the device, from its last known status
+	Meters               []pkgshelly.MeterSummary        `json:"meters,omitempty"`       // Energy meters (em, em1, pm1) on the device, from its last known status
 	IsPoolPump           bool                            `json:"is_pool_pump,omitempty"`           // true if this is the configured pool pump device
 	TurnoverAchieved     *float64                        `json:"turnover_achieved,omitempty"`      // pool volumes filtered today so far (nil unless IsPoolPump)
 	TurnoverTarget       *float64                        `json:"turnover_target,omitempty"`        // configured daily turnover target, times/day (nil unless IsPoolPump)
@@ -308,6 +311,17 @@ func DeviceToView(ctx context.Context, d *myhome.Device) DeviceView {
 		}
 	}
 
+	// Covers, lights and energy meters, from the cached device status
+	var covers map[int]pkgshelly.CoverSummary
+	var lights map[int]pkgshelly.LightSummary
+	var meters []pkgshelly.MeterSummary
+	if sd, ok := d.Impl().(*shelly.Device); ok && sd != nil {
+		status := sd.Status()
+		covers = pkgshelly.CoverSummaries(d.Config, status)
+		lights = pkgshelly.LightSummaries(d.Config, status)
+		meters = pkgshelly.MeterSummaries(d.Config, status)
+	}
+
 	// Extract sensor values from cached device status
 	var temperature *float64
 	var humidity *float64
@@ -354,6 +368,9 @@ func DeviceToView(ctx context.Context, d *myhome.Device) DeviceView {
 		Humidity:             humidity,
 		DoorOpened:           doorOpened,
 		Switches:             switches,
+		Covers:               covers,
+		Lights:               lights,
+		Meters:               meters,
 	}
 }
 
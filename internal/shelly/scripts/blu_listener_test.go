@@ -104,7 +104,7 @@ func runBluListener(ctx context.Context, t *testing.T, buf []byte, state *script
 	t.Helper()
 	done := make(chan error, 1)
 	go func() {
-		done <- script.RunWithDeviceState(ctx, bluListenerScriptPath, buf, false, state)
+		done <- script.RunWithDeviceState(mqtt.NewContext(ctx, mqtt.NewMockClient()), bluListenerScriptPath, buf, false, state)
 	}()
 	// Allow script to initialize: KVS.List + KVS.Get chain + onLoadFollowsComplete
 	time.Sleep(300 * time.Millisecond)
@@ -115,10 +115,6 @@ func runBluListener(ctx context.Context, t *testing.T, buf []byte, state *script
 // followed MAC turns on the configured switch.
 func TestBluListener_MotionTurnsOnSwitch(t *testing.T) {
 	buf := readBluListenerScript(t)
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	mac := "aa:bb:cc:dd:ee:ff"
 	state := newBluListenerState(bluFollowKVS(mac, "switch:0", 0))
 
@@ -147,10 +143,6 @@ func TestBluListener_MotionTurnsOnSwitch(t *testing.T) {
 // does not turn on the switch.
 func TestBluListener_NoMotionNoAction(t *testing.T) {
 	buf := readBluListenerScript(t)
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	mac := "aa:bb:cc:dd:ee:01"
 	state := newBluListenerState(bluFollowKVS(mac, "switch:0", 0))
 
@@ -177,10 +169,6 @@ func TestBluListener_NoMotionNoAction(t *testing.T) {
 // and turns the switch off after the configured duration.
 func TestBluListener_AutoOffTurnsOffSwitch(t *testing.T) {
 	buf := readBluListenerScript(t)
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	mac := "11:22:33:44:55:66"
 	// 0.3 s auto-off to keep the test fast
 	state := newBluListenerState(bluFollowKVS(mac, "switch:0", 0.3))
@@ -219,10 +207,6 @@ func TestBluListener_AutoOffTurnsOffSwitch(t *testing.T) {
 // the switch is NOT turned on.
 func TestBluListener_IlluminanceTooHigh(t *testing.T) {
 	buf := readBluListenerScript(t)
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	mac := "aa:11:bb:22:cc:33"
 	state := newBluListenerState(bluFollowKVSWithBounds(mac, "switch:0", 0, nil, 100))
 
@@ -250,10 +234,6 @@ func TestBluListener_IlluminanceTooHigh(t *testing.T) {
 // the switch is NOT turned on.
 func TestBluListener_IlluminanceTooLow(t *testing.T) {
 	buf := readBluListenerScript(t)
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	mac := "aa:11:bb:22:cc:44"
 	state := newBluListenerState(bluFollowKVSWithBounds(mac, "switch:0", 0, 50, nil))
 
@@ -281,10 +261,6 @@ func TestBluListener_IlluminanceTooLow(t *testing.T) {
 // configured lux bounds does trigger the switch.
 func TestBluListener_IlluminanceWithinBoundsTurnsOn(t *testing.T) {
 	buf := readBluListenerScript(t)
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	mac := "aa:11:bb:22:cc:55"
 	// min=20, max=100 → illuminance=60 should pass
 	state := newBluListenerState(bluFollowKVSWithBounds(mac, "switch:0", 0, 20, 100))
@@ -314,10 +290,6 @@ func TestBluListener_IlluminanceWithinBoundsTurnsOn(t *testing.T) {
 // event, a newly configured follow MAC becomes active.
 func TestBluListener_KVSReloadPicksUpNewFollow(t *testing.T) {
 	buf := readBluListenerScript(t)
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	// Start with no follows
 	state := newBluListenerState(map[string]interface{}{})
 
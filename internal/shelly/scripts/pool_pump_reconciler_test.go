@@ -9,7 +9,6 @@ import (
 	"testing"
 	"time"
 
-	"github.com/asnowfix/home-automation/pkg/shelly/mqtt"
 	"github.com/asnowfix/home-automation/pkg/shelly/script"
 )
 
@@ -115,10 +114,6 @@ func poolPumpWindowNow(t *testing.T, offsetStart, offsetStop time.Duration, swit
 // returned stop().
 func runPoolPump(t *testing.T, d *script.DeviceState) (stop func()) {
 	t.Helper()
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	buf := readPoolPumpScript(t)
 	ctx, cancel := poolPumpRunContext(t)
 	done := make(chan error, 1)
@@ -135,10 +135,8 @@ const (
 // assertion runs next reports a behavioural fault that never happened.
 func poolPumpRunContext(t *testing.T) (context.Context, context.CancelFunc) {
 	t.Helper()
-	return context.WithTimeout(
-		logr.NewContext(context.Background(), testr.New(t)),
-		2*time.Minute,
-	)
+	ctx := logr.NewContext(context.Background(), testr.New(t))
+	return context.WithTimeout(mqtt.NewContext(ctx, mqtt.NewMockClient()), 2*time.Minute)
 }
 
 func waitFor(deadline time.Duration, pollInterval time.Duration, pred func() bool) bool {
@@ -220,10 +218,6 @@ func pro1Schedules() []map[string]interface{} {
 func TestPoolPump_InitVerifiesSchedules(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	ctx, cancel := poolPumpRunContext(t)
 	defer cancel()
 
@@ -309,10 +303,6 @@ func poolPumpSchedulesWrapped() []map[string]interface{} {
 func TestPoolPump_InitVerifiesWrappedSchedules(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	ctx, cancel := poolPumpRunContext(t)
 	defer cancel()
 
@@ -358,10 +348,6 @@ func TestPoolPump_InitVerifiesWrappedSchedules(t *testing.T) {
 func TestPoolPump_WaterSupplyRestoresSpeed(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	injector := make(chan []byte, 4)
 
 	// "max" speed must map to switch 2 unambiguously. controllerKVS() only
@@ -487,10 +473,6 @@ func TestPoolPump_WaterSupplyRestoresSpeed(t *testing.T) {
 func TestPoolPump_ButtonCyclesPro3(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	injector := make(chan []byte, 8)
 
 	deviceState := &script.DeviceState{
@@ -582,10 +564,6 @@ func TestPoolPump_ButtonCyclesPro3(t *testing.T) {
 func TestPoolPump_Pro1ToggleAndWaterSupply(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	injector := make(chan []byte, 8)
 
 	deviceState := &script.DeviceState{
@@ -754,10 +732,6 @@ func assertSwitchOutput(t *testing.T, deviceState *script.DeviceState, want bool
 func TestPoolPump_WaterSupplyFlapFalseThenTrue(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	injector := make(chan []byte, 8)
 	deviceState := poolPumpWaterSupplyFlapDeviceState(injector)
 
@@ -845,10 +819,6 @@ func TestPoolPump_WaterSupplyFlapFalseThenTrue(t *testing.T) {
 func TestPoolPump_WaterSupplyFlapTrueThenFalse(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	injector := make(chan []byte, 8)
 	deviceState := poolPumpWaterSupplyFlapDeviceState(injector)
 
@@ -998,10 +968,6 @@ func parseKVSFloat(t *testing.T, deviceState *script.DeviceState, key string) fl
 func TestPoolPump_RuntimeAccounting_TracksElapsedRunAndTurnover(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	injector := make(chan []byte, 4)
 
 	cs := pro3ComponentStatus()
@@ -1182,10 +1148,6 @@ func localDayNumber(epochSec int64) int64 {
 func TestPoolPump_RuntimeAccounting_ContinuesAfterReboot(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	injector := make(chan []byte, 4)
 	cs := pro3ComponentStatus()
 	cs["switch:2"] = map[string]interface{}{"id": 2, "output": true} // pump on at boot
@@ -1258,10 +1220,6 @@ func TestPoolPump_RuntimeAccounting_ContinuesAfterReboot(t *testing.T) {
 func TestPoolPump_RuntimeAccounting_PreviousDayRestartResets(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	deviceState := &script.DeviceState{
 		KVS:             controllerKVS(),
 		Storage:         make(map[string]interface{}),
@@ -1298,10 +1256,6 @@ func TestPoolPump_RuntimeAccounting_PreviousDayRestartResets(t *testing.T) {
 func TestPoolPump_RuntimeAccounting_CorruptStorageFallsBackToKVS(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	injector := make(chan []byte, 4)
 	cs := pro3ComponentStatus()
 	cs["switch:2"] = map[string]interface{}{"id": 2, "output": true}
@@ -1378,10 +1332,6 @@ func TestPoolPump_RuntimeAccounting_CorruptStorageFallsBackToKVS(t *testing.T) {
 func TestPoolPump_RuntimeAccounting_LegacyMigrationDiscardsStaleDate(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	deviceState := &script.DeviceState{
 		KVS: controllerKVS(),
 		Storage: map[string]interface{}{
@@ -1424,10 +1374,6 @@ func TestPoolPump_RuntimeAccounting_LegacyMigrationDiscardsStaleDate(t *testing.
 func TestPoolPump_RuntimeAccounting_AnchorDoesNotDriftAcrossCheckpoints(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	evalCh := make(chan []byte, 4)
 	cs := pro3ComponentStatus()
 	cs["switch:2"] = map[string]interface{}{"id": 2, "output": true} // pump on at boot -> real startRuntimeAccounting()
@@ -1491,10 +1437,6 @@ func TestPoolPump_RuntimeAccounting_AnchorDoesNotDriftAcrossCheckpoints(t *testi
 func TestPoolPump_RuntimeAccounting_StopRightAfterMidnightDoesNotCreditWholeRun(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	evalCh := make(chan []byte, 4)
 	injector := make(chan []byte, 4)
 	cs := pro3ComponentStatus()
@@ -1590,10 +1532,7 @@ func solarPayload(availableW float64, tsUnixSec int64) []byte {
 func TestPoolPump_SolarStartsAndStopsPump(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
 	mc := mqtt.NewMockClient()
-	mqtt.SetClient(mc)
-	t.Cleanup(mqtt.ResetClient)
 
 	deviceState := &script.DeviceState{
 		KVS:             solarKVS(nil),
@@ -1603,6 +1542,7 @@ func TestPoolPump_SolarStartsAndStopsPump(t *testing.T) {
 	}
 
 	ctx, cancel := poolPumpRunContext(t)
+	ctx = mqtt.NewContext(ctx, mc)
 	defer cancel()
 
 	done := make(chan error, 1)
@@ -1661,10 +1601,7 @@ func TestPoolPump_SolarStartsAndStopsPump(t *testing.T) {
 func TestPoolPump_SolarRespectsHardCeiling(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
 	mc := mqtt.NewMockClient()
-	mqtt.SetClient(mc)
-	t.Cleanup(mqtt.ResetClient)
 
 	// Ceiling target = poolVolume(46) * solarMaxTurnover(0.001) / flowRate(≈21.38 m3/h) * 3600s ≈ 7.7s.
 	kvs := solarKVS(map[string]string{"solar-max-turnover": "0.001"})
@@ -1680,6 +1617,7 @@ func TestPoolPump_SolarRespectsHardCeiling(t *testing.T) {
 	}
 
 	ctx, cancel := poolPumpRunContext(t)
+	ctx = mqtt.NewContext(ctx, mc)
 	defer cancel()
 
 	done := make(chan error, 1)
@@ -1738,10 +1676,7 @@ func TestPoolPump_SolarRespectsHardCeiling(t *testing.T) {
 func TestPoolPump_SolarHardCeiling_DayRolloverUnblocksWithoutRestart(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
 	mc := mqtt.NewMockClient()
-	mqtt.SetClient(mc)
-	t.Cleanup(mqtt.ResetClient)
 
 	// Same tiny ceiling override as TestPoolPump_SolarRespectsHardCeiling
 	// (~7.7s target), so a modest injected sec total blocks solar start.
@@ -1757,6 +1692,7 @@ func TestPoolPump_SolarHardCeiling_DayRolloverUnblocksWithoutRestart(t *testing.
 	}
 
 	ctx, cancel := poolPumpRunContext(t)
+	ctx = mqtt.NewContext(ctx, mc)
 	defer cancel()
 
 	done := make(chan error, 1)
@@ -1820,10 +1756,6 @@ func TestPoolPump_SolarHardCeiling_DayRolloverUnblocksWithoutRestart(t *testing.
 func TestPoolPump_SolarStaleFallsBackToSchedule(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	injector := make(chan []byte, 4)
 
 	deviceState := &script.DeviceState{
@@ -1883,10 +1815,7 @@ func TestPoolPump_SolarStaleFallsBackToSchedule(t *testing.T) {
 func TestPoolPump_SolarStaleTsFallsBackImmediately(t *testing.T) {
 	buf := readPoolPumpScript(t)
 
-	mqtt.ResetClient()
 	mc := mqtt.NewMockClient()
-	mqtt.SetClient(mc)
-	t.Cleanup(mqtt.ResetClient)
 
 	// solar-stale-ms defaults to 300000 (5 min) via CONFIG_SCHEMA — not
 	// overridden here, so this exercises the real default.
@@ -1900,6 +1829,7 @@ func TestPoolPump_SolarStaleTsFallsBackImmediately(t *testing.T) {
 	}
 
 	ctx, cancel := poolPumpRunContext(t)
+	ctx = mqtt.NewContext(ctx, mc)
 	defer cancel()
 
 	done := make(chan error, 1)
@@ -2104,10 +2034,6 @@ func poolPumpSummerSchedulesWrapped(start, stop time.Time) []map[string]interfac
 func poolPumpRewriteResult(t *testing.T, deviceState *script.DeviceState, wantOutput string) (string, []map[string]interface{}) {
 	t.Helper()
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	ctx, cancel := poolPumpRunContext(t)
 	defer cancel()
 
@@ -2455,10 +2381,6 @@ func TestPoolPump_DailyCheckNoOpRewriteLeavesWindowAndScheduleUnchanged(t *testi
 		Schedules:       poolPumpSummerSchedules(start, stop),
 	}
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	ctx, cancel := poolPumpRunContext(t)
 	defer cancel()
 
@@ -2542,10 +2464,6 @@ func TestPoolPump_DailyCheckWinterSwitchDerivesNightWindow(t *testing.T) {
 		},
 	}
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	ctx, cancel := poolPumpRunContext(t)
 	defer cancel()
 
@@ -2622,10 +2540,6 @@ func TestPoolPump_DailyCheckMissingEveningJobLeavesWindowUnresolved(t *testing.T
 		},
 	}
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	ctx, cancel := poolPumpRunContext(t)
 	defer cancel()
 
@@ -2692,10 +2606,6 @@ func TestPoolPump_DailyCheckRunsDuringWaterSupplyProtection(t *testing.T) {
 		Schedules:       poolPumpSummerSchedules(now.Add(2*time.Hour), now.Add(4*time.Hour)),
 	}
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	ctx, cancel := poolPumpRunContext(t)
 	defer cancel()
 
@@ -2937,10 +2847,6 @@ func waitPoolPumpInit(t *testing.T, deviceState *script.DeviceState) bool {
 func TestPoolPump_CallSlotBurstExhaustsPoolButSurvives(t *testing.T) {
 	buf := append(readPoolPumpScript(t), []byte(callSlotTestHarnessJS)...)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	injector := make(chan []byte, 4)
 	deviceState := newCallSlotDeviceState(injector)
 
@@ -3010,10 +2916,6 @@ func TestPoolPump_CallSlotBurstExhaustsPoolButSurvives(t *testing.T) {
 func TestPoolPump_CallSlotsReleaseAfterBurst(t *testing.T) {
 	buf := append(readPoolPumpScript(t), []byte(callSlotTestHarnessJS)...)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	injector := make(chan []byte, 4)
 	deviceState := newCallSlotDeviceState(injector)
 
@@ -3077,10 +2979,6 @@ func TestPoolPump_CallSlotsReleaseAfterBurst(t *testing.T) {
 func TestPoolPump_CallSlotDeepChainDefersInsteadOfRecursing(t *testing.T) {
 	buf := append(readPoolPumpScript(t), []byte(callSlotTestHarnessJS)...)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	injector := make(chan []byte, 4)
 	deviceState := newCallSlotDeviceState(injector)
 
@@ -3136,10 +3034,6 @@ func TestPoolPump_CallSlotDeepChainDefersInsteadOfRecursing(t *testing.T) {
 func TestPoolPump_CallSlotErrorPathReleasesSlot(t *testing.T) {
 	buf := append(readPoolPumpScript(t), []byte(callSlotTestHarnessJS)...)
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	injector := make(chan []byte, 4)
 	deviceState := newCallSlotDeviceState(injector)
 
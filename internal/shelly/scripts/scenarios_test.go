@@ -0,0 +1,78 @@
+package scripts
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/script"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/testr"
+)
+
+// scenariosDir holds the regression scenarios of the embedded scripts (see
+// script.Scenario), which `myhome ctl shelly script test` also runs.
+const scenariosDir = "testdata/scenarios"
+
+// runScenario runs a scenario file against its embedded script, and fails
+// the test for each of its expectations that does not hold. It returns the
+// scenario.
+func runScenario(t *testing.T, file string) *script.Scenario {
+	t.Helper()
+	sc, err := script.LoadScenario(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := fs.ReadFile(GetFS(), sc.Script)
+	if err != nil {
+		t.Fatalf("%s: %v", file, err)
+	}
+
+	ctx := logr.NewContext(context.Background(), testr.NewWithOptions(t, testr.Options{Verbosity: -1}))
+	failures, err := script.RunScenario(ctx, sc, buf)
+	if err != nil {
+		t.Fatalf("%s (%s): %v", file, sc.Name, err)
+	}
+	for _, f := range failures {
+		t.Errorf("%s (%s): %s", file, sc.Name, f)
+	}
+	return sc
+}
+
+// TestScenarios runs every scenario, and checks that every embedded script
+// has at least one: a new .js file comes with its scenarios.
+func TestScenarios(t *testing.T) {
+	// Scripts that cannot run in the goja harness (see TestSmokeAllScripts)
+	noScenario := map[string]string{
+		"universal-blu-to-mqtt.js": "uses BLE.Scanner (hardware-only API)",
+	}
+
+	files, err := filepath.Glob(filepath.Join(scenariosDir, "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	covered := make(map[string]bool)
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".yaml")
+		t.Run(name, func(t *testing.T) {
+			covered[runScenario(t, file).Script] = true
+		})
+	}
+
+	entries, err := fs.ReadDir(GetFS(), ".")
+	if err != nil {
+		t.Fatalf("failed to read embedded script FS: %v", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".js") || covered[name] {
+			continue
+		}
+		if _, ok := noScenario[name]; !ok {
+			t.Errorf("%s has no scenario in %s", name, scenariosDir)
+		}
+	}
+}
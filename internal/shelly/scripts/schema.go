@@ -0,0 +1,51 @@
+package scripts
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/virtual"
+)
+
+// The *.schema.json files are kept out of content, which is listed as the
+// set of available scripts.
+//
+//go:embed *.schema.json
+var schemas embed.FS
+
+// VirtualComponents returns the virtual components declared in the
+// "virtualComponents" list of the schema of the embedded script name (e.g.
+// pool-pump.schema.json for pool-pump.js), to be created on the device
+// alongside the script. It returns nil if the script has no schema.
+func VirtualComponents(name string) ([]virtual.AddRequest, error) {
+	schemaName := strings.TrimSuffix(path.Base(name), ".js") + ".schema.json"
+	buf, err := fs.ReadFile(schemas, schemaName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var schema struct {
+		VirtualComponents []virtual.AddRequest `json:"virtualComponents"`
+	}
+	if err := json.Unmarshal(buf, &schema); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", schemaName, err)
+	}
+	for _, vc := range schema.VirtualComponents {
+		// A fixed id keeps the setup idempotent, and lets the script find
+		// its components
+		if vc.Id == nil {
+			return nil, fmt.Errorf("%s: virtual %s component has no id", schemaName, vc.Type)
+		}
+		if _, _, err := virtual.ParseKey(virtual.Key(vc.Type, *vc.Id)); err != nil {
+			return nil, fmt.Errorf("%s: %w", schemaName, err)
+		}
+	}
+	return schema.VirtualComponents, nil
+}
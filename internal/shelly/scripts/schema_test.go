@@ -0,0 +1,27 @@
+package scripts
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+// TestVirtualComponents checks that every embedded schema declares valid
+// virtual components, if any.
+func TestVirtualComponents(t *testing.T) {
+	entries, err := fs.ReadDir(schemas, ".")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".schema.json") + ".js"
+		if _, err := VirtualComponents(name); err != nil {
+			t.Errorf("VirtualComponents(%s): %v", name, err)
+		}
+	}
+
+	vcs, err := VirtualComponents("watchdog.js")
+	if err != nil || vcs != nil {
+		t.Errorf("expected no virtual components for a script without schema, got %v, %v", vcs, err)
+	}
+}
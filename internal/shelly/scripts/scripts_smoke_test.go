@@ -69,10 +69,6 @@ func TestSmokeAllScripts(t *testing.T) {
 	// Leave empty to use the generic state below.
 	perScriptState := map[string]*script.DeviceState{}
 
-	mqtt.ResetClient()
-	mqtt.SetClient(mqtt.NewMockClient())
-	t.Cleanup(mqtt.ResetClient)
-
 	entries, err := fs.ReadDir(GetFS(), ".")
 	if err != nil {
 		t.Fatalf("failed to read embedded script FS: %v", err)
@@ -112,6 +108,7 @@ func TestSmokeAllScripts(t *testing.T) {
 				smokeTimeout,
 			)
 			defer cancel()
+			ctx = mqtt.NewContext(ctx, mqtt.NewMockClient())
 
 			deviceState, ok := perScriptState[name]
 			if !ok {
@@ -2,6 +2,7 @@ package ctl
 
 import (
 	"context"
+	"fmt"
 	"github.com/asnowfix/home-automation/internal/global"
 	"github.com/asnowfix/home-automation/hlog"
 	"github.com/asnowfix/home-automation/internal/myhome"
@@ -11,6 +12,7 @@ import (
 	"github.com/asnowfix/home-automation/myhome/ctl/db"
 	eventsctl "github.com/asnowfix/home-automation/myhome/ctl/events"
 	"github.com/asnowfix/home-automation/myhome/ctl/fetch"
+	"github.com/asnowfix/home-automation/myhome/ctl/fleet"
 	"github.com/asnowfix/home-automation/myhome/ctl/forget"
 	"github.com/asnowfix/home-automation/myhome/ctl/heater"
 	"github.com/asnowfix/home-automation/myhome/ctl/list"
@@ -20,6 +22,7 @@ import (
 	"github.com/asnowfix/home-automation/myhome/ctl/garden"
 	"github.com/asnowfix/home-automation/myhome/ctl/pool"
 	"github.com/asnowfix/home-automation/myhome/ctl/room"
+	"github.com/asnowfix/home-automation/myhome/ctl/rpc"
 	"github.com/asnowfix/home-automation/myhome/ctl/sfr"
 	"github.com/asnowfix/home-automation/myhome/ctl/shelly"
 	"github.com/asnowfix/home-automation/myhome/ctl/show"
@@ -30,6 +33,7 @@ import (
 	"os"
 	"os/signal"
 	shellyPkg "github.com/asnowfix/home-automation/pkg/shelly"
+	shellymqtt "github.com/asnowfix/home-automation/pkg/shelly/mqtt"
 	"github.com/asnowfix/home-automation/pkg/shelly/types"
 	"runtime/pprof"
 	"syscall"
@@ -53,6 +57,11 @@ var Cmd = &cobra.Command{
 
 		ctx = options.CommandLineContext(ctx)
 
+		if localOnly(cmd) {
+			cmd.SetContext(ctx)
+			return nil
+		}
+
 		// Set the target instance name for RPC topics
 		if options.Flags.InstanceName != "" {
 			myhome.InstanceName = options.Flags.InstanceName
@@ -70,13 +79,28 @@ var Cmd = &cobra.Command{
 			return err
 		}
 
+		// RPC credentials, from the environment (.env) only, never a flag
+		myhome.TheCredentials = myhome.Credentials{
+			Key:    os.Getenv("MYHOME_RPC_KEY"),
+			Secret: os.Getenv("MYHOME_RPC_TOKEN"),
+		}
+
 		myhome.TheClient, err = myhome.NewClientE(ctx, log, mc, options.Flags.MqttTimeout)
 		if err != nil {
 			log.Error(err, "Failed to initialize MyHome client")
 			return err
 		}
 
-		shellyPkg.Init(log, mc, options.Flags.MqttTimeout, options.Flags.ShellyRateLimit)
+		shellyPkg.Init(log, mc, options.Flags.MqttTimeout, options.Flags.ShellyRateLimit, options.Flags.ShellyUdpPort)
+
+		// Shelly device passwords, from the environment (.env) only, never a flag
+		passwords, err := types.ParsePasswords(os.Getenv("MYHOME_SHELLY_PASSWORDS"))
+		if err != nil {
+			return fmt.Errorf("MYHOME_SHELLY_PASSWORDS: %w", err)
+		}
+		if err := shellyPkg.SetCredentialsProvider(passwords); err != nil {
+			return err
+		}
 
 		// Start cleanup goroutine that closes MQTT client when context is cancelled OR on signal
 		// This ensures cleanup happens even when command returns an error or is interrupted
@@ -103,7 +127,8 @@ var Cmd = &cobra.Command{
 			}
 		}
 
-		cmd.SetContext(ctx)
+		// MQTT client of the scripts run locally (see script.Run)
+		cmd.SetContext(shellymqtt.NewContext(ctx, mc))
 
 		return nil
 	},
@@ -115,6 +140,10 @@ var Cmd = &cobra.Command{
 			defer pprof.StopCPUProfile()
 		}
 
+		if localOnly(cmd) {
+			return nil
+		}
+
 		mc, err := mqttclient.GetClientE(ctx)
 		if err != nil {
 			return err
@@ -127,6 +156,18 @@ var Cmd = &cobra.Command{
 	},
 }
 
+// localOnly reports whether cmd, or one of its parents, is annotated as
+// working on local files only. With cobra.EnableTraverseRunHooks the ctl
+// hooks run for every ctl command, so this is how they skip MQTT.
+func localOnly(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if _, ok := c.Annotations[options.LOCAL_ONLY_ANNOTATION]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 func init() {
 	Cmd.PersistentFlags().StringVarP(&options.Flags.CpuProfile, "cpuprofile", "C", "", "write CPU profile to `file`")
 	Cmd.PersistentFlags().DurationVarP(&options.Flags.Wait, "wait", "w", options.COMMAND_DEFAULT_TIMEOUT, "Maximum time to wait for command to finish (0 = wait indefinitely)")
@@ -139,6 +180,7 @@ func init() {
 	Cmd.PersistentFlags().BoolVarP(&options.Flags.Json, "json", "j", false, "output in json format")
 	Cmd.PersistentFlags().DurationVarP(&options.Flags.MdnsTimeout, "mdns-timeout", "M", options.MDNS_LOOKUP_DEFAULT_TIMEOUT, "Timeout for mDNS lookups")
 	Cmd.PersistentFlags().StringVarP(&options.Flags.Via, "via", "V", types.ChannelDefault.String(), "Use given channel to communicate with Shelly devices (default is to discover it from the network)")
+	Cmd.PersistentFlags().Uint16Var(&options.Flags.ShellyUdpPort, "udp-port", 0, "UDP port Shelly devices listen on for RPC (Sys rpc_udp.listen_port), used with --via udp when the device host has none")
 	Cmd.PersistentFlags().DurationVar(&options.Flags.ShellyRateLimit, "shelly-rate-limit", options.SHELLY_DEFAULT_RATE_LIMIT, "Minimum interval between commands to the same Shelly device (0 to disable)")
 	Cmd.PersistentFlags().StringVarP(&options.Flags.InstanceName, "instance", "I", "myhome", "Target myhome server instance name for RPC (default: myhome)")
 
@@ -165,6 +207,8 @@ func init() {
 	Cmd.AddCommand(room.Cmd)
 	Cmd.AddCommand(eventsctl.Cmd)
 	Cmd.AddCommand(fetch.Cmd)
+	Cmd.AddCommand(fleet.Cmd)
+	Cmd.AddCommand(rpc.Cmd)
 }
 
 var Commit string
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/myhome/storage/backup"
+	"github.com/spf13/cobra"
+)
+
+// database is a local database file, by the name of its backups.
+type database struct {
+	name   string
+	path   string
+	tables []string // Tables a backup of it must have, telling it apart from the other one
+}
+
+func databases() []database {
+	return []database{
+		{"myhome", localFlags.DB, []string{"devices"}},
+		{"events", localFlags.EventsDB, []string{"events"}},
+	}
+}
+
+func lookupDatabase(name string) (database, error) {
+	for _, d := range databases() {
+		if d.name == name {
+			return d, nil
+		}
+	}
+	return database{}, fmt.Errorf("unknown database %q (one of myhome, events)", name)
+}
+
+var BackupCmd = &cobra.Command{
+	Use:   "backup [directory]",
+	Short: "Back up the local databases, safely while the daemon runs",
+	Long: `Write a consistent copy of the myhome and events SQLite databases to a
+directory (default: the current one), as myhome-<time>.db and events-<time>.db.
+
+Copies are made with SQLite's VACUUM INTO and checked for integrity: this is
+safe while the daemon runs, on its host. An events database that does not
+exist (events service disabled) is skipped.
+
+Examples:
+  myhome ctl db backup /mnt/backups --db /var/lib/myhome/myhome.db --events-db /var/lib/myhome/events.db`,
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: map[string]string{options.LOCAL_ONLY_ANNOTATION: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "."
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, d := range databases() {
+			dst := backup.SnapshotPath(dir, d.name, now)
+			err := backup.Backup(cmd.Context(), d.path, dst)
+			if d.name == "events" && errors.Is(err, os.ErrNotExist) {
+				fmt.Printf("Skipped %s: %s does not exist\n", d.name, d.path)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to back up %s: %w", d.path, err)
+			}
+			fmt.Printf("Backed up %s to %s\n", d.path, dst)
+		}
+		return nil
+	},
+}
+
+var RestoreCmd = &cobra.Command{
+	Use:   "restore <myhome|events> <backup.db>",
+	Short: "Restore a local database from a backup (daemon stopped)",
+	Long: `Replace the myhome or events SQLite database with a backup, once the backup
+passed SQLite's integrity check and was found to be a backup of that database
+(it has its tables). The replaced database is kept next to it as
+<database>.pre-restore-<time>.
+
+The daemon must be stopped: it keeps the databases open.
+
+Examples:
+  myhome ctl db restore myhome /mnt/backups/myhome-20261017T030000Z.db --db /var/lib/myhome/myhome.db`,
+	Args:        cobra.ExactArgs(2),
+	Annotations: map[string]string{options.LOCAL_ONLY_ANNOTATION: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		d, err := lookupDatabase(args[0])
+		if err != nil {
+			return err
+		}
+		dst := d.path
+		kept, err := backup.Restore(cmd.Context(), args[1], dst, d.tables...)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", dst, err)
+		}
+		if kept != "" {
+			fmt.Printf("Restored %s from %s (previous database kept as %s)\n", dst, args[1], kept)
+		} else {
+			fmt.Printf("Restored %s from %s\n", dst, args[1])
+		}
+		return nil
+	},
+}
+
+var VerifyCmd = &cobra.Command{
+	Use:         "verify <database.db>...",
+	Short:       "Run SQLite's integrity check on databases or backups",
+	Args:        cobra.MinimumNArgs(1),
+	Annotations: map[string]string{options.LOCAL_ONLY_ANNOTATION: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var failed int
+		for _, path := range args {
+			if err := backup.Verify(cmd.Context(), path); err != nil {
+				fmt.Printf("%s: %v\n", path, err)
+				failed++
+				continue
+			}
+			fmt.Printf("%s: ok\n", path)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d databases failed verification", failed, len(args))
+		}
+		return nil
+	},
+}
+
+func init() {
+	addLocalFlags(BackupCmd)
+	addLocalFlags(RestoreCmd)
+}
@@ -9,11 +9,16 @@ var Cmd = &cobra.Command{
 	Short: "Manage the device database",
 	Long: `Commands for managing the myhome device database.
 
-Export, import, and sync device data between myhome instances.`,
+Export, import, and sync device data between myhome instances, and back up,
+restore and migrate the local databases.`,
 }
 
 func init() {
 	Cmd.AddCommand(ExportCmd)
 	Cmd.AddCommand(ImportCmd)
 	Cmd.AddCommand(PullCmd)
+	Cmd.AddCommand(MigrateCmd)
+	Cmd.AddCommand(BackupCmd)
+	Cmd.AddCommand(RestoreCmd)
+	Cmd.AddCommand(VerifyCmd)
 }
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/myhome/events"
+	"github.com/asnowfix/home-automation/myhome/fetchproxy"
+	"github.com/asnowfix/home-automation/myhome/storage"
+	"github.com/asnowfix/home-automation/myhome/storage/backup"
+	"github.com/asnowfix/home-automation/myhome/storage/migrate"
+	"github.com/asnowfix/home-automation/myhome/temperature"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/cobra"
+)
+
+// localFlags are the paths of the database files the local-only commands
+// (migrate, backup, restore) work on.
+var localFlags struct {
+	DB       string
+	EventsDB string
+}
+
+func addLocalFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&localFlags.DB, "db", "myhome.db", "Path to the myhome SQLite database")
+	cmd.PersistentFlags().StringVar(&localFlags.EventsDB, "events-db", "events.db", "Path to the events SQLite database")
+}
+
+var migrateFlags struct {
+	To int
+}
+
+// subsystem is a migration set and the database file it lives in.
+type subsystem struct {
+	set  migrate.Set
+	path func() string
+}
+
+func subsystems() []subsystem {
+	myhomeDB := func() string { return localFlags.DB }
+	eventsDB := func() string { return localFlags.EventsDB }
+	return []subsystem{
+		{storage.Migrations, myhomeDB},
+		{temperature.Migrations, myhomeDB},
+		{fetchproxy.Migrations, myhomeDB},
+		{events.Migrations, eventsDB},
+	}
+}
+
+func lookupSubsystem(name string) (subsystem, error) {
+	var names []string
+	for _, s := range subsystems() {
+		if s.set.Subsystem == name {
+			return s, nil
+		}
+		names = append(names, s.set.Subsystem)
+	}
+	return subsystem{}, fmt.Errorf("unknown subsystem %q (one of %v)", name, names)
+}
+
+// open opens an existing database file: migrating one that does not exist
+// would only create an empty database.
+func (s subsystem) open() (*sqlx.DB, error) {
+	db, err := backup.Open(s.path())
+	if err != nil {
+		return nil, fmt.Errorf("%s database: %w", s.set.Subsystem, err)
+	}
+	return db, nil
+}
+
+var MigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Show or change the schema version of the local databases",
+	Long: `Show or change the schema version of the myhome SQLite databases
+(myhome.db and events.db), per subsystem, as recorded in their
+schema_migrations table.
+
+The daemon applies pending migrations itself when it starts, and refuses to
+start on a database migrated by a newer myhome. Use these commands on the
+daemon's host, with the daemon stopped, to inspect or to roll back a schema
+before downgrading myhome.
+
+Examples:
+  # Show the schema version of every subsystem
+  myhome ctl db migrate status --db /var/lib/myhome/myhome.db --events-db /var/lib/myhome/events.db
+
+  # Roll the devices schema back by one version
+  myhome ctl db migrate down devices
+
+  # Roll the devices schema back to version 2, then forward again
+  myhome ctl db migrate down devices --to 2
+  myhome ctl db migrate up devices`,
+	// migrate works on the database files directly and does not need an
+	// MQTT connection.
+	Annotations: map[string]string{options.LOCAL_ONLY_ANNOTATION: ""},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the current and latest schema version of each subsystem",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var statuses []*migrate.Status
+		for _, s := range subsystems() {
+			db, err := s.open()
+			if err != nil {
+				return err
+			}
+			st, err := migrate.StatusOf(cmd.Context(), db, s.set)
+			db.Close()
+			if err != nil {
+				return err
+			}
+			statuses = append(statuses, st)
+		}
+
+		if options.Flags.Json {
+			return options.PrintResult(statuses)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SUBSYSTEM\tCURRENT\tLATEST\tSTATE")
+		fmt.Fprintln(w, "---------\t-------\t------\t-----")
+		for _, st := range statuses {
+			state := "up to date"
+			switch {
+			case st.Current > st.Latest:
+				state = "newer than this myhome"
+			case st.Current < st.Latest:
+				state = strconv.Itoa(st.Latest-st.Current) + " pending"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", st.Subsystem, st.Current, st.Latest, state)
+		}
+		return w.Flush()
+	},
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up [subsystem]",
+	Short: "Apply pending migrations, to the latest version or to --to",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		targets := subsystems()
+		if len(args) == 1 {
+			s, err := lookupSubsystem(args[0])
+			if err != nil {
+				return err
+			}
+			targets = []subsystem{s}
+		} else if migrateFlags.To != 0 {
+			return fmt.Errorf("--to requires a subsystem")
+		}
+
+		for _, s := range targets {
+			if err := runMigration(cmd.Context(), s, "Applied", func(ctx context.Context, db *sqlx.DB) ([]migrate.Migration, error) {
+				return migrate.Up(ctx, db, s.set, migrateFlags.To)
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down <subsystem>",
+	Short: "Roll back the last migration of a subsystem, or down to --to",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := lookupSubsystem(args[0])
+		if err != nil {
+			return err
+		}
+		return runMigration(cmd.Context(), s, "Reverted", func(ctx context.Context, db *sqlx.DB) ([]migrate.Migration, error) {
+			to := migrateFlags.To
+			if !cmd.Flags().Changed("to") {
+				st, err := migrate.StatusOf(ctx, db, s.set)
+				if err != nil {
+					return nil, err
+				}
+				to = max(st.Current-1, 0)
+			}
+			return migrate.Down(ctx, db, s.set, to)
+		})
+	},
+}
+
+func runMigration(ctx context.Context, s subsystem, verb string, fn func(context.Context, *sqlx.DB) ([]migrate.Migration, error)) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	done, err := fn(ctx, db)
+	for _, m := range done {
+		fmt.Printf("%s %s migration %d: %s\n", verb, s.set.Subsystem, m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(done) == 0 {
+		fmt.Printf("Nothing to do for %s\n", s.set.Subsystem)
+	}
+	return nil
+}
+
+func init() {
+	addLocalFlags(MigrateCmd)
+	migrateUpCmd.Flags().IntVar(&migrateFlags.To, "to", 0, "Version to migrate up to (default: latest)")
+	migrateDownCmd.Flags().IntVar(&migrateFlags.To, "to", 0, "Version to roll back to (default: the previous one)")
+
+	MigrateCmd.AddCommand(migrateStatusCmd)
+	MigrateCmd.AddCommand(migrateUpCmd)
+	MigrateCmd.AddCommand(migrateDownCmd)
+}
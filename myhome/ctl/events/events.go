@@ -120,13 +120,14 @@ func init() {
 }
 
 // ============================================================================
-// follow — tail live events via SSE
+// follow — tail live events via an event.subscribe RPC subscription (or SSE)
 // ============================================================================
 
 var (
 	followDevice   string
 	followType     string
 	followSeverity string
+	followUseSSE   bool
 )
 
 // severityRank maps severity labels to numeric rank (higher = more severe).
@@ -144,17 +145,14 @@ var severityRank = map[string]int{
 
 var followCmd = &cobra.Command{
 	Use:   "follow",
-	Short: "Stream live events from the running daemon via SSE",
+	Short: "Stream live events from the running daemon",
+	Long: `Stream live events from the running daemon, through an event.subscribe
+subscription on the myhome RPC bus (works wherever the MQTT broker is
+reachable). Use --sse to read the local web UI's Server-Sent Events stream
+instead.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx := cmd.Context()
 
-		host := "localhost"
-		port := options.Flags.UiPort
-		if port == 0 {
-			port = options.HTTP_DEFAULT_PORT
-		}
-		url := fmt.Sprintf("http://%s:%d/events", host, port)
-
 		minRank := severityRank["info"]
 		if followSeverity != "" {
 			r, ok := severityRank[strings.ToLower(followSeverity)]
@@ -164,6 +162,24 @@ var followCmd = &cobra.Command{
 			minRank = r
 		}
 
+		// Both the subscription and the SSE stream match the device ID
+		// exactly: resolve a name or MAC to it first.
+		deviceFilter, err := resolveDeviceId(ctx, followDevice)
+		if err != nil {
+			return err
+		}
+
+		if !followUseSSE {
+			return followRPC(ctx, deviceFilter, followType, minRank)
+		}
+
+		host := "localhost"
+		port := options.Flags.UiPort
+		if port == 0 {
+			port = options.HTTP_DEFAULT_PORT
+		}
+		url := fmt.Sprintf("http://%s:%d/events", host, port)
+
 		backoff := time.Second
 		const maxBackoff = 30 * time.Second
 
@@ -174,7 +190,7 @@ var followCmd = &cobra.Command{
 			default:
 			}
 
-			if err := followSSE(ctx, url, followDevice, followType, minRank); err != nil {
+			if err := followSSE(ctx, url, deviceFilter, followType, minRank); err != nil {
 				if ctx.Err() != nil {
 					return nil
 				}
@@ -195,6 +211,47 @@ var followCmd = &cobra.Command{
 	},
 }
 
+// resolveDeviceId returns the ID of the single device known by the given ID,
+// name or MAC, or "" for an empty filter.
+func resolveDeviceId(ctx context.Context, device string) (string, error) {
+	if device == "" {
+		return "", nil
+	}
+	found, err := myhome.TheClient.LookupDevices(ctx, device)
+	if err != nil {
+		return "", err
+	}
+	switch len(*found) {
+	case 0:
+		return "", fmt.Errorf("no device matches %q", device)
+	case 1:
+		return (*found)[0].Id(), nil
+	default:
+		return "", fmt.Errorf("%q matches %d devices: use a device ID", device, len(*found))
+	}
+}
+
+// followRPC subscribes to the daemon's event stream over the myhome RPC bus.
+// The device and type filters are applied server-side; severity is a
+// minimum rank, so it stays a client-side filter.
+func followRPC(ctx context.Context, deviceFilter, typeFilter string, minRank int) error {
+	stream, err := myhome.TheClient.SubscribeE(ctx, myhome.EventSubscribe, &myhome.SubscribeParams{
+		DeviceID:  deviceFilter,
+		EventType: typeFilter,
+	})
+	if err != nil {
+		return err
+	}
+	for n := range stream {
+		var ev myhome.EventView
+		if err := n.DecodeParams(&ev); err != nil {
+			continue
+		}
+		printFollowed(ev, minRank)
+	}
+	return nil
+}
+
 func followSSE(ctx context.Context, url, deviceFilter, typeFilter string, minRank int) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
@@ -238,16 +295,7 @@ func followSSE(ctx context.Context, url, deviceFilter, typeFilter string, minRan
 			if typeFilter != "" && !strings.HasPrefix(ev.Event, typeFilter) {
 				continue
 			}
-			rank, ok := severityRank[strings.ToLower(ev.Severity)]
-			if ok && rank < minRank {
-				continue
-			}
-			ts := time.Unix(int64(ev.Ts), 0).Format("2006-01-02 15:04:05")
-			data := ""
-			if ev.Data != nil {
-				data = " " + *ev.Data
-			}
-			fmt.Printf("%s %s %s %s%s\n", ts, ev.DeviceID, ev.Component, ev.Event, data)
+			printFollowed(ev, minRank)
 		case line == "":
 			currentEvent = ""
 		}
@@ -255,7 +303,22 @@ func followSSE(ctx context.Context, url, deviceFilter, typeFilter string, minRan
 	return scanner.Err()
 }
 
+// printFollowed prints one followed event, unless it is below minRank.
+func printFollowed(ev myhome.EventView, minRank int) {
+	rank, ok := severityRank[strings.ToLower(ev.Severity)]
+	if ok && rank < minRank {
+		return
+	}
+	ts := time.Unix(int64(ev.Ts), 0).Format("2006-01-02 15:04:05")
+	data := ""
+	if ev.Data != nil {
+		data = " " + *ev.Data
+	}
+	fmt.Printf("%s %s %s %s%s\n", ts, ev.DeviceID, ev.Component, ev.Event, data)
+}
+
 func init() {
+	followCmd.Flags().BoolVar(&followUseSSE, "sse", false, "Read the local web UI's SSE stream instead of subscribing over the RPC bus")
 	followCmd.Flags().StringVar(&followDevice, "device", "", "Filter by device ID/name/MAC (default: all)")
 	followCmd.Flags().StringVar(&followType, "type", "", "Event name prefix filter, e.g. \"switch\" (default: all)")
 	followCmd.Flags().StringVar(&followSeverity, "severity", "info", "Minimum severity: debug|info|notice|warn|alarm (default: info)")
@@ -275,9 +338,8 @@ var clearCmd = &cobra.Command{
 	Short: "Purge old events from the events database",
 	Long: `Purge events older than the given cutoff directly from the events SQLite database.
 Does not require the daemon to be running.`,
-	// Override PersistentPreRunE from ctl.go: clear reads the DB directly and
-	// does not need an MQTT connection.
-	PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+	// clear reads the DB directly and does not need an MQTT connection.
+	Annotations: map[string]string{options.LOCAL_ONLY_ANNOTATION: ""},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		dbPath := options.Flags.EventsDBPath
 		if dbPath == "" {
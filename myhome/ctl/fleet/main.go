@@ -0,0 +1,116 @@
+package fleet
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/asnowfix/home-automation/hlog"
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/internal/myhome/shelly/fleet"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/pkg/devices"
+	"github.com/asnowfix/home-automation/pkg/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "fleet",
+	Short: "Converge devices to a declarative fleet file",
+	Long: `Converge devices to a declarative fleet file.
+
+The fleet file gives the desired state of each device, by device name, id or
+glob pattern: its name, room, scripts, KVS values, schedules, switch & input
+modes, WiFi and BLE settings. Settings left out are not managed. See
+docs/configuration.md for the file format.
+
+The daemon reports the drift from the same file (see --fleet-file).`,
+}
+
+func init() {
+	Cmd.AddCommand(planCmd)
+	Cmd.AddCommand(applyCmd)
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan <file> [device]",
+	Short: "Show the changes that would converge devices to the fleet file",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return run(cmd.Context(), args, false)
+	},
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply <file> [device]",
+	Short: "Converge devices to the fleet file",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return run(cmd.Context(), args, true)
+	},
+}
+
+func run(ctx context.Context, args []string, apply bool) error {
+	f, err := fleet.Load(args[0])
+	if err != nil {
+		return err
+	}
+	name := "*"
+	if len(args) > 1 {
+		name = args[1]
+	}
+	_, err = myhome.Foreach(ctx, hlog.Logger, name, options.Via, func(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+		return converge(ctx, log, via, device, f, apply)
+	}, nil)
+	return err
+}
+
+func converge(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, f *fleet.File, apply bool) (any, error) {
+	sd, ok := device.(*shelly.Device)
+	if !ok || shelly.IsGen1Device(sd.Id()) || strings.HasPrefix(sd.Id(), "shellyblu-") {
+		return nil, nil
+	}
+	spec := f.Lookup(sd.Id(), sd.Name())
+	if spec == nil {
+		return nil, nil
+	}
+	plan, err := fleet.Diff(ctx, log, via, sd, rooms{}, spec)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Empty() {
+		fmt.Printf("%s: up to date\n", sd.Name())
+		return plan, nil
+	}
+	options.PrintResult(plan, sd.Name())
+	if apply {
+		if err := plan.Apply(ctx); err != nil {
+			return nil, err
+		}
+		fmt.Printf("%s: applied %d changes\n", sd.Name(), len(plan.Changes))
+	}
+	return plan, nil
+}
+
+// rooms reads and assigns device rooms through the daemon.
+type rooms struct{}
+
+func (rooms) GetRoom(ctx context.Context, deviceId string) (string, error) {
+	out, err := myhome.TheClient.CallE(ctx, myhome.DeviceShow, &myhome.DeviceShowParams{Identifier: deviceId})
+	if err != nil {
+		return "", err
+	}
+	d, ok := out.(*myhome.Device)
+	if !ok {
+		return "", fmt.Errorf("expected *myhome.Device, got %T", out)
+	}
+	return d.RoomId, nil
+}
+
+func (rooms) SetRoom(ctx context.Context, deviceId string, room string) error {
+	_, err := myhome.TheClient.CallE(ctx, myhome.DeviceSetRoom, &myhome.DeviceSetRoomParams{Identifier: deviceId, RoomId: room})
+	return err
+}
@@ -24,7 +24,14 @@ var Cmd = &cobra.Command{
 	Short: "Run the MCP stdio server (for AI tool use)",
 	Args:  cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		srv := server.NewMCPServer("shelly", "1.0.0")
+		srv := server.NewMCPServer("shelly", "1.0.0", server.WithResourceCapabilities(false, false))
+
+		tools, err := verbTools(cmd.Context(), readOnly)
+		if err != nil {
+			return err
+		}
+		srv.AddTools(tools...)
+		addResources(srv)
 
 		srv.AddTool(
 			mcpgo.NewTool("shelly_list",
@@ -34,6 +41,10 @@ var Cmd = &cobra.Command{
 			),
 			handleList,
 		)
+		if readOnly {
+			// shelly_call can run any device RPC, including Switch.Set
+			return server.ServeStdio(srv)
+		}
 		srv.AddTool(
 			mcpgo.NewTool("shelly_call",
 				mcpgo.WithDescription("Call a Shelly Gen2+ device RPC method over MQTT and return the JSON result."),
@@ -53,6 +64,12 @@ var Cmd = &cobra.Command{
 	},
 }
 
+var readOnly bool
+
+func init() {
+	Cmd.Flags().BoolVar(&readOnly, "read-only", false, "Only expose the read-only myhome verbs (and no raw shelly_call)")
+}
+
 func handleList(ctx context.Context, req mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
 	filter := req.GetString("filter", "*")
 	if filter == "" {
@@ -0,0 +1,95 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	mcpgo "github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/asnowfix/home-automation/internal/myhome"
+)
+
+// RecentEventsWindow and RecentEventsLimit bound the myhome://events/recent
+// resource.
+const (
+	RecentEventsWindow = 24 * time.Hour
+	RecentEventsLimit  = 200
+)
+
+// resource is a read-only MCP resource backed by a read-only verb.
+type resource struct {
+	uri         string
+	name        string
+	description string
+	verb        myhome.Verb
+	params      func() any
+}
+
+var resources = []resource{
+	{
+		uri:         "myhome://devices",
+		name:        "Devices",
+		description: "Every device known to the myhome daemon (id, name, host, mac...).",
+		verb:        myhome.DevicesMatch,
+		params:      func() any { return "*" },
+	},
+	{
+		uri:         "myhome://rooms",
+		name:        "Rooms",
+		description: "Every room defined in the myhome daemon.",
+		verb:        myhome.RoomList,
+		params:      func() any { return nil },
+	},
+	{
+		uri:         "myhome://events/recent",
+		name:        "Recent events",
+		description: "Device events recorded over the last 24 hours (at most 200).",
+		verb:        myhome.EventList,
+		params: func() any {
+			return &myhome.EventListRequest{Since: RecentEventsWindow, Limit: RecentEventsLimit}
+		},
+	},
+	{
+		uri:         "myhome://pool/status",
+		name:        "Pool status",
+		description: "Pool pump status: runtime and turnover today, water supply protection.",
+		verb:        myhome.PoolGetStatus,
+		params:      func() any { return nil },
+	},
+	{
+		uri:         "myhome://solar/claimers",
+		name:        "Solar claimers",
+		description: "Devices claiming solar surplus power, and whether each one is active.",
+		verb:        myhome.SolarClaimersList,
+		params:      func() any { return nil },
+	},
+}
+
+// addResources registers the read-only resources. They are served whatever
+// the read-only flag: they only call read-only verbs.
+func addResources(srv *server.MCPServer) {
+	for _, r := range resources {
+		srv.AddResource(
+			mcpgo.NewResource(r.uri, r.name,
+				mcpgo.WithResourceDescription(r.description),
+				mcpgo.WithMIMEType("application/json")),
+			r.read,
+		)
+	}
+}
+
+func (r resource) read(ctx context.Context, req mcpgo.ReadResourceRequest) ([]mcpgo.ResourceContents, error) {
+	out, err := myhome.TheClient.CallE(ctx, r.verb, r.params())
+	if err != nil {
+		return nil, err
+	}
+	text, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []mcpgo.ResourceContents{
+		mcpgo.TextResourceContents{URI: req.Params.URI, MIMEType: "application/json", Text: string(text)},
+	}, nil
+}
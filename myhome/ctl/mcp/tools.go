@@ -0,0 +1,159 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	mcpgo "github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/asnowfix/home-automation/internal/myhome"
+)
+
+// excludedVerbs are not exposed as tools: subscriptions need a streaming
+// transport MCP tools do not have, and the rpc.* plumbing verbs only make
+// sense to RPC clients.
+var excludedVerbs = map[myhome.Verb]bool{
+	myhome.EventSubscribe: true,
+	myhome.DeviceWatch:    true,
+	myhome.Unsubscribe:    true,
+	myhome.RpcCancel:      true,
+	myhome.RpcBatch:       true,
+	myhome.RpcList:        true,
+	myhome.RpcDescribe:    true,
+}
+
+// toolName returns the MCP tool name of a verb, e.g. "myhome_device_show"
+// for device.show: MCP clients do not all accept dots in tool names.
+func toolName(verb myhome.Verb) string {
+	return "myhome_" + strings.ReplaceAll(string(verb), ".", "_")
+}
+
+// describeVerbs returns the verbs the daemon serves (rpc.list), or every
+// verb known to this client if the daemon predates rpc.list.
+func describeVerbs(ctx context.Context) ([]myhome.MethodDescription, error) {
+	out, err := myhome.TheClient.CallE(ctx, myhome.RpcList, nil)
+	if err == nil {
+		if list, ok := out.(*myhome.ListResult); ok {
+			return list.Methods, nil
+		}
+		return nil, fmt.Errorf("unexpected result type: %T", out)
+	}
+	if !errors.Is(err, myhome.ErrMethodNotFound) {
+		return nil, err
+	}
+	var descriptions []myhome.MethodDescription
+	for _, verb := range myhome.Verbs() {
+		d, err := myhome.Describe(verb)
+		if err != nil {
+			return nil, err
+		}
+		descriptions = append(descriptions, *d)
+	}
+	return descriptions, nil
+}
+
+// verbTools returns one tool per verb served by the daemon, or only the
+// read-only ones if readOnly is set.
+func verbTools(ctx context.Context, readOnly bool) ([]server.ServerTool, error) {
+	descriptions, err := describeVerbs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var tools []server.ServerTool
+	for _, d := range descriptions {
+		if excludedVerbs[d.Name] || (readOnly && d.Role != myhome.RoleReadOnly) {
+			continue
+		}
+		tool, handler, err := verbTool(d)
+		if err != nil {
+			return nil, err
+		}
+		tools = append(tools, server.ServerTool{Tool: tool, Handler: handler})
+	}
+	return tools, nil
+}
+
+// verbTool returns the tool calling a verb through myhome.TheClient.CallE,
+// its input schema built from the verb's params schema.
+func verbTool(d myhome.MethodDescription) (mcpgo.Tool, server.ToolHandlerFunc, error) {
+	sig, err := myhome.Signature(d.Name)
+	if err != nil {
+		return mcpgo.Tool{}, nil, err
+	}
+	schema, wrapped := toolInputSchema(d.Params)
+	raw, err := json.Marshal(schema)
+	if err != nil {
+		return mcpgo.Tool{}, nil, err
+	}
+
+	description := fmt.Sprintf("Call the myhome %s method. Params: %s. Result: %s. Requires the %s role.",
+		d.Name, typeName(sig.NewParams()), typeName(sig.NewResult()), d.Role)
+	if wrapped {
+		description += ` Pass the params as the "params" argument.`
+	}
+	tool := mcpgo.NewToolWithRawSchema(toolName(d.Name), description, raw)
+	readOnly := d.Role == myhome.RoleReadOnly
+	tool.Annotations.ReadOnlyHint = &readOnly
+
+	handler := func(ctx context.Context, req mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
+		var in any = req.GetArguments()
+		if wrapped {
+			in = req.GetArguments()["params"]
+		}
+		params := sig.NewParams()
+		if params != nil && in != nil {
+			buf, err := json.Marshal(in)
+			if err != nil {
+				return mcpgo.NewToolResultError(err.Error()), nil
+			}
+			if err := json.Unmarshal(buf, &params); err != nil {
+				return mcpgo.NewToolResultError(fmt.Sprintf("invalid params: %v", err)), nil
+			}
+		}
+
+		out, err := myhome.TheClient.CallE(ctx, d.Name, params)
+		if err != nil {
+			return mcpgo.NewToolResultError(err.Error()), nil
+		}
+		text, _ := json.MarshalIndent(out, "", "  ")
+		return mcpgo.NewToolResultText(string(text)), nil
+	}
+	return tool, handler, nil
+}
+
+// toolInputSchema turns a params schema into a tool input schema, which MCP
+// requires to be an object: struct params are used as-is, other params
+// (a device identifier string...) are wrapped as a "params" property.
+func toolInputSchema(params *myhome.Schema) (*myhome.Schema, bool) {
+	if params.Type == "null" {
+		return &myhome.Schema{Schema: params.Schema, Type: "object"}, false
+	}
+	if def, exists := params.Defs[strings.TrimPrefix(params.Ref, "#/$defs/")]; exists && params.Ref != "" && def.Type == "object" {
+		root := *def
+		root.Schema = params.Schema
+		root.Defs = params.Defs
+		return &root, false
+	}
+	inner := *params
+	inner.Schema, inner.Defs = "", nil
+	return &myhome.Schema{
+		Schema:     params.Schema,
+		Type:       "object",
+		Properties: map[string]*myhome.Schema{"params": &inner},
+		Required:   []string{"params"},
+		Defs:       params.Defs,
+	}, true
+}
+
+// typeName names the Go type of a params or result value for descriptions.
+func typeName(v any) string {
+	if v == nil {
+		return "none"
+	}
+	return strings.TrimPrefix(reflect.TypeOf(v).String(), "*")
+}
@@ -0,0 +1,116 @@
+package mcp
+
+import (
+	"context"
+	"testing"
+
+	mcpgo "github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/asnowfix/home-automation/internal/myhome"
+)
+
+// withFakeClient installs a FakeClient as myhome.TheClient for the duration
+// of the test and restores the previous value on cleanup. Tests using it must
+// not run in parallel.
+func withFakeClient(t *testing.T) *myhome.FakeClient {
+	t.Helper()
+	prev := myhome.TheClient
+	fake := myhome.NewFakeClient()
+	myhome.TheClient = fake
+	t.Cleanup(func() {
+		myhome.TheClient = prev
+	})
+	return fake
+}
+
+func describe(t *testing.T, verb myhome.Verb) myhome.MethodDescription {
+	t.Helper()
+	d, err := myhome.Describe(verb)
+	if err != nil {
+		t.Fatalf("Describe(%s): %v", verb, err)
+	}
+	return *d
+}
+
+func TestToolInputSchema(t *testing.T) {
+	s, wrapped := toolInputSchema(describe(t, myhome.DeviceShow).Params)
+	if wrapped || s.Type != "object" || s.Properties["identifier"] == nil {
+		t.Errorf("struct params: got wrapped=%v %+v", wrapped, s)
+	}
+	s, wrapped = toolInputSchema(describe(t, myhome.DeviceForget).Params)
+	if !wrapped || s.Type != "object" || s.Properties["params"].Type != "string" {
+		t.Errorf("string params: got wrapped=%v %+v", wrapped, s)
+	}
+	s, wrapped = toolInputSchema(describe(t, myhome.RoomList).Params)
+	if wrapped || s.Type != "object" || len(s.Properties) != 0 {
+		t.Errorf("no params: got wrapped=%v %+v", wrapped, s)
+	}
+}
+
+// TestVerbTool_CallsThroughClient verifies that tool arguments are decoded
+// into the verb's params type and sent through TheClient.CallE.
+func TestVerbTool_CallsThroughClient(t *testing.T) {
+	fake := withFakeClient(t)
+	fake.SetResult(myhome.DeviceShow, &myhome.Device{})
+	fake.SetResult(myhome.DeviceForget, nil)
+
+	call := func(verb myhome.Verb, args map[string]any) *mcpgo.CallToolResult {
+		_, handler, err := verbTool(describe(t, verb))
+		if err != nil {
+			t.Fatalf("verbTool(%s): %v", verb, err)
+		}
+		var req mcpgo.CallToolRequest
+		req.Params.Arguments = args
+		res, err := handler(context.Background(), req)
+		if err != nil {
+			t.Fatalf("%s: %v", verb, err)
+		}
+		return res
+	}
+
+	if res := call(myhome.DeviceShow, map[string]any{"identifier": "d1"}); res.IsError {
+		t.Fatalf("device.show: %+v", res.Content)
+	}
+	if res := call(myhome.DeviceForget, map[string]any{"params": "d2"}); res.IsError {
+		t.Fatalf("device.forget: %+v", res.Content)
+	}
+	if res := call(myhome.SwitchOn, nil); !res.IsError {
+		t.Error("switch.on: expected the client error to be a tool error")
+	}
+
+	if p, ok := fake.Calls[0].Params.(*myhome.DeviceShowParams); !ok || p.Identifier != "d1" {
+		t.Errorf("device.show params: got %#v", fake.Calls[0].Params)
+	}
+	if p, ok := fake.Calls[1].Params.(string); !ok || p != "d2" {
+		t.Errorf("device.forget params: got %#v", fake.Calls[1].Params)
+	}
+}
+
+// TestVerbTools_ReadOnly verifies that tools follow the daemon's rpc.list,
+// without subscriptions, and that --read-only keeps only read-only verbs.
+func TestVerbTools_ReadOnly(t *testing.T) {
+	fake := withFakeClient(t)
+	fake.SetResult(myhome.RpcList, &myhome.ListResult{Methods: []myhome.MethodDescription{
+		describe(t, myhome.DeviceShow),
+		describe(t, myhome.SwitchOn),
+		describe(t, myhome.EventSubscribe),
+	}})
+
+	names := func(readOnly bool) []string {
+		tools, err := verbTools(context.Background(), readOnly)
+		if err != nil {
+			t.Fatalf("verbTools: %v", err)
+		}
+		var names []string
+		for _, tool := range tools {
+			names = append(names, tool.Tool.Name)
+		}
+		return names
+	}
+	if got := names(false); len(got) != 2 || got[0] != "myhome_device_show" || got[1] != "myhome_switch_on" {
+		t.Errorf("all tools: got %v", got)
+	}
+	if got := names(true); len(got) != 1 || got[0] != "myhome_device_show" {
+		t.Errorf("read-only tools: got %v", got)
+	}
+}
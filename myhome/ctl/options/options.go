@@ -44,11 +44,17 @@ const MQTT_RECONNECT_INTERVAL time.Duration = 2 * time.Hour
 
 const SHELLY_DEFAULT_RATE_LIMIT time.Duration = 200 * time.Millisecond
 
+const SNAPSHOT_DEFAULT_KEEP int = 7
+
 // SOLAR_STALE_AFTER is the default for --solar-stale-after: roughly 5x
 // Beem's default 60s poll interval, so one or two missed polls don't
 // immediately drop the source out of the aggregate sum.
 const SOLAR_STALE_AFTER time.Duration = 5 * time.Minute
 
+// LOCAL_ONLY_ANNOTATION marks a ctl command (and its sub-commands) that works
+// on local files only: ctl then skips connecting to MQTT before running it.
+const LOCAL_ONLY_ANNOTATION = "myhome/local-only"
+
 // ViperConfig holds the Viper configuration instance
 var ViperConfig *viper.Viper
 
@@ -79,13 +85,19 @@ var Flags struct {
 	MetricsExporterPort         int
 	MetricsExporterTopic        string
 	ShellyRateLimit             time.Duration // the value taken by --shelly-rate-limit
+	ShellyUdpPort               uint16        // the value taken by --udp-port: devices' rpc_udp.listen_port
+	WebsocketWatch              bool          // the value taken by --websocket-watch
 	AutoSetup                   bool          // the value taken by --auto-setup / -A
 	ReconcileInterval           time.Duration // the value taken by --reconcile-interval (0 disables)
+	FleetFile                   string        // the value taken by --fleet-file: desired state whose drift is reported at each reconciliation
 	NoMdnsPublish               bool          // the value taken by --no-mdns-publish
 	InstanceName                string        // the value taken by --instance / -I
 	EventsDBPath                string        // path to events SQLite database
 	EventsRetention             time.Duration // retention period for event records
 	EnableEventsService         bool          // whether to enable the event recording service
+	SnapshotDir                 string        // directory of the scheduled database snapshots
+	SnapshotInterval            time.Duration // interval between scheduled database snapshots (0 disables)
+	SnapshotKeep                int           // number of scheduled snapshots kept per database
 	RemoteProxy                 string        // the value taken by --remote-proxy; delegates /devices/... to a remote myhome daemon
 	PoolDeviceID                string        // Shelly device ID for the pool pump
 	PoolEnabled                 bool          // whether to enable pool runtime tracking
@@ -112,6 +124,9 @@ var Flags struct {
 	SMTPPassword                string        // SMTP auth password (e.g. a Gmail App Password); from .env, never a flag
 	SMTPFrom                    string        // envelope/header From address; empty disables email entirely
 	SMTPTo                      string        // recipient address, or comma-separated list of addresses
+	RpcTokens                   string        // comma-separated name:role:secret RPC tokens; from .env, never a flag
+	ShellyPasswords             string        // comma-separated device_id:password Shelly device passwords ("*" for any device); from .env, never a flag
+	RpcAnonymousRole            string        // role of RPC requests carrying no credentials, once tokens are set
 }
 
 var Via types.Channel
@@ -1,8 +1,10 @@
 package room
 
 import (
+	"context"
 	"fmt"
 	"github.com/asnowfix/home-automation/internal/myhome"
+	"sort"
 
 	"github.com/spf13/cobra"
 )
@@ -39,19 +41,66 @@ If no room-id is provided, lists all devices that have a room assignment.`,
 				fmt.Printf("  - %s (%s)\n", d.Name(), d.Id())
 			}
 		} else {
-			// List all devices with room assignments via DevicesMatch
-			result, err := myhome.TheClient.CallE(cmd.Context(), myhome.DevicesMatch, "*")
-			if err != nil {
-				return err
-			}
+			return listAllRooms(cmd.Context())
+		}
+		return nil
+	},
+}
 
-			devices := result.(*[]myhome.DeviceSummary)
+// listAllRooms prints every device with a room assignment, grouped by room.
+// Device summaries carry no room, so the full records are fetched with
+// batched device.show calls: one round-trip per MaxBatchSize devices.
+func listAllRooms(ctx context.Context) error {
+	result, err := myhome.TheClient.CallE(ctx, myhome.DevicesMatch, "*")
+	if err != nil {
+		return err
+	}
+	summaries, ok := result.(*[]myhome.DeviceSummary)
+	if !ok {
+		return fmt.Errorf("expected *[]myhome.DeviceSummary, got %T", result)
+	}
 
-			// We need full device info to get room_id, so we'll list by room instead
-			// For now, just show a message
-			fmt.Println("Use 'myhome ctl room list <room-id>' to list devices in a specific room")
-			fmt.Printf("Found %d devices total\n", len(*devices))
+	rooms := make(map[string][]*myhome.Device)
+	for start := 0; start < len(*summaries); start += myhome.MaxBatchSize {
+		end := min(start+myhome.MaxBatchSize, len(*summaries))
+		calls := make([]myhome.BatchCall, 0, end-start)
+		for _, s := range (*summaries)[start:end] {
+			calls = append(calls, myhome.BatchCall{
+				Method: myhome.DeviceShow,
+				Params: &myhome.DeviceShowParams{Identifier: s.Id()},
+			})
 		}
+		items, err := myhome.TheClient.BatchE(ctx, calls)
+		if err != nil {
+			return err
+		}
+		for i, item := range items {
+			if err := item.Err(); err != nil {
+				fmt.Printf("Skipping %s: %v\n", calls[i].Params.(*myhome.DeviceShowParams).Identifier, err)
+				continue
+			}
+			d, ok := item.Result.(*myhome.Device)
+			if !ok || d.RoomId == "" {
+				continue
+			}
+			rooms[d.RoomId] = append(rooms[d.RoomId], d)
+		}
+	}
+
+	if len(rooms) == 0 {
+		fmt.Println("No devices with a room assignment")
 		return nil
-	},
+	}
+	roomIds := make([]string, 0, len(rooms))
+	for roomId := range rooms {
+		roomIds = append(roomIds, roomId)
+	}
+	sort.Strings(roomIds)
+	for _, roomId := range roomIds {
+		fmt.Printf("Devices in room %s:\n", roomId)
+		for _, d := range rooms[roomId] {
+			fmt.Printf("  - %s (%s)\n", d.Name(), d.Id())
+		}
+	}
+	return nil
 }
@@ -0,0 +1,73 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/asnowfix/home-automation/internal/myhome"
+)
+
+// withFakeClient installs a FakeClient as myhome.TheClient for the duration
+// of the test and restores the previous value on cleanup. Tests using it must
+// not run in parallel.
+func withFakeClient(t *testing.T) *myhome.FakeClient {
+	t.Helper()
+	prev := myhome.TheClient
+	fake := myhome.NewFakeClient()
+	myhome.TheClient = fake
+	t.Cleanup(func() {
+		myhome.TheClient = prev
+	})
+	return fake
+}
+
+func summary(id string) myhome.DeviceSummary {
+	return myhome.DeviceSummary{DeviceIdentifier: myhome.DeviceIdentifier{Id_: id}, Name_: id}
+}
+
+// TestListAllRooms_BatchesDeviceShow verifies that listing every room
+// assignment fetches the devices with batched device.show calls, and that a
+// failing item does not fail the whole listing.
+func TestListAllRooms_BatchesDeviceShow(t *testing.T) {
+	fake := withFakeClient(t)
+	fake.SetResult(myhome.DevicesMatch, &[]myhome.DeviceSummary{summary("a"), summary("b"), summary("gone")})
+	fake.SetHandler(myhome.DeviceShow, func(_ context.Context, in any) (any, error) {
+		id := in.(*myhome.DeviceShowParams).Identifier
+		if id == "gone" {
+			return nil, fmt.Errorf("%w: device %s", myhome.ErrNotFound, id)
+		}
+		return &myhome.Device{DeviceSummary: summary(id), RoomId: "salon"}, nil
+	})
+
+	listCmd.SetContext(context.Background())
+	if err := listCmd.RunE(listCmd, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(fake.Calls) != 4 {
+		t.Fatalf("expected 4 calls (1 match + 3 batched shows), got %d", len(fake.Calls))
+	}
+	if fake.Calls[0].Method != myhome.DevicesMatch {
+		t.Errorf("call 0: expected verb %s, got %s", myhome.DevicesMatch, fake.Calls[0].Method)
+	}
+	for i, call := range fake.Calls[1:] {
+		if call.Method != myhome.DeviceShow {
+			t.Errorf("call %d: expected verb %s, got %s", i+1, myhome.DeviceShow, call.Method)
+		}
+	}
+}
+
+func TestListAllRooms_PropagatesBatchError(t *testing.T) {
+	fake := withFakeClient(t)
+	fake.SetResult(myhome.DevicesMatch, &[]myhome.DeviceSummary{summary("a")})
+	wantErr := errors.New("broker down")
+	fake.SetError(myhome.RpcBatch, wantErr)
+
+	listCmd.SetContext(context.Background())
+	err := listCmd.RunE(listCmd, nil)
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("expected error %v, got %v", wantErr, err)
+	}
+}
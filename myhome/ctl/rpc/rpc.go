@@ -0,0 +1,73 @@
+// Package rpc provides the `myhome ctl rpc` command: discover the verbs the
+// daemon serves and the JSON Schema of their params & result, through the
+// rpc.list / rpc.describe RPC methods.
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/spf13/cobra"
+)
+
+// Cmd is the root "rpc" sub-command registered under "myhome ctl".
+var Cmd = &cobra.Command{
+	Use:   "rpc",
+	Short: "Discover the myhome RPC verbs and their schemas",
+}
+
+func init() {
+	Cmd.AddCommand(listCmd)
+	Cmd.AddCommand(describeCmd)
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the verbs served by the daemon, with the role they require",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		result, err := myhome.TheClient.CallE(cmd.Context(), myhome.RpcList, nil)
+		if err != nil {
+			return err
+		}
+		list, ok := result.(*myhome.ListResult)
+		if !ok {
+			return fmt.Errorf("unexpected result type: %T", result)
+		}
+
+		if options.Flags.Json {
+			return options.PrintResult(list)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "METHOD\tROLE")
+		fmt.Fprintln(w, "------\t----")
+		for _, m := range list.Methods {
+			fmt.Fprintf(w, "%s\t%s\n", m.Name, m.Role)
+		}
+		return w.Flush()
+	},
+}
+
+var describeCmd = &cobra.Command{
+	Use:   "describe <method>",
+	Short: "Print the JSON Schema of a verb's params and result",
+	Long:  "Print the JSON Schema of a verb's params and result. The output is always JSON, --json or not.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		result, err := myhome.TheClient.CallE(cmd.Context(), myhome.RpcDescribe, &myhome.DescribeParams{Method: myhome.Verb(args[0])})
+		if err != nil {
+			return err
+		}
+		out, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	},
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/asnowfix/home-automation/hlog"
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/pkg/devices"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Shelly device authentication",
+	Long: `Enable, rotate or disable the password protecting Shelly Gen2+ devices.
+
+Devices with a password answer HTTP requests with a SHA-256 digest challenge,
+which MyHome answers with the password from MYHOME_SHELLY_PASSWORDS
+(comma-separated device_id:password, "*" for any device), or else with the
+credentials recorded by the daemon when the password was set with this command.
+MQTT requests are not authenticated: use --via mqtt to reach a device whose
+password is lost.`,
+	Args: cobra.NoArgs,
+}
+
+func init() {
+	Cmd.AddCommand(setCmd)
+	Cmd.AddCommand(clearCmd)
+}
+
+var setCmd = &cobra.Command{
+	Use:   "set <device_name_or_pattern>",
+	Short: "Set (or rotate) the password of Shelly devices",
+	Long: `Set (or rotate) the password of Shelly devices.
+
+The daemon sets the password itself, over HTTP straight to each device, and
+records its credentials: no password nor digest goes on the MQTT bus. The
+password is the one of the device in the daemon's MYHOME_SHELLY_PASSWORDS
+(device id, or else "*"), or else a random one, known to the daemon only.
+
+Examples:
+  # Rotate the password of every Shelly Pro device
+  myhome ctl shelly auth set 'shellypro*'`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, func(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+			return oneDeviceAuth(ctx, log, device, true)
+		}, options.Args(args))
+		return err
+	},
+}
+
+var clearCmd = &cobra.Command{
+	Use:   "clear <device_name_or_pattern>",
+	Short: "Disable the password of Shelly devices",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, func(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+			return oneDeviceAuth(ctx, log, device, false)
+		}, options.Args(args))
+		return err
+	},
+}
+
+// oneDeviceAuth has the daemon enable (or rotate) authentication on device,
+// or disable it.
+func oneDeviceAuth(ctx context.Context, log logr.Logger, device devices.Device, enable bool) (any, error) {
+	_, err := myhome.TheClient.CallE(ctx, myhome.DeviceSetAuth, &myhome.DeviceSetAuthParams{
+		Identifier: device.Id(),
+		Enable:     enable,
+	})
+	if err != nil {
+		log.Error(err, "Unable to set device authentication", "device", device.Id())
+		return nil, err
+	}
+
+	if enable {
+		fmt.Printf("%s: password set\n", device.Name())
+	} else {
+		fmt.Printf("%s: authentication disabled\n", device.Name())
+	}
+	return nil, nil
+}
@@ -0,0 +1,143 @@
+package cover
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/asnowfix/home-automation/hlog"
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/pkg/devices"
+	"github.com/asnowfix/home-automation/pkg/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/cover"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+)
+
+var coverId int
+var duration float32
+
+func init() {
+	Cmd.PersistentFlags().IntVarP(&coverId, "id", "i", 0, "Use this cover ID.")
+	openCmd.Flags().Float32VarP(&duration, "duration", "d", 0, "Move for this many seconds (default: fully).")
+	closeCmd.Flags().Float32VarP(&duration, "duration", "d", 0, "Move for this many seconds (default: fully).")
+
+	Cmd.AddCommand(statusCmd)
+	Cmd.AddCommand(configCmd)
+	Cmd.AddCommand(openCmd)
+	Cmd.AddCommand(closeCmd)
+	Cmd.AddCommand(stopCmd)
+	Cmd.AddCommand(positionCmd)
+	Cmd.AddCommand(calibrateCmd)
+}
+
+var Cmd = &cobra.Command{
+	Use:   "cover",
+	Short: "Shelly covers (roller shutters) control & status",
+	Args:  cobra.NoArgs,
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status <device-id>",
+	Short: "Display cover status",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("status"),
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config <device-id>",
+	Short: "Display cover configuration",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("config"),
+}
+
+var openCmd = &cobra.Command{
+	Use:   "open <device-id>",
+	Short: "Open cover",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("open"),
+}
+
+var closeCmd = &cobra.Command{
+	Use:   "close <device-id>",
+	Short: "Close cover",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("close"),
+}
+
+var stopCmd = &cobra.Command{
+	Use:   "stop <device-id>",
+	Short: "Stop cover",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("stop"),
+}
+
+var positionCmd = &cobra.Command{
+	Use:   "position <device-id> <percent>",
+	Short: "Move a calibrated cover to a position, from 0 (closed) to 100 (open)",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("invalid position %q: %w", args[1], err)
+		}
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doCoverOneDevice, []string{"position", args[1]})
+		return err
+	},
+}
+
+var calibrateCmd = &cobra.Command{
+	Use:   "calibrate <device-id>",
+	Short: "Start cover calibration",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("calibrate"),
+}
+
+func run(op string) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doCoverOneDevice, []string{op})
+		return err
+	}
+}
+
+func doCoverOneDevice(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+	sd, ok := device.(*shelly.Device)
+	if !ok {
+		return nil, fmt.Errorf("device is not a Shelly: %s %v", reflect.TypeOf(device), device)
+	}
+
+	var out any
+	var err error
+
+	switch args[0] {
+	case "status":
+		out, err = cover.GetStatus(ctx, sd, via, coverId)
+	case "config":
+		out, err = cover.GetConfig(ctx, sd, via, coverId)
+	case "open":
+		err = cover.Open(ctx, sd, via, coverId, duration)
+	case "close":
+		err = cover.Close(ctx, sd, via, coverId, duration)
+	case "stop":
+		err = cover.Stop(ctx, sd, via, coverId)
+	case "position":
+		pos, _ := strconv.Atoi(args[1])
+		err = cover.GoToPosition(ctx, sd, via, coverId, pos)
+	case "calibrate":
+		err = cover.Calibrate(ctx, sd, via, coverId)
+	default:
+		return nil, fmt.Errorf("unknown operation %s", args[0])
+	}
+
+	if err != nil {
+		log.Error(err, "Failed to run cover operation", "op", args[0], "device", sd.Id())
+		return nil, fmt.Errorf("failed to run %s on device %s: %w", args[0], sd.Id(), err)
+	}
+	if out != nil {
+		options.PrintResult(out, sd.Name())
+	}
+	return out, nil
+}
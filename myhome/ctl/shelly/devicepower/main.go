@@ -0,0 +1,48 @@
+package devicepower
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/asnowfix/home-automation/hlog"
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/pkg/devices"
+	"github.com/asnowfix/home-automation/pkg/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/devicepower"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+)
+
+var devicePowerId int
+
+func init() {
+	Cmd.Flags().IntVarP(&devicePowerId, "id", "i", 0, "Use this DevicePower ID.")
+}
+
+var Cmd = &cobra.Command{
+	Use:   "power <device-id>",
+	Short: "Display battery & external power status of battery-powered devices",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doStatusOneDevice, options.Args(args))
+		return err
+	},
+}
+
+func doStatusOneDevice(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+	sd, ok := device.(*shelly.Device)
+	if !ok {
+		return nil, fmt.Errorf("device is not a Shelly: %s %v", reflect.TypeOf(device), device)
+	}
+	out, err := devicepower.GetStatus(ctx, sd, via, devicePowerId)
+	if err != nil {
+		log.Error(err, "Unable to get device power status", "device", sd.Id())
+		return nil, err
+	}
+	options.PrintResult(out, sd.Name())
+	return out, nil
+}
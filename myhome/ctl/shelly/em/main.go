@@ -0,0 +1,139 @@
+package em
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/asnowfix/home-automation/hlog"
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/pkg/devices"
+	"github.com/asnowfix/home-automation/pkg/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/em"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+)
+
+var emId int
+var em1 bool
+var since time.Duration
+
+func init() {
+	Cmd.PersistentFlags().IntVarP(&emId, "id", "i", 0, "Use this EM/EMData ID.")
+	Cmd.PersistentFlags().BoolVar(&em1, "em1", false, "Use the single-phase EM1/EM1Data component (e.g. Pro EM channels 0 and 1).")
+	recordsCmd.Flags().DurationVarP(&since, "since", "s", 24*time.Hour, "List records since this long ago.")
+	dataCmd.Flags().DurationVarP(&since, "since", "s", time.Hour, "Get records since this long ago.")
+
+	Cmd.AddCommand(statusCmd)
+	Cmd.AddCommand(energyCmd)
+	Cmd.AddCommand(recordsCmd)
+	Cmd.AddCommand(dataCmd)
+	Cmd.AddCommand(resetCmd)
+}
+
+var Cmd = &cobra.Command{
+	Use:   "em",
+	Short: "Shelly energy meters (Pro EM) status & data",
+	Args:  cobra.NoArgs,
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status <device-id>",
+	Short: "Display energy meter per-phase measurements",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("status"),
+}
+
+var energyCmd = &cobra.Command{
+	Use:   "energy <device-id>",
+	Short: "Display energy meter totals (EMData)",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("energy"),
+}
+
+var recordsCmd = &cobra.Command{
+	Use:   "records <device-id>",
+	Short: "List the stored energy data blocks",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("records"),
+}
+
+var dataCmd = &cobra.Command{
+	Use:   "data <device-id>",
+	Short: "Get the stored energy data records",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("data"),
+}
+
+var resetCmd = &cobra.Command{
+	Use:   "reset <device-id>",
+	Short: "Reset energy meter counters",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("reset"),
+}
+
+func run(op string) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doEMOneDevice, []string{op})
+		return err
+	}
+}
+
+func doEMOneDevice(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+	sd, ok := device.(*shelly.Device)
+	if !ok {
+		return nil, fmt.Errorf("device is not a Shelly: %s %v", reflect.TypeOf(device), device)
+	}
+
+	var out any
+	var err error
+
+	ts := time.Now().Add(-since).Unix()
+	switch args[0] {
+	case "status":
+		if em1 {
+			out, err = em.GetEM1Status(ctx, sd, via, emId)
+			break
+		}
+		out, err = em.GetStatus(ctx, sd, via, emId)
+	case "energy":
+		if em1 {
+			out, err = em.GetEM1DataStatus(ctx, sd, via, emId)
+			break
+		}
+		out, err = em.GetDataStatus(ctx, sd, via, emId)
+	case "records":
+		if em1 {
+			out, err = em.GetEM1Records(ctx, sd, via, emId, ts)
+			break
+		}
+		out, err = em.GetRecords(ctx, sd, via, emId, ts)
+	case "data":
+		if em1 {
+			out, err = em.GetEM1Data(ctx, sd, via, emId, ts, 0)
+			break
+		}
+		out, err = em.GetData(ctx, sd, via, emId, ts, 0)
+	case "reset":
+		if em1 {
+			err = em.ResetEM1DataCounters(ctx, sd, via, emId)
+			break
+		}
+		err = em.ResetDataCounters(ctx, sd, via, emId)
+	default:
+		return nil, fmt.Errorf("unknown operation %s", args[0])
+	}
+
+	if err != nil {
+		log.Error(err, "Failed to run EM operation", "op", args[0], "device", sd.Id())
+		return nil, fmt.Errorf("failed to run %s on device %s: %w", args[0], sd.Id(), err)
+	}
+	if out != nil {
+		options.PrintResult(out, sd.Name())
+	}
+	return out, nil
+}
@@ -0,0 +1,279 @@
+package firmware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/asnowfix/home-automation/hlog"
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/internal/myhome/shelly/firmware"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/pkg/devices"
+	shellyapi "github.com/asnowfix/home-automation/pkg/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/schedule"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "firmware",
+	Short: "Shelly firmware versions and fleet updates",
+	Args:  cobra.NoArgs,
+}
+
+func init() {
+	Cmd.AddCommand(statusCmd)
+
+	updateCmd.Flags().StringVar(&updateFlags.stage, "stage", firmware.StageStable, "Firmware stage to update to: stable|beta")
+	updateCmd.Flags().StringArrayVar(&updateFlags.quiet, "quiet", nil, "Daily window HH:MM-HH:MM during which no device is updated (repeatable)")
+	updateCmd.Flags().BoolVar(&updateFlags.schedules, "schedules", true, "Also keep out of the pool-pump and garden runs scheduled on the devices")
+	updateCmd.Flags().DurationVar(&updateFlags.gardenRun, "garden-run", firmware.DefaultGardenRun, "Longest garden watering after its scheduled start")
+	updateCmd.Flags().DurationVar(&updateFlags.timeout, "timeout", firmware.DefaultTimeout, "Maximum time for each device to come back online with its new firmware")
+	updateCmd.Flags().BoolVar(&updateFlags.dryRun, "dry-run", false, "Only show which devices would be updated, in which order")
+	Cmd.AddCommand(updateCmd)
+}
+
+// target is a device and its firmware status
+type target struct {
+	firmware.Status
+	device *shellyapi.Device
+}
+
+func oneDeviceFirmware(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+	sd, ok := device.(*shellyapi.Device)
+	if !ok {
+		return nil, fmt.Errorf("device is not a Shelly: %s %v", reflect.TypeOf(device), device)
+	}
+	s, err := firmware.GetStatus(ctx, via, sd)
+	if err != nil {
+		return nil, err
+	}
+	return &target{Status: *s, device: sd}, nil
+}
+
+// fleetFirmware returns the firmware status of the devices matching name,
+// sorted by model then name, and the error of the devices that did not
+// answer.
+func fleetFirmware(ctx context.Context, name string) ([]*target, error) {
+	out, err := myhome.Foreach(ctx, hlog.Logger, name, options.Via, oneDeviceFirmware, nil)
+	results, ok := out.([]any)
+	if !ok {
+		return nil, err
+	}
+	targets := make([]*target, 0, len(results))
+	for _, r := range results {
+		if t, ok := r.(*target); ok && t != nil {
+			targets = append(targets, t)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Model != targets[j].Model {
+			return targets[i].Model < targets[j].Model
+		}
+		return targets[i].Name < targets[j].Name
+	})
+	return targets, err
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status <device_name_or_pattern>",
+	Short: "Show the current, stable and beta firmware versions of Shelly devices",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		targets, err := fleetFirmware(cmd.Context(), args[0])
+
+		if options.Flags.Json {
+			statuses := make([]firmware.Status, 0, len(targets))
+			for _, t := range targets {
+				statuses = append(statuses, t.Status)
+			}
+			s, jerr := json.MarshalIndent(statuses, "", "  ")
+			if jerr != nil {
+				return jerr
+			}
+			fmt.Println(string(s))
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "DEVICE\tID\tMODEL\tVERSION\tSTABLE\tBETA")
+		fmt.Fprintln(w, "------\t--\t-----\t-------\t------\t----")
+		for _, t := range targets {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.Name, t.Id, t.Model, t.Version, orDash(t.Stable), orDash(t.Beta))
+		}
+		w.Flush()
+		return err
+	},
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+var updateFlags struct {
+	stage     string
+	quiet     []string
+	schedules bool
+	gardenRun time.Duration
+	timeout   time.Duration
+	dryRun    bool
+}
+
+var updateCmd = &cobra.Command{
+	Use:   "update <device_name_or_pattern>",
+	Short: "Update the firmware of Shelly devices, in a staged rollout",
+	Long: `Update the firmware of Shelly devices, in a staged rollout.
+
+One canary device per model is updated first, then the other devices, one at a
+time: each must come back online with its new firmware before the next one is
+updated, and the rollout stops at the first failure. No device is updated
+during a quiet window, nor so close to one that its update (up to --timeout)
+could run into it: the rollout waits. Quiet windows are those given with
+--quiet, and the pool-pump and garden runs scheduled on the devices.
+
+Each update is recorded in the daemon's event log, as firmware.updated or
+firmware.failed.
+
+Examples:
+  # Show the rollout plan
+  myhome ctl shelly firmware update '*' --dry-run
+
+  # Update every device, except while the pool pump runs (10:00-18:00)
+  myhome ctl shelly firmware update '*' --quiet 10:00-18:00`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		log := hlog.Logger
+
+		stage := updateFlags.stage
+		if stage != firmware.StageStable && stage != firmware.StageBeta {
+			return fmt.Errorf("invalid stage %q: must be stable|beta", stage)
+		}
+		quiet, err := firmware.ParseWindows(updateFlags.quiet)
+		if err != nil {
+			return err
+		}
+		if updateFlags.gardenRun < 0 || updateFlags.gardenRun >= 24*time.Hour {
+			return fmt.Errorf("invalid --garden-run %v: must be less than a day", updateFlags.gardenRun)
+		}
+
+		targets, err := fleetFirmware(ctx, args[0])
+		if err != nil {
+			if len(targets) == 0 {
+				return err
+			}
+			fmt.Printf("⚠ Some devices did not report their firmware, they will not be updated: %v\n", err)
+		}
+
+		devices := make(map[string]*shellyapi.Device, len(targets))
+		fleet := make([]firmware.Status, 0, len(targets))
+		for _, t := range targets {
+			devices[t.Id] = t.device
+			fleet = append(fleet, t.Status)
+		}
+		if updateFlags.schedules {
+			quiet = append(quiet, scheduledWindows(ctx, log, targets)...)
+		}
+
+		canaries, others := firmware.Plan(fleet, stage)
+		if len(canaries) == 0 {
+			fmt.Printf("All %d device(s) are up to date (%s)\n", len(fleet), stage)
+			return nil
+		}
+		fmt.Printf("Rollout plan (%s):\n", stage)
+		for i, s := range append(canaries, others...) {
+			role := ""
+			if i < len(canaries) {
+				role = " [canary]"
+			}
+			fmt.Printf("  %d. %s (%s, %s): %s -> %s%s\n", i+1, s.Name, s.Id, s.Model, s.Version, s.Available(stage), role)
+		}
+		for _, w := range quiet {
+			fmt.Printf("  quiet window: %v\n", w)
+		}
+		if updateFlags.dryRun {
+			return nil
+		}
+
+		rollout := &firmware.Rollout{
+			Log:     log,
+			Stage:   stage,
+			Quiet:   quiet,
+			Timeout: updateFlags.timeout,
+			Update: func(ctx context.Context, s firmware.Status) (string, error) {
+				fmt.Printf("Updating %s from %s to %s...\n", s.Name, s.Version, s.Available(stage))
+				version, err := firmware.Apply(ctx, log, options.Via, devices[s.Id], stage, s.Version, updateFlags.timeout)
+				if err != nil {
+					fmt.Printf("✗ %s: %v\n", s.Name, err)
+					return "", err
+				}
+				fmt.Printf("✓ %s is back online with %s\n", s.Name, version)
+				return version, nil
+			},
+			Record: func(ctx context.Context, s firmware.Status, event string, data map[string]string) {
+				recordEvent(ctx, log, s, event, data)
+			},
+		}
+		updated, err := rollout.Run(ctx, fleet)
+		fmt.Printf("\n%d of %d device(s) updated\n", len(updated), len(canaries)+len(others))
+		return err
+	},
+}
+
+// scheduledWindows returns the quiet windows of the pool-pump and garden runs
+// scheduled on targets (see firmware.ScheduleWindows). A device whose jobs
+// cannot be listed is skipped, with a warning.
+func scheduledWindows(ctx context.Context, log logr.Logger, targets []*target) []firmware.Window {
+	var windows []firmware.Window
+	seen := make(map[firmware.Window]bool)
+	for _, t := range targets {
+		out, err := schedule.ShowJobs(ctx, log, options.Via, t.device)
+		if err != nil {
+			fmt.Printf("⚠ Unable to read the schedules of %s, its runs are not quiet windows: %v\n", t.Name, err)
+			continue
+		}
+		for _, w := range firmware.ScheduleWindows(out.(*schedule.Scheduled).Jobs, updateFlags.gardenRun) {
+			if !seen[w] {
+				seen[w] = true
+				windows = append(windows, w)
+			}
+		}
+	}
+	return windows
+}
+
+// recordEvent adds the outcome of a device update to the daemon's event log.
+// Failing to do so does not stop the rollout.
+func recordEvent(ctx context.Context, log logr.Logger, s firmware.Status, event string, data map[string]string) {
+	severity := "notice"
+	if event == firmware.EventFailed {
+		severity = "warn"
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		log.Error(err, "Failed to marshal firmware event", "device", s.Id, "event", event)
+		return
+	}
+	str := string(b)
+	_, err = myhome.TheClient.CallE(ctx, myhome.EventRecord, &myhome.EventRecordRequest{
+		DeviceID:  s.Id,
+		Component: "sys",
+		Event:     event,
+		Severity:  severity,
+		Data:      &str,
+	})
+	if err != nil {
+		log.Error(err, "Failed to record firmware event", "device", s.Id, "event", event)
+	}
+}
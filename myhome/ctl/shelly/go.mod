@@ -7,6 +7,7 @@ toolchain go1.25.3
 require (
 	github.com/asnowfix/home-automation/myhome/ctl/shelly/follow v0.0.0-00010101000000-000000000000
 	github.com/go-logr/logr v1.4.3
+	github.com/gorilla/websocket v1.5.3
 	github.com/spf13/cobra v1.10.1
 	gopkg.in/yaml.v2 v2.4.0
 	gopkg.in/yaml.v3 v3.0.1
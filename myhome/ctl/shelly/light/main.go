@@ -0,0 +1,134 @@
+package light
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/asnowfix/home-automation/hlog"
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/pkg/devices"
+	"github.com/asnowfix/home-automation/pkg/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/light"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+)
+
+var lightId int
+var brightness float32
+var transition float32
+
+func init() {
+	Cmd.PersistentFlags().IntVarP(&lightId, "id", "i", 0, "Use this light ID.")
+	Cmd.PersistentFlags().Float32VarP(&transition, "transition", "t", 0, "Transition duration in seconds.")
+	setCmd.Flags().Float32VarP(&brightness, "brightness", "b", 0, "Brightness in percent (0-100).")
+	setCmd.MarkFlagRequired("brightness")
+
+	Cmd.AddCommand(statusCmd)
+	Cmd.AddCommand(configCmd)
+	Cmd.AddCommand(onCmd)
+	Cmd.AddCommand(offCmd)
+	Cmd.AddCommand(toggleCmd)
+	Cmd.AddCommand(setCmd)
+}
+
+var Cmd = &cobra.Command{
+	Use:   "light",
+	Short: "Shelly lights (dimmers) control & status",
+	Args:  cobra.NoArgs,
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status <device-id>",
+	Short: "Display light status",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("status"),
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config <device-id>",
+	Short: "Display light configuration",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("config"),
+}
+
+var onCmd = &cobra.Command{
+	Use:   "on <device-id>",
+	Short: "Turn light on",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("on"),
+}
+
+var offCmd = &cobra.Command{
+	Use:   "off <device-id>",
+	Short: "Turn light off",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("off"),
+}
+
+var toggleCmd = &cobra.Command{
+	Use:   "toggle <device-id>",
+	Short: "Toggle light",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run("toggle"),
+}
+
+var setCmd = &cobra.Command{
+	Use:   "set <device-id>",
+	Short: "Turn light on at the given brightness",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if brightness < 0 || brightness > 100 {
+			return fmt.Errorf("invalid brightness %v: must be 0-100", brightness)
+		}
+		return run("set")(cmd, args)
+	},
+}
+
+func run(op string) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doLightOneDevice, []string{op})
+		return err
+	}
+}
+
+func doLightOneDevice(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+	sd, ok := device.(*shelly.Device)
+	if !ok {
+		return nil, fmt.Errorf("device is not a Shelly: %s %v", reflect.TypeOf(device), device)
+	}
+
+	var out any
+	var err error
+
+	on := true
+	switch args[0] {
+	case "status":
+		out, err = light.GetStatus(ctx, sd, via, lightId)
+	case "config":
+		out, err = light.GetConfig(ctx, sd, via, lightId)
+	case "toggle":
+		err = light.Toggle(ctx, sd, via, lightId)
+	case "off":
+		on = false
+		fallthrough
+	case "on":
+		err = light.Set(ctx, sd, via, &light.SetRequest{Id: lightId, On: &on, TransitionDuration: transition})
+	case "set":
+		err = light.Set(ctx, sd, via, &light.SetRequest{Id: lightId, On: &on, Brightness: &brightness, TransitionDuration: transition})
+	default:
+		return nil, fmt.Errorf("unknown operation %s", args[0])
+	}
+
+	if err != nil {
+		log.Error(err, "Failed to run light operation", "op", args[0], "device", sd.Id())
+		return nil, fmt.Errorf("failed to run %s on device %s: %w", args[0], sd.Id(), err)
+	}
+	if out != nil {
+		options.PrintResult(out, sd.Name())
+	}
+	return out, nil
+}
@@ -1,17 +1,26 @@
 package shelly
 
 import (
+	"github.com/asnowfix/home-automation/myhome/ctl/shelly/auth"
 	"github.com/asnowfix/home-automation/myhome/ctl/shelly/call"
 	"github.com/asnowfix/home-automation/myhome/ctl/shelly/components"
+	"github.com/asnowfix/home-automation/myhome/ctl/shelly/cover"
+	"github.com/asnowfix/home-automation/myhome/ctl/shelly/devicepower"
+	"github.com/asnowfix/home-automation/myhome/ctl/shelly/em"
+	"github.com/asnowfix/home-automation/myhome/ctl/shelly/firmware"
 	"github.com/asnowfix/home-automation/myhome/ctl/shelly/follow"
 	"github.com/asnowfix/home-automation/myhome/ctl/shelly/jobs"
 	"github.com/asnowfix/home-automation/myhome/ctl/shelly/kvs"
+	"github.com/asnowfix/home-automation/myhome/ctl/shelly/light"
 	"github.com/asnowfix/home-automation/myhome/ctl/shelly/mqtt"
+	"github.com/asnowfix/home-automation/myhome/ctl/shelly/pm1"
 	"github.com/asnowfix/home-automation/myhome/ctl/shelly/reboot"
 	"github.com/asnowfix/home-automation/myhome/ctl/shelly/script"
 	"github.com/asnowfix/home-automation/myhome/ctl/shelly/setup"
 	"github.com/asnowfix/home-automation/myhome/ctl/shelly/status"
 	"github.com/asnowfix/home-automation/myhome/ctl/shelly/sys"
+	"github.com/asnowfix/home-automation/myhome/ctl/shelly/virtual"
+	"github.com/asnowfix/home-automation/myhome/ctl/shelly/webhook"
 	"github.com/asnowfix/home-automation/myhome/ctl/shelly/wifi"
 
 	"github.com/spf13/cobra"
@@ -24,6 +33,7 @@ var Cmd = &cobra.Command{
 }
 
 func init() {
+	Cmd.AddCommand(auth.Cmd)
 	Cmd.AddCommand(call.Cmd)
 	Cmd.AddCommand(follow.Cmd)
 	Cmd.AddCommand(follow.UnfollowCmd)
@@ -34,7 +44,15 @@ func init() {
 	Cmd.AddCommand(wifi.Cmd)
 	Cmd.AddCommand(sys.Cmd)
 	Cmd.AddCommand(components.Cmd)
+	Cmd.AddCommand(firmware.Cmd)
 	Cmd.AddCommand(setup.Cmd)
 	Cmd.AddCommand(reboot.Cmd)
 	Cmd.AddCommand(status.Cmd)
+	Cmd.AddCommand(cover.Cmd)
+	Cmd.AddCommand(light.Cmd)
+	Cmd.AddCommand(pm1.Cmd)
+	Cmd.AddCommand(em.Cmd)
+	Cmd.AddCommand(devicepower.Cmd)
+	Cmd.AddCommand(virtual.Cmd)
+	Cmd.AddCommand(webhook.Cmd)
 }
@@ -0,0 +1,81 @@
+package pm1
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/asnowfix/home-automation/hlog"
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/pkg/devices"
+	"github.com/asnowfix/home-automation/pkg/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/pm1"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+)
+
+var pm1Id int
+var counters []string
+
+func init() {
+	Cmd.PersistentFlags().IntVarP(&pm1Id, "id", "i", 0, "Use this PM1 ID.")
+	resetCmd.Flags().StringSliceVarP(&counters, "counter", "c", nil, fmt.Sprintf("Counters to reset: %s, %s (default: all).", pm1.CounterAenergy, pm1.CounterRetAenergy))
+
+	Cmd.AddCommand(statusCmd)
+	Cmd.AddCommand(resetCmd)
+}
+
+var Cmd = &cobra.Command{
+	Use:   "pm1",
+	Short: "Shelly power meters (PM Mini) status",
+	Args:  cobra.NoArgs,
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status <device-id>",
+	Short: "Display power meter status",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doPM1OneDevice, []string{"status"})
+		return err
+	},
+}
+
+var resetCmd = &cobra.Command{
+	Use:   "reset <device-id>",
+	Short: "Reset power meter energy counters",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doPM1OneDevice, []string{"reset"})
+		return err
+	},
+}
+
+func doPM1OneDevice(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+	sd, ok := device.(*shelly.Device)
+	if !ok {
+		return nil, fmt.Errorf("device is not a Shelly: %s %v", reflect.TypeOf(device), device)
+	}
+
+	var out any
+	var err error
+
+	switch args[0] {
+	case "status":
+		out, err = pm1.GetStatus(ctx, sd, via, pm1Id)
+	case "reset":
+		out, err = pm1.ResetCounters(ctx, sd, via, pm1Id, counters...)
+	default:
+		return nil, fmt.Errorf("unknown operation %s", args[0])
+	}
+
+	if err != nil {
+		log.Error(err, "Failed to run PM1 operation", "op", args[0], "device", sd.Id())
+		return nil, fmt.Errorf("failed to run %s on device %s: %w", args[0], sd.Id(), err)
+	}
+	options.PrintResult(out, sd.Name())
+	return out, nil
+}
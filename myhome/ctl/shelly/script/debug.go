@@ -6,14 +6,9 @@ import (
 	"github.com/asnowfix/home-automation/hlog"
 	"github.com/asnowfix/home-automation/internal/myhome"
 	"github.com/asnowfix/home-automation/myhome/ctl/options"
-	"github.com/asnowfix/home-automation/internal/myhome/net"
-	"net"
-	"os"
 	"github.com/asnowfix/home-automation/pkg/devices"
 	shellyapi "github.com/asnowfix/home-automation/pkg/shelly"
 	shellyscript "github.com/asnowfix/home-automation/pkg/shelly/script"
-	"github.com/asnowfix/home-automation/pkg/shelly/shelly"
-	"github.com/asnowfix/home-automation/pkg/shelly/system"
 	"github.com/asnowfix/home-automation/pkg/shelly/types"
 	"reflect"
 	"strconv"
@@ -126,51 +121,12 @@ var debugCtl = &cobra.Command{
 		}
 
 		if active {
-			port := flags.Port
-			_, ip, err := mynet.MainInterface(hlog.Logger)
+			addr, entries, err := listenUDPLog(ctx, log, flags.Port)
 			if err != nil {
 				return err
 			}
-			listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: *ip, Port: port})
-			if err != nil {
-				log.Error(err, "Unable to listen on UDP", "ip", ip.String(), "port", port)
-				return err
-			}
-			defer listener.Close()
-
-			// Get the actual port that was assigned (especially important if port was 0)
-			localAddr := listener.LocalAddr().(*net.UDPAddr)
-			port = localAddr.Port
-			log.Info("Listening on UDP", "ip", ip.String(), "port", port)
 
-			udpChan := make(chan []byte)
-
-			// Start a goroutine to read from UDP and send to channel
-			go func(ctx context.Context, log logr.Logger, ch chan []byte) {
-				ctx = tools.WithToken(ctx)
-				for {
-					buf := make([]byte, 1024)
-					n, addr, err := listener.ReadFromUDP(buf)
-					if err != nil {
-						log.Error(err, "Unable to read from UDP", "ip", addr.String())
-						continue
-					}
-					// log.Info("Received UDP message", "ip", addr.String(), "port", addr.Port, "bytes", n)
-
-					// Make a copy of the data to avoid buffer reuse issues
-					dataCopy := make([]byte, n)
-					copy(dataCopy, buf[:n])
-
-					// Send to channel or exit if context is done
-					select {
-					case ch <- dataCopy:
-					case <-ctx.Done():
-						return
-					}
-				}
-			}(ctx, log.WithName("UDP-logger"), udpChan)
-
-			go func(ctx context.Context, ch chan []byte) {
+			go func(ctx context.Context) {
 				ctx = tools.WithToken(ctx)
 
 				// Process messages from channel
@@ -179,13 +135,15 @@ var debugCtl = &cobra.Command{
 					case <-ctx.Done():
 						return
 
-					case data := <-ch:
-						parseMessage(data)
+					case e, ok := <-entries:
+						if !ok {
+							return
+						}
+						printLogEntry(e)
 					}
 				}
-			}(ctx, udpChan)
+			}(ctx)
 
-			addr := net.JoinHostPort(ip.String(), strconv.Itoa(port))
 			args = []string{addr}
 		} else {
 			args = []string{}
@@ -213,119 +171,5 @@ func doDebug(ctx context.Context, log logr.Logger, via types.Channel, device dev
 	if len(args) > 0 {
 		addr = &args[0]
 	}
-	config, err := system.GetConfig(ctx, via, sd)
-	if err != nil {
-		log.Error(err, "Unable to get config", "device", sd.Id())
-		return nil, err
-	}
-	log.Info("Current config", "config", config)
-	config.RpcUdp = nil // FIXME: force no-UDP channel (otherwise tries to set dst_addr="")
-	config.Debug = &system.DeviceDebug{
-		Mqtt: system.Enabler{
-			Enable: false,
-		},
-		WebSocket: system.Enabler{
-			Enable: false,
-		},
-		Udp: system.EnablerUDP{
-			Address: addr,
-			Level:   4,
-		},
-	}
-	log.Info("Applying new config", "config", config)
-	res, err := system.SetConfig(ctx, via, sd, config)
-	if err != nil {
-		log.Error(err, "Unable to turn on script UDP debugging", "addr", addr)
-		return nil, err
-	}
-	log.Info("Applied new config", "config", config)
-	if res.RestartRequired {
-		log.Info("Restart required")
-		err := shelly.DoReboot(ctx, sd)
-		if err != nil {
-			log.Error(err, "Unable to restart")
-			return nil, err
-		}
-		log.Info("Restarted", "res", res)
-	}
-	options.PrintResult(res)
-
-	return res, nil
-}
-
-func parseMessage(data []byte) {
-	// shelly1minig3-54320464074c 22008 84452.340 101 2|\"restart_required\": true, \"ts\": 1746952708.27999997138, \"cfg_rev\": 55 }\x00shelly1minig3-54320464074c 22009 84452.340 101 2|}\x00shelly1minig3-54320464074c 22010 84452.340 1 2|shelly_notification:211 Event from sys: {\"component\":\"sys\",\"event\":\"config_changed\",\"restart_required\":true,\"ts\":1746952708.28,\"cfg_rev\":55}\x00shelly1minig3-54320464074c 22011 84452.340 1 2|shelly_notification:165 Status change of sys: {\"cfg_rev\":55}\x00shelly1minig3-54320464074c 22012 84452.431 1 2|shos_rpc_inst.c:243     Wifi.GetStatus via MQTT
-	// shelly1minig3-54320464074c 22061 84617.229 102 2|BLE scanner is listening to addresses: e8:e0:7e:a6:0c:6f
-	// shelly1minig3-54320464074c 22062 84619.171 1 2|shos_rpc_inst.c:243     Shelly.GetDeviceInfo via MQTT
-	// shelly1minig3-54320464074c 22063 84619.536 1 2|shos_rpc_inst.c:243     Shelly.ListMethods via MQTT
-	// shelly1minig3-54320464074c 22064 84620.008 1 2|shos_rpc_inst.c:243     Script.Start via MQTT
-	// shelly1minig3-54320464074c 22065 84620.009 1 2|shelly_user_script.:215 JS RAM stat: initial: 74768 after: 74740, used: 28
-	// shelly1minig3-54320464074c 22066 84620.009 101 2|Now handling pool-house switch events
-	// shelly1minig3-54320464074c 22067 84620.010 1 2|shelly_user_script.:231 JS RAM stat: after user code: 74768 after: 73656, used: 1112
-	// shelly1minig3-54320464074c 22068 84620.024 1 2|shelly_notification:165 Status change of script:1: {\"id\":1,\"error_msg\":null,\"errors\":[],\"running\":true}
-	// shelly1minig3-54320464074c 22069 84620.159 1 2|shos_rpc_inst.c:243     Wifi.GetStatus via MQTT
-	// shelly1minig3-54320464074c 22070 84622.224 102 2|BLE scanner is listening to addresses: e8:e0:7e:a6:0c:6f" v=0
-	// shelly1minig3-54320464074c 22071 84627.223 102 2|BLE scanner is listening to addresses: e8:e0:7e:a6:0c:6f" v=0
-	// shelly1minig3-54320464074c 22072 84632.223 102 2|BLE scanner is listening to addresses: e8:e0:7e:a6:0c:6f" v=0
-
-	// 0x00 is a line break
-	lines := strings.Split(string(data), "\x00")
-
-	// One each line:
-	// <device> <message-count> <timestamp> <component> <lvl>|<message>
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-
-		// header is before "|", message is after
-		entry := strings.SplitN(line, "|", 2)
-		header := entry[0]
-
-		fields := strings.Split(header, " ")
-		if len(fields) != 5 {
-			fmt.Fprintf(os.Stderr, "Invalid line: %s\n", line)
-			continue
-		}
-
-		device := fields[0]
-
-		msgCount, err := strconv.Atoi(fields[1])
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Invalid msg count: %s\n", fields[1])
-			continue
-		}
-
-		timestamp, err := strconv.ParseFloat(fields[2], 64)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Invalid timestamp: %s\n", fields[2])
-			continue
-		}
-
-		component, err := strconv.Atoi(fields[3])
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Invalid component: %s\n", fields[3])
-			continue
-		}
-
-		// lvl, err := strconv.Atoi(fields[4])
-		// if err != nil {
-		// 	log.Error(err, "Invalid lvl", "lvl", fields[4])
-		// 	continue
-		// }
-
-		if len(entry) != 2 {
-			fmt.Fprintf(os.Stderr, "Invalid line: %s\n", line)
-			continue
-		}
-		msg := entry[1]
-
-		// if <component> is 1xx, xx is the script number
-		if component >= 100 && component < 200 {
-			scriptNumber := component - 100
-			fmt.Printf("%s [script:%d] [%d] %.3f | %s\n", device, scriptNumber, msgCount, timestamp, msg)
-		} else {
-			fmt.Printf("%s [comp:%d] [%d] %.3f | %s\n", device, component, msgCount, timestamp, msg)
-		}
-	}
+	return configureDebugLog(ctx, log, via, sd, addr, false)
 }
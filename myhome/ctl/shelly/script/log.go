@@ -0,0 +1,293 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asnowfix/home-automation/hlog"
+	mynet "github.com/asnowfix/home-automation/internal/myhome/net"
+	"github.com/asnowfix/home-automation/internal/tools"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	shellyapi "github.com/asnowfix/home-automation/pkg/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/system"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/websocket"
+)
+
+// <https://shelly-api-docs.shelly.cloud/gen2/General/DebugLogs>
+//
+// A device sends its debug log, when enabled in its sys config, as UDP
+// datagrams to a given address and/or over a websocket served on
+// ws://<host>/debug/log.
+
+// logEntry is one line of a device debug log.
+type logEntry struct {
+	Device    string
+	Count     int
+	Timestamp float64
+	Component int // 1xx for the script with id xx, noComponent when unknown
+	Msg       string
+}
+
+// noComponent marks entries whose source does not report the component,
+// i.e. those read from the websocket.
+const noComponent = -1
+
+// scriptComponent is the log component of the script with the given id.
+func scriptComponent(id uint32) int {
+	return 100 + int(id)
+}
+
+func printLogEntry(e logEntry) {
+	switch {
+	case e.Component == noComponent:
+		fmt.Printf("%s %.3f | %s\n", e.Device, e.Timestamp, e.Msg)
+	case e.Component >= 100 && e.Component < 200:
+		// if <component> is 1xx, xx is the script number
+		fmt.Printf("%s [script:%d] [%d] %.3f | %s\n", e.Device, e.Component-100, e.Count, e.Timestamp, e.Msg)
+	default:
+		fmt.Printf("%s [comp:%d] [%d] %.3f | %s\n", e.Device, e.Component, e.Count, e.Timestamp, e.Msg)
+	}
+}
+
+func parseMessage(data []byte) []logEntry {
+	// shelly1minig3-54320464074c 22008 84452.340 101 2|\"restart_required\": true, \"ts\": 1746952708.27999997138, \"cfg_rev\": 55 }\x00shelly1minig3-54320464074c 22009 84452.340 101 2|}\x00shelly1minig3-54320464074c 22010 84452.340 1 2|shelly_notification:211 Event from sys: {\"component\":\"sys\",\"event\":\"config_changed\",\"restart_required\":true,\"ts\":1746952708.28,\"cfg_rev\":55}\x00shelly1minig3-54320464074c 22011 84452.340 1 2|shelly_notification:165 Status change of sys: {\"cfg_rev\":55}\x00shelly1minig3-54320464074c 22012 84452.431 1 2|shos_rpc_inst.c:243     Wifi.GetStatus via MQTT
+	// shelly1minig3-54320464074c 22061 84617.229 102 2|BLE scanner is listening to addresses: e8:e0:7e:a6:0c:6f
+	// shelly1minig3-54320464074c 22062 84619.171 1 2|shos_rpc_inst.c:243     Shelly.GetDeviceInfo via MQTT
+	// shelly1minig3-54320464074c 22063 84619.536 1 2|shos_rpc_inst.c:243     Shelly.ListMethods via MQTT
+	// shelly1minig3-54320464074c 22064 84620.008 1 2|shos_rpc_inst.c:243     Script.Start via MQTT
+	// shelly1minig3-54320464074c 22065 84620.009 1 2|shelly_user_script.:215 JS RAM stat: initial: 74768 after: 74740, used: 28
+	// shelly1minig3-54320464074c 22066 84620.009 101 2|Now handling pool-house switch events
+	// shelly1minig3-54320464074c 22067 84620.010 1 2|shelly_user_script.:231 JS RAM stat: after user code: 74768 after: 73656, used: 1112
+	// shelly1minig3-54320464074c 22068 84620.024 1 2|shelly_notification:165 Status change of script:1: {\"id\":1,\"error_msg\":null,\"errors\":[],\"running\":true}
+	// shelly1minig3-54320464074c 22069 84620.159 1 2|shos_rpc_inst.c:243     Wifi.GetStatus via MQTT
+	// shelly1minig3-54320464074c 22070 84622.224 102 2|BLE scanner is listening to addresses: e8:e0:7e:a6:0c:6f" v=0
+	// shelly1minig3-54320464074c 22071 84627.223 102 2|BLE scanner is listening to addresses: e8:e0:7e:a6:0c:6f" v=0
+	// shelly1minig3-54320464074c 22072 84632.223 102 2|BLE scanner is listening to addresses: e8:e0:7e:a6:0c:6f" v=0
+
+	// 0x00 is a line break
+	lines := strings.Split(string(data), "\x00")
+
+	entries := make([]logEntry, 0, len(lines))
+
+	// One each line:
+	// <device> <message-count> <timestamp> <component> <lvl>|<message>
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+
+		// header is before "|", message is after
+		entry := strings.SplitN(line, "|", 2)
+		header := entry[0]
+
+		fields := strings.Split(header, " ")
+		if len(fields) != 5 {
+			fmt.Fprintf(os.Stderr, "Invalid line: %s\n", line)
+			continue
+		}
+
+		device := fields[0]
+
+		msgCount, err := strconv.Atoi(fields[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid msg count: %s\n", fields[1])
+			continue
+		}
+
+		timestamp, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid timestamp: %s\n", fields[2])
+			continue
+		}
+
+		component, err := strconv.Atoi(fields[3])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid component: %s\n", fields[3])
+			continue
+		}
+
+		// lvl, err := strconv.Atoi(fields[4])
+		// if err != nil {
+		// 	log.Error(err, "Invalid lvl", "lvl", fields[4])
+		// 	continue
+		// }
+
+		if len(entry) != 2 {
+			fmt.Fprintf(os.Stderr, "Invalid line: %s\n", line)
+			continue
+		}
+
+		entries = append(entries, logEntry{
+			Device:    device,
+			Count:     msgCount,
+			Timestamp: timestamp,
+			Component: component,
+			Msg:       entry[1],
+		})
+	}
+	return entries
+}
+
+// listenUDPLog listens for debug log datagrams on the main interface and
+// returns the address devices should send them to. Entries are delivered on
+// the returned channel until ctx is done.
+func listenUDPLog(ctx context.Context, log logr.Logger, port int) (string, <-chan logEntry, error) {
+	_, ip, err := mynet.MainInterface(hlog.Logger)
+	if err != nil {
+		return "", nil, err
+	}
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: *ip, Port: port})
+	if err != nil {
+		log.Error(err, "Unable to listen on UDP", "ip", ip.String(), "port", port)
+		return "", nil, err
+	}
+
+	// Get the actual port that was assigned (especially important if port was 0)
+	localAddr := listener.LocalAddr().(*net.UDPAddr)
+	port = localAddr.Port
+	log.Info("Listening on UDP", "ip", ip.String(), "port", port)
+
+	ch := make(chan logEntry)
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	// Start a goroutine to read from UDP and send to channel
+	go func(ctx context.Context, log logr.Logger) {
+		ctx = tools.WithToken(ctx)
+		defer close(ch)
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := listener.ReadFromUDP(buf)
+			if err != nil {
+				if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+					return
+				}
+				log.Error(err, "Unable to read from UDP", "addr", addr)
+				continue
+			}
+			// log.Info("Received UDP message", "ip", addr.String(), "port", addr.Port, "bytes", n)
+
+			for _, e := range parseMessage(buf[:n]) {
+				// Send to channel or exit if context is done
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}(ctx, log.WithName("UDP-logger"))
+
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port)), ch, nil
+}
+
+// wsLogFrame is a debug log line as sent over the websocket.
+type wsLogFrame struct {
+	Timestamp float64 `json:"ts"`
+	Level     int     `json:"level"`
+	Data      string  `json:"data"`
+}
+
+// streamWebsocketLog reads the debug log served by the device at host and
+// sends it to ch, reconnecting (e.g. across reboots) until ctx is done.
+func streamWebsocketLog(ctx context.Context, log logr.Logger, device string, host string, ch chan<- logEntry) {
+	u := url.URL{Scheme: "ws", Host: host, Path: "/debug/log"}
+	backoff := time.Second
+	for ctx.Err() == nil {
+		conn, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), nil)
+		if err != nil {
+			log.Error(err, "Unable to connect to debug log", "url", u.String(), "retry_in", backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, time.Minute)
+			continue
+		}
+		backoff = time.Second
+		log.Info("Streaming debug log", "url", u.String())
+
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+			case <-done:
+			}
+		}()
+		for {
+			var frame wsLogFrame
+			if err := conn.ReadJSON(&frame); err != nil {
+				if ctx.Err() == nil {
+					log.Error(err, "Debug log connection lost", "url", u.String())
+				}
+				break
+			}
+			select {
+			case ch <- logEntry{Device: device, Timestamp: frame.Timestamp, Component: noComponent, Msg: strings.TrimRight(frame.Data, "\n")}:
+			case <-ctx.Done():
+			}
+		}
+		close(done)
+		conn.Close()
+	}
+}
+
+// configureDebugLog points the device debug log at the given UDP address (nil
+// disables it) and turns the websocket log on or off, rebooting the device if
+// the change requires it.
+func configureDebugLog(ctx context.Context, log logr.Logger, via types.Channel, sd *shellyapi.Device, addr *string, websocket bool) (*system.SetConfigResponse, error) {
+	config, err := system.GetConfig(ctx, via, sd)
+	if err != nil {
+		log.Error(err, "Unable to get config", "device", sd.Id())
+		return nil, err
+	}
+	log.Info("Current config", "config", config)
+	config.RpcUdp = nil // FIXME: force no-UDP channel (otherwise tries to set dst_addr="")
+	config.Debug = &system.DeviceDebug{
+		Mqtt: system.Enabler{
+			Enable: false,
+		},
+		WebSocket: system.Enabler{
+			Enable: websocket,
+		},
+		Udp: system.EnablerUDP{
+			Address: addr,
+			Level:   4,
+		},
+	}
+	log.Info("Applying new config", "config", config)
+	res, err := system.SetConfig(ctx, via, sd, config)
+	if err != nil {
+		log.Error(err, "Unable to configure debug log", "addr", addr, "websocket", websocket)
+		return nil, err
+	}
+	log.Info("Applied new config", "config", config)
+	if res.RestartRequired {
+		log.Info("Restart required")
+		err := shelly.DoReboot(ctx, sd)
+		if err != nil {
+			log.Error(err, "Unable to restart")
+			return nil, err
+		}
+		log.Info("Restarted", "res", res)
+	}
+	options.PrintResult(res)
+
+	return res, nil
+}
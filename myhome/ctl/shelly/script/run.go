@@ -3,6 +3,8 @@ package script
 import (
 	"context"
 	"fmt"
+	"time"
+
 	"github.com/asnowfix/home-automation/pkg/shelly/script"
 
 	"github.com/spf13/cobra"
@@ -10,11 +12,29 @@ import (
 
 var runMinify bool
 var runDeviceFile string
+var runSimulateFrom string
+var runSimulateUntil string
 
 func init() {
 	Cmd.AddCommand(runCmd)
 	runCmd.Flags().BoolVar(&runMinify, "minify", false, "Minify script before running (default: false)")
 	runCmd.Flags().StringVarP(&runDeviceFile, "device-file", "D", "device.json", "Device state file (KVS and Script.storage)")
+	runCmd.Flags().StringVar(&runSimulateUntil, "simulate-until", "", "Run on a virtual clock until this local time (e.g. 2026-07-01T00:00)")
+	runCmd.Flags().StringVar(&runSimulateFrom, "simulate-from", "", "Start time of the virtual clock (default: now)")
+}
+
+// parseLocalTime parses a date & time given on the command line, in the
+// local time zone unless it has an explicit offset.
+func parseLocalTime(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.Local(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (expected e.g. 2026-07-01T00:00)", s)
 }
 
 var runCmd = &cobra.Command{
@@ -30,10 +50,23 @@ This is useful for:
 
 The script will run until interrupted with Ctrl+C.
 
+With --simulate-until, the script runs on a virtual clock instead: timers,
+schedules, Date and Shelly.getComponentStatus("sys").unixtime jump instantly to
+the next due event, and the run stops once the given time is reached. Weeks of
+timers & schedules run in seconds, with reproducible results.
+
 Note: The local execution environment provides:
 - Shelly API placeholders (Shelly.call, MQTT.subscribe, etc.)
 - Real MQTT connectivity for testing subscriptions
 - Event loop for handling async operations
+- Status handlers (Shelly.addStatusHandler) notified of the component status
+  changes, e.g. Switch.Set, and MQTT connect/disconnect/status handlers
+- The device's per-script resource limits (5 timers, 5 event & status handlers,
+  5 calls in progress, 10 MQTT subscriptions, call depth, heap): exceeding one
+  fails the run with the error the device would report (crashed or
+  out_of_memory). The heap budget follows the model of the device file's
+  "device_info" (a Plus1 without one); override the limits with a "limits"
+  object in the device file.
 - Use --verbose flag to see detailed execution logs
 
 Examples:
@@ -44,15 +77,38 @@ Examples:
   myhome ctl shelly script run heater.js --verbose
   
   # Run with minification (to test minifier)
-  myhome ctl shelly script run heater.js --minify`,
+  myhome ctl shelly script run heater.js --minify
+
+  # Simulate the pool pump schedules until July 1st
+  myhome ctl shelly script run pool-pump.js --simulate-until 2026-07-01T00:00`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		scriptName := args[0]
 
-		fmt.Printf("Running script %s locally (press Ctrl+C to stop)...\n", scriptName)
+		var clock *script.VirtualClock
+		if runSimulateUntil != "" {
+			until, err := parseLocalTime(runSimulateUntil)
+			if err != nil {
+				return err
+			}
+			from := time.Now()
+			if runSimulateFrom != "" {
+				if from, err = parseLocalTime(runSimulateFrom); err != nil {
+					return err
+				}
+			}
+			if clock, err = script.NewVirtualClock(from, until); err != nil {
+				return err
+			}
+			fmt.Printf("Simulating script %s from %s until %s...\n", scriptName, from.Format(time.RFC3339), until.Format(time.RFC3339))
+		} else if runSimulateFrom != "" {
+			return fmt.Errorf("--simulate-from requires --simulate-until")
+		} else {
+			fmt.Printf("Running script %s locally (press Ctrl+C to stop)...\n", scriptName)
+		}
 
 		// Run locally without device, with device state file
-		err := script.RunWithDeviceFile(cmd.Context(), scriptName, nil, runMinify, runDeviceFile)
+		err := script.RunWithDeviceFile(cmd.Context(), scriptName, nil, runMinify, runDeviceFile, clock)
 		if err != nil && err != context.Canceled {
 			fmt.Printf("\n✗ Script execution failed: %v\n", err)
 			return err
@@ -0,0 +1,72 @@
+package script
+
+import (
+	"fmt"
+
+	"github.com/asnowfix/home-automation/hlog"
+	mhscript "github.com/asnowfix/home-automation/internal/myhome/shelly/script"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/pkg/shelly/script"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	Cmd.AddCommand(testCmd)
+}
+
+var testCmd = &cobra.Command{
+	Use:   "test <scenario-file>...",
+	Short: "Run scripts through scenario files, locally (without a device)",
+	Long: `Run each scenario file (YAML or JSON) against its script, locally, on a
+virtual clock: the scenario gives the initial state of the device, the canned
+responses to the script's HTTP.GET requests, and the steps to play over time
+(input changes, device events, MQTT messages, status changes...) with the
+expected state of the device (component status, KVS, Script.storage, emitted
+events, published MQTT messages) at checkpoints.
+
+The script runs against an in-memory MQTT broker and never reaches the
+network: every run of a scenario gives the same result. See
+internal/shelly/scripts/testdata/scenarios for examples.
+
+Examples:
+  # Run one scenario
+  myhome ctl shelly script test internal/shelly/scripts/testdata/scenarios/heater.yaml
+
+  # Run every scenario of the pool pump, against the local pool-pump.js
+  myhome ctl shelly script test --local-scripts-dir internal/shelly/scripts internal/shelly/scripts/testdata/scenarios/pool-pump*.yaml`,
+	Args:        cobra.MinimumNArgs(1),
+	Annotations: map[string]string{options.LOCAL_ONLY_ANNOTATION: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log := hlog.Logger
+		failed := 0
+		for _, file := range args {
+			sc, err := script.LoadScenario(file)
+			if err != nil {
+				return err
+			}
+			buf, _, err := mhscript.LoadScript(log, localScriptsDirEffective(), sc.Script)
+			if err != nil {
+				return err
+			}
+			failures, err := script.RunScenario(cmd.Context(), sc, buf)
+			switch {
+			case err != nil:
+				fmt.Printf("✗ %s (%s): %v\n", file, sc.Name, err)
+				failed++
+			case len(failures) > 0:
+				fmt.Printf("✗ %s (%s)\n", file, sc.Name)
+				for _, f := range failures {
+					fmt.Printf("    %s\n", f)
+				}
+				failed++
+			default:
+				fmt.Printf("✓ %s (%s)\n", file, sc.Name)
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d scenarios failed", failed, len(args))
+		}
+		return nil
+	},
+}
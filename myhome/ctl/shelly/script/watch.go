@@ -0,0 +1,267 @@
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/asnowfix/home-automation/internal/myhome"
+	mhscript "github.com/asnowfix/home-automation/internal/myhome/shelly/script"
+	"github.com/asnowfix/home-automation/internal/tools"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/pkg/devices"
+	shellyapi "github.com/asnowfix/home-automation/pkg/shelly"
+	pkgscript "github.com/asnowfix/home-automation/pkg/shelly/script"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	Cmd.AddCommand(watchCtl)
+	watchCtl.Flags().StringVar(&watchFlags.Log, "log", "udp", "Device debug log to stream: udp, websocket or none")
+	watchCtl.Flags().IntVarP(&watchFlags.Port, "port", "p", 0, "UDP port to listen on for the udp log (default is to use dynamic port)")
+	watchCtl.Flags().DurationVar(&watchFlags.Interval, "interval", time.Second, "How often to check the script file for changes")
+	watchCtl.Flags().BoolVar(&watchFlags.NoMinify, "no-minify", false, "Do not minify the script before upload")
+	watchCtl.Flags().BoolVar(&watchFlags.Force, "force", false, "Force re-upload even if version hash matches")
+	watchCtl.Flags().StringVar(&watchFlags.SourceMap, "source-map", "", "Also write the source map of each upload to this file")
+}
+
+var watchFlags struct {
+	Log       string
+	Port      int
+	Interval  time.Duration
+	NoMinify  bool
+	Force     bool
+	SourceMap string
+}
+
+var watchCtl = &cobra.Command{
+	Use:   "watch DEVICE FILE",
+	Short: "Re-upload a local script on every change and stream the device debug log, mapped back to the script source",
+	Long: `Usage:
+
+	homectl shelly script watch <device> <file.js>
+
+	Uploads <file.js> to the device(s), then again every time the file changes,
+	using the same version check as 'script upload'. Meanwhile the device debug
+	log is streamed (over UDP by default, or the device websocket with
+	--log=websocket), and the "line N col M" positions the script engine reports
+	for the minified upload are followed by the matching ~<file.js>:line:col.
+	The map is rebuilt by aligning both texts, hence the "~": the position is
+	approximate and may be a few tokens or lines off.
+
+	Examples:
+	- homectl shelly script watch "Shelly Plus 1" ./heater.js
+	- homectl shelly script watch "Shelly Plus 1" ./heater.js --log=websocket --source-map=heater.js.map`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.ExactArgs(2)(cmd, args); err != nil {
+			return err
+		}
+		switch watchFlags.Log {
+		case "udp", "websocket", "none":
+		default:
+			return fmt.Errorf("--log must be udp, websocket or none: %q", watchFlags.Log)
+		}
+		if watchFlags.Interval <= 0 {
+			return fmt.Errorf("--interval must be positive")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		device := args[0]
+		ctx := tools.WithToken(cmd.Context())
+
+		w := &watcher{
+			path: args[1],
+			name: filepath.Base(args[1]),
+			ids:  make(map[string]uint32),
+		}
+		if _, err := os.Stat(w.path); err != nil {
+			return err
+		}
+
+		// Start streaming before the first upload, so that the script start
+		// shows in the log.
+		switch watchFlags.Log {
+		case "udp":
+			addr, entries, err := listenUDPLog(ctx, log, watchFlags.Port)
+			if err != nil {
+				return err
+			}
+			if _, err := myhome.Foreach(ctx, log, device, options.Via, doDebug, []string{addr}); err != nil {
+				return err
+			}
+			go w.printLog(ctx, entries)
+		case "websocket":
+			entries := make(chan logEntry)
+			if _, err := myhome.Foreach(ctx, log, device, options.Via, func(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+				return doWebsocketLog(ctx, log, via, device, entries)
+			}, nil); err != nil {
+				return err
+			}
+			go w.printLog(ctx, entries)
+		}
+
+		var modTime time.Time
+		ticker := time.NewTicker(watchFlags.Interval)
+		defer ticker.Stop()
+		for {
+			info, err := os.Stat(w.path)
+			if err != nil {
+				fmt.Printf("✗ %v\n", err)
+			} else if !info.ModTime().Equal(modTime) {
+				modTime = info.ModTime()
+				w.upload(ctx, device)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+// watcher holds the state shared between the upload loop and the log
+// printer: the source map of the code last uploaded, and the id the script
+// got on each device (by device id) to tell its log lines apart.
+type watcher struct {
+	path string
+	name string
+
+	mutex     sync.Mutex
+	src       []byte
+	sourceMap *pkgscript.SourceMap
+	ids       map[string]uint32
+}
+
+func (w *watcher) upload(ctx context.Context, device string) {
+	src, err := os.ReadFile(w.path)
+	if err != nil {
+		fmt.Printf("✗ %v\n", err)
+		return
+	}
+
+	var sm *pkgscript.SourceMap
+	if watchFlags.NoMinify {
+		sm = pkgscript.NewSourceMap(w.name, src, src)
+	} else if _, sm, err = pkgscript.MinifyWithSourceMap(w.name, src); err != nil {
+		// Most likely a syntax error: keep watching for the fix.
+		fmt.Printf("✗ Unable to minify %s: %v\n", w.name, err)
+		return
+	}
+	if watchFlags.SourceMap != "" {
+		buf, err := json.Marshal(sm)
+		if err == nil {
+			err = os.WriteFile(watchFlags.SourceMap, buf, 0644)
+		}
+		if err != nil {
+			fmt.Printf("✗ Unable to write source map %s: %v\n", watchFlags.SourceMap, err)
+		}
+	}
+
+	w.mutex.Lock()
+	w.src = src
+	w.sourceMap = sm
+	w.mutex.Unlock()
+
+	fmt.Printf("Uploading %s (version %s)\n", w.name, mhscript.Version(src))
+	if _, err := myhome.Foreach(ctx, log, device, options.Via, w.doUpload, nil); err != nil {
+		fmt.Printf("✗ %v\n", err)
+	}
+}
+
+func (w *watcher) doUpload(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+	sd, ok := device.(*shellyapi.Device)
+	if !ok {
+		return nil, fmt.Errorf("device is not a Shelly: %s %v", reflect.TypeOf(device), device)
+	}
+
+	w.mutex.Lock()
+	src := w.src
+	w.mutex.Unlock()
+
+	id, err := mhscript.UploadWithVersion(ctx, log, via, sd, w.name, src, !watchFlags.NoMinify, watchFlags.Force)
+	if err != nil {
+		fmt.Printf("  ✗ Failed to upload %s to %s: %v\n", w.name, sd.Name(), err)
+		return nil, err
+	}
+	if id == 0 {
+		// Skipped as up-to-date: look the id up for the log filter.
+		loaded, err := pkgscript.ListLoaded(ctx, via, sd)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range loaded {
+			if s.Name == w.name {
+				id = s.Id
+			}
+		}
+		fmt.Printf("  → %s is up-to-date on %s\n", w.name, sd.Name())
+	} else {
+		fmt.Printf("  ✓ Uploaded %s to %s (id: %d)\n", w.name, sd.Name(), id)
+	}
+
+	w.mutex.Lock()
+	w.ids[sd.Id()] = id
+	w.mutex.Unlock()
+	return id, nil
+}
+
+func (w *watcher) printLog(ctx context.Context, entries <-chan logEntry) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-entries:
+			if !ok {
+				return
+			}
+			printLogEntry(w.annotate(e))
+		}
+	}
+}
+
+// annotate maps the positions reported in e back to the watched script
+// source. Lines of other scripts are left alone; firmware lines (where the
+// script engine reports uncaught errors) and websocket lines, which carry no
+// component, are mapped.
+func (w *watcher) annotate(e logEntry) logEntry {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.sourceMap == nil {
+		return e
+	}
+	if e.Component >= 100 {
+		id, ok := w.ids[e.Device]
+		if !ok || e.Component != scriptComponent(id) {
+			return e
+		}
+	}
+	e.Msg = w.sourceMap.Annotate(e.Msg)
+	return e
+}
+
+func doWebsocketLog(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, entries chan<- logEntry) (any, error) {
+	sd, ok := device.(*shellyapi.Device)
+	if !ok {
+		return nil, fmt.Errorf("device is not a Shelly: %s %v", reflect.TypeOf(device), device)
+	}
+	res, err := configureDebugLog(ctx, log, via, sd, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	host := sd.Host()
+	if host == "" {
+		return nil, fmt.Errorf("no known IP address for %s: the websocket log needs one", sd.Name())
+	}
+	go streamWebsocketLog(ctx, log.WithName("websocket-logger"), sd.Id(), host, entries)
+	return res, nil
+}
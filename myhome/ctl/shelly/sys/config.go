@@ -19,8 +19,10 @@ import (
 )
 
 var flags struct {
-	EcoMode bool
-	Name    string
+	EcoMode    bool
+	Name       string
+	UdpPort    uint16
+	SetUdpPort bool
 }
 
 func init() {
@@ -28,6 +30,7 @@ func init() {
 
 	configCmd.Flags().BoolVarP(&flags.EcoMode, "ecomode", "E", false, "Set eco mode")
 	configCmd.Flags().StringVarP(&flags.Name, "name", "N", "", "Device name")
+	configCmd.Flags().Uint16Var(&flags.UdpPort, "rpc-udp-port", 0, "Listen for RPC requests on this UDP port, for --via udp (0 disables)")
 }
 
 var configCmd = &cobra.Command{
@@ -58,9 +61,14 @@ Examples:
   # myhome ctl shelly sys config shelly1minig3-abc123 --name "Living Room Light"
 
   # Set eco mode (not yet implemented)
-  # myhome ctl shelly sys config shelly1minig3-abc123 --ecomode`,
+  # myhome ctl shelly sys config shelly1minig3-abc123 --ecomode
+
+  # Accept RPC over UDP, then call the device that way
+  myhome ctl shelly sys config shellypro3-abc123 --rpc-udp-port 2020
+  myhome ctl --via udp --udp-port 2020 shelly status shellypro3-abc123`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		flags.SetUdpPort = cmd.Flags().Changed("rpc-udp-port")
 		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, oneDeviceConfig, options.Args(args))
 		return err
 	},
@@ -72,6 +80,14 @@ func oneDeviceConfig(ctx context.Context, log logr.Logger, via types.Channel, de
 		return nil, fmt.Errorf("device is not a Shelly: %s %v", reflect.TypeOf(device), device)
 	}
 
+	if flags.SetUdpPort {
+		out, err := system.SetRpcUdpPort(ctx, via, sd, flags.UdpPort)
+		if err != nil {
+			return nil, fmt.Errorf("unable to set RPC UDP port: %v", err)
+		}
+		return out, nil
+	}
+
 	config, err := system.GetConfig(ctx, via, sd)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get config: %v", err)
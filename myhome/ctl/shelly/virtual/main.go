@@ -0,0 +1,222 @@
+package virtual
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/asnowfix/home-automation/hlog"
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/pkg/devices"
+	"github.com/asnowfix/home-automation/pkg/shelly"
+	shellypkg "github.com/asnowfix/home-automation/pkg/shelly/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+	"github.com/asnowfix/home-automation/pkg/shelly/virtual"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+)
+
+var addFlags struct {
+	Id        int
+	Name      string
+	Min       float64
+	Max       float64
+	Options   []string
+	Persisted bool
+}
+
+func init() {
+	addCmd.Flags().IntVarP(&addFlags.Id, "id", "i", 0, fmt.Sprintf("Id of the new component, %d-%d (default: first free).", virtual.MinId, virtual.MaxId))
+	addCmd.Flags().StringVarP(&addFlags.Name, "name", "n", "", "Name of the new component.")
+	addCmd.Flags().Float64Var(&addFlags.Min, "min", 0, "Minimum value (number).")
+	addCmd.Flags().Float64Var(&addFlags.Max, "max", 0, "Maximum value (number).")
+	addCmd.Flags().StringSliceVar(&addFlags.Options, "options", nil, "Allowed values (enum).")
+	addCmd.Flags().BoolVar(&addFlags.Persisted, "persisted", false, "Keep the value across reboots.")
+
+	Cmd.AddCommand(listCmd)
+	Cmd.AddCommand(addCmd)
+	Cmd.AddCommand(deleteCmd)
+	Cmd.AddCommand(getCmd)
+	Cmd.AddCommand(setCmd)
+}
+
+var Cmd = &cobra.Command{
+	Use:   "virtual",
+	Short: "Shelly virtual components (boolean, number, text, enum & group)",
+	Args:  cobra.NoArgs,
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list <device-id>",
+	Short: "List virtual components, with their configuration and value",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doList, options.Args(args))
+		return err
+	},
+}
+
+var addCmd = &cobra.Command{
+	Use:   "add <device-id> <type>",
+	Short: "Add a virtual component",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := virtual.ParseType(args[1]); err != nil {
+			return err
+		}
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, func(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+			return doAdd(ctx, log, via, device, args, cmd)
+		}, options.Args(args))
+		return err
+	},
+}
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete <device-id> <key>",
+	Short: "Delete a virtual component, e.g. number:200",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !virtual.IsVirtual(args[1]) {
+			return fmt.Errorf("invalid virtual component key %q", args[1])
+		}
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doDelete, options.Args(args))
+		return err
+	},
+}
+
+var getCmd = &cobra.Command{
+	Use:   "get <device-id> <key>",
+	Short: "Display the value of a virtual component, e.g. boolean:200",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, _, err := virtual.ParseKey(args[1]); err != nil {
+			return err
+		}
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doGet, options.Args(args))
+		return err
+	},
+}
+
+var setCmd = &cobra.Command{
+	Use:   "set <device-id> <key> <value>",
+	Short: "Set the value of a virtual component (group members are comma-separated keys)",
+	Args:  cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		t, _, err := virtual.ParseKey(args[1])
+		if err != nil {
+			return err
+		}
+		if _, err := virtual.ParseValue(t, args[2]); err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", t, args[2], err)
+		}
+		_, err = myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doSet, options.Args(args))
+		return err
+	},
+}
+
+func shellyDevice(device devices.Device) (*shelly.Device, error) {
+	sd, ok := device.(*shelly.Device)
+	if !ok {
+		return nil, fmt.Errorf("device is not a Shelly: %s %v", reflect.TypeOf(device), device)
+	}
+	return sd, nil
+}
+
+func doList(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+	sd, err := shellyDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	res, err := sd.CallE(ctx, via, shellypkg.GetComponents.String(), &shellypkg.ComponentsRequest{
+		Include:     []string{"config", "status"},
+		DynamicOnly: true,
+	})
+	if err != nil {
+		log.Error(err, "Unable to list virtual components", "device", sd.Id())
+		return nil, err
+	}
+	comps, ok := res.(*shellypkg.ComponentsResponse)
+	if !ok {
+		return nil, fmt.Errorf("invalid components type %T (should be *ComponentsResponse)", res)
+	}
+	out := comps.Virtual
+	if out == nil {
+		out = make([]virtual.Component, 0)
+	}
+	options.PrintResult(out, sd.Name())
+	return out, nil
+}
+
+func doAdd(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string, cmd *cobra.Command) (any, error) {
+	sd, err := shellyDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	t, _ := virtual.ParseType(args[0])
+	config := &virtual.Config{}
+	if addFlags.Name != "" {
+		config.Name = &addFlags.Name
+	}
+	if cmd.Flags().Changed("min") {
+		config.Min = &addFlags.Min
+	}
+	if cmd.Flags().Changed("max") {
+		config.Max = &addFlags.Max
+	}
+	if cmd.Flags().Changed("persisted") {
+		config.Persisted = &addFlags.Persisted
+	}
+	config.Options = addFlags.Options
+
+	id, err := virtual.Add(ctx, sd, via, t, addFlags.Id, config)
+	if err != nil {
+		log.Error(err, "Unable to add virtual component", "type", t, "device", sd.Id())
+		return nil, err
+	}
+	key := virtual.Key(t, id)
+	fmt.Printf("%s: added %s\n", sd.Name(), key)
+	return key, nil
+}
+
+func doDelete(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+	sd, err := shellyDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	if err := virtual.Delete(ctx, sd, via, args[0]); err != nil {
+		log.Error(err, "Unable to delete virtual component", "key", args[0], "device", sd.Id())
+		return nil, err
+	}
+	return nil, nil
+}
+
+func doGet(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+	sd, err := shellyDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	t, id, _ := virtual.ParseKey(args[0])
+	out, err := virtual.GetStatus(ctx, sd, via, t, id)
+	if err != nil {
+		log.Error(err, "Unable to get virtual component status", "key", args[0], "device", sd.Id())
+		return nil, err
+	}
+	options.PrintResult(out, sd.Name())
+	return out, nil
+}
+
+func doSet(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+	sd, err := shellyDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	t, id, _ := virtual.ParseKey(args[0])
+	value, _ := virtual.ParseValue(t, args[1])
+	if err := virtual.Set(ctx, sd, via, t, id, value); err != nil {
+		log.Error(err, "Unable to set virtual component value", "key", args[0], "device", sd.Id())
+		return nil, err
+	}
+	return nil, nil
+}
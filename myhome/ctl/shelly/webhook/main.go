@@ -0,0 +1,185 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/asnowfix/home-automation/hlog"
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/pkg/devices"
+	"github.com/asnowfix/home-automation/pkg/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+	"github.com/asnowfix/home-automation/pkg/shelly/webhook"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+)
+
+var addFlags struct {
+	Name      string
+	Event     string
+	Cid       int
+	Urls      []string
+	Condition string
+	Disabled  bool
+}
+
+var deleteAll bool
+
+func init() {
+	addCmd.Flags().StringVarP(&addFlags.Name, "name", "n", "", "Name of the webhook.")
+	addCmd.Flags().StringVarP(&addFlags.Event, "event", "e", "", "Event that triggers the webhook, e.g. input.toggle_on (see 'webhook supported').")
+	addCmd.Flags().IntVarP(&addFlags.Cid, "cid", "c", 0, "Id of the component instance that emits the event.")
+	addCmd.Flags().StringArrayVarP(&addFlags.Urls, "url", "u", nil, "URL to call (repeatable).")
+	addCmd.Flags().StringVar(&addFlags.Condition, "condition", "", "Condition on the event, e.g. 'ev.tC > 25'.")
+	addCmd.Flags().BoolVar(&addFlags.Disabled, "disabled", false, "Create the webhook disabled.")
+	addCmd.MarkFlagRequired("name")
+	addCmd.MarkFlagRequired("event")
+	addCmd.MarkFlagRequired("url")
+
+	deleteCmd.Flags().BoolVarP(&deleteAll, "all", "A", false, "Delete all webhooks.")
+
+	Cmd.AddCommand(listCmd)
+	Cmd.AddCommand(supportedCmd)
+	Cmd.AddCommand(addCmd)
+	Cmd.AddCommand(deleteCmd)
+	Cmd.AddCommand(syncCmd)
+}
+
+var Cmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Shelly devices webhooks (a.k.a. actions)",
+	Args:  cobra.NoArgs,
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list <device-id>",
+	Short: "List webhooks",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doList, options.Args(args))
+		return err
+	},
+}
+
+var supportedCmd = &cobra.Command{
+	Use:   "supported <device-id>",
+	Short: "List the events that can trigger webhooks",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doSupported, options.Args(args))
+		return err
+	},
+}
+
+var addCmd = &cobra.Command{
+	Use:   "add <device-id>",
+	Short: "Add a webhook",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doAdd, options.Args(args))
+		return err
+	},
+}
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete <device-id> [<webhook-id>]",
+	Short: "Delete a webhook, or all of them with --all",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if deleteAll {
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		if err := cobra.ExactArgs(2)(cmd, args); err != nil {
+			return err
+		}
+		if _, err := strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("invalid webhook id %q: %w", args[1], err)
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doDelete, options.Args(args))
+		return err
+	},
+}
+
+func shellyDevice(device devices.Device) (*shelly.Device, error) {
+	sd, ok := device.(*shelly.Device)
+	if !ok {
+		return nil, fmt.Errorf("device is not a Shelly: %s %v", reflect.TypeOf(device), device)
+	}
+	return sd, nil
+}
+
+func doList(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+	sd, err := shellyDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	out, err := webhook.List(ctx, sd, via)
+	if err != nil {
+		log.Error(err, "Unable to list webhooks", "device", sd.Id())
+		return nil, err
+	}
+	options.PrintResult(out.Hooks, sd.Name())
+	return out, nil
+}
+
+func doSupported(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+	sd, err := shellyDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	out, err := webhook.ListSupported(ctx, sd, via)
+	if err != nil {
+		log.Error(err, "Unable to list supported webhook events", "device", sd.Id())
+		return nil, err
+	}
+	options.PrintResult(out.Types, sd.Name())
+	return out, nil
+}
+
+func doAdd(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+	sd, err := shellyDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	hook := &webhook.Hook{
+		Name:   addFlags.Name,
+		Event:  addFlags.Event,
+		Cid:    addFlags.Cid,
+		Urls:   addFlags.Urls,
+		Enable: !addFlags.Disabled,
+	}
+	if addFlags.Condition != "" {
+		hook.Condition = &addFlags.Condition
+	}
+	id, err := webhook.Create(ctx, sd, via, hook)
+	if err != nil {
+		log.Error(err, "Unable to add webhook", "name", hook.Name, "device", sd.Id())
+		return nil, err
+	}
+	fmt.Printf("%s: added webhook %d (%s)\n", sd.Name(), id, hook.Name)
+	return id, nil
+}
+
+func doDelete(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+	sd, err := shellyDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	if deleteAll {
+		err = webhook.DeleteAll(ctx, sd, via)
+	} else {
+		id, _ := strconv.Atoi(args[0])
+		err = webhook.Delete(ctx, sd, via, id)
+	}
+	if err != nil {
+		log.Error(err, "Unable to delete webhook", "device", sd.Id())
+		return nil, err
+	}
+	return nil, nil
+}
@@ -0,0 +1,200 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+
+	"github.com/asnowfix/home-automation/hlog"
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/pkg/devices"
+	"github.com/asnowfix/home-automation/pkg/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+	"github.com/asnowfix/home-automation/pkg/shelly/webhook"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var syncFlags struct {
+	Prune  bool
+	DryRun bool
+}
+
+func init() {
+	syncCmd.Flags().BoolVar(&syncFlags.Prune, "prune", false, "Also delete the webhooks that are not declared (e.g. configured in the web UI).")
+	syncCmd.Flags().BoolVar(&syncFlags.DryRun, "dry-run", false, "Only show the changes.")
+}
+
+// hookSpec is a declared webhook: a webhook.Hook whose enable flag defaults
+// to true.
+type hookSpec struct {
+	webhook.Hook
+	Enable *bool `json:"enable,omitempty"`
+}
+
+// SyncFile declares the webhooks of each device, by device name, id or
+// pattern:
+//
+//	devices:
+//	  front-door:
+//	    - name: porch-light-on
+//	      event: input.toggle_on
+//	      cid: 0
+//	      urls:
+//	        - http://porch-light.local/rpc/Switch.Set?id=0&on=true
+type SyncFile struct {
+	Devices map[string][]hookSpec `json:"devices"`
+}
+
+// LoadSyncFile reads and parses a webhooks declaration (YAML or JSON).
+func LoadSyncFile(path string) (map[string][]webhook.Hook, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f SyncFile
+	if err := yaml.UnmarshalStrict(buf, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	out := make(map[string][]webhook.Hook, len(f.Devices))
+	for device, specs := range f.Devices {
+		hooks := make([]webhook.Hook, 0, len(specs))
+		for _, s := range specs {
+			h := s.Hook
+			h.Enable = s.Enable == nil || *s.Enable
+			hooks = append(hooks, h)
+		}
+		out[device] = hooks
+	}
+	return out, nil
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync <file>",
+	Short: "Reconcile the webhooks of devices with a declarative YAML file",
+	Long: `Reconcile the webhooks of devices with a declarative YAML file.
+
+Webhooks are matched by name: missing ones are created and changed ones are
+updated. Webhooks with an undeclared name are kept, unless --prune is given.
+A device matched by several entries gets the webhooks of all of them, and
+--prune only deletes the webhooks none of them declares.
+
+Example file:
+
+  devices:
+    front-door:
+      - name: porch-light-on
+        event: input.toggle_on
+        cid: 0
+        urls:
+          - http://porch-light.local/rpc/Switch.Set?id=0&on=true
+      - name: porch-light-off
+        event: input.toggle_off
+        cid: 0
+        urls:
+          - http://porch-light.local/rpc/Switch.Set?id=0&on=false`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		declared, err := LoadSyncFile(args[0])
+		if err != nil {
+			return err
+		}
+		patterns := make([]string, 0, len(declared))
+		for p := range declared {
+			patterns = append(patterns, p)
+		}
+		sort.Strings(patterns)
+
+		// Resolve every pattern before syncing, so that a device matched by
+		// several patterns is synced (and pruned) once, against all of them.
+		matches := make(map[string][]string, len(patterns))
+		var targets []devices.Device
+		for _, p := range patterns {
+			found, err := myhome.TheClient.LookupDevices(cmd.Context(), p)
+			if err != nil {
+				return err
+			}
+			for _, device := range *found {
+				if device.Id() == "" {
+					hlog.Logger.Info("Skipping device with no ID yet", "pattern", p, "name", device.Name())
+					continue
+				}
+				if !slices.ContainsFunc(targets, func(t devices.Device) bool { return t.Id() == device.Id() }) {
+					targets = append(targets, device)
+				}
+				matches[p] = append(matches[p], device.Id())
+			}
+		}
+		desired, err := desiredHooks(declared, matches)
+		if err != nil {
+			return err
+		}
+
+		_, err = shelly.Foreach(cmd.Context(), hlog.Logger, targets, options.Via, func(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
+			return doSync(ctx, log, via, device, desired[device.Id()])
+		}, nil)
+		return err
+	},
+}
+
+// desiredHooks merges the webhooks declared by pattern into the webhooks of
+// each device, by device id, given the ids of the devices each pattern
+// matches. A webhook declared by several patterns matching the same device
+// must be declared identically.
+func desiredHooks(declared map[string][]webhook.Hook, matches map[string][]string) (map[string][]webhook.Hook, error) {
+	patterns := make([]string, 0, len(matches))
+	for p := range matches {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+
+	desired := make(map[string][]webhook.Hook)
+	from := make(map[string]map[string]string) // Pattern declaring each webhook, by device id and webhook name
+	for _, p := range patterns {
+		for _, id := range matches[p] {
+			if from[id] == nil {
+				from[id] = make(map[string]string)
+			}
+			for _, h := range declared[p] {
+				prev, dup := from[id][h.Name]
+				if !dup {
+					from[id][h.Name] = p
+					desired[id] = append(desired[id], h)
+					continue
+				}
+				if prev == p {
+					return nil, fmt.Errorf("webhook %q is declared twice by %q", h.Name, p)
+				}
+				i := slices.IndexFunc(desired[id], func(d webhook.Hook) bool { return d.Name == h.Name })
+				if !reflect.DeepEqual(desired[id][i], h) {
+					return nil, fmt.Errorf("webhook %q of device %s is declared differently by %q and %q", h.Name, id, prev, p)
+				}
+			}
+		}
+	}
+	return desired, nil
+}
+
+func doSync(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, hooks []webhook.Hook) (any, error) {
+	sd, err := shellyDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := webhook.Sync(ctx, log, sd, via, hooks, syncFlags.Prune, syncFlags.DryRun)
+	if err != nil {
+		log.Error(err, "Unable to sync webhooks", "device", sd.Id())
+		return nil, err
+	}
+	if plan.Empty() {
+		fmt.Printf("%s: webhooks up to date\n", sd.Name())
+		return plan, nil
+	}
+	options.PrintResult(plan, sd.Name())
+	return plan, nil
+}
@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/webhook"
+)
+
+func TestLoadSyncFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.yaml")
+	data := `devices:
+  front-door:
+    - name: porch-light-on
+      event: input.toggle_on
+      cid: 0
+      urls:
+        - http://porch-light.local/rpc/Switch.Set?id=0&on=true
+    - name: porch-light-off
+      event: input.toggle_off
+      enable: false
+      urls:
+        - http://porch-light.local/rpc/Switch.Set?id=0&on=false
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	declared, err := LoadSyncFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hooks := declared["front-door"]
+	if len(hooks) != 2 {
+		t.Fatalf("expected 2 webhooks, got %+v", declared)
+	}
+	if hooks[0].Name != "porch-light-on" || hooks[0].Event != "input.toggle_on" || !hooks[0].Enable || len(hooks[0].Urls) != 1 {
+		t.Errorf("unexpected first webhook %+v", hooks[0])
+	}
+	if hooks[1].Enable {
+		t.Errorf("expected the second webhook disabled, got %+v", hooks[1])
+	}
+
+	if err := os.WriteFile(path, []byte("devices:\n  x:\n    - name: a\n      evnt: typo\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSyncFile(path); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestDesiredHooks_OverlappingPatterns(t *testing.T) {
+	on := webhook.Hook{Name: "porch-light-on", Event: "input.toggle_on", Enable: true}
+	off := webhook.Hook{Name: "porch-light-off", Event: "input.toggle_off", Enable: true}
+	alarm := webhook.Hook{Name: "alarm", Event: "input.button_push", Enable: true}
+	declared := map[string][]webhook.Hook{
+		"front-*":    {on, off},
+		"front-door": {alarm, on},
+	}
+	matches := map[string][]string{
+		"front-*":    {"shellyplus1-door", "shellyplus1-gate"},
+		"front-door": {"shellyplus1-door"},
+	}
+
+	desired, err := desiredHooks(declared, matches)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	door := desired["shellyplus1-door"]
+	if len(door) != 3 || door[0].Name != "porch-light-on" || door[1].Name != "porch-light-off" || door[2].Name != "alarm" {
+		t.Errorf("expected the webhooks of both patterns on the door, got %+v", door)
+	}
+	if gate := desired["shellyplus1-gate"]; len(gate) != 2 {
+		t.Errorf("expected the webhooks of front-* only on the gate, got %+v", gate)
+	}
+
+	// Pruning the door against its merged declaration keeps every declared webhook
+	current := []webhook.Hook{{Id: 1, Name: "porch-light-on", Event: "input.toggle_on", Enable: true}, {Id: 2, Name: "alarm", Event: "input.button_push", Enable: true}, {Id: 3, Name: "manual"}}
+	plan, err := webhook.Diff(current, door, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Delete) != 1 || plan.Delete[0].Name != "manual" {
+		t.Errorf("expected only the undeclared webhook pruned, got %+v", plan.Delete)
+	}
+
+	conflicting := map[string][]webhook.Hook{
+		"front-*":    {on},
+		"front-door": {{Name: "porch-light-on", Event: "input.toggle_off", Enable: true}},
+	}
+	if _, err := desiredHooks(conflicting, matches); err == nil {
+		t.Error("expected an error for a webhook declared differently by two patterns")
+	}
+	twice := map[string][]webhook.Hook{"front-*": {on, on}}
+	if _, err := desiredHooks(twice, matches); err == nil {
+		t.Error("expected an error for a webhook declared twice by a pattern")
+	}
+}
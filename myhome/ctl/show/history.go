@@ -0,0 +1,77 @@
+package show
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/spf13/cobra"
+)
+
+var historyFlags struct {
+	History bool
+	Path    string
+	Limit   int
+}
+
+func showHistory(cmd *cobra.Command, identifier string) error {
+	out, err := myhome.TheClient.CallE(cmd.Context(), myhome.DeviceHistory, &myhome.DeviceHistoryParams{
+		Identifier: identifier,
+		Path:       historyFlags.Path,
+		Limit:      historyFlags.Limit,
+	})
+	if err != nil {
+		return err
+	}
+	res := out.(*myhome.DeviceHistoryResult)
+	if options.Flags.Json {
+		s, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(s))
+		return nil
+	}
+
+	if len(res.Entries) == 0 {
+		fmt.Println("No history found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSOURCE\tBY\tREVISION\tCHANGE")
+	fmt.Fprintln(w, "----\t------\t--\t--------\t------")
+	for _, e := range res.Entries {
+		ts := e.Ts.Local().Format("2006-01-02 15:04:05")
+		by := e.Principal
+		if by == "" {
+			by = "-"
+		}
+		revision := fmt.Sprintf("%d→%d", e.OldRevision, e.NewRevision)
+		if len(e.Changes) == 0 {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", ts, e.Source, by, revision, "(revision only)")
+			continue
+		}
+		for _, c := range e.Changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s: %s → %s\n", ts, e.Source, by, revision, c.Path, value(c.Old), value(c.New))
+		}
+	}
+	w.Flush()
+	return nil
+}
+
+// value shortens a changed JSON value for the table; absent values are
+// shown as "-".
+func value(v json.RawMessage) string {
+	if len(v) == 0 {
+		return "-"
+	}
+	s := string(v)
+	if len(s) > 40 {
+		s = s[:37] + "..."
+	}
+	return s
+}
@@ -16,15 +16,29 @@ import (
 func init() {
 	Cmd.AddCommand(showShellyCmd)
 	Cmd.AddCommand(showTapoCmd)
+	Cmd.Flags().BoolVar(&historyFlags.History, "history", false, "Show the history of the device's stored config & info instead")
+	Cmd.Flags().StringVar(&historyFlags.Path, "path", "", "With --history: only changes at or under this path, e.g. config.mqtt")
+	Cmd.Flags().IntVar(&historyFlags.Limit, "limit", 100, "With --history: maximum number of changes")
 }
 
 var Cmd = &cobra.Command{
 	Use:   "show",
 	Short: "Show devices",
-	Args:  cobra.ExactArgs(1),
+	Long: `Show a device as stored by the daemon.
+
+With --history, show who changed its stored config or info, when, and how.
+
+Examples:
+  myhome ctl show pool-pump
+  myhome ctl show --history --path config.mqtt.server pool-pump`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		log := hlog.Logger
 
+		if historyFlags.History {
+			return showHistory(cmd, args[0])
+		}
+
 		out, err := myhome.TheClient.CallE(cmd.Context(), myhome.DeviceShow, &myhome.DeviceShowParams{Identifier: args[0]})
 		if err != nil {
 			return err
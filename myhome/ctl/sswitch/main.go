@@ -3,12 +3,15 @@ package sswitch
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/asnowfix/home-automation/hlog"
 	"github.com/asnowfix/home-automation/internal/myhome"
 	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	mqttclient "github.com/asnowfix/home-automation/myhome/mqtt"
 	"github.com/asnowfix/home-automation/pkg/devices"
 	"github.com/asnowfix/home-automation/pkg/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/gen1"
 	shellypkg "github.com/asnowfix/home-automation/pkg/shelly/shelly"
 	"github.com/asnowfix/home-automation/pkg/shelly/sswitch"
 	"github.com/asnowfix/home-automation/pkg/shelly/types"
@@ -44,7 +47,7 @@ var toggleCmd = &cobra.Command{
 	Short: "Toggle device switch",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doSwitchOneDevice, []string{"toggle"})
+		_, err := foreach(cmd.Context(), args[0], "toggle")
 		return err
 	},
 }
@@ -54,7 +57,7 @@ var onCmd = &cobra.Command{
 	Short: "Turn device switch on",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doSwitchOneDevice, []string{"on"})
+		_, err := foreach(cmd.Context(), args[0], "on")
 		return err
 	},
 }
@@ -64,7 +67,7 @@ var offCmd = &cobra.Command{
 	Short: "Turn device switch off",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		_, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doSwitchOneDevice, []string{"off"})
+		_, err := foreach(cmd.Context(), args[0], "off")
 		return err
 	},
 }
@@ -74,7 +77,7 @@ var statusCmd = &cobra.Command{
 	Short: "Display device switch status",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		out, err := myhome.Foreach(cmd.Context(), hlog.Logger, args[0], options.Via, doSwitchOneDevice, []string{"status"})
+		out, err := foreach(cmd.Context(), args[0], "status")
 		if err != nil {
 			return err
 		}
@@ -92,8 +95,59 @@ var statusCmd = &cobra.Command{
 	},
 }
 
+// foreach runs op on every device matching name. Gen1 devices, that
+// shelly.Foreach skips, are driven through their own HTTP & MQTT API.
+func foreach(ctx context.Context, name string, op string) (any, error) {
+	found, err := myhome.TheClient.LookupDevices(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var others []devices.Device
+	var out []any
+	var errs []error
+	for _, device := range *found {
+		if !shelly.IsGen1Device(device.Id()) {
+			others = append(others, device)
+			continue
+		}
+		one, err := doSwitchOneDevice(ctx, hlog.Logger, options.Via, newGen1Device(ctx, device), []string{op})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("device %s: %w", device.Id(), err))
+			continue
+		}
+		out = append(out, one)
+	}
+
+	if len(others) > 0 {
+		res, err := shelly.Foreach(ctx, hlog.Logger, others, options.Via, doSwitchOneDevice, []string{op})
+		if res, ok := res.([]any); ok {
+			out = append(out, res...)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return out, errors.Join(errs...)
+}
+
+// newGen1Device returns the Gen1 device to control over HTTP if its host is
+// known, or else over MQTT.
+func newGen1Device(ctx context.Context, device devices.Device) *gen1.Shelly {
+	var mc mqttclient.Client
+	if device.Host() == "" {
+		mc, _ = mqttclient.GetClientE(ctx)
+	}
+	gd := gen1.NewShelly(device.Id(), device.Host(), mc)
+	gd.UpdateName(device.Name())
+	if device.Mac() != nil {
+		gd.UpdateMac(device.Mac().String())
+	}
+	return gd
+}
+
 func doSwitchOneDevice(ctx context.Context, log logr.Logger, via types.Channel, device devices.Device, args []string) (any, error) {
-	sd, ok := device.(*shelly.Device)
+	sd, ok := device.(types.Device)
 	if !ok {
 		return nil, fmt.Errorf("device is not a Shelly: %s %v", reflect.TypeOf(device), device)
 	}
@@ -102,6 +156,9 @@ func doSwitchOneDevice(ctx context.Context, log logr.Logger, via types.Channel,
 	var err error
 
 	if switchAll {
+		if gd, ok := sd.(*gen1.Shelly); ok {
+			return gd.GetSwitchesSummary(ctx)
+		}
 		return shellypkg.GetSwitchesSummary(ctx, sd)
 	}
 
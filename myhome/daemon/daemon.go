@@ -2,6 +2,7 @@ package daemon
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof"
@@ -26,6 +27,8 @@ import (
 	"github.com/asnowfix/home-automation/myhome/notify"
 	"github.com/asnowfix/home-automation/myhome/occupancy"
 	"github.com/asnowfix/home-automation/myhome/storage"
+	"github.com/asnowfix/home-automation/myhome/storage/backup"
+	"github.com/asnowfix/home-automation/myhome/storage/migrate"
 	"github.com/asnowfix/home-automation/myhome/temperature"
 	beem "github.com/asnowfix/home-automation/pkg/beem"
 	"github.com/asnowfix/home-automation/pkg/shelly"
@@ -155,7 +158,7 @@ func (d *daemon) Run() error {
 	}
 	defer mc.Close()
 
-	shelly.Init(log, mc, options.Flags.MqttTimeout, options.Flags.ShellyRateLimit)
+	shelly.Init(log, mc, options.Flags.MqttTimeout, options.Flags.ShellyRateLimit, options.Flags.ShellyUdpPort)
 
 	// Start the main HTTP server (as a Mux), given to every other servers started below
 	// mux := http.NewServeMux()
@@ -297,8 +300,12 @@ func (d *daemon) Run() error {
 		// broadcast, both have long since been wired up.
 		var noticeSvc *notice.Service
 		var poolNotices *PoolNotices
+		// RPC subscribers are notified in the background, off the broadcast
+		// path: a slow subscriber never holds back the dashboard.
+		notifier := myhome.NewNotifier(d.ctx, log.WithName("notify"), 256)
 		broadcastFn := func(e events.Event) {
 			sseBroadcaster.BroadcastEvent(e)
+			notifier.Notify(myhome.NotifyEvent, eventView(e))
 			if noticeSvc != nil {
 				noticeSvc.OnEvent(d.ctx, e)
 			}
@@ -307,7 +314,11 @@ func (d *daemon) Run() error {
 
 		if options.Flags.EnableEventsService {
 			eventsStore, err = events.NewStorage(log.WithName("events"), options.Flags.EventsDBPath)
-			if err != nil {
+			if errors.Is(err, migrate.ErrFutureSchema) {
+				// Fatal: a newer myhome wrote this database, do not touch it
+				log.Error(err, "Refusing to open events storage", "path", options.Flags.EventsDBPath)
+				return err
+			} else if err != nil {
 				log.Error(err, "Failed to initialize events storage", "path", options.Flags.EventsDBPath)
 				// Non-fatal: continue without event recording
 				eventsStore = nil
@@ -322,6 +333,18 @@ func (d *daemon) Run() error {
 			log.Info("Events service disabled")
 		}
 
+		// Scheduled snapshots of the databases (VACUUM INTO, on connections
+		// of their own), with rotation
+		if options.Flags.SnapshotInterval > 0 {
+			sources := []backup.Source{{Name: "myhome", Path: "myhome.db"}}
+			if eventsStore != nil {
+				sources = append(sources, backup.Source{Name: "events", Path: options.Flags.EventsDBPath})
+			}
+			snapshots := backup.NewScheduler(log, options.Flags.SnapshotDir, options.Flags.SnapshotInterval, options.Flags.SnapshotKeep, sources...)
+			go snapshots.Start(d.ctx)
+			log.Info("Database snapshots scheduled", "dir", options.Flags.SnapshotDir, "interval", options.Flags.SnapshotInterval, "keep", options.Flags.SnapshotKeep)
+		}
+
 		// Start the notice service (curated "notice"-severity events + daily
 		// email digest) if enabled. Requires both the events service (to
 		// record derived motion notices and query the digest) and the
@@ -449,7 +472,10 @@ func (d *daemon) Run() error {
 		}
 
 		// Start device manager
-		d.dm = impl.NewDeviceManager(d.ctx, storage, resolver, mc, sseBroadcaster)
+		// Device updates reach the dashboard (SSE) and device.watch RPC
+		// subscribers alike.
+		deviceBroadcaster := &notifyingBroadcaster{SSEBroadcaster: sseBroadcaster, notifier: notifier}
+		d.dm = impl.NewDeviceManager(d.ctx, storage, resolver, mc, deviceBroadcaster)
 		d.dm.WithEventService(eventsSvc, eventsTracker)
 		err = d.dm.Start(d.ctx)
 		if err != nil {
@@ -464,6 +490,15 @@ func (d *daemon) Run() error {
 			go gen2Listener.Start(d.ctx)
 			log.Info("Gen2 event listener started")
 		}
+		if options.Flags.WebsocketWatch {
+			go watchWebsockets(d.ctx, log.WithName("websocket"), d.dm, options.Flags.RefreshInterval)
+		}
+
+		// Authenticate RPC callers before serving any request
+		if err := configureRpcAuth(log.WithName("rpc"), eventsSvc); err != nil {
+			log.Error(err, "Invalid RPC authentication configuration")
+			return err
+		}
 
 		// Start the main RPC server
 		d.rpc, err = myhome.NewServerE(d.ctx, mc, d.dm)
@@ -493,20 +528,32 @@ func (d *daemon) Run() error {
 				}
 				views := make([]myhome.EventView, len(rows))
 				for i, e := range rows {
-					views[i] = myhome.EventView{
-						ID:         e.ID,
-						Ts:         e.Ts,
-						ReceivedAt: e.ReceivedAt,
-						DeviceID:   e.DeviceID,
-						Component:  e.Component,
-						Event:      e.Event,
-						Severity:   e.Severity,
-						Data:       e.Data,
-					}
+					views[i] = eventView(e)
 				}
 				return &myhome.EventListResponse{Events: views, Total: len(views)}, nil
 			})
 			log.Info("EventList RPC handler registered")
+
+			myhome.RegisterMethodHandler(myhome.EventRecord, func(ctx context.Context, in any) (any, error) {
+				req, ok := in.(*myhome.EventRecordRequest)
+				if !ok {
+					return nil, fmt.Errorf("unexpected param type: %T", in)
+				}
+				if err := req.Validate(); err != nil {
+					return nil, err
+				}
+				severity := req.Severity
+				if severity == "" {
+					severity = "info"
+				}
+				return nil, eventsSvc.Record(ctx, events.Event{
+					DeviceID:  req.DeviceID,
+					Component: req.Component,
+					Event:     req.Event,
+					Severity:  severity,
+					Data:      req.Data,
+				})
+			})
 		}
 
 		// Register Temperature RPC methods if enabled
@@ -82,6 +82,7 @@ func (f *fakeKVSDevice) StopDialog(ctx context.Context, id uint32)
 func (f *fakeKVSDevice) IsHttpReady() bool                                            { return false }
 func (f *fakeKVSDevice) IsMqttReady() bool                                            { return true }
 func (f *fakeKVSDevice) Channel(ctx context.Context, via types.Channel) types.Channel { return via }
+func (f *fakeKVSDevice) ResolveHost(ctx context.Context) bool                         { return false }
 func (f *fakeKVSDevice) UpdateName(name string)                                       {}
 func (f *fakeKVSDevice) UpdateHost(host string)                                       {}
 func (f *fakeKVSDevice) ClearHost()                                                   {}
@@ -0,0 +1,59 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/ctl/options"
+	"github.com/asnowfix/home-automation/myhome/events"
+	"github.com/go-logr/logr"
+)
+
+// configureRpcAuth installs the RPC tokens from options.Flags, and records
+// every rejected RPC request as an "rpc.denied" notice event (or only logs
+// it, when the events service is not running).
+func configureRpcAuth(log logr.Logger, eventsSvc *events.Service) error {
+	tokens, err := myhome.ParseTokens(options.Flags.RpcTokens)
+	if err != nil {
+		return err
+	}
+	anonymous, err := myhome.ParseRole(options.Flags.RpcAnonymousRole)
+	if err != nil {
+		return err
+	}
+	if err := myhome.ConfigureAuth(tokens, anonymous); err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		log.Info("WARNING: RPC authentication disabled (no MYHOME_RPC_TOKENS): every caller is admin")
+	} else {
+		log.Info("RPC authentication enabled", "tokens", len(tokens), "anonymous_role", anonymous)
+	}
+
+	myhome.OnAuthDenied(func(ctx context.Context, d myhome.Denial) {
+		log.Info("RPC request denied", "principal", d.Principal, "role", d.Role, "src", d.Src, "method", d.Method, "reason", d.Reason)
+		if eventsSvc == nil {
+			return
+		}
+		data, err := json.Marshal(d)
+		if err != nil {
+			log.Error(err, "Failed to marshal RPC denial")
+			return
+		}
+		str := string(data)
+		ev := events.Event{
+			Ts:        float64(time.Now().Unix()),
+			DeviceID:  myhome.InstanceName,
+			Component: "rpc",
+			Event:     "rpc.denied",
+			Severity:  "notice",
+			Data:      &str,
+		}
+		if err := eventsSvc.Record(context.WithoutCancel(ctx), ev); err != nil {
+			log.Error(err, "Failed to record RPC denial")
+		}
+	})
+	return nil
+}
@@ -0,0 +1,54 @@
+package daemon
+
+import (
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/internal/myhome/ui"
+	"github.com/asnowfix/home-automation/myhome/devices/impl"
+	"github.com/asnowfix/home-automation/myhome/events"
+)
+
+// eventView converts a stored event into its RPC view, shared by the
+// event.list handler and NotifyEvent frames.
+func eventView(e events.Event) myhome.EventView {
+	return myhome.EventView{
+		ID:         e.ID,
+		Ts:         e.Ts,
+		ReceivedAt: e.ReceivedAt,
+		DeviceID:   e.DeviceID,
+		Component:  e.Component,
+		Event:      e.Event,
+		Severity:   e.Severity,
+		Data:       e.Data,
+	}
+}
+
+// notifyingBroadcaster decorates the UI's SSE broadcaster so that every
+// sensor and device update pushed to the dashboard is also pushed, as a
+// NotifyDevice frame, to device.watch subscribers on the myhome RPC bus. The
+// notifier publishes in the background: the dashboard never waits for the
+// bus.
+type notifyingBroadcaster struct {
+	impl.SSEBroadcaster
+	notifier *myhome.Notifier
+}
+
+func (b *notifyingBroadcaster) BroadcastSensorUpdate(deviceID string, sensor string, value string) {
+	b.SSEBroadcaster.BroadcastSensorUpdate(deviceID, sensor, value)
+	b.notify(myhome.DeviceNotification{DeviceID: deviceID, Sensor: sensor, Value: value})
+}
+
+func (b *notifyingBroadcaster) BroadcastDeviceUpdate(dv ui.DeviceView) {
+	b.SSEBroadcaster.BroadcastDeviceUpdate(dv)
+	b.notify(myhome.DeviceNotification{
+		DeviceID: dv.Id,
+		Name:     dv.Name,
+		Switches: dv.Switches,
+		Covers:   dv.Covers,
+		Lights:   dv.Lights,
+		Meters:   dv.Meters,
+	})
+}
+
+func (b *notifyingBroadcaster) notify(n myhome.DeviceNotification) {
+	b.notifier.Notify(myhome.NotifyDevice, n)
+}
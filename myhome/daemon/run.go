@@ -69,12 +69,18 @@ func init() {
 	runCmd.PersistentFlags().IntVar(&options.Flags.MetricsExporterPort, "metrics-exporter-port", options.PROMETHEUS_DEFAULT_PORT, "Prometheus metrics exporter HTTP port")
 	runCmd.PersistentFlags().StringVar(&options.Flags.MetricsExporterTopic, "metrics-exporter-topic", "shelly/metrics", "MQTT topic for Shelly device metrics")
 	runCmd.PersistentFlags().BoolVar(&disableAutoSetup, "disable-auto-setup", false, "Disable automatic configuration of newly discovered unknown devices")
+	runCmd.PersistentFlags().Uint16Var(&options.Flags.ShellyUdpPort, "udp-port", 0, "UDP port Shelly devices listen on for RPC (Sys rpc_udp.listen_port), for calls over UDP")
+	runCmd.PersistentFlags().BoolVar(&options.Flags.WebsocketWatch, "websocket-watch", false, "Keep a WebSocket connection to every known Gen2+ Shelly, to receive their notifications without the MQTT broker")
 	runCmd.PersistentFlags().DurationVar(&options.Flags.ReconcileInterval, "reconcile-interval", options.RECONCILE_DEFAULT_INTERVAL, "Interval for re-applying canonical MQTT broker/NTP/Matter config to known devices over HTTP (0 to disable)")
+	runCmd.PersistentFlags().StringVar(&options.Flags.FleetFile, "fleet-file", "", "Fleet file (see 'myhome ctl fleet') whose drift is reported as events at each reconciliation")
 	runCmd.PersistentFlags().BoolVar(&options.Flags.NoMdnsPublish, "no-mdns-publish", false, "Disable mDNS/Zeroconf publishing (useful for dev instances)")
 	runCmd.PersistentFlags().StringVarP(&options.Flags.InstanceName, "instance", "I", "myhome", "Server instance name for RPC topics (default: myhome)")
 	runCmd.PersistentFlags().StringVar(&options.Flags.EventsDBPath, "events-db", defaultEventsDBPath(), "Path to the events SQLite database")
 	runCmd.PersistentFlags().DurationVar(&options.Flags.EventsRetention, "events-retention", 90*24*time.Hour, "Retention period for event records (default 90 days)")
 	runCmd.PersistentFlags().BoolVar(&disableEventsService, "disable-events-service", false, "Disable the event recording service")
+	runCmd.PersistentFlags().StringVar(&options.Flags.SnapshotDir, "snapshot-dir", "snapshots", "Directory of the scheduled database snapshots")
+	runCmd.PersistentFlags().DurationVar(&options.Flags.SnapshotInterval, "snapshot-interval", 0, "Interval between scheduled snapshots of the databases (0 to disable)")
+	runCmd.PersistentFlags().IntVar(&options.Flags.SnapshotKeep, "snapshot-keep", options.SNAPSHOT_DEFAULT_KEEP, "Number of scheduled snapshots kept per database")
 	runCmd.PersistentFlags().StringVar(&options.Flags.RemoteProxy, "remote-proxy", "", "Forward /devices/... requests to a remote myhome daemon (e.g. http://home-pi:6080) instead of connecting directly")
 	runCmd.PersistentFlags().DurationVar(&options.Flags.SolarStaleAfter, "solar-stale-after", options.SOLAR_STALE_AFTER, "Solar aggregator: exclude a source's reading from the total once it is older than this")
 	runCmd.PersistentFlags().StringVar(&options.Flags.PoolDeviceID, "pool-device-id", "", "Pool Shelly device ID")
@@ -144,6 +150,12 @@ var runCmd = &cobra.Command{
 		if v.IsSet("daemon.mqtt_timeout") && !cmd.Flags().Changed("mqtt-timeout") {
 			options.Flags.MqttTimeout = v.GetDuration("daemon.mqtt_timeout")
 		}
+		if v.IsSet("daemon.websocket_watch") && !cmd.Flags().Changed("websocket-watch") {
+			options.Flags.WebsocketWatch = v.GetBool("daemon.websocket_watch")
+		}
+		if v.IsSet("daemon.udp_port") && !cmd.Flags().Changed("udp-port") {
+			options.Flags.ShellyUdpPort = uint16(v.GetUint("daemon.udp_port"))
+		}
 		if v.IsSet("daemon.mqtt_grace") && !cmd.Flags().Changed("mqtt-grace") {
 			options.Flags.MqttGrace = v.GetDuration("daemon.mqtt_grace")
 		}
@@ -165,6 +177,9 @@ var runCmd = &cobra.Command{
 		if v.IsSet("daemon.reconcile_interval") && !cmd.Flags().Changed("reconcile-interval") {
 			options.Flags.ReconcileInterval = v.GetDuration("daemon.reconcile_interval")
 		}
+		if v.IsSet("daemon.fleet_file") && !cmd.Flags().Changed("fleet-file") {
+			options.Flags.FleetFile = v.GetString("daemon.fleet_file")
+		}
 		if v.IsSet("daemon.events_dir") && !cmd.Flags().Changed("events-dir") {
 			options.Flags.EventsDir = v.GetString("daemon.events_dir")
 		}
@@ -247,6 +262,17 @@ var runCmd = &cobra.Command{
 			}
 		}
 
+		// Handle scheduled database snapshots config from viper / flags
+		if v.IsSet("db.snapshot_dir") && !cmd.Flags().Changed("snapshot-dir") {
+			options.Flags.SnapshotDir = v.GetString("db.snapshot_dir")
+		}
+		if v.IsSet("db.snapshot_interval") && !cmd.Flags().Changed("snapshot-interval") {
+			options.Flags.SnapshotInterval = v.GetDuration("db.snapshot_interval")
+		}
+		if v.IsSet("db.snapshot_keep") && !cmd.Flags().Changed("snapshot-keep") {
+			options.Flags.SnapshotKeep = v.GetInt("db.snapshot_keep")
+		}
+
 		// Handle notice service config from viper / flags. Unlike events/
 		// occupancy/temperature, notice is not auto-enabled with the device
 		// manager — it depends on both of those already being enabled and
@@ -280,6 +306,16 @@ var runCmd = &cobra.Command{
 		options.Flags.SMTPFrom = v.GetString("smtp.from")
 		options.Flags.SMTPTo = v.GetString("smtp.to")
 
+		// RPC tokens are credentials too: MYHOME_RPC_TOKENS, never a flag.
+		// The anonymous role only applies once at least one token is set.
+		options.Flags.RpcTokens = v.GetString("rpc.tokens")
+		options.Flags.RpcAnonymousRole = v.GetString("rpc.anonymous_role")
+
+		// Shelly device passwords, likewise: MYHOME_SHELLY_PASSWORDS. Devices
+		// whose password was set with "ctl shelly auth set" are also found in
+		// the device DB.
+		options.Flags.ShellyPasswords = v.GetString("shelly.passwords")
+
 		// Handle pool runtime tracker config from viper / flags
 		if v.IsSet("pool.device_id") && !cmd.Flags().Changed("pool-device-id") {
 			options.Flags.PoolDeviceID = v.GetString("pool.device_id")
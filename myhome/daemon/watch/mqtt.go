@@ -11,6 +11,7 @@ import (
 	mqttclient "github.com/asnowfix/home-automation/myhome/mqtt"
 	"os"
 	"path/filepath"
+	"strings"
 	shellyapi "github.com/asnowfix/home-automation/pkg/shelly"
 	"github.com/asnowfix/home-automation/pkg/shelly/kvs"
 	shellymqtt "github.com/asnowfix/home-automation/pkg/shelly/mqtt"
@@ -76,54 +77,76 @@ func mqttWatcher(ctx context.Context, log logr.Logger, topic string, dm devices.
 				}
 			}
 
-			event := &shellymqtt.Event{}
-			err := json.Unmarshal(msg.Payload(), &event)
-			if err != nil {
-				log.Error(err, "Failed to unmarshal event from payload", "payload", string(msg.Payload()))
-				continue
-			}
-			if event.Src[:6] != "shelly" {
-				log.Info("Skipping non-shelly event", "event", event)
-				continue
-			}
+			handleEvent(ctx, log, dm, dr, msg.Payload())
+		}
+	}
+}
 
-			deviceId := event.Src
-			device, err := dr.GetDeviceById(ctx, deviceId)
-			if err != nil {
-				log.Info("Device not found from DB, creating new one", "device_id", deviceId)
-				sd, err := shellyapi.NewDeviceFromMqttId(ctx, log, deviceId)
-				if err != nil {
-					log.Error(err, "Failed to create device from shelly device", "device_id", deviceId)
-					continue
-				}
-				device, err = myhome.NewDeviceFromImpl(ctx, log, sd)
-				if err != nil {
-					log.Error(err, "Failed to create device from shelly device", "device_id", deviceId)
-					continue
-				}
-			} else {
-				log.Info("Found device in DB", "device", device.DeviceSummary)
-				if device.Impl() == nil {
-					log.Info("Loading device details in memory", "device", device.DeviceSummary)
-					sd, err := shellyapi.NewDeviceFromSummary(ctx, log, device)
-					if err != nil {
-						log.Error(err, "Failed to create device from summary", "device", device.DeviceSummary)
-						continue
-					}
-					device = device.WithImpl(sd)
-				}
-			}
+// StartWebsocketWatcher applies the notifications pushed by the devices
+// watched over WebSocket (see shelly.WatchWebsocket) to the device manager,
+// as StartMqttWatcher does for those received over MQTT.
+func StartWebsocketWatcher(ctx context.Context, log logr.Logger, dm devices.Manager, dr devices.DeviceRegistry) error {
+	log = log.WithName("WebsocketWatcher")
+	err := shellyapi.SubscribeWebsocket("daemon/watch", func(topic string, payload []byte, _ string) error {
+		handleEvent(ctx, log, dm, dr, payload)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("Started")
+	return nil
+}
 
-			log.Info("Updating device from MQTT event", "device", device.DeviceSummary)
-			err = UpdateFromMqttEvent(ctx, device, event)
+// handleEvent updates the device that pushed the notification payload, and
+// hands it to the device manager.
+func handleEvent(ctx context.Context, log logr.Logger, dm devices.Manager, dr devices.DeviceRegistry, payload []byte) {
+	event := &shellymqtt.Event{}
+	err := json.Unmarshal(payload, &event)
+	if err != nil {
+		log.Error(err, "Failed to unmarshal event from payload", "payload", string(payload))
+		return
+	}
+	if !strings.HasPrefix(event.Src, "shelly") {
+		log.Info("Skipping non-shelly event", "event", event)
+		return
+	}
+
+	deviceId := event.Src
+	device, err := dr.GetDeviceById(ctx, deviceId)
+	if err != nil {
+		log.Info("Device not found from DB, creating new one", "device_id", deviceId)
+		sd, err := shellyapi.NewDeviceFromMqttId(ctx, log, deviceId)
+		if err != nil {
+			log.Error(err, "Failed to create device from shelly device", "device_id", deviceId)
+			return
+		}
+		device, err = myhome.NewDeviceFromImpl(ctx, log, sd)
+		if err != nil {
+			log.Error(err, "Failed to create device from shelly device", "device_id", deviceId)
+			return
+		}
+	} else {
+		log.Info("Found device in DB", "device", device.DeviceSummary)
+		if device.Impl() == nil {
+			log.Info("Loading device details in memory", "device", device.DeviceSummary)
+			sd, err := shellyapi.NewDeviceFromSummary(ctx, log, device)
 			if err != nil {
-				log.Error(err, "Failed to update device from MQTT event", "src", event.Src, "device", device.DeviceSummary)
-				continue
+				log.Error(err, "Failed to create device from summary", "device", device.DeviceSummary)
+				return
 			}
-
-			dm.UpdateChannel() <- device
+			device = device.WithImpl(sd)
 		}
 	}
+
+	log.Info("Updating device from event", "device", device.DeviceSummary)
+	err = UpdateFromMqttEvent(ctx, device, event)
+	if err != nil {
+		log.Error(err, "Failed to update device from event", "src", event.Src, "device", device.DeviceSummary)
+		return
+	}
+
+	dm.UpdateChannel() <- device
 }
 
 func UpdateFromMqttEvent(ctx context.Context, d *myhome.Device, event *shellymqtt.Event) error {
@@ -148,7 +171,12 @@ func UpdateFromMqttEvent(ctx context.Context, d *myhome.Device, event *shellymqt
 			if status.System != nil {
 				kvs.ObserveRevision(log, d.Id(), status.System.KvsRevision)
 			}
-			// TODO: Update device from status
+			if sd, ok := d.Impl().(*shellyapi.Device); ok {
+				if err := sd.UpdateStatus(event.Params); err != nil {
+					log.Error(err, "Failed to update device status", "event", event)
+					return err
+				}
+			}
 		}
 	}
 
@@ -3,12 +3,15 @@ package watch
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/devices"
 	"github.com/asnowfix/home-automation/myhome/mqtt"
+	shellyapi "github.com/asnowfix/home-automation/pkg/shelly"
 	"github.com/asnowfix/home-automation/pkg/shelly/kvs"
 	shellymqtt "github.com/asnowfix/home-automation/pkg/shelly/mqtt"
 	"github.com/asnowfix/home-automation/pkg/shelly/types"
@@ -138,3 +141,49 @@ func TestUpdateFromMqttEvent_ExternalKvsWriteInvalidatesCache(t *testing.T) {
 		t.Fatalf("expected a fresh device call after external kvs_rev change, got %d total calls", len(fd.Calls))
 	}
 }
+
+// fakeRegistry serves a single known device.
+type fakeRegistry struct {
+	devices.DeviceRegistry
+	device *myhome.Device
+}
+
+func (r fakeRegistry) GetDeviceById(_ context.Context, id string) (*myhome.Device, error) {
+	if r.device.Id() != id {
+		return nil, fmt.Errorf("device not found: %s", id)
+	}
+	return r.device, nil
+}
+
+type fakeManager chan *myhome.Device
+
+func (m fakeManager) UpdateChannel() chan<- *myhome.Device {
+	return m
+}
+
+// TestHandleEvent_MergesNotifyStatus verifies that a notification, as pushed
+// over MQTT or WebSocket, is merged into the known device status and handed
+// to the device manager.
+func TestHandleEvent_MergesNotifyStatus(t *testing.T) {
+	log := testr.New(t)
+	ctx := logr.NewContext(context.Background(), log)
+
+	const deviceId = "shellyplus1-08b61fd90730"
+	sd := &shellyapi.Device{}
+	d := myhome.NewDevice(log, myhome.SHELLY, deviceId).WithImpl(sd)
+	dm := make(fakeManager, 2)
+
+	handleEvent(ctx, log, dm, fakeRegistry{device: d}, []byte(`{"src":"`+deviceId+`","dst":"`+deviceId+`/events","method":"NotifyFullStatus","params":{"ts":1736604018.38,"switch:0":{"id":0,"output":true,"temperature":{"tC":48.4,"tF":119.2}}}}`))
+	handleEvent(ctx, log, dm, fakeRegistry{device: d}, []byte(`{"src":"`+deviceId+`","dst":"`+deviceId+`/events","method":"NotifyStatus","params":{"ts":1736604020.06,"switch:0":{"id":0,"output":false}}}`))
+
+	if len(dm) != 2 {
+		t.Fatalf("device manager got %d updates, want 2", len(dm))
+	}
+	sw := sd.Status().Switch0
+	if sw == nil || sw.Output {
+		t.Fatalf("switch:0 status: got %+v, want output false", sw)
+	}
+	if sw.Temperature.Celsius != 48.4 {
+		t.Errorf("switch:0 temperature: got %v, want 48.4°C kept from the full status", sw.Temperature.Celsius)
+	}
+}
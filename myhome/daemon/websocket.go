@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/devices/impl"
+	"github.com/asnowfix/home-automation/pkg/shelly"
+	"github.com/go-logr/logr"
+)
+
+// watchWebsockets keeps a WebSocket connection open to every known Gen2+
+// Shelly, so that the notifications they push reach the Gen2 listener
+// without going through the MQTT broker. Devices discovered later are
+// picked up every interval.
+func watchWebsockets(ctx context.Context, log logr.Logger, dm *impl.DeviceManager, interval time.Duration) {
+	watched := make(map[string]bool)
+	for {
+		ds, err := dm.GetAllDevices(ctx)
+		if err != nil {
+			log.Error(err, "Failed to list devices to watch")
+		}
+		for _, d := range ds {
+			id := d.Id()
+			if watched[id] || d.Manufacturer() != string(myhome.SHELLY) || shelly.IsGen1Device(id) || shelly.IsBluDevice(id) {
+				continue
+			}
+			device, err := shelly.NewDeviceFromSummary(ctx, log, d)
+			if err != nil {
+				log.Error(err, "Failed to create device to watch", "device_id", id)
+				continue
+			}
+			sd, ok := device.(*shelly.Device)
+			if !ok || sd == nil {
+				continue
+			}
+			watched[id] = true
+			log.Info("Watching device over WebSocket", "device_id", id)
+			go func() {
+				if err := shelly.WatchWebsocket(ctx, sd); err != nil {
+					log.Error(err, "Failed to watch device over WebSocket", "device_id", id)
+				}
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -2,6 +2,11 @@ package impl
 
 import (
 	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"reflect"
@@ -15,6 +20,7 @@ import (
 	mynet "github.com/asnowfix/home-automation/internal/myhome/net"
 	"github.com/asnowfix/home-automation/internal/myhome/sfr"
 	shellyblu "github.com/asnowfix/home-automation/internal/myhome/shelly/blu"
+	"github.com/asnowfix/home-automation/internal/myhome/shelly/fleet"
 	shellygen1 "github.com/asnowfix/home-automation/internal/myhome/shelly/gen1"
 	shellyscript "github.com/asnowfix/home-automation/internal/myhome/shelly/script"
 	shellysetup "github.com/asnowfix/home-automation/internal/myhome/shelly/setup"
@@ -29,13 +35,18 @@ import (
 	"github.com/asnowfix/home-automation/myhome/storage"
 	"github.com/asnowfix/home-automation/pkg/devices"
 	"github.com/asnowfix/home-automation/pkg/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/gen1"
 	"github.com/asnowfix/home-automation/pkg/shelly/kvs"
+	pkgshelly "github.com/asnowfix/home-automation/pkg/shelly/shelly"
 	"github.com/asnowfix/home-automation/pkg/shelly/types"
 	"github.com/go-logr/logr"
 )
 
 type DeviceManager struct {
 	dr             mhd.DeviceRegistry
+	history        *storage.DeviceStorage // device_history is not cached: queried from storage
+	auth           *storage.DeviceStorage // device_auth, likewise
+	passwords      types.Passwords        // MYHOME_SHELLY_PASSWORDS
 	update         chan *myhome.Device
 	refreshed      chan *myhome.Device
 	cancel         context.CancelFunc
@@ -48,6 +59,8 @@ type DeviceManager struct {
 	setupInFlight  sync.Map           // Track devices currently being set up (device_id -> bool)
 	eventSvc       *events.Service
 	eventTracker   *events.SensorDailyTracker
+	components     sync.Map // Last pushed cover/light/meter state, by device id (see broadcastComponents)
+	drift          sync.Map // Last recorded fleet drift, by device id (see reportFleetDrift)
 }
 
 // SSEBroadcaster interface for broadcasting sensor updates to UI
@@ -68,6 +81,8 @@ func NewDeviceManager(ctx context.Context, s *storage.DeviceStorage, resolver my
 
 	dm := &DeviceManager{
 		dr:             mhd.NewCache(ctx, s),
+		history:        s,
+		auth:           s,
 		log:            log.WithName("DeviceManager"),
 		update:         make(chan *myhome.Device, 64), // TODO configurable buffer size
 		refreshed:      make(chan *myhome.Device, 64), // TODO configurable buffer size
@@ -105,18 +120,46 @@ func NewDeviceManager(ctx context.Context, s *storage.DeviceStorage, resolver my
 		name := in.(string)
 
 		devices := make([]devices.Device, 0)
-		device, err := dm.GetDeviceByAny(ctx, name)
+		device, err := dm.lookupDevice(ctx, name)
 		if err == nil {
 			dm.log.Info("Found device by identifier", "identifier", name)
 			devices = append(devices, device.DeviceSummary)
 			return &devices, nil
 		}
 
-		return nil, fmt.Errorf("failed to get device by identifier: %v", err)
+		return nil, fmt.Errorf("failed to get device by identifier: %w", err)
 	})
 	myhome.RegisterMethodHandler(myhome.DeviceShow, func(ctx context.Context, in any) (any, error) {
 		params := in.(*myhome.DeviceShowParams)
-		return dm.GetDeviceByAny(ctx, params.Identifier)
+		return dm.lookupDevice(ctx, params.Identifier)
+	})
+	myhome.RegisterMethodHandler(myhome.DeviceHistory, func(ctx context.Context, in any) (any, error) {
+		params := in.(*myhome.DeviceHistoryParams)
+		// A forgotten device keeps its history: fall back to the identifier
+		// as its id.
+		id := params.Identifier
+		if device, err := dm.lookupDevice(ctx, params.Identifier); err == nil {
+			id = device.Id()
+		} else if !errors.Is(err, myhome.ErrNotFound) {
+			return nil, err
+		}
+		entries, err := dm.history.DeviceHistory(ctx, id, params.Path, params.Limit)
+		if err != nil {
+			return nil, err
+		}
+		return &myhome.DeviceHistoryResult{Entries: entries}, nil
+	})
+	myhome.RegisterMethodHandler(myhome.DeviceSetAuth, func(ctx context.Context, in any) (any, error) {
+		params := in.(*myhome.DeviceSetAuthParams)
+		device, err := dm.lookupDevice(ctx, params.Identifier)
+		if err != nil {
+			return nil, err
+		}
+		sd, err := dm.GetShellyDevice(ctx, device)
+		if err != nil {
+			return nil, err
+		}
+		return nil, dm.setDeviceAuth(ctx, sd, params.Enable)
 	})
 	myhome.RegisterMethodHandler(myhome.DeviceForget, func(ctx context.Context, in any) (any, error) {
 		return nil, dm.ForgetDevice(ctx, in.(string))
@@ -125,7 +168,7 @@ func NewDeviceManager(ctx context.Context, s *storage.DeviceStorage, resolver my
 		log := dm.log.WithName("rpc/device.refresh")
 		ident := in.(string)
 		log.V(1).Info("New", "ident", ident)
-		device, err := dm.GetDeviceByAny(ctx, ident)
+		device, err := dm.lookupDevice(ctx, ident)
 		if err != nil {
 			log.Error(err, "Failed to get device by identifier", "identifier", ident)
 			return nil, err
@@ -158,7 +201,7 @@ func NewDeviceManager(ctx context.Context, s *storage.DeviceStorage, resolver my
 
 		// Return the original refresh error if any
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%w: %w", myhome.ErrUnreachable, err)
 		}
 
 		return device, nil
@@ -167,7 +210,8 @@ func NewDeviceManager(ctx context.Context, s *storage.DeviceStorage, resolver my
 		params := in.(*myhome.DeviceSetupParams)
 		log := dm.log.WithName("rpc/device.setup")
 		log.V(1).Info("New", "params", params)
-		device, err := dm.GetDeviceByAny(ctx, params.Identifier)
+		ctx = myhome.WithChangeSource(ctx, myhome.ChangeSourceSetup)
+		device, err := dm.lookupDevice(ctx, params.Identifier)
 		if err != nil {
 			log.Error(err, "Failed to get device by identifier", "identifier", params.Identifier)
 			return nil, err
@@ -235,15 +279,9 @@ func NewDeviceManager(ctx context.Context, s *storage.DeviceStorage, resolver my
 			return nil, fmt.Errorf("setup failed: %w", err)
 		}
 
-		// Refresh device info from Shelly and update DB with new name
-		if _, err := sd.Refresh(ctx, types.ChannelHttp); err != nil {
-			log.Error(err, "Failed to refresh device after setup", "device", device.Id())
-		} else {
-			// Update device name in DB from refreshed Shelly info
-			device = device.WithName(sd.Name())
-			if _, err := dm.dr.SetDevice(ctx, device, true); err != nil {
-				log.Error(err, "Failed to update device in DB after setup", "device", device.Id())
-			}
+		// Refresh device info from Shelly and update DB with new name & config
+		if err := dm.storeChangedDevice(ctx, device, sd); err != nil {
+			log.Error(err, "Failed to update device in DB after setup", "device", device.Id())
 		}
 
 		log.V(1).Info("Setup complete", "device", device.Id())
@@ -253,6 +291,7 @@ func NewDeviceManager(ctx context.Context, s *storage.DeviceStorage, resolver my
 		device := in.(*myhome.Device)
 		log := dm.log.WithName("rpc/device.update")
 		log.V(1).Info("New", "id", device.Id(), "name", device.Name())
+		ctx = myhome.WithChangeSource(ctx, myhome.ChangeSourceUser)
 
 		var modified bool
 		if modified, err = dm.dr.SetDevice(ctx, device, true); err != nil {
@@ -366,6 +405,15 @@ func (dm *DeviceManager) Start(ctx context.Context) error {
 	}
 	shelly.SetHostResolver(routerHostResolver{router: dm.router})
 
+	passwords, err := types.ParsePasswords(options.Flags.ShellyPasswords)
+	if err != nil {
+		return fmt.Errorf("MYHOME_SHELLY_PASSWORDS: %w", err)
+	}
+	dm.passwords = passwords
+	if err := shelly.SetCredentialsProvider(deviceCredentials{passwords: passwords, db: dm.auth}); err != nil {
+		return err
+	}
+
 	// Pre-populate cache with existing devices from database
 	// This ensures devices exist when retained MQTT sensor messages arrive
 	if err := dm.dr.Load(ctx); err != nil {
@@ -391,6 +439,12 @@ func (dm *DeviceManager) Start(ctx context.Context) error {
 		dm.log.Error(err, "Failed to watch MQTT events")
 		return err
 	}
+	if options.Flags.WebsocketWatch {
+		if err := watch.StartWebsocketWatcher(ctx, dm.log, dm, dm.dr); err != nil {
+			dm.log.Error(err, "Failed to watch WebSocket events")
+			return err
+		}
+	}
 
 	// Configure auto-setup for new devices (used by device updater loop)
 	dm.setupConfig = shellysetup.Config{
@@ -481,11 +535,43 @@ func (dm *DeviceManager) deviceUpdaterLoop(ctx context.Context) {
 				}
 
 				refreshOneDevice(logr.NewContext(tools.WithToken(ctx), log.WithName("refreshOneDevice").WithName(d.Name())), d, dm.refreshed)
+				dm.broadcastComponents(ctx, d)
 			}(device, isNewDevice, deviceId)
 		}
 	}
 }
 
+// broadcastComponents pushes the device view to the UI when the state of its
+// covers, lights or energy meters changed since last pushed. Unlike switches
+// and sensors, that state only lives in the in-memory device status, which is
+// not stored, so it never marks the device as modified.
+func (dm *DeviceManager) broadcastComponents(ctx context.Context, device *myhome.Device) {
+	sd, ok := device.Impl().(*shelly.Device)
+	if !ok || sd == nil {
+		return
+	}
+	status := sd.Status()
+	buf, err := json.Marshal(struct {
+		Covers map[int]pkgshelly.CoverSummary `json:"covers,omitempty"`
+		Lights map[int]pkgshelly.LightSummary `json:"lights,omitempty"`
+		Meters []pkgshelly.MeterSummary       `json:"meters,omitempty"`
+	}{
+		Covers: pkgshelly.CoverSummaries(device.Config, status),
+		Lights: pkgshelly.LightSummaries(device.Config, status),
+		Meters: pkgshelly.MeterSummaries(device.Config, status),
+	})
+	if err != nil {
+		return
+	}
+	state := string(buf)
+	prev, seen := dm.components.Swap(device.Id(), state)
+	if (seen && prev.(string) == state) || (!seen && state == "{}") {
+		return
+	}
+	dm.log.V(1).Info("Broadcasting device update (components)", "device", device.DeviceSummary)
+	dm.sseBroadcaster.BroadcastDeviceUpdate(ui.DeviceToView(ctx, device))
+}
+
 // triggerAutoSetup runs auto-setup for a new device in a goroutine
 func (dm *DeviceManager) triggerAutoSetup(ctx context.Context, log logr.Logger, device *myhome.Device, deviceId string) {
 	var err error
@@ -551,6 +637,9 @@ func (dm *DeviceManager) triggerAutoSetup(ctx context.Context, log logr.Logger,
 			return
 		}
 		setupLog.Info("Auto-setup completed successfully", "device_id", deviceId)
+		if err := dm.storeChangedDevice(myhome.WithChangeSource(ctx, myhome.ChangeSourceSetup), device, sd); err != nil {
+			setupLog.Error(err, "Failed to update device in DB after auto-setup", "device_id", deviceId)
+		}
 	}()
 }
 
@@ -575,6 +664,56 @@ func (r routerHostResolver) ResolveHost(ctx context.Context, mac net.HardwareAdd
 	return nil, model.ErrNotFound
 }
 
+// setDeviceAuth enables (or rotates) authentication on sd, or disables it,
+// then records the HA1 digest of its credentials. The password is the one of
+// the device in MYHOME_SHELLY_PASSWORDS, or else a random one. It is set over
+// HTTP, straight to the device, so that the credentials never go on the MQTT
+// bus.
+func (dm *DeviceManager) setDeviceAuth(ctx context.Context, sd types.Device, enable bool) error {
+	var password string
+	if enable {
+		password = dm.passwords[sd.Id()]
+		if password == "" {
+			password = dm.passwords["*"]
+		}
+		if password == "" {
+			buf := make([]byte, 16)
+			if _, err := rand.Read(buf); err != nil {
+				return err
+			}
+			password = hex.EncodeToString(buf)
+		}
+	}
+	ha1, err := pkgshelly.DoSetAuth(ctx, types.ChannelHttp, sd, password)
+	if err != nil {
+		dm.log.Error(err, "Unable to set device authentication", "device_id", sd.Id())
+		return fmt.Errorf("%s: unable to set authentication: %w", sd.Id(), err)
+	}
+	dm.log.Info("Recording device credentials", "device_id", sd.Id(), "enabled", enable)
+	if err := dm.auth.SetDeviceAuth(ctx, sd.Id(), ha1); err != nil {
+		return fmt.Errorf("%s: authentication changed but not recorded: %w", sd.Id(), err)
+	}
+	return nil
+}
+
+// deviceCredentials answers the authentication challenges of devices with
+// the passwords from MYHOME_SHELLY_PASSWORDS, or else the HA1 digests
+// recorded by device.setauth.
+type deviceCredentials struct {
+	passwords types.Passwords
+	db        *storage.DeviceStorage
+}
+
+func (c deviceCredentials) HA1(ctx context.Context, realm string) (string, bool) {
+	if _, ok := c.passwords[realm]; ok {
+		return c.passwords.HA1(ctx, realm)
+	}
+	if ha1, ok := c.db.HA1(ctx, realm); ok {
+		return ha1, true
+	}
+	return c.passwords.HA1(ctx, realm) // Default password, if any
+}
+
 func refreshOneDevice(ctx context.Context, device *myhome.Device, refreshed chan<- *myhome.Device) {
 	log, err := logr.FromContext(ctx)
 	if err != nil {
@@ -691,6 +830,7 @@ func (dm *DeviceManager) runDeviceRefreshJob(ctx context.Context, interval time.
 // runReconciliationLoop periodically re-applies canonical MQTT broker / NTP / Matter
 // config to every known Gen2+ device over HTTP, as a self-healing safety net against
 // config drift (see docs/MQTT-BROKER-LOOPBACK-PLAN.md). interval <= 0 disables the loop.
+// With --fleet-file, it also reports each device's drift from the fleet file as events.
 //
 // HTTP is forced rather than auto-selected: if a device's MQTT broker is wrong, its
 // "MQTT ready" flag can look fine while nothing actually reaches it, so only HTTP to
@@ -719,17 +859,25 @@ func (dm *DeviceManager) runReconciliationLoop(ctx context.Context, interval tim
 				log.Error(err, "Failed to get all devices for reconciliation")
 				continue
 			}
+			// The fleet file is read at every round, to pick up its edits
+			var f *fleet.File
+			if options.Flags.FleetFile != "" {
+				f, err = fleet.Load(options.Flags.FleetFile)
+				if err != nil {
+					log.Error(err, "Failed to load fleet file (not reporting drift)", "file", options.Flags.FleetFile)
+				}
+			}
 			for _, d := range devices {
 				if shelly.IsGen1Device(d.Id()) || strings.HasPrefix(d.Id(), "shellyblu-") {
 					continue
 				}
-				dm.reconcileOneDevice(ctx, log, d)
+				dm.reconcileOneDevice(ctx, log, d, f)
 			}
 		}
 	}
 }
 
-func (dm *DeviceManager) reconcileOneDevice(ctx context.Context, log logr.Logger, device *myhome.Device) {
+func (dm *DeviceManager) reconcileOneDevice(ctx context.Context, log logr.Logger, device *myhome.Device, f *fleet.File) {
 	sd, ok := device.Impl().(*shelly.Device)
 	if !ok || sd == nil {
 		impl, err := shelly.NewDeviceFromSummary(ctx, log, device)
@@ -746,11 +894,106 @@ func (dm *DeviceManager) reconcileOneDevice(ctx context.Context, log logr.Logger
 		log.V(1).Info("Skipping reconciliation: no host known for device", "device", device.Id())
 		return
 	}
-	if err := shellysetup.ReconcileConfig(ctx, log, types.ChannelHttp, sd, dm.setupConfig); err != nil {
+	changed, err := shellysetup.ReconcileConfig(ctx, log, types.ChannelHttp, sd, dm.setupConfig)
+	if err != nil {
 		log.Error(err, "Reconciliation failed", "device", device.Id())
+	} else if f != nil {
+		dm.reportFleetDrift(ctx, log, device, sd, f)
+	}
+	// Only what reconciliation applied is recorded as such: changes made
+	// elsewhere are left to the refresh job.
+	if !changed {
+		return
+	}
+	if err := dm.storeChangedDevice(myhome.WithChangeSource(ctx, myhome.ChangeSourceReconcile), device, sd); err != nil {
+		log.Error(err, "Failed to update device in DB after reconciliation", "device", device.Id())
 	}
 }
 
+// reportFleetDrift records a fleet/drift event listing the differences
+// between sd and its desired state in the fleet file, when they changed
+// since last recorded: a device that stays drifted is reported once, not at
+// every round. The drift is only reported: 'myhome ctl fleet apply'
+// converges the devices.
+func (dm *DeviceManager) reportFleetDrift(ctx context.Context, log logr.Logger, device *myhome.Device, sd types.Device, f *fleet.File) {
+	spec := f.Lookup(device.Id(), device.Name())
+	if spec == nil {
+		dm.drift.Delete(device.Id())
+		return
+	}
+	plan, err := fleet.Diff(ctx, log, types.ChannelHttp, sd, fleetRooms{dm.dr}, spec)
+	if err != nil {
+		log.Error(err, "Failed to compare device with the fleet file", "device", device.Id())
+		return
+	}
+	if plan.Empty() {
+		if _, drifted := dm.drift.LoadAndDelete(device.Id()); drifted {
+			log.Info("Device is back in line with the fleet file", "device", device.Id())
+		}
+		return
+	}
+	payload, err := json.Marshal(plan.Changes)
+	if err != nil {
+		log.Error(err, "Failed to marshal fleet drift", "device", device.Id())
+		return
+	}
+	data := string(payload)
+	if prev, ok := dm.drift.Load(device.Id()); ok && prev.(string) == data {
+		log.V(1).Info("Device still drifted from the fleet file", "device", device.Id(), "changes", len(plan.Changes))
+		return
+	}
+	log.Info("Device drifted from the fleet file", "device", device.Id(), "changes", len(plan.Changes))
+	if dm.eventSvc == nil {
+		dm.drift.Store(device.Id(), data)
+		return
+	}
+	if err := dm.eventSvc.Record(ctx, events.Event{
+		DeviceID:  device.Id(),
+		Component: "fleet",
+		Event:     "drift",
+		Severity:  "notice",
+		Data:      &data,
+	}); err != nil {
+		log.Error(err, "Failed to record fleet drift", "device", device.Id())
+		return
+	}
+	dm.drift.Store(device.Id(), data)
+}
+
+// fleetRooms gives the fleet engine the rooms of the device registry.
+type fleetRooms struct {
+	dr mhd.DeviceRegistry
+}
+
+func (r fleetRooms) GetRoom(ctx context.Context, deviceId string) (string, error) {
+	d, err := r.dr.GetDeviceById(ctx, deviceId)
+	if err != nil {
+		return "", err
+	}
+	return d.RoomId, nil
+}
+
+func (r fleetRooms) SetRoom(ctx context.Context, deviceId string, room string) error {
+	_, err := r.dr.SetDeviceRoom(ctx, deviceId, room)
+	return err
+}
+
+// storeChangedDevice refreshes sd over HTTP after the daemon changed its
+// configuration, and stores it as device. The change is recorded in the
+// device history with the source found in ctx (see myhome.WithChangeSource),
+// rather than as observed by the next periodic refresh.
+func (dm *DeviceManager) storeChangedDevice(ctx context.Context, device *myhome.Device, sd *shelly.Device) error {
+	if _, err := sd.Refresh(ctx, types.ChannelHttp); err != nil {
+		return err
+	}
+	device = device.WithName(sd.Name())
+	device.ConfigRevision = sd.ConfigRevision()
+	device.Info = sd.Info()
+	device.Config = sd.Config()
+	_, err := dm.dr.SetDevice(ctx, device, true)
+	return err
+}
+
 func (dm *DeviceManager) Flush() error {
 	err := dm.dr.Flush()
 	if err != nil {
@@ -772,6 +1015,16 @@ func (dm *DeviceManager) GetDeviceByAny(ctx context.Context, any string) (*myhom
 	return dm.dr.GetDeviceByAny(ctx, any)
 }
 
+// lookupDevice is GetDeviceByAny for RPC handlers: an unknown identifier is
+// reported as myhome.ErrNotFound.
+func (dm *DeviceManager) lookupDevice(ctx context.Context, ident string) (*myhome.Device, error) {
+	device, err := dm.GetDeviceByAny(ctx, ident)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: device %s", myhome.ErrNotFound, ident)
+	}
+	return device, err
+}
+
 func (dm *DeviceManager) GetDeviceById(ctx context.Context, id string) (*myhome.Device, error) {
 	return dm.dr.GetDeviceById(ctx, id)
 }
@@ -939,3 +1192,21 @@ func (dm *DeviceManager) GetShellyDevice(ctx context.Context, device *myhome.Dev
 	}
 	return sd, nil
 }
+
+// GetGen1Device returns a Gen1 device to control over HTTP, with its IP
+// resolved by the router, or else over MQTT (implements
+// mhswitch.DeviceProvider)
+func (dm *DeviceManager) GetGen1Device(ctx context.Context, device *myhome.Device) (*gen1.Shelly, error) {
+	if !shelly.IsGen1Device(device.Id()) {
+		return nil, fmt.Errorf("not a Gen1 device: %s", device.Id())
+	}
+	gd := gen1.NewShelly(device.Id(), device.Host(), dm.mqttClient)
+	gd.UpdateName(device.Name())
+	if device.Mac() != nil {
+		gd.UpdateMac(device.Mac().String())
+	}
+	if dm.router != nil {
+		gd.SetHostResolver(routerHostResolver{router: dm.router})
+	}
+	return gd, nil
+}
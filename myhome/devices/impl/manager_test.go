@@ -1,10 +1,21 @@
 package impl
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
 
 	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/internal/myhome/shelly/fleet"
+	"github.com/asnowfix/home-automation/internal/myhome/ui"
+	"github.com/asnowfix/home-automation/myhome/events"
+	"github.com/asnowfix/home-automation/myhome/storage"
+	shellyapi "github.com/asnowfix/home-automation/pkg/shelly"
 	"github.com/asnowfix/home-automation/pkg/shelly/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/system"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
 )
 
 func newTestDevice(id, name string) *myhome.Device {
@@ -120,3 +131,146 @@ func TestClassifyDoors(t *testing.T) {
 		}
 	})
 }
+
+type recordingBroadcaster struct {
+	devices []ui.DeviceView
+}
+
+func (b *recordingBroadcaster) BroadcastSensorUpdate(deviceID string, sensor string, value string) {}
+
+func (b *recordingBroadcaster) BroadcastDeviceUpdate(dv ui.DeviceView) {
+	b.devices = append(b.devices, dv)
+}
+
+func TestBroadcastComponents_OnlyOnChange(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	b := &recordingBroadcaster{}
+	dm := &DeviceManager{log: logr.Discard(), sseBroadcaster: b}
+
+	sd := &shellyapi.Device{}
+	d := newTestDevice("shellyplus2pm-abc", "Kitchen").WithImpl(sd)
+	update := func(params string) {
+		t.Helper()
+		if err := sd.UpdateStatus(json.RawMessage(params)); err != nil {
+			t.Fatal(err)
+		}
+		dm.broadcastComponents(ctx, d)
+	}
+
+	update(`{"cover:0":{"id":0,"state":"opening","current_pos":10}}`)
+	update(`{"cover:0":{"id":0,"state":"opening","current_pos":10},"sys":{"uptime":12}}`)
+	update(`{"cover:0":{"id":0,"state":"open","current_pos":100}}`)
+
+	if len(b.devices) != 2 {
+		t.Fatalf("expected 2 broadcasts, got %d", len(b.devices))
+	}
+	if c := b.devices[1].Covers[0]; c.State != "open" || c.Position == nil || *c.Position != 100 {
+		t.Errorf("unexpected cover %+v", c)
+	}
+
+	// Devices without covers, lights or meters are not pushed
+	plain := newTestDevice("shellyplus1-abc", "Plain").WithImpl(&shellyapi.Device{})
+	dm.broadcastComponents(ctx, plain)
+	if len(b.devices) != 2 {
+		t.Errorf("unexpected broadcast of %s", plain.Id())
+	}
+}
+
+func TestReportFleetDrift_OnlyOnChange(t *testing.T) {
+	ctx := context.Background()
+	store, err := events.NewStorage(logr.Discard(), ":memory:")
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	defer store.Close()
+	// Events of the same second are stored once: count the recorded ones
+	var recorded []events.Event
+	dm := &DeviceManager{eventSvc: events.NewService(logr.Discard(), store, nil, func(e events.Event) { recorded = append(recorded, e) }, 0)}
+
+	d := newTestDevice("shellyplus1-abc", "Porch")
+	sd := types.NewFakeDevice()
+	sd.IdValue = d.Id()
+	setName := func(name string) {
+		sd.SetResult("Sys.GetConfig", &system.Config{Device: &system.DeviceConfig{Name: name}})
+	}
+	want := "Porch light"
+	f := &fleet.File{Devices: map[string]*fleet.Spec{d.Id(): {Name: &want}}}
+
+	drifts := func() int { return len(recorded) }
+
+	setName("Porch")
+	dm.reportFleetDrift(ctx, logr.Discard(), d, sd, f)
+	dm.reportFleetDrift(ctx, logr.Discard(), d, sd, f)
+	if n := drifts(); n != 1 {
+		t.Fatalf("expected 1 drift event for an unchanged drift, got %d", n)
+	}
+
+	setName("Front")
+	dm.reportFleetDrift(ctx, logr.Discard(), d, sd, f)
+	if n := drifts(); n != 2 {
+		t.Fatalf("expected a new drift event once the drift changed, got %d", n)
+	}
+
+	// Back in line, then drifted again the same way: reported again
+	setName(want)
+	dm.reportFleetDrift(ctx, logr.Discard(), d, sd, f)
+	setName("Front")
+	dm.reportFleetDrift(ctx, logr.Discard(), d, sd, f)
+	if n := drifts(); n != 3 {
+		t.Fatalf("expected a drift event after the device got back in line, got %d", n)
+	}
+}
+
+func TestSetDeviceAuth(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.NewDeviceStorage(logr.Discard(), ":memory:")
+	if err != nil {
+		t.Fatalf("NewDeviceStorage: %v", err)
+	}
+	defer db.Close()
+
+	sd := types.NewFakeDevice()
+	sd.IdValue = "shellypro3-aabbccddeeff"
+	sd.SetResult(shelly.SetAuth.String(), nil)
+	setAuth := func(dm *DeviceManager, enable bool) *shelly.AuthRequest {
+		t.Helper()
+		sd.Calls = nil
+		if err := dm.setDeviceAuth(ctx, sd, enable); err != nil {
+			t.Fatalf("setDeviceAuth: %v", err)
+		}
+		if len(sd.Calls) != 1 || sd.Calls[0].Method != shelly.SetAuth.String() || sd.Calls[0].Via != types.ChannelHttp {
+			t.Fatalf("expected one Shelly.SetAuth call over HTTP, got %+v", sd.Calls)
+		}
+		return sd.Calls[0].Params.(*shelly.AuthRequest)
+	}
+
+	// Configured password
+	dm := &DeviceManager{log: logr.Discard(), auth: db, passwords: types.Passwords{"*": "s3cret"}}
+	req := setAuth(dm, true)
+	want := types.AuthHA1(sd.Id(), "s3cret")
+	if req.Ha1 == nil || *req.Ha1 != want {
+		t.Fatalf("expected the HA1 of the configured password, got %v", req.Ha1)
+	}
+	if ha1, ok := db.HA1(ctx, sd.Id()); !ok || ha1 != want {
+		t.Fatalf("expected the HA1 to be recorded, got %q (%v)", ha1, ok)
+	}
+
+	// Random password, different on every rotation
+	dm.passwords = nil
+	first := *setAuth(dm, true).Ha1
+	second := *setAuth(dm, true).Ha1
+	if first == want || first == second {
+		t.Fatalf("expected random passwords, got HA1 %s then %s", first, second)
+	}
+	if ha1, _ := db.HA1(ctx, sd.Id()); ha1 != second {
+		t.Fatalf("expected the last HA1 to be recorded, got %q", ha1)
+	}
+
+	// Disabled
+	if req := setAuth(dm, false); req.Ha1 != nil {
+		t.Fatalf("expected no HA1 when disabling, got %q", *req.Ha1)
+	}
+	if _, ok := db.HA1(ctx, sd.Id()); ok {
+		t.Fatal("expected the credentials to be forgotten")
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/jmoiron/sqlx"
 	_ "modernc.org/sqlite"
+
+	"github.com/asnowfix/home-automation/myhome/storage/migrate"
 )
 
 type Event struct {
@@ -92,8 +94,15 @@ func NewStorage(log logr.Logger, dbPath string) (*Storage, error) {
 	return s, nil
 }
 
-func (s *Storage) createTables() error {
-	schema := `
+// Migrations is the versioned schema of the events database, applied by
+// NewStorage (see myhome/storage/migrate).
+var Migrations = migrate.Set{
+	Subsystem: "events",
+	Migrations: []migrate.Migration{
+		{
+			Version: 1,
+			Name:    "create events and sensor_daily_stats",
+			Up: `
 CREATE TABLE IF NOT EXISTS events (
     id          INTEGER PRIMARY KEY AUTOINCREMENT,
     ts          REAL    NOT NULL,
@@ -121,22 +130,20 @@ CREATE TABLE IF NOT EXISTS sensor_daily_stats (
     samples     INTEGER DEFAULT 0,
     updated_at  REAL    NOT NULL,
     PRIMARY KEY (date, device_id, component, metric)
-);`
-
-	_, err := s.db.Exec(schema)
-	if err != nil {
-		s.log.Error(err, "Failed to create events schema")
-		return err
-	}
+);`,
+			Down: `
+DROP TABLE sensor_daily_stats;
+DROP TABLE events;`,
+		},
+	},
+}
 
-	// Migration: check events table exists (use COUNT(*) pattern from myhome/storage/db.go)
-	var count int
-	err = s.db.Get(&count, `SELECT COUNT(*) FROM pragma_table_info('events') WHERE name='severity'`)
-	if err != nil {
-		s.log.Error(err, "Failed to check events table columns")
+func (s *Storage) createTables() error {
+	ctx := logr.NewContext(context.Background(), s.log)
+	if err := migrate.Ensure(ctx, s.db, Migrations); err != nil {
+		s.log.Error(err, "Failed to migrate events schema")
 		return err
 	}
-
 	return nil
 }
 
@@ -1,6 +1,7 @@
 package fetchproxy
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -9,14 +10,15 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/jmoiron/sqlx"
 
+	"github.com/asnowfix/home-automation/myhome/storage/migrate"
+
 	_ "modernc.org/sqlite"
 )
 
 // Storage persists fetch subscriptions in the shared myhome.db (see #465
 // "Reuse myhome.db. Do not introduce a new database file"). It follows the
 // precedent in myhome/temperature/storage.go: NewStorage takes the shared
-// *sqlx.DB handle, creates its table idempotently, and there is no versioned
-// migration framework to fight.
+// *sqlx.DB handle and versions its table with myhome/storage/migrate.
 //
 // last_seen is deliberately NOT a column here: persisting it would reintroduce
 // a write on every re-publication and undo the wear saving the change-hash
@@ -41,21 +43,14 @@ type subscriptionRow struct {
 	UpdatedAt       time.Time `db:"updated_at"`
 }
 
-// NewStorage creates the fetch_subscriptions table if it does not already
-// exist, using the shared database handle (storage.DB() in the daemon).
-func NewStorage(log logr.Logger, db *sqlx.DB) (*Storage, error) {
-	s := &Storage{
-		db:  db,
-		log: log.WithName("FetchStorage"),
-	}
-	if err := s.createTable(); err != nil {
-		return nil, err
-	}
-	return s, nil
-}
-
-func (s *Storage) createTable() error {
-	schema := `
+// Migrations is the versioned schema of fetch_subscriptions.
+var Migrations = migrate.Set{
+	Subsystem: "fetchproxy",
+	Migrations: []migrate.Migration{
+		{
+			Version: 1,
+			Name:    "create fetch_subscriptions",
+			Up: `
 	CREATE TABLE IF NOT EXISTS fetch_subscriptions (
 		device_id        TEXT NOT NULL,
 		name             TEXT NOT NULL,
@@ -68,8 +63,28 @@ func (s *Storage) createTable() error {
 		updated_at       TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		PRIMARY KEY (device_id, name)
 	);
-	`
-	if _, err := s.db.Exec(schema); err != nil {
+	`,
+			Down: `DROP TABLE fetch_subscriptions;`,
+		},
+	},
+}
+
+// NewStorage creates or migrates the fetch_subscriptions table, using the
+// shared database handle (storage.DB() in the daemon).
+func NewStorage(log logr.Logger, db *sqlx.DB) (*Storage, error) {
+	s := &Storage{
+		db:  db,
+		log: log.WithName("FetchStorage"),
+	}
+	if err := s.createTable(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Storage) createTable() error {
+	ctx := logr.NewContext(context.Background(), s.log)
+	if err := migrate.Ensure(ctx, s.db, Migrations); err != nil {
 		s.log.Error(err, "Failed to create fetch_subscriptions table")
 		return err
 	}
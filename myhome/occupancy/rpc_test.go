@@ -11,18 +11,11 @@ import (
 
 // withRegisteredHandler registers h for verb on the shared myhome method
 // registry and restores the previous registration (if any) in t.Cleanup.
-// myhome exposes no Unregister API, so when there was no prior registration
-// this intentionally leaves h registered afterward. Tests using this must
-// not call t.Parallel(), since the registry is a package-level global.
+// Tests using this must not call t.Parallel(), since the registry is a
+// package-level global.
 func withRegisteredHandler(t *testing.T, verb myhome.Verb, h myhome.MethodHandler) {
 	t.Helper()
-	prev, err := myhome.Methods(verb)
-	myhome.RegisterMethodHandler(verb, h)
-	t.Cleanup(func() {
-		if err == nil && prev != nil {
-			myhome.RegisterMethodHandler(verb, prev.ActionE)
-		}
-	})
+	t.Cleanup(myhome.RegisterMethodHandler(verb, h))
 }
 
 // TestOccupancyGetStatus_Dispatch verifies that RegisterHandlers wires
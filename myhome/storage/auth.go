@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// createDeviceAuth is the version 6 migration of the devices database: the
+// HA1 digest of the credentials set on each device with authentication
+// enabled (see pkg/shelly/types.AuthHA1). Passwords themselves are never
+// stored.
+const createDeviceAuth = `
+    CREATE TABLE IF NOT EXISTS device_auth (
+        device_id TEXT PRIMARY KEY,
+        ha1 TEXT NOT NULL,
+        updated_at TEXT NOT NULL
+    );`
+
+// SetDeviceAuth records the HA1 digest of the credentials of deviceId, or
+// forgets them if ha1 is empty.
+func (s *DeviceStorage) SetDeviceAuth(ctx context.Context, deviceId string, ha1 string) error {
+	var err error
+	if ha1 == "" {
+		_, err = s.db.ExecContext(ctx, `DELETE FROM device_auth WHERE device_id = ?`, deviceId)
+	} else {
+		_, err = s.db.ExecContext(ctx, `INSERT INTO device_auth (device_id, ha1, updated_at) VALUES (?, ?, ?)
+            ON CONFLICT(device_id) DO UPDATE SET ha1 = excluded.ha1, updated_at = excluded.updated_at`,
+			deviceId, ha1, time.Now().UTC().Format(time.RFC3339Nano))
+	}
+	if err != nil {
+		s.log.Error(err, "Failed to store device credentials", "device_id", deviceId)
+	}
+	return err
+}
+
+// HA1 returns the recorded HA1 digest of the credentials of the device with
+// id realm, so that DeviceStorage is a pkg/shelly/types.CredentialsProvider.
+func (s *DeviceStorage) HA1(ctx context.Context, realm string) (string, bool) {
+	var ha1 string
+	err := s.db.GetContext(ctx, &ha1, `SELECT ha1 FROM device_auth WHERE device_id = ?`, realm)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			s.log.Error(err, "Failed to load device credentials", "device_id", realm)
+		}
+		return "", false
+	}
+	return ha1, true
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDeviceAuth(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	const id = "shellypro4pm-f008d1d8b8b8"
+
+	if _, ok := s.HA1(ctx, id); ok {
+		t.Fatal("expected no credentials before SetDeviceAuth")
+	}
+	for _, ha1 := range []string{"aaaa", "bbbb"} {
+		if err := s.SetDeviceAuth(ctx, id, ha1); err != nil {
+			t.Fatalf("SetDeviceAuth: %v", err)
+		}
+		if got, ok := s.HA1(ctx, id); !ok || got != ha1 {
+			t.Errorf("HA1: got %q %v, want %q", got, ok, ha1)
+		}
+	}
+	if err := s.SetDeviceAuth(ctx, id, ""); err != nil {
+		t.Fatalf("SetDeviceAuth: %v", err)
+	}
+	if _, ok := s.HA1(ctx, id); ok {
+		t.Error("expected credentials to be forgotten")
+	}
+}
@@ -0,0 +1,363 @@
+// Package backup takes consistent copies of the myhome SQLite databases while
+// the daemon uses them, verifies and restores them, and keeps a rotating set
+// of scheduled snapshots.
+//
+// Copies are made with VACUUM INTO: a single read transaction on the source,
+// producing a compact standalone database file (no -wal sidecar to carry
+// along). In WAL mode that read transaction does not block writers on other
+// connections, but the daemon pins each pool to a single connection: a
+// VACUUM INTO run on the daemon's own handle would hold back every query
+// until it completes. Backup and the Scheduler therefore open a connection of
+// their own on the database file.
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jmoiron/sqlx"
+
+	_ "modernc.org/sqlite"
+)
+
+// ErrCorrupt is returned when a database fails its integrity check.
+var ErrCorrupt = errors.New("database failed its integrity check")
+
+// ErrWrongDatabase is returned when a database lacks the tables of the
+// database it is meant to be a backup of.
+var ErrWrongDatabase = errors.New("not a backup of this database")
+
+// TimeFormat is the timestamp of snapshot file names, sortable as text.
+const TimeFormat = "20060102T150405Z"
+
+// now is the clock naming the databases kept aside by Restore.
+var now = time.Now
+
+// Open opens an existing database file; it does not create missing ones.
+func Open(path string) (*sqlx.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sqlx.Connect("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// Snapshot writes a consistent copy of db to path, which must not exist. The
+// copy is written next to path, verified, then renamed into place, so that
+// path is either a complete, checked database or absent.
+func Snapshot(ctx context.Context, db *sqlx.DB, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s: %w", path, os.ErrExist)
+	}
+	partial := path + ".partial"
+	os.Remove(partial)
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, partial); err != nil {
+		os.Remove(partial)
+		return fmt.Errorf("snapshot to %s: %w", path, err)
+	}
+	if err := Verify(ctx, partial); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, path)
+}
+
+// Backup snapshots the database file at src to dst.
+func Backup(ctx context.Context, src, dst string) error {
+	db, err := Open(src)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return Snapshot(ctx, db, dst)
+}
+
+// Verify runs SQLite's integrity check on the database file at path, and
+// returns ErrCorrupt with its findings if it is not "ok".
+func Verify(ctx context.Context, path string) error {
+	db, err := Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return err
+	} else if err != nil {
+		// Not a database at all ("file is not a database")
+		return fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	defer db.Close()
+	var findings []string
+	if err := db.SelectContext(ctx, &findings, `PRAGMA integrity_check`); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorrupt, path, err)
+	}
+	if len(findings) != 1 || findings[0] != "ok" {
+		return fmt.Errorf("%w: %s: %s", ErrCorrupt, path, strings.Join(findings, "; "))
+	}
+	return nil
+}
+
+// CheckTables returns ErrWrongDatabase, naming the first one missing, unless
+// the database file at path has all the given tables.
+func CheckTables(ctx context.Context, path string, tables ...string) error {
+	db, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	for _, table := range tables {
+		var n int
+		if err := db.GetContext(ctx, &n, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table); err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("%w: %s has no %s table", ErrWrongDatabase, path, table)
+		}
+	}
+	return nil
+}
+
+// Restore replaces the database file at dst with the backup at src, once src
+// passed its integrity check and was found to have the given tables, those
+// telling the databases apart. The database being replaced, if any, is
+// checkpointed and kept as <dst>.pre-restore-<time>, whose path is returned;
+// an earlier one is never overwritten. Nothing may have dst open: the daemon
+// must be stopped.
+func Restore(ctx context.Context, src, dst string, tables ...string) (string, error) {
+	if err := Verify(ctx, src); err != nil {
+		return "", err
+	}
+	if err := CheckTables(ctx, src, tables...); err != nil {
+		return "", err
+	}
+
+	// Fold the -wal sidecar of the current database into it, so that neither
+	// the copy kept aside loses its last writes nor a stale -wal is replayed
+	// over the restored database.
+	if db, err := Open(dst); err == nil {
+		_, err = db.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`)
+		db.Close()
+		if err != nil {
+			return "", fmt.Errorf("checkpoint %s: %w", dst, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	kept := dst + ".pre-restore-" + now().UTC().Format(TimeFormat)
+	if _, err := os.Stat(kept); err == nil {
+		return "", fmt.Errorf("%s: %w", kept, os.ErrExist)
+	}
+	restoring := dst + ".restoring"
+	if err := copyFile(src, restoring); err != nil {
+		os.Remove(restoring)
+		return "", err
+	}
+	if err := os.Rename(dst, kept); errors.Is(err, os.ErrNotExist) {
+		kept = ""
+	} else if err != nil {
+		os.Remove(restoring)
+		return "", err
+	}
+	for _, sidecar := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dst + sidecar); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return kept, err
+		}
+	}
+	return kept, os.Rename(restoring, dst)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// SnapshotPath returns the path of the snapshot of the database name taken
+// at t in dir, e.g. dir/myhome-20261017T030000Z.db.
+func SnapshotPath(dir, name string, t time.Time) string {
+	return filepath.Join(dir, name+"-"+t.UTC().Format(TimeFormat)+".db")
+}
+
+// Snapshots returns the snapshots of the database name in dir, oldest first.
+func Snapshots(dir, name string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, name+"-*.db"))
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []string
+	for _, p := range paths {
+		if _, err := takenAt(p, name); err == nil {
+			snapshots = append(snapshots, p)
+		}
+	}
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
+
+// takenAt parses the time a snapshot of the database name was taken from its
+// path.
+func takenAt(path, name string) (time.Time, error) {
+	ts := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), name+"-"), ".db")
+	return time.Parse(TimeFormat, ts)
+}
+
+// Prune deletes all but the keep most recent snapshots of the database name
+// in dir, and returns the deleted paths.
+func Prune(dir, name string, keep int) ([]string, error) {
+	snapshots, err := Snapshots(dir, name)
+	if err != nil || len(snapshots) <= keep {
+		return nil, err
+	}
+	var deleted []string
+	for _, p := range snapshots[:len(snapshots)-keep] {
+		if err := os.Remove(p); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, p)
+	}
+	return deleted, nil
+}
+
+// Source is a database file the Scheduler snapshots, by name (the prefix of
+// its snapshot files).
+type Source struct {
+	Name string
+	Path string
+}
+
+// Scheduler snapshots its sources into a directory at a fixed interval and
+// keeps the most recent ones.
+type Scheduler struct {
+	log      logr.Logger
+	dir      string
+	interval time.Duration
+	keep     int
+	sources  []Source
+	failed   map[string]time.Time // Last failed snapshot of each source, by name
+}
+
+func NewScheduler(log logr.Logger, dir string, interval time.Duration, keep int, sources ...Source) *Scheduler {
+	return &Scheduler{
+		log:      log.WithName("Snapshots"),
+		dir:      dir,
+		interval: interval,
+		keep:     max(keep, 1), // never prune the snapshot just taken
+		sources:  sources,
+		failed:   make(map[string]time.Time),
+	}
+}
+
+// Start snapshots each source whenever its snapshot is due, until ctx is
+// done. A snapshot is due interval after the previous one, as found in the
+// directory: restarting the daemon does not take an extra one. A source that
+// failed is retried interval after its failure, not in a loop.
+func (s *Scheduler) Start(ctx context.Context) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		s.log.Error(err, "Failed to create snapshot directory", "dir", s.dir)
+		return err
+	}
+	for {
+		timer := time.NewTimer(s.untilDue(time.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case now := <-timer.C:
+			s.snapshot(ctx, now, s.dueSources(now))
+		}
+	}
+}
+
+// untilDue returns how long until the next snapshot is due, the earliest
+// among the sources.
+func (s *Scheduler) untilDue(now time.Time) time.Duration {
+	if len(s.sources) == 0 {
+		return s.interval
+	}
+	var due time.Time
+	for _, src := range s.sources {
+		if next := s.due(src, now); due.IsZero() || next.Before(due) {
+			due = next
+		}
+	}
+	return max(due.Sub(now), 0)
+}
+
+// due returns when the next snapshot of src is due: interval after its
+// latest snapshot or its last failed one, whichever is later, or now if it
+// has neither.
+func (s *Scheduler) due(src Source, now time.Time) time.Time {
+	last := s.failed[src.Name]
+	if snapshots, err := Snapshots(s.dir, src.Name); err == nil && len(snapshots) > 0 {
+		if taken, err := takenAt(snapshots[len(snapshots)-1], src.Name); err == nil && taken.After(last) {
+			last = taken
+		}
+	}
+	if last.IsZero() {
+		return now
+	}
+	return last.Add(s.interval)
+}
+
+// dueSources returns the sources whose snapshot is due at now.
+func (s *Scheduler) dueSources(now time.Time) []Source {
+	var due []Source
+	for _, src := range s.sources {
+		if !s.due(src, now).After(now) {
+			due = append(due, src)
+		}
+	}
+	return due
+}
+
+// SnapshotAll snapshots every source as of now, then prunes old snapshots.
+// A failing source is logged and does not prevent the others' snapshots.
+func (s *Scheduler) SnapshotAll(ctx context.Context, now time.Time) {
+	s.snapshot(ctx, now, s.sources)
+}
+
+// snapshot snapshots sources as of now, then prunes their old snapshots. A
+// failing source is logged, and remembered until its next successful
+// snapshot.
+func (s *Scheduler) snapshot(ctx context.Context, now time.Time, sources []Source) {
+	for _, src := range sources {
+		path := SnapshotPath(s.dir, src.Name, now)
+		if err := Backup(ctx, src.Path, path); err != nil {
+			s.log.Error(err, "Failed to snapshot database", "name", src.Name, "path", path, "retry_in", s.interval)
+			s.failed[src.Name] = now
+			continue
+		}
+		delete(s.failed, src.Name)
+		s.log.Info("Snapshotted database", "name", src.Name, "path", path)
+		deleted, err := Prune(s.dir, src.Name, s.keep)
+		if err != nil {
+			s.log.Error(err, "Failed to prune snapshots", "name", src.Name)
+		} else if len(deleted) > 0 {
+			s.log.Info("Pruned snapshots", "name", src.Name, "count", len(deleted))
+		}
+	}
+}
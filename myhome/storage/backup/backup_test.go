@@ -0,0 +1,234 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/jmoiron/sqlx"
+)
+
+// newTestDB creates a WAL-mode database file holding one row, like the
+// daemon's databases.
+func newTestDB(t *testing.T, path string) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Connect("sqlite", path)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	db.MustExec(`PRAGMA journal_mode=WAL`)
+	db.MustExec(`CREATE TABLE things (id TEXT PRIMARY KEY)`)
+	db.MustExec(`INSERT INTO things (id) VALUES ('before')`)
+	return db
+}
+
+func count(t *testing.T, path string) int {
+	t.Helper()
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open(%s): %v", path, err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.Get(&n, `SELECT COUNT(*) FROM things`); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	return n
+}
+
+// TestSnapshotRestore verifies that a snapshot of a database in use can be
+// restored over it, keeping the replaced database aside.
+func TestSnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	live := filepath.Join(dir, "myhome.db")
+	db := newTestDB(t, live)
+
+	snapshot := filepath.Join(dir, "backup.db")
+	if err := Snapshot(ctx, db, snapshot); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if err := Snapshot(ctx, db, snapshot); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Snapshot over an existing file: got %v, want ErrExist", err)
+	}
+	db.MustExec(`INSERT INTO things (id) VALUES ('after')`)
+	db.Close()
+
+	restoredAt := time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)
+	now = func() time.Time { return restoredAt }
+	t.Cleanup(func() { now = time.Now })
+
+	kept, err := Restore(ctx, snapshot, live, "things")
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if want := live + ".pre-restore-20261017T030000Z"; kept != want {
+		t.Errorf("kept: got %q, want %q", kept, want)
+	}
+	if n := count(t, live); n != 1 {
+		t.Errorf("restored rows: got %d, want 1", n)
+	}
+	if n := count(t, kept); n != 2 {
+		t.Errorf("pre-restore rows: got %d, want 2", n)
+	}
+
+	// A second restore within the same second must not overwrite the
+	// database kept aside by the first.
+	if _, err := Restore(ctx, snapshot, live, "things"); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Restore over a kept database: got %v, want ErrExist", err)
+	}
+	if n := count(t, kept); n != 2 {
+		t.Errorf("pre-restore rows after a refused restore: got %d, want 2", n)
+	}
+
+	if _, err := Restore(ctx, filepath.Join(dir, "missing.db"), live); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Restore of a missing backup: got %v, want ErrNotExist", err)
+	}
+}
+
+// TestVerify_RejectsCorruptFiles verifies that a file which is not a sound
+// database is refused, and never restored.
+func TestVerify_RejectsCorruptFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.db")
+	if err := os.WriteFile(garbage, []byte("not a database, not at all, really not"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(ctx, garbage); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Verify: got %v, want ErrCorrupt", err)
+	}
+
+	live := filepath.Join(dir, "myhome.db")
+	newTestDB(t, live).Close()
+	if _, err := Restore(ctx, garbage, live); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Restore: got %v, want ErrCorrupt", err)
+	}
+	if n := count(t, live); n != 1 {
+		t.Errorf("rows after a refused restore: got %d, want 1", n)
+	}
+}
+
+// TestScheduler verifies that snapshots are taken when due and rotated.
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	live := filepath.Join(dir, "myhome.db")
+	db := newTestDB(t, live)
+	snapshots := filepath.Join(dir, "snapshots")
+	if err := os.Mkdir(snapshots, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s := NewScheduler(testr.New(t), snapshots, time.Hour, 2, Source{Name: "myhome", Path: live})
+
+	// The daemon's single-connection pool stays usable while snapshots are
+	// taken on their own connection.
+	tx, err := db.Beginx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	tx.MustExec(`INSERT INTO things (id) VALUES ('pending')`)
+
+	now := time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)
+	if d := s.untilDue(now); d != 0 {
+		t.Errorf("due without snapshots: got %v, want 0", d)
+	}
+	for i := range 3 {
+		s.SnapshotAll(ctx, now.Add(time.Duration(i)*time.Hour))
+	}
+	got, err := Snapshots(snapshots, "myhome")
+	if err != nil {
+		t.Fatalf("Snapshots: %v", err)
+	}
+	want := []string{
+		SnapshotPath(snapshots, "myhome", now.Add(time.Hour)),
+		SnapshotPath(snapshots, "myhome", now.Add(2*time.Hour)),
+	}
+	if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("snapshots: got %v, want %v", got, want)
+	}
+	if d := s.untilDue(now.Add(2*time.Hour + 20*time.Minute)); d != 40*time.Minute {
+		t.Errorf("due: got %v, want 40m", d)
+	}
+}
+
+// TestScheduler_FailingSource verifies that a source that fails to snapshot
+// is retried an interval later, without snapshotting the healthy ones again
+// meanwhile.
+func TestScheduler_FailingSource(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	live := filepath.Join(dir, "myhome.db")
+	newTestDB(t, live)
+	snapshots := filepath.Join(dir, "snapshots")
+	if err := os.Mkdir(snapshots, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s := NewScheduler(testr.New(t), snapshots, time.Hour, 5,
+		Source{Name: "myhome", Path: live},
+		Source{Name: "events", Path: filepath.Join(dir, "missing.db")})
+
+	now := time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)
+	if due := s.dueSources(now); len(due) != 2 {
+		t.Fatalf("due without snapshots: got %v, want both sources", due)
+	}
+	s.snapshot(ctx, now, s.dueSources(now))
+	if d := s.untilDue(now); d != time.Hour {
+		t.Errorf("due after a failed snapshot: got %v, want 1h", d)
+	}
+	if due := s.dueSources(now.Add(30 * time.Minute)); len(due) != 0 {
+		t.Errorf("due before the interval: got %v, want none", due)
+	}
+
+	// The failing source keeps failing, the healthy one is snapshotted once
+	// per interval.
+	later := now.Add(time.Hour)
+	if due := s.dueSources(later); len(due) != 2 {
+		t.Fatalf("due after the interval: got %v, want both sources", due)
+	}
+	s.snapshot(ctx, later, s.dueSources(later))
+	got, err := Snapshots(snapshots, "myhome")
+	if err != nil {
+		t.Fatalf("Snapshots: %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("snapshots: got %v, want 2", got)
+	}
+	if d := s.untilDue(later.Add(time.Minute)); d != 59*time.Minute {
+		t.Errorf("due: got %v, want 59m", d)
+	}
+}
+
+// TestRestore_RejectsOtherDatabases verifies that a sound backup of another
+// database is refused, and never restored.
+func TestRestore_RejectsOtherDatabases(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	live := filepath.Join(dir, "myhome.db")
+	newTestDB(t, live).Close()
+
+	other := filepath.Join(dir, "events.db")
+	db, err := sqlx.Connect("sqlite", other)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	db.MustExec(`CREATE TABLE events (id INTEGER PRIMARY KEY)`)
+	db.Close()
+
+	if _, err := Restore(ctx, other, live, "things"); !errors.Is(err, ErrWrongDatabase) {
+		t.Fatalf("Restore: got %v, want ErrWrongDatabase", err)
+	}
+	if n := count(t, live); n != 1 {
+		t.Errorf("rows after a refused restore: got %d, want 1", n)
+	}
+	if err := CheckTables(ctx, live, "things"); err != nil {
+		t.Errorf("CheckTables: %v", err)
+	}
+}
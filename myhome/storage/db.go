@@ -7,6 +7,7 @@ import (
 	"net"
 
 	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/storage/migrate"
 
 	"github.com/go-logr/logr"
 	"github.com/jmoiron/sqlx"
@@ -60,8 +61,15 @@ func NewDeviceStorage(log logr.Logger, dbName string) (*DeviceStorage, error) {
 	return storage, nil
 }
 
-func (s *DeviceStorage) createTable() error {
-	schema := `
+// Migrations is the versioned schema of the devices table, applied by
+// NewDeviceStorage (see myhome/storage/migrate).
+var Migrations = migrate.Set{
+	Subsystem: "devices",
+	Migrations: []migrate.Migration{
+		{
+			Version: 1,
+			Name:    "create devices",
+			Up: `
     CREATE TABLE IF NOT EXISTS devices (
         manufacturer TEXT NOT NULL,
         id TEXT NOT NULL,
@@ -71,83 +79,80 @@ func (s *DeviceStorage) createTable() error {
         info TEXT,
         config_revision INTEGER,  -- New column for config revision
         config TEXT,
-        room_id TEXT DEFAULT '',  -- Room this device belongs to (optional)
         PRIMARY KEY (manufacturer, id)
-    );`
-
-	res, err := s.db.Exec(schema)
-	if err != nil {
-		s.log.Error(err, "Failed to create database schema")
-		return err
-	}
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		s.log.Error(err, "Failed to get rows affected")
-		return err
-	}
-	if rowsAffected > 0 {
-		s.log.Info("Created database schema")
-	}
-
-	// Drop group tables if they exist (migration from previous version)
-	migrationSchema := `
+    );`,
+			Down: `DROP TABLE devices;`,
+		},
+		{
+			// Groups were removed from the devices database; there is no
+			// bringing them back.
+			Version: 2,
+			Name:    "drop groups",
+			Up: `
     DROP TABLE IF EXISTS groupsMember;
-    DROP TABLE IF EXISTS groups;`
-
-	res, err = s.db.Exec(migrationSchema)
-	if err != nil {
-		s.log.Error(err, "Failed to drop group tables during migration")
-		// Don't return error - tables might not exist
-	}
-	rowsAffected, err = res.RowsAffected()
-	if err != nil {
-		s.log.Error(err, "Failed to get rows affected")
-		// Don't return error - tables might not exist
-	}
-	if rowsAffected > 0 {
-		s.log.Info("Dropped group tables during migration")
-	}
-
-	// Migration: Add room_id column if it doesn't exist
-	var count int
-	query := `SELECT COUNT(*) FROM pragma_table_info('devices') WHERE name='room_id'`
-	err = s.db.Get(&count, query)
-	if err != nil {
-		s.log.Error(err, "Failed to check for room_id column")
-		return err
-	}
-	if count == 0 {
-		s.log.Info("Adding room_id column to devices table")
-		alterQuery := `ALTER TABLE devices ADD COLUMN room_id TEXT DEFAULT ''`
-		res, err = s.db.Exec(alterQuery)
-		if err != nil {
-			s.log.Error(err, "Failed to add room_id column")
-			return err
-		}
-		rowsAffected, err = res.RowsAffected()
-		if err != nil {
-			s.log.Error(err, "Failed to get rows affected")
-			// Don't return error - tables might not exist
-		}
-	}
+    DROP TABLE IF EXISTS groups;`,
+		},
+		{
+			Version: 3,
+			Name:    "add devices.room_id",
+			UpFunc: func(ctx context.Context, tx *sqlx.Tx) error {
+				exists, err := migrate.ColumnExists(ctx, tx, "devices", "room_id")
+				if err != nil || exists {
+					return err
+				}
+				_, err = tx.ExecContext(ctx, `ALTER TABLE devices ADD COLUMN room_id TEXT DEFAULT ''`) // Room this device belongs to (optional)
+				return err
+			},
+			Down: `ALTER TABLE devices DROP COLUMN room_id;`,
+		},
+		{
+			Version: 4,
+			Name:    "rewrite cached IPs to hostnames",
+			UpFunc: func(ctx context.Context, tx *sqlx.Tx) error {
+				return migrateHostsToHostnames(ctx, tx)
+			},
+		},
+		{
+			Version: 5,
+			Name:    "create device_history",
+			Up:      createDeviceHistory,
+			Down:    `DROP TABLE device_history;`,
+		},
+		{
+			Version: 6,
+			Name:    "create device_auth",
+			Up:      createDeviceAuth,
+			Down:    `DROP TABLE device_auth;`,
+		},
+	},
+}
 
-	if err := s.migrateHostsToHostnames(); err != nil {
+func (s *DeviceStorage) createTable() error {
+	ctx := logr.NewContext(context.Background(), s.log)
+	if err := migrate.Ensure(ctx, s.db, Migrations); err != nil {
+		s.log.Error(err, "Failed to migrate database schema")
 		return err
 	}
-
 	return nil
 }
 
+// migrateHostsToHostnames re-runs the version 4 migration of the devices
+// table.
+func (s *DeviceStorage) migrateHostsToHostnames() error {
+	return migrateHostsToHostnames(logr.NewContext(context.Background(), s.log), s.db)
+}
+
 // migrateHostsToHostnames replaces any literal IP address left in the host
 // column (from before #252) with "<id>.local". host is no longer written
 // with a live-resolved IP (see docs/no-ip-address-plan.md); a pre-existing
 // IP is stale by definition — the device may have moved to a different
 // address since it was last cached — so it is rewritten to the device's
 // mDNS-resolvable hostname instead of being left permanently wrong.
-func (s *DeviceStorage) migrateHostsToHostnames() error {
-	rows, err := s.db.Query(`SELECT rowid, id, host FROM devices WHERE host != ''`)
+func migrateHostsToHostnames(ctx context.Context, db sqlx.ExtContext) error {
+	log := logr.FromContextOrDiscard(ctx)
+	rows, err := db.QueryContext(ctx, `SELECT rowid, id, host FROM devices WHERE host != ''`)
 	if err != nil {
-		s.log.Error(err, "Failed to query devices for host migration")
+		log.Error(err, "Failed to query devices for host migration")
 		return err
 	}
 
@@ -161,7 +166,7 @@ func (s *DeviceStorage) migrateHostsToHostnames() error {
 		var id, host string
 		if err := rows.Scan(&rowid, &id, &host); err != nil {
 			rows.Close()
-			s.log.Error(err, "Failed to scan device row during host migration")
+			log.Error(err, "Failed to scan device row during host migration")
 			return err
 		}
 		if net.ParseIP(host) != nil {
@@ -170,19 +175,19 @@ func (s *DeviceStorage) migrateHostsToHostnames() error {
 	}
 	if err := rows.Err(); err != nil {
 		rows.Close()
-		s.log.Error(err, "Failed to iterate devices during host migration")
+		log.Error(err, "Failed to iterate devices during host migration")
 		return err
 	}
 	rows.Close()
 
 	for _, r := range stale {
-		if _, err := s.db.Exec(`UPDATE devices SET host = ? WHERE rowid = ?`, r.id+".local", r.rowid); err != nil {
-			s.log.Error(err, "Failed to migrate cached IP to hostname", "id", r.id)
+		if _, err := db.ExecContext(ctx, `UPDATE devices SET host = ? WHERE rowid = ?`, r.id+".local", r.rowid); err != nil {
+			log.Error(err, "Failed to migrate cached IP to hostname", "id", r.id)
 			return err
 		}
 	}
 	if len(stale) > 0 {
-		s.log.Info("Migrated cached IP addresses in devices DB to mDNS hostnames", "count", len(stale))
+		log.Info("Migrated cached IP addresses in devices DB to mDNS hostnames", "count", len(stale))
 	}
 
 	return nil
@@ -224,6 +229,20 @@ func (s *DeviceStorage) SetDevice(ctx context.Context, device *myhome.Device, ov
 	d.Config_ = string(b)
 	s.log.V(1).Info("Marshalled device config", "device_id", device.Id(), "config_length", len(d.Config_), "config_is_null", device.Config == nil)
 
+	// The previous info, config and revision are read in the same
+	// transaction as the update, to record the change in device_history.
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		s.log.Error(err, "Failed to begin device update", "device", device)
+		return false, err
+	}
+	defer tx.Rollback()
+	old, err := storedConfigOf(ctx, tx, &d)
+	if err != nil {
+		s.log.Error(err, "Failed to read stored device config", "device", device)
+		return false, err
+	}
+
 	// Number of rows affected by the SQL
 	var count int64
 
@@ -247,7 +266,7 @@ func (s *DeviceStorage) SetDevice(ctx context.Context, device *myhome.Device, ov
        OR devices.config_revision IS DISTINCT FROM excluded.config_revision
        OR devices.config IS DISTINCT FROM excluded.config
        OR devices.room_id IS DISTINCT FROM excluded.room_id`
-	rows, err := s.db.NamedExec(query, d)
+	rows, err := tx.NamedExec(query, d)
 	if err != nil {
 		s.log.Error(err, "Failed to upsert device by manufacturer and id", "device", device)
 		return false, err
@@ -257,12 +276,9 @@ func (s *DeviceStorage) SetDevice(ctx context.Context, device *myhome.Device, ov
 		s.log.Error(err, "Failed to upsert device by manufacturer and id", "device", device)
 		return false, err
 	}
-	if count > 0 {
-		return true, nil
-	}
 
 	// If MAC address is provided, also handle conflicts based on MAC address
-	if d.MAC != "" {
+	if count == 0 && d.MAC != "" {
 		macQuery := `
     UPDATE devices SET 
         manufacturer = :manufacturer,
@@ -274,7 +290,7 @@ func (s *DeviceStorage) SetDevice(ctx context.Context, device *myhome.Device, ov
         config = :config
     WHERE mac = :mac`
 
-		rows, err := s.db.NamedExec(macQuery, d)
+		rows, err := tx.NamedExec(macQuery, d)
 		if err != nil {
 			s.log.Error(err, "Failed to update device by MAC address", "device", device)
 			return false, err
@@ -284,12 +300,20 @@ func (s *DeviceStorage) SetDevice(ctx context.Context, device *myhome.Device, ov
 			s.log.Error(err, "Failed to update device by MAC address", "device", device)
 			return false, err
 		}
-		if count > 0 {
-			return true, nil
-		}
+	}
+	if count == 0 {
+		return false, nil
 	}
 
-	return false, nil
+	if err := recordHistory(ctx, tx, old, &d); err != nil {
+		s.log.Error(err, "Failed to record device history", "device", device)
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		s.log.Error(err, "Failed to commit device update", "device", device)
+		return false, err
+	}
+	return true, nil
 }
 
 // GetAllDevices retrieves all devices from the database.
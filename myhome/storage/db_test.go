@@ -2,9 +2,12 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"path/filepath"
 	"testing"
 
 	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/myhome/storage/migrate"
 
 	"github.com/go-logr/logr/testr"
 )
@@ -50,6 +53,24 @@ func TestNewDeviceStorage_CreatesSchema(t *testing.T) {
 	}
 }
 
+// TestNewDeviceStorage_RefusesFutureSchema verifies that a database migrated
+// by a newer myhome is refused rather than used.
+func TestNewDeviceStorage_RefusesFutureSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "myhome.db")
+	s, err := NewDeviceStorage(testr.New(t), path)
+	if err != nil {
+		t.Fatalf("NewDeviceStorage: %v", err)
+	}
+	next := Migrations.Latest() + 1
+	s.db.MustExec(`INSERT INTO schema_migrations (subsystem, version, name, applied_at) VALUES (?, ?, 'from the future', CURRENT_TIMESTAMP)`,
+		Migrations.Subsystem, next)
+	s.Close()
+
+	if _, err := NewDeviceStorage(testr.New(t), path); !errors.Is(err, migrate.ErrFutureSchema) {
+		t.Fatalf("NewDeviceStorage: got %v, want ErrFutureSchema", err)
+	}
+}
+
 // TestMigrateHostsToHostnames_RewritesLegacyIPs verifies that a pre-existing
 // literal IP in host (left over from before #252) is rewritten to
 // "<id>.local" the next time the storage opens, while a non-IP host value
@@ -71,8 +92,8 @@ func TestMigrateHostsToHostnames_RewritesLegacyIPs(t *testing.T) {
 		t.Fatalf("SetDevice noHost: %v", err)
 	}
 
-	// Re-running the migration (as NewDeviceStorage does on every open) must
-	// be idempotent and only touch the row that had a literal IP.
+	// Re-running the migration (NewDeviceStorage already applied it) must be
+	// idempotent and only touch the row that had a literal IP.
 	if err := s.migrateHostsToHostnames(); err != nil {
 		t.Fatalf("migrateHostsToHostnames: %v", err)
 	}
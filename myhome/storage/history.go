@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/jmoiron/sqlx"
+)
+
+// createDeviceHistory is the version 5 migration of the devices database: an
+// audit log of the changes stored to each device's info, config and config
+// revision, which SetDevice otherwise overwrites in place.
+const createDeviceHistory = `
+    CREATE TABLE IF NOT EXISTS device_history (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts TEXT NOT NULL,
+        manufacturer TEXT NOT NULL,
+        device_id TEXT NOT NULL,
+        source TEXT NOT NULL,         -- refresh, reconcile, setup or user
+        principal TEXT,               -- RPC caller, if any
+        old_revision INTEGER NOT NULL,
+        new_revision INTEGER NOT NULL,
+        diff TEXT NOT NULL            -- JSON array of myhome.ConfigChange
+    );
+    CREATE INDEX IF NOT EXISTS idx_device_history_device ON device_history(device_id, ts);`
+
+// DefaultHistoryLimit is the number of entries DeviceHistory returns when
+// not given a limit.
+const DefaultHistoryLimit = 100
+
+// storedConfig is the part of a stored device whose changes are recorded in
+// device_history.
+type storedConfig struct {
+	Info     sql.NullString `db:"info"`
+	Config   sql.NullString `db:"config"`
+	Revision sql.NullInt64  `db:"config_revision"`
+}
+
+// storedConfigOf returns the stored info, config and revision of d, found by
+// manufacturer and id, else by MAC address, or nil for a new device.
+func storedConfigOf(ctx context.Context, tx *sqlx.Tx, d *Device) (*storedConfig, error) {
+	var old storedConfig
+	err := tx.GetContext(ctx, &old, `SELECT info, config, config_revision FROM devices WHERE manufacturer = ? AND id = ?`, d.Manufacturer(), d.Id())
+	if errors.Is(err, sql.ErrNoRows) && d.MAC != "" {
+		err = tx.GetContext(ctx, &old, `SELECT info, config, config_revision FROM devices WHERE mac = ?`, d.MAC)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &old, nil
+}
+
+// recordHistory adds an entry to device_history if the info, config or
+// config revision stored for d differs from old (nil for a new device). The
+// source and principal of the change are taken from ctx.
+func recordHistory(ctx context.Context, tx *sqlx.Tx, old *storedConfig, d *Device) error {
+	if old == nil {
+		old = &storedConfig{}
+	}
+	var changes []myhome.ConfigChange
+	for _, part := range []struct {
+		path     string
+		old, new string
+	}{
+		{"info", old.Info.String, d.Info_},
+		{"config", old.Config.String, d.Config_},
+	} {
+		c, err := diffJSON(part.path, part.old, part.new)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, c...)
+	}
+	oldRevision := uint32(old.Revision.Int64)
+	if len(changes) == 0 && oldRevision == d.ConfigRevision {
+		return nil
+	}
+	if changes == nil {
+		changes = []myhome.ConfigChange{} // Revision bump alone
+	}
+	diff, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	var principal sql.NullString
+	if c, ok := myhome.CallerFromContext(ctx); ok {
+		principal = sql.NullString{String: c.Principal, Valid: true}
+	}
+	_, err = tx.ExecContext(ctx, `
+    INSERT INTO device_history (ts, manufacturer, device_id, source, principal, old_revision, new_revision, diff)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		time.Now().UTC().Format(time.RFC3339Nano), d.Manufacturer(), d.Id(),
+		string(myhome.ChangeSourceFromContext(ctx)), principal, oldRevision, d.ConfigRevision, string(diff))
+	return err
+}
+
+// DeviceHistory returns the most recent changes (at most limit, or
+// DefaultHistoryLimit) stored for the device deviceId, newest first. A
+// non-empty path keeps only the changes at or under it, e.g. "config.mqtt",
+// and the entries holding any.
+func (s *DeviceStorage) DeviceHistory(ctx context.Context, deviceId string, path string, limit int) ([]myhome.DeviceHistoryEntry, error) {
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	query := `SELECT id, ts, device_id, source, principal, old_revision, new_revision, diff FROM device_history WHERE device_id = ? ORDER BY id DESC`
+	args := []any{deviceId}
+	if path == "" {
+		// With a path, entries are filtered after decoding their diff.
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		s.log.Error(err, "Failed to query device history", "device_id", deviceId)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]myhome.DeviceHistoryEntry, 0)
+	for rows.Next() && len(entries) < limit {
+		var e myhome.DeviceHistoryEntry
+		var ts, diff string
+		var principal sql.NullString
+		if err := rows.Scan(&e.Id, &ts, &e.DeviceId, &e.Source, &principal, &e.OldRevision, &e.NewRevision, &diff); err != nil {
+			s.log.Error(err, "Failed to scan device history", "device_id", deviceId)
+			return nil, err
+		}
+		e.Ts, _ = time.Parse(time.RFC3339Nano, ts)
+		e.Principal = principal.String
+		if err := json.Unmarshal([]byte(diff), &e.Changes); err != nil {
+			s.log.Error(err, "Failed to unmarshal device history diff", "id", e.Id)
+			return nil, err
+		}
+		if path != "" {
+			e.Changes = changesUnder(e.Changes, path)
+			if len(e.Changes) == 0 {
+				continue
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// changesUnder returns the changes at path or under it.
+func changesUnder(changes []myhome.ConfigChange, path string) []myhome.ConfigChange {
+	var under []myhome.ConfigChange
+	for _, c := range changes {
+		if c.Path == path || strings.HasPrefix(c.Path, path+".") {
+			under = append(under, c)
+		}
+	}
+	return under
+}
+
+// diffJSON returns the changes from the JSON document old to new, under
+// path, sorted by path. Objects are compared member by member; any other
+// value, arrays included, is compared as a whole. An empty or "null"
+// document is absent: all of the other one is added or removed.
+func diffJSON(path string, old, new string) ([]myhome.ConfigChange, error) {
+	o, err := decodeJSON(old)
+	if err != nil {
+		return nil, err
+	}
+	n, err := decodeJSON(new)
+	if err != nil {
+		return nil, err
+	}
+	var changes []myhome.ConfigChange
+	diffValues(path, o, n, &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// absent stands for a missing object member, or a missing document.
+type absent struct{}
+
+func decodeJSON(doc string) (any, error) {
+	if doc == "" || doc == "null" {
+		return absent{}, nil
+	}
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber() // Keep numbers exactly as stored
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func diffValues(path string, old, new any, changes *[]myhome.ConfigChange) {
+	om, oIsMap := old.(map[string]any)
+	nm, nIsMap := new.(map[string]any)
+	if oIsMap && nIsMap {
+		for k, ov := range om {
+			nv, ok := nm[k]
+			if !ok {
+				nv = absent{}
+			}
+			diffValues(path+"."+k, ov, nv, changes)
+		}
+		for k, nv := range nm {
+			if _, ok := om[k]; !ok {
+				diffValues(path+"."+k, absent{}, nv, changes)
+			}
+		}
+		return
+	}
+	o, n := encodeJSON(old), encodeJSON(new)
+	if !bytes.Equal(o, n) {
+		*changes = append(*changes, myhome.ConfigChange{Path: path, Old: o, New: n})
+	}
+}
+
+// encodeJSON returns v as compact JSON, or nil if absent.
+func encodeJSON(v any) json.RawMessage {
+	if _, ok := v.(absent); ok {
+		return nil
+	}
+	b, _ := json.Marshal(v) // Decoded from JSON: always encodes
+	return b
+}
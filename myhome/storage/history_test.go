@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asnowfix/home-automation/internal/myhome"
+	"github.com/asnowfix/home-automation/pkg/shelly/mqtt"
+	"github.com/asnowfix/home-automation/pkg/shelly/shelly"
+)
+
+// TestSetDevice_RecordsHistory verifies that stored config changes are
+// recorded with their source, caller and revisions, and that storing the
+// same config again records nothing.
+func TestSetDevice_RecordsHistory(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	d := makeDevice("Shelly", "shellypro3-pool", "aa:bb:cc:dd:ee:30", "pool", "shellypro3-pool.local")
+	d.ConfigRevision = 7
+	d.Config = &shelly.Config{Mqtt: &mqtt.Config{Enable: true, Server: "old-broker:1883"}}
+	if _, err := s.SetDevice(ctx, d, false); err != nil {
+		t.Fatalf("first SetDevice: %v", err)
+	}
+	if _, err := s.SetDevice(ctx, d, true); err != nil {
+		t.Fatalf("unchanged SetDevice: %v", err)
+	}
+
+	d.ConfigRevision = 8
+	d.Config = &shelly.Config{Mqtt: &mqtt.Config{Enable: true, Server: "new-broker:1883"}}
+	userCtx := myhome.WithChangeSource(ctx, myhome.ChangeSourceUser)
+	if _, err := s.SetDevice(userCtx, d, true); err != nil {
+		t.Fatalf("second SetDevice: %v", err)
+	}
+
+	entries, err := s.DeviceHistory(ctx, d.Id(), "", 0)
+	if err != nil {
+		t.Fatalf("DeviceHistory: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries: got %d, want 2: %+v", len(entries), entries)
+	}
+	latest := entries[0]
+	if latest.Source != myhome.ChangeSourceUser || latest.OldRevision != 7 || latest.NewRevision != 8 {
+		t.Errorf("latest entry: got %+v", latest)
+	}
+	if len(latest.Changes) != 1 {
+		t.Fatalf("latest changes: got %+v, want only config.mqtt.server", latest.Changes)
+	}
+	c := latest.Changes[0]
+	if c.Path != "config.mqtt.server" || string(c.Old) != `"old-broker:1883"` || string(c.New) != `"new-broker:1883"` {
+		t.Errorf("change: got %s %s -> %s", c.Path, c.Old, c.New)
+	}
+	if first := entries[1]; first.Source != myhome.ChangeSourceRefresh || first.OldRevision != 0 || first.NewRevision != 7 {
+		t.Errorf("first entry: got %+v", first)
+	}
+
+	entries, err = s.DeviceHistory(ctx, d.Id(), "config.mqtt.server", 0)
+	if err != nil {
+		t.Fatalf("DeviceHistory by path: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Id != latest.Id {
+		t.Errorf("entries under config.mqtt.server: got %+v, want the latest only", entries)
+	}
+}
+
+func TestDiffJSON(t *testing.T) {
+	changes, err := diffJSON("config",
+		`{"mqtt":{"server":"a","enable":true},"sys":{"name":"x"},"list":[1,2]}`,
+		`{"mqtt":{"server":"b","enable":true},"wifi":{"ssid":"home"},"list":[1,3]}`)
+	if err != nil {
+		t.Fatalf("diffJSON: %v", err)
+	}
+	want := []struct{ path, old, new string }{
+		{"config.list", `[1,2]`, `[1,3]`},
+		{"config.mqtt.server", `"a"`, `"b"`},
+		{"config.sys", `{"name":"x"}`, ``},
+		{"config.wifi", ``, `{"ssid":"home"}`},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes: got %+v, want %d", changes, len(want))
+	}
+	for i, w := range want {
+		c := changes[i]
+		if c.Path != w.path || string(c.Old) != w.old || string(c.New) != w.new {
+			t.Errorf("change %d: got %s %s -> %s, want %s %s -> %s", i, c.Path, c.Old, c.New, w.path, w.old, w.new)
+		}
+	}
+
+	if changes, _ := diffJSON("info", "null", "null"); len(changes) != 0 {
+		t.Errorf("null to null: got %+v", changes)
+	}
+}
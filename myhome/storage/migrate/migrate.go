@@ -0,0 +1,224 @@
+// Package migrate applies numbered, ordered schema migrations to the myhome
+// SQLite databases, and records them in a schema_migrations table shared by
+// every subsystem (devices, temperature, fetchproxy... in myhome.db; events
+// in events.db).
+//
+// Each subsystem declares its migrations as a Set, numbered from 1. Version 1
+// creates the subsystem's tables with CREATE TABLE IF NOT EXISTS and later
+// versions are written to be idempotent, so that databases created before
+// schema_migrations existed are adopted by simply running every migration.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrFutureSchema is returned when a database holds a migration this binary
+// does not know: it was written by a newer myhome, and using it could
+// silently corrupt data.
+var ErrFutureSchema = errors.New("database schema is newer than this myhome")
+
+// Migration is one schema change of a subsystem. Up (SQL) runs before UpFunc
+// (Go, for data migrations), Down before DownFunc. A migration with neither
+// Down nor DownFunc rolls back as a no-op: it only migrated data, or dropped
+// obsolete tables that cannot be brought back.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	UpFunc   func(ctx context.Context, tx *sqlx.Tx) error
+	Down     string
+	DownFunc func(ctx context.Context, tx *sqlx.Tx) error
+}
+
+// Set is the ordered migrations of one subsystem.
+type Set struct {
+	Subsystem  string
+	Migrations []Migration
+}
+
+// Latest returns the version the last migration of s brings the schema to.
+func (s Set) Latest() int {
+	if len(s.Migrations) == 0 {
+		return 0
+	}
+	return s.Migrations[len(s.Migrations)-1].Version
+}
+
+func (s Set) validate() error {
+	for i, m := range s.Migrations {
+		if m.Version != i+1 {
+			return fmt.Errorf("%s migration %q: version %d, want %d", s.Subsystem, m.Name, m.Version, i+1)
+		}
+	}
+	return nil
+}
+
+// Applied is a migration recorded in schema_migrations.
+type Applied struct {
+	Subsystem string    `db:"subsystem" json:"subsystem"`
+	Version   int       `db:"version" json:"version"`
+	Name      string    `db:"name" json:"name"`
+	AppliedAt time.Time `db:"applied_at" json:"applied_at"`
+}
+
+// Status is where a subsystem's schema stands.
+type Status struct {
+	Subsystem string      `json:"subsystem"`
+	Current   int         `json:"current"`
+	Latest    int         `json:"latest"`
+	Applied   []Applied   `json:"applied"`
+	Pending   []Migration `json:"-"`
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    subsystem  TEXT      NOT NULL,
+    version    INTEGER   NOT NULL,
+    name       TEXT      NOT NULL,
+    applied_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (subsystem, version)
+);`
+
+// StatusOf returns the status of set in db.
+func StatusOf(ctx context.Context, db *sqlx.DB, set Set) (*Status, error) {
+	if err := set.validate(); err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+	st := &Status{Subsystem: set.Subsystem, Latest: set.Latest()}
+	err := db.SelectContext(ctx, &st.Applied,
+		`SELECT subsystem, version, name, applied_at FROM schema_migrations WHERE subsystem = ? ORDER BY version`, set.Subsystem)
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	if n := len(st.Applied); n > 0 {
+		st.Current = st.Applied[n-1].Version
+	}
+	if st.Current < st.Latest {
+		st.Pending = set.Migrations[st.Current:]
+	}
+	return st, nil
+}
+
+// Ensure brings set up to date in db, as done by each store when it opens.
+// It fails with ErrFutureSchema, without touching anything, if db holds
+// migrations of set newer than this binary knows.
+func Ensure(ctx context.Context, db *sqlx.DB, set Set) error {
+	_, err := Up(ctx, db, set, 0)
+	return err
+}
+
+// Up applies the pending migrations of set up to version to (0 for the
+// latest), each in its own transaction, and returns those applied.
+func Up(ctx context.Context, db *sqlx.DB, set Set, to int) ([]Migration, error) {
+	st, err := StatusOf(ctx, db, set)
+	if err != nil {
+		return nil, err
+	}
+	if st.Current > st.Latest {
+		return nil, fmt.Errorf("%w: %s is at version %d, this myhome only knows up to %d", ErrFutureSchema, set.Subsystem, st.Current, st.Latest)
+	}
+	if to == 0 {
+		to = st.Latest
+	}
+	if to > st.Latest {
+		return nil, fmt.Errorf("%s: no version %d (latest is %d)", set.Subsystem, to, st.Latest)
+	}
+
+	log := logr.FromContextOrDiscard(ctx)
+	var applied []Migration
+	for _, m := range st.Pending {
+		if m.Version > to {
+			break
+		}
+		log.Info("Applying migration", "subsystem", set.Subsystem, "version", m.Version, "name", m.Name)
+		err := inTx(ctx, db, func(tx *sqlx.Tx) error {
+			if err := run(ctx, tx, m.Up, m.UpFunc); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (subsystem, version, name, applied_at) VALUES (?, ?, ?, ?)`,
+				set.Subsystem, m.Version, m.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("%s migration %d (%s): %w", set.Subsystem, m.Version, m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// Down rolls set back to version to (at least 0), newest first, each in its
+// own transaction, and returns the migrations rolled back.
+func Down(ctx context.Context, db *sqlx.DB, set Set, to int) ([]Migration, error) {
+	st, err := StatusOf(ctx, db, set)
+	if err != nil {
+		return nil, err
+	}
+	if st.Current > st.Latest {
+		return nil, fmt.Errorf("%w: %s is at version %d, this myhome only knows up to %d", ErrFutureSchema, set.Subsystem, st.Current, st.Latest)
+	}
+	if to < 0 {
+		return nil, fmt.Errorf("%s: invalid version %d", set.Subsystem, to)
+	}
+
+	log := logr.FromContextOrDiscard(ctx)
+	var reverted []Migration
+	for v := st.Current; v > to; v-- {
+		m := set.Migrations[v-1]
+		log.Info("Reverting migration", "subsystem", set.Subsystem, "version", m.Version, "name", m.Name)
+		err := inTx(ctx, db, func(tx *sqlx.Tx) error {
+			if err := run(ctx, tx, m.Down, m.DownFunc); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE subsystem = ? AND version = ?`, set.Subsystem, m.Version)
+			return err
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("%s migration %d (%s): %w", set.Subsystem, m.Version, m.Name, err)
+		}
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+func run(ctx context.Context, tx *sqlx.Tx, stmt string, fn func(context.Context, *sqlx.Tx) error) error {
+	if stmt != "" {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if fn != nil {
+		return fn(ctx, tx)
+	}
+	return nil
+}
+
+func inTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ColumnExists reports whether table has column, for migrations adopting
+// databases that may or may not have been altered before schema_migrations.
+func ColumnExists(ctx context.Context, tx *sqlx.Tx, table, column string) (bool, error) {
+	var count int
+	err := tx.GetContext(ctx, &count, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column)
+	return count > 0, err
+}
@@ -0,0 +1,165 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+
+	_ "modernc.org/sqlite"
+)
+
+func newTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Connect("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+var testSet = Set{
+	Subsystem: "test",
+	Migrations: []Migration{
+		{Version: 1, Name: "create things", Up: `CREATE TABLE IF NOT EXISTS things (id TEXT PRIMARY KEY)`, Down: `DROP TABLE things`},
+		{
+			Version: 2,
+			Name:    "add things.label",
+			UpFunc: func(ctx context.Context, tx *sqlx.Tx) error {
+				exists, err := ColumnExists(ctx, tx, "things", "label")
+				if err != nil || exists {
+					return err
+				}
+				_, err = tx.ExecContext(ctx, `ALTER TABLE things ADD COLUMN label TEXT DEFAULT ''`)
+				return err
+			},
+			Down: `ALTER TABLE things DROP COLUMN label`,
+		},
+		{Version: 3, Name: "seed things", Up: `INSERT INTO things (id, label) VALUES ('a', 'A')`},
+	},
+}
+
+func current(t *testing.T, db *sqlx.DB, set Set) int {
+	t.Helper()
+	st, err := StatusOf(context.Background(), db, set)
+	if err != nil {
+		t.Fatalf("StatusOf: %v", err)
+	}
+	return st.Current
+}
+
+// TestUpDown verifies that migrations apply in order up to a target, roll
+// back newest first, and that a no-op down only forgets the version.
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	applied, err := Up(ctx, db, testSet, 2)
+	if err != nil || len(applied) != 2 {
+		t.Fatalf("Up to 2: got %d applied, %v", len(applied), err)
+	}
+	if v := current(t, db, testSet); v != 2 {
+		t.Fatalf("current: got %d, want 2", v)
+	}
+	if err := Ensure(ctx, db, testSet); err != nil {
+		t.Fatalf("Ensure: %v", err)
+	}
+	var label string
+	if err := db.Get(&label, `SELECT label FROM things WHERE id = 'a'`); err != nil || label != "A" {
+		t.Fatalf("seeded row: got %q, %v", label, err)
+	}
+
+	reverted, err := Down(ctx, db, testSet, 1)
+	if err != nil || len(reverted) != 2 || reverted[0].Version != 3 {
+		t.Fatalf("Down to 1: got %+v, %v", reverted, err)
+	}
+	tx := db.MustBegin()
+	exists, err := ColumnExists(ctx, tx, "things", "label")
+	tx.Rollback()
+	if err != nil || exists {
+		t.Errorf("things.label after down: exists=%v, %v", exists, err)
+	}
+
+	if _, err := Down(ctx, db, testSet, 0); err != nil {
+		t.Fatalf("Down to 0: %v", err)
+	}
+	if v := current(t, db, testSet); v != 0 {
+		t.Errorf("current after full down: got %d, want 0", v)
+	}
+}
+
+// TestEnsure_AdoptsLegacySchema verifies that a database created before
+// schema_migrations, with the tables already there, is adopted.
+func TestEnsure_AdoptsLegacySchema(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	db.MustExec(`CREATE TABLE things (id TEXT PRIMARY KEY, label TEXT DEFAULT '')`)
+
+	if err := Ensure(ctx, db, testSet); err != nil {
+		t.Fatalf("Ensure: %v", err)
+	}
+	if v := current(t, db, testSet); v != 3 {
+		t.Errorf("current: got %d, want 3", v)
+	}
+}
+
+// TestEnsure_RefusesFutureSchema verifies that a database migrated by a newer
+// binary is left untouched.
+func TestEnsure_RefusesFutureSchema(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	if err := Ensure(ctx, db, testSet); err != nil {
+		t.Fatalf("Ensure: %v", err)
+	}
+
+	older := Set{Subsystem: testSet.Subsystem, Migrations: testSet.Migrations[:2]}
+	if err := Ensure(ctx, db, older); !errors.Is(err, ErrFutureSchema) {
+		t.Fatalf("Ensure with an older binary: got %v, want ErrFutureSchema", err)
+	}
+	if _, err := Down(ctx, db, older, 0); !errors.Is(err, ErrFutureSchema) {
+		t.Errorf("Down with an older binary: got %v, want ErrFutureSchema", err)
+	}
+	if v := current(t, db, testSet); v != 3 {
+		t.Errorf("current: got %d, want 3", v)
+	}
+}
+
+// TestUp_RollsBackFailedMigration verifies that a failing migration leaves
+// neither its changes nor its version behind, and that subsystems are
+// versioned independently.
+func TestUp_RollsBackFailedMigration(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	if err := Ensure(ctx, db, testSet); err != nil {
+		t.Fatalf("Ensure: %v", err)
+	}
+
+	broken := Set{
+		Subsystem: "broken",
+		Migrations: []Migration{
+			{Version: 1, Name: "ok", Up: `CREATE TABLE others (id TEXT)`},
+			{Version: 2, Name: "fails", Up: `INSERT INTO others (id) VALUES ('x'); INSERT INTO nowhere VALUES (1)`},
+		},
+	}
+	if err := Ensure(ctx, db, broken); err == nil {
+		t.Fatal("Ensure: expected an error")
+	}
+	if v := current(t, db, broken); v != 1 {
+		t.Errorf("broken current: got %d, want 1", v)
+	}
+	var count int
+	if err := db.Get(&count, `SELECT COUNT(*) FROM others`); err != nil || count != 0 {
+		t.Errorf("others rows: got %d, %v", count, err)
+	}
+	if v := current(t, db, testSet); v != 3 {
+		t.Errorf("test current: got %d, want 3", v)
+	}
+
+	gap := Set{Subsystem: "gap", Migrations: []Migration{{Version: 2, Name: "two"}}}
+	if err := Ensure(ctx, db, gap); err == nil {
+		t.Error("Ensure of a set not numbered from 1: expected an error")
+	}
+}
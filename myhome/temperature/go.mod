@@ -5,6 +5,7 @@ go 1.25.0
 require (
 	github.com/asnowfix/home-automation/internal/myhome v0.0.0-00010101000000-000000000000
 	github.com/asnowfix/home-automation/myhome/mqtt v0.0.0-00010101000000-000000000000
+	github.com/asnowfix/home-automation/myhome/storage v0.0.0-00010101000000-000000000000
 	github.com/go-logr/logr v1.4.3
 	github.com/jmoiron/sqlx v1.4.0
 	github.com/spf13/viper v1.21.0
@@ -15,6 +16,8 @@ replace github.com/asnowfix/home-automation/internal/myhome => ../../internal/my
 
 replace github.com/asnowfix/home-automation/myhome/mqtt => ../mqtt
 
+replace github.com/asnowfix/home-automation/myhome/storage => ../storage
+
 require (
 	github.com/cenkalti/backoff v2.2.1+incompatible // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
@@ -1,6 +1,7 @@
 package temperature
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -10,6 +11,8 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/jmoiron/sqlx"
 	_ "modernc.org/sqlite"
+
+	"github.com/asnowfix/home-automation/myhome/storage/migrate"
 )
 
 // Type aliases for convenience
@@ -60,9 +63,15 @@ func NewStorage(log logr.Logger, db *sqlx.DB) (*Storage, error) {
 	return storage, nil
 }
 
-// createTables creates the temperature configuration tables
-func (s *Storage) createTables() error {
-	schema := `
+// Migrations is the versioned schema of the temperature configuration
+// tables, applied by NewStorage (see myhome/storage/migrate).
+var Migrations = migrate.Set{
+	Subsystem: "temperature",
+	Migrations: []migrate.Migration{
+		{
+			Version: 1,
+			Name:    "create temperature tables",
+			Up: `
 	CREATE TABLE IF NOT EXISTS temperature_rooms (
 		room_id TEXT PRIMARY KEY,
 		name TEXT NOT NULL,
@@ -87,10 +96,20 @@ func (s *Storage) createTables() error {
 	
 	CREATE INDEX IF NOT EXISTS idx_temperature_rooms_updated 
 		ON temperature_rooms(updated_at);
-	`
+	`,
+			Down: `
+	DROP TABLE temperature_weekday_defaults;
+	DROP TABLE temperature_kind_schedules;
+	DROP TABLE temperature_rooms;
+	`,
+		},
+	},
+}
 
-	_, err := s.db.Exec(schema)
-	if err != nil {
+// createTables creates or migrates the temperature configuration tables
+func (s *Storage) createTables() error {
+	ctx := logr.NewContext(context.Background(), s.log)
+	if err := migrate.Ensure(ctx, s.db, Migrations); err != nil {
 		s.log.Error(err, "Failed to create temperature tables")
 		return err
 	}
@@ -0,0 +1,238 @@
+package shelly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	scripts "github.com/asnowfix/home-automation/internal/shelly/scripts"
+	"github.com/asnowfix/home-automation/pkg/shelly/ble"
+	"github.com/asnowfix/home-automation/pkg/shelly/cover"
+	"github.com/asnowfix/home-automation/pkg/shelly/devicepower"
+	"github.com/asnowfix/home-automation/pkg/shelly/em"
+	"github.com/asnowfix/home-automation/pkg/shelly/ethernet"
+	"github.com/asnowfix/home-automation/pkg/shelly/input"
+	"github.com/asnowfix/home-automation/pkg/shelly/kvs"
+	"github.com/asnowfix/home-automation/pkg/shelly/light"
+	"github.com/asnowfix/home-automation/pkg/shelly/matter"
+	"github.com/asnowfix/home-automation/pkg/shelly/mqtt"
+	"github.com/asnowfix/home-automation/pkg/shelly/pm1"
+	"github.com/asnowfix/home-automation/pkg/shelly/ratelimit"
+	"github.com/asnowfix/home-automation/pkg/shelly/schedule"
+	"github.com/asnowfix/home-automation/pkg/shelly/script"
+	"github.com/asnowfix/home-automation/pkg/shelly/shelly"
+	shttp "github.com/asnowfix/home-automation/pkg/shelly/shttp"
+	"github.com/asnowfix/home-automation/pkg/shelly/sswitch"
+	sudp "github.com/asnowfix/home-automation/pkg/shelly/sudp"
+	sws "github.com/asnowfix/home-automation/pkg/shelly/sws"
+	"github.com/asnowfix/home-automation/pkg/shelly/system"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+	"github.com/asnowfix/home-automation/pkg/shelly/virtual"
+	"github.com/asnowfix/home-automation/pkg/shelly/webhook"
+	"github.com/asnowfix/home-automation/pkg/shelly/wifi"
+
+	"github.com/go-logr/logr"
+)
+
+// Client talks to Shelly devices with its own registrar of methods and
+// channels, MQTT client, device credentials, rate limiter and host
+// resolver: one process can
+// hold several, e.g. one per MQTT broker, and tests can run in parallel.
+// Devices are bound to the Client that created them (see
+// NewDeviceFromSummary); the package-level functions use the default Client
+// set up by Init.
+type Client struct {
+	log       logr.Logger
+	registrar Registrar
+	mqtt      mqtt.Client
+	limiter   *ratelimit.RateLimiter
+	http      *shttp.HttpChannel
+	udp       *sudp.UdpChannel
+	ws        *sws.WsChannel
+
+	resolverMutex sync.RWMutex
+	resolver      types.HostResolver
+
+	// MQTT channels per device id, shared by the Device values of the same
+	// device (see DeviceMqttChannels)
+	mqttChannelsMutex sync.RWMutex
+	mqttChannels      map[string]*DeviceMqttChannels
+}
+
+// ErrNotInitialized is returned by the methods of a Client not created by
+// NewClient, e.g. the default Client before Init.
+var ErrNotInitialized = errors.New("shelly client not initialized (see shelly.Init)")
+
+// NewClient returns a Client using mc for the MQTT channel. timeout bounds
+// each call, rateLimitInterval spaces the calls to each device (0: no
+// limit), and udpPort is the rpc_udp.listen_port assumed for devices called
+// over UDP (0: none).
+func NewClient(log logr.Logger, mc mqtt.Client, timeout time.Duration, rateLimitInterval time.Duration, udpPort uint16) *Client {
+	log.Info("Init", "package", reflect.TypeOf(empty{}).PkgPath(), "rateLimit", rateLimitInterval)
+	c := &Client{
+		log:          log,
+		mqtt:         mc,
+		limiter:      ratelimit.New(rateLimitInterval),
+		mqttChannels: make(map[string]*DeviceMqttChannels),
+	}
+	r := &c.registrar
+	r.Init(log)
+
+	// Keep in lexical order
+	// gen1.Init(log, r)
+	shelly.Init(log, r, timeout)
+	ble.Init(log, r)
+	cover.Init(log, r)
+	devicepower.Init(log, r)
+	em.Init(log, r)
+	ethernet.Init(log, r)
+	input.Init(log, r)
+	kvs.Init(log, r)
+	light.Init(log, r)
+	matter.Init(log, r)
+	mqtt.Init(log, r, timeout)
+	pm1.Init(log, r)
+	schedule.Init(log, r)
+	script.Init(log, r, scripts.GetFS())
+	c.http = shttp.Init(log, r)
+	sswitch.Init(log, r)
+	c.udp = sudp.Init(log, r, udpPort, timeout)
+	c.ws = sws.Init(log, r, timeout)
+	system.Init(log, r)
+	// temperature.Init(log, r)
+	virtual.Init(log, r)
+	webhook.Init(log, r)
+	wifi.Init(log, r)
+	return c
+}
+
+// Close releases the sockets and connections of c's channels.
+func (c *Client) Close() {
+	if c.udp != nil {
+		c.udp.Close()
+	}
+	if c.ws != nil {
+		c.ws.Close()
+	}
+}
+
+// Registrar returns the methods and channels registrar of c.
+func (c *Client) Registrar() *Registrar {
+	return &c.registrar
+}
+
+// SetHostResolver installs the resolver used to (re-)resolve a device's IP
+// address when it is unknown, or immediately after an HTTP dial failure.
+// See types.HostResolver. nil (the default) disables resolution.
+func (c *Client) SetHostResolver(r types.HostResolver) {
+	c.resolverMutex.Lock()
+	defer c.resolverMutex.Unlock()
+	c.resolver = r
+}
+
+// resolveHost calls the installed HostResolver, if any. ok is false if no
+// resolver is installed, or the installed one could not find an address.
+func (c *Client) resolveHost(ctx context.Context, mac net.HardwareAddr, name string) (ip net.IP, ok bool) {
+	c.resolverMutex.RLock()
+	resolver := c.resolver
+	c.resolverMutex.RUnlock()
+	if resolver == nil {
+		return nil, false
+	}
+	log := logr.FromContextOrDiscard(ctx)
+	start := time.Now()
+	ip, err := resolver.ResolveHost(ctx, mac, name)
+	log.Info("ResolveHost", "mac", mac, "name", name, "ip", ip, "err", err, "elapsed", time.Since(start))
+	if err != nil || ip == nil {
+		return nil, false
+	}
+	return ip, true
+}
+
+// SetCredentialsProvider installs the provider of the credentials of
+// devices with authentication enabled, used by the HTTP channel. See
+// types.CredentialsProvider. nil (the default) leaves protected devices
+// unreachable over HTTP.
+func (c *Client) SetCredentialsProvider(p types.CredentialsProvider) error {
+	if c.http == nil {
+		return ErrNotInitialized
+	}
+	c.http.SetCredentialsProvider(p)
+	return nil
+}
+
+// SubscribeWebsocket calls handle with every notification pushed by the
+// devices connected over WebSocket, and the topic the device publishes its
+// MQTT copy on (<device_id>/events/rpc): MQTT subscription handlers consume
+// both alike.
+func (c *Client) SubscribeWebsocket(subscriber string, handle func(topic string, payload []byte, subscriber string) error) error {
+	if c.ws == nil {
+		return ErrNotInitialized
+	}
+	c.ws.Subscribe(subscriber, handle)
+	return nil
+}
+
+// WatchWebsocket keeps a WebSocket connection to device open until ctx is
+// done, so that the device pushes its notifications to the subscribers.
+func (c *Client) WatchWebsocket(ctx context.Context, device types.Device) error {
+	if c.ws == nil {
+		return ErrNotInitialized
+	}
+	c.ws.Watch(ctx, device)
+	return nil
+}
+
+// deviceMqttChannels returns the MQTT channels of deviceId, subscribing to
+// its RPC topics on first use: Device values recreated for the same device
+// (e.g. loaded from database) reuse them instead of leaking subscriptions.
+func (c *Client) deviceMqttChannels(ctx context.Context, deviceId string) (*DeviceMqttChannels, error) {
+	c.mqttChannelsMutex.RLock()
+	existing, exists := c.mqttChannels[deviceId]
+	c.mqttChannelsMutex.RUnlock()
+
+	if exists {
+		return existing, nil
+	}
+
+	// Create new channels (first time for this device)
+	c.mqttChannelsMutex.Lock()
+	defer c.mqttChannelsMutex.Unlock()
+
+	// Double-check after acquiring write lock
+	if existing, exists = c.mqttChannels[deviceId]; exists {
+		return existing, nil
+	}
+
+	mc := c.mqtt
+	if mc == nil {
+		return nil, fmt.Errorf("no MQTT client to reach device %s", deviceId)
+	}
+	replyTo := fmt.Sprintf("%s_%s", mc.Id(), deviceId)
+
+	// Use larger buffer (64) to handle concurrent refresh operations without dropping responses
+	// With maxConcurrentRefreshes and multiple devices, responses can arrive in bursts
+	from, err := mc.Subscribe(ctx, fmt.Sprintf("%s/rpc", replyTo), 64 /*qlen*/, "shelly/device/"+deviceId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to subscribe to device's RPC topic: %w", err)
+	}
+
+	topic := fmt.Sprintf("%s/rpc", deviceId)
+	to, err := mc.Publisher(ctx, topic, 1 /*qlen*/, mqtt.ExactlyOnce, false /*retain*/, "shelly/device/"+deviceId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to publish to device's RPC topic: %w", err)
+	}
+
+	// Store in registry for future reuse
+	channels := &DeviceMqttChannels{
+		ReplyTo: replyTo,
+		To:      to,
+		From:    from,
+	}
+	c.mqttChannels[deviceId] = channels
+	return channels, nil
+}
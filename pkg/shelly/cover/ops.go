@@ -0,0 +1,120 @@
+package cover
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+var log logr.Logger
+
+type empty struct{}
+
+type Verb string
+
+func (v Verb) String() string {
+	return string(v) // Convert Verb to string
+}
+
+const (
+	getConfig    Verb = "Cover.GetConfig"
+	setConfig    Verb = "Cover.SetConfig"
+	getStatus    Verb = "Cover.GetStatus"
+	openCover    Verb = "Cover.Open"
+	closeCover   Verb = "Cover.Close"
+	stopCover    Verb = "Cover.Stop"
+	goToPosition Verb = "Cover.GoToPosition"
+	calibrate    Verb = "Cover.Calibrate"
+)
+
+func Init(l logr.Logger, r types.MethodsRegistrar) {
+	log = l
+	log.Info("Init", "package", reflect.TypeOf(empty{}).PkgPath())
+
+	r.RegisterMethodHandler(getConfig.String(), types.MethodHandler{
+		Allocate:   func() any { return new(Config) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(setConfig.String(), types.MethodHandler{
+		Allocate:   func() any { return new(ConfigurationResponse) },
+		HttpMethod: http.MethodPost,
+	})
+	r.RegisterMethodHandler(getStatus.String(), types.MethodHandler{
+		Allocate:   func() any { return new(Status) },
+		HttpMethod: http.MethodGet,
+	})
+	// The moves answer null
+	for _, verb := range []Verb{openCover, closeCover, stopCover, goToPosition, calibrate} {
+		r.RegisterMethodHandler(verb.String(), types.MethodHandler{
+			Allocate:   func() any { return nil },
+			HttpMethod: http.MethodPost,
+		})
+	}
+}
+
+func doCall[reqT any, resT any](ctx context.Context, device types.Device, via types.Channel, verb Verb, req *reqT) (*resT, error) {
+	out, err := device.CallE(ctx, via, verb.String(), req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s on device %s: %w", verb, device.Id(), err)
+	}
+
+	result, ok := out.(*resT)
+	if !ok {
+		var expected resT
+		return nil, fmt.Errorf("unexpected response type %T (should be *%T)", out, expected)
+	}
+	return result, nil
+}
+
+func doMove(ctx context.Context, device types.Device, via types.Channel, verb Verb, req any) error {
+	_, err := device.CallE(ctx, via, verb.String(), req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s on device %s: %w", verb, device.Id(), err)
+	}
+	return nil
+}
+
+func GetConfig(ctx context.Context, device types.Device, via types.Channel, id int) (*Config, error) {
+	return doCall[IdRequest, Config](ctx, device, via, getConfig, &IdRequest{Id: id})
+}
+
+func SetConfig(ctx context.Context, device types.Device, via types.Channel, id int, config *Config) (*ConfigurationResponse, error) {
+	return doCall[ConfigurationRequest, ConfigurationResponse](ctx, device, via, setConfig, &ConfigurationRequest{Id: id, Configuration: *config})
+}
+
+func GetStatus(ctx context.Context, device types.Device, via types.Channel, id int) (*Status, error) {
+	return doCall[IdRequest, Status](ctx, device, via, getStatus, &IdRequest{Id: id})
+}
+
+// Open opens the cover, for duration seconds if not zero, or fully.
+func Open(ctx context.Context, device types.Device, via types.Channel, id int, duration float32) error {
+	return doMove(ctx, device, via, openCover, &MoveRequest{Id: id, Duration: duration})
+}
+
+// Close closes the cover, for duration seconds if not zero, or fully.
+func Close(ctx context.Context, device types.Device, via types.Channel, id int, duration float32) error {
+	return doMove(ctx, device, via, closeCover, &MoveRequest{Id: id, Duration: duration})
+}
+
+func Stop(ctx context.Context, device types.Device, via types.Channel, id int) error {
+	return doMove(ctx, device, via, stopCover, &IdRequest{Id: id})
+}
+
+// GoToPosition moves a calibrated cover to pos percent, from 0 (fully
+// closed) to 100 (fully open).
+func GoToPosition(ctx context.Context, device types.Device, via types.Channel, id int, pos int) error {
+	if pos < 0 || pos > 100 {
+		return fmt.Errorf("invalid cover position %d: must be 0-100", pos)
+	}
+	return doMove(ctx, device, via, goToPosition, &GoToPositionRequest{Id: id, Pos: &pos})
+}
+
+// Calibrate starts the calibration of the cover, required for GoToPosition.
+func Calibrate(ctx context.Context, device types.Device, via types.Channel, id int) error {
+	return doMove(ctx, device, via, calibrate, &IdRequest{Id: id})
+}
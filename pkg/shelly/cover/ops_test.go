@@ -0,0 +1,87 @@
+package cover
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+)
+
+func TestGetStatus(t *testing.T) {
+	d := types.NewFakeDevice()
+	pos := 40
+	want := &Status{Id: 1, State: StateStopped, CurrentPos: &pos, PosControl: true}
+	d.SetResult(getStatus.String(), want)
+
+	got, err := GetStatus(context.Background(), d, types.ChannelDefault, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+	if req, ok := d.Calls[0].Params.(*IdRequest); !ok || req.Id != 1 {
+		t.Errorf("expected &IdRequest{Id: 1}, got %#v", d.Calls[0].Params)
+	}
+}
+
+func TestMoves(t *testing.T) {
+	ctx := context.Background()
+	d := types.NewFakeDevice()
+	for _, verb := range []Verb{openCover, closeCover, stopCover, goToPosition, calibrate} {
+		d.SetResult(verb.String(), nil)
+	}
+
+	if err := Open(ctx, d, types.ChannelDefault, 0, 0); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := Close(ctx, d, types.ChannelDefault, 0, 2.5); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := Stop(ctx, d, types.ChannelDefault, 0); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if err := GoToPosition(ctx, d, types.ChannelDefault, 0, 75); err != nil {
+		t.Fatalf("GoToPosition: %v", err)
+	}
+	if err := Calibrate(ctx, d, types.ChannelDefault, 0); err != nil {
+		t.Fatalf("Calibrate: %v", err)
+	}
+
+	want := []string{"Cover.Open", "Cover.Close", "Cover.Stop", "Cover.GoToPosition", "Cover.Calibrate"}
+	if len(d.Calls) != len(want) {
+		t.Fatalf("expected %d calls, got %d", len(want), len(d.Calls))
+	}
+	for i, m := range want {
+		if d.Calls[i].Method != m {
+			t.Errorf("call %d: expected %s, got %s", i, m, d.Calls[i].Method)
+		}
+	}
+	if req := d.Calls[1].Params.(*MoveRequest); req.Duration != 2.5 {
+		t.Errorf("expected Close duration 2.5, got %v", req.Duration)
+	}
+	if req := d.Calls[3].Params.(*GoToPositionRequest); req.Pos == nil || *req.Pos != 75 || req.Rel != nil {
+		t.Errorf("expected GoToPosition pos 75, got %#v", req)
+	}
+}
+
+func TestGoToPosition_Invalid(t *testing.T) {
+	d := types.NewFakeDevice()
+	if err := GoToPosition(context.Background(), d, types.ChannelDefault, 0, 101); err == nil {
+		t.Fatal("expected an error for position 101")
+	}
+	if len(d.Calls) != 0 {
+		t.Errorf("expected no call to the device, got %v", d.Calls)
+	}
+}
+
+func TestOpen_DeviceError(t *testing.T) {
+	d := types.NewFakeDevice()
+	wantErr := errors.New("obstruction")
+	d.SetError(openCover.String(), wantErr)
+
+	if err := Open(context.Background(), d, types.ChannelDefault, 0, 0); !errors.Is(err, wantErr) {
+		t.Fatalf("expected %v, got %v", wantErr, err)
+	}
+}
@@ -0,0 +1,90 @@
+package cover
+
+// https://shelly-api-docs.shelly.cloud/gen2/ComponentsAndServices/Cover
+
+type Config struct {
+	Id                int     `json:"id"`                           // Id of the Cover component instance
+	Name              *string `json:"name,omitempty"`               // Name of the cover instance
+	InMode            string  `json:"in_mode,omitempty"`            // Mode of the associated inputs. Range of values: single, dual, detached
+	InitialState      string  `json:"initial_state,omitempty"`      // State to set on power_on. Range of values: open, closed, stopped
+	InvertDirections  bool    `json:"invert_directions"`            // True to swap the open and close directions
+	SwapInputs        bool    `json:"swap_inputs"`                  // True to swap the open and close inputs
+	MaxtimeOpen       float32 `json:"maxtime_open,omitempty"`       // Default timeout (in seconds) after which the cover stops opening
+	MaxtimeClose      float32 `json:"maxtime_close,omitempty"`      // Default timeout (in seconds) after which the cover stops closing
+	PowerLimit        float32 `json:"power_limit,omitempty"`        // Limit (in Watts) over which overpower condition occurs (shown if applicable)
+	VoltageLimit      float32 `json:"voltage_limit,omitempty"`      // Limit (in Volts) over which overvoltage condition occurs (shown if applicable)
+	UnderVoltageLimit float32 `json:"undervoltage_limit,omitempty"` // Limit (in Volts) under which undervoltage condition occurs (shown if applicable)
+	CurrentLimit      float32 `json:"current_limit,omitempty"`      // Limit (in Amperes) over which overcurrent condition occurs (shown if applicable)
+	Motor             *struct {
+		IdlePowerThreshold float32 `json:"idle_power_thr"`      // Threshold (in Watts) under which the motor is considered stopped
+		IdleConfirmPeriod  float32 `json:"idle_confirm_period"` // Seconds the power must stay under the threshold
+	} `json:"motor,omitempty"`
+	ObstructionDetection *struct {
+		Enable    bool    `json:"enable"`    // True to stop (or reverse) the cover on obstruction
+		Direction string  `json:"direction"` // Direction of detection. Range of values: open, close, both
+		Action    string  `json:"action"`    // Action on obstruction. Range of values: stop, reverse
+		PowerThr  float32 `json:"power_thr"` // Power (in Watts) over which an obstruction is detected
+		Holdoff   float32 `json:"holdoff"`   // Seconds after the start of a move during which no obstruction is detected
+	} `json:"obstruction_detection,omitempty"`
+}
+
+type ConfigurationRequest struct {
+	Id            int    `json:"id"`     // Id of the Cover component instance
+	Configuration Config `json:"config"` // Configuration that the method takes
+}
+
+type ConfigurationResponse struct {
+	RestartRequired bool `json:"restart_required"` // True if the device needs to be restarted for the changes to take effect
+}
+
+// Cover states, as found in Status.State
+const (
+	StateOpen        = "open"
+	StateClosed      = "closed"
+	StateOpening     = "opening"
+	StateClosing     = "closing"
+	StateStopped     = "stopped"
+	StateCalibrating = "calibrating"
+)
+
+type Status struct {
+	Id            int     `json:"id"`                        // Id of the Cover component instance
+	Source        string  `json:"source"`                    // Source of the last command, for example: init, WS_in, http, ...
+	State         string  `json:"state"`                     // One of open, closed, opening, closing, stopped, calibrating
+	Apower        float32 `json:"apower,omitempty"`          // Last measured instantaneous active power (in Watts) delivered to the attached load
+	Voltage       float32 `json:"voltage,omitempty"`         // Last measured voltage in Volts
+	Current       float32 `json:"current,omitempty"`         // Last measured current in Amperes
+	PowerFactor   float32 `json:"pf,omitempty"`              // Last measured power factor
+	Freq          float32 `json:"freq,omitempty"`            // Last measured network frequency in Hz
+	CurrentPos    *int    `json:"current_pos,omitempty"`     // Current position in percent from 0 (fully closed) to 100 (fully open); null if not calibrated
+	TargetPos     *int    `json:"target_pos,omitempty"`      // Requested target position in percent (shown while moving to a position)
+	MoveTimeout   float32 `json:"move_timeout,omitempty"`    // Seconds after which the cover stops moving (shown while moving)
+	MoveStartedAt float32 `json:"move_started_at,omitempty"` // Unix timestamp of the start of the move (shown while moving)
+	PosControl    bool    `json:"pos_control"`               // True if the cover is calibrated, and accepts positions
+	LastDirection string  `json:"last_direction,omitempty"`  // Direction of the last move: open or close
+	Aenergy       *struct {
+		Total    float32   `json:"total"`     // Total energy consumed in Watt-hours
+		ByMinute []float32 `json:"by_minute"` // Energy consumption by minute (in Milliwatt-hours) for the last three minutes
+		MinuteTs int       `json:"minute_ts"` // Unix timestamp of the first second of the last minute (in UTC)
+	} `json:"aenergy,omitempty"`
+	Temperature *struct {
+		Celsius    float32 `json:"tC,omitempty"` // Temperature in Celsius
+		Fahrenheit float32 `json:"tF,omitempty"` // Temperature in Fahrenheit
+	} `json:"temperature,omitempty"`
+	Errors []string `json:"errors,omitempty"` // Error conditions occurred, e.g. overtemp, overpower, obstruction (shown if at least one error is present)
+}
+
+type IdRequest struct {
+	Id int `json:"id"` // Id of the Cover component instance
+}
+
+type MoveRequest struct {
+	Id       int     `json:"id"`                 // Id of the Cover component instance
+	Duration float32 `json:"duration,omitempty"` // Seconds to move for; the full move (up to maxtime_open/close) if omitted
+}
+
+type GoToPositionRequest struct {
+	Id  int  `json:"id"`            // Id of the Cover component instance
+	Pos *int `json:"pos,omitempty"` // Target position in percent, from 0 (fully closed) to 100 (fully open)
+	Rel *int `json:"rel,omitempty"` // Relative move in percent, from -100 to 100
+}
@@ -7,8 +7,6 @@ import (
 	_ "github.com/asnowfix/home-automation/internal/myhome/net"
 	"net"
 	"github.com/asnowfix/home-automation/pkg/devices"
-	"github.com/asnowfix/home-automation/pkg/shelly/mqtt"
-	"github.com/asnowfix/home-automation/pkg/shelly/ratelimit"
 	"github.com/asnowfix/home-automation/pkg/shelly/shelly"
 	"github.com/asnowfix/home-automation/pkg/shelly/system"
 	"github.com/asnowfix/home-automation/pkg/shelly/types"
@@ -22,7 +20,7 @@ import (
 
 // DeviceMqttChannels holds MQTT channels for each device ID to prevent goroutine leaks.
 // When Device structs are recreated (e.g., loaded from database), they reuse existing channels
-// instead of creating new subscriptions/publishers that would leak goroutines.
+// of their Client instead of creating new subscriptions/publishers that would leak goroutines.
 type DeviceMqttChannels struct {
 	ReplyTo string
 	To      chan<- []byte
@@ -60,59 +58,6 @@ func (m *DeviceMqttChannels) Unlock() {
 	}
 }
 
-// Init initializes MQTT channels for a device. Returns an existing instance from the registry
-// if available, or creates new channels and registers them.
-func (m *DeviceMqttChannels) Init(ctx context.Context, deviceId string) (*DeviceMqttChannels, error) {
-	// Check if we already have MQTT channels for this device (prevents goroutine leaks)
-	deviceMqttRegistryMutex.RLock()
-	existing, exists := deviceMqttRegistry[deviceId]
-	deviceMqttRegistryMutex.RUnlock()
-
-	if exists {
-		return existing, nil
-	}
-
-	// Create new channels (first time for this device)
-	deviceMqttRegistryMutex.Lock()
-	defer deviceMqttRegistryMutex.Unlock()
-
-	// Double-check after acquiring write lock
-	if existing, exists = deviceMqttRegistry[deviceId]; exists {
-		return existing, nil
-	}
-
-	mc := mqtt.GetClient(ctx)
-	replyTo := fmt.Sprintf("%s_%s", mc.Id(), deviceId)
-
-	// Use larger buffer (64) to handle concurrent refresh operations without dropping responses
-	// With maxConcurrentRefreshes and multiple devices, responses can arrive in bursts
-	from, err := mc.Subscribe(ctx, fmt.Sprintf("%s/rpc", replyTo), 64 /*qlen*/, "shelly/device/"+deviceId)
-	if err != nil {
-		return nil, fmt.Errorf("unable to subscribe to device's RPC topic: %w", err)
-	}
-
-	topic := fmt.Sprintf("%s/rpc", deviceId)
-	to, err := mc.Publisher(ctx, topic, 1 /*qlen*/, mqtt.ExactlyOnce, false /*retain*/, "shelly/device/"+deviceId)
-	if err != nil {
-		return nil, fmt.Errorf("unable to publish to device's RPC topic: %w", err)
-	}
-
-	// Store in registry for future reuse
-	channels := &DeviceMqttChannels{
-		ReplyTo: replyTo,
-		To:      to,
-		From:    from,
-	}
-	deviceMqttRegistry[deviceId] = channels
-	return channels, nil
-}
-
-var (
-	// Global registry of MQTT channels per device ID
-	deviceMqttRegistry      = make(map[string]*DeviceMqttChannels)
-	deviceMqttRegistryMutex sync.RWMutex
-)
-
 type Device struct {
 	Id_         string              `json:"id"`
 	MacAddress_ net.HardwareAddr    `json:"-"`
@@ -126,6 +71,15 @@ type Device struct {
 	dialogs     sync.Map            `json:"-"` // map[uint32]bool
 	log         logr.Logger         `json:"-"`
 	modified    bool                `json:"-"`
+	client      *Client             `json:"-"` // nil: the default Client
+}
+
+// shellyClient returns the Client d is bound to.
+func (d *Device) shellyClient() *Client {
+	if d.client != nil {
+		return d.client
+	}
+	return defaultClient
 }
 
 func (d *Device) Refresh(ctx context.Context, via types.Channel) (bool, error) {
@@ -360,6 +314,16 @@ func (d *Device) Status() *shelly.Status {
 	return d.status
 }
 
+// UpdateStatus merges the params of a NotifyStatus or NotifyFullStatus
+// notification into the device status: components it does not mention, and
+// fields it does not carry, keep their last known value.
+func (d *Device) UpdateStatus(params json.RawMessage) error {
+	if d.status == nil {
+		d.status = &shelly.Status{}
+	}
+	return json.Unmarshal(params, d.status)
+}
+
 func (d *Device) ConfigRevision() uint32 {
 	if d.config == nil {
 		return 0
@@ -426,7 +390,7 @@ func (d *Device) Channel(ctx context.Context, via types.Channel) types.Channel {
 		if d.IsMqttReady() {
 			return types.ChannelMqtt
 		}
-		if d.IsHttpReady() || d.resolveHost(ctx) {
+		if d.IsHttpReady() || d.ResolveHost(ctx) {
 			return types.ChannelHttp
 		}
 	case types.ChannelMqtt:
@@ -434,19 +398,29 @@ func (d *Device) Channel(ctx context.Context, via types.Channel) types.Channel {
 			return types.ChannelMqtt
 		}
 	case types.ChannelHttp:
-		if d.IsHttpReady() || d.resolveHost(ctx) {
+		if d.IsHttpReady() || d.ResolveHost(ctx) {
 			return types.ChannelHttp
 		}
+	case types.ChannelUdp:
+		// Same address as HTTP, on the device's rpc_udp.listen_port
+		if d.IsHttpReady() || d.ResolveHost(ctx) {
+			return types.ChannelUdp
+		}
+	case types.ChannelWebsocket:
+		// Same address as HTTP: ws://<host>/rpc
+		if d.IsHttpReady() || d.ResolveHost(ctx) {
+			return types.ChannelWebsocket
+		}
 	}
 	// Auto discarded
 	return types.ChannelDefault
 }
 
-// resolveHost asks the injected types.HostResolver (if any) for the
+// ResolveHost asks the HostResolver of the device's Client (if any) for the
 // device's current IP, keyed by MAC first and then by device ID (mDNS
 // hostname). On success it updates Host_ and returns true.
-func (d *Device) resolveHost(ctx context.Context) bool {
-	ip, ok := types.ResolveHost(ctx, d.Mac(), d.Id())
+func (d *Device) ResolveHost(ctx context.Context) bool {
+	ip, ok := d.shellyClient().resolveHost(ctx, d.Mac(), d.Id())
 	if !ok {
 		return false
 	}
@@ -518,8 +492,9 @@ func (d *Device) CallE(ctx context.Context, via types.Channel, method string, pa
 	var mh types.MethodHandler
 	var err error
 
+	c := d.shellyClient()
 	if strings.HasPrefix(method, "Shelly.") {
-		mh, err = GetRegistrar().MethodHandlerE(method)
+		mh, err = c.registrar.MethodHandlerE(method)
 	} else {
 		mh, err = d.MethodHandlerE(method)
 	}
@@ -529,14 +504,14 @@ func (d *Device) CallE(ctx context.Context, via types.Channel, method string, pa
 	}
 
 	// Per-device rate limiting with queuing
-	rl := ratelimit.GetLimiter()
+	rl := c.limiter
 	if rl != nil {
 		if err := rl.Wait(ctx, d.Id()); err != nil {
 			return nil, err
 		}
 	}
 
-	result, err := GetRegistrar().CallE(ctx, d, via, mh, params)
+	result, err := c.registrar.CallE(ctx, d, via, mh, params)
 
 	// Mark command completion for rate limiting (interval measured from response to next request)
 	if rl != nil {
@@ -551,7 +526,7 @@ func (d *Device) MethodHandlerE(v any) (types.MethodHandler, error) {
 	if !ok {
 		return types.NotAMethod, fmt.Errorf("not a method: %v", v)
 	}
-	mh, exists := registrar.methods[m]
+	mh, exists := d.shellyClient().registrar.methods[m]
 	if !exists {
 		return types.MethodNotFound, fmt.Errorf("did not find any registrar handler for method: %v", v)
 	}
@@ -588,10 +563,16 @@ func (d *Device) ReplyTo() string {
 	return d.mqtt.ReplyTo
 }
 
+// NewDeviceFromIp returns the device at ip, bound to the default Client.
 func NewDeviceFromIp(ctx context.Context, log logr.Logger, ip net.IP) (devices.Device, error) {
+	return defaultClient.NewDeviceFromIp(ctx, log, ip)
+}
+
+func (c *Client) NewDeviceFromIp(ctx context.Context, log logr.Logger, ip net.IP) (devices.Device, error) {
 	d := &Device{
-		Host_: ip,
-		log:   log,
+		Host_:  ip,
+		log:    log,
+		client: c,
 	}
 	err := d.init(ctx)
 	if err != nil {
@@ -625,12 +606,19 @@ func MacFromShellyID(id string) net.HardwareAddr {
 	return mac
 }
 
+// NewDeviceFromMqttId returns the device with id, bound to the default
+// Client.
 func NewDeviceFromMqttId(ctx context.Context, log logr.Logger, id string) (devices.Device, error) {
+	return defaultClient.NewDeviceFromMqttId(ctx, log, id)
+}
+
+func (c *Client) NewDeviceFromMqttId(ctx context.Context, log logr.Logger, id string) (devices.Device, error) {
 	if id == "" || id == "<nil>" {
 		return nil, fmt.Errorf("invalid device id: %s", id)
 	}
 	d := &Device{
-		log: log,
+		log:    log,
+		client: c,
 	}
 	d.UpdateId(id)
 	if mac := MacFromShellyID(id); mac != nil {
@@ -639,7 +627,13 @@ func NewDeviceFromMqttId(ctx context.Context, log logr.Logger, id string) (devic
 	return d, nil
 }
 
+// NewDeviceFromSummary returns the device of summary, bound to the default
+// Client.
 func NewDeviceFromSummary(ctx context.Context, log logr.Logger, summary devices.Device) (devices.Device, error) {
+	return defaultClient.NewDeviceFromSummary(ctx, log, summary)
+}
+
+func (c *Client) NewDeviceFromSummary(ctx context.Context, log logr.Logger, summary devices.Device) (devices.Device, error) {
 	if summary.Id() == "" {
 		return nil, fmt.Errorf("device summary has empty ID (name=%q, host=%q)", summary.Name(), summary.Host())
 	}
@@ -649,7 +643,8 @@ func NewDeviceFromSummary(ctx context.Context, log logr.Logger, summary devices.
 		// 	Id:      summary.Id(),
 		// 	Product: shelly.Product{},
 		// },
-		log: log,
+		log:    log,
+		client: c,
 	}
 	d.UpdateId(summary.Id())
 	d.UpdateHost(summary.Host())
@@ -699,7 +694,7 @@ func (d *Device) initMqtt(ctx context.Context) error {
 	}
 
 	var err error
-	d.mqtt, err = d.mqtt.Init(ctx, d.Id())
+	d.mqtt, err = d.shellyClient().deviceMqttChannels(ctx, d.Id())
 	if err != nil {
 		d.log.Error(err, "Unable to init MQTT channels", "device_id", d.Id_)
 		return err
@@ -783,7 +778,13 @@ type DeviceResult struct {
 	Error  error
 }
 
+// Foreach runs do on each device of deviceList in parallel, with the
+// default Client.
 func Foreach(ctx context.Context, log logr.Logger, deviceList []devices.Device, via types.Channel, do Do, args []string) (any, error) {
+	return defaultClient.Foreach(ctx, log, deviceList, via, do, args)
+}
+
+func (c *Client) Foreach(ctx context.Context, log logr.Logger, deviceList []devices.Device, via types.Channel, do Do, args []string) (any, error) {
 	log.Info("Running", "func_type", reflect.TypeOf(do), "args", args, "nb_devices", len(deviceList))
 
 	// Create channels for results
@@ -818,7 +819,7 @@ func Foreach(ctx context.Context, log logr.Logger, deviceList []devices.Device,
 			}
 
 			// Create device from summary
-			device, err := NewDeviceFromSummary(ctx, log, devSummary)
+			device, err := c.NewDeviceFromSummary(ctx, log, devSummary)
 			if err != nil {
 				log.Error(err, "Unable to create device from summary", "device", devSummary)
 				results <- DeviceResult{Device: devSummary, Error: err}
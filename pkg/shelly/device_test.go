@@ -5,8 +5,10 @@ import (
 	"errors"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/asnowfix/home-automation/pkg/devices"
+	"github.com/asnowfix/home-automation/pkg/shelly/mqtt"
 	"github.com/asnowfix/home-automation/pkg/shelly/types"
 	"github.com/go-logr/logr"
 )
@@ -205,15 +207,15 @@ func TestNewDeviceFromMqttId_Valid(t *testing.T) {
 }
 
 func TestChannel_ResolvesHostWhenNeitherMqttNorHttpReady(t *testing.T) {
-	t.Cleanup(func() { types.SetHostResolver(nil) })
-	types.SetHostResolver(fakeResolverFunc(func(ctx context.Context, mac net.HardwareAddr, name string) (net.IP, error) {
+	c := &Client{}
+	c.SetHostResolver(fakeResolverFunc(func(ctx context.Context, mac net.HardwareAddr, name string) (net.IP, error) {
 		if name == "shellyplus1pm-aabbccddeeff" {
 			return net.ParseIP("192.168.1.77"), nil
 		}
 		return nil, errors.New("not found")
 	}))
 
-	d := &Device{Id_: "shellyplus1pm-aabbccddeeff", log: logr.Discard()}
+	d := &Device{Id_: "shellyplus1pm-aabbccddeeff", log: logr.Discard(), client: c}
 
 	got := d.Channel(context.Background(), types.ChannelDefault)
 	if got != types.ChannelHttp {
@@ -225,10 +227,7 @@ func TestChannel_ResolvesHostWhenNeitherMqttNorHttpReady(t *testing.T) {
 }
 
 func TestChannel_NoResolverStaysDiscarded(t *testing.T) {
-	t.Cleanup(func() { types.SetHostResolver(nil) })
-	types.SetHostResolver(nil)
-
-	d := &Device{Id_: "shellyplus1pm-aabbccddeeff", log: logr.Discard()}
+	d := &Device{Id_: "shellyplus1pm-aabbccddeeff", log: logr.Discard(), client: &Client{}}
 
 	got := d.Channel(context.Background(), types.ChannelDefault)
 	if got != types.ChannelDefault {
@@ -237,14 +236,14 @@ func TestChannel_NoResolverStaysDiscarded(t *testing.T) {
 }
 
 func TestChannel_MqttReadyDoesNotCallResolver(t *testing.T) {
-	t.Cleanup(func() { types.SetHostResolver(nil) })
 	called := false
-	types.SetHostResolver(fakeResolverFunc(func(ctx context.Context, mac net.HardwareAddr, name string) (net.IP, error) {
+	c := &Client{}
+	c.SetHostResolver(fakeResolverFunc(func(ctx context.Context, mac net.HardwareAddr, name string) (net.IP, error) {
 		called = true
 		return net.ParseIP("192.168.1.1"), nil
 	}))
 
-	d := &Device{Id_: "shellyplus1pm-aabbccddeeff", log: logr.Discard()}
+	d := &Device{Id_: "shellyplus1pm-aabbccddeeff", log: logr.Discard(), client: c}
 	d.mqtt = &DeviceMqttChannels{ReplyTo: "x", To: make(chan []byte, 1), From: make(chan []byte, 1)}
 
 	got := d.Channel(context.Background(), types.ChannelDefault)
@@ -255,3 +254,39 @@ func TestChannel_MqttReadyDoesNotCallResolver(t *testing.T) {
 		t.Error("resolver should not be called when MQTT is already ready")
 	}
 }
+
+// TestClients_AreIndependent verifies that two Clients in one process keep
+// their own registrar, MQTT channels and host resolver, and that devices use
+// the Client that created them.
+func TestClients_AreIndependent(t *testing.T) {
+	ctx := context.Background()
+	const id = "shellyplus1pm-aabbccddeeff"
+	for _, ip := range []string{"192.168.1.10", "10.0.0.10"} {
+		t.Run(ip, func(t *testing.T) {
+			t.Parallel()
+			c := NewClient(logr.Discard(), mqtt.NewMockClient(), time.Second, 0, 0)
+			t.Cleanup(c.Close)
+			c.SetHostResolver(fakeResolverFunc(func(ctx context.Context, mac net.HardwareAddr, name string) (net.IP, error) {
+				return net.ParseIP(ip), nil
+			}))
+
+			device, err := c.NewDeviceFromMqttId(ctx, logr.Discard(), id)
+			if err != nil {
+				t.Fatalf("NewDeviceFromMqttId: %v", err)
+			}
+			d := device.(*Device)
+			if err := d.Init(ctx); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			if c.mqttChannels[id] != d.mqtt || !d.IsMqttReady() {
+				t.Error("expected the device to use the MQTT channels of its Client")
+			}
+			if !d.ResolveHost(ctx) || d.Host() != ip {
+				t.Errorf("expected host %s from the Client's resolver, got %q", ip, d.Host())
+			}
+			if _, err := d.MethodHandlerE("Switch.Set"); err != nil {
+				t.Errorf("expected Switch.Set in the Client's registrar: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package devicepower
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+var log logr.Logger
+
+type empty struct{}
+
+type Verb string
+
+func (v Verb) String() string {
+	return string(v) // Convert Verb to string
+}
+
+const (
+	getStatus Verb = "DevicePower.GetStatus"
+)
+
+func Init(l logr.Logger, r types.MethodsRegistrar) {
+	log = l
+	log.Info("Init", "package", reflect.TypeOf(empty{}).PkgPath())
+
+	r.RegisterMethodHandler(getStatus.String(), types.MethodHandler{
+		Allocate:   func() any { return new(Status) },
+		HttpMethod: http.MethodGet,
+	})
+}
+
+// GetStatus returns the battery and external power state of battery-powered
+// devices (e.g. Plus H&T).
+func GetStatus(ctx context.Context, device types.Device, via types.Channel, id int) (*Status, error) {
+	out, err := device.CallE(ctx, via, getStatus.String(), &IdRequest{Id: id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s on device %s: %w", getStatus, device.Id(), err)
+	}
+	status, ok := out.(*Status)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response type %T (should be *Status)", out)
+	}
+	return status, nil
+}
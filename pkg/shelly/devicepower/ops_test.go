@@ -0,0 +1,27 @@
+package devicepower
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+)
+
+func TestGetStatus(t *testing.T) {
+	var want Status
+	payload := `{"id":0,"battery":{"V":5.32,"percent":83},"external":{"present":false}}`
+	if err := json.Unmarshal([]byte(payload), &want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d := types.NewFakeDevice()
+	d.SetResult(getStatus.String(), &want)
+
+	got, err := GetStatus(context.Background(), d, types.ChannelDefault, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Battery.Percent == nil || *got.Battery.Percent != 83 || got.External.Present {
+		t.Errorf("unexpected %+v", got)
+	}
+}
@@ -0,0 +1,19 @@
+package devicepower
+
+// https://shelly-api-docs.shelly.cloud/gen2/ComponentsAndServices/DevicePower
+
+type Status struct {
+	Id      int `json:"id"` // Id of the DevicePower component instance
+	Battery struct {
+		Voltage *float32 `json:"V"`       // Battery voltage in Volts (null if not available)
+		Percent *int     `json:"percent"` // Battery charge level in percent (null if not available)
+	} `json:"battery"`
+	External struct {
+		Present bool `json:"present"` // True if an external power source is connected
+	} `json:"external"`
+	Errors []string `json:"errors,omitempty"` // Error conditions occurred, e.g. read (shown if at least one error is present)
+}
+
+type IdRequest struct {
+	Id int `json:"id"` // Id of the DevicePower component instance
+}
@@ -0,0 +1,197 @@
+package em
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+var log logr.Logger
+
+type empty struct{}
+
+type Verb string
+
+func (v Verb) String() string {
+	return string(v) // Convert Verb to string
+}
+
+const (
+	getConfig         Verb = "EM.GetConfig"
+	setConfig         Verb = "EM.SetConfig"
+	getStatus         Verb = "EM.GetStatus"
+	getDataStatus     Verb = "EMData.GetStatus"
+	getRecords        Verb = "EMData.GetRecords"
+	getData           Verb = "EMData.GetData"
+	resetDataCounters Verb = "EMData.ResetCounters"
+
+	em1GetConfig         Verb = "EM1.GetConfig"
+	em1SetConfig         Verb = "EM1.SetConfig"
+	em1GetStatus         Verb = "EM1.GetStatus"
+	em1GetDataStatus     Verb = "EM1Data.GetStatus"
+	em1GetRecords        Verb = "EM1Data.GetRecords"
+	em1GetData           Verb = "EM1Data.GetData"
+	em1ResetDataCounters Verb = "EM1Data.ResetCounters"
+)
+
+func Init(l logr.Logger, r types.MethodsRegistrar) {
+	log = l
+	log.Info("Init", "package", reflect.TypeOf(empty{}).PkgPath())
+
+	r.RegisterMethodHandler(getConfig.String(), types.MethodHandler{
+		Allocate:   func() any { return new(Config) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(setConfig.String(), types.MethodHandler{
+		Allocate:   func() any { return new(ConfigurationResponse) },
+		HttpMethod: http.MethodPost,
+	})
+	r.RegisterMethodHandler(getStatus.String(), types.MethodHandler{
+		Allocate:   func() any { return new(Status) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(getDataStatus.String(), types.MethodHandler{
+		Allocate:   func() any { return new(DataStatus) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(getRecords.String(), types.MethodHandler{
+		Allocate:   func() any { return new(RecordsResponse) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(getData.String(), types.MethodHandler{
+		Allocate:   func() any { return new(DataResponse) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(resetDataCounters.String(), types.MethodHandler{
+		Allocate:   func() any { return nil },
+		HttpMethod: http.MethodPost,
+	})
+
+	r.RegisterMethodHandler(em1GetConfig.String(), types.MethodHandler{
+		Allocate:   func() any { return new(EM1Config) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(em1SetConfig.String(), types.MethodHandler{
+		Allocate:   func() any { return new(ConfigurationResponse) },
+		HttpMethod: http.MethodPost,
+	})
+	r.RegisterMethodHandler(em1GetStatus.String(), types.MethodHandler{
+		Allocate:   func() any { return new(EM1Status) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(em1GetDataStatus.String(), types.MethodHandler{
+		Allocate:   func() any { return new(EM1DataStatus) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(em1GetRecords.String(), types.MethodHandler{
+		Allocate:   func() any { return new(RecordsResponse) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(em1GetData.String(), types.MethodHandler{
+		Allocate:   func() any { return new(DataResponse) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(em1ResetDataCounters.String(), types.MethodHandler{
+		Allocate:   func() any { return nil },
+		HttpMethod: http.MethodPost,
+	})
+}
+
+func doCall[reqT any, resT any](ctx context.Context, device types.Device, via types.Channel, verb Verb, req *reqT) (*resT, error) {
+	out, err := device.CallE(ctx, via, verb.String(), req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s on device %s: %w", verb, device.Id(), err)
+	}
+
+	result, ok := out.(*resT)
+	if !ok {
+		var expected resT
+		return nil, fmt.Errorf("unexpected response type %T (should be *%T)", out, expected)
+	}
+	return result, nil
+}
+
+func GetConfig(ctx context.Context, device types.Device, via types.Channel, id int) (*Config, error) {
+	return doCall[IdRequest, Config](ctx, device, via, getConfig, &IdRequest{Id: id})
+}
+
+func SetConfig(ctx context.Context, device types.Device, via types.Channel, id int, config *Config) (*ConfigurationResponse, error) {
+	return doCall[ConfigurationRequest, ConfigurationResponse](ctx, device, via, setConfig, &ConfigurationRequest{Id: id, Configuration: *config})
+}
+
+// GetStatus returns the instantaneous measures of the meter, per phase.
+func GetStatus(ctx context.Context, device types.Device, via types.Channel, id int) (*Status, error) {
+	return doCall[IdRequest, Status](ctx, device, via, getStatus, &IdRequest{Id: id})
+}
+
+// GetDataStatus returns the energy counters of the meter (EMData component).
+func GetDataStatus(ctx context.Context, device types.Device, via types.Channel, id int) (*DataStatus, error) {
+	return doCall[IdRequest, DataStatus](ctx, device, via, getDataStatus, &IdRequest{Id: id})
+}
+
+// GetRecords lists the blocks of energy records stored on the device since
+// ts (Unix timestamp; 0 for all).
+func GetRecords(ctx context.Context, device types.Device, via types.Channel, id int, ts int64) (*RecordsResponse, error) {
+	return doCall[RecordsRequest, RecordsResponse](ctx, device, via, getRecords, &RecordsRequest{Id: id, Ts: ts})
+}
+
+// GetData returns the energy records stored on the device between ts and
+// endTs (Unix timestamps; 0 for the latest). The device may truncate the
+// response: see DataResponse.NextRecordTs.
+func GetData(ctx context.Context, device types.Device, via types.Channel, id int, ts int64, endTs int64) (*DataResponse, error) {
+	return doCall[DataRequest, DataResponse](ctx, device, via, getData, &DataRequest{Id: id, Ts: ts, EndTs: endTs})
+}
+
+// ResetDataCounters resets the energy counters of the meter.
+func ResetDataCounters(ctx context.Context, device types.Device, via types.Channel, id int) error {
+	_, err := device.CallE(ctx, via, resetDataCounters.String(), &IdRequest{Id: id})
+	if err != nil {
+		return fmt.Errorf("failed to call %s on device %s: %w", resetDataCounters, device.Id(), err)
+	}
+	return nil
+}
+
+func GetEM1Config(ctx context.Context, device types.Device, via types.Channel, id int) (*EM1Config, error) {
+	return doCall[IdRequest, EM1Config](ctx, device, via, em1GetConfig, &IdRequest{Id: id})
+}
+
+func SetEM1Config(ctx context.Context, device types.Device, via types.Channel, id int, config *EM1Config) (*ConfigurationResponse, error) {
+	return doCall[EM1ConfigurationRequest, ConfigurationResponse](ctx, device, via, em1SetConfig, &EM1ConfigurationRequest{Id: id, Configuration: *config})
+}
+
+// GetEM1Status returns the instantaneous measures of a single-phase meter
+// channel (EM1 component).
+func GetEM1Status(ctx context.Context, device types.Device, via types.Channel, id int) (*EM1Status, error) {
+	return doCall[IdRequest, EM1Status](ctx, device, via, em1GetStatus, &IdRequest{Id: id})
+}
+
+// GetEM1DataStatus returns the energy counters of a single-phase meter
+// channel (EM1Data component).
+func GetEM1DataStatus(ctx context.Context, device types.Device, via types.Channel, id int) (*EM1DataStatus, error) {
+	return doCall[IdRequest, EM1DataStatus](ctx, device, via, em1GetDataStatus, &IdRequest{Id: id})
+}
+
+// GetEM1Records is GetRecords for a single-phase meter channel.
+func GetEM1Records(ctx context.Context, device types.Device, via types.Channel, id int, ts int64) (*RecordsResponse, error) {
+	return doCall[RecordsRequest, RecordsResponse](ctx, device, via, em1GetRecords, &RecordsRequest{Id: id, Ts: ts})
+}
+
+// GetEM1Data is GetData for a single-phase meter channel.
+func GetEM1Data(ctx context.Context, device types.Device, via types.Channel, id int, ts int64, endTs int64) (*DataResponse, error) {
+	return doCall[DataRequest, DataResponse](ctx, device, via, em1GetData, &DataRequest{Id: id, Ts: ts, EndTs: endTs})
+}
+
+// ResetEM1DataCounters resets the energy counters of a single-phase meter
+// channel.
+func ResetEM1DataCounters(ctx context.Context, device types.Device, via types.Channel, id int) error {
+	_, err := device.CallE(ctx, via, em1ResetDataCounters.String(), &IdRequest{Id: id})
+	if err != nil {
+		return fmt.Errorf("failed to call %s on device %s: %w", em1ResetDataCounters, device.Id(), err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package em
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+)
+
+func TestGetStatus(t *testing.T) {
+	d := types.NewFakeDevice()
+	want := &Status{Id: 0, AVoltage: 230, TotalActPower: 1500}
+	d.SetResult(getStatus.String(), want)
+
+	got, err := GetStatus(context.Background(), d, types.ChannelDefault, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestGetData(t *testing.T) {
+	d := types.NewFakeDevice()
+	d.SetResult(getData.String(), &DataResponse{})
+
+	if _, err := GetData(context.Background(), d, types.ChannelDefault, 0, 1700000000, 1700003600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req, ok := d.Calls[0].Params.(*DataRequest)
+	if !ok || req.Ts != 1700000000 || req.EndTs != 1700003600 {
+		t.Errorf("unexpected EMData.GetData params %#v", d.Calls[0].Params)
+	}
+}
+
+func TestDataResponse_Unmarshal(t *testing.T) {
+	payload := `{"keys":["a_total_act_energy","b_total_act_energy"],"data":[{"ts":1700000000,"period":60,"values":[[1.5,2.5],[1.25,0]]}],"next_record_ts":1700000120}`
+	var res DataResponse
+	if err := json.Unmarshal([]byte(payload), &res); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Keys) != 2 || len(res.Data) != 1 || res.Data[0].Period != 60 || res.Data[0].Values[1][0] != 1.25 {
+		t.Errorf("unexpected %+v", res)
+	}
+	if res.NextRecordTs == nil || *res.NextRecordTs != 1700000120 {
+		t.Errorf("unexpected next_record_ts %v", res.NextRecordTs)
+	}
+}
+
+func TestResetDataCounters_DeviceError(t *testing.T) {
+	d := types.NewFakeDevice()
+	wantErr := errors.New("denied")
+	d.SetError(resetDataCounters.String(), wantErr)
+
+	if err := ResetDataCounters(context.Background(), d, types.ChannelDefault, 0); !errors.Is(err, wantErr) {
+		t.Fatalf("expected %v, got %v", wantErr, err)
+	}
+}
+
+func TestGetEM1Status(t *testing.T) {
+	d := types.NewFakeDevice()
+	want := &EM1Status{Id: 1, Voltage: 231, ActPower: 420}
+	d.SetResult(em1GetStatus.String(), want)
+
+	got, err := GetEM1Status(context.Background(), d, types.ChannelDefault, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+	if len(d.Calls) != 1 || d.Calls[0].Method != "EM1.GetStatus" {
+		t.Errorf("unexpected calls %+v", d.Calls)
+	}
+	if req, ok := d.Calls[0].Params.(*IdRequest); !ok || req.Id != 1 {
+		t.Errorf("unexpected EM1.GetStatus params %#v", d.Calls[0].Params)
+	}
+}
+
+func TestEM1DataStatus_Unmarshal(t *testing.T) {
+	payload := `{"id":0,"total_act_energy":1234.5,"total_act_ret_energy":12}`
+	var s EM1DataStatus
+	if err := json.Unmarshal([]byte(payload), &s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.TotalActEnergy != 1234.5 || s.TotalActRetEnergy != 12 {
+		t.Errorf("unexpected %+v", s)
+	}
+}
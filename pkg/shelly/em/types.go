@@ -0,0 +1,142 @@
+package em
+
+// https://shelly-api-docs.shelly.cloud/gen2/ComponentsAndServices/EM
+// https://shelly-api-docs.shelly.cloud/gen2/ComponentsAndServices/EMData
+
+type Config struct {
+	Id                   int             `json:"id"`                            // Id of the EM component instance
+	Name                 *string         `json:"name,omitempty"`                // Name of the EM instance
+	BlinkModeSelector    string          `json:"blink_mode_selector,omitempty"` // Meter LED: active_energy or apparent_energy
+	PhaseSelector        string          `json:"phase_selector,omitempty"`      // Phase shown in the UI and used by the meter LED: all, a, b or c
+	MonitorPhaseSequence bool            `json:"monitor_phase_sequence"`        // True to report phase sequence errors
+	CTType               string          `json:"ct_type,omitempty"`             // Type of the current transformers, e.g. 120A
+	Reverse              map[string]bool `json:"reverse,omitempty"`             // Phases whose measurement direction is reversed, by phase (a, b, c)
+}
+
+type ConfigurationRequest struct {
+	Id            int    `json:"id"`     // Id of the EM component instance
+	Configuration Config `json:"config"` // Configuration that the method takes
+}
+
+type ConfigurationResponse struct {
+	RestartRequired bool `json:"restart_required"` // True if the device needs to be restarted for the changes to take effect
+}
+
+type Status struct {
+	Id int `json:"id"` // Id of the EM component instance
+
+	ACurrent   float32 `json:"a_current"`    // Phase A current in Amperes
+	AVoltage   float32 `json:"a_voltage"`    // Phase A voltage in Volts
+	AActPower  float32 `json:"a_act_power"`  // Phase A active power in Watts
+	AAprtPower float32 `json:"a_aprt_power"` // Phase A apparent power in Volt-Amperes
+	APf        float32 `json:"a_pf"`         // Phase A power factor
+	AFreq      float32 `json:"a_freq"`       // Phase A network frequency in Hz
+
+	BCurrent   float32 `json:"b_current"`    // Phase B current in Amperes
+	BVoltage   float32 `json:"b_voltage"`    // Phase B voltage in Volts
+	BActPower  float32 `json:"b_act_power"`  // Phase B active power in Watts
+	BAprtPower float32 `json:"b_aprt_power"` // Phase B apparent power in Volt-Amperes
+	BPf        float32 `json:"b_pf"`         // Phase B power factor
+	BFreq      float32 `json:"b_freq"`       // Phase B network frequency in Hz
+
+	CCurrent   float32 `json:"c_current"`    // Phase C current in Amperes
+	CVoltage   float32 `json:"c_voltage"`    // Phase C voltage in Volts
+	CActPower  float32 `json:"c_act_power"`  // Phase C active power in Watts
+	CAprtPower float32 `json:"c_aprt_power"` // Phase C apparent power in Volt-Amperes
+	CPf        float32 `json:"c_pf"`         // Phase C power factor
+	CFreq      float32 `json:"c_freq"`       // Phase C network frequency in Hz
+
+	NCurrent       *float32 `json:"n_current,omitempty"` // Neutral current in Amperes (null if not measured)
+	TotalCurrent   float32  `json:"total_current"`       // Sum of the phases' currents in Amperes
+	TotalActPower  float32  `json:"total_act_power"`     // Sum of the phases' active power in Watts
+	TotalAprtPower float32  `json:"total_aprt_power"`    // Sum of the phases' apparent power in Volt-Amperes
+
+	UserCalibratedPhase []string `json:"user_calibrated_phase,omitempty"` // Phases with a user calibration
+	Errors              []string `json:"errors,omitempty"`                // Error conditions of the whole meter (shown if at least one error is present)
+}
+
+type DataStatus struct {
+	Id int `json:"id"` // Id of the EMData component instance
+
+	ATotalActEnergy    float32 `json:"a_total_act_energy"`     // Phase A active energy consumed in Watt-hours
+	ATotalActRetEnergy float32 `json:"a_total_act_ret_energy"` // Phase A active energy returned in Watt-hours
+	BTotalActEnergy    float32 `json:"b_total_act_energy"`     // Phase B active energy consumed in Watt-hours
+	BTotalActRetEnergy float32 `json:"b_total_act_ret_energy"` // Phase B active energy returned in Watt-hours
+	CTotalActEnergy    float32 `json:"c_total_act_energy"`     // Phase C active energy consumed in Watt-hours
+	CTotalActRetEnergy float32 `json:"c_total_act_ret_energy"` // Phase C active energy returned in Watt-hours
+	TotalAct           float32 `json:"total_act"`              // All phases active energy consumed in Watt-hours
+	TotalActRet        float32 `json:"total_act_ret"`          // All phases active energy returned in Watt-hours
+
+	Errors []string `json:"errors,omitempty"` // Error conditions occurred (shown if at least one error is present)
+}
+
+type IdRequest struct {
+	Id int `json:"id"` // Id of the EM/EMData component instance
+}
+
+type RecordsRequest struct {
+	Id int   `json:"id"`           // Id of the EMData component instance
+	Ts int64 `json:"ts,omitempty"` // Unix timestamp of the first record to list
+}
+
+type RecordsResponse struct {
+	DataBlocks []struct {
+		Ts      int64 `json:"ts"`      // Unix timestamp of the first record of the block
+		Period  int   `json:"period"`  // Seconds between two records of the block
+		Records int   `json:"records"` // Number of records in the block
+	} `json:"data_blocks"`
+}
+
+type DataRequest struct {
+	Id    int   `json:"id"`               // Id of the EMData component instance
+	Ts    int64 `json:"ts"`               // Unix timestamp of the first record to get
+	EndTs int64 `json:"end_ts,omitempty"` // Unix timestamp of the last record to get
+}
+
+type DataResponse struct {
+	Keys []string `json:"keys"` // Name of each value of a record, e.g. a_total_act_energy
+	Data []struct {
+		Ts     int64       `json:"ts"`     // Unix timestamp of the first record of the block
+		Period int         `json:"period"` // Seconds between two records of the block
+		Values [][]float64 `json:"values"` // Records of the block, each with one value per key
+	} `json:"data"`
+	NextRecordTs *int64 `json:"next_record_ts,omitempty"` // Unix timestamp to get the next records from, if the response is truncated
+}
+
+// https://shelly-api-docs.shelly.cloud/gen2/ComponentsAndServices/EM1
+// https://shelly-api-docs.shelly.cloud/gen2/ComponentsAndServices/EM1Data
+//
+// Single-phase meters (e.g. Pro EM, with em1:0 and em1:1) report one EM1 and
+// one EM1Data instance per channel instead of the three-phase EM and EMData.
+
+type EM1Config struct {
+	Id      int     `json:"id"`                // Id of the EM1 component instance
+	Name    *string `json:"name,omitempty"`    // Name of the EM1 instance
+	CTType  string  `json:"ct_type,omitempty"` // Type of the current transformer, e.g. 50A
+	Reverse bool    `json:"reverse"`           // True if the measurement direction is reversed
+}
+
+type EM1ConfigurationRequest struct {
+	Id            int       `json:"id"`     // Id of the EM1 component instance
+	Configuration EM1Config `json:"config"` // Configuration that the method takes
+}
+
+type EM1Status struct {
+	Id          int      `json:"id"`                    // Id of the EM1 component instance
+	Current     float32  `json:"current"`               // Current in Amperes
+	Voltage     float32  `json:"voltage"`               // Voltage in Volts
+	ActPower    float32  `json:"act_power"`             // Active power in Watts
+	AprtPower   float32  `json:"aprt_power"`            // Apparent power in Volt-Amperes
+	Pf          float32  `json:"pf"`                    // Power factor
+	Freq        float32  `json:"freq"`                  // Network frequency in Hz
+	Calibration string   `json:"calibration,omitempty"` // Calibration in use: factory or user
+	Errors      []string `json:"errors,omitempty"`      // Error conditions (shown if at least one error is present)
+	Flags       []string `json:"flags,omitempty"`       // Measurement flags, e.g. count_disabled
+}
+
+type EM1DataStatus struct {
+	Id                int      `json:"id"`                   // Id of the EM1Data component instance
+	TotalActEnergy    float32  `json:"total_act_energy"`     // Active energy consumed in Watt-hours
+	TotalActRetEnergy float32  `json:"total_act_ret_energy"` // Active energy returned in Watt-hours
+	Errors            []string `json:"errors,omitempty"`     // Error conditions occurred (shown if at least one error is present)
+}
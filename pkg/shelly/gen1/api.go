@@ -0,0 +1,77 @@
+package gen1
+
+// Subset of the Gen1 HTTP API used to control relays & read settings/status:
+// <https://shelly-api-docs.shelly.cloud/gen1/#common-http-api>
+
+// RelayStatus is returned by /relay/N (with or without a turn=... command).
+type RelayStatus struct {
+	IsOn           bool    `json:"ison"`                      // Whether the channel is turned ON or OFF
+	HasTimer       bool    `json:"has_timer"`                 // Whether a timer is currently armed for this channel
+	TimerStarted   int64   `json:"timer_started,omitempty"`   // Unix timestamp of timer start; 0 if timer inactive or time not synced
+	TimerDuration  float32 `json:"timer_duration,omitempty"`  // Timer duration, s
+	TimerRemaining float32 `json:"timer_remaining,omitempty"` // Experimental: remaining time of the timer, s
+	Overpower      bool    `json:"overpower,omitempty"`       // Whether an overpower condition turned the channel OFF (shown if applicable)
+	Source         string  `json:"source,omitempty"`          // Source of the last relay command
+}
+
+// RelaySettings is returned by /settings/relay/N.
+type RelaySettings struct {
+	Name          *string `json:"name"`                     // Channel name
+	ApplianceType string  `json:"appliance_type,omitempty"` // Custom configurable appliance type
+	IsOn          bool    `json:"ison"`                     // Whether the channel is turned ON or OFF
+	HasTimer      bool    `json:"has_timer"`                // Whether a timer is currently armed for this channel
+	DefaultState  string  `json:"default_state"`            // Power-on state: off, on, last or switch
+	BtnType       string  `json:"btn_type"`                 // Input mode: momentary, toggle, edge, detached, action or momentary_on_release
+	BtnReverse    int     `json:"btn_reverse"`              // Whether to invert the input logic (0 or 1)
+	AutoOn        float32 `json:"auto_on"`                  // Automatic flip back timer, s; 0 if disabled
+	AutoOff       float32 `json:"auto_off"`                 // Automatic flip back timer, s; 0 if disabled
+	Schedule      bool    `json:"schedule"`                 // Whether scheduling is enabled
+}
+
+type DeviceInfo struct {
+	Type     string `json:"type"`     // Device model identifier, e.g. SHSW-1
+	Mac      string `json:"mac"`      // MAC address of the device
+	Hostname string `json:"hostname"` // Device ID, e.g. shelly1-B929CC
+}
+
+// Settings is (a subset of) what /settings returns.
+type Settings struct {
+	Device    DeviceInfo      `json:"device"`
+	Name      *string         `json:"name"`                 // Unique name of the device
+	Firmware  string          `json:"fw"`                   // Current firmware version
+	Relays    []RelaySettings `json:"relays,omitempty"`     // Relays settings (shown if applicable)
+	SleepMode *SleepMode      `json:"sleep_mode,omitempty"` // Battery-powered devices only (shown if applicable)
+}
+
+type SleepMode struct {
+	Period int    `json:"period"` // Periodic wakeup period
+	Unit   string `json:"unit"`   // m or h
+}
+
+type WiFiStatus struct {
+	Connected bool   `json:"connected"`
+	SSID      string `json:"ssid,omitempty"`
+	Ip        string `json:"ip,omitempty"`
+	Rssi      int    `json:"rssi,omitempty"`
+}
+
+type Measure struct {
+	Value   float32 `json:"value"`
+	Units   string  `json:"units,omitempty"`
+	IsValid bool    `json:"is_valid"`
+}
+
+type Battery struct {
+	Value   int     `json:"value"`   // Battery level, %
+	Voltage float32 `json:"voltage"` // Battery voltage, V
+}
+
+// Status is (a subset of) what /status returns.
+type Status struct {
+	WiFi        WiFiStatus    `json:"wifi_sta"`
+	Relays      []RelayStatus `json:"relays,omitempty"` // Relays status (shown if applicable)
+	Temperature *Measure      `json:"tmp,omitempty"`    // H&T (shown if applicable)
+	Humidity    *Measure      `json:"hum,omitempty"`    // H&T (shown if applicable)
+	Battery     *Battery      `json:"bat,omitempty"`    // Battery-powered devices only (shown if applicable)
+	Uptime      int           `json:"uptime"`           // Seconds since last reboot
+}
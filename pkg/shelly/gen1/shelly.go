@@ -0,0 +1,437 @@
+package gen1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/mqtt"
+	"github.com/asnowfix/home-automation/pkg/shelly/shelly"
+	"github.com/asnowfix/home-automation/pkg/shelly/sswitch"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+)
+
+// ErrUnsupported is returned for RPC methods that have no Gen1 equivalent.
+var ErrUnsupported = errors.New("not supported by Gen1 devices")
+
+// The Gen2+ methods that Shelly translates to the Gen1 API
+const (
+	switchSet       = "Switch.Set"
+	switchToggle    = "Switch.Toggle"
+	switchGetStatus = "Switch.GetStatus"
+	switchGetConfig = "Switch.GetConfig"
+	switchSetConfig = "Switch.SetConfig"
+)
+
+// HttpTimeout bounds each HTTP request to a Gen1 device.
+var HttpTimeout = 5 * time.Second
+
+// Shelly is a Gen1 device (e.g. Shelly 1, Shelly H&T), controlled over its
+// HTTP API (/relay/N, /settings, /status) or, when its host is unknown, over
+// the shellies/<id>/relay/N/command MQTT topics. It implements types.Device,
+// translating the Switch.* RPC methods, so that Gen1 relays can be driven
+// like Gen2+ switches.
+type Shelly struct {
+	id       string
+	name     string
+	host     string
+	mac      net.HardwareAddr
+	mc       mqtt.Client
+	resolver types.HostResolver
+	modified bool
+}
+
+// NewShelly returns the Gen1 device with the given id (e.g.
+// shelly1-34945475FE06), reachable at host (if not empty) or through mc (if
+// not nil).
+func NewShelly(id string, host string, mc mqtt.Client) *Shelly {
+	return &Shelly{
+		id:   id,
+		name: id,
+		host: host,
+		mc:   mc,
+	}
+}
+
+// SetHostResolver installs the resolver used to find the IP address of the
+// device when its host is unknown. See types.HostResolver.
+func (d *Shelly) SetHostResolver(r types.HostResolver) {
+	d.resolver = r
+}
+
+func (d *Shelly) String() string {
+	return fmt.Sprintf("%s (%s)", d.name, d.id)
+}
+
+func (d *Shelly) Name() string         { return d.name }
+func (d *Shelly) Host() string         { return d.host }
+func (d *Shelly) Manufacturer() string { return "Shelly" }
+func (d *Shelly) Id() string           { return d.id }
+
+func (d *Shelly) Mac() net.HardwareAddr { return d.mac }
+
+func (d *Shelly) Ip() net.IP {
+	return net.ParseIP(d.host)
+}
+
+// Gen1 devices do not have a JSON-RPC dialog.
+
+func (d *Shelly) ReplyTo() string                           { return "" }
+func (d *Shelly) To() chan<- []byte                         { return nil }
+func (d *Shelly) From() <-chan []byte                       { return nil }
+func (d *Shelly) StartDialog(ctx context.Context) uint32    { return 0 }
+func (d *Shelly) StopDialog(ctx context.Context, id uint32) {}
+
+func (d *Shelly) IsHttpReady() bool { return d.host != "" }
+func (d *Shelly) IsMqttReady() bool { return d.mc != nil }
+
+func (d *Shelly) Channel(ctx context.Context, via types.Channel) types.Channel {
+	if via != types.ChannelDefault {
+		return via
+	}
+	if d.IsHttpReady() || d.ResolveHost(ctx) || !d.IsMqttReady() {
+		return types.ChannelHttp
+	}
+	return types.ChannelMqtt
+}
+
+// ResolveHost asks the HostResolver (if any) for the device's current IP,
+// keyed by MAC first and then by device ID. On success it updates the host
+// and returns true.
+func (d *Shelly) ResolveHost(ctx context.Context) bool {
+	if d.resolver == nil {
+		return false
+	}
+	ip, err := d.resolver.ResolveHost(ctx, d.mac, d.id)
+	if err != nil || ip == nil {
+		return false
+	}
+	d.UpdateHost(ip.String())
+	return true
+}
+
+func (d *Shelly) UpdateName(name string) {
+	if name != "" && d.name != name {
+		d.name = name
+		d.modified = true
+	}
+}
+
+func (d *Shelly) UpdateHost(host string) {
+	if d.host != host {
+		d.host = host
+		d.modified = true
+	}
+}
+
+func (d *Shelly) ClearHost() {
+	d.UpdateHost("")
+}
+
+func (d *Shelly) UpdateMac(mac string) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return
+	}
+	if d.mac.String() != hw.String() {
+		d.mac = hw
+		d.modified = true
+	}
+}
+
+func (d *Shelly) UpdateId(id string) {
+	if id != "" && d.id != id {
+		d.id = id
+		d.modified = true
+	}
+}
+
+func (d *Shelly) IsModified() bool { return d.modified }
+func (d *Shelly) ResetModified()   { d.modified = false }
+
+// CallE translates the Switch.* methods to the Gen1 relay API. Status &
+// configuration are only available over HTTP.
+func (d *Shelly) CallE(ctx context.Context, via types.Channel, method string, params any) (any, error) {
+	via = d.Channel(ctx, via)
+	switch method {
+	case switchSet:
+		req, ok := params.(*sswitch.SetRequest)
+		if !ok {
+			return nil, fmt.Errorf("%s: unexpected params type %T", method, params)
+		}
+		turn := "off"
+		if req.On {
+			turn = "on"
+		}
+		if via == types.ChannelMqtt {
+			// The previous state is not known over MQTT
+			return &sswitch.ToogleSetResponse{}, d.publishRelayCommand(ctx, req.Id, turn)
+		}
+		prev, err := d.GetRelay(ctx, req.Id)
+		if err != nil {
+			return nil, err
+		}
+		q := url.Values{"turn": {turn}}
+		if req.ToggleAfter > 0 {
+			q.Set("timer", strconv.Itoa(req.ToggleAfter))
+		}
+		if _, err := d.relay(ctx, req.Id, q); err != nil {
+			return nil, err
+		}
+		return &sswitch.ToogleSetResponse{WasOn: prev.IsOn}, nil
+
+	case switchToggle:
+		req, ok := params.(*sswitch.ToggleStatusConfigRequest)
+		if !ok {
+			return nil, fmt.Errorf("%s: unexpected params type %T", method, params)
+		}
+		if via == types.ChannelMqtt {
+			return &sswitch.ToogleSetResponse{}, d.publishRelayCommand(ctx, req.Id, "toggle")
+		}
+		rs, err := d.relay(ctx, req.Id, url.Values{"turn": {"toggle"}})
+		if err != nil {
+			return nil, err
+		}
+		return &sswitch.ToogleSetResponse{WasOn: !rs.IsOn}, nil
+
+	case switchGetStatus:
+		req, ok := params.(*sswitch.ToggleStatusConfigRequest)
+		if !ok {
+			return nil, fmt.Errorf("%s: unexpected params type %T", method, params)
+		}
+		if err := d.httpOnly(method, via); err != nil {
+			return nil, err
+		}
+		rs, err := d.GetRelay(ctx, req.Id)
+		if err != nil {
+			return nil, err
+		}
+		return &sswitch.Status{
+			Id:            req.Id,
+			Source:        rs.Source,
+			Output:        rs.IsOn,
+			TimerDuration: rs.TimerDuration,
+		}, nil
+
+	case switchGetConfig:
+		req, ok := params.(*sswitch.ToggleStatusConfigRequest)
+		if !ok {
+			return nil, fmt.Errorf("%s: unexpected params type %T", method, params)
+		}
+		if err := d.httpOnly(method, via); err != nil {
+			return nil, err
+		}
+		var rs RelaySettings
+		if err := d.get(ctx, fmt.Sprintf("/settings/relay/%d", req.Id), nil, &rs); err != nil {
+			return nil, err
+		}
+		return switchConfig(req.Id, &rs), nil
+
+	case switchSetConfig:
+		req, ok := params.(*sswitch.ConfigurationRequest)
+		if !ok {
+			return nil, fmt.Errorf("%s: unexpected params type %T", method, params)
+		}
+		if err := d.httpOnly(method, via); err != nil {
+			return nil, err
+		}
+		q, err := relaySettingsQuery(&req.Configuration)
+		if err != nil {
+			return nil, err
+		}
+		var rs RelaySettings
+		if err := d.get(ctx, fmt.Sprintf("/settings/relay/%d", req.Id), q, &rs); err != nil {
+			return nil, err
+		}
+		return &sswitch.ConfigurationResponse{}, nil
+	}
+	return nil, fmt.Errorf("%s: %w", method, ErrUnsupported)
+}
+
+func (d *Shelly) httpOnly(method string, via types.Channel) error {
+	if via != types.ChannelHttp {
+		return fmt.Errorf("%s over %s: %w", method, via, ErrUnsupported)
+	}
+	return nil
+}
+
+// GetRelay returns the status of relay N (/relay/N).
+func (d *Shelly) GetRelay(ctx context.Context, id int) (*RelayStatus, error) {
+	return d.relay(ctx, id, nil)
+}
+
+func (d *Shelly) relay(ctx context.Context, id int, q url.Values) (*RelayStatus, error) {
+	var rs RelayStatus
+	if err := d.get(ctx, fmt.Sprintf("/relay/%d", id), q, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// GetSettings returns the device settings (/settings).
+func (d *Shelly) GetSettings(ctx context.Context) (*Settings, error) {
+	var s Settings
+	if err := d.get(ctx, "/settings", nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetStatus returns the device status (/status).
+func (d *Shelly) GetStatus(ctx context.Context) (*Status, error) {
+	var s Status
+	if err := d.get(ctx, "/status", nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetSwitchesSummary is the Gen1 equivalent of shelly.GetSwitchesSummary:
+// the name & state of every relay of the device.
+func (d *Shelly) GetSwitchesSummary(ctx context.Context) (map[int]shelly.SwitchSummary, error) {
+	settings, err := d.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status, err := d.GetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switches := make(map[int]shelly.SwitchSummary, len(settings.Relays))
+	for id, rs := range settings.Relays {
+		ss := shelly.SwitchSummary{
+			Id:   id,
+			Name: fmt.Sprintf("switch:%d", id),
+		}
+		if rs.Name != nil && *rs.Name != "" {
+			ss.Name = *rs.Name
+		}
+		if id < len(status.Relays) {
+			ss.On = status.Relays[id].IsOn
+		}
+		switches[id] = ss
+	}
+	return switches, nil
+}
+
+func (d *Shelly) get(ctx context.Context, path string, q url.Values, out any) error {
+	if d.host == "" && !d.ResolveHost(ctx) {
+		return fmt.Errorf("device %s: unknown host", d.id)
+	}
+	u := url.URL{Scheme: "http", Host: d.host, Path: path, RawQuery: q.Encode()}
+
+	ctx, cancel := context.WithTimeout(ctx, HttpTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("device %s: %w", d.id, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("device %s: GET %s: %s", d.id, path, res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("device %s: GET %s: %w", d.id, path, err)
+	}
+	return nil
+}
+
+// publishRelayCommand publishes on, off or toggle to
+// shellies/<id>/relay/<N>/command.
+// See: https://shelly-api-docs.shelly.cloud/gen1/#shelly1-shelly1pm-mqtt
+func (d *Shelly) publishRelayCommand(ctx context.Context, id int, command string) error {
+	if d.mc == nil {
+		return fmt.Errorf("device %s: no MQTT client", d.id)
+	}
+	topic := fmt.Sprintf("shellies/%s/relay/%d/command", d.id, id)
+	return d.mc.Publish(ctx, topic, []byte(command), mqtt.AtLeastOnce, false /*retain*/, "shelly/gen1")
+}
+
+// Gen1 btn_type <-> Gen2+ in_mode
+var btnTypes = map[string]string{
+	"momentary": "momentary",
+	"toggle":    "follow",
+	"edge":      "flip",
+	"detached":  "detached",
+}
+
+// Gen1 default_state <-> Gen2+ initial_state
+var defaultStates = map[string]string{
+	"off":    "off",
+	"on":     "on",
+	"last":   "restore_last",
+	"switch": "match_input",
+}
+
+func switchConfig(id int, rs *RelaySettings) *sswitch.Config {
+	c := &sswitch.Config{
+		Id:           id,
+		InMode:       rs.BtnType,
+		InitialState: rs.DefaultState,
+		AutoOn:       rs.AutoOn > 0,
+		AutoOnDelay:  rs.AutoOn,
+		AutoOff:      rs.AutoOff > 0,
+		AutoOffDelay: rs.AutoOff,
+	}
+	if rs.Name != nil {
+		c.Name = *rs.Name
+	}
+	// Gen1-only modes (e.g. action, momentary_on_release) are passed as-is
+	if m, ok := btnTypes[rs.BtnType]; ok {
+		c.InMode = m
+	}
+	if s, ok := defaultStates[rs.DefaultState]; ok {
+		c.InitialState = s
+	}
+	return c
+}
+
+func relaySettingsQuery(c *sswitch.Config) (url.Values, error) {
+	q := url.Values{}
+	if c.Name != "" {
+		q.Set("name", c.Name)
+	}
+	if c.InMode != "" {
+		bt, err := reverse(btnTypes, c.InMode)
+		if err != nil {
+			return nil, fmt.Errorf("in_mode: %w", err)
+		}
+		q.Set("btn_type", bt)
+	}
+	if c.InitialState != "" {
+		ds, err := reverse(defaultStates, c.InitialState)
+		if err != nil {
+			return nil, fmt.Errorf("initial_state: %w", err)
+		}
+		q.Set("default_state", ds)
+	}
+	var autoOn, autoOff float32
+	if c.AutoOn {
+		autoOn = c.AutoOnDelay
+	}
+	if c.AutoOff {
+		autoOff = c.AutoOffDelay
+	}
+	q.Set("auto_on", strconv.FormatFloat(float64(autoOn), 'f', -1, 32))
+	q.Set("auto_off", strconv.FormatFloat(float64(autoOff), 'f', -1, 32))
+	return q, nil
+}
+
+func reverse(m map[string]string, v string) (string, error) {
+	for k, mv := range m {
+		if mv == v {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("%q: %w", v, ErrUnsupported)
+}
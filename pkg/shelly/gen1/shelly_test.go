@@ -0,0 +1,167 @@
+package gen1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/mqtt"
+	"github.com/asnowfix/home-automation/pkg/shelly/sswitch"
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+)
+
+// fakeShelly1 serves the subset of the Gen1 HTTP API of a Shelly 1.
+type fakeShelly1 struct {
+	on       bool
+	settings RelaySettings
+	queries  []string
+}
+
+func (f *fakeShelly1) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.queries = append(f.queries, req.URL.Path+"?"+req.URL.RawQuery)
+	q := req.URL.Query()
+	var out any
+	switch req.URL.Path {
+	case "/relay/0":
+		switch q.Get("turn") {
+		case "on":
+			f.on = true
+		case "off":
+			f.on = false
+		case "toggle":
+			f.on = !f.on
+		}
+		out = RelayStatus{IsOn: f.on, Source: "http"}
+	case "/settings/relay/0":
+		if q.Has("btn_type") {
+			f.settings.BtnType = q.Get("btn_type")
+		}
+		if q.Has("default_state") {
+			f.settings.DefaultState = q.Get("default_state")
+		}
+		out = f.settings
+	case "/settings":
+		out = Settings{Relays: []RelaySettings{f.settings}}
+	case "/status":
+		out = Status{Relays: []RelayStatus{{IsOn: f.on}}}
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+func newTestShelly(t *testing.T) (*Shelly, *fakeShelly1) {
+	name := "pump"
+	f := &fakeShelly1{settings: RelaySettings{Name: &name, BtnType: "edge", DefaultState: "last"}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return NewShelly("shelly1-34945475FE06", strings.TrimPrefix(srv.URL, "http://"), nil), f
+}
+
+func TestSetAndToggle(t *testing.T) {
+	ctx := context.Background()
+	d, f := newTestShelly(t)
+
+	res, err := sswitch.Set(ctx, d, types.ChannelDefault, 0, true)
+	if err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if res.WasOn || !f.on {
+		t.Errorf("expected off -> on, got was_on=%v on=%v", res.WasOn, f.on)
+	}
+
+	res, err = sswitch.Toggle(ctx, d, types.ChannelDefault, 0)
+	if err != nil {
+		t.Fatalf("Toggle: %v", err)
+	}
+	if !res.WasOn || f.on {
+		t.Errorf("expected on -> off, got was_on=%v on=%v", res.WasOn, f.on)
+	}
+
+	status, err := sswitch.GetStatus(ctx, d, types.ChannelDefault, 0)
+	if err != nil {
+		t.Fatalf("GetStatus: %v", err)
+	}
+	if status.Output || status.Source != "http" {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	ctx := context.Background()
+	d, f := newTestShelly(t)
+
+	c, err := sswitch.GetConfig(ctx, d, types.ChannelDefault, 0)
+	if err != nil {
+		t.Fatalf("GetConfig: %v", err)
+	}
+	if c.Name != "pump" || c.InMode != "flip" || c.InitialState != "restore_last" {
+		t.Errorf("unexpected config %+v", c)
+	}
+
+	c.InMode = "detached"
+	c.InitialState = "match_input"
+	if _, err := sswitch.SetConfig(ctx, d, types.ChannelDefault, 0, c); err != nil {
+		t.Fatalf("SetConfig: %v", err)
+	}
+	if f.settings.BtnType != "detached" || f.settings.DefaultState != "switch" {
+		t.Errorf("unexpected settings %+v", f.settings)
+	}
+
+	c.InMode = "cycle"
+	if _, err := sswitch.SetConfig(ctx, d, types.ChannelDefault, 0, c); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestSwitchesSummary(t *testing.T) {
+	d, f := newTestShelly(t)
+	f.on = true
+
+	switches, err := d.GetSwitchesSummary(context.Background())
+	if err != nil {
+		t.Fatalf("GetSwitchesSummary: %v", err)
+	}
+	if len(switches) != 1 || switches[0].Name != "pump" || !switches[0].On {
+		t.Errorf("unexpected switches %+v", switches)
+	}
+}
+
+func TestMqtt(t *testing.T) {
+	ctx := context.Background()
+	mc := mqtt.NewMockClient()
+	commands, err := mc.Subscribe(ctx, "shellies/shelly1-34945475FE06/relay/0/command", 2, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No host: MQTT is used by default
+	d := NewShelly("shelly1-34945475FE06", "", mc)
+	if _, err := sswitch.Set(ctx, d, types.ChannelDefault, 0, true); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := sswitch.Toggle(ctx, d, types.ChannelMqtt, 0); err != nil {
+		t.Fatalf("Toggle: %v", err)
+	}
+	for _, want := range []string{"on", "toggle"} {
+		if got := string(<-commands); got != want {
+			t.Errorf("got command %q, want %q", got, want)
+		}
+	}
+
+	if _, err := sswitch.GetStatus(ctx, d, types.ChannelDefault, 0); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported over MQTT, got %v", err)
+	}
+}
+
+func TestUnsupportedMethod(t *testing.T) {
+	d := NewShelly("shelly1-34945475FE06", "192.0.2.1", nil)
+	if _, err := d.CallE(context.Background(), types.ChannelDefault, "Shelly.Reboot", nil); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}
@@ -8,17 +8,26 @@ require (
 	github.com/asnowfix/home-automation/internal/myhome/net v0.0.0-20260714105922-3929eb070393
 	github.com/asnowfix/home-automation/internal/shelly/scripts v0.0.0-20260714105922-3929eb070393
 	github.com/asnowfix/home-automation/pkg/devices v0.0.0-20260714105922-3929eb070393
+	github.com/asnowfix/home-automation/pkg/shelly/cover v0.0.0-00010101000000-000000000000
+	github.com/asnowfix/home-automation/pkg/shelly/devicepower v0.0.0-00010101000000-000000000000
+	github.com/asnowfix/home-automation/pkg/shelly/em v0.0.0-00010101000000-000000000000
 	github.com/asnowfix/home-automation/pkg/shelly/ethernet v0.0.0-20260714105922-3929eb070393
 	github.com/asnowfix/home-automation/pkg/shelly/input v0.0.0-20260714105922-3929eb070393
 	github.com/asnowfix/home-automation/pkg/shelly/kvs v0.0.0-20260714105922-3929eb070393
+	github.com/asnowfix/home-automation/pkg/shelly/light v0.0.0-00010101000000-000000000000
 	github.com/asnowfix/home-automation/pkg/shelly/mqtt v0.0.0-20260714105922-3929eb070393
+	github.com/asnowfix/home-automation/pkg/shelly/pm1 v0.0.0-00010101000000-000000000000
 	github.com/asnowfix/home-automation/pkg/shelly/schedule v0.0.0-20260714105922-3929eb070393
 	github.com/asnowfix/home-automation/pkg/shelly/script v0.0.0-20260714105922-3929eb070393
 	github.com/asnowfix/home-automation/pkg/shelly/shelly v0.0.0-20260714105922-3929eb070393
 	github.com/asnowfix/home-automation/pkg/shelly/shttp v0.0.0-20260714105922-3929eb070393
 	github.com/asnowfix/home-automation/pkg/shelly/sswitch v0.0.0-20260714105922-3929eb070393
+	github.com/asnowfix/home-automation/pkg/shelly/sudp v0.0.0-00010101000000-000000000000
+	github.com/asnowfix/home-automation/pkg/shelly/sws v0.0.0-00010101000000-000000000000
 	github.com/asnowfix/home-automation/pkg/shelly/system v0.0.0-20260714105922-3929eb070393
 	github.com/asnowfix/home-automation/pkg/shelly/types v0.0.0-20260714105922-3929eb070393
+	github.com/asnowfix/home-automation/pkg/shelly/virtual v0.0.0-00010101000000-000000000000
+	github.com/asnowfix/home-automation/pkg/shelly/webhook v0.0.0-00010101000000-000000000000
 	github.com/asnowfix/home-automation/pkg/shelly/wifi v0.0.0-20260714105922-3929eb070393
 	github.com/go-logr/logr v1.4.3
 	github.com/grandcat/zeroconf v1.0.0
@@ -74,3 +83,21 @@ require (
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	sigs.k8s.io/yaml v1.6.0 // indirect
 )
+
+replace github.com/asnowfix/home-automation/pkg/shelly/sudp => ./sudp
+
+replace github.com/asnowfix/home-automation/pkg/shelly/sws => ./sws
+
+replace github.com/asnowfix/home-automation/pkg/shelly/cover => ./cover
+
+replace github.com/asnowfix/home-automation/pkg/shelly/devicepower => ./devicepower
+
+replace github.com/asnowfix/home-automation/pkg/shelly/em => ./em
+
+replace github.com/asnowfix/home-automation/pkg/shelly/light => ./light
+
+replace github.com/asnowfix/home-automation/pkg/shelly/pm1 => ./pm1
+
+replace github.com/asnowfix/home-automation/pkg/shelly/virtual => ./virtual
+
+replace github.com/asnowfix/home-automation/pkg/shelly/webhook => ./webhook
@@ -0,0 +1,103 @@
+package light
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+var log logr.Logger
+
+type empty struct{}
+
+type Verb string
+
+func (v Verb) String() string {
+	return string(v) // Convert Verb to string
+}
+
+const (
+	getConfig Verb = "Light.GetConfig"
+	setConfig Verb = "Light.SetConfig"
+	getStatus Verb = "Light.GetStatus"
+	toggle    Verb = "Light.Toggle"
+	set       Verb = "Light.Set"
+)
+
+func Init(l logr.Logger, r types.MethodsRegistrar) {
+	log = l
+	log.Info("Init", "package", reflect.TypeOf(empty{}).PkgPath())
+
+	r.RegisterMethodHandler(getConfig.String(), types.MethodHandler{
+		Allocate:   func() any { return new(Config) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(setConfig.String(), types.MethodHandler{
+		Allocate:   func() any { return new(ConfigurationResponse) },
+		HttpMethod: http.MethodPost,
+	})
+	r.RegisterMethodHandler(getStatus.String(), types.MethodHandler{
+		Allocate:   func() any { return new(Status) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(toggle.String(), types.MethodHandler{
+		Allocate:   func() any { return nil },
+		HttpMethod: http.MethodPost,
+	})
+	r.RegisterMethodHandler(set.String(), types.MethodHandler{
+		Allocate:   func() any { return nil },
+		HttpMethod: http.MethodPost,
+	})
+}
+
+func doCall[reqT any, resT any](ctx context.Context, device types.Device, via types.Channel, verb Verb, req *reqT) (*resT, error) {
+	out, err := device.CallE(ctx, via, verb.String(), req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s on device %s: %w", verb, device.Id(), err)
+	}
+
+	result, ok := out.(*resT)
+	if !ok {
+		var expected resT
+		return nil, fmt.Errorf("unexpected response type %T (should be *%T)", out, expected)
+	}
+	return result, nil
+}
+
+func GetConfig(ctx context.Context, device types.Device, via types.Channel, id int) (*Config, error) {
+	return doCall[IdRequest, Config](ctx, device, via, getConfig, &IdRequest{Id: id})
+}
+
+func SetConfig(ctx context.Context, device types.Device, via types.Channel, id int, config *Config) (*ConfigurationResponse, error) {
+	return doCall[ConfigurationRequest, ConfigurationResponse](ctx, device, via, setConfig, &ConfigurationRequest{Id: id, Configuration: *config})
+}
+
+func GetStatus(ctx context.Context, device types.Device, via types.Channel, id int) (*Status, error) {
+	return doCall[IdRequest, Status](ctx, device, via, getStatus, &IdRequest{Id: id})
+}
+
+func Toggle(ctx context.Context, device types.Device, via types.Channel, id int) error {
+	_, err := device.CallE(ctx, via, toggle.String(), &IdRequest{Id: id})
+	if err != nil {
+		return fmt.Errorf("failed to call %s on device %s: %w", toggle, device.Id(), err)
+	}
+	return nil
+}
+
+// Set turns the light on or off (if req.On is set) and/or sets its
+// brightness (if req.Brightness is set, in percent).
+func Set(ctx context.Context, device types.Device, via types.Channel, req *SetRequest) error {
+	if req.Brightness != nil && (*req.Brightness < 0 || *req.Brightness > 100) {
+		return fmt.Errorf("invalid brightness %v: must be 0-100", *req.Brightness)
+	}
+	_, err := device.CallE(ctx, via, set.String(), req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s on device %s: %w", set, device.Id(), err)
+	}
+	return nil
+}
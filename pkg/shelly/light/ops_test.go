@@ -0,0 +1,60 @@
+package light
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+)
+
+func TestGetStatus(t *testing.T) {
+	d := types.NewFakeDevice()
+	want := &Status{Id: 0, Output: true, Brightness: 60}
+	d.SetResult(getStatus.String(), want)
+
+	got, err := GetStatus(context.Background(), d, types.ChannelDefault, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestSet(t *testing.T) {
+	d := types.NewFakeDevice()
+	d.SetResult(set.String(), nil)
+
+	on := true
+	brightness := float32(30)
+	err := Set(context.Background(), d, types.ChannelDefault, &SetRequest{Id: 1, On: &on, Brightness: &brightness})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req, ok := d.Calls[0].Params.(*SetRequest)
+	if !ok || req.Id != 1 || *req.On != true || *req.Brightness != 30 {
+		t.Errorf("unexpected Light.Set params %#v", d.Calls[0].Params)
+	}
+}
+
+func TestSet_InvalidBrightness(t *testing.T) {
+	d := types.NewFakeDevice()
+	brightness := float32(120)
+	if err := Set(context.Background(), d, types.ChannelDefault, &SetRequest{Brightness: &brightness}); err == nil {
+		t.Fatal("expected an error for brightness 120")
+	}
+	if len(d.Calls) != 0 {
+		t.Errorf("expected no call to the device, got %v", d.Calls)
+	}
+}
+
+func TestToggle_DeviceError(t *testing.T) {
+	d := types.NewFakeDevice()
+	wantErr := errors.New("overtemp")
+	d.SetError(toggle.String(), wantErr)
+
+	if err := Toggle(context.Background(), d, types.ChannelDefault, 0); !errors.Is(err, wantErr) {
+		t.Fatalf("expected %v, got %v", wantErr, err)
+	}
+}
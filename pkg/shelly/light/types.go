@@ -0,0 +1,75 @@
+package light
+
+// https://shelly-api-docs.shelly.cloud/gen2/ComponentsAndServices/Light
+
+type Config struct {
+	Id                    int     `json:"id"`                                 // Id of the Light component instance
+	Name                  *string `json:"name,omitempty"`                     // Name of the light instance
+	InMode                string  `json:"in_mode,omitempty"`                  // Mode of the associated input. Range of values: follow, flip, activate, detached, dim, dual_dim (if applicable)
+	InitialState          string  `json:"initial_state,omitempty"`            // Output state to set on power_on. Range of values: off, on, restore_last
+	AutoOn                bool    `json:"auto_on"`                            // True if the "Automatic ON" function is enabled, false otherwise
+	AutoOnDelay           float32 `json:"auto_on_delay"`                      // Seconds to pass until the component is switched back on
+	AutoOff               bool    `json:"auto_off"`                           // True if the "Automatic OFF" function is enabled, false otherwise
+	AutoOffDelay          float32 `json:"auto_off_delay"`                     // Seconds to pass until the component is switched back off
+	TransitionDuration    float32 `json:"transition_duration,omitempty"`      // Seconds of the transition between brightness levels (shown if applicable)
+	MinBrightnessOnToggle float32 `json:"min_brightness_on_toggle,omitempty"` // Brightness (in percent) to turn on with, if the current one is lower (shown if applicable)
+	Default               *struct {
+		Brightness float32 `json:"brightness"` // Brightness (in percent) to turn on with
+	} `json:"default,omitempty"`
+	NightMode *struct {
+		Enable        bool     `json:"enable"`         // True to use the night mode brightness within the active periods
+		Brightness    float32  `json:"brightness"`     // Brightness (in percent) to turn on with within the active periods
+		ActiveBetween []string `json:"active_between"` // Start and end times (HH:MM) of the night mode
+	} `json:"night_mode,omitempty"`
+}
+
+type ConfigurationRequest struct {
+	Id            int    `json:"id"`     // Id of the Light component instance
+	Configuration Config `json:"config"` // Configuration that the method takes
+}
+
+type ConfigurationResponse struct {
+	RestartRequired bool `json:"restart_required"` // True if the device needs to be restarted for the changes to take effect
+}
+
+type Status struct {
+	Id             int     `json:"id"`                         // Id of the Light component instance
+	Source         string  `json:"source"`                     // Source of the last command, for example: init, WS_in, http, ...
+	Output         bool    `json:"output"`                     // true if the output channel is currently on, false otherwise
+	Brightness     float32 `json:"brightness"`                 // Current brightness level (in percent)
+	TimerStartedAt float32 `json:"timer_started_at,omitempty"` // Unix timestamp, start time of the timer (in UTC) (shown if the timer is triggered)
+	TimerDuration  float32 `json:"timer_duration,omitempty"`   // Duration of the timer in seconds (shown if the timer is triggered)
+	Transition     *struct {
+		Target *struct {
+			Output     bool    `json:"output"`     // Target output state
+			Brightness float32 `json:"brightness"` // Target brightness (in percent)
+		} `json:"target,omitempty"`
+		StartedAt float32 `json:"started_at"` // Unix timestamp of the start of the transition
+		Duration  float32 `json:"duration"`   // Duration of the transition in seconds
+	} `json:"transition,omitempty"` // Transition in progress (shown if applicable)
+	Apower  float32 `json:"apower,omitempty"`  // Last measured instantaneous active power (in Watts) delivered to the attached load (shown if applicable)
+	Voltage float32 `json:"voltage,omitempty"` // Last measured voltage in Volts (shown if applicable)
+	Current float32 `json:"current,omitempty"` // Last measured current in Amperes (shown if applicable)
+	Aenergy *struct {
+		Total    float32   `json:"total"`     // Total energy consumed in Watt-hours
+		ByMinute []float32 `json:"by_minute"` // Energy consumption by minute (in Milliwatt-hours) for the last three minutes
+		MinuteTs int       `json:"minute_ts"` // Unix timestamp of the first second of the last minute (in UTC)
+	} `json:"aenergy,omitempty"`
+	Temperature *struct {
+		Celsius    float32 `json:"tC,omitempty"` // Temperature in Celsius
+		Fahrenheit float32 `json:"tF,omitempty"` // Temperature in Fahrenheit
+	} `json:"temperature,omitempty"`
+	Errors []string `json:"errors,omitempty"` // Error conditions occurred, e.g. overtemp, overpower (shown if at least one error is present)
+}
+
+type IdRequest struct {
+	Id int `json:"id"` // Id of the Light component instance
+}
+
+type SetRequest struct {
+	Id                 int      `json:"id"`                            // Id of the Light component instance. Required
+	On                 *bool    `json:"on,omitempty"`                  // true to turn on, false to turn off. Optional
+	Brightness         *float32 `json:"brightness,omitempty"`          // Brightness level (in percent). Optional
+	TransitionDuration float32  `json:"transition_duration,omitempty"` // Seconds of the transition to the new level. Optional
+	ToggleAfter        float32  `json:"toggle_after,omitempty"`        // Flip-back timer in seconds. Optional
+}
@@ -12,8 +12,6 @@ import (
 
 // <https://shelly-api-docs.shelly.cloud/gen2/General/RPCChannels#mqtt>
 
-var mqttChannel MqttChannel
-
 type MqttChannel struct {
 	log     *logr.Logger
 	timeout time.Duration
@@ -53,6 +53,59 @@ func TestMockClient_Publish_MultipleMessages(t *testing.T) {
 	}
 }
 
+func TestMockClient_Publish_WildcardSubscribers(t *testing.T) {
+	ctx := context.Background()
+	mc := NewMockClient()
+	all, _ := mc.Subscribe(ctx, "myhome/heater/#", 1, "subscriber")
+	one, _ := mc.Subscribe(ctx, "myhome/+/set-point", 1, "subscriber")
+	other, _ := mc.Subscribe(ctx, "myhome/pool/#", 1, "subscriber")
+
+	mc.Publish(ctx, "myhome/heater/set-point", []byte("19"), AtMostOnce, false, "publisher")
+	if got := string(<-all); got != "19" {
+		t.Errorf("# subscriber got %q", got)
+	}
+	if got := string(<-one); got != "19" {
+		t.Errorf("+ subscriber got %q", got)
+	}
+	select {
+	case msg := <-other:
+		t.Errorf("unexpected message %q", msg)
+	default:
+	}
+}
+
+func TestMockClient_Published(t *testing.T) {
+	mc := NewMockClient()
+	mc.Publish(context.Background(), "a/b", []byte("1"), AtMostOnce, false, "publisher")
+	mc.Publish(context.Background(), "a/c", []byte("2"), AtMostOnce, false, "publisher")
+
+	published := mc.Published()
+	if len(published) != 2 || published[0].Topic != "a/b" || string(published[1].Payload) != "2" {
+		t.Errorf("Published() = %+v", published)
+	}
+}
+
+func TestTopicMatches(t *testing.T) {
+	for _, tt := range []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a/b", "a", false},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/+/c", "a/b/c", true},
+		{"a/#", "a", true},
+		{"a/#", "a/b/c", true},
+		{"#", "a/b", true},
+	} {
+		if got := topicMatches(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("topicMatches(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
 // --- Publisher ---
 
 func TestMockClient_Publisher_DrainsSafely(t *testing.T) {
@@ -3,7 +3,6 @@ package mqtt
 import (
 	"context"
 	"net/url"
-	"sync"
 )
 
 // MQTT QoS levels
@@ -27,42 +26,16 @@ type Cache interface {
 	Insert(topic string, msg []byte) error
 }
 
-var (
-	client    Client
-	clientMu  sync.RWMutex
-	clientSet chan struct{}
-)
-
-func init() {
-	clientSet = make(chan struct{})
-}
-
-func SetClient(c Client) {
-	clientMu.Lock()
-	defer clientMu.Unlock()
-	if client != nil && c != client {
-		panic("BUG: MQTT client already set with different value")
-	}
-	client = c
-	close(clientSet)
-}
+type clientKey struct{}
 
-// ResetClient clears the global MQTT client so it can be set again.
-// This is intended for use in tests only.
-func ResetClient() {
-	clientMu.Lock()
-	defer clientMu.Unlock()
-	client = nil
-	clientSet = make(chan struct{})
+// NewContext returns a copy of ctx carrying c, the MQTT client of the scripts
+// run with ctx (see script.Run).
+func NewContext(ctx context.Context, c Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, c)
 }
 
-func GetClient(ctx context.Context) Client {
-	select {
-	case <-clientSet:
-		clientMu.RLock()
-		defer clientMu.RUnlock()
-		return client
-	case <-ctx.Done():
-		return nil
-	}
+// FromContext returns the MQTT client carried by ctx, if any.
+func FromContext(ctx context.Context) (Client, bool) {
+	c, ok := ctx.Value(clientKey{}).(Client)
+	return c, ok && c != nil
 }
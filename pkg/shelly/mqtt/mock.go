@@ -3,24 +3,32 @@ package mqtt
 import (
 	"context"
 	"net/url"
+	"strings"
 	"sync"
 )
 
 // MockClient is a minimal in-process MQTT client implementation for testing.
 //
 // Subscribe/Publish are wired together in-memory: Publish delivers a copy of
-// the payload to every channel currently registered (via Subscribe) for the
-// exact same topic. This lets tests exercise a script's MQTT.subscribe
-// callback by calling Publish with the topic/payload it expects — e.g.
-// simulating the daemon's retained `myhome/energy/solar/available` message.
-// There is no wildcard ("+"/"#") matching; topics must match exactly, which
-// is sufficient for the fixed, non-wildcard topics pool-pump.js and similar
-// scripts use.
+// the payload to every channel currently registered (via Subscribe) for a
+// topic filter matching the topic ("+" and "#" wildcards included). This lets
+// tests exercise a script's MQTT.subscribe callback by calling Publish with
+// the topic/payload it expects — e.g. simulating the daemon's retained
+// `myhome/energy/solar/available` message. Every published message is also
+// recorded, for tests to check what a script published (see Published).
 type MockClient struct {
 	server string
 
-	mu   sync.Mutex
-	subs map[string][]chan []byte // topic -> subscriber channels
+	mu        sync.Mutex
+	subs      map[string][]chan []byte // topic filter -> subscriber channels
+	published []MockMessage
+}
+
+// MockMessage is a message published through a MockClient.
+type MockMessage struct {
+	Topic     string
+	Payload   []byte
+	Publisher string // publisherName given to Publish
 }
 
 // NewMockClient creates a new mock MQTT client
@@ -74,7 +82,13 @@ func (m *MockClient) Publisher(ctx context.Context, topic string, qlen uint, qos
 // matching real broker QoS-0-ish behavior for this test double.
 func (m *MockClient) Publish(ctx context.Context, topic string, msg []byte, qos byte, retained bool, publisherName string) error {
 	m.mu.Lock()
-	chans := append([]chan []byte(nil), m.subs[topic]...)
+	var chans []chan []byte
+	for filter, subs := range m.subs {
+		if topicMatches(filter, topic) {
+			chans = append(chans, subs...)
+		}
+	}
+	m.published = append(m.published, MockMessage{Topic: topic, Payload: append([]byte(nil), msg...), Publisher: publisherName})
 	m.mu.Unlock()
 
 	for _, ch := range chans {
@@ -87,3 +101,26 @@ func (m *MockClient) Publish(ctx context.Context, topic string, msg []byte, qos
 	}
 	return nil
 }
+
+// Published returns the messages published so far, in order.
+func (m *MockClient) Published() []MockMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockMessage(nil), m.published...)
+}
+
+// topicMatches reports whether topic matches the MQTT topic filter, which
+// may contain "+" (one level) and "#" (any remaining levels) wildcards.
+func topicMatches(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(t) || (level != "+" && level != t[i]) {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
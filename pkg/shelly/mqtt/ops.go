@@ -29,11 +29,10 @@ const (
 	SetConfig Verb = "MQTT.SetConfig"
 )
 
-var registrar types.MethodsRegistrar
-
-func Init(log logr.Logger, r types.MethodsRegistrar, mc Client, timeout time.Duration) {
+// Init registers the MQTT methods, and a new MQTT channel, to r. timeout
+// bounds each call.
+func Init(log logr.Logger, r types.MethodsRegistrar, timeout time.Duration) {
 	log.Info("Init", "package", reflect.TypeOf(empty{}).PkgPath())
-	registrar = r
 	r.RegisterMethodHandler(GetStatus.String(), types.MethodHandler{
 		Allocate:   func() any { return new(Status) },
 		HttpMethod: http.MethodGet,
@@ -48,9 +47,9 @@ func Init(log logr.Logger, r types.MethodsRegistrar, mc Client, timeout time.Dur
 		HttpMethod: http.MethodPost,
 	})
 
-	SetClient(mc)
-	mqttChannel.Init(log, timeout)
-	registrar.RegisterDeviceCaller(types.ChannelMqtt, types.DeviceCaller(mqttChannel.CallDevice))
+	ch := &MqttChannel{}
+	ch.Init(log, timeout)
+	r.RegisterDeviceCaller(types.ChannelMqtt, types.DeviceCaller(ch.CallDevice))
 }
 
 func init() {
@@ -2,23 +2,8 @@ package shelly
 
 import (
 	"context"
-	"github.com/asnowfix/home-automation/pkg/shelly/ble"
-	"github.com/asnowfix/home-automation/pkg/shelly/ethernet"
-	"github.com/asnowfix/home-automation/pkg/shelly/input"
-	"github.com/asnowfix/home-automation/pkg/shelly/kvs"
-	"github.com/asnowfix/home-automation/pkg/shelly/matter"
 	"github.com/asnowfix/home-automation/pkg/shelly/mqtt"
-	"github.com/asnowfix/home-automation/pkg/shelly/ratelimit"
-	"github.com/asnowfix/home-automation/pkg/shelly/script"
-	"github.com/asnowfix/home-automation/pkg/shelly/shelly"
-	shttp "github.com/asnowfix/home-automation/pkg/shelly/shttp"
-	"github.com/asnowfix/home-automation/pkg/shelly/sswitch"
-	"github.com/asnowfix/home-automation/pkg/shelly/system"
 	"github.com/asnowfix/home-automation/pkg/shelly/types"
-	"github.com/asnowfix/home-automation/pkg/shelly/wifi"
-	"reflect"
-	"github.com/asnowfix/home-automation/pkg/shelly/schedule"
-	scripts "github.com/asnowfix/home-automation/internal/shelly/scripts"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -26,38 +11,46 @@ import (
 
 type empty struct{}
 
-func Init(log logr.Logger, mc mqtt.Client, timeout time.Duration, rateLimitInterval time.Duration) {
-	log.Info("Init", "package", reflect.TypeOf(empty{}).PkgPath(), "rateLimit", rateLimitInterval)
-	registrar.Init(log)
-
-	// Initialize rate limiter
-	ratelimit.Init(rateLimitInterval)
-
-	// Keep in lexical order
-	// gen1.Init(log, &registrar)
-	shelly.Init(log, &registrar, timeout)
-	ble.Init(log, &registrar)
-	ethernet.Init(log, &registrar)
-	input.Init(log, &registrar)
-	kvs.Init(log, &registrar)
-	matter.Init(log, &registrar)
-	mqtt.Init(log, &registrar, mc, timeout)
-	schedule.Init(log, &registrar)
-	script.Init(log, &registrar, scripts.GetFS())
-	shttp.Init(log, &registrar)
-	sswitch.Init(log, &registrar)
-	system.Init(log, &registrar)
-	// temperature.Init(log, &registrar)
-	wifi.Init(log, &registrar)
+// defaultClient is the Client of the package-level functions, and of the
+// devices not created by a Client.
+var defaultClient = &Client{}
+
+// Init sets up the default Client (see NewClient). udpPort is the
+// rpc_udp.listen_port assumed for devices called over UDP (0: none).
+func Init(log logr.Logger, mc mqtt.Client, timeout time.Duration, rateLimitInterval time.Duration, udpPort uint16) {
+	defaultClient = NewClient(log, mc, timeout, rateLimitInterval, udpPort)
+}
+
+// Default returns the default Client, set up by Init.
+func Default() *Client {
+	return defaultClient
 }
 
 func (r *Registrar) CallE(ctx context.Context, d types.Device, via types.Channel, mh types.MethodHandler, params any) (any, error) {
 	return r.channels[d.Channel(ctx, via)](ctx, d, mh, mh.Allocate(), params)
 }
 
-// SetHostResolver installs the resolver used to (re-)resolve a device's IP
-// address when it is unknown, or immediately after an HTTP dial failure.
-// See types.HostResolver. Call once at daemon startup.
+// SetHostResolver installs the resolver of the default Client. See
+// Client.SetHostResolver. Call once at daemon startup.
 func SetHostResolver(r types.HostResolver) {
-	types.SetHostResolver(r)
+	defaultClient.SetHostResolver(r)
+}
+
+// SetCredentialsProvider installs the credentials provider of the default
+// Client. See Client.SetCredentialsProvider.
+func SetCredentialsProvider(p types.CredentialsProvider) error {
+	return defaultClient.SetCredentialsProvider(p)
+}
+
+// SubscribeWebsocket subscribes to the notifications of the devices
+// connected over WebSocket by the default Client. See
+// Client.SubscribeWebsocket.
+func SubscribeWebsocket(subscriber string, handle func(topic string, payload []byte, subscriber string) error) error {
+	return defaultClient.SubscribeWebsocket(subscriber, handle)
+}
+
+// WatchWebsocket keeps a WebSocket connection of the default Client to
+// device open until ctx is done. See Client.WatchWebsocket.
+func WatchWebsocket(ctx context.Context, device types.Device) error {
+	return defaultClient.WatchWebsocket(ctx, device)
 }
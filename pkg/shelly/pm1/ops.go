@@ -0,0 +1,83 @@
+package pm1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+var log logr.Logger
+
+type empty struct{}
+
+type Verb string
+
+func (v Verb) String() string {
+	return string(v) // Convert Verb to string
+}
+
+const (
+	getConfig     Verb = "PM1.GetConfig"
+	setConfig     Verb = "PM1.SetConfig"
+	getStatus     Verb = "PM1.GetStatus"
+	resetCounters Verb = "PM1.ResetCounters"
+)
+
+func Init(l logr.Logger, r types.MethodsRegistrar) {
+	log = l
+	log.Info("Init", "package", reflect.TypeOf(empty{}).PkgPath())
+
+	r.RegisterMethodHandler(getConfig.String(), types.MethodHandler{
+		Allocate:   func() any { return new(Config) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(setConfig.String(), types.MethodHandler{
+		Allocate:   func() any { return new(ConfigurationResponse) },
+		HttpMethod: http.MethodPost,
+	})
+	r.RegisterMethodHandler(getStatus.String(), types.MethodHandler{
+		Allocate:   func() any { return new(Status) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(resetCounters.String(), types.MethodHandler{
+		Allocate:   func() any { return new(ResetCountersResponse) },
+		HttpMethod: http.MethodPost,
+	})
+}
+
+func doCall[reqT any, resT any](ctx context.Context, device types.Device, via types.Channel, verb Verb, req *reqT) (*resT, error) {
+	out, err := device.CallE(ctx, via, verb.String(), req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s on device %s: %w", verb, device.Id(), err)
+	}
+
+	result, ok := out.(*resT)
+	if !ok {
+		var expected resT
+		return nil, fmt.Errorf("unexpected response type %T (should be *%T)", out, expected)
+	}
+	return result, nil
+}
+
+func GetConfig(ctx context.Context, device types.Device, via types.Channel, id int) (*Config, error) {
+	return doCall[IdRequest, Config](ctx, device, via, getConfig, &IdRequest{Id: id})
+}
+
+func SetConfig(ctx context.Context, device types.Device, via types.Channel, id int, config *Config) (*ConfigurationResponse, error) {
+	return doCall[ConfigurationRequest, ConfigurationResponse](ctx, device, via, setConfig, &ConfigurationRequest{Id: id, Configuration: *config})
+}
+
+func GetStatus(ctx context.Context, device types.Device, via types.Channel, id int) (*Status, error) {
+	return doCall[IdRequest, Status](ctx, device, via, getStatus, &IdRequest{Id: id})
+}
+
+// ResetCounters resets the energy counters named in counters
+// (CounterAenergy, CounterRetAenergy), or all of them if none is named.
+func ResetCounters(ctx context.Context, device types.Device, via types.Channel, id int, counters ...string) (*ResetCountersResponse, error) {
+	return doCall[ResetCountersRequest, ResetCountersResponse](ctx, device, via, resetCounters, &ResetCountersRequest{Id: id, Type: counters})
+}
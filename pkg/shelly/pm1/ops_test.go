@@ -0,0 +1,45 @@
+package pm1
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+)
+
+func TestGetStatus(t *testing.T) {
+	d := types.NewFakeDevice()
+	want := &Status{Id: 0, Voltage: 231.2, Apower: 12.5, Aenergy: &Energy{Total: 1042}}
+	d.SetResult(getStatus.String(), want)
+
+	got, err := GetStatus(context.Background(), d, types.ChannelDefault, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestResetCounters(t *testing.T) {
+	d := types.NewFakeDevice()
+	d.SetResult(resetCounters.String(), &ResetCountersResponse{})
+
+	if _, err := ResetCounters(context.Background(), d, types.ChannelDefault, 0, CounterAenergy); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req, ok := d.Calls[0].Params.(*ResetCountersRequest)
+	if !ok || !reflect.DeepEqual(req.Type, []string{CounterAenergy}) {
+		t.Errorf("unexpected PM1.ResetCounters params %#v", d.Calls[0].Params)
+	}
+}
+
+func TestGetStatus_WrongType(t *testing.T) {
+	d := types.NewFakeDevice()
+	d.SetResult(getStatus.String(), &Config{})
+
+	if _, err := GetStatus(context.Background(), d, types.ChannelDefault, 0); err == nil {
+		t.Fatal("expected an error for an unexpected response type")
+	}
+}
@@ -0,0 +1,60 @@
+package pm1
+
+// https://shelly-api-docs.shelly.cloud/gen2/ComponentsAndServices/PM1
+
+type Config struct {
+	Id   int     `json:"id"`             // Id of the PM1 component instance
+	Name *string `json:"name,omitempty"` // Name of the PM1 instance
+}
+
+type ConfigurationRequest struct {
+	Id            int    `json:"id"`     // Id of the PM1 component instance
+	Configuration Config `json:"config"` // Configuration that the method takes
+}
+
+type ConfigurationResponse struct {
+	RestartRequired bool `json:"restart_required"` // True if the device needs to be restarted for the changes to take effect
+}
+
+type Energy struct {
+	Total    float32   `json:"total"`     // Total energy in Watt-hours
+	ByMinute []float32 `json:"by_minute"` // Energy by minute (in Milliwatt-hours) for the last three minutes
+	MinuteTs int       `json:"minute_ts"` // Unix timestamp of the first second of the last minute (in UTC)
+}
+
+type Status struct {
+	Id          int      `json:"id"`                    // Id of the PM1 component instance
+	Voltage     float32  `json:"voltage"`               // Last measured voltage in Volts
+	Current     float32  `json:"current"`               // Last measured current in Amperes
+	Apower      float32  `json:"apower"`                // Last measured instantaneous active power in Watts
+	AprtPower   float32  `json:"aprtpower,omitempty"`   // Last measured instantaneous apparent power in Volt-Amperes (shown if applicable)
+	PowerFactor float32  `json:"pf,omitempty"`          // Last measured power factor (shown if applicable)
+	Freq        float32  `json:"freq,omitempty"`        // Last measured network frequency in Hz (shown if applicable)
+	Aenergy     *Energy  `json:"aenergy,omitempty"`     // Active energy consumed
+	RetAenergy  *Energy  `json:"ret_aenergy,omitempty"` // Active energy returned to the grid (shown if applicable)
+	Errors      []string `json:"errors,omitempty"`      // Error conditions occurred (shown if at least one error is present)
+}
+
+type IdRequest struct {
+	Id int `json:"id"` // Id of the PM1 component instance
+}
+
+// Counters that ResetCountersRequest.Type can reset
+const (
+	CounterAenergy    = "aenergy"
+	CounterRetAenergy = "ret_aenergy"
+)
+
+type ResetCountersRequest struct {
+	Id   int      `json:"id"`             // Id of the PM1 component instance
+	Type []string `json:"type,omitempty"` // Counters to reset; all if empty
+}
+
+type ResetCountersResponse struct {
+	Aenergy *struct {
+		Total float32 `json:"total"` // Active energy consumed (in Watt-hours) before the reset
+	} `json:"aenergy,omitempty"`
+	RetAenergy *struct {
+		Total float32 `json:"total"` // Active energy returned (in Watt-hours) before the reset
+	} `json:"ret_aenergy,omitempty"`
+}
@@ -20,31 +20,14 @@ type deviceLimiter struct {
 	lastCall time.Time
 }
 
-var (
-	globalLimiter *RateLimiter
-	once          sync.Once
-)
-
-// Init initializes the global rate limiter with the given minimum interval.
+// New returns a rate limiter with the given minimum interval.
 // If interval is 0, rate limiting is disabled.
-func Init(interval time.Duration) {
-	once.Do(func() {
-		globalLimiter = &RateLimiter{
-			minInterval: interval,
-		}
-	})
-	// Allow updating the interval even after initialization
-	if globalLimiter != nil {
-		globalLimiter.minInterval = interval
+func New(interval time.Duration) *RateLimiter {
+	return &RateLimiter{
+		minInterval: interval,
 	}
 }
 
-// GetLimiter returns the global rate limiter.
-// Returns nil if not initialized.
-func GetLimiter() *RateLimiter {
-	return globalLimiter
-}
-
 // Wait blocks until it's safe to send a command to the specified device.
 // It respects the minimum interval between commands and queues requests
 // if they arrive too quickly. The interval is measured from when the previous
@@ -8,11 +8,9 @@ import (
 	"github.com/go-logr/logr"
 )
 
-var registrar Registrar
-
-// return singleton registrar
+// GetRegistrar returns the registrar of the default Client.
 func GetRegistrar() *Registrar {
-	return &registrar
+	return defaultClient.Registrar()
 }
 
 type Registrar struct {
@@ -25,7 +23,7 @@ type Registrar struct {
 func (r *Registrar) Init(log logr.Logger) {
 	r.log = log
 	r.channel = types.ChannelHttp
-	r.channels = make([]types.DeviceCaller, 3 /*sizeof(Channel)*/)
+	r.channels = make([]types.DeviceCaller, len(types.Channels))
 	r.methods = make(map[string]types.MethodHandler)
 
 	r.RegisterDeviceCaller(types.ChannelDefault, discardDeviceCaller)
@@ -0,0 +1,336 @@
+package script
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Location of the emulated device, as returned by Shelly.DetectLocation and
+// the sys configuration. Also used to compute @sunrise/@sunset schedules.
+const (
+	emulatedLat = 52.5200
+	emulatedLon = 13.4050
+)
+
+// VirtualClock is the time source of a script run in virtual-clock mode (see
+// DeviceState.Clock). Instead of waiting, the event loop advances it
+// instantly to the next due Timer.set callback or Schedule job, until it
+// reaches its end: a whole day of timers & schedules then runs in
+// milliseconds, and every run from the same state gives the same result.
+//
+// Date, Shelly.getComponentStatus("sys").unixtime/uptime and
+// Shelly.emitEvent timestamps all follow the virtual clock, and Math.random
+// is seeded from the start time. Schedule timespecs are evaluated in the
+// location of the start time.
+type VirtualClock struct {
+	mu    sync.RWMutex
+	start time.Time
+	now   time.Time
+	until time.Time
+	hooks []clockHook // by due time, then in the order they were added
+}
+
+// clockHook is a function the event loop runs when the clock reaches at (see
+// VirtualClock.at), e.g. a scenario step.
+type clockHook struct {
+	at time.Time
+	fn func()
+}
+
+// NewVirtualClock returns a clock starting at start, that stops the script
+// once nothing else is due before until.
+func NewVirtualClock(start, until time.Time) (*VirtualClock, error) {
+	if !until.After(start) {
+		return nil, fmt.Errorf("simulation end %s is not after its start %s", until, start)
+	}
+	return &VirtualClock{start: start, now: start, until: until}, nil
+}
+
+// Now returns the current virtual time.
+func (c *VirtualClock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.now
+}
+
+// Uptime returns the virtual time elapsed since the start.
+func (c *VirtualClock) Uptime() time.Duration {
+	return c.Now().Sub(c.start)
+}
+
+// Until returns the end of the simulation.
+func (c *VirtualClock) Until() time.Time {
+	return c.until
+}
+
+func (c *VirtualClock) set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.After(c.now) {
+		c.now = t
+	}
+}
+
+// at adds a function the event loop runs once the clock reaches t, after the
+// timers & schedule jobs due at t. Functions due at the same time run one at
+// a time, each after the script has processed what the previous one caused.
+func (c *VirtualClock) at(t time.Time, fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := len(c.hooks)
+	for i > 0 && c.hooks[i-1].at.After(t) {
+		i--
+	}
+	c.hooks = append(c.hooks[:i], append([]clockHook{{at: t, fn: fn}}, c.hooks[i:]...)...)
+}
+
+// nextHook returns the due time of the next function added by at, if any.
+func (c *VirtualClock) nextHook() (time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.hooks) == 0 {
+		return time.Time{}, false
+	}
+	return c.hooks[0].at, true
+}
+
+// takeHook removes and returns the next function added by at, if it is due
+// at t.
+func (c *VirtualClock) takeHook(t time.Time) (func(), bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.hooks) == 0 || c.hooks[0].at.After(t) {
+		return nil, false
+	}
+	h := c.hooks[0]
+	c.hooks = c.hooks[1:]
+	return h.fn, true
+}
+
+// nowFunc returns the wall clock, or the virtual clock if any.
+func nowFunc(c *VirtualClock) func() time.Time {
+	if c == nil {
+		return time.Now
+	}
+	return c.Now
+}
+
+// nextDue returns the first instant strictly after after that matches
+// timespec, a mongoose cron expression as used by the Schedule service:
+//
+//	"<sec> <min> <hour> <dom> <month> <dow>"       e.g. "0 15 23 * * SUN,MON"
+//	"@sunrise[+|-<offset>] <dom> <month> <dow>"    e.g. "@sunrise+3h * * *"
+//	"@sunset[+|-<offset>] <dom> <month> <dow>"
+//
+// Fields accept *, numbers, names (for months & weekdays), lists, ranges and
+// steps (e.g. */15). It is evaluated in the location of after.
+func nextDue(timespec string, after time.Time) (time.Time, error) {
+	fields := strings.Fields(timespec)
+	if len(fields) == 0 {
+		return time.Time{}, fmt.Errorf("empty timespec")
+	}
+
+	var sun func(day time.Time) (time.Time, bool)
+	var secs, mins, hours []int
+	if strings.HasPrefix(fields[0], "@") {
+		if len(fields) != 4 {
+			return time.Time{}, fmt.Errorf("timespec %q: expected 4 fields", timespec)
+		}
+		var err error
+		sun, err = parseSunEvent(fields[0])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("timespec %q: %w", timespec, err)
+		}
+		fields = append([]string{"", "", ""}, fields[1:]...)
+	} else {
+		if len(fields) != 6 {
+			return time.Time{}, fmt.Errorf("timespec %q: expected 6 fields", timespec)
+		}
+		var err error
+		if secs, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+			return time.Time{}, fmt.Errorf("timespec %q: seconds: %w", timespec, err)
+		}
+		if mins, err = parseCronField(fields[1], 0, 59, nil); err != nil {
+			return time.Time{}, fmt.Errorf("timespec %q: minutes: %w", timespec, err)
+		}
+		if hours, err = parseCronField(fields[2], 0, 23, nil); err != nil {
+			return time.Time{}, fmt.Errorf("timespec %q: hours: %w", timespec, err)
+		}
+	}
+	doms, err := parseCronField(fields[3], 1, 31, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("timespec %q: day of month: %w", timespec, err)
+	}
+	months, err := parseCronField(fields[4], 1, 12, monthNames)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("timespec %q: month: %w", timespec, err)
+	}
+	dows, err := parseCronField(fields[5], 0, 7, dayNames)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("timespec %q: day of week: %w", timespec, err)
+	}
+	if contains(dows, 7) {
+		dows = append(dows, 0) // Sunday is both 0 and 7
+	}
+
+	loc := after.Location()
+	day := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, loc)
+	// Four years cover every day of month & weekday combination
+	for i := 0; i < 4*366; i, day = i+1, day.AddDate(0, 0, 1) {
+		if !contains(doms, day.Day()) || !contains(months, int(day.Month())) || !contains(dows, int(day.Weekday())) {
+			continue
+		}
+		if sun != nil {
+			if t, ok := sun(day); ok && t.After(after) {
+				return t, nil
+			}
+			continue
+		}
+		for _, h := range hours {
+			for _, m := range mins {
+				for _, s := range secs {
+					t := time.Date(day.Year(), day.Month(), day.Day(), h, m, s, 0, loc)
+					if t.After(after) {
+						return t, nil
+					}
+				}
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("timespec %q: never due", timespec)
+}
+
+var monthNames = []string{"", "JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+
+var dayNames = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+// parseCronField returns the sorted values in [first, last] matched by field.
+func parseCronField(field string, first, last int, names []string) ([]int, error) {
+	value := func(s string) (int, error) {
+		for i, n := range names {
+			if n != "" && strings.EqualFold(s, n) {
+				return i, nil
+			}
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value %q", s)
+		}
+		if v < first || v > last {
+			return 0, fmt.Errorf("value %d out of range [%d, %d]", v, first, last)
+		}
+		return v, nil
+	}
+
+	match := make([]bool, last+1)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+		lo, hi := first, last
+		if part != "*" {
+			var err error
+			if i := strings.Index(part, "-"); i >= 0 {
+				if lo, err = value(part[:i]); err != nil {
+					return nil, err
+				}
+				if hi, err = value(part[i+1:]); err != nil {
+					return nil, err
+				}
+			} else {
+				if lo, err = value(part); err != nil {
+					return nil, err
+				}
+				if step == 1 {
+					hi = lo // e.g. 5, but 5/15 means 5, 20, 35...
+				}
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			match[v] = true
+		}
+	}
+
+	var values []int
+	for v := first; v <= last; v++ {
+		if match[v] {
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+func contains(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSunEvent parses @sunrise or @sunset, with an optional offset (e.g.
+// @sunset-30m, @sunrise+1h30m).
+func parseSunEvent(s string) (func(day time.Time) (time.Time, bool), error) {
+	var rise bool
+	var rest string
+	switch {
+	case strings.HasPrefix(s, "@sunrise"):
+		rise, rest = true, strings.TrimPrefix(s, "@sunrise")
+	case strings.HasPrefix(s, "@sunset"):
+		rise, rest = false, strings.TrimPrefix(s, "@sunset")
+	default:
+		return nil, fmt.Errorf("unknown event %q", s)
+	}
+	var offset time.Duration
+	if rest != "" {
+		var err error
+		if offset, err = time.ParseDuration(rest); err != nil {
+			return nil, fmt.Errorf("invalid offset in %q: %w", s, err)
+		}
+	}
+	return func(day time.Time) (time.Time, bool) {
+		sunrise, sunset, ok := sunTimes(day, emulatedLat, emulatedLon)
+		if !ok {
+			return time.Time{}, false
+		}
+		if rise {
+			return sunrise.Add(offset), true
+		}
+		return sunset.Add(offset), true
+	}, nil
+}
+
+// sunTimes returns the sunrise & sunset of the given day, at the given
+// latitude & longitude, in the location of day. ok is false during polar
+// day or night. See <https://en.wikipedia.org/wiki/Sunrise_equation>.
+func sunTimes(day time.Time, lat, lon float64) (sunrise, sunset time.Time, ok bool) {
+	rad := math.Pi / 180
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	n := math.Ceil(float64(midnight.Unix())/86400 + 2440587.5 - 2451545.0 + 0.0008)
+	jstar := n - lon/360
+	m := math.Mod(357.5291+0.98560028*jstar, 360)
+	c := 1.9148*math.Sin(m*rad) + 0.02*math.Sin(2*m*rad) + 0.0003*math.Sin(3*m*rad)
+	lambda := math.Mod(m+c+180+102.9372, 360)
+	transit := 2451545.0 + jstar + 0.0053*math.Sin(m*rad) - 0.0069*math.Sin(2*lambda*rad)
+	sinDecl := math.Sin(lambda*rad) * math.Sin(23.4397*rad)
+	cosDecl := math.Cos(math.Asin(sinDecl))
+	cosHour := (math.Sin(-0.833*rad) - math.Sin(lat*rad)*sinDecl) / (math.Cos(lat*rad) * cosDecl)
+	if cosHour < -1 || cosHour > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+	hour := math.Acos(cosHour) / rad
+	julian := func(j float64) time.Time {
+		return time.Unix(0, int64((j-2440587.5)*86400*1e9)).In(day.Location()).Truncate(time.Second)
+	}
+	return julian(transit - hour/360), julian(transit + hour/360), true
+}
@@ -0,0 +1,141 @@
+package script
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/mqtt"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/testr"
+)
+
+func TestNextDue(t *testing.T) {
+	// Monday
+	after := time.Date(2026, 6, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		timespec string
+		want     time.Time
+	}{
+		{"0 15 23 * * SUN,MON,TUE,WED,THU,FRI,SAT", time.Date(2026, 6, 15, 23, 15, 0, 0, time.UTC)},
+		{"0 */15 * * * *", time.Date(2026, 6, 15, 10, 15, 0, 0, time.UTC)},
+		{"0 0 10 * * *", time.Date(2026, 6, 16, 10, 0, 0, 0, time.UTC)},
+		{"30 0 8 * * SAT", time.Date(2026, 6, 20, 8, 0, 30, 0, time.UTC)},
+		{"0 0 12 * * 7", time.Date(2026, 6, 21, 12, 0, 0, 0, time.UTC)},
+		{"0 0 0 1 JAN *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 5/20 9-11 * * MON-FRI", time.Date(2026, 6, 15, 10, 5, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := nextDue(tt.timespec, after)
+		if err != nil {
+			t.Errorf("nextDue(%q): %v", tt.timespec, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("nextDue(%q) = %v, want %v", tt.timespec, got, tt.want)
+		}
+	}
+
+	for _, timespec := range []string{"", "0 0 25 * * *", "0 0 0 31 FEB *", "@noon * * *", "@sunrise * *"} {
+		if _, err := nextDue(timespec, after); err == nil {
+			t.Errorf("nextDue(%q): expected an error", timespec)
+		}
+	}
+}
+
+func TestNextDueSun(t *testing.T) {
+	cest := time.FixedZone("CEST", 2*60*60)
+	after := time.Date(2026, 6, 21, 0, 0, 0, 0, cest)
+
+	// Berlin, summer solstice: sunrise ~04:43, sunset ~21:33
+	for _, tt := range []struct {
+		timespec string
+		want     time.Time
+	}{
+		{"@sunrise * * *", time.Date(2026, 6, 21, 4, 43, 0, 0, cest)},
+		{"@sunrise+3h * * *", time.Date(2026, 6, 21, 7, 43, 0, 0, cest)},
+		{"@sunset-30m * * *", time.Date(2026, 6, 21, 21, 3, 0, 0, cest)},
+	} {
+		got, err := nextDue(tt.timespec, after)
+		if err != nil {
+			t.Fatalf("nextDue(%q): %v", tt.timespec, err)
+		}
+		if d := got.Sub(tt.want); d < -5*time.Minute || d > 5*time.Minute {
+			t.Errorf("nextDue(%q) = %v, want %v ± 5m", tt.timespec, got, tt.want)
+		}
+	}
+}
+
+// TestVirtualClockRun validates that a day and a half of timers & schedules
+// runs instantly, and that the script sees the virtual time.
+func TestVirtualClockRun(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), testr.NewWithOptions(t, testr.Options{Verbosity: -1}))
+
+	ctx = mqtt.NewContext(ctx, mqtt.NewMockClient())
+
+	start := time.Date(2026, 6, 15, 0, 0, 0, 0, time.UTC)
+	until := start.Add(36 * time.Hour)
+	clock, err := NewVirtualClock(start, until)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deviceState := &DeviceState{
+		KVS:     make(map[string]interface{}),
+		Storage: make(map[string]interface{}),
+		Schedules: []map[string]interface{}{{
+			"id": 1, "enable": true,
+			"timespec": "0 0 12 * * *",
+			"calls": []interface{}{map[string]interface{}{
+				"method": "script.eval",
+				"params": map[string]interface{}{"id": 1, "code": "noon()"},
+			}},
+		}},
+		Clock: clock,
+	}
+
+	buf := []byte(`
+		var ticks = 0;
+		var noons = 0;
+		Timer.set(60 * 1000, true, function() { ticks++; });
+		Timer.set(1000, false, function() { Shelly.emitEvent("started", {}); });
+		Shelly.addEventHandler(function(ev) {
+			if (ev.info.event === "started") {
+				Script.storage.setItem("started", Shelly.getComponentStatus("sys").unixtime);
+			}
+		});
+		function noon() {
+			noons++;
+			Script.storage.setItem("noon", new Date().toISOString());
+			Script.storage.setItem("ticks", ticks);
+			Script.storage.setItem("noons", noons);
+		}
+	`)
+
+	begin := time.Now()
+	if err := RunWithDeviceState(ctx, "virtual.js", buf, false, deviceState); err != nil {
+		t.Fatalf("RunWithDeviceState: %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 30*time.Second {
+		t.Errorf("simulation took %v", elapsed)
+	}
+
+	if !clock.Now().Equal(until) {
+		t.Errorf("clock stopped at %v, want %v", clock.Now(), until)
+	}
+	if v, _ := deviceState.StorageValue("started"); v != "1781481601" {
+		t.Errorf("started = %v, want 1781481601", v)
+	}
+	if v, _ := deviceState.StorageValue("noon"); v != "2026-06-16T12:00:00.000Z" {
+		t.Errorf("last noon = %v, want 2026-06-16T12:00:00.000Z", v)
+	}
+	if v, _ := deviceState.StorageValue("noons"); v != "2" {
+		t.Errorf("noons = %v, want 2", v)
+	}
+	// The timer due at 12:00 fires before the schedule
+	if v, _ := deviceState.StorageValue("ticks"); v != "2160" {
+		t.Errorf("ticks at noon = %v, want 2160", v)
+	}
+}
@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"reflect"
+	"strings"
 	"sync"
 
+	shellyrpc "github.com/asnowfix/home-automation/pkg/shelly/shelly"
+
 	"github.com/go-logr/logr"
 )
 
@@ -33,14 +37,33 @@ type DeviceState struct {
 	// ScheduleEvalInjector, when non-nil, lets a test fire a Schedule job's
 	// code the way a real device does: Schedule.eval on the schedule's due
 	// instant calls Script.Eval(id, code) against the already-running
-	// script's global scope. The emulator does not itself track wall-clock
-	// time against Schedules' timespecs (see Schedule.List/.Create/.Update in
-	// run.go — pure storage, never fired automatically), so a test that needs
+	// script's global scope. Unless Clock is set, the emulator does not itself
+	// track time against Schedules' timespecs (see Schedule.List/.Create/.Update
+	// in run.go — pure storage, never fired automatically), so a test that needs
 	// a specific job's handler (e.g. "handleEveningStop()") to run sends a
 	// JSON object {"code": "handleEveningStop()"} on this channel instead of
 	// waiting on real time.
 	ScheduleEvalInjector chan []byte `json:"-"`
 
+	// HTTPFixtures, when non-nil, answer the script's HTTP.GET requests
+	// instead of the network: the first fixture whose URL prefixes the
+	// request's answers it, and a request no fixture matches fails.
+	HTTPFixtures []HTTPFixture `json:"-"`
+
+	// DeviceInfo is what Shelly.getDeviceInfo() returns, a Plus1 if nil. Its
+	// model selects the resource limits of the device (see LimitsFor).
+	DeviceInfo *shellyrpc.DeviceInfo `json:"device_info,omitempty"`
+
+	// Limits are the resource limits of the device, LimitsFor(DeviceInfo) if
+	// nil.
+	Limits *Limits `json:"limits,omitempty"`
+
+	// Clock, when non-nil, runs the script in virtual-clock mode: timers,
+	// schedules and Date advance instantly to the next due event instead of
+	// following the wall clock, and the run ends when the clock reaches its
+	// end. See VirtualClock.
+	Clock *VirtualClock `json:"-"`
+
 	// OnModified is called whenever the device state is modified (KVS.Set, config changes, etc.)
 	// This allows automatic persistence of state changes during script execution
 	OnModified func() `json:"-"`
@@ -91,6 +114,17 @@ type DeviceState struct {
 	// EmittedEvents()/EmittedEventCount().
 	emittedEvents []EmittedEvent
 
+	// calls records every Shelly.call(method, params) the script makes, in
+	// order, including to the methods the emulator ignores (e.g.
+	// Sys.Reboot), for tests to tell the script made them. See Calls() and
+	// CallCount().
+	calls []RPCCall
+
+	// statusListener, set by the runtime of the running script, is told of
+	// every component status change (see NotifyStatus), to deliver it to the
+	// script's Shelly.addStatusHandler callbacks.
+	statusListener func(component string, delta map[string]interface{})
+
 	// mu guards every map and slice above. The emulator mutates them from the
 	// goroutine running the script while tests poll them from the test
 	// goroutine, which without this is a data race — and an unsynchronised map
@@ -104,6 +138,17 @@ type DeviceState struct {
 	mu sync.RWMutex
 }
 
+// HTTPFixture is the canned response to the HTTP.GET requests of a script
+// whose URL starts with URL (see DeviceState.HTTPFixtures).
+type HTTPFixture struct {
+	URL      string            `json:"url"`
+	Status   int               `json:"status,omitempty"`    // Default: 200
+	Headers  map[string]string `json:"headers,omitempty"`   // Response headers
+	Body     string            `json:"body,omitempty"`      // Response body
+	BodyFile string            `json:"body_file,omitempty"` // File of the response body, see LoadScenario
+	Error    string            `json:"error,omitempty"`     // Fail the request with this message instead
+}
+
 // KVSValue returns one KVS entry under the read lock.
 func (d *DeviceState) KVSValue(key string) (interface{}, bool) {
 	d.mu.RLock()
@@ -207,29 +252,138 @@ func (d *DeviceState) ComponentStatusValue(name string) (interface{}, bool) {
 // under the write lock, and reports whether the component existed and was a
 // map. This is the safe form of the read-then-mutate pattern: doing it via
 // ComponentStatusValue would only mutate the copy.
+//
+// A change of value is notified to the script's status handlers.
 func (d *DeviceState) SetComponentStatusField(name, field string, value interface{}) bool {
 	d.mu.Lock()
-	defer d.mu.Unlock()
 	existing, ok := d.ComponentStatus[name]
 	if !ok {
+		d.mu.Unlock()
 		return false
 	}
 	m, isMap := existing.(map[string]interface{})
 	if !isMap {
+		d.mu.Unlock()
 		return false
 	}
+	old, had := m[field]
 	m[field] = value
+	listener := d.statusListener
+	d.mu.Unlock()
+
+	if listener != nil && (!had || !reflect.DeepEqual(old, value)) {
+		listener(name, map[string]interface{}{field: value})
+	}
 	return true
 }
 
 // SetComponentStatusValue writes one component's status under the write lock.
+// The fields that changed are notified to the script's status handlers.
 func (d *DeviceState) SetComponentStatusValue(name string, value interface{}) {
 	d.mu.Lock()
-	defer d.mu.Unlock()
 	if d.ComponentStatus == nil {
 		d.ComponentStatus = make(map[string]interface{})
 	}
+	old, _ := d.ComponentStatus[name].(map[string]interface{})
 	d.ComponentStatus[name] = value
+	listener := d.statusListener
+	d.mu.Unlock()
+
+	if m, ok := value.(map[string]interface{}); ok && listener != nil {
+		if delta := statusDelta(old, m); len(delta) > 0 {
+			listener(name, delta)
+		}
+	}
+}
+
+// NotifyStatus applies the params of a NotifyStatus notification, e.g.
+//
+//	{"ts": 1736603810.49, "switch:0": {"id": 0, "output": false, "source": "HTTP_in"}}
+//
+// merging each component's fields into its status (creating it if needed),
+// then notifies the fields that changed to the script's status handlers,
+// exactly as a device does with its own NotifyStatus deltas.
+func (d *DeviceState) NotifyStatus(params map[string]interface{}) {
+	type change struct {
+		component string
+		delta     map[string]interface{}
+	}
+	var changes []change
+
+	d.mu.Lock()
+	if d.ComponentStatus == nil {
+		d.ComponentStatus = make(map[string]interface{})
+	}
+	for component, v := range params {
+		fields, ok := v.(map[string]interface{})
+		if !ok {
+			continue // e.g. "ts"
+		}
+		status, ok := d.ComponentStatus[component].(map[string]interface{})
+		if !ok {
+			status = make(map[string]interface{})
+			d.ComponentStatus[component] = status
+		}
+		delta := statusDelta(status, fields)
+		for k, v := range fields {
+			status[k] = v
+		}
+		if len(delta) > 0 {
+			changes = append(changes, change{component, delta})
+		}
+	}
+	listener := d.statusListener
+	d.mu.Unlock()
+
+	if listener != nil {
+		for _, c := range changes {
+			listener(c.component, c.delta)
+		}
+	}
+}
+
+// SetMqttConnected emulates the device's MQTT connection going up or down:
+// the "mqtt" component status changes, which the script sees through its
+// status handlers and its MQTT connect/disconnect handlers.
+func (d *DeviceState) SetMqttConnected(connected bool) {
+	d.NotifyStatus(map[string]interface{}{
+		"mqtt": map[string]interface{}{"connected": connected},
+	})
+}
+
+// MqttConnected reports whether the emulated MQTT connection is up: true
+// unless the "mqtt" component status says otherwise.
+func (d *DeviceState) MqttConnected() bool {
+	v, ok := d.ComponentStatusValue("mqtt")
+	if !ok {
+		return true
+	}
+	m, _ := v.(map[string]interface{})
+	connected, ok := m["connected"].(bool)
+	return !ok || connected
+}
+
+// setStatusListener sets the function told of every component status
+// change.
+func (d *DeviceState) setStatusListener(listener func(component string, delta map[string]interface{})) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statusListener = listener
+}
+
+// statusDelta returns the fields of updated that differ from old, plus "id"
+// if the component has one, as in a NotifyStatus delta.
+func statusDelta(old, updated map[string]interface{}) map[string]interface{} {
+	delta := make(map[string]interface{})
+	for k, v := range updated {
+		if ov, ok := old[k]; !ok || !reflect.DeepEqual(ov, v) {
+			delta[k] = v
+		}
+	}
+	if id, ok := updated["id"]; ok && len(delta) > 0 {
+		delta["id"] = id
+	}
+	return delta
 }
 
 // DeleteComponentStatusValue removes one component's status under the write lock.
@@ -398,6 +552,44 @@ func (d *DeviceState) EmittedEventCount(name string) int {
 	return n
 }
 
+// RPCCall is one recorded Shelly.call(method, params) call.
+type RPCCall struct {
+	Method string
+	Params interface{}
+}
+
+// RecordCall appends one Shelly.call(method, params) call. Called from
+// run.go's Shelly.call implementation; not for test use.
+func (d *DeviceState) RecordCall(method string, params interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls = append(d.calls, RPCCall{Method: method, Params: params})
+}
+
+// Calls returns a copy of every Shelly.call recorded so far, in order.
+func (d *DeviceState) Calls() []RPCCall {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	out := make([]RPCCall, len(d.calls))
+	copy(out, d.calls)
+	return out
+}
+
+// CallCount returns how many times the script called Shelly.call(method,
+// ...), for any params. Method names are case-insensitive, as on the
+// device.
+func (d *DeviceState) CallCount(method string) int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	n := 0
+	for _, c := range d.calls {
+		if strings.EqualFold(c.Method, method) {
+			n++
+		}
+	}
+	return n
+}
+
 // GetStorage returns a snapshot of the Script.storage map.
 func (d *DeviceState) GetStorage() map[string]interface{} {
 	d.mu.RLock()
@@ -493,8 +685,9 @@ func SaveDeviceState(log logr.Logger, filename string, state *DeviceState) error
 	return nil
 }
 
-// RunWithDeviceFile runs a Shelly script with device state persistence
-func RunWithDeviceFile(ctx context.Context, name string, buf []byte, minify bool, deviceFile string) error {
+// RunWithDeviceFile runs a Shelly script with device state persistence. If
+// clock is not nil, the script runs in virtual-clock mode (see VirtualClock).
+func RunWithDeviceFile(ctx context.Context, name string, buf []byte, minify bool, deviceFile string, clock *VirtualClock) error {
 	log, err := logr.FromContext(ctx)
 	if err != nil {
 		return err
@@ -527,6 +720,7 @@ func RunWithDeviceFile(ctx context.Context, name string, buf []byte, minify bool
 	}
 
 	// Run the script with device state
+	deviceState.Clock = clock
 	err = RunWithDeviceState(ctx, name, buf, minify, deviceState)
 
 	// Save device state after script completes, but not if it was canceled
@@ -2,6 +2,7 @@ package script
 
 import (
 	"context"
+	"errors"
 
 	"encoding/json"
 
@@ -23,6 +24,10 @@ type eventsHandler struct {
 	vm         *goja.Runtime
 	signalChan chan []byte
 	id         int
+	// synchronous is set in virtual-clock mode: events are queued, already
+	// marshalled, on signalChan as soon as emitted, with no forwarding
+	// goroutine in between.
+	synchronous bool
 }
 
 func NewEventsHandler(ctx context.Context, vm *goja.Runtime) *eventsHandler {
@@ -56,6 +61,37 @@ func (eh *eventsHandler) Broadcaster() chan<- goja.Value {
 	return eh.eventChan
 }
 
+// Synchronous switches the handler to synchronous delivery. It must be
+// called before Wait().
+func (eh *eventsHandler) Synchronous() {
+	eh.synchronous = true
+	eh.signalChan = make(chan []byte, cap(eh.eventChan))
+}
+
+// Emit queues an event for the registered handlers, without blocking. It
+// returns false if the queue is full.
+func (eh *eventsHandler) Emit(event goja.Value) bool {
+	if !eh.synchronous {
+		select {
+		case eh.Broadcaster() <- event:
+			return true
+		default:
+			return false
+		}
+	}
+	data, err := json.Marshal(event.Export())
+	if err != nil {
+		eh.log.Error(err, "Failed to marshal event", "data", event.Export())
+		return true
+	}
+	select {
+	case eh.signalChan <- data:
+		return true
+	default:
+		return false
+	}
+}
+
 func (eh *eventsHandler) Wait() <-chan []byte {
 	// Create signal channel if not exists
 	if eh.signalChan == nil {
@@ -113,6 +149,11 @@ func (eh *eventsHandler) Handle(ctx context.Context, vm *goja.Runtime, msg []byt
 		_, err := handler.callback(goja.Undefined(), eventObj, handler.userdata)
 		if err != nil {
 			log.Error(err, "Event handler failed", "handler", i, "event", eventData)
+			// Uncatchable: the device would stop the script
+			var so *goja.StackOverflowError
+			if errors.As(err, &so) {
+				return err
+			}
 		}
 	}
 
@@ -15,6 +15,7 @@ import (
 // Fetched fields:
 //   - KVS: all key-value pairs stored on the device
 //   - ComponentStatus: point-in-time snapshot of all component statuses
+//   - DeviceInfo: the device identity, which selects its resource limits
 //   - Storage: always empty (Script.storage is not accessible via RPC)
 func FetchDeviceState(ctx context.Context, via types.Channel, device types.Device) (*DeviceState, error) {
 	kvsData, err := fetchAllKVS(ctx, via, device)
@@ -27,10 +28,16 @@ func FetchDeviceState(ctx context.Context, via types.Channel, device types.Devic
 		return nil, fmt.Errorf("fetching component status: %w", err)
 	}
 
+	info, err := shellyrpc.GetDeviceInfo(ctx, device, via)
+	if err != nil {
+		return nil, fmt.Errorf("fetching device info: %w", err)
+	}
+
 	return &DeviceState{
 		KVS:             kvsData,
 		Storage:         make(map[string]interface{}),
 		ComponentStatus: componentStatus,
+		DeviceInfo:      info,
 	}, nil
 }
 
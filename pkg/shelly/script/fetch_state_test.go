@@ -25,6 +25,7 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/asnowfix/home-automation/pkg/shelly/kvs"
+	shellyrpc "github.com/asnowfix/home-automation/pkg/shelly/shelly"
 	"github.com/asnowfix/home-automation/pkg/shelly/types"
 )
 
@@ -62,6 +63,7 @@ func (f *fakeDevice) StopDialog(_ context.Context, _ uint32)  {}
 func (f *fakeDevice) IsHttpReady() bool                        { return false }
 func (f *fakeDevice) IsMqttReady() bool                        { return true }
 func (f *fakeDevice) Channel(_ context.Context, via types.Channel) types.Channel { return via }
+func (f *fakeDevice) ResolveHost(_ context.Context) bool     { return false }
 func (f *fakeDevice) UpdateName(_ string)                      {}
 func (f *fakeDevice) UpdateHost(_ string)                      {}
 func (f *fakeDevice) ClearHost()                               {}
@@ -79,11 +81,22 @@ func kvsListResp(store map[string]string) *kvs.ListResponse {
 	return &kvs.ListResponse{Keys: keys}
 }
 
-// makeCallFn builds a callFn that serves KVS.List, KVS.Get, and
-// Shelly.GetStatus from the provided stores, failing on anything else.
+// fakeDeviceInfo is the Shelly.GetDeviceInfo response of fakeDevice.
+func fakeDeviceInfo() *shellyrpc.DeviceInfo {
+	return &shellyrpc.DeviceInfo{
+		Product: shellyrpc.Product{Model: "SPSW-003XE16EU", MacAddress: "34987A48C26C", Application: "Pro3", Version: "1.7.1", Generation: 2},
+		Id:      "shellypro3-34987a48c26c",
+	}
+}
+
+// makeCallFn builds a callFn that serves KVS.List, KVS.Get,
+// Shelly.GetStatus and Shelly.GetDeviceInfo from the provided stores,
+// failing on anything else.
 func makeCallFn(store map[string]string, status any) func(string, any) (any, error) {
 	return func(method string, params any) (any, error) {
 		switch method {
+		case "Shelly.GetDeviceInfo":
+			return fakeDeviceInfo(), nil
 		case "KVS.List":
 			return kvsListResp(store), nil
 		case "KVS.Get":
@@ -136,6 +149,9 @@ func TestFetchDeviceState_HappyPath(t *testing.T) {
 	if len(state.Storage) != 0 {
 		t.Errorf("Storage: got %d keys, want 0 (Script.storage is not fetchable via RPC)", len(state.Storage))
 	}
+	if state.DeviceInfo == nil || state.DeviceInfo.Application != "Pro3" {
+		t.Errorf("DeviceInfo: got %+v, want the Pro3 info", state.DeviceInfo)
+	}
 }
 
 // TestFetchDeviceState_Empty verifies that a device with no KVS entries and
@@ -5,13 +5,15 @@ go 1.25.0
 require (
 	github.com/dop251/goja v0.0.0-20251103141225-af2ceb9156d7
 	github.com/go-logr/logr v1.4.3
+	github.com/go-sourcemap/sourcemap v2.1.3+incompatible
 	github.com/tdewolff/minify/v2 v2.24.3
+	github.com/tdewolff/parse/v2 v2.8.3
+	sigs.k8s.io/yaml v1.6.0
 )
 
 require (
 	github.com/dlclark/regexp2 v1.11.4 // indirect
-	github.com/go-sourcemap/sourcemap v2.1.3+incompatible // indirect
 	github.com/google/pprof v0.0.0-20230207041349-798e818bf904 // indirect
-	github.com/tdewolff/parse/v2 v2.8.3 // indirect
+	go.yaml.in/yaml/v2 v2.4.2 // indirect
 	golang.org/x/text v0.28.0 // indirect
 )
@@ -0,0 +1,254 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	shellyrpc "github.com/asnowfix/home-automation/pkg/shelly/shelly"
+
+	"github.com/dop251/goja"
+)
+
+// Limits are the per-script resource limits of the Espruino runtime of a
+// Shelly device. goja has none of them, so the emulator enforces them itself
+// (see limiter), to catch scripts that would crash on the device before they
+// get uploaded.
+type Limits struct {
+	Timers            int `json:"timers"`             // Active Timer.set
+	EventHandlers     int `json:"event_handlers"`     // Shelly.addEventHandler
+	StatusHandlers    int `json:"status_handlers"`    // Shelly.addStatusHandler
+	CallsInProgress   int `json:"calls_in_progress"`  // Concurrent Shelly.call
+	MqttSubscriptions int `json:"mqtt_subscriptions"` // MQTT.subscribe
+	CallDepth         int `json:"call_depth"`         // Nested JavaScript function calls
+	HeapBytes         int `json:"heap_bytes"`         // Script heap, as estimated by heapSize()
+}
+
+// Limits of the device families, selected by LimitsFor. The counts are the
+// per-script limits of the Shelly scripting documentation
+// (https://shelly-api-docs.shelly.cloud/gen2/Scripts/ShellyScriptLanguageFeatures),
+// as also checked in docs/garden-sprinklers-plan.md and docs/pool-pump.md.
+// CallDepth is not documented: it is the emulator's own guess. The heap
+// budgets are the free script heap measured on our own devices.
+var (
+	// Plus devices: ~25200 bytes free on a Plus1 with no script running
+	// (see docs/429-watchdog-agent-handover.md).
+	PlusLimits = Limits{
+		Timers:            5,
+		EventHandlers:     5,
+		StatusHandlers:    5,
+		CallsInProgress:   5,
+		MqttSubscriptions: 10,
+		CallDepth:         32,
+		HeapBytes:         25000,
+	}
+
+	// Pro devices: garden.js ran out of memory at a ~28 KB peak on the ~30 KB
+	// heap of a Pro3 (see docs/garden-sprinklers-plan.md, phase 6).
+	ProLimits = Limits{
+		Timers:            5,
+		EventHandlers:     5,
+		StatusHandlers:    5,
+		CallsInProgress:   5,
+		MqttSubscriptions: 10,
+		CallDepth:         32,
+		HeapBytes:         30000,
+	}
+
+	// Gen3 devices: their heap was not measured yet, so they get the budget
+	// of the Plus devices, the smallest known. Set the limits of the device
+	// file (see DeviceState.Limits) to use another one.
+	Gen3Limits = PlusLimits
+)
+
+// DefaultLimits are the limits of the device the emulator impersonates when
+// the device file has no device info: a Plus1.
+var DefaultLimits = PlusLimits
+
+// LimitsFor returns the limits of the device family of info, DefaultLimits if
+// info is nil.
+func LimitsFor(info *shellyrpc.DeviceInfo) Limits {
+	switch {
+	case info == nil:
+		return DefaultLimits
+	case info.Generation >= 3:
+		return Gen3Limits
+	case strings.HasPrefix(info.Application, "Pro"):
+		return ProLimits
+	default:
+		return PlusLimits
+	}
+}
+
+// Error codes reported by Script.GetStatus "errors" when the firmware stops a
+// script.
+const (
+	ScriptErrorCrashed     = "crashed"
+	ScriptErrorOutOfMemory = "out_of_memory"
+)
+
+// LimitError is the error a script run fails with when the script exceeds
+// one of its Limits: Code is what the device would report in Script.GetStatus
+// "errors", Error() the message of the exception it would throw.
+type LimitError struct {
+	Code    string
+	Message string
+}
+
+func (e *LimitError) Error() string {
+	return e.Message
+}
+
+// limiter enforces the Limits of one script run. Exceeding a limit throws
+// the same exception as the firmware, and records it: the event loop then
+// fails the run, even if the script catches the exception, so that CI flags
+// the script.
+type limiter struct {
+	limits Limits
+	err    *LimitError // first limit exceeded, if any
+
+	// Shelly.call requests not completed yet. Like the firmware, the
+	// emulator completes most of them from inside the call, so only the
+	// calls that are answered through the event loop (e.g. HTTP.GET), and
+	// calls issued before an enclosing call completes, add up.
+	calls []*rpcCall
+
+	// globals defined by the runtime rather than by the script, not counted
+	// in the heap
+	builtins map[string]bool
+}
+
+type rpcCall struct {
+	done bool
+}
+
+func newLimiter(limits Limits) *limiter {
+	return &limiter{limits: limits}
+}
+
+// exceeded returns the error of an exceeded limit, after recording it if it
+// is the first one.
+func (l *limiter) exceeded(code string, format string, args ...any) *LimitError {
+	e := &LimitError{Code: code, Message: fmt.Sprintf(format, args...)}
+	if l.err == nil {
+		l.err = e
+	}
+	return e
+}
+
+// throw exceeds a limit and throws the corresponding exception.
+func (l *limiter) throw(vm *goja.Runtime, format string, args ...any) {
+	panic(vm.NewGoError(l.exceeded(ScriptErrorCrashed, format, args...)))
+}
+
+// observe records uncatchable errors returned by goja as limits exceeded.
+func (l *limiter) observe(err error) {
+	var so *goja.StackOverflowError
+	if errors.As(err, &so) {
+		l.exceeded(ScriptErrorCrashed, "Too much recursion - the stack is about to overflow")
+	}
+}
+
+// failure returns the error the run fails with, once a limit was exceeded.
+func (l *limiter) failure() error {
+	if l.err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", l.err.Code, l.err)
+}
+
+// startCall registers a new Shelly.call, or throws if too many are in
+// progress.
+func (l *limiter) startCall(vm *goja.Runtime) *rpcCall {
+	inProgress := l.calls[:0]
+	for _, c := range l.calls {
+		if !c.done {
+			inProgress = append(inProgress, c)
+		}
+	}
+	l.calls = inProgress
+	if len(l.calls) >= l.limits.CallsInProgress {
+		l.throw(vm, "Too many calls in progress")
+	}
+	c := &rpcCall{}
+	l.calls = append(l.calls, c)
+	return c
+}
+
+// callback wraps the callback of a Shelly.call, so that the call completes
+// as soon as its callback is invoked.
+func (l *limiter) callback(vm *goja.Runtime, c *rpcCall, callable goja.Callable) goja.Value {
+	return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		c.done = true
+
+		// The response is on the heap while the callback runs
+		l.checkHeap(vm, call.Arguments...)
+		if l.err != nil {
+			panic(vm.NewGoError(l.err))
+		}
+		v, err := callable(call.This, call.Arguments...)
+		if err != nil {
+			l.observe(err)
+			panic(err)
+		}
+		return v
+	})
+}
+
+// checkHeap records an out-of-memory error if the values reachable from the
+// script's globals, plus the given values, exceed the heap budget.
+func (l *limiter) checkHeap(vm *goja.Runtime, values ...goja.Value) {
+	size := heapSize(vm, l.builtins, values...)
+	if size > l.limits.HeapBytes {
+		l.exceeded(ScriptErrorOutOfMemory, "Out of memory: ~%d bytes used, %d available", size, l.limits.HeapBytes)
+	}
+}
+
+// jsVarSize is the size of an Espruino variable (JsVar): every value,
+// object property and array element takes at least one.
+const jsVarSize = 16
+
+// heapSize estimates the heap used by the values reachable from the globals
+// of vm (except builtins), plus the given values, as Espruino would store
+// them. Function code and closure scopes are not accounted for: on the device
+// scripts run minified, and goja does not expose closures.
+func heapSize(vm *goja.Runtime, builtins map[string]bool, values ...goja.Value) int {
+	seen := make(map[*goja.Object]bool)
+	var size func(v goja.Value) int
+	size = func(v goja.Value) int {
+		if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+			return jsVarSize
+		}
+		if o, ok := v.(*goja.Object); ok {
+			if seen[o] {
+				return 0
+			}
+			seen[o] = true
+			if _, ok := goja.AssertFunction(o); ok {
+				return jsVarSize
+			}
+			n := jsVarSize
+			for _, k := range o.Keys() {
+				n += jsVarSize + len(k) + size(o.Get(k))
+			}
+			return n
+		}
+		if t := v.ExportType(); t != nil && t.Kind() == reflect.String {
+			return jsVarSize + len(v.String())
+		}
+		return jsVarSize
+	}
+
+	n := 0
+	global := vm.GlobalObject()
+	for _, k := range global.Keys() {
+		if !builtins[k] {
+			n += jsVarSize + len(k) + size(global.Get(k))
+		}
+	}
+	for _, v := range values {
+		n += size(v)
+	}
+	return n
+}
@@ -0,0 +1,216 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/mqtt"
+	shellyrpc "github.com/asnowfix/home-automation/pkg/shelly/shelly"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/testr"
+)
+
+// runLimited runs code for a virtual minute, with the given limits (or
+// DefaultLimits if nil).
+func runLimited(t *testing.T, code string, limits *Limits) error {
+	t.Helper()
+	ctx := logr.NewContext(context.Background(), testr.NewWithOptions(t, testr.Options{Verbosity: -1}))
+
+	ctx = mqtt.NewContext(ctx, mqtt.NewMockClient())
+
+	start := time.Date(2026, 6, 15, 0, 0, 0, 0, time.UTC)
+	clock, err := NewVirtualClock(start, start.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deviceState := &DeviceState{
+		KVS:     make(map[string]interface{}),
+		Storage: make(map[string]interface{}),
+		Limits:  limits,
+		Clock:   clock,
+	}
+	return RunWithDeviceState(ctx, "limits.js", []byte(code), false, deviceState)
+}
+
+func TestLimits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		code    string
+		limits  *Limits
+		errCode string // "" if the script must run fine
+		message string
+	}{{
+		name:    "timers",
+		code:    `for (var i = 0; i < 6; i++) { Timer.set(1000, true, function() {}); }`,
+		errCode: ScriptErrorCrashed,
+		message: "Too many timers",
+	}, {
+		name: "one-shot timer re-armed from its callback",
+		code: `
+			for (var i = 0; i < 4; i++) { Timer.set(1000, true, function() {}); }
+			function tick() { Timer.set(100, false, tick); }
+			tick();`,
+	}, {
+		name: "cleared timers free their slot",
+		code: `
+			for (var i = 0; i < 10; i++) { Timer.clear(Timer.set(1000, true, function() {})); }`,
+	}, {
+		name: "caught exception still fails the run",
+		code: `
+			try {
+				for (var i = 0; i < 6; i++) { Timer.set(1000, true, function() {}); }
+			} catch (e) {}`,
+		errCode: ScriptErrorCrashed,
+		message: "Too many timers",
+	}, {
+		name:    "device limits",
+		code:    `Timer.set(1000, true, function() {}); Timer.set(1000, true, function() {});`,
+		limits:  &Limits{Timers: 1, EventHandlers: 5, StatusHandlers: 5, CallsInProgress: 5, MqttSubscriptions: 10, CallDepth: 32, HeapBytes: 25000},
+		errCode: ScriptErrorCrashed,
+		message: "Too many timers",
+	}, {
+		name:    "event handlers",
+		code:    `for (var i = 0; i < 6; i++) { Shelly.addEventHandler(function() {}); }`,
+		errCode: ScriptErrorCrashed,
+		message: "Too many event handlers",
+	}, {
+		name:    "status handlers",
+		code:    `for (var i = 0; i < 6; i++) { Shelly.addStatusHandler(function() {}); }`,
+		errCode: ScriptErrorCrashed,
+		message: "Too many status handlers",
+	}, {
+		name:    "MQTT subscriptions",
+		code:    `for (var i = 0; i < 11; i++) { MQTT.subscribe("test/" + i, function() {}); }`,
+		errCode: ScriptErrorCrashed,
+		message: "Too many subscriptions",
+	}, {
+		name: "MQTT subscriptions to the same topic",
+		code: `for (var i = 0; i < 11; i++) { MQTT.subscribe("test/0", function() {}); }`,
+	}, {
+		name: "concurrent calls",
+		code: `for (var i = 0; i < 6; i++) {
+				Shelly.call("HTTP.GET", {url: "` + srv.URL + `", timeout: 5}, function() {});
+			}`,
+		errCode: ScriptErrorCrashed,
+		message: "Too many calls in progress",
+	}, {
+		name: "chained calls",
+		code: `
+			var n = 0;
+			function next() {
+				if (n++ < 10) Shelly.call("KVS.Set", {key: "k" + n, value: n}, next);
+			}
+			next();
+			for (var i = 0; i < 10; i++) { Shelly.call("KVS.Set", {key: "k", value: i}); }`,
+	}, {
+		name:    "recursion",
+		code:    `function f(n) { return f(n + 1) + 1; } f(0);`,
+		errCode: ScriptErrorCrashed,
+		message: "Too much recursion",
+	}, {
+		name: "heap",
+		code: `
+			var buf = [];
+			Timer.set(1000, true, function() {
+				for (var i = 0; i < 20; i++) { buf.push("0123456789abcdef0123456789abcdef"); }
+			});`,
+		errCode: ScriptErrorOutOfMemory,
+		message: "Out of memory",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runLimited(t, tt.code, tt.limits)
+			if tt.errCode == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var le *LimitError
+			if !errors.As(err, &le) {
+				t.Fatalf("expected a LimitError, got %v", err)
+			}
+			if le.Code != tt.errCode || !strings.HasPrefix(le.Message, tt.message) {
+				t.Errorf("got %q (%s), want %q (%s)", le.Message, le.Code, tt.message, tt.errCode)
+			}
+		})
+	}
+}
+
+func TestLimitsFor(t *testing.T) {
+	tests := []struct {
+		name string
+		info *shellyrpc.DeviceInfo
+		want Limits
+	}{
+		{"none", nil, DefaultLimits},
+		{"Plus1", &shellyrpc.DeviceInfo{Product: shellyrpc.Product{Application: "Plus1", Generation: 2}}, PlusLimits},
+		{"Pro3", &shellyrpc.DeviceInfo{Product: shellyrpc.Product{Application: "Pro3", Generation: 2}}, ProLimits},
+		{"Mini1G3", &shellyrpc.DeviceInfo{Product: shellyrpc.Product{Application: "Mini1G3", Generation: 3}}, Gen3Limits},
+	}
+	for _, tt := range tests {
+		if got := LimitsFor(tt.info); got != tt.want {
+			t.Errorf("%s: LimitsFor() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestLimits_DeviceModel checks that the heap budget follows the model of the
+// emulated device, which Shelly.getDeviceInfo() reports to the script.
+func TestLimits_DeviceModel(t *testing.T) {
+	// ~27 KB of strings: over the heap of a Plus, under the one of a Pro
+	code := `
+		var buf = [];
+		Timer.set(1000, false, function() {
+			for (var i = 0; i < 205; i++) { buf.push("0123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789"); }
+			Shelly.call("KVS.Set", {key: "app", value: Shelly.getDeviceInfo().app});
+		});`
+	for _, tt := range []struct {
+		app     string
+		errCode string
+	}{
+		{"Plus1", ScriptErrorOutOfMemory},
+		{"Pro3", ""},
+	} {
+		t.Run(tt.app, func(t *testing.T) {
+			ctx := logr.NewContext(context.Background(), testr.NewWithOptions(t, testr.Options{Verbosity: -1}))
+			ctx = mqtt.NewContext(ctx, mqtt.NewMockClient())
+			start := time.Date(2026, 6, 15, 0, 0, 0, 0, time.UTC)
+			clock, err := NewVirtualClock(start, start.Add(time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			deviceState := &DeviceState{
+				KVS:        make(map[string]interface{}),
+				Storage:    make(map[string]interface{}),
+				DeviceInfo: &shellyrpc.DeviceInfo{Product: shellyrpc.Product{Application: tt.app, Generation: 2}},
+				Clock:      clock,
+			}
+			err = RunWithDeviceState(ctx, "model.js", []byte(code), false, deviceState)
+			if tt.errCode == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if app, _ := deviceState.KVSString("app"); app != tt.app {
+					t.Errorf("Shelly.getDeviceInfo().app = %q, want %q", app, tt.app)
+				}
+				return
+			}
+			var le *LimitError
+			if !errors.As(err, &le) || le.Code != tt.errCode {
+				t.Fatalf("expected a %s limit error, got %v", tt.errCode, err)
+			}
+		})
+	}
+}
@@ -61,6 +61,18 @@ func Minify(src []byte) ([]byte, error) {
 	return minifyJS(src)
 }
 
+// prepareCode is the transformation doUpload applies to a script before
+// sending it when minification is requested: minify, then downgrade ES6
+// template literals without interpolations to plain strings.
+// MinifyWithSourceMap relies on it to map positions in the uploaded code.
+func prepareCode(src []byte) ([]byte, error) {
+	minified, err := minifyJS(src)
+	if err != nil {
+		return nil, err
+	}
+	return downgradeTemplates(minified), nil
+}
+
 // downgradeTemplates converts ES6 template literals without interpolations (${...})
 // into normal double-quoted strings with escaped newlines and quotes. This helps
 // older JS engines that don't support backtick template strings.
@@ -369,18 +381,12 @@ func doUpload(ctx context.Context, via types.Channel, device types.Device, name
 	// Minify before splitting and uploading (only if requested)
 	if minify {
 		origLen := len(buf)
-		if minified, err := minifyJS(buf); err != nil {
+		if minified, err := prepareCode(buf); err != nil {
 			log.Error(err, "Minify failed", "name", name)
 			return 0, err
 		} else {
 			buf = minified
 			log.Info("Minified script", "name", name, "from", origLen, "to", len(buf))
-			// Downgrade ES6 template literals without interpolations to plain strings
-			before := len(buf)
-			buf = downgradeTemplates(buf)
-			if len(buf) != before {
-				log.Info("Downgraded template literals in minified script", "name", name)
-			}
 		}
 	}
 
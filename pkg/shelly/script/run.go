@@ -3,13 +3,16 @@ package script
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"math/rand"
 	"net/http"
 	"os"
 	"reflect"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -27,7 +30,8 @@ func Run(ctx context.Context, name string, buf []byte, minify bool) error {
 	return RunWithDeviceState(ctx, name, buf, minify, emptyState)
 }
 
-// RunWithDeviceState runs a script with a provided device state for testing
+// RunWithDeviceState runs a script with a provided device state for testing,
+// against the MQTT client carried by ctx (see mqtt.NewContext).
 func RunWithDeviceState(ctx context.Context, name string, buf []byte, minify bool, deviceState *DeviceState) error {
 	log, err := logr.FromContext(ctx)
 	if err != nil {
@@ -41,21 +45,32 @@ func RunWithDeviceState(ctx context.Context, name string, buf []byte, minify boo
 		}
 	}
 
-	handlers := make([]handler, 0)
-
-	mc := mqtt.GetClient(ctx)
-	if mc == nil {
-		err := fmt.Errorf("MQTT client not initialized")
+	mc, ok := mqtt.FromContext(ctx)
+	if !ok {
+		err := fmt.Errorf("no MQTT client in context (see mqtt.NewContext)")
 		log.Error(err, "Failed to get MQTT client", "name", name)
 		return err
 	}
+	return runWithClient(ctx, log, mc, name, buf, deviceState)
+}
+
+// runWithClient runs a script against the given MQTT client.
+func runWithClient(ctx context.Context, log logr.Logger, mc mqtt.Client, name string, buf []byte, deviceState *DeviceState) error {
+	handlers := make([]handler, 0)
 
-	vm, err := createShellyRuntime(ctx, mc, &handlers, deviceState)
+	vm, lim, err := createShellyRuntime(ctx, mc, &handlers, deviceState)
 	if err != nil {
 		log.Error(err, "Failed to create Shelly runtime", "name", name)
 		return err
 	}
+	defer deviceState.setStatusListener(nil)
 	out, err := vm.RunScript(name, string(buf))
+	lim.observe(err)
+	lim.checkHeap(vm)
+	if err := lim.failure(); err != nil {
+		log.Error(err, "Script exceeded the device limits", "name", name)
+		return err
+	}
 	if err != nil {
 		log.Error(err, "Script evaluation failed", "name", name)
 		return err
@@ -70,7 +85,12 @@ func RunWithDeviceState(ctx context.Context, name string, buf []byte, minify boo
 
 	log.Info("Starting event loop", "handlers", len(handlers))
 
-	// Build select cases: context.Done() + all handler channels
+	// In virtual-clock mode, the select does not block: when nothing is
+	// ready, the clock moves on to the next due timer or schedule job.
+	clock := deviceState.Clock
+
+	// Build select cases: context.Done() + all handler channels (+ default,
+	// in virtual-clock mode)
 	// This function rebuilds the cases array from current handlers
 	buildCases := func() []reflect.SelectCase {
 		cases := make([]reflect.SelectCase, len(handlers)+1)
@@ -84,6 +104,9 @@ func RunWithDeviceState(ctx context.Context, name string, buf []byte, minify boo
 				Chan: reflect.ValueOf(h.Wait()),
 			}
 		}
+		if clock != nil {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+		}
 		return cases
 	}
 
@@ -100,6 +123,26 @@ func RunWithDeviceState(ctx context.Context, name string, buf []byte, minify boo
 
 		chosen, value, ok := reflect.Select(cases)
 
+		if clock != nil && chosen == len(cases)-1 {
+			// Idle: in-flight HTTP requests complete at the current virtual
+			// time, then the clock moves on.
+			if httpPending(handlers) {
+				chosen, value, ok = reflect.Select(cases[:len(cases)-1])
+			} else {
+				more := advanceClock(ctx, log, vm, lim, clock, handlers, deviceState)
+				if err := lim.failure(); err != nil {
+					log.Error(err, "Script exceeded the device limits", "name", name)
+					return err
+				}
+				if !more {
+					log.Info("Simulation complete", "until", clock.Until())
+					return nil
+				}
+				needsRebuild = true
+				continue
+			}
+		}
+
 		if chosen == 0 {
 			// Context cancelled
 			log.Info("Context cancelled, exiting event loop")
@@ -112,8 +155,14 @@ func RunWithDeviceState(ctx context.Context, name string, buf []byte, minify boo
 			msg := value.Bytes()
 			handlerCountBefore := len(handlers)
 			if err := handlers[handlerIdx].Handle(ctx, vm, msg); err != nil {
+				lim.observe(err)
 				log.Error(err, "Handler failed", "handler", handlerIdx)
 			}
+			lim.checkHeap(vm)
+			if err := lim.failure(); err != nil {
+				log.Error(err, "Script exceeded the device limits", "name", name)
+				return err
+			}
 			// Check if new handlers were added during Handle()
 			if len(handlers) != handlerCountBefore {
 				log.Info("Handlers changed, will rebuild cases", "before", handlerCountBefore, "after", len(handlers))
@@ -142,11 +191,106 @@ type handler interface {
 	Handle(ctx context.Context, vm *goja.Runtime, msg []byte) error
 }
 
-// createShellyRuntime creates a goja VM with Shelly API placeholders
-func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handler, deviceState *DeviceState) (*goja.Runtime, error) {
+func httpPending(handlers []handler) bool {
+	for _, h := range handlers {
+		if _, ok := h.(*httpGetHandler); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// advanceClock moves the virtual clock to the next due timer, schedule job or
+// hook (see VirtualClock.at) and runs them: timers first, in creation order,
+// then schedule jobs, then the first hook. It returns false once nothing is
+// due before the end of the simulation.
+func advanceClock(ctx context.Context, log logr.Logger, vm *goja.Runtime, lim *limiter, clock *VirtualClock, handlers []handler, deviceState *DeviceState) bool {
+	now := clock.Now()
+	var due time.Time
+	for _, h := range handlers {
+		if th, ok := h.(*timerHandler); ok && !th.stopped.Load() && (due.IsZero() || th.nextFire.Before(due)) {
+			due = th.nextFire
+		}
+	}
+	jobs := deviceState.ScheduleJobs()
+	jobsDue := make([]time.Time, len(jobs))
+	for i, job := range jobs {
+		if enable, _ := job["enable"].(bool); !enable {
+			continue
+		}
+		timespec, _ := job["timespec"].(string)
+		t, err := nextDue(timespec, now)
+		if err != nil {
+			log.Error(err, "Ignoring schedule", "id", job["id"])
+			continue
+		}
+		jobsDue[i] = t
+		if due.IsZero() || t.Before(due) {
+			due = t
+		}
+	}
+	if t, ok := clock.nextHook(); ok && (due.IsZero() || t.Before(due)) {
+		due = t
+	}
+	if due.IsZero() || due.After(clock.Until()) {
+		clock.set(clock.Until())
+		return false
+	}
+
+	clock.set(due)
+	log.V(1).Info("Virtual clock", "now", due)
+	for _, h := range handlers {
+		if th, ok := h.(*timerHandler); ok && !th.stopped.Load() && th.nextFire.Equal(due) {
+			lim.observe(th.fire(ctx, vm))
+			lim.checkHeap(vm)
+		}
+	}
+	for i, job := range jobs {
+		if !jobsDue[i].IsZero() && jobsDue[i].Equal(due) {
+			lim.observe(runScheduleJob(ctx, log, vm, job))
+			lim.checkHeap(vm)
+		}
+	}
+	if fn, ok := clock.takeHook(due); ok {
+		fn()
+	}
+	return true
+}
+
+// runScheduleJob runs the calls of a due schedule job, the way the device's
+// Schedule service does: Script.Eval runs code in the script's global scope,
+// any other method goes through Shelly.call. It returns the last error.
+func runScheduleJob(ctx context.Context, log logr.Logger, vm *goja.Runtime, job map[string]interface{}) (err error) {
+	calls, _ := job["calls"].([]interface{})
+	for _, c := range calls {
+		call, _ := c.(map[string]interface{})
+		method, _ := call["method"].(string)
+		log.Info("Schedule job due", "id", job["id"], "method", method)
+		if strings.EqualFold(method, "script.eval") {
+			params, _ := call["params"].(map[string]interface{})
+			code, _ := params["code"].(string)
+			if _, err = vm.RunString(code); err != nil {
+				log.Error(err, "Schedule job failed", "id", job["id"], "code", code)
+			}
+			continue
+		}
+		shellyCall, ok := goja.AssertFunction(vm.Get("Shelly").ToObject(vm).Get("call"))
+		if !ok {
+			return
+		}
+		if _, err = shellyCall(goja.Undefined(), vm.ToValue(method), vm.ToValue(call["params"])); err != nil {
+			log.Error(err, "Schedule job failed", "id", job["id"], "method", method)
+		}
+	}
+	return
+}
+
+// createShellyRuntime creates a goja VM with Shelly API placeholders, and the
+// limiter enforcing the device's resource limits on it
+func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handler, deviceState *DeviceState) (*goja.Runtime, *limiter, error) {
 	log, err := logr.FromContext(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Generate unique device identifier (hostname-program-pid)
@@ -169,9 +313,31 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 
 	vm := goja.New()
 
+	limits := LimitsFor(deviceState.DeviceInfo)
+	if deviceState.Limits != nil {
+		limits = *deviceState.Limits
+	}
+	lim := newLimiter(limits)
+	vm.SetMaxCallStackSize(limits.CallDepth)
+
 	// Shelly event handler system
 	eh := NewEventsHandler(ctx, vm)
 
+	// Status changes of the device, for Shelly.addStatusHandler & MQTT
+	// connection handlers
+	sh := newStatusHandlers(log)
+	deviceState.setStatusListener(sh.Notify)
+
+	now := nowFunc(deviceState.Clock)
+	if deviceState.Clock != nil {
+		vm.SetTimeSource(deviceState.Clock.Now)
+		// Math.random too gives the same values on every run
+		vm.SetRandSource(rand.New(rand.NewSource(deviceState.Clock.start.Unix())).Float64)
+		// Emitted events must be ready as soon as emitted, for the event
+		// loop to tell when it is idle
+		eh.Synchronous()
+	}
+
 	// Define methods map with access to deviceState. ctx/vm/eh let Switch.Set
 	// deliver a test-armed nested event (see DeviceState.pendingNestedEvent
 	// and #450) synchronously from inside the call, before invoking the
@@ -192,9 +358,20 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 		}
 
 		log.Info("Shelly.call()", "method", method, "params", params.Export())
+		deviceState.RecordCall(call.Argument(0).String(), params.Export())
+
+		rpc := lim.startCall(vm)
+		if callable, ok := goja.AssertFunction(callback); ok {
+			callback = lim.callback(vm, rpc, callable)
+		}
 
 		if fn, ok := methods[method]; ok {
+			handlersBefore := len(*handlers)
 			result, err := fn(vm, method, params, callback, userdata)
+			if len(*handlers) == handlersBefore {
+				// Not answered asynchronously, through the event loop
+				rpc.done = true
+			}
 			if err != nil {
 				log.Error(err, "Shelly.call() failed", "method", method)
 				return vm.ToValue(err)
@@ -202,6 +379,7 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 			return vm.ToValue(result)
 		} else {
 			log.Error(err, "Shelly.call() unknown method", "method", method)
+			rpc.done = true
 			// Call the callback with null result if provided
 			if !goja.IsUndefined(callback) && !goja.IsNull(callback) {
 				if callable, ok := goja.AssertFunction(callback); ok {
@@ -213,10 +391,26 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 		}
 	})
 
-	// Shelly.addStatusHandler(callback, userdata)
+	// [Shelly.addStatusHandler(callback, userdata)](https://shelly-api-docs.shelly.cloud/gen2/Scripts/ShellyScriptLanguageFeatures#shellyaddeventhandler-and-shellyaddstatushandler)
 	shellyObj.Set("addStatusHandler", func(call goja.FunctionCall) goja.Value {
-		log.V(1).Info("Shelly.addStatusHandler placeholder")
-		return goja.Undefined()
+		callable, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
+			log.Error(nil, "Shelly.addStatusHandler callback is not a function")
+			return goja.Undefined()
+		}
+		if len(sh.handlers) >= limits.StatusHandlers {
+			lim.throw(vm, "Too many status handlers")
+		}
+		handle := sh.Add(callable, call.Argument(1))
+		log.Info("Shelly.addStatusHandler", "handle", handle)
+		return vm.ToValue(handle)
+	})
+
+	// Shelly.removeStatusHandler(handle)
+	shellyObj.Set("removeStatusHandler", func(call goja.FunctionCall) goja.Value {
+		handle := int(call.Argument(0).ToInteger())
+		log.Info("Shelly.removeStatusHandler", "handle", handle)
+		return vm.ToValue(sh.Remove(handle))
 	})
 
 	// [Shelly.addEventHandler(callback, userdata)](https://shelly-api-docs.shelly.cloud/gen2/Scripts/ShellyScriptLanguageFeatures#shellyaddeventhandler-and-shellyaddstatushandler)
@@ -234,6 +428,9 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 		}
 
 		if callable, ok := goja.AssertFunction(callback); ok {
+			if len(eh.handlers) >= limits.EventHandlers {
+				lim.throw(vm, "Too many event handlers")
+			}
 			eh.AddHandler(callable, userdata)
 			log.V(1).Info("Shelly.addEventHandler registered", "handlers", len(eh.handlers))
 		} else {
@@ -274,7 +471,7 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 		event.Component = "script:1"
 		event.Name = "script"
 		event.Id = eh.NextId()
-		event.Now = float64(time.Now().UnixNano()) / 1e6
+		event.Now = float64(now().UnixNano()) / 1e6
 		event.Info.Component = event.Component
 		event.Info.Id = event.Id
 		event.Info.Event = call.Argument(0).String()
@@ -288,9 +485,7 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 		log.V(1).Info("Shelly.emitEvent", "event", event)
 
 		// Send event to channel (non-blocking)
-		select {
-		case eh.Broadcaster() <- vm.ToValue(event):
-		default:
+		if !eh.Emit(vm.ToValue(event)) {
 			log.Error(nil, "Event channel full, dropping event", "event", event)
 		}
 
@@ -301,6 +496,18 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 	shellyObj.Set("getComponentStatus", func(call goja.FunctionCall) goja.Value {
 		component := call.Argument(0).String()
 		log.V(1).Info("Shelly.getComponentStatus", "component", component)
+		if clock := deviceState.Clock; clock != nil && component == "sys" {
+			sys := make(map[string]interface{})
+			if v, ok := deviceState.ComponentStatusValue(component); ok {
+				if m, ok := v.(map[string]interface{}); ok {
+					sys = m
+				}
+			}
+			sys["unixtime"] = clock.Now().Unix()
+			sys["uptime"] = int64(clock.Uptime().Seconds())
+			sys["time"] = clock.Now().Format("15:04")
+			return vm.ToValue(sys)
+		}
 		if deviceState.ComponentStatus != nil {
 			if v, ok := deviceState.ComponentStatusValue(component); ok {
 				return vm.ToValue(v)
@@ -366,8 +573,8 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 				},
 				"location": map[string]interface{}{
 					"tz":  "Europe/Berlin",
-					"lat": 52.5200,
-					"lon": 13.4050,
+					"lat": emulatedLat,
+					"lon": emulatedLon,
 				},
 				"debug": map[string]interface{}{
 					"mqtt": map[string]interface{}{
@@ -467,6 +674,17 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 	// "auth_domain": null
 	// }
 	shellyObj.Set("getDeviceInfo", func(call goja.FunctionCall) goja.Value {
+		if info := deviceState.DeviceInfo; info != nil {
+			buf, err := json.Marshal(info)
+			if err != nil {
+				panic(vm.NewGoError(err))
+			}
+			var out map[string]interface{}
+			if err := json.Unmarshal(buf, &out); err != nil {
+				panic(vm.NewGoError(err))
+			}
+			return vm.ToValue(out)
+		}
 		return vm.ToValue(map[string]interface{}{
 			"name":        "radiateur-bureau",
 			"id":          "shellyplus1-b8d61a85a970",
@@ -505,6 +723,15 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 
 		if !goja.IsUndefined(callback) && !goja.IsNull(callback) {
 			if callable, ok := goja.AssertFunction(callback); ok {
+				for h, timer := range timers {
+					if timer.stopped.Load() {
+						delete(timers, h)
+					}
+				}
+				if len(timers) >= limits.Timers {
+					lim.throw(vm, "Too many timers")
+				}
+
 				handle := nextTimerHandle
 				nextTimerHandle++
 
@@ -515,7 +742,8 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 					callable:  callable,
 					userdata:  userdata,
 					vm:        vm,
-					startTime: time.Now(),
+					startTime: now(),
+					clock:     deviceState.Clock,
 				}
 
 				timers[handle] = timer
@@ -562,7 +790,7 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 				info.Set("interval", 0)
 			}
 			// Calculate next invocation time in milliseconds uptime
-			uptime := time.Since(timer.startTime).Milliseconds()
+			uptime := now().Sub(timer.startTime).Milliseconds()
 			next := timer.nextFire.Sub(timer.startTime).Milliseconds()
 			info.Set("next", next)
 			log.V(1).Info("Timer.getInfo()", "handle", handle, "interval", timer.period.Milliseconds(), "next", next, "uptime", uptime)
@@ -584,6 +812,10 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 
 		log.Info("MQTT.subscribe()", "topic", topic)
 
+		if _, ok := mqttSubscriptions[topic]; !ok && len(mqttSubscriptions) >= limits.MqttSubscriptions {
+			lim.throw(vm, "Too many subscriptions")
+		}
+
 		handler, err := mqttSubscribe(ctx, mc, vm, topic, callback)
 		if err != nil {
 			log.Error(err, "MQTT.subscribe() failed", "topic", topic)
@@ -627,14 +859,26 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 		}
 		return vm.ToValue(true)
 	})
-	mqttObj.Set("setStatusHandler", func(call goja.FunctionCall) goja.Value {
-		log.V(1).Info("MQTT.setStatusHandler placeholder")
-		return goja.Undefined()
-	})
+	// MQTT.setConnectHandler(callback, userdata), MQTT.setDisconnectHandler(callback, userdata):
+	// callback(userdata) when the connection goes up/down.
+	// MQTT.setStatusHandler(callback, userdata): callback({connected}, userdata) on both.
+	// The connection state is the "mqtt" component status: see DeviceState.SetMqttConnected.
+	setMqttHandler := func(name string, h **eventHandler) {
+		mqttObj.Set(name, func(call goja.FunctionCall) goja.Value {
+			log.Info("MQTT." + name + "()")
+			*h = nil
+			if callable, ok := goja.AssertFunction(call.Argument(0)); ok {
+				*h = &eventHandler{callback: callable, userdata: call.Argument(1)}
+			}
+			return goja.Undefined()
+		})
+	}
+	setMqttHandler("setConnectHandler", &sh.mqttConnect)
+	setMqttHandler("setDisconnectHandler", &sh.mqttDisconnect)
+	setMqttHandler("setStatusHandler", &sh.mqttStatus)
 	// MQTT.isConnected() — https://shelly-api-docs.shelly.cloud/gen2/Scripts/ShellyScriptLanguageFeatures#mqttisconnected
-	// The mock client is always treated as connected.
 	mqttObj.Set("isConnected", func(call goja.FunctionCall) goja.Value {
-		return vm.ToValue(true)
+		return vm.ToValue(deviceState.MqttConnected())
 	})
 	vm.Set("MQTT", mqttObj)
 
@@ -735,16 +979,18 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 		}
 	`)
 
-	// Add device's events handler to process emitted events
-	*handlers = append(*handlers, eh)
+	// Add device's events & status handlers to process emitted events and
+	// status changes
+	*handlers = append(*handlers, eh, sh)
 
 	// If the caller provided an event-injection channel (for tests), wire it up
 	// so that raw JSON event bytes sent to the channel are forwarded to the
 	// script's registered Shelly.addEventHandler callbacks.
 	if deviceState.EventInjector != nil {
 		*handlers = append(*handlers, &testEventForwarder{
-			ch: deviceState.EventInjector,
-			eh: eh,
+			ch:          deviceState.EventInjector,
+			eh:          eh,
+			deviceState: deviceState,
 		})
 	}
 
@@ -758,20 +1004,37 @@ func createShellyRuntime(ctx context.Context, mc mqtt.Client, handlers *[]handle
 		})
 	}
 
-	return vm, nil
+	// Globals defined so far are the runtime's, not the script's
+	lim.builtins = make(map[string]bool)
+	for _, k := range vm.GlobalObject().Keys() {
+		lim.builtins[k] = true
+	}
+
+	return vm, lim, nil
 }
 
 // testEventForwarder is a handler that reads pre-encoded JSON event bytes from
 // a test-controlled channel and routes them into the script's event handlers.
 // This allows tests to simulate schedule-fired events without needing a real
-// Shelly device.
+// Shelly device. A NotifyStatus notification
+// ({"method": "NotifyStatus", "params": {...}}) updates the device state
+// instead, which notifies the script's status handlers.
 type testEventForwarder struct {
-	ch <-chan []byte
-	eh *eventsHandler
+	ch          <-chan []byte
+	eh          *eventsHandler
+	deviceState *DeviceState
 }
 
 func (f *testEventForwarder) Wait() <-chan []byte { return f.ch }
 func (f *testEventForwarder) Handle(ctx context.Context, vm *goja.Runtime, msg []byte) error {
+	var notification struct {
+		Method string                 `json:"method"`
+		Params map[string]interface{} `json:"params"`
+	}
+	if err := json.Unmarshal(msg, &notification); err == nil && notification.Method == "NotifyStatus" {
+		f.deviceState.NotifyStatus(notification.Params)
+		return nil
+	}
 	return f.eh.Handle(ctx, vm, msg)
 }
 
@@ -823,8 +1086,8 @@ func createMethodsMap(ctx context.Context, eh *eventsHandler, deviceState *Devic
 			if !goja.IsUndefined(callback) && !goja.IsNull(callback) {
 				if callable, ok := goja.AssertFunction(callback); ok {
 					result := map[string]interface{}{
-						"lat": 52.5200,
-						"lon": 13.4050,
+						"lat": emulatedLat,
+						"lon": emulatedLon,
 						"tz":  "Europe/Berlin",
 					}
 					// Call: callback(result, error_code, error_message)
@@ -1106,9 +1369,10 @@ func createMethodsMap(ctx context.Context, eh *eventsHandler, deviceState *Devic
 			if deviceState.ComponentStatus != nil {
 				// Mutate in place under the lock; a read-then-modify via
 				// ComponentStatusValue would only change the returned copy.
-				if !deviceState.SetComponentStatusField(key, "output", on) {
-					deviceState.SetComponentStatusValue(key, map[string]interface{}{"id": id, "output": on})
-				}
+				// A change of output is notified to the status handlers.
+				deviceState.NotifyStatus(map[string]interface{}{
+					key: map[string]interface{}{"id": id, "output": on},
+				})
 			}
 
 			// Trigger auto-save if callback is set
@@ -1141,6 +1405,30 @@ func createMethodsMap(ctx context.Context, eh *eventsHandler, deviceState *Devic
 			return nil, nil
 		},
 
+		// Switch.Toggle emulates https://shelly-api-docs.shelly.cloud/gen2/ComponentsAndServices/Switch#switchtoggle
+		"switch.toggle": func(vm *goja.Runtime, method string, params goja.Value, callback goja.Value, userdata goja.Value) (interface{}, error) {
+			id := int(params.ToObject(vm).Get("id").ToInteger())
+			key := fmt.Sprintf("switch:%d", id)
+			status, _ := deviceState.ComponentStatusValue(key)
+			m, _ := status.(map[string]interface{})
+			wasOn, _ := m["output"].(bool)
+			if deviceState.ComponentStatus != nil {
+				deviceState.NotifyStatus(map[string]interface{}{
+					key: map[string]interface{}{"id": id, "output": !wasOn},
+				})
+			}
+			if deviceState.OnModified != nil {
+				deviceState.OnModified()
+			}
+			if !goja.IsUndefined(callback) && !goja.IsNull(callback) {
+				if callable, ok := goja.AssertFunction(callback); ok {
+					result := map[string]interface{}{"was_on": wasOn}
+					callable(goja.Undefined(), vm.ToValue(result), vm.ToValue(0), goja.Null(), userdata)
+				}
+			}
+			return nil, nil
+		},
+
 		// Input.SetConfig — acknowledge component rename, no state needed
 		"input.setconfig": func(vm *goja.Runtime, method string, params goja.Value, callback goja.Value, userdata goja.Value) (interface{}, error) {
 			if !goja.IsUndefined(callback) && !goja.IsNull(callback) {
@@ -1201,7 +1489,7 @@ func createMethodsMap(ctx context.Context, eh *eventsHandler, deviceState *Devic
 				return nil, nil
 			}
 
-			h := newHTTPGetHandler(ctx, url, timeout, callable, userdata)
+			h := newHTTPGetHandler(ctx, url, timeout, callable, userdata, deviceState.HTTPFixtures)
 			*handlers = append(*handlers, h)
 			return nil, nil
 		},
@@ -1299,24 +1587,32 @@ type httpGetHandler struct {
 	errMsg  string
 }
 
-func newHTTPGetHandler(ctx context.Context, url string, timeoutSec int, callable goja.Callable, userdata goja.Value) *httpGetHandler {
+func newHTTPGetHandler(ctx context.Context, url string, timeoutSec int, callable goja.Callable, userdata goja.Value, fixtures []HTTPFixture) *httpGetHandler {
 	h := &httpGetHandler{
 		callable: callable,
 		userdata: userdata,
 		ch:       make(chan []byte, 1),
 	}
-	go h.run(ctx, url, timeoutSec)
+	go h.run(ctx, url, timeoutSec, fixtures)
 	return h
 }
 
-func (h *httpGetHandler) run(parent context.Context, url string, timeoutSec int) {
+func (h *httpGetHandler) run(parent context.Context, url string, timeoutSec int, fixtures []HTTPFixture) {
 	// Bounded by the RPC's own `timeout` param, same as before, but also
 	// cancelled early if the script's context ends (e.g. the test finishes)
 	// so this goroutine never outlives its script.
 	ctx, cancel := context.WithTimeout(parent, time.Duration(timeoutSec)*time.Second)
 	defer cancel()
 
-	body, headers, status, err := doHTTPGet(ctx, url)
+	var body string
+	var headers map[string]string
+	var status int
+	var err error
+	if fixtures != nil {
+		body, headers, status, err = fixtureHTTPGet(fixtures, url)
+	} else {
+		body, headers, status, err = doHTTPGet(ctx, url)
+	}
 	if err != nil {
 		h.hasErr = true
 		h.errCode = -1
@@ -1360,6 +1656,25 @@ func doHTTPGet(ctx context.Context, url string) (body string, headers map[string
 	return string(bodyBytes), headers, resp.StatusCode, nil
 }
 
+// fixtureHTTPGet answers a request from the first fixture whose URL prefixes
+// url, and fails it if none does.
+func fixtureHTTPGet(fixtures []HTTPFixture, url string) (body string, headers map[string]string, status int, err error) {
+	for _, f := range fixtures {
+		if !strings.HasPrefix(url, f.URL) {
+			continue
+		}
+		if f.Error != "" {
+			return "", nil, 0, errors.New(f.Error)
+		}
+		status = f.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		return f.Body, f.Headers, status, nil
+	}
+	return "", nil, 0, fmt.Errorf("no HTTP fixture for %s", url)
+}
+
 func (h *httpGetHandler) Wait() <-chan []byte {
 	return h.ch
 }
@@ -1406,6 +1721,10 @@ type timerHandler struct {
 	// in principle miss a stop entirely.
 	stopped atomic.Bool
 	ch      chan []byte // cached channel, created once in Wait()
+	// clock is set in virtual-clock mode: no ticker runs, the event loop
+	// calls fire() when the clock reaches nextFire, and Stop() closes ch.
+	clock     *VirtualClock
+	closeOnce sync.Once
 }
 
 func (th *timerHandler) Wait() <-chan []byte {
@@ -1416,6 +1735,14 @@ func (th *timerHandler) Wait() <-chan []byte {
 
 	th.ch = make(chan []byte)
 
+	if th.clock != nil {
+		th.nextFire = th.startTime.Add(th.interval())
+		if th.stopped.Load() {
+			th.closeOnce.Do(func() { close(th.ch) })
+		}
+		return th.ch
+	}
+
 	if th.repeat {
 		// Periodic timer
 		th.ticker = time.NewTicker(th.period)
@@ -1459,6 +1786,12 @@ func (th *timerHandler) Handle(ctx context.Context, vm *goja.Runtime, msg []byte
 
 	log.V(2).Info("Timer callback", "handle", th.handle, "repeat", th.repeat)
 
+	// A one-shot timer frees its slot before its callback runs, so that the
+	// callback can set another one
+	if !th.repeat {
+		th.stopped.Store(true)
+	}
+
 	// Call the callback with userdata
 	_, err = th.callable(goja.Undefined(), th.userdata)
 	if err != nil {
@@ -1469,8 +1802,31 @@ func (th *timerHandler) Handle(ctx context.Context, vm *goja.Runtime, msg []byte
 	return nil
 }
 
+// interval returns the timer period, with 0ms treated as 1ms.
+func (th *timerHandler) interval() time.Duration {
+	if th.period <= 0 {
+		return 1 * time.Millisecond
+	}
+	return th.period
+}
+
+// fire runs the callback of a due virtual-clock timer, then re-arms it or
+// stops it.
+func (th *timerHandler) fire(ctx context.Context, vm *goja.Runtime) error {
+	err := th.Handle(ctx, vm, nil)
+	if th.repeat {
+		th.nextFire = th.nextFire.Add(th.interval())
+	} else {
+		th.Stop()
+	}
+	return err
+}
+
 func (th *timerHandler) Stop() {
 	th.stopped.Store(true)
+	if th.clock != nil && th.ch != nil {
+		th.closeOnce.Do(func() { close(th.ch) })
+	}
 	if th.ticker != nil {
 		th.ticker.Stop()
 	}
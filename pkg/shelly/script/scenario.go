@@ -0,0 +1,482 @@
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/mqtt"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/yaml"
+)
+
+// ScenarioStart is when a scenario starts, unless it gives its own start.
+var ScenarioStart = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// scenarioPublisher is the MQTT publisher of the messages a scenario sends to
+// the script, which are not the script's own.
+const scenarioPublisher = "scenario"
+
+// Scenario is an end-to-end test of a script: the device it runs on, and
+// what happens to it over time, on a virtual clock (see VirtualClock):
+//
+//	name: Follower switch follows the leader
+//	script: follower-switch.js
+//	duration: 1m
+//	device:
+//	  kvs:
+//	    script/follower-switch/leader: shellyplus1-aabbccddeeff
+//	  component_status:
+//	    switch:0: {id: 0, output: false}
+//	http:
+//	  - url: https://api.open-meteo.com/
+//	    body_file: forecast.json
+//	steps:
+//	  - at: 10s
+//	    mqtt:
+//	      topic: shellyplus1-aabbccddeeff/events/rpc
+//	      payload: {method: NotifyStatus, params: {switch:0: {output: true}}}
+//	  - at: 11s
+//	    expect:
+//	      status:
+//	        switch:0: {output: true}
+//
+// Steps run in order at their time, after the timers & schedule jobs due at
+// the same time, and each one after the script has processed what the
+// previous one caused. The run fails if the script throws while loading or
+// exceeds the device limits; the expectations that do not hold are reported
+// as failures.
+type Scenario struct {
+	Name     string         `json:"name"`
+	Script   string         `json:"script"`           // Embedded script to run, e.g. heater.js
+	Minify   bool           `json:"minify,omitempty"` // Run the script minified, as uploaded
+	Start    time.Time      `json:"start,omitempty"`  // Default: ScenarioStart
+	Duration string         `json:"duration"`         // e.g. "90m", "48h"
+	Device   *DeviceState   `json:"device,omitempty"` // Initial state of the device
+	HTTP     []HTTPFixture  `json:"http,omitempty"`   // Answers to HTTP.GET: any other request fails
+	Steps    []ScenarioStep `json:"steps"`
+
+	duration time.Duration
+}
+
+// ScenarioStep is what happens at a time of a scenario: actions, run in the
+// order of the fields below, then expectations.
+type ScenarioStep struct {
+	At string `json:"at"` // Time since the start, e.g. "10s"
+
+	Status        map[string]interface{} `json:"status,omitempty"`         // Component status changes, as NotifyStatus params
+	Input         *ScenarioInput         `json:"input,omitempty"`          // Input state change or button event
+	Event         map[string]interface{} `json:"event,omitempty"`          // Raw device event, e.g. {info: {event: sys_btn_push}}
+	MQTT          *ScenarioMessage       `json:"mqtt,omitempty"`           // MQTT message to the script
+	MqttConnected *bool                  `json:"mqtt_connected,omitempty"` // MQTT connection going up or down
+	Eval          string                 `json:"eval,omitempty"`           // Code run in the script's global scope, as by Script.Eval
+
+	Expect *ScenarioExpect `json:"expect,omitempty"`
+
+	at time.Duration
+}
+
+// ScenarioInput changes the state of an input (with the status change &
+// toggle event of a switch input), or sends an event of a button input (e.g.
+// single_push).
+type ScenarioInput struct {
+	Id    int    `json:"id"`
+	State *bool  `json:"state,omitempty"`
+	Event string `json:"event,omitempty"`
+}
+
+// ScenarioMessage is an MQTT message. A string payload is sent as is, any
+// other value as JSON.
+type ScenarioMessage struct {
+	Topic   string      `json:"topic"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+// ScenarioExpect is the expected state of the device at a time of a
+// scenario. Objects match if they have the expected fields, other values if
+// they are equal; a null KVS or storage value matches a missing key.
+type ScenarioExpect struct {
+	Status    map[string]interface{} `json:"status,omitempty"`    // Component status, e.g. {switch:0: {output: true}}
+	KVS       map[string]interface{} `json:"kvs,omitempty"`       // KVS values
+	Storage   map[string]interface{} `json:"storage,omitempty"`   // Script.storage values
+	Events    map[string]int         `json:"events,omitempty"`    // Number of Shelly.emitEvent calls since the start, by event name
+	Calls     map[string]int         `json:"calls,omitempty"`     // Number of Shelly.call calls since the start, by method, e.g. {Sys.Reboot: 1}
+	Published []ScenarioMessage      `json:"published,omitempty"` // Messages the script published since the start (any payload if none)
+}
+
+// ScenarioFailure is an expectation of a scenario that did not hold.
+type ScenarioFailure struct {
+	At      time.Duration
+	Message string
+}
+
+func (f ScenarioFailure) String() string {
+	return fmt.Sprintf("at %s: %s", f.At, f.Message)
+}
+
+// LoadScenario reads and parses a scenario (YAML or JSON). The body_file of
+// its HTTP fixtures are relative to the scenario file.
+func LoadScenario(filename string) (*Scenario, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := ParseScenario(buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	for i, f := range sc.HTTP {
+		if f.BodyFile == "" {
+			continue
+		}
+		body, err := os.ReadFile(filepath.Join(filepath.Dir(filename), f.BodyFile))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		sc.HTTP[i].Body = string(body)
+	}
+	return sc, nil
+}
+
+// ParseScenario parses and checks a scenario.
+func ParseScenario(buf []byte) (*Scenario, error) {
+	var sc Scenario
+	if err := yaml.UnmarshalStrict(buf, &sc); err != nil {
+		return nil, err
+	}
+	if err := sc.check(); err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+func (sc *Scenario) check() error {
+	if sc.Script == "" {
+		return fmt.Errorf("scenario %q: no script", sc.Name)
+	}
+	d, err := time.ParseDuration(sc.Duration)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("scenario %q: invalid duration %q", sc.Name, sc.Duration)
+	}
+	sc.duration = d
+	for i := range sc.Steps {
+		step := &sc.Steps[i]
+		at, err := time.ParseDuration(step.At)
+		if err != nil || at < 0 || at > d {
+			return fmt.Errorf("scenario %q: step %d: invalid time %q (must be within %s)", sc.Name, i, step.At, sc.Duration)
+		}
+		step.at = at
+		if i > 0 && at < sc.Steps[i-1].at {
+			return fmt.Errorf("scenario %q: step %d: %s is before the previous step", sc.Name, i, step.At)
+		}
+		if in := step.Input; in != nil && (in.State == nil) == (in.Event == "") {
+			return fmt.Errorf("scenario %q: step %d: input needs either a state or an event", sc.Name, i)
+		}
+		if m := step.MQTT; m != nil && m.Topic == "" {
+			return fmt.Errorf("scenario %q: step %d: MQTT message without topic", sc.Name, i)
+		}
+	}
+	return nil
+}
+
+// RunScenario runs a scenario with the given script source, or the embedded
+// script if buf is nil, and returns the expectations that did not hold. The
+// script runs against an in-memory MQTT broker, and only gets the HTTP
+// responses of the scenario: the run does not depend on the network.
+func RunScenario(ctx context.Context, sc *Scenario, buf []byte) ([]ScenarioFailure, error) {
+	log, err := logr.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := sc.check(); err != nil {
+		return nil, err
+	}
+
+	if buf == nil {
+		if scripts == nil {
+			return nil, fmt.Errorf("no embedded scripts to read %s from", sc.Script)
+		}
+		if buf, err = fs.ReadFile(scripts, sc.Script); err != nil {
+			return nil, err
+		}
+	}
+	if sc.Minify {
+		if buf, err = Minify(buf); err != nil {
+			return nil, fmt.Errorf("failed to minify %s: %w", sc.Script, err)
+		}
+	}
+
+	// Each run starts from the state of the scenario
+	deviceState := &DeviceState{}
+	if sc.Device != nil {
+		data, err := json.Marshal(sc.Device)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, deviceState); err != nil {
+			return nil, err
+		}
+	}
+	if deviceState.KVS == nil {
+		deviceState.KVS = make(map[string]interface{})
+	}
+	if deviceState.Storage == nil {
+		deviceState.Storage = make(map[string]interface{})
+	}
+	deviceState.HTTPFixtures = append([]HTTPFixture{}, sc.HTTP...)
+	deviceState.EventInjector = make(chan []byte, 64)
+	deviceState.ScheduleEvalInjector = make(chan []byte, 64)
+
+	start := sc.Start
+	if start.IsZero() {
+		start = ScenarioStart
+	}
+	clock, err := NewVirtualClock(start, start.Add(sc.duration))
+	if err != nil {
+		return nil, err
+	}
+	deviceState.Clock = clock
+
+	mc := mqtt.NewMockClient()
+	var failures []ScenarioFailure
+	pending := 0
+	for i := range sc.Steps {
+		step := &sc.Steps[i]
+		fail := func(format string, args ...any) {
+			failures = append(failures, ScenarioFailure{At: step.at, Message: fmt.Sprintf(format, args...)})
+		}
+		pending++
+		clock.at(start.Add(step.at), func() {
+			pending--
+			log.Info("Scenario step", "at", step.at)
+			step.run(ctx, mc, deviceState, fail)
+		})
+		if step.Expect != nil {
+			pending++
+			clock.at(start.Add(step.at), func() {
+				pending--
+				step.Expect.check(mc, deviceState, fail)
+			})
+		}
+	}
+
+	err = runWithClient(ctx, log.WithValues("scenario", sc.Name), mc, sc.Script, buf, deviceState)
+	if err != nil {
+		return failures, err
+	}
+	if pending > 0 {
+		failures = append(failures, ScenarioFailure{
+			At:      clock.Uptime(),
+			Message: fmt.Sprintf("the script stopped before the end of the scenario (%d steps not run)", pending),
+		})
+	}
+	return failures, nil
+}
+
+// run runs the actions of a step. Like the device, it queues the events &
+// messages the script then processes; it must not block.
+func (step *ScenarioStep) run(ctx context.Context, mc *mqtt.MockClient, deviceState *DeviceState, fail func(string, ...any)) {
+	inject := func(ch chan []byte, v interface{}) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			fail("%v", err)
+			return
+		}
+		select {
+		case ch <- data:
+		default:
+			fail("too many events queued")
+		}
+	}
+
+	if step.Status != nil {
+		deviceState.NotifyStatus(step.Status)
+	}
+	if in := step.Input; in != nil {
+		component := fmt.Sprintf("input:%d", in.Id)
+		now := float64(deviceState.Clock.Now().UnixMilli()) / 1000
+		info := map[string]interface{}{"component": component, "id": in.Id, "event": in.Event, "ts": now}
+		if in.State != nil {
+			deviceState.NotifyStatus(map[string]interface{}{
+				component: map[string]interface{}{"id": in.Id, "state": *in.State},
+			})
+			info["event"] = "toggle"
+			info["state"] = *in.State
+		}
+		inject(deviceState.EventInjector, map[string]interface{}{
+			"component": component, "name": "input", "id": in.Id, "now": now, "info": info,
+		})
+	}
+	if step.Event != nil {
+		inject(deviceState.EventInjector, step.Event)
+	}
+	if m := step.MQTT; m != nil {
+		payload, err := m.payload()
+		if err != nil {
+			fail("MQTT message to %s: %v", m.Topic, err)
+		} else if err := mc.Publish(ctx, m.Topic, payload, mqtt.AtMostOnce, false, scenarioPublisher); err != nil {
+			fail("MQTT message to %s: %v", m.Topic, err)
+		}
+	}
+	if step.MqttConnected != nil {
+		deviceState.SetMqttConnected(*step.MqttConnected)
+	}
+	if step.Eval != "" {
+		inject(deviceState.ScheduleEvalInjector, map[string]string{"code": step.Eval})
+	}
+}
+
+func (m *ScenarioMessage) payload() ([]byte, error) {
+	if s, ok := m.Payload.(string); ok {
+		return []byte(s), nil
+	}
+	if m.Payload == nil {
+		return []byte{}, nil
+	}
+	return json.Marshal(m.Payload)
+}
+
+// check reports the expectations that do not hold.
+func (e *ScenarioExpect) check(mc *mqtt.MockClient, deviceState *DeviceState, fail func(string, ...any)) {
+	for _, name := range sortedKeys(e.Status) {
+		got, _ := deviceState.ComponentStatusValue(name)
+		if !matches(e.Status[name], got) {
+			fail("status of %s: got %s, want %s", name, jsonString(got), jsonString(e.Status[name]))
+		}
+	}
+	for _, key := range sortedKeys(e.KVS) {
+		got, _ := deviceState.KVSValue(key)
+		if !matches(e.KVS[key], got) {
+			fail("KVS %s: got %s, want %s", key, jsonString(got), jsonString(e.KVS[key]))
+		}
+	}
+	for _, key := range sortedKeys(e.Storage) {
+		got, _ := deviceState.StorageValue(key)
+		if !matches(e.Storage[key], got) {
+			fail("storage %s: got %s, want %s", key, jsonString(got), jsonString(e.Storage[key]))
+		}
+	}
+	names := make([]string, 0, len(e.Events))
+	for name := range e.Events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if got := deviceState.EmittedEventCount(name); got != e.Events[name] {
+			fail("event %s emitted %d times, want %d", name, got, e.Events[name])
+		}
+	}
+
+	methods := make([]string, 0, len(e.Calls))
+	for method := range e.Calls {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		if got := deviceState.CallCount(method); got != e.Calls[method] {
+			fail("%s called %d times, want %d", method, got, e.Calls[method])
+		}
+	}
+
+	var published []mqtt.MockMessage
+	for _, msg := range mc.Published() {
+		if msg.Publisher != scenarioPublisher {
+			published = append(published, msg)
+		}
+	}
+	for _, want := range e.Published {
+		if !publishedMatch(published, want) {
+			fail("no message published to %s with payload %s", want.Topic, jsonString(want.Payload))
+		}
+	}
+}
+
+func publishedMatch(published []mqtt.MockMessage, want ScenarioMessage) bool {
+	for _, msg := range published {
+		if msg.Topic != want.Topic {
+			continue
+		}
+		switch p := want.Payload.(type) {
+		case nil:
+			return true
+		case string:
+			if string(msg.Payload) == p {
+				return true
+			}
+		default:
+			var got interface{}
+			if json.Unmarshal(msg.Payload, &got) == nil && matches(p, got) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches reports whether got has the fields of want, if it is an object,
+// or is equal to want otherwise, once both are normalized to JSON values.
+func matches(want, got interface{}) bool {
+	want, got = jsonValue(want), jsonValue(got)
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range w {
+			if !matches(v, g[k]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !matches(w[i], g[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(want, got)
+}
+
+// jsonValue returns v as decoded from JSON, e.g. with float64 numbers.
+func jsonValue(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+func jsonString(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
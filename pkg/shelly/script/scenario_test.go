@@ -0,0 +1,149 @@
+package script
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/testr"
+)
+
+const testScenario = `
+name: relay follows input & MQTT
+script: test.js
+duration: 2m
+device:
+  kvs:
+    topic: test/relay
+  component_status:
+    switch:0: {id: 0, output: false}
+    input:0: {id: 0, state: false}
+http:
+  - url: https://api.example.com/
+    body: '{"on": true}'
+steps:
+  - at: 10s
+    input: {id: 0, state: true}
+    expect:
+      status:
+        input:0: {state: true}
+        switch:0: {output: true}
+      events: {relay: 1}
+      published:
+        - topic: test/relay/state
+          payload: {"on": true}
+  - at: 20s
+    mqtt: {topic: test/relay, payload: "off"}
+  - at: 20s
+    expect:
+      status:
+        switch:0: {output: false}
+      published:
+        - topic: test/relay/state
+          payload: {"on": false}
+  - at: 30s
+    eval: fetch()
+  - at: 31s
+    expect:
+      status:
+        switch:0: {output: true}
+      kvs:
+        fetched: "true"
+        missing: null
+  - at: 1m
+    mqtt_connected: false
+    expect:
+      storage:
+        mqtt: disconnected
+  - at: 2m
+    expect:
+      storage:
+        ticks: "12"
+`
+
+const testScenarioScript = `
+var ticks = 0;
+Timer.set(10000, true, function() {
+	ticks++;
+	Script.storage.setItem("ticks", JSON.stringify(ticks));
+});
+function set(on) {
+	Shelly.call("Switch.Set", {id: 0, on: on});
+	MQTT.publish("test/relay/state", JSON.stringify({on: on}));
+	Shelly.emitEvent("relay", {on: on});
+}
+function fetch() {
+	Shelly.call("HTTP.GET", {url: "https://api.example.com/relay", timeout: 5}, function(res, code) {
+		if (code === 0) {
+			set(JSON.parse(res.body).on);
+			Shelly.call("KVS.Set", {key: "fetched", value: "true"});
+		}
+	});
+}
+Shelly.addEventHandler(function(ev) {
+	if (ev.info.component === "input:0" && ev.info.event === "toggle") {
+		set(ev.info.state);
+	}
+});
+Shelly.call("KVS.Get", {key: "topic"}, function(res) {
+	MQTT.subscribe(res.value, function(topic, message) {
+		set(message === "on");
+	});
+});
+MQTT.setDisconnectHandler(function() {
+	Script.storage.setItem("mqtt", "disconnected");
+});
+`
+
+func TestScenario(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), testr.NewWithOptions(t, testr.Options{Verbosity: -1}))
+
+	sc, err := ParseScenario([]byte(testScenario))
+	if err != nil {
+		t.Fatalf("ParseScenario: %v", err)
+	}
+	failures, err := RunScenario(ctx, sc, []byte(testScenarioScript))
+	if err != nil {
+		t.Fatalf("RunScenario: %v", err)
+	}
+	for _, f := range failures {
+		t.Error(f)
+	}
+
+	// Each run starts afresh, and reports what does not hold
+	sc.Steps[len(sc.Steps)-1].Expect.Storage["ticks"] = "13"
+	failures, err = RunScenario(ctx, sc, []byte(testScenarioScript))
+	if err != nil {
+		t.Fatalf("RunScenario: %v", err)
+	}
+	if len(failures) != 1 || !strings.Contains(failures[0].String(), `at 2m0s: storage ticks: got "12", want "13"`) {
+		t.Errorf("failures = %v", failures)
+	}
+}
+
+func TestScenarioErrors(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), testr.NewWithOptions(t, testr.Options{Verbosity: -1}))
+
+	for name, in := range map[string]string{
+		"unknown field":       "script: a.js\nduration: 1m\ncolor: red\n",
+		"no script":           "duration: 1m\n",
+		"no duration":         "script: a.js\n",
+		"step after end":      "script: a.js\nduration: 1m\nsteps:\n  - at: 2m\n",
+		"steps out of order":  "script: a.js\nduration: 1m\nsteps:\n  - at: 20s\n  - at: 10s\n",
+		"input state & event": "script: a.js\nduration: 1m\nsteps:\n  - at: 1s\n    input: {id: 0, state: true, event: single_push}\n",
+	} {
+		if _, err := ParseScenario([]byte(in)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// Scripts that do not load fail the run
+	sc, err := ParseScenario([]byte("script: a.js\nduration: 1m\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RunScenario(ctx, sc, []byte("throw new Error('boom');")); err == nil {
+		t.Error("expected an error")
+	}
+}
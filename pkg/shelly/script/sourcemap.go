@@ -0,0 +1,384 @@
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/js"
+)
+
+// SourceMap maps positions in the code uploaded to a device back to the
+// script source it was produced from.
+//
+// The minifier does not emit a source map of its own, so one is rebuilt after
+// the fact by aligning the JavaScript tokens of both texts: string literals,
+// property names, globals and keywords survive minification unchanged and
+// anchor the alignment, while renamed locals and dropped punctuation fall
+// back to the closest preceding anchor. Minification is deterministic, so the
+// map can be regenerated from the local source at any time rather than being
+// stored alongside the uploaded script.
+type SourceMap struct {
+	name   string
+	src    []byte
+	code   []byte
+	genOff []int // offsets of the aligned tokens in code, ascending
+	srcOff []int // matching offsets in src
+	genLen []int
+	srcLen []int
+
+	genLines []int // offsets of the start of each line of code
+	srcLines []int // offsets of the start of each line of src
+}
+
+// MinifyWithSourceMap returns the code Upload sends to the device for src
+// when minification is requested, along with the map of that code back to
+// src.
+func MinifyWithSourceMap(name string, src []byte) ([]byte, *SourceMap, error) {
+	code, err := prepareCode(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	return code, NewSourceMap(name, src, code), nil
+}
+
+// NewSourceMap aligns code, as uploaded to the device, with the source it was
+// generated from. name is only used to label mapped positions.
+func NewSourceMap(name string, src, code []byte) *SourceMap {
+	m := &SourceMap{name: name, src: src, code: code, genLines: lineStarts(code), srcLines: lineStarts(src)}
+	gen := lexTokens(code)
+	orig := lexTokens(src)
+	var pairs [][2]int
+	alignTokens(gen, orig, 0, len(gen), 0, len(orig), &pairs)
+	for _, p := range pairs {
+		m.genOff = append(m.genOff, gen[p[0]].off)
+		m.genLen = append(m.genLen, gen[p[0]].len)
+		m.srcOff = append(m.srcOff, orig[p[1]].off)
+		m.srcLen = append(m.srcLen, orig[p[1]].len)
+	}
+	return m
+}
+
+// Code returns the uploaded code the map was built for.
+func (m *SourceMap) Code() []byte {
+	return m.code
+}
+
+// Lookup returns the position in the original source of the given position in
+// the uploaded code. Lines and columns are 1-based, as reported by the
+// device's script engine; columns count bytes.
+func (m *SourceMap) Lookup(line, col int) (srcLine, srcCol int, ok bool) {
+	if line < 1 || line > len(m.genLines) || col < 1 || len(m.genOff) == 0 {
+		return 0, 0, false
+	}
+	off := m.genLines[line-1] + col - 1
+	if off >= len(m.code) {
+		return 0, 0, false
+	}
+	i := sort.SearchInts(m.genOff, off+1) - 1
+	if i < 0 {
+		i = 0
+	}
+	target := m.srcOff[i]
+	if delta := off - m.genOff[i]; delta > 0 && delta < m.genLen[i] && delta < m.srcLen[i] {
+		target += delta
+	}
+	srcLine, srcCol = positionOf(m.srcLines, target)
+	return srcLine, srcCol, true
+}
+
+// positionPattern matches the positions the device's script engine reports
+// in error messages and stack traces, e.g. "at line 1 col 2345" or
+// "called from line 1 col 678".
+var positionPattern = regexp.MustCompile(`line (\d+) col (\d+)`)
+
+// Annotate appends the original source position after every engine-reported
+// position found in msg, e.g. "line 1 col 2345" becomes
+// "line 1 col 2345 (~heater.js:120:9)". The "~" marks the position as
+// approximate: the map is rebuilt by alignment, which may land a few tokens
+// or lines off. Messages without positions are returned unchanged.
+func (m *SourceMap) Annotate(msg string) string {
+	return positionPattern.ReplaceAllStringFunc(msg, func(s string) string {
+		sub := positionPattern.FindStringSubmatch(s)
+		line, _ := strconv.Atoi(sub[1])
+		col, _ := strconv.Atoi(sub[2])
+		srcLine, srcCol, ok := m.Lookup(line, col)
+		if !ok {
+			return s
+		}
+		return fmt.Sprintf("%s (~%s:%d:%d)", s, m.name, srcLine, srcCol)
+	})
+}
+
+// MarshalJSON encodes the map in the Source Map Revision 3 format, so it can
+// also be loaded into a browser debugger or any other standard tool.
+func (m *SourceMap) MarshalJSON() ([]byte, error) {
+	var mappings strings.Builder
+	genLine, prevGenCol := 0, 0
+	prevSrcLine, prevSrcCol := 0, 0
+	first := true
+	for i := range m.genOff {
+		gl, gc := positionOf(m.genLines, m.genOff[i])
+		sl, sc := positionOf(m.srcLines, m.srcOff[i])
+		gl, gc, sl, sc = gl-1, gc-1, sl-1, sc-1
+		for genLine < gl {
+			mappings.WriteByte(';')
+			genLine++
+			prevGenCol = 0
+			first = true
+		}
+		if !first {
+			mappings.WriteByte(',')
+		}
+		first = false
+		writeVLQ(&mappings, gc-prevGenCol)
+		writeVLQ(&mappings, 0) // single source
+		writeVLQ(&mappings, sl-prevSrcLine)
+		writeVLQ(&mappings, sc-prevSrcCol)
+		prevGenCol, prevSrcLine, prevSrcCol = gc, sl, sc
+	}
+	return json.Marshal(struct {
+		Version        int      `json:"version"`
+		File           string   `json:"file"`
+		Sources        []string `json:"sources"`
+		SourcesContent []string `json:"sourcesContent"`
+		Names          []string `json:"names"`
+		Mappings       string   `json:"mappings"`
+	}{
+		Version:        3,
+		File:           m.name,
+		Sources:        []string{m.name},
+		SourcesContent: []string{string(m.src)},
+		Names:          []string{},
+		Mappings:       mappings.String(),
+	})
+}
+
+const vlqAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+func writeVLQ(b *strings.Builder, v int) {
+	u := v << 1
+	if v < 0 {
+		u = (-v << 1) | 1
+	}
+	for {
+		digit := u & 0x1f
+		u >>= 5
+		if u > 0 {
+			digit |= 0x20
+		}
+		b.WriteByte(vlqAlphabet[digit])
+		if u == 0 {
+			return
+		}
+	}
+}
+
+// lineStarts returns the offset of the start of every line in buf.
+func lineStarts(buf []byte) []int {
+	starts := []int{0}
+	for i, b := range buf {
+		if b == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// positionOf converts a byte offset into a 1-based line and column, given the
+// line starts of the text.
+func positionOf(lines []int, off int) (line, col int) {
+	line = sort.SearchInts(lines, off+1)
+	return line, off - lines[line-1] + 1
+}
+
+// srcToken is a lexed JavaScript token reduced to what the alignment needs: a
+// comparison key that ignores cosmetic rewrites (string quotes, number
+// spelling) and its location.
+type srcToken struct {
+	key string
+	off int
+	len int
+}
+
+func lexTokens(buf []byte) []srcToken {
+	// parse.NewInputBytes appends a NUL in place when capacity allows: never
+	// hand it the caller's slice.
+	in := parse.NewInputBytes(append(make([]byte, 0, len(buf)+1), buf...))
+	l := js.NewLexer(in)
+	var toks []srcToken
+	prev := js.ErrorToken
+	for {
+		tt, data := l.Next()
+		if (tt == js.DivToken || tt == js.DivEqToken) && regExpAllowed(prev) {
+			tt, data = l.RegExp()
+		}
+		switch tt {
+		case js.ErrorToken:
+			return toks
+		case js.WhitespaceToken, js.LineTerminatorToken, js.CommentToken, js.CommentLineTerminatorToken:
+			continue
+		}
+		end := in.Offset()
+		toks = append(toks, srcToken{key: tokenKey(tt, data), off: end - len(data), len: len(data)})
+		prev = tt
+	}
+}
+
+// regExpAllowed tells whether a '/' following a token of type prev starts a
+// regular expression literal rather than a division.
+func regExpAllowed(prev js.TokenType) bool {
+	switch prev {
+	case js.CloseParenToken, js.CloseBracketToken, js.CloseBraceToken,
+		js.StringToken, js.TemplateToken, js.TemplateEndToken, js.RegExpToken,
+		js.ThisToken, js.SuperToken, js.TrueToken, js.FalseToken, js.NullToken:
+		return false
+	}
+	return !js.IsNumeric(prev) && !js.IsIdentifier(prev)
+}
+
+func tokenKey(tt js.TokenType, data []byte) string {
+	switch {
+	case (tt == js.StringToken || tt == js.TemplateToken) && len(data) >= 2:
+		// Quotes may change, and downgradeTemplates turns plain template
+		// literals into strings.
+		return "s" + string(data[1:len(data)-1])
+	case js.IsNumeric(tt):
+		if f, err := strconv.ParseFloat(string(data), 64); err == nil {
+			return "n" + strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		if i, err := strconv.ParseInt(string(data), 0, 64); err == nil {
+			return "n" + strconv.FormatInt(i, 10)
+		}
+	}
+	return string(data)
+}
+
+// alignTokens appends to pairs the matched (gen, orig) token indexes for the
+// ranges gen[gs:ge] and orig[os:oe], in increasing order. It follows the
+// patience diff strategy: tokens occurring exactly once on both sides anchor
+// the alignment and the gaps between anchors are aligned recursively, with a
+// plain longest common subsequence for the small gaps left without anchors.
+func alignTokens(gen, orig []srcToken, gs, ge, os, oe int, pairs *[][2]int) {
+	for gs < ge && os < oe && gen[gs].key == orig[os].key {
+		*pairs = append(*pairs, [2]int{gs, os})
+		gs, os = gs+1, os+1
+	}
+	var tail [][2]int
+	for gs < ge && os < oe && gen[ge-1].key == orig[oe-1].key {
+		ge, oe = ge-1, oe-1
+		tail = append(tail, [2]int{ge, oe})
+	}
+	defer func() {
+		for i := len(tail) - 1; i >= 0; i-- {
+			*pairs = append(*pairs, tail[i])
+		}
+	}()
+	if gs == ge || os == oe {
+		return
+	}
+
+	anchors := uniqueAnchors(gen, orig, gs, ge, os, oe)
+	if len(anchors) == 0 {
+		alignLCS(gen, orig, gs, ge, os, oe, pairs)
+		return
+	}
+	for _, a := range anchors {
+		alignTokens(gen, orig, gs, a[0], os, a[1], pairs)
+		*pairs = append(*pairs, a)
+		gs, os = a[0]+1, a[1]+1
+	}
+	alignTokens(gen, orig, gs, ge, os, oe, pairs)
+}
+
+// uniqueAnchors returns the longest increasing run of tokens that occur
+// exactly once in both ranges.
+func uniqueAnchors(gen, orig []srcToken, gs, ge, os, oe int) [][2]int {
+	type count struct{ gen, orig, at int }
+	counts := make(map[string]*count)
+	for i := gs; i < ge; i++ {
+		c := counts[gen[i].key]
+		if c == nil {
+			c = &count{}
+			counts[gen[i].key] = c
+		}
+		c.gen++
+	}
+	for i := os; i < oe; i++ {
+		if c := counts[orig[i].key]; c != nil {
+			c.orig++
+			c.at = i
+		}
+	}
+	var candidates [][2]int
+	for i := gs; i < ge; i++ {
+		if c := counts[gen[i].key]; c.gen == 1 && c.orig == 1 {
+			candidates = append(candidates, [2]int{i, c.at})
+		}
+	}
+
+	// Longest increasing subsequence on the orig side (patience sorting).
+	var piles []int // index in candidates of the top of each pile
+	back := make([]int, len(candidates))
+	for i, c := range candidates {
+		p := sort.Search(len(piles), func(j int) bool { return candidates[piles[j]][1] >= c[1] })
+		if p > 0 {
+			back[i] = piles[p-1]
+		} else {
+			back[i] = -1
+		}
+		if p == len(piles) {
+			piles = append(piles, i)
+		} else {
+			piles[p] = i
+		}
+	}
+	if len(piles) == 0 {
+		return nil
+	}
+	anchors := make([][2]int, len(piles))
+	for i, k := len(piles)-1, piles[len(piles)-1]; k >= 0; i, k = i-1, back[k] {
+		anchors[i] = candidates[k]
+	}
+	return anchors
+}
+
+// maxLCSCells bounds the table alignLCS may allocate; larger gaps without any
+// unique token are left unaligned and map to the preceding anchor.
+const maxLCSCells = 1 << 16
+
+func alignLCS(gen, orig []srcToken, gs, ge, os, oe int, pairs *[][2]int) {
+	n, m := ge-gs, oe-os
+	if n*m > maxLCSCells {
+		return
+	}
+	// lcs[i][j] is the LCS length of gen[gs+i:ge] and orig[os+j:oe].
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if gen[gs+i].key == orig[os+j].key {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case gen[gs+i].key == orig[os+j].key:
+			*pairs = append(*pairs, [2]int{gs + i, os + j})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+}
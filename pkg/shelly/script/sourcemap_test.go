@@ -0,0 +1,152 @@
+package script_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/go-sourcemap/sourcemap"
+
+	"github.com/asnowfix/home-automation/internal/shelly/scripts"
+	"github.com/asnowfix/home-automation/pkg/shelly/script"
+)
+
+// stringLiterals returns the 1-based line and column of every double-quoted
+// string literal in minified code, along with its content.
+func stringLiterals(code []byte) (positions [][2]int, contents []string) {
+	for li, l := range strings.Split(string(code), "\n") {
+		for c := 0; c < len(l); c++ {
+			if l[c] != '"' {
+				continue
+			}
+			end := strings.IndexByte(l[c+1:], '"')
+			if end < 0 {
+				break
+			}
+			positions = append(positions, [2]int{li + 1, c + 1})
+			contents = append(contents, l[c+1:c+1+end])
+			c += end + 1
+		}
+	}
+	return positions, contents
+}
+
+// TestSourceMap_EmbeddedScripts minifies every shipped script and checks that
+// string literals in the uploaded code map back onto the same literal in the
+// source. The minifier occasionally swaps if/else branches (negating the
+// condition), which a monotone alignment cannot follow: those land a few lines
+// off, hence a tolerance over the whole set rather than per script.
+func TestSourceMap_EmbeddedScripts(t *testing.T) {
+	names, err := fs.Glob(scripts.GetFS(), "*.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	total, hits := 0, 0
+	for _, name := range names {
+		src, err := fs.ReadFile(scripts.GetFS(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, m, err := script.MinifyWithSourceMap(name, src)
+		if err != nil {
+			t.Fatalf("%s: minify failed: %v", name, err)
+		}
+		srcLines := strings.Split(string(src), "\n")
+		positions, contents := stringLiterals(code)
+		for i, p := range positions {
+			total++
+			line, col, ok := m.Lookup(p[0], p[1])
+			if !ok {
+				t.Errorf("%s: no mapping for %q at %d:%d", name, contents[i], p[0], p[1])
+				continue
+			}
+			// col points at the opening quote
+			if rest := srcLines[line-1][col-1:]; len(rest) > 1 && strings.HasPrefix(rest[1:], contents[i]) {
+				hits++
+			} else {
+				t.Logf("%s: %q mapped to %d:%d", name, contents[i], line, col)
+			}
+		}
+	}
+	if total == 0 || hits*100 < total*98 {
+		t.Errorf("only %d of %d string literals mapped back onto themselves", hits, total)
+	}
+}
+
+func TestSourceMap_Annotate(t *testing.T) {
+	src := []byte(`// Comments and layout are dropped by the minifier.
+var CONFIG = {
+  debug: false
+};
+
+function computeTarget(levels, occupied) {
+  var target = levels.eco;
+  if (occupied) {
+    target = levels.comfort;
+  }
+  return target.value;
+}
+
+Timer.set(1000, true, function () {
+  print("target", computeTarget({ eco: 17 }, true));
+});
+`)
+	code, m, err := script.MinifyWithSourceMap("heater.js", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := strings.Index(string(code), ".value") + 1
+	if col == 0 || strings.Contains(string(code), "\n") {
+		t.Fatalf("unexpected minified code: %s", code)
+	}
+
+	msg := fmt.Sprintf("Uncaught Error: Cannot read property 'value' of undefined\n at line 1 col %d\nin function \"computeTarget\" called from line 1 col 1", col)
+	got := m.Annotate(msg)
+	want := fmt.Sprintf("at line 1 col %d (~heater.js:11:16)", col)
+	if !strings.Contains(got, want) {
+		t.Errorf("Annotate() = %q, want it to contain %q", got, want)
+	}
+	if !strings.Contains(got, "called from line 1 col 1 (~heater.js:2:1)") {
+		t.Errorf("Annotate() = %q, want the caller position mapped too", got)
+	}
+
+	if got := m.Annotate("BLE scanner is listening"); got != "BLE scanner is listening" {
+		t.Errorf("Annotate() changed a message without positions: %q", got)
+	}
+	if got := m.Annotate("at line 7 col 1"); got != "at line 7 col 1" {
+		t.Errorf("Annotate() mapped a position outside the code: %q", got)
+	}
+}
+
+// TestSourceMap_V3 checks the encoded map with an independent consumer.
+func TestSourceMap_V3(t *testing.T) {
+	src, err := fs.ReadFile(scripts.GetFS(), "heater.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, m, err := script.MinifyWithSourceMap("heater.js", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer, err := sourcemap.Parse("heater.js.map", buf)
+	if err != nil {
+		t.Fatalf("invalid source map: %v", err)
+	}
+	positions, _ := stringLiterals(code)
+	if len(positions) == 0 {
+		t.Fatal("no string literal in heater.js")
+	}
+	for _, p := range positions {
+		wantLine, wantCol, _ := m.Lookup(p[0], p[1])
+		source, _, line, col, ok := consumer.Source(p[0], p[1]-1)
+		if !ok || source != "heater.js" || line != wantLine || col != wantCol-1 {
+			t.Fatalf("consumer maps %d:%d to %s %d:%d (ok=%v), Lookup to %d:%d", p[0], p[1], source, line, col+1, ok, wantLine, wantCol)
+		}
+	}
+}
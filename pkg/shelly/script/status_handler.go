@@ -0,0 +1,152 @@
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/go-logr/logr"
+)
+
+// statusNotification is what Shelly.addStatusHandler callbacks receive, e.g.
+//
+//	{"component": "switch:0", "name": "switch", "id": 0, "delta": {"id": 0, "output": true}}
+type statusNotification struct {
+	Component string                 `json:"component"`
+	Name      string                 `json:"name"`
+	Id        *int                   `json:"id,omitempty"`
+	Delta     map[string]interface{} `json:"delta"`
+}
+
+func newStatusNotification(component string, delta map[string]interface{}) statusNotification {
+	n := statusNotification{Component: component, Name: component, Delta: delta}
+	if i := strings.Index(component, ":"); i >= 0 {
+		n.Name = component[:i]
+		if id, err := strconv.Atoi(component[i+1:]); err == nil {
+			n.Id = &id
+			if _, ok := delta["id"]; !ok {
+				delta["id"] = id
+			}
+		}
+	}
+	return n
+}
+
+// there is one statusHandlers per script: it delivers the device's component
+// status changes to the Shelly.addStatusHandler callbacks, and the changes
+// of the MQTT connection to the MQTT connect/disconnect/status handlers
+type statusHandlers struct {
+	log        logr.Logger
+	ch         chan []byte
+	handlers   []statusHandler
+	nextHandle int
+
+	mqttConnect    *eventHandler
+	mqttDisconnect *eventHandler
+	mqttStatus     *eventHandler
+}
+
+// each call to Shelly.addStatusHandler creates a statusHandler
+type statusHandler struct {
+	handle int
+	eventHandler
+}
+
+func newStatusHandlers(log logr.Logger) *statusHandlers {
+	return &statusHandlers{
+		log: log.WithValues("statusHandlers", "statusHandlers"),
+		ch:  make(chan []byte, 100),
+	}
+}
+
+// Notify queues a status change for delivery by the event loop, without
+// blocking. It may be called from any goroutine (e.g. a test updating the
+// device state).
+func (sh *statusHandlers) Notify(component string, delta map[string]interface{}) {
+	data, err := json.Marshal(newStatusNotification(component, delta))
+	if err != nil {
+		sh.log.Error(err, "Failed to marshal status change", "component", component)
+		return
+	}
+	select {
+	case sh.ch <- data:
+	default:
+		sh.log.Error(nil, "Status channel full, dropping status change", "component", component)
+	}
+}
+
+func (sh *statusHandlers) Add(callback goja.Callable, userdata goja.Value) int {
+	sh.nextHandle++
+	sh.handlers = append(sh.handlers, statusHandler{
+		handle:       sh.nextHandle,
+		eventHandler: eventHandler{callback: callback, userdata: userdata},
+	})
+	return sh.nextHandle
+}
+
+func (sh *statusHandlers) Remove(handle int) bool {
+	for i, h := range sh.handlers {
+		if h.handle == handle {
+			sh.handlers = append(sh.handlers[:i], sh.handlers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (sh *statusHandlers) Wait() <-chan []byte {
+	return sh.ch
+}
+
+func (sh *statusHandlers) Handle(ctx context.Context, vm *goja.Runtime, msg []byte) error {
+	log, err := logr.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	var status map[string]interface{}
+	if err := json.Unmarshal(msg, &status); err != nil {
+		log.Error(err, "Failed to unmarshal status change", "msg", string(msg))
+		return err
+	}
+	log.V(1).Info("Processing status change", "status", status)
+
+	statusObj := vm.ToValue(status)
+	for _, h := range sh.handlers {
+		if _, err := h.callback(goja.Undefined(), statusObj, h.userdata); err != nil {
+			log.Error(err, "Status handler failed", "handle", h.handle, "status", status)
+			// Uncatchable: the device would stop the script
+			var so *goja.StackOverflowError
+			if errors.As(err, &so) {
+				return err
+			}
+		}
+	}
+
+	if status["component"] != "mqtt" {
+		return nil
+	}
+	delta, _ := status["delta"].(map[string]interface{})
+	connected, ok := delta["connected"].(bool)
+	if !ok {
+		return nil
+	}
+	if sh.mqttStatus != nil {
+		if _, err := sh.mqttStatus.callback(goja.Undefined(), vm.ToValue(map[string]interface{}{"connected": connected}), sh.mqttStatus.userdata); err != nil {
+			log.Error(err, "MQTT status handler failed")
+		}
+	}
+	h := sh.mqttDisconnect
+	if connected {
+		h = sh.mqttConnect
+	}
+	if h != nil {
+		if _, err := h.callback(goja.Undefined(), h.userdata); err != nil {
+			log.Error(err, "MQTT connection handler failed", "connected", connected)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package script
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/mqtt"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/testr"
+)
+
+// TestStatusHandlers validates that Switch.Set, device state updates and
+// injected NotifyStatus notifications reach Shelly.addStatusHandler, and
+// that MQTT connection changes reach the MQTT handlers.
+func TestStatusHandlers(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), testr.NewWithOptions(t, testr.Options{Verbosity: -1}))
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	ctx = mqtt.NewContext(ctx, mqtt.NewMockClient())
+
+	events := make(chan []byte, 10)
+	deviceState := &DeviceState{
+		KVS:     make(map[string]interface{}),
+		Storage: make(map[string]interface{}),
+		ComponentStatus: map[string]interface{}{
+			"switch:0": map[string]interface{}{"id": 0, "output": false, "apower": 0.0},
+			"sys":      map[string]interface{}{"kvs_rev": 1},
+		},
+		EventInjector: events,
+	}
+
+	buf := []byte(`
+		var seen = [];
+		function note(s) {
+			seen.push(s);
+			Script.storage.setItem("seen", seen.join(" "));
+		}
+		var removed = Shelly.addStatusHandler(function() { note("removed"); });
+		Shelly.removeStatusHandler(removed);
+		Shelly.addStatusHandler(function(status, ud) {
+			note(ud + ":" + status.component + ":" + JSON.stringify(status.delta));
+		}, "ud");
+		MQTT.setStatusHandler(function(status) {
+			note("status:" + status.connected + ":" + MQTT.isConnected());
+		});
+		MQTT.setConnectHandler(function(ud) { note(ud); }, "connected");
+		MQTT.setDisconnectHandler(function(ud) { note(ud); }, "disconnected");
+		Timer.set(10, false, function() {
+			Shelly.call("Switch.Set", {id: 0, on: true});
+			Shelly.call("Switch.Set", {id: 0, on: true}); // no change
+		});
+	`)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- RunWithDeviceState(ctx, "status.js", buf, false, deviceState)
+	}()
+
+	waitSeen := func(want string) {
+		t.Helper()
+		for {
+			if v, _ := deviceState.StorageValue("seen"); v == want {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				v, _ := deviceState.StorageValue("seen")
+				t.Fatalf("seen = %q, want %q", v, want)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+
+	waitSeen(`ud:switch:0:{"id":0,"output":true}`)
+
+	deviceState.SetComponentStatusField("switch:0", "apower", 12.5)
+	waitSeen(`ud:switch:0:{"id":0,"output":true} ud:switch:0:{"apower":12.5,"id":0}`)
+
+	events <- []byte(`{"method":"NotifyStatus","params":{"ts":1736603810.49,"sys":{"kvs_rev":2}}}`)
+	waitSeen(`ud:switch:0:{"id":0,"output":true} ud:switch:0:{"apower":12.5,"id":0} ud:sys:{"kvs_rev":2}`)
+
+	deviceState.SetMqttConnected(false)
+	waitSeen(`ud:switch:0:{"id":0,"output":true} ud:switch:0:{"apower":12.5,"id":0} ud:sys:{"kvs_rev":2} ` +
+		`ud:mqtt:{"connected":false} status:false:false disconnected`)
+
+	deviceState.SetMqttConnected(true)
+	waitSeen(`ud:switch:0:{"id":0,"output":true} ud:switch:0:{"apower":12.5,"id":0} ud:sys:{"kvs_rev":2} ` +
+		`ud:mqtt:{"connected":false} status:false:false disconnected ` +
+		`ud:mqtt:{"connected":true} status:true:true connected`)
+
+	cancel()
+	<-done
+}
+
+// TestSwitchToggle_NoStatus checks that toggling a switch with no recorded
+// status turns it on rather than crashing the emulator.
+func TestSwitchToggle_NoStatus(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), testr.NewWithOptions(t, testr.Options{Verbosity: -1}))
+	ctx = mqtt.NewContext(ctx, mqtt.NewMockClient())
+	start := time.Date(2026, 6, 15, 0, 0, 0, 0, time.UTC)
+	clock, err := NewVirtualClock(start, start.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deviceState := &DeviceState{
+		KVS:             make(map[string]interface{}),
+		Storage:         make(map[string]interface{}),
+		ComponentStatus: make(map[string]interface{}),
+		Clock:           clock,
+	}
+
+	buf := []byte(`
+		Timer.set(10, false, function() {
+			Shelly.call("Switch.Toggle", {id: 3}, function(res) {
+				Script.storage.setItem("was_on", JSON.stringify(res.was_on));
+			});
+		});
+	`)
+	if err := RunWithDeviceState(ctx, "toggle.js", buf, false, deviceState); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, _ := deviceState.StorageValue("was_on"); v != "false" {
+		t.Errorf("was_on = %q, want %q", v, "false")
+	}
+	status, _ := deviceState.ComponentStatusValue("switch:3")
+	if m, _ := status.(map[string]interface{}); m["output"] != true {
+		t.Errorf("switch:3 status = %v, want output true", status)
+	}
+}
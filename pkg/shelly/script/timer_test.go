@@ -468,10 +468,7 @@ func TestTimerSetWithShellyRuntime(t *testing.T) {
 	ctx = logr.NewContext(ctx, testr.New(t))
 
 	// Add mock MQTT client to context
-	mqtt.ResetClient()
-	mc := mqtt.NewMockClient()
-	mqtt.SetClient(mc)
-	t.Cleanup(mqtt.ResetClient)
+	ctx = mqtt.NewContext(ctx, mqtt.NewMockClient())
 
 	// Create a test script that uses Timer.set
 	script := `
@@ -525,10 +522,7 @@ func TestTimerSetOneShotWithRuntime(t *testing.T) {
 	ctx = logr.NewContext(ctx, testr.New(t))
 
 	// Add mock MQTT client to context
-	mqtt.ResetClient()
-	mc := mqtt.NewMockClient()
-	mqtt.SetClient(mc)
-	t.Cleanup(mqtt.ResetClient)
+	ctx = mqtt.NewContext(ctx, mqtt.NewMockClient())
 
 	script := `
 		var callCount = 0;
@@ -570,10 +564,7 @@ func TestTimerSetRecurringWithRuntime(t *testing.T) {
 	ctx = logr.NewContext(ctx, testr.New(t))
 
 	// Add mock MQTT client to context
-	mqtt.ResetClient()
-	mc := mqtt.NewMockClient()
-	mqtt.SetClient(mc)
-	t.Cleanup(mqtt.ResetClient)
+	ctx = mqtt.NewContext(ctx, mqtt.NewMockClient())
 
 	script := `
 		var callCount = 0;
@@ -615,10 +606,7 @@ func TestTimerClearWithRuntime(t *testing.T) {
 	ctx = logr.NewContext(ctx, testr.New(t))
 
 	// Add mock MQTT client to context
-	mqtt.ResetClient()
-	mc := mqtt.NewMockClient()
-	mqtt.SetClient(mc)
-	t.Cleanup(mqtt.ResetClient)
+	ctx = mqtt.NewContext(ctx, mqtt.NewMockClient())
 
 	script := `
 		var callCount = 0;
@@ -665,10 +653,7 @@ func TestTimerMultipleWithRuntime(t *testing.T) {
 	ctx = logr.NewContext(ctx, testr.New(t))
 
 	// Add mock MQTT client to context
-	mqtt.ResetClient()
-	mc := mqtt.NewMockClient()
-	mqtt.SetClient(mc)
-	t.Cleanup(mqtt.ResetClient)
+	ctx = mqtt.NewContext(ctx, mqtt.NewMockClient())
 
 	script := `
 		var timer1Count = 0;
@@ -718,10 +703,7 @@ func TestTimerTimingWithRuntime(t *testing.T) {
 	ctx = logr.NewContext(ctx, testr.New(t))
 
 	// Add mock MQTT client to context
-	mqtt.ResetClient()
-	mc := mqtt.NewMockClient()
-	mqtt.SetClient(mc)
-	t.Cleanup(mqtt.ResetClient)
+	ctx = mqtt.NewContext(ctx, mqtt.NewMockClient())
 
 	// Record start time in Go
 	startTime := time.Now()
@@ -779,10 +761,7 @@ func TestTimerRecurringIntervalAccuracyWithRuntime(t *testing.T) {
 	ctx = logr.NewContext(ctx, testr.New(t))
 
 	// Add mock MQTT client to context
-	mqtt.ResetClient()
-	mc := mqtt.NewMockClient()
-	mqtt.SetClient(mc)
-	t.Cleanup(mqtt.ResetClient)
+	ctx = mqtt.NewContext(ctx, mqtt.NewMockClient())
 
 	script := `
 		var startTime = Date.now();
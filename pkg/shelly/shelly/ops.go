@@ -83,6 +83,11 @@ func Init(log logr.Logger, r types.MethodsRegistrar, timeout time.Duration) {
 		HttpMethod: http.MethodPost,
 	})
 
+	r.RegisterMethodHandler(SetAuth.String(), types.MethodHandler{
+		Allocate:   func() any { return nil },
+		HttpMethod: http.MethodPost,
+	})
+
 	// TODO complete the list of handlers
 
 	r.RegisterDeviceCaller(types.ChannelDefault, func(ctx context.Context, d types.Device, mh types.MethodHandler, out any, params any) (any, error) {
@@ -134,6 +139,27 @@ func DoUpdate(ctx context.Context, via types.Channel, d types.Device, stage stri
 	return err
 }
 
+// AuthRequest represents the parameters for Shelly.SetAuth
+type AuthRequest struct {
+	User  string  `json:"user"`
+	Realm string  `json:"realm"`
+	Ha1   *string `json:"ha1"` // nil disables authentication
+}
+
+// DoSetAuth enables authentication on the device with password, or disables
+// it if password is empty. It returns the HA1 digest now expected by the
+// device ("" if disabled).
+func DoSetAuth(ctx context.Context, via types.Channel, d types.Device, password string) (string, error) {
+	req := AuthRequest{User: types.AuthUser, Realm: d.Id()}
+	var ha1 string
+	if password != "" {
+		ha1 = types.AuthHA1(d.Id(), password)
+		req.Ha1 = &ha1
+	}
+	_, err := d.CallE(ctx, via, SetAuth.String(), &req)
+	return ha1, err
+}
+
 func DoReboot(ctx context.Context, d types.Device) error {
 	_, err := d.CallE(ctx, types.ChannelDefault, string(Reboot.String()), nil)
 	return err
@@ -97,6 +97,30 @@ func TestDoReboot(t *testing.T) {
 	}
 }
 
+func TestDoSetAuth(t *testing.T) {
+	d := types.NewFakeDevice()
+	d.IdValue = "shellypro4pm-f008d1d8b8b8"
+	d.SetResult(SetAuth.String(), nil)
+
+	ha1, err := DoSetAuth(context.Background(), types.ChannelDefault, d, "pass")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req, ok := d.Calls[0].Params.(*AuthRequest)
+	if !ok || req.User != "admin" || req.Realm != d.IdValue || req.Ha1 == nil || *req.Ha1 != ha1 || ha1 != types.AuthHA1(d.IdValue, "pass") {
+		t.Errorf("expected AuthRequest with the HA1 of pass, got %+v", d.Calls[0].Params)
+	}
+
+	ha1, err = DoSetAuth(context.Background(), types.ChannelDefault, d, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req, ok = d.Calls[1].Params.(*AuthRequest)
+	if !ok || req.Ha1 != nil || ha1 != "" {
+		t.Errorf("expected AuthRequest clearing ha1, got %+v", d.Calls[1].Params)
+	}
+}
+
 func TestGetDeviceInfo(t *testing.T) {
 	t.Run("happy path", func(t *testing.T) {
 		d := types.NewFakeDevice()
@@ -2,12 +2,19 @@ package shelly
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/asnowfix/home-automation/pkg/shelly/ethernet"
 	"github.com/asnowfix/home-automation/pkg/shelly/mqtt"
 	"github.com/asnowfix/home-automation/pkg/shelly/sswitch"
 	"github.com/asnowfix/home-automation/pkg/shelly/system"
 	"github.com/asnowfix/home-automation/pkg/shelly/wifi"
 	"github.com/asnowfix/home-automation/pkg/shelly/schedule"
+	"github.com/asnowfix/home-automation/pkg/shelly/cover"
+	"github.com/asnowfix/home-automation/pkg/shelly/devicepower"
+	"github.com/asnowfix/home-automation/pkg/shelly/em"
+	"github.com/asnowfix/home-automation/pkg/shelly/light"
+	"github.com/asnowfix/home-automation/pkg/shelly/pm1"
+	"github.com/asnowfix/home-automation/pkg/shelly/virtual"
 )
 
 type Product struct {
@@ -58,15 +65,23 @@ type Config struct {
 	BLE       *any                 `json:"ble,omitempty"`
 	BtHome    *any                 `json:"bthome,omitempty"`
 	Cloud     *any                 `json:"cloud,omitempty"`
+	Cover0    *cover.Config        `json:"cover:0,omitempty"`
+	Cover1    *cover.Config        `json:"cover:1,omitempty"`
+	EM        *em.Config           `json:"em:0,omitempty"`
+	EM1Ch0    *em.EM1Config        `json:"em1:0,omitempty"`
+	EM1Ch1    *em.EM1Config        `json:"em1:1,omitempty"`
 	Ethernet  *ethernet.Config     `json:"eth,omitempty"`
 	Input0    *sswitch.InputConfig `json:"input:0,omitempty"`
 	Input1    *sswitch.InputConfig `json:"input:1,omitempty"`
 	Input2    *sswitch.InputConfig `json:"input:2,omitempty"`
 	Input3    *sswitch.InputConfig `json:"input:3,omitempty"`
 	Knx       *any                 `json:"knx,omitempty"`
+	Light0    *light.Config        `json:"light:0,omitempty"`
+	Light1    *light.Config        `json:"light:1,omitempty"`
 	Matter    *any                 `json:"matter,omitempty"`
 	Mqtt      *mqtt.Config         `json:"mqtt,omitempty"`
 	PlugsUI   *any                 `json:"plugs_ui,omitempty"`
+	PM1       *pm1.Config          `json:"pm1:0,omitempty"`
 	Schedule  *schedule.Scheduled  `json:"schedule,omitempty"`
 	Script1   *ScriptInfo          `json:"script:1,omitempty"`
 	Script2   *ScriptInfo          `json:"script:2,omitempty"`
@@ -86,29 +101,41 @@ type Status struct {
 	Gen1 *map[string]float32 `json:"gen1,omitempty"`
 
 	// gen2+
-	BLE       *any                 `json:"ble,omitempty"`
-	BtHome    *any                 `json:"bthome,omitempty"`
-	Cloud     *any                 `json:"cloud,omitempty"`
-	Ethernet  *ethernet.Status     `json:"eth,omitempty"`
-	Input0    *sswitch.InputStatus `json:"input:0,omitempty"`
-	Input1    *sswitch.InputStatus `json:"input:1,omitempty"`
-	Input2    *sswitch.InputStatus `json:"input:2,omitempty"`
-	Input3    *sswitch.InputStatus `json:"input:3,omitempty"`
-	Knx       *any                 `json:"knx,omitempty"`
-	Matter    *any                 `json:"matter,omitempty"`
-	Mqtt      *mqtt.Status         `json:"mqtt,omitempty"`
-	PlugsUI   *any                 `json:"plugs_ui,omitempty"`
-	Script1   *ScriptInfo          `json:"script:1,omitempty"`
-	Script2   *ScriptInfo          `json:"script:2,omitempty"`
-	Script3   *ScriptInfo          `json:"script:3,omitempty"`
-	Script4   *ScriptInfo          `json:"script:4,omitempty"`
-	Switch0   *sswitch.Status      `json:"switch:0,omitempty"`
-	Switch1   *sswitch.Status      `json:"switch:1,omitempty"`
-	Switch2   *sswitch.Status      `json:"switch:2,omitempty"`
-	Switch3   *sswitch.Status      `json:"switch:3,omitempty"`
-	System    *system.Status       `json:"sys,omitempty"`
-	Wifi      *wifi.Status         `json:"wifi,omitempty"`
-	WebSocket *any                 `json:"ws,omitempty"`
+	BLE         *any                 `json:"ble,omitempty"`
+	BtHome      *any                 `json:"bthome,omitempty"`
+	Cloud       *any                 `json:"cloud,omitempty"`
+	Cover0      *cover.Status        `json:"cover:0,omitempty"`
+	Cover1      *cover.Status        `json:"cover:1,omitempty"`
+	DevicePower *devicepower.Status  `json:"devicepower:0,omitempty"`
+	EM          *em.Status           `json:"em:0,omitempty"`
+	EMData      *em.DataStatus       `json:"emdata:0,omitempty"`
+	EM1Ch0      *em.EM1Status        `json:"em1:0,omitempty"`
+	EM1Ch1      *em.EM1Status        `json:"em1:1,omitempty"`
+	EM1DataCh0  *em.EM1DataStatus    `json:"em1data:0,omitempty"`
+	EM1DataCh1  *em.EM1DataStatus    `json:"em1data:1,omitempty"`
+	Ethernet    *ethernet.Status     `json:"eth,omitempty"`
+	Input0      *sswitch.InputStatus `json:"input:0,omitempty"`
+	Input1      *sswitch.InputStatus `json:"input:1,omitempty"`
+	Input2      *sswitch.InputStatus `json:"input:2,omitempty"`
+	Input3      *sswitch.InputStatus `json:"input:3,omitempty"`
+	Knx         *any                 `json:"knx,omitempty"`
+	Light0      *light.Status        `json:"light:0,omitempty"`
+	Light1      *light.Status        `json:"light:1,omitempty"`
+	Matter      *any                 `json:"matter,omitempty"`
+	Mqtt        *mqtt.Status         `json:"mqtt,omitempty"`
+	PlugsUI     *any                 `json:"plugs_ui,omitempty"`
+	PM1         *pm1.Status          `json:"pm1:0,omitempty"`
+	Script1     *ScriptInfo          `json:"script:1,omitempty"`
+	Script2     *ScriptInfo          `json:"script:2,omitempty"`
+	Script3     *ScriptInfo          `json:"script:3,omitempty"`
+	Script4     *ScriptInfo          `json:"script:4,omitempty"`
+	Switch0     *sswitch.Status      `json:"switch:0,omitempty"`
+	Switch1     *sswitch.Status      `json:"switch:1,omitempty"`
+	Switch2     *sswitch.Status      `json:"switch:2,omitempty"`
+	Switch3     *sswitch.Status      `json:"switch:3,omitempty"`
+	System      *system.Status       `json:"sys,omitempty"`
+	Wifi        *wifi.Status         `json:"wifi,omitempty"`
+	WebSocket   *any                 `json:"ws,omitempty"`
 }
 
 // From https://shelly-api-docs.shelly.cloud/gen2/ComponentsAndServices/Shelly#shellycheckforupdate
@@ -142,6 +169,9 @@ type ComponentsResponse struct {
 	Total          int    `json:"total"`
 	Config         Config `json:"config"`
 	Status         Status `json:"status"`
+	// Virtual lists the virtual (dynamic) components, e.g. boolean:200,
+	// which have no field in Config & Status
+	Virtual []virtual.Component `json:"virtual,omitempty"`
 }
 
 func (cr *ComponentsResponse) UnmarshalJSON(data []byte) error {
@@ -179,7 +209,23 @@ func (cr *ComponentsResponse) UnmarshalJSON(data []byte) error {
 		Config:         make(map[string]*json.RawMessage, len(ra.Components)),
 		Status:         make(map[string]*json.RawMessage, len(ra.Components)),
 	}
+	virtuals := make([]virtual.Component, 0)
 	for _, comp := range ra.Components {
+		if virtual.IsVirtual(comp.Key) {
+			vc := virtual.Component{Key: comp.Key}
+			if comp.Config != nil {
+				if err = json.Unmarshal(*comp.Config, &vc.Config); err != nil {
+					return err
+				}
+			}
+			if comp.Status != nil {
+				if err = json.Unmarshal(*comp.Status, &vc.Status); err != nil {
+					return err
+				}
+			}
+			virtuals = append(virtuals, vc)
+			continue
+		}
 		if comp.Config != nil {
 			rm.Config[comp.Key] = comp.Config
 		}
@@ -199,6 +245,9 @@ func (cr *ComponentsResponse) UnmarshalJSON(data []byte) error {
 	if err = json.Unmarshal(buf, (*alias)(cr)); err != nil {
 		return err
 	}
+	if len(virtuals) > 0 {
+		cr.Virtual = virtuals
+	}
 
 	return nil
 }
@@ -208,3 +257,158 @@ type SwitchSummary struct {
 	Name string `json:"name"`
 	On   bool   `json:"on"`
 }
+
+// CoverSummary is the state of a cover (roller shutter) component.
+type CoverSummary struct {
+	Id       int    `json:"id"`
+	Name     string `json:"name"`
+	State    string `json:"state"`              // One of cover.State*
+	Position *int   `json:"position,omitempty"` // Percent open; nil if not calibrated
+}
+
+// LightSummary is the state of a (dimmable) light component.
+type LightSummary struct {
+	Id         int     `json:"id"`
+	Name       string  `json:"name"`
+	On         bool    `json:"on"`
+	Brightness float32 `json:"brightness"` // Percent
+}
+
+// MeterSummary is the reading of an energy meter component: em (three
+// phases), em1 (one channel of e.g. a Pro EM) or pm1.
+type MeterSummary struct {
+	Key    string   `json:"key"` // Component key, e.g. em1:0
+	Name   string   `json:"name"`
+	Power  float32  `json:"power"`            // Active power in Watts
+	Energy *float32 `json:"energy,omitempty"` // Active energy consumed in Watt-hours, if reported
+}
+
+// CoverSummaries returns the covers found in status, named after config
+// (which may be nil).
+func CoverSummaries(config *Config, status *Status) map[int]CoverSummary {
+	covers := make(map[int]CoverSummary)
+	if status == nil {
+		return covers
+	}
+	var configs [2]*cover.Config
+	if config != nil {
+		configs = [2]*cover.Config{config.Cover0, config.Cover1}
+	}
+	for i, s := range []*cover.Status{status.Cover0, status.Cover1} {
+		if s == nil {
+			continue
+		}
+		var name *string
+		if configs[i] != nil {
+			name = configs[i].Name
+		}
+		covers[s.Id] = CoverSummary{
+			Id:       s.Id,
+			Name:     componentName(name, "cover", s.Id),
+			State:    s.State,
+			Position: s.CurrentPos,
+		}
+	}
+	return covers
+}
+
+// LightSummaries returns the lights found in status, named after config
+// (which may be nil).
+func LightSummaries(config *Config, status *Status) map[int]LightSummary {
+	lights := make(map[int]LightSummary)
+	if status == nil {
+		return lights
+	}
+	var configs [2]*light.Config
+	if config != nil {
+		configs = [2]*light.Config{config.Light0, config.Light1}
+	}
+	for i, s := range []*light.Status{status.Light0, status.Light1} {
+		if s == nil {
+			continue
+		}
+		var name *string
+		if configs[i] != nil {
+			name = configs[i].Name
+		}
+		lights[s.Id] = LightSummary{
+			Id:         s.Id,
+			Name:       componentName(name, "light", s.Id),
+			On:         s.Output,
+			Brightness: s.Brightness,
+		}
+	}
+	return lights
+}
+
+// MeterSummaries returns the energy meters found in status, in component
+// order, named after config (which may be nil).
+func MeterSummaries(config *Config, status *Status) []MeterSummary {
+	var meters []MeterSummary
+	if status == nil {
+		return meters
+	}
+	if config == nil {
+		config = &Config{}
+	}
+	if s := status.EM; s != nil {
+		var name *string
+		if config.EM != nil {
+			name = config.EM.Name
+		}
+		m := MeterSummary{
+			Key:   fmt.Sprintf("em:%d", s.Id),
+			Name:  componentName(name, "em", s.Id),
+			Power: s.TotalActPower,
+		}
+		if status.EMData != nil {
+			m.Energy = &status.EMData.TotalAct
+		}
+		meters = append(meters, m)
+	}
+	em1Configs := []*em.EM1Config{config.EM1Ch0, config.EM1Ch1}
+	em1Data := []*em.EM1DataStatus{status.EM1DataCh0, status.EM1DataCh1}
+	for i, s := range []*em.EM1Status{status.EM1Ch0, status.EM1Ch1} {
+		if s == nil {
+			continue
+		}
+		var name *string
+		if em1Configs[i] != nil {
+			name = em1Configs[i].Name
+		}
+		m := MeterSummary{
+			Key:   fmt.Sprintf("em1:%d", s.Id),
+			Name:  componentName(name, "em1", s.Id),
+			Power: s.ActPower,
+		}
+		if em1Data[i] != nil {
+			m.Energy = &em1Data[i].TotalActEnergy
+		}
+		meters = append(meters, m)
+	}
+	if s := status.PM1; s != nil {
+		var name *string
+		if config.PM1 != nil {
+			name = config.PM1.Name
+		}
+		m := MeterSummary{
+			Key:   fmt.Sprintf("pm1:%d", s.Id),
+			Name:  componentName(name, "pm1", s.Id),
+			Power: s.Apower,
+		}
+		if s.Aenergy != nil {
+			m.Energy = &s.Aenergy.Total
+		}
+		meters = append(meters, m)
+	}
+	return meters
+}
+
+// componentName returns the configured name of a component if set, or its
+// key otherwise.
+func componentName(name *string, kind string, id int) string {
+	if name != nil && *name != "" {
+		return *name
+	}
+	return fmt.Sprintf("%s:%d", kind, id)
+}
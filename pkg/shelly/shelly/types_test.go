@@ -0,0 +1,73 @@
+package shelly
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestComponentsResponse_UnmarshalVirtual(t *testing.T) {
+	payload := `{"components":[
+		{"key":"switch:0","config":{"id":0,"name":"Pump"},"status":{"id":0,"output":true}},
+		{"key":"number:200","config":{"id":200,"name":"Eco speed","min":0,"max":2},"status":{"value":2,"source":"rpc"}},
+		{"key":"boolean:201","status":{"value":false}}
+	],"cfg_rev":12,"offset":0,"total":3}`
+
+	var cr ComponentsResponse
+	if err := json.Unmarshal([]byte(payload), &cr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cr.Total != 3 || cr.Config.Switch0 == nil || cr.Config.Switch0.Name != "Pump" {
+		t.Errorf("unexpected static components %+v", cr)
+	}
+	if len(cr.Virtual) != 2 {
+		t.Fatalf("expected 2 virtual components, got %+v", cr.Virtual)
+	}
+	n := cr.Virtual[0]
+	if n.Key != "number:200" || n.Config == nil || *n.Config.Name != "Eco speed" || *n.Config.Max != 2 || n.Status.Value != float64(2) {
+		t.Errorf("unexpected number:200 %+v", n)
+	}
+	b := cr.Virtual[1]
+	if b.Key != "boolean:201" || b.Config != nil || b.Status.Value != false {
+		t.Errorf("unexpected boolean:201 %+v", b)
+	}
+}
+
+func TestSummaries_ProEMAndCover(t *testing.T) {
+	payload := `{
+		"config":{"em1:0":{"id":0,"name":"Heat pump"},"cover:0":{"id":0,"name":"Kitchen"}},
+		"status":{
+			"em1:0":{"id":0,"act_power":1200.5,"voltage":231},
+			"em1:1":{"id":1,"act_power":-300},
+			"em1data:0":{"id":0,"total_act_energy":4200},
+			"cover:0":{"id":0,"state":"stopped","current_pos":40},
+			"light:0":{"id":0,"output":true,"brightness":60}
+		}}`
+	var both struct {
+		Config Config `json:"config"`
+		Status Status `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(payload), &both); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	meters := MeterSummaries(&both.Config, &both.Status)
+	if len(meters) != 2 {
+		t.Fatalf("expected 2 meters, got %+v", meters)
+	}
+	if m := meters[0]; m.Key != "em1:0" || m.Name != "Heat pump" || m.Power != 1200.5 || m.Energy == nil || *m.Energy != 4200 {
+		t.Errorf("unexpected em1:0 %+v", m)
+	}
+	if m := meters[1]; m.Key != "em1:1" || m.Name != "em1:1" || m.Power != -300 || m.Energy != nil {
+		t.Errorf("unexpected em1:1 %+v", m)
+	}
+
+	covers := CoverSummaries(&both.Config, &both.Status)
+	if c := covers[0]; c.Name != "Kitchen" || c.State != "stopped" || c.Position == nil || *c.Position != 40 {
+		t.Errorf("unexpected cover:0 %+v", c)
+	}
+
+	lights := LightSummaries(nil, &both.Status)
+	if l := lights[0]; len(lights) != 1 || l.Name != "light:0" || !l.On || l.Brightness != 60 {
+		t.Errorf("unexpected lights %+v", lights)
+	}
+}
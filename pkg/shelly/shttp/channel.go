@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -11,6 +12,7 @@ import (
 	"net/url"
 	"github.com/asnowfix/home-automation/pkg/shelly/types"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -18,10 +20,32 @@ import (
 
 // <https://shelly-api-docs.shelly.cloud/gen2/General/RPCChannels#http>
 
+// HttpChannel calls devices over HTTP, answering the digest challenge of
+// those with authentication enabled with its credentials provider.
 type HttpChannel struct {
+	credentialsMutex sync.RWMutex
+	credentials      types.CredentialsProvider
 }
 
-var httpChannel HttpChannel
+// SetCredentialsProvider installs the CredentialsProvider used to answer
+// devices' authentication challenges. nil (the default) leaves protected
+// devices unreachable over HTTP.
+func (ch *HttpChannel) SetCredentialsProvider(p types.CredentialsProvider) {
+	ch.credentialsMutex.Lock()
+	defer ch.credentialsMutex.Unlock()
+	ch.credentials = p
+}
+
+// deviceHA1 calls the installed CredentialsProvider, if any.
+func (ch *HttpChannel) deviceHA1(ctx context.Context, realm string) (ha1 string, ok bool) {
+	ch.credentialsMutex.RLock()
+	p := ch.credentials
+	ch.credentialsMutex.RUnlock()
+	if p == nil {
+		return "", false
+	}
+	return p.HA1(ctx, realm)
+}
 
 // formatHost normalizes a device host for use in an RPC URL. host may be a
 // bare IPv4/IPv6 address, a hostname, or any of those with an explicit
@@ -56,13 +80,17 @@ func (ch *HttpChannel) callE(ctx context.Context, device types.Device, verb type
 	}
 
 	res, err = dial()
+	if errors.Is(err, ErrUnauthorized) {
+		// The device is reachable: re-resolving its host would not help
+		log.Error(err, "HTTP authentication failed", "device_id", device.Id())
+		return nil, err
+	}
 	if err != nil {
 		log.Error(err, "HTTP error - re-resolving host before falling back to MQTT", "device_id", device.Id())
 		device.ClearHost()
 
-		if ip, ok := types.ResolveHost(ctx, device.Mac(), device.Id()); ok {
-			log.Info("Re-resolved host, retrying once", "device_id", device.Id(), "ip", ip.String())
-			device.UpdateHost(ip.String())
+		if device.ResolveHost(ctx) {
+			log.Info("Re-resolved host, retrying once", "device_id", device.Id(), "host", device.Host())
 			res, err = dial()
 		}
 
@@ -121,7 +149,7 @@ func (ch *HttpChannel) getE(ctx context.Context, host string, cmd string, params
 		return nil, err
 	}
 
-	res, err := doWithRetry(ctx, http.DefaultClient, req, 4, 200*time.Millisecond, 3*time.Second, log)
+	res, err := ch.do(ctx, req, log)
 	if err != nil {
 		log.Error(err, "HTTP GET error")
 		return nil, err
@@ -195,7 +223,7 @@ func (ch *HttpChannel) postE(ctx context.Context, host string, hm string, cmd st
 	}
 
 	log.Info("Calling", "method", hm, "url", requestURL)
-	res, err := doWithRetry(ctx, http.DefaultClient, req, 4, 200*time.Millisecond, 3*time.Second, log)
+	res, err := ch.do(ctx, req, log)
 	if err != nil {
 		log.Error(err, "HTTP error")
 		return nil, err
@@ -211,6 +239,48 @@ func (ch *HttpChannel) postE(ctx context.Context, host string, hm string, cmd st
 	return res, err
 }
 
+// do sends req, answering the device's digest challenge if it requires
+// authentication.
+func (ch *HttpChannel) do(ctx context.Context, req *http.Request, log logr.Logger) (*http.Response, error) {
+	res, err := doWithRetry(ctx, http.DefaultClient, req, 4, 200*time.Millisecond, 3*time.Second, log)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+	res.Body.Close()
+
+	c, err := parseChallenge(res.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+	ha1, ok := ch.deviceHA1(ctx, c.realm)
+	if !ok {
+		return nil, fmt.Errorf("%w: no credentials for %s (set MYHOME_SHELLY_PASSWORDS)", ErrUnauthorized, c.realm)
+	}
+	authorization, err := c.authorization(req.Method, req.URL.RequestURI(), ha1)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	req.Header.Set("Authorization", authorization)
+	log.V(1).Info("Answering digest challenge", "realm", c.realm)
+	res, err = doWithRetry(ctx, http.DefaultClient, req, 4, 200*time.Millisecond, 3*time.Second, log)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		res.Body.Close()
+		return nil, fmt.Errorf("%w: wrong credentials for %s", ErrUnauthorized, c.realm)
+	}
+	return res, nil
+}
+
 // doWithRetry performs an HTTP request with simple exponential backoff retries.
 // It retries on transport errors, 5xx, and 429, honoring Retry-After when present.
 func doWithRetry(ctx context.Context, client *http.Client, req *http.Request, maxRetries int, baseDelay, maxDelay time.Duration, log logr.Logger) (*http.Response, error) {
@@ -3,9 +3,10 @@ package http
 import (
 	"context"
 	"encoding/json"
-	"net"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/asnowfix/home-automation/pkg/shelly/types"
@@ -13,12 +14,7 @@ import (
 	"github.com/go-logr/logr"
 )
 
-// fakeResolverFunc adapts a plain func to types.HostResolver for tests.
-type fakeResolverFunc func(ctx context.Context, mac net.HardwareAddr, name string) (net.IP, error)
-
-func (f fakeResolverFunc) ResolveHost(ctx context.Context, mac net.HardwareAddr, name string) (net.IP, error) {
-	return f(ctx, mac, name)
-}
+const authDevice = "shellyplus1pm-aabbccddeeff"
 
 func withLogger(ctx context.Context) context.Context {
 	return logr.NewContext(ctx, logr.Discard())
@@ -28,8 +24,6 @@ func withLogger(ctx context.Context) context.Context {
 // unaffected by the retry-on-failure logic: a device whose Host is already
 // dialable gets called once, no resolver involved.
 func TestCallE_SucceedsWithoutResolution(t *testing.T) {
-	t.Cleanup(func() { types.SetHostResolver(nil) })
-
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]any{"ok": true})
 	}))
@@ -42,7 +36,7 @@ func TestCallE_SucceedsWithoutResolution(t *testing.T) {
 	verb := types.MethodHandler{Method: "Shelly.GetStatus", HttpMethod: http.MethodGet}
 	out := map[string]any{}
 
-	_, err := httpChannel.callE(withLogger(context.Background()), device, verb, &out, nil)
+	_, err := new(HttpChannel).callE(withLogger(context.Background()), device, verb, &out, nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -52,20 +46,17 @@ func TestCallE_SucceedsWithoutResolution(t *testing.T) {
 }
 
 // TestCallE_RetriesOnceAfterReResolution verifies that on a dial failure,
-// callE clears the stale host, asks the installed resolver exactly once,
+// callE clears the stale host, asks the device's resolver exactly once,
 // updates the host with what it returns, and retries — and that if the
 // retry also fails, the host ends up cleared again.
 func TestCallE_RetriesOnceAfterReResolution(t *testing.T) {
-	t.Cleanup(func() { types.SetHostResolver(nil) })
-
 	resolveCalls := 0
-	types.SetHostResolver(fakeResolverFunc(func(ctx context.Context, mac net.HardwareAddr, name string) (net.IP, error) {
-		resolveCalls++
-		return net.ParseIP("127.0.0.1"), nil
-	}))
-
 	device := types.NewFakeDevice()
 	device.IdValue = "shellyplus1pm-aabbccddeeff"
+	device.ResolveHostFunc = func(ctx context.Context) (string, bool) {
+		resolveCalls++
+		return "127.0.0.1", true
+	}
 	// Port 1 is reserved/unassigned: connection is refused immediately on
 	// both the first attempt and the retry (the resolver only returns a bare
 	// IP, so the retry dials it on the default port-less host string, which
@@ -76,7 +67,7 @@ func TestCallE_RetriesOnceAfterReResolution(t *testing.T) {
 	verb := types.MethodHandler{Method: "Shelly.GetStatus", HttpMethod: http.MethodGet}
 	out := map[string]any{}
 
-	_, err := httpChannel.callE(withLogger(context.Background()), device, verb, &out, nil)
+	_, err := new(HttpChannel).callE(withLogger(context.Background()), device, verb, &out, nil)
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -90,11 +81,8 @@ func TestCallE_RetriesOnceAfterReResolution(t *testing.T) {
 
 // TestCallE_NoResolverClearsHostOnFailure verifies the pre-existing behavior
 // (clear host, give the caller an error to fall back to MQTT) is preserved
-// when no resolver is installed.
+// when the device has no resolver.
 func TestCallE_NoResolverClearsHostOnFailure(t *testing.T) {
-	t.Cleanup(func() { types.SetHostResolver(nil) })
-	types.SetHostResolver(nil)
-
 	device := types.NewFakeDevice()
 	device.IdValue = "shellyplus1pm-aabbccddeeff"
 	device.HostValue = "127.0.0.1:1"
@@ -102,7 +90,7 @@ func TestCallE_NoResolverClearsHostOnFailure(t *testing.T) {
 	verb := types.MethodHandler{Method: "Shelly.GetStatus", HttpMethod: http.MethodGet}
 	out := map[string]any{}
 
-	_, err := httpChannel.callE(withLogger(context.Background()), device, verb, &out, nil)
+	_, err := new(HttpChannel).callE(withLogger(context.Background()), device, verb, &out, nil)
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -110,3 +98,102 @@ func TestCallE_NoResolverClearsHostOnFailure(t *testing.T) {
 		t.Errorf("expected host to be cleared, got %q", device.Host())
 	}
 }
+
+// digestServer serves Shelly RPCs like a device with authentication
+// enabled with password: it challenges every request without a valid
+// SHA-256 digest Authorization, and echoes the request body otherwise.
+func digestServer(t *testing.T, password string) *httptest.Server {
+	t.Helper()
+	const nonce = "1700000000"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := map[string]string{}
+		if scheme, rest, _ := strings.Cut(r.Header.Get("Authorization"), " "); scheme == "Digest" {
+			for _, p := range splitParams(rest) {
+				k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+				params[k] = strings.Trim(v, `"`)
+			}
+		}
+		ha1 := types.AuthHA1(authDevice, password)
+		ha2 := sha256Hex(r.Method + ":" + r.URL.RequestURI())
+		want := sha256Hex(ha1 + ":" + nonce + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+		if params["username"] != "admin" || params["realm"] != authDevice || params["uri"] != r.URL.RequestURI() || params["response"] != want {
+			w.Header().Set("WWW-Authenticate", `Digest qop="auth", realm="`+authDevice+`", nonce="`+nonce+`", algorithm=SHA-256`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		json.NewEncoder(w).Encode(map[string]any{"body": body})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestCallE_AnswersDigestChallenge verifies that a device with
+// authentication enabled is called with the credentials of the installed
+// provider, body included.
+func TestCallE_AnswersDigestChallenge(t *testing.T) {
+	ch := &HttpChannel{}
+	ch.SetCredentialsProvider(types.Passwords{authDevice: "s3cret:pw"})
+	srv := digestServer(t, "s3cret:pw")
+
+	device := types.NewFakeDevice()
+	device.IdValue = authDevice
+	device.HostValue = srv.Listener.Addr().String()
+
+	verb := types.MethodHandler{Method: "Switch.Set", HttpMethod: http.MethodPost}
+	out := map[string]any{}
+	_, err := ch.callE(withLogger(context.Background()), device, verb, &out, map[string]any{"id": 0, "on": true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body, _ := out["body"].(map[string]any); body["on"] != true {
+		t.Errorf("expected the request body to be replayed, got %v", out)
+	}
+}
+
+// TestCallE_Unauthorized verifies that missing or wrong credentials fail
+// with ErrUnauthorized, leaving the (reachable) device host alone.
+func TestCallE_Unauthorized(t *testing.T) {
+	srv := digestServer(t, "s3cret")
+
+	for name, provider := range map[string]types.CredentialsProvider{
+		"none":  nil,
+		"wrong": types.Passwords{"*": "guess"},
+	} {
+		ch := &HttpChannel{}
+		ch.SetCredentialsProvider(provider)
+		device := types.NewFakeDevice()
+		device.IdValue = authDevice
+		device.HostValue = srv.Listener.Addr().String()
+
+		verb := types.MethodHandler{Method: "Shelly.GetStatus", HttpMethod: http.MethodGet}
+		out := map[string]any{}
+		_, err := ch.callE(withLogger(context.Background()), device, verb, &out, nil)
+		if !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("%s: expected ErrUnauthorized, got %v", name, err)
+		}
+		if device.Host() != srv.Listener.Addr().String() {
+			t.Errorf("%s: host should be unchanged, got %q", name, device.Host())
+		}
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	c, err := parseChallenge(`Digest qop="auth", realm="shellypro4pm-f008d1d8b8b8", nonce="60dc59c6", algorithm=SHA-256`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.realm != "shellypro4pm-f008d1d8b8b8" || c.nonce != "60dc59c6" || c.qop != "auth" {
+		t.Errorf("unexpected challenge %+v", c)
+	}
+	for _, header := range []string{
+		`Basic realm="x"`,
+		`Digest realm="x", nonce="1", algorithm=MD5`,
+		`Digest nonce="1"`,
+	} {
+		if _, err := parseChallenge(header); err == nil {
+			t.Errorf("%s: expected an error", header)
+		}
+	}
+}
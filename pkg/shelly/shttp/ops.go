@@ -23,7 +23,9 @@ const (
 	Post Verb = "HTTP.POST"
 )
 
-func Init(log logr.Logger, r types.MethodsRegistrar) {
+// Init registers the HTTP methods and a new HTTP channel to r, and returns
+// the channel for its SetCredentialsProvider.
+func Init(log logr.Logger, r types.MethodsRegistrar) *HttpChannel {
 	log.Info("Init", "package", reflect.TypeOf(empty{}).PkgPath())
 
 	// register methods
@@ -37,5 +39,7 @@ func Init(log logr.Logger, r types.MethodsRegistrar) {
 	})
 
 	// register channel
-	r.RegisterDeviceCaller(types.ChannelHttp, types.DeviceCaller(httpChannel.callE))
+	ch := &HttpChannel{}
+	r.RegisterDeviceCaller(types.ChannelHttp, types.DeviceCaller(ch.callE))
+	return ch
 }
@@ -37,7 +37,7 @@ func Init(l logr.Logger, r types.MethodsRegistrar) {
 		HttpMethod: http.MethodGet,
 	})
 	r.RegisterMethodHandler(setConfig.String(), types.MethodHandler{
-		Allocate:   func() any { return new(Config) },
+		Allocate:   func() any { return new(ConfigurationResponse) },
 		HttpMethod: http.MethodPost,
 	})
 	r.RegisterMethodHandler(getStatus.String(), types.MethodHandler{
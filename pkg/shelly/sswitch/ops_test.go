@@ -0,0 +1,61 @@
+package sswitch
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+// registrar records the method handlers registered by Init.
+type registrar struct {
+	handlers map[string]types.MethodHandler
+}
+
+func (r *registrar) RegisterMethodHandler(method string, mh types.MethodHandler) {
+	r.handlers[method] = mh
+}
+
+func (r *registrar) RegisterDeviceCaller(ch types.Channel, dc types.DeviceCaller) {}
+
+func (r *registrar) CallE(ctx context.Context, d types.Device, ch types.Channel, mh types.MethodHandler, params any) (any, error) {
+	return nil, nil
+}
+
+func TestInit_SetConfigAllocatesResponse(t *testing.T) {
+	r := &registrar{handlers: make(map[string]types.MethodHandler)}
+	Init(logr.Discard(), r)
+
+	mh, ok := r.handlers[setConfig.String()]
+	if !ok {
+		t.Fatalf("%s not registered", setConfig)
+	}
+	out := mh.Allocate()
+	res, ok := out.(*ConfigurationResponse)
+	if !ok {
+		t.Fatalf("%s allocates %T, want *ConfigurationResponse", setConfig, out)
+	}
+	if err := json.Unmarshal([]byte(`{"restart_required":true}`), res); err != nil || !res.RestartRequired {
+		t.Errorf("unexpected %+v (err=%v)", res, err)
+	}
+}
+
+func TestSetConfig(t *testing.T) {
+	d := types.NewFakeDevice()
+	d.SetResult(setConfig.String(), &ConfigurationResponse{RestartRequired: true})
+
+	res, err := SetConfig(context.Background(), d, types.ChannelDefault, 1, &Config{Id: 1, Name: "Pump"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.RestartRequired {
+		t.Errorf("unexpected %+v", res)
+	}
+	req, ok := d.Calls[0].Params.(*ConfigurationRequest)
+	if !ok || req.Id != 1 || req.Configuration.Name != "Pump" {
+		t.Errorf("unexpected Switch.SetConfig params %#v", d.Calls[0].Params)
+	}
+}
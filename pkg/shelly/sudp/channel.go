@@ -0,0 +1,249 @@
+package udp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+// <https://shelly-api-docs.shelly.cloud/gen2/General/RPCChannels#udp>
+//
+// A Gen2+ device listens for JSON-RPC requests on the UDP port set with
+// Sys.SetConfig rpc_udp.listen_port, and replies to the address the request
+// came from. All calls share one local socket: replies are matched to their
+// pending call by request id. Devices do not deduplicate request ids: a
+// re-sent request runs again. Only read-only requests (see idempotent) are
+// therefore re-sent when they get no reply; any other is sent once, and
+// times out if either the request or its reply is lost.
+
+// DefaultRetries is the number of times a read-only request is re-sent
+// before its call times out.
+const DefaultRetries = 2
+
+// maxDatagram is the largest UDP payload: responses such as
+// Shelly.GetConfig do not fit in a single Ethernet frame.
+const maxDatagram = 65535
+
+// src is the source of requests, as seen by devices.
+const src = "myhome"
+
+type UdpChannel struct {
+	log     logr.Logger
+	port    uint16
+	timeout time.Duration
+	retries int
+
+	mutex   sync.Mutex
+	conn    *net.UDPConn
+	nextId  uint32
+	pending map[uint32]chan *reply
+}
+
+type reply struct {
+	payload []byte
+	from    *net.UDPAddr
+}
+
+func (ch *UdpChannel) Init(log logr.Logger, port uint16, timeout time.Duration, retries int) {
+	ch.log = log.WithName("shelly.UdpChannel")
+	ch.port = port
+	ch.timeout = timeout
+	ch.retries = retries
+}
+
+// addr returns the UDP address of device: its host, on the port it carries
+// or else the channel's.
+func (ch *UdpChannel) addr(device types.Device) (*net.UDPAddr, error) {
+	host := device.Host()
+	if host == "" {
+		return nil, fmt.Errorf("no known host for %s (%s)", device.Id(), device.Name())
+	}
+	port := strconv.Itoa(int(ch.port))
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host, port = h, p
+	} else if ch.port == 0 {
+		return nil, fmt.Errorf("no UDP RPC port for %s: set the device's rpc_udp.listen_port and --udp-port", device.Id())
+	}
+	return net.ResolveUDPAddr("udp", net.JoinHostPort(host, port))
+}
+
+// open returns the shared socket, opening it and starting its reader on
+// first use.
+func (ch *UdpChannel) open() (*net.UDPConn, error) {
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+	if ch.conn != nil {
+		return ch.conn, nil
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	ch.conn = conn
+	ch.pending = make(map[uint32]chan *reply)
+	go ch.read(conn)
+	return conn, nil
+}
+
+// Close closes the shared socket, failing the pending calls. The next call
+// opens a new one.
+func (ch *UdpChannel) Close() error {
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+	if ch.conn == nil {
+		return nil
+	}
+	err := ch.conn.Close()
+	ch.conn = nil
+	return err
+}
+
+// read dispatches the datagrams received on conn to their pending call,
+// until conn is closed.
+func (ch *UdpChannel) read(conn *net.UDPConn) {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				ch.log.Error(err, "UDP read error, closing channel socket")
+				conn.Close()
+			}
+			ch.mutex.Lock()
+			if ch.conn == conn || ch.conn == nil { // Not replaced by a new socket yet
+				for id, c := range ch.pending {
+					close(c)
+					delete(ch.pending, id)
+				}
+				ch.conn = nil
+			}
+			ch.mutex.Unlock()
+			return
+		}
+		var dialog struct {
+			Id uint32 `json:"id"`
+		}
+		if err := json.Unmarshal(buf[:n], &dialog); err != nil {
+			ch.log.V(1).Info("Ignoring non-JSON datagram", "from", from, "error", err)
+			continue
+		}
+		ch.mutex.Lock()
+		c, ok := ch.pending[dialog.Id]
+		ch.mutex.Unlock()
+		if !ok {
+			// Reply to a retried request already answered, or to a call
+			// that timed out
+			ch.log.V(1).Info("Ignoring unexpected response", "id", dialog.Id, "from", from)
+			continue
+		}
+		select {
+		case c <- &reply{payload: append([]byte(nil), buf[:n]...), from: from}:
+		default: // Duplicate reply
+		}
+	}
+}
+
+// startDialog registers a new pending call, and returns its request id.
+func (ch *UdpChannel) startDialog() (uint32, chan *reply) {
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+	ch.nextId++
+	c := make(chan *reply, 1)
+	ch.pending[ch.nextId] = c
+	return ch.nextId, c
+}
+
+func (ch *UdpChannel) stopDialog(id uint32) {
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+	delete(ch.pending, id)
+}
+
+func (ch *UdpChannel) callE(ctx context.Context, device types.Device, verb types.MethodHandler, out any, params any) (any, error) {
+	log := logr.FromContextOrDiscard(ctx).WithName("shelly.UdpChannel")
+
+	addr, err := ch.addr(device)
+	if err != nil {
+		log.Error(err, "Unable to address device", "device_id", device.Id())
+		return nil, err
+	}
+	conn, err := ch.open()
+	if err != nil {
+		log.Error(err, "Unable to open UDP socket")
+		return nil, err
+	}
+
+	id, replies := ch.startDialog()
+	defer ch.stopDialog(id)
+	payload, err := json.Marshal(Request{Id: id, Src: src, Method: verb.Method, Params: params})
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(ch.timeout)
+	attempts := 1
+	if idempotent(verb.Method) {
+		attempts += ch.retries
+	}
+	for attempt := 1; ; attempt++ {
+		log.V(1).Info("Calling", "device_id", device.Id(), "addr", addr, "method", verb.Method, "id", id, "attempt", attempt)
+		if _, err := conn.WriteToUDP(payload, addr); err != nil {
+			log.Error(err, "UDP write error", "device_id", device.Id(), "addr", addr)
+			return nil, err
+		}
+
+		// Spread the attempts over what is left of the timeout
+		wait := time.Until(deadline) / time.Duration(attempts-attempt+1)
+		timer := time.NewTimer(wait)
+		select {
+		case r, ok := <-replies:
+			timer.Stop()
+			if !ok {
+				return nil, fmt.Errorf("UDP channel closed while waiting for response from %s (%s)", device.Id(), device.Name())
+			}
+			return ch.decode(device, verb, r, out)
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("context cancelled while waiting for response from %s (%s): %w", device.Id(), device.Name(), ctx.Err())
+		case <-timer.C:
+		}
+		if attempt == attempts {
+			err := fmt.Errorf("timeout waiting for response from %s (%s) after %d attempts", device.Id(), device.Name(), attempts)
+			log.Error(err, "Timeout waiting for device response", "method", verb.Method, "addr", addr, "timeout", ch.timeout)
+			return nil, err
+		}
+	}
+}
+
+// idempotent reports whether method only reads device state (Get*, List*),
+// so that running it twice is harmless.
+func idempotent(method string) bool {
+	_, name, _ := strings.Cut(method, ".")
+	return strings.HasPrefix(name, "Get") || strings.HasPrefix(name, "List")
+}
+
+func (ch *UdpChannel) decode(device types.Device, verb types.MethodHandler, r *reply, out any) (any, error) {
+	var res Response
+	res.Result = &out
+	if err := json.Unmarshal(r.payload, &res); err != nil {
+		ch.log.Error(err, "Unable to unmarshal response", "payload", string(r.payload))
+		return nil, err
+	}
+	if res.Src != "" && device.Id() != "" && res.Src != device.Id() {
+		return nil, fmt.Errorf("response to %s from %s (%s), expected %s", verb.Method, res.Src, r.from, device.Id())
+	}
+	if res.Error != nil {
+		return nil, fmt.Errorf("device replied error '%v' (code:%v) to request '%v'", res.Error.Message, res.Error.Code, verb.Method)
+	}
+	return out, nil
+}
@@ -0,0 +1,197 @@
+package udp
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+const device0 = "shellypro3-aabbccddeeff"
+
+func withLogger(ctx context.Context) context.Context {
+	return logr.NewContext(ctx, logr.Discard())
+}
+
+// fakeDevice listens like a device's rpc_udp.listen_port, and answers each
+// request it is handed with reply (no answer if reply returns nil).
+func fakeDevice(t *testing.T, reply func(n int, req Request) []any) *types.FakeDevice {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, maxDatagram)
+		for n := 1; ; n++ {
+			size, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			var req Request
+			if err := json.Unmarshal(buf[:size], &req); err != nil {
+				continue
+			}
+			for _, res := range reply(n, req) {
+				b, _ := json.Marshal(res)
+				conn.WriteToUDP(b, from)
+			}
+		}
+	}()
+
+	device := types.NewFakeDevice()
+	device.IdValue = device0
+	device.HostValue = conn.LocalAddr().String()
+	return device
+}
+
+func newChannel(t *testing.T, timeout time.Duration) *UdpChannel {
+	t.Helper()
+	var ch UdpChannel
+	ch.Init(logr.Discard(), 0, timeout, DefaultRetries)
+	t.Cleanup(func() { ch.Close() })
+	return &ch
+}
+
+func result(req Request, v any) map[string]any {
+	return map[string]any{"id": req.Id, "src": device0, "dst": req.Src, "result": v}
+}
+
+// TestCallE_IgnoresOtherIds verifies that replies are matched to their call
+// by request id: a stray reply to another id is not taken for the answer.
+func TestCallE_IgnoresOtherIds(t *testing.T) {
+	device := fakeDevice(t, func(n int, req Request) []any {
+		return []any{result(Request{Id: req.Id + 100}, "stray"), result(req, map[string]any{"method": req.Method})}
+	})
+	ch := newChannel(t, 2*time.Second)
+
+	out := map[string]any{}
+	res, err := ch.callE(withLogger(context.Background()), device, types.MethodHandler{Method: "Shelly.GetStatus"}, &out, nil)
+	if err != nil {
+		t.Fatalf("callE: %v", err)
+	}
+	if got := (*res.(*map[string]any))["method"]; got != "Shelly.GetStatus" {
+		t.Errorf("result: got %v, want the echoed method", got)
+	}
+}
+
+// TestCallE_RetriesLostRequests verifies that an unanswered read-only
+// request is re-sent with the same id until the device answers.
+func TestCallE_RetriesLostRequests(t *testing.T) {
+	var mutex sync.Mutex
+	var ids []uint32
+	device := fakeDevice(t, func(n int, req Request) []any {
+		mutex.Lock()
+		defer mutex.Unlock()
+		ids = append(ids, req.Id)
+		if n < 3 {
+			return nil // Lost
+		}
+		return []any{result(req, true)}
+	})
+	ch := newChannel(t, 3*time.Second)
+
+	var out any
+	if _, err := ch.callE(withLogger(context.Background()), device, types.MethodHandler{Method: "Switch.GetStatus"}, &out, nil); err != nil {
+		t.Fatalf("callE: %v", err)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(ids) != 3 || ids[0] != ids[1] || ids[1] != ids[2] {
+		t.Errorf("request ids: got %v, want 3 sends of the same id", ids)
+	}
+}
+
+// TestCallE_SendsActionsOnce verifies that a request changing device state
+// is never re-sent: the device would run it again.
+func TestCallE_SendsActionsOnce(t *testing.T) {
+	var mutex sync.Mutex
+	sent := 0
+	device := fakeDevice(t, func(n int, req Request) []any {
+		mutex.Lock()
+		defer mutex.Unlock()
+		sent++
+		return nil // Reply lost
+	})
+	ch := newChannel(t, 300*time.Millisecond)
+
+	var out any
+	if _, err := ch.callE(withLogger(context.Background()), device, types.MethodHandler{Method: "Switch.Toggle"}, &out, nil); err == nil {
+		t.Fatal("callE: got no error, want a timeout")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if sent != 1 {
+		t.Errorf("Switch.Toggle sent %d times, want once", sent)
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	for method, want := range map[string]bool{
+		"Shelly.GetStatus":   true,
+		"Switch.GetConfig":   true,
+		"Shelly.ListMethods": true,
+		"Script.List":        true,
+		"Switch.Set":         false,
+		"Switch.Toggle":      false,
+		"Shelly.Reboot":      false,
+		"Script.PutCode":     false,
+	} {
+		if got := idempotent(method); got != want {
+			t.Errorf("idempotent(%q) = %v, want %v", method, got, want)
+		}
+	}
+}
+
+// TestCallE_TimesOut verifies that a silent device fails the call once the
+// channel timeout elapsed, retries included.
+func TestCallE_TimesOut(t *testing.T) {
+	device := fakeDevice(t, func(n int, req Request) []any { return nil })
+	ch := newChannel(t, 300*time.Millisecond)
+
+	start := time.Now()
+	var out any
+	_, err := ch.callE(withLogger(context.Background()), device, types.MethodHandler{Method: "Shelly.GetStatus"}, &out, nil)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("callE: got %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("timed out after %v, want about 300ms", elapsed)
+	}
+}
+
+// TestCallE_DeviceError verifies that an error frame fails the call.
+func TestCallE_DeviceError(t *testing.T) {
+	device := fakeDevice(t, func(n int, req Request) []any {
+		return []any{map[string]any{"id": req.Id, "src": device0, "error": map[string]any{"code": -103, "message": "Invalid argument"}}}
+	})
+	ch := newChannel(t, time.Second)
+
+	var out any
+	_, err := ch.callE(withLogger(context.Background()), device, types.MethodHandler{Method: "Switch.Set"}, &out, nil)
+	if err == nil || !strings.Contains(err.Error(), "Invalid argument") {
+		t.Fatalf("callE: got %v, want the device error", err)
+	}
+}
+
+// TestCallE_NeedsPort verifies that a device host without a port is refused
+// when no default port is configured.
+func TestCallE_NeedsPort(t *testing.T) {
+	device := types.NewFakeDevice()
+	device.IdValue = device0
+	device.HostValue = "127.0.0.1"
+	ch := newChannel(t, time.Second)
+
+	var out any
+	if _, err := ch.callE(withLogger(context.Background()), device, types.MethodHandler{Method: "Shelly.GetStatus"}, &out, nil); err == nil {
+		t.Fatal("callE: got nil, want an error")
+	}
+}
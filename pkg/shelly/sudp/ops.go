@@ -0,0 +1,23 @@
+package udp
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+type empty struct{}
+
+// Init registers a new UDP channel to r, and returns it. port is the
+// rpc_udp.listen_port of devices whose host does not carry one; timeout
+// bounds each call, retries included.
+func Init(log logr.Logger, r types.MethodsRegistrar, port uint16, timeout time.Duration) *UdpChannel {
+	log.Info("Init", "package", reflect.TypeOf(empty{}).PkgPath(), "port", port)
+	ch := &UdpChannel{}
+	ch.Init(log, port, timeout, DefaultRetries)
+	r.RegisterDeviceCaller(types.ChannelUdp, types.DeviceCaller(ch.callE))
+	return ch
+}
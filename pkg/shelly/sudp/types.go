@@ -0,0 +1,24 @@
+package udp
+
+// <https://shelly-api-docs.shelly.cloud/gen2/General/RPCChannels#udp>
+
+// Request is a JSON-RPC frame sent to a device's rpc_udp.listen_port.
+type Request struct {
+	Id     uint32 `json:"id"`
+	Src    string `json:"src"`
+	Method string `json:"method"`
+	Params any    `json:"params,omitempty"`
+}
+
+// Response is the JSON-RPC frame a device sends back to the address the
+// request came from.
+type Response struct {
+	Id     uint32 `json:"id"`
+	Src    string `json:"src"` // Device Id
+	Dst    string `json:"dst"`
+	Result *any   `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
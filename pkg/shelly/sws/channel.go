@@ -0,0 +1,308 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/websocket"
+)
+
+// <https://shelly-api-docs.shelly.cloud/gen2/General/RPCChannels#websocket>
+//
+// A Gen2+ device serves JSON-RPC on ws://<host>/rpc. Once a client sent a
+// request with a src, the device also pushes it NotifyStatus, NotifyEvent
+// and NotifyFullStatus frames over the same connection. One connection per
+// device is kept open and shared by all calls, matched to their responses by
+// request id.
+
+// src is the source of requests, as seen by devices.
+const src = "myhome"
+
+// Reconnection backoff of Watch.
+const (
+	watchMinBackoff = time.Second
+	watchMaxBackoff = time.Minute
+)
+
+type WsChannel struct {
+	log     logr.Logger
+	timeout time.Duration
+	dialer  websocket.Dialer
+
+	mutex       sync.Mutex
+	conns       map[string]*conn // by device host
+	nextId      uint32
+	subscribers []subscriber
+}
+
+type subscriber struct {
+	name   string
+	handle func(topic string, payload []byte, subscriber string) error
+}
+
+// conn is a pooled connection to a device.
+type conn struct {
+	ws      *websocket.Conn
+	host    string
+	writeMu sync.Mutex
+	mutex   sync.Mutex
+	pending map[uint32]chan *Frame
+	closed  chan struct{} // Closed once the connection is unusable
+}
+
+func (ch *WsChannel) Init(log logr.Logger, timeout time.Duration) {
+	ch.log = log.WithName("shelly.WsChannel")
+	ch.timeout = timeout
+	ch.dialer = websocket.Dialer{HandshakeTimeout: timeout}
+}
+
+// Subscribe calls handle with every notification pushed by the devices
+// connected over this channel, and the topic the device publishes its MQTT
+// copy on (<device_id>/events/rpc): MQTT subscription handlers consume both
+// alike.
+func (ch *WsChannel) Subscribe(name string, handle func(topic string, payload []byte, subscriber string) error) {
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+	ch.subscribers = append(ch.subscribers, subscriber{name: name, handle: handle})
+}
+
+// Close closes every pooled connection, failing their pending calls.
+func (ch *WsChannel) Close() {
+	ch.mutex.Lock()
+	conns := ch.conns
+	ch.conns = nil
+	ch.mutex.Unlock()
+	for _, c := range conns {
+		c.ws.Close()
+	}
+}
+
+// connect returns the pooled connection to device, dialing it if there is
+// none.
+func (ch *WsChannel) connect(ctx context.Context, device types.Device) (*conn, error) {
+	host := device.Host()
+	if host == "" {
+		return nil, fmt.Errorf("no known host for %s (%s)", device.Id(), device.Name())
+	}
+
+	ch.mutex.Lock()
+	if c, ok := ch.conns[host]; ok {
+		ch.mutex.Unlock()
+		return c, nil
+	}
+	ch.mutex.Unlock()
+
+	u := url.URL{Scheme: "ws", Host: formatHost(host), Path: "/rpc"}
+	ws, _, err := ch.dialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{
+		ws:      ws,
+		host:    host,
+		pending: make(map[uint32]chan *Frame),
+		closed:  make(chan struct{}),
+	}
+
+	ch.mutex.Lock()
+	if existing, ok := ch.conns[host]; ok {
+		// Lost a race with another call dialing the same device
+		ch.mutex.Unlock()
+		ws.Close()
+		return existing, nil
+	}
+	if ch.conns == nil {
+		ch.conns = make(map[string]*conn)
+	}
+	ch.conns[host] = c
+	ch.mutex.Unlock()
+
+	ch.log.Info("Connected", "device_id", device.Id(), "url", u.String())
+	go ch.read(c)
+	return c, nil
+}
+
+// formatHost brackets IPv6 literals, as required by URL syntax.
+func formatHost(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// read dispatches the frames received on c, responses to their pending call
+// and notifications to the subscribers, until c fails.
+func (ch *WsChannel) read(c *conn) {
+	defer ch.drop(c)
+	for {
+		_, payload, err := c.ws.ReadMessage()
+		if err != nil {
+			ch.log.V(1).Info("Connection closed", "host", c.host, "error", err)
+			return
+		}
+		var frame Frame
+		if err := json.Unmarshal(payload, &frame); err != nil {
+			ch.log.V(1).Info("Ignoring non-JSON frame", "host", c.host, "error", err)
+			continue
+		}
+
+		if frame.Id == nil && frame.Method != "" {
+			ch.notify(frame.Src, payload)
+			continue
+		}
+		if frame.Id == nil {
+			continue
+		}
+		c.mutex.Lock()
+		reply, ok := c.pending[*frame.Id]
+		delete(c.pending, *frame.Id)
+		c.mutex.Unlock()
+		if !ok {
+			ch.log.V(1).Info("Ignoring unexpected response", "host", c.host, "id", *frame.Id)
+			continue
+		}
+		reply <- &frame
+	}
+}
+
+// notify hands a notification pushed by the device src to the subscribers.
+func (ch *WsChannel) notify(src string, payload []byte) {
+	ch.mutex.Lock()
+	subscribers := append([]subscriber(nil), ch.subscribers...)
+	ch.mutex.Unlock()
+	topic := src + "/events/rpc"
+	for _, s := range subscribers {
+		if err := s.handle(topic, payload, s.name); err != nil {
+			ch.log.Error(err, "Notification handler failed", "subscriber", s.name, "topic", topic)
+		}
+	}
+}
+
+// drop removes c from the pool, and fails its pending calls.
+func (ch *WsChannel) drop(c *conn) {
+	c.ws.Close()
+	ch.mutex.Lock()
+	if ch.conns[c.host] == c {
+		delete(ch.conns, c.host)
+	}
+	ch.mutex.Unlock()
+	c.mutex.Lock()
+	for id, reply := range c.pending {
+		close(reply)
+		delete(c.pending, id)
+	}
+	c.mutex.Unlock()
+	close(c.closed)
+}
+
+func (ch *WsChannel) callE(ctx context.Context, device types.Device, verb types.MethodHandler, out any, params any) (any, error) {
+	log := logr.FromContextOrDiscard(ctx).WithName("shelly.WsChannel")
+
+	c, err := ch.connect(ctx, device)
+	if err != nil {
+		log.Error(err, "Unable to connect to device", "device_id", device.Id())
+		return nil, err
+	}
+
+	ch.mutex.Lock()
+	ch.nextId++
+	id := ch.nextId
+	ch.mutex.Unlock()
+	reply := make(chan *Frame, 1)
+	c.mutex.Lock()
+	c.pending[id] = reply
+	c.mutex.Unlock()
+	defer func() {
+		c.mutex.Lock()
+		delete(c.pending, id)
+		c.mutex.Unlock()
+	}()
+
+	log.V(1).Info("Calling", "device_id", device.Id(), "method", verb.Method, "id", id)
+	c.writeMu.Lock()
+	err = c.ws.WriteJSON(Request{Id: id, Src: src, Method: verb.Method, Params: params})
+	c.writeMu.Unlock()
+	if err != nil {
+		log.Error(err, "WebSocket write error", "device_id", device.Id())
+		c.ws.Close() // The reader drops it from the pool
+		return nil, err
+	}
+
+	timer := time.NewTimer(ch.timeout)
+	defer timer.Stop()
+	select {
+	case frame, ok := <-reply:
+		if !ok {
+			return nil, fmt.Errorf("connection to %s (%s) closed while waiting for response", device.Id(), device.Name())
+		}
+		if frame.Error != nil {
+			return nil, fmt.Errorf("device replied error '%v' (code:%v) to request '%v'", frame.Error.Message, frame.Error.Code, verb.Method)
+		}
+		if len(frame.Result) > 0 {
+			if err := json.Unmarshal(frame.Result, &out); err != nil {
+				log.Error(err, "Unable to unmarshal result", "device_id", device.Id(), "result", string(frame.Result))
+				return nil, err
+			}
+		}
+		return out, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("context cancelled while waiting for response from %s (%s): %w", device.Id(), device.Name(), ctx.Err())
+	case <-timer.C:
+		err := fmt.Errorf("timeout waiting for response from %s (%s)", device.Id(), device.Name())
+		log.Error(err, "Timeout waiting for device response", "method", verb.Method, "timeout", ch.timeout)
+		return nil, err
+	}
+}
+
+// Watch keeps a connection to device open until ctx is done, reconnecting
+// with backoff. Each connection starts with a request, which makes the
+// device push its notifications on it.
+func (ch *WsChannel) Watch(ctx context.Context, device types.Device) {
+	log := ch.log.WithValues("device_id", device.Id())
+	ctx = logr.NewContext(ctx, log)
+	backoff := watchMinBackoff
+	for {
+		var closed <-chan struct{}
+		if device.Channel(ctx, types.ChannelWebsocket) == types.ChannelWebsocket {
+			var info map[string]any
+			if _, err := ch.callE(ctx, device, types.MethodHandler{Method: "Shelly.GetDeviceInfo"}, &info, nil); err == nil {
+				ch.mutex.Lock()
+				if c, ok := ch.conns[device.Host()]; ok {
+					closed = c.closed
+				}
+				ch.mutex.Unlock()
+			} else {
+				log.V(1).Info("Unable to watch device", "error", err)
+			}
+		}
+		if closed != nil {
+			backoff = watchMinBackoff
+			select {
+			case <-closed:
+				log.Info("Lost connection, reconnecting")
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, watchMaxBackoff)
+	}
+}
@@ -0,0 +1,201 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/websocket"
+)
+
+const device0 = "shellypro3-aabbccddeeff"
+
+func withLogger(ctx context.Context) context.Context {
+	return logr.NewContext(ctx, logr.Discard())
+}
+
+// fakeShelly serves /rpc over WebSocket like a Gen2 device: it answers
+// each request with the echoed method and params (Switch.Fail with an
+// error), out of order when a call says {"delay":...}, and pushes a
+// NotifyStatus after its first response on every connection.
+type fakeShelly struct {
+	server      *httptest.Server
+	connections atomic.Int32
+	conns       sync.Map // *websocket.Conn
+}
+
+func newFakeShelly(t *testing.T) *fakeShelly {
+	t.Helper()
+	f := &fakeShelly{}
+	upgrader := websocket.Upgrader{}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rpc" {
+			http.NotFound(w, r)
+			return
+		}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		f.connections.Add(1)
+		f.conns.Store(ws, true)
+		var writeMu sync.Mutex
+		write := func(v any) {
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			ws.WriteJSON(v)
+		}
+		notified := false
+		for {
+			var req struct {
+				Id     uint32          `json:"id"`
+				Src    string          `json:"src"`
+				Method string          `json:"method"`
+				Params json.RawMessage `json:"params"`
+			}
+			if err := ws.ReadJSON(&req); err != nil {
+				return
+			}
+			var params struct {
+				Delay time.Duration `json:"delay"`
+			}
+			json.Unmarshal(req.Params, &params)
+			go func() {
+				time.Sleep(params.Delay)
+				if req.Method == "Switch.Fail" {
+					write(map[string]any{"id": req.Id, "src": device0, "dst": req.Src, "error": map[string]any{"code": -103, "message": "Invalid argument"}})
+					return
+				}
+				write(map[string]any{"id": req.Id, "src": device0, "dst": req.Src, "result": map[string]any{"method": req.Method, "params": req.Params}})
+			}()
+			if !notified {
+				notified = true
+				write(map[string]any{"src": device0, "dst": req.Src, "method": "NotifyStatus", "params": map[string]any{"ts": 1.5, "switch:0": map[string]any{"output": true}}})
+			}
+		}
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// drop closes the device side of every connection.
+func (f *fakeShelly) drop() {
+	f.conns.Range(func(k, _ any) bool {
+		k.(*websocket.Conn).Close()
+		f.conns.Delete(k)
+		return true
+	})
+}
+
+func (f *fakeShelly) device() *types.FakeDevice {
+	device := types.NewFakeDevice()
+	device.IdValue = device0
+	device.HostValue = strings.TrimPrefix(f.server.URL, "http://")
+	return device
+}
+
+func newChannel(t *testing.T) *WsChannel {
+	t.Helper()
+	var ch WsChannel
+	ch.Init(logr.Discard(), 2*time.Second)
+	t.Cleanup(ch.Close)
+	return &ch
+}
+
+func call(ch *WsChannel, device types.Device, method string, params any) (map[string]any, error) {
+	out := map[string]any{}
+	_, err := ch.callE(withLogger(context.Background()), device, types.MethodHandler{Method: method}, &out, params)
+	return out, err
+}
+
+// TestCallE_MultiplexesOneConnection verifies that concurrent calls share
+// one connection, each getting its own response even out of order.
+func TestCallE_MultiplexesOneConnection(t *testing.T) {
+	f := newFakeShelly(t)
+	device := f.device()
+	ch := newChannel(t)
+
+	if _, err := call(ch, device, "Shelly.GetDeviceInfo", nil); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i, delay := range []time.Duration{300 * time.Millisecond, 0, 100 * time.Millisecond} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			method := []string{"Switch.Set", "Switch.Toggle", "Switch.GetStatus"}[i]
+			out, err := call(ch, device, method, map[string]any{"delay": delay})
+			if err != nil {
+				t.Errorf("%s: %v", method, err)
+			} else if out["method"] != method {
+				t.Errorf("%s: got the response to %v", method, out["method"])
+			}
+		}()
+	}
+	wg.Wait()
+	if n := f.connections.Load(); n != 1 {
+		t.Errorf("connections: got %d, want 1", n)
+	}
+
+	if _, err := call(ch, device, "Switch.Fail", nil); err == nil || !strings.Contains(err.Error(), "Invalid argument") {
+		t.Errorf("Switch.Fail: got %v, want the device error", err)
+	}
+}
+
+// TestNotifications verifies that notifications pushed by a device reach
+// subscribers with the topic of their MQTT copy.
+func TestNotifications(t *testing.T) {
+	f := newFakeShelly(t)
+	ch := newChannel(t)
+	got := make(chan string, 1)
+	ch.Subscribe("test", func(topic string, payload []byte, subscriber string) error {
+		got <- topic + " " + string(payload)
+		return nil
+	})
+
+	if _, err := call(ch, f.device(), "Shelly.GetDeviceInfo", nil); err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	select {
+	case n := <-got:
+		if !strings.HasPrefix(n, device0+"/events/rpc ") || !strings.Contains(n, `"NotifyStatus"`) {
+			t.Errorf("notification: got %s", n)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no notification received")
+	}
+}
+
+// TestWatch_Reconnects verifies that a watched device is reconnected to
+// after it dropped the connection.
+func TestWatch_Reconnects(t *testing.T) {
+	f := newFakeShelly(t)
+	ch := newChannel(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ch.Watch(ctx, f.device())
+
+	waitFor := func(n int32) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for f.connections.Load() < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("connections: got %d, want %d", f.connections.Load(), n)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor(1)
+	time.Sleep(100 * time.Millisecond) // Let the first call complete
+	f.drop()
+	waitFor(2)
+}
@@ -0,0 +1,8 @@
+module github.com/asnowfix/home-automation/pkg/shelly/sws
+
+go 1.25.0
+
+require (
+	github.com/go-logr/logr v1.4.3
+	github.com/gorilla/websocket v1.5.3
+)
@@ -0,0 +1,22 @@
+package ws
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+type empty struct{}
+
+// Init registers a new WebSocket channel to r, and returns it for its
+// Subscribe and Watch. timeout bounds each call.
+func Init(log logr.Logger, r types.MethodsRegistrar, timeout time.Duration) *WsChannel {
+	log.Info("Init", "package", reflect.TypeOf(empty{}).PkgPath())
+	ch := &WsChannel{}
+	ch.Init(log, timeout)
+	r.RegisterDeviceCaller(types.ChannelWebsocket, types.DeviceCaller(ch.callE))
+	return ch
+}
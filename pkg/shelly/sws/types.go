@@ -0,0 +1,29 @@
+package ws
+
+import "encoding/json"
+
+// <https://shelly-api-docs.shelly.cloud/gen2/General/RPCChannels#websocket>
+
+// Request is a JSON-RPC frame sent to a device over its /rpc WebSocket.
+type Request struct {
+	Id     uint32 `json:"id"`
+	Src    string `json:"src"`
+	Method string `json:"method"`
+	Params any    `json:"params,omitempty"`
+}
+
+// Frame is any frame a device sends: the response to a request (Id, Result
+// or Error), or a notification it pushes unsolicited (Method: NotifyStatus,
+// NotifyEvent or NotifyFullStatus, and Params).
+type Frame struct {
+	Id     *uint32         `json:"id,omitempty"`
+	Src    string          `json:"src"`
+	Dst    string          `json:"dst"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
@@ -83,6 +83,28 @@ func SetConfig(ctx context.Context, via types.Channel, device types.Device, conf
 	return res, nil
 }
 
+// SetRpcUdpPort makes device listen for RPC requests on UDP port (0
+// disables it), leaving the rest of its rpc_udp config alone. See
+// types.ChannelUdp.
+func SetRpcUdpPort(ctx context.Context, via types.Channel, device types.Device, port uint16) (*SetConfigResponse, error) {
+	var listenPort any = port
+	if port == 0 {
+		listenPort = nil
+	}
+	out, err := device.CallE(ctx, via, setConfig.String(), map[string]any{
+		"config": map[string]any{"rpc_udp": map[string]any{"listen_port": listenPort}},
+	})
+	if err != nil {
+		log.Error(err, "Unable to set RPC UDP port", "device", device.Id(), "port", port)
+		return nil, err
+	}
+	res, ok := out.(*SetConfigResponse)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response type: got %v, expected %v", reflect.TypeOf(out), reflect.TypeOf(&SetConfigResponse{}))
+	}
+	return res, nil
+}
+
 func GetStatus(ctx context.Context, via types.Channel, device types.Device) (*Status, error) {
 	out, err := device.CallE(ctx, via, getStatus.String(), nil)
 	if err != nil {
@@ -2,6 +2,7 @@ package system
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"testing"
 
@@ -91,6 +92,19 @@ func TestSetConfig(t *testing.T) {
 	}
 }
 
+func TestSetRpcUdpPort(t *testing.T) {
+	d := types.NewFakeDevice()
+	d.SetResult(setConfig.String(), &SetConfigResponse{RestartRequired: true})
+
+	if _, err := SetRpcUdpPort(context.Background(), types.ChannelDefault, d, 2020); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := json.Marshal(d.Calls[0].Params)
+	if want := `{"config":{"rpc_udp":{"listen_port":2020}}}`; string(b) != want {
+		t.Errorf("expected %s, got %s", want, b)
+	}
+}
+
 func TestGetStatus(t *testing.T) {
 	t.Run("happy path", func(t *testing.T) {
 		d := types.NewFakeDevice()
@@ -0,0 +1,72 @@
+package types
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// <https://shelly-api-docs.shelly.cloud/gen2/General/Authentication>
+//
+// A Gen2+ device with authentication enabled answers HTTP requests with a
+// SHA-256 digest challenge, whose realm is the device id. The only user is
+// AuthUser; its password is never needed as such, only the HA1 digest of
+// user, realm and password, which is what Shelly.SetAuth stores too.
+
+// AuthUser is the user of every Gen2+ device with authentication enabled.
+const AuthUser = "admin"
+
+// AuthHA1 returns the hex SHA-256 of "admin:<realm>:<password>", as set with
+// Shelly.SetAuth and used to answer digest challenges.
+func AuthHA1(realm string, password string) string {
+	sum := sha256.Sum256([]byte(AuthUser + ":" + realm + ":" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// CredentialsProvider returns the HA1 digest of the credentials of the
+// device with id realm, if it knows them. Implemented by the internal/myhome
+// layer (config, device DB), and installed with
+// shelly.Client.SetCredentialsProvider.
+type CredentialsProvider interface {
+	HA1(ctx context.Context, realm string) (ha1 string, ok bool)
+}
+
+// Passwords are device passwords by device id, "*" being the password of
+// any other device.
+type Passwords map[string]string
+
+// ParsePasswords parses a comma-separated list of device_id:password, as
+// found in MYHOME_SHELLY_PASSWORDS. A password may contain colons, not
+// commas.
+func ParsePasswords(s string) (Passwords, error) {
+	passwords := make(Passwords)
+	for i, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, password, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || password == "" {
+			// Don't quote the entry: without a colon, it is the password.
+			return nil, fmt.Errorf("invalid device password #%d: expected device_id:password", i+1)
+		}
+		if _, dup := passwords[id]; dup {
+			return nil, fmt.Errorf("duplicate device password for %q", id)
+		}
+		passwords[id] = password
+	}
+	return passwords, nil
+}
+
+func (p Passwords) HA1(ctx context.Context, realm string) (string, bool) {
+	password, ok := p[realm]
+	if !ok {
+		password, ok = p["*"]
+	}
+	if !ok {
+		return "", false
+	}
+	return AuthHA1(realm, password), true
+}
@@ -0,0 +1,39 @@
+package types
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParsePasswords(t *testing.T) {
+	p, err := ParsePasswords(" shellypro3-aabbccddeeff:a:b , *:default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ha1, ok := p.HA1(context.Background(), "shellypro3-aabbccddeeff")
+	if !ok || ha1 != AuthHA1("shellypro3-aabbccddeeff", "a:b") {
+		t.Errorf("device password: got %q %v", ha1, ok)
+	}
+	ha1, ok = p.HA1(context.Background(), "shelly1-112233445566")
+	if !ok || ha1 != AuthHA1("shelly1-112233445566", "default") {
+		t.Errorf("default password: got %q %v", ha1, ok)
+	}
+
+	for _, s := range []string{"nopassword", "id:", "a:1,a:2"} {
+		if _, err := ParsePasswords(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+	if _, err := ParsePasswords("*:default,s3cret"); err == nil || strings.Contains(err.Error(), "s3cret") {
+		t.Errorf("got %v, want an error not quoting the entry", err)
+	}
+}
+
+func TestAuthHA1(t *testing.T) {
+	// echo -n "admin:shellypro4pm-f008d1d8b8b8:pass" | sha256sum
+	const want = "b2d4691b6df2e46452e28814d2a22ccede110fa63472fe8eed82e1d4b3305634"
+	if got := AuthHA1("shellypro4pm-f008d1d8b8b8", "pass"); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -26,6 +26,10 @@ type FakeDevice struct {
 	NameValue string
 	HostValue string
 
+	// ResolveHostFunc, if set, is the HostResolver of ResolveHost: it returns
+	// the device's current host.
+	ResolveHostFunc func(ctx context.Context) (host string, ok bool)
+
 	Calls   []FakeDeviceCall
 	results map[string]any
 	errs    map[string]error
@@ -84,6 +88,17 @@ func (f *FakeDevice) IsHttpReady() bool           { return true }
 func (f *FakeDevice) IsMqttReady() bool           { return true }
 func (f *FakeDevice) Channel(ctx context.Context, via Channel) Channel { return via }
 
+func (f *FakeDevice) ResolveHost(ctx context.Context) bool {
+	if f.ResolveHostFunc == nil {
+		return false
+	}
+	host, ok := f.ResolveHostFunc(ctx)
+	if ok {
+		f.HostValue = host
+	}
+	return ok
+}
+
 func (f *FakeDevice) UpdateName(name string) { f.NameValue = name }
 func (f *FakeDevice) UpdateHost(host string) { f.HostValue = host }
 func (f *FakeDevice) ClearHost()             { f.HostValue = "" }
@@ -4,9 +4,6 @@ import (
 	"context"
 	"fmt"
 	"net"
-	"time"
-
-	"github.com/go-logr/logr"
 )
 
 type MethodsRegistrar interface {
@@ -35,6 +32,12 @@ type Device interface {
 
 	Channel(ctx context.Context, via Channel) Channel
 
+	// ResolveHost (re-)resolves the device's IP address with the
+	// HostResolver of its client, if any, and updates its host. It is called
+	// when the host is unknown, or immediately after an HTTP dial failure,
+	// before falling back to another channel (e.g. MQTT).
+	ResolveHost(ctx context.Context) bool
+
 	UpdateName(name string)
 	UpdateHost(host string)
 	ClearHost()
@@ -48,48 +51,24 @@ type DeviceCaller func(ctx context.Context, device Device, mh MethodHandler, out
 
 // HostResolver resolves a device's current dialable IP address, e.g. via
 // mDNS or a router's ARP-like lookup table. Implemented by the internal/
-// myhome layer, which owns network-topology concerns, and injected here at
-// daemon startup via SetHostResolver — keeping pkg/shelly free of any
-// MyHome-specific dependency (see CLAUDE.md's Three-Tier Layer Rule).
+// myhome layer, which owns network-topology concerns, and injected into a
+// shelly.Client at daemon startup via its SetHostResolver — keeping
+// pkg/shelly free of any MyHome-specific dependency (see CLAUDE.md's
+// Three-Tier Layer Rule).
 type HostResolver interface {
 	ResolveHost(ctx context.Context, mac net.HardwareAddr, name string) (net.IP, error)
 }
 
-var hostResolver HostResolver
-
-// SetHostResolver installs the HostResolver used to (re-)resolve a device's
-// IP address when it is unknown, or immediately after an HTTP dial failure,
-// before falling back to another channel (e.g. MQTT). Call once at daemon
-// startup; nil (the default) disables resolution.
-func SetHostResolver(r HostResolver) {
-	hostResolver = r
-}
-
-// ResolveHost calls the installed HostResolver, if any. ok is false if no
-// resolver is installed, or the installed one could not find an address.
-func ResolveHost(ctx context.Context, mac net.HardwareAddr, name string) (ip net.IP, ok bool) {
-	if hostResolver == nil {
-		return nil, false
-	}
-	log := logr.FromContextOrDiscard(ctx)
-	start := time.Now()
-	ip, err := hostResolver.ResolveHost(ctx, mac, name)
-	log.Info("ResolveHost", "mac", mac, "name", name, "ip", ip, "err", err, "elapsed", time.Since(start))
-	if err != nil || ip == nil {
-		return nil, false
-	}
-	return ip, true
-}
-
 type Channel uint32
 
-var Channels = [...]string{"default", "http", "mqtt", "udp"}
+var Channels = [...]string{"default", "http", "mqtt", "udp", "websocket"}
 
 const (
 	ChannelDefault Channel = iota
 	ChannelHttp
 	ChannelMqtt
 	ChannelUdp
+	ChannelWebsocket
 )
 
 func (ch Channel) String() string {
@@ -140,6 +119,11 @@ const (
 	DevicePower
 	Humidity
 	Temperature
+	PM1
+	EM
+	EMData
+	EM1
+	EM1Data
 	None
 )
 
@@ -167,6 +151,11 @@ func (api Api) String() string {
 		"DevicePower",
 		"Humidity",
 		"Temperature",
+		"PM1",
+		"EM",
+		"EMData",
+		"EM1",
+		"EM1Data",
 		"None",
 	}[api]
 }
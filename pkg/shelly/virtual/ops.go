@@ -0,0 +1,193 @@
+package virtual
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+var log logr.Logger
+
+type empty struct{}
+
+type Verb string
+
+func (v Verb) String() string {
+	return string(v) // Convert Verb to string
+}
+
+const (
+	addVirtual    Verb = "Virtual.Add"
+	deleteVirtual Verb = "Virtual.Delete"
+)
+
+// Methods of every virtual component type, e.g. Boolean.GetConfig
+const (
+	getConfig = "GetConfig"
+	setConfig = "SetConfig"
+	getStatus = "GetStatus"
+	set       = "Set"
+)
+
+func verb(t Type, method string) Verb {
+	return Verb(t.Namespace() + "." + method)
+}
+
+func Init(l logr.Logger, r types.MethodsRegistrar) {
+	log = l
+	log.Info("Init", "package", reflect.TypeOf(empty{}).PkgPath())
+
+	r.RegisterMethodHandler(addVirtual.String(), types.MethodHandler{
+		Allocate:   func() any { return new(AddResponse) },
+		HttpMethod: http.MethodPost,
+	})
+	r.RegisterMethodHandler(deleteVirtual.String(), types.MethodHandler{
+		Allocate:   func() any { return nil },
+		HttpMethod: http.MethodPost,
+	})
+	for _, t := range Types {
+		r.RegisterMethodHandler(verb(t, getConfig).String(), types.MethodHandler{
+			Allocate:   func() any { return new(Config) },
+			HttpMethod: http.MethodGet,
+		})
+		r.RegisterMethodHandler(verb(t, setConfig).String(), types.MethodHandler{
+			Allocate:   func() any { return new(ConfigurationResponse) },
+			HttpMethod: http.MethodPost,
+		})
+		r.RegisterMethodHandler(verb(t, getStatus).String(), types.MethodHandler{
+			Allocate:   func() any { return new(Status) },
+			HttpMethod: http.MethodGet,
+		})
+		// Set answers null
+		r.RegisterMethodHandler(verb(t, set).String(), types.MethodHandler{
+			Allocate:   func() any { return nil },
+			HttpMethod: http.MethodPost,
+		})
+	}
+}
+
+func doCall[reqT any, resT any](ctx context.Context, device types.Device, via types.Channel, verb Verb, req *reqT) (*resT, error) {
+	out, err := device.CallE(ctx, via, verb.String(), req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s on device %s: %w", verb, device.Id(), err)
+	}
+
+	result, ok := out.(*resT)
+	if !ok {
+		var expected resT
+		return nil, fmt.Errorf("unexpected response type %T (should be *%T)", out, expected)
+	}
+	return result, nil
+}
+
+// Add creates a virtual component of type t on the device. If id is zero,
+// the device picks the first free id. It returns the id of the new
+// component.
+func Add(ctx context.Context, device types.Device, via types.Channel, t Type, id int, config *Config) (int, error) {
+	req := &AddRequest{Type: t, Config: config}
+	if id != 0 {
+		if id < MinId || id > MaxId {
+			return 0, fmt.Errorf("invalid virtual component id %d (expected %d-%d)", id, MinId, MaxId)
+		}
+		req.Id = &id
+	}
+	res, err := doCall[AddRequest, AddResponse](ctx, device, via, addVirtual, req)
+	if err != nil {
+		return 0, err
+	}
+	return res.Id, nil
+}
+
+// Delete removes the virtual component with the given key (e.g. number:200)
+// from the device.
+func Delete(ctx context.Context, device types.Device, via types.Channel, key string) error {
+	if !IsVirtual(key) {
+		return fmt.Errorf("invalid virtual component key %q", key)
+	}
+	_, err := device.CallE(ctx, via, deleteVirtual.String(), &DeleteRequest{Key: key})
+	if err != nil {
+		return fmt.Errorf("failed to call %s on device %s: %w", deleteVirtual, device.Id(), err)
+	}
+	return nil
+}
+
+func GetConfig(ctx context.Context, device types.Device, via types.Channel, t Type, id int) (*Config, error) {
+	return doCall[IdRequest, Config](ctx, device, via, verb(t, getConfig), &IdRequest{Id: id})
+}
+
+func SetConfig(ctx context.Context, device types.Device, via types.Channel, t Type, id int, config *Config) (*ConfigurationResponse, error) {
+	return doCall[ConfigurationRequest, ConfigurationResponse](ctx, device, via, verb(t, setConfig), &ConfigurationRequest{Id: id, Configuration: *config})
+}
+
+func GetStatus(ctx context.Context, device types.Device, via types.Channel, t Type, id int) (*Status, error) {
+	return doCall[IdRequest, Status](ctx, device, via, verb(t, getStatus), &IdRequest{Id: id})
+}
+
+// Set sets the value of a virtual component: a bool for a boolean, a number
+// for a number, a string for a text or an enum, and a list of component
+// keys for a group.
+func Set(ctx context.Context, device types.Device, via types.Channel, t Type, id int, value any) error {
+	if err := checkValue(t, value); err != nil {
+		return err
+	}
+	v := verb(t, set)
+	_, err := device.CallE(ctx, via, v.String(), &SetRequest{Id: id, Value: value})
+	if err != nil {
+		return fmt.Errorf("failed to call %s on device %s: %w", v, device.Id(), err)
+	}
+	return nil
+}
+
+func checkValue(t Type, value any) error {
+	ok := false
+	switch t {
+	case TypeBoolean:
+		_, ok = value.(bool)
+	case TypeNumber:
+		switch value.(type) {
+		case int, int32, int64, float32, float64:
+			ok = true
+		}
+	case TypeText, TypeEnum:
+		_, ok = value.(string)
+	case TypeGroup:
+		_, ok = value.([]string)
+	default:
+		return fmt.Errorf("unknown virtual component type %q", t)
+	}
+	if !ok {
+		return fmt.Errorf("invalid %T value %v for a %s virtual component", value, value, t)
+	}
+	return nil
+}
+
+// ParseValue parses the textual value s (e.g. from the command line) into
+// the value type that Set expects for t. Group members are comma-separated
+// keys.
+func ParseValue(t Type, s string) (any, error) {
+	switch t {
+	case TypeBoolean:
+		return strconv.ParseBool(s)
+	case TypeNumber:
+		return strconv.ParseFloat(s, 64)
+	case TypeText, TypeEnum:
+		return s, nil
+	case TypeGroup:
+		keys := make([]string, 0)
+		for _, k := range strings.Split(s, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				keys = append(keys, k)
+			}
+		}
+		return keys, nil
+	default:
+		return nil, fmt.Errorf("unknown virtual component type %q", t)
+	}
+}
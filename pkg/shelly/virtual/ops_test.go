@@ -0,0 +1,99 @@
+package virtual
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+)
+
+func TestParseKey(t *testing.T) {
+	typ, id, err := ParseKey("number:200")
+	if err != nil || typ != TypeNumber || id != 200 {
+		t.Errorf("ParseKey(number:200) = %v, %v, %v", typ, id, err)
+	}
+	for _, key := range []string{"switch:0", "number:1", "number:300", "number", "boolean:x"} {
+		if _, _, err := ParseKey(key); err == nil {
+			t.Errorf("expected an error for %q", key)
+		}
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		typ  Type
+		in   string
+		want any
+	}{
+		{TypeBoolean, "true", true},
+		{TypeNumber, "21.5", 21.5},
+		{TypeText, "hello", "hello"},
+		{TypeEnum, "eco", "eco"},
+		{TypeGroup, "number:200, boolean:201", []string{"number:200", "boolean:201"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseValue(tt.typ, tt.in)
+		if err != nil {
+			t.Errorf("ParseValue(%s, %q): unexpected error: %v", tt.typ, tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseValue(%s, %q) = %#v, want %#v", tt.typ, tt.in, got, tt.want)
+		}
+	}
+	if _, err := ParseValue(TypeBoolean, "maybe"); err == nil {
+		t.Error("expected an error for boolean value maybe")
+	}
+}
+
+func TestAdd(t *testing.T) {
+	d := types.NewFakeDevice()
+	d.SetResult(addVirtual.String(), &AddResponse{Id: 200})
+
+	name := "Eco speed"
+	id, err := Add(context.Background(), d, types.ChannelDefault, TypeNumber, 200, &Config{Name: &name})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != 200 {
+		t.Errorf("expected id 200, got %d", id)
+	}
+	req, ok := d.Calls[0].Params.(*AddRequest)
+	if !ok || req.Type != TypeNumber || req.Id == nil || *req.Id != 200 || *req.Config.Name != name {
+		t.Errorf("unexpected Virtual.Add params %#v", d.Calls[0].Params)
+	}
+
+	if _, err := Add(context.Background(), d, types.ChannelDefault, TypeNumber, 42, nil); err == nil {
+		t.Error("expected an error for id 42")
+	}
+}
+
+func TestSet(t *testing.T) {
+	d := types.NewFakeDevice()
+	d.SetResult("Boolean.Set", nil)
+
+	if err := Set(context.Background(), d, types.ChannelDefault, TypeBoolean, 201, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Calls[0].Method != "Boolean.Set" {
+		t.Errorf("expected Boolean.Set, got %s", d.Calls[0].Method)
+	}
+	if err := Set(context.Background(), d, types.ChannelDefault, TypeBoolean, 201, "on"); err == nil {
+		t.Error("expected an error for a string value on a boolean")
+	}
+	if len(d.Calls) != 1 {
+		t.Errorf("expected no call for an invalid value, got %v", d.Calls)
+	}
+}
+
+func TestGetStatus_DeviceError(t *testing.T) {
+	d := types.NewFakeDevice()
+	wantErr := errors.New("not found")
+	d.SetError("Number.GetStatus", wantErr)
+
+	if _, err := GetStatus(context.Background(), d, types.ChannelDefault, TypeNumber, 200); !errors.Is(err, wantErr) {
+		t.Fatalf("expected %v, got %v", wantErr, err)
+	}
+}
@@ -0,0 +1,148 @@
+package virtual
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// https://shelly-api-docs.shelly.cloud/gen2/DynamicComponents/Virtual
+// https://shelly-api-docs.shelly.cloud/gen2/DynamicComponents/Boolean
+// https://shelly-api-docs.shelly.cloud/gen2/DynamicComponents/Number
+// https://shelly-api-docs.shelly.cloud/gen2/DynamicComponents/Text
+// https://shelly-api-docs.shelly.cloud/gen2/DynamicComponents/Enum
+// https://shelly-api-docs.shelly.cloud/gen2/DynamicComponents/Group
+
+// Type is the type of a virtual component, as found in its key (e.g.
+// "boolean" in "boolean:200").
+type Type string
+
+const (
+	TypeBoolean Type = "boolean"
+	TypeNumber  Type = "number"
+	TypeText    Type = "text"
+	TypeEnum    Type = "enum"
+	TypeGroup   Type = "group"
+)
+
+var Types = []Type{TypeBoolean, TypeNumber, TypeText, TypeEnum, TypeGroup}
+
+// Virtual components instance ids range
+const (
+	MinId = 200
+	MaxId = 299
+)
+
+// Namespace returns the RPC namespace of the component type, e.g. "Boolean".
+func (t Type) Namespace() string {
+	s := string(t)
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func ParseType(s string) (Type, error) {
+	for _, t := range Types {
+		if string(t) == strings.ToLower(s) {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unknown virtual component type %q (expected one of %v)", s, Types)
+}
+
+// Key returns the component key of the virtual component, e.g. "number:200".
+func Key(t Type, id int) string {
+	return fmt.Sprintf("%s:%d", t, id)
+}
+
+// ParseKey splits a virtual component key like "number:200".
+func ParseKey(key string) (Type, int, error) {
+	ts, ids, ok := strings.Cut(key, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid virtual component key %q (expected <type>:<id>)", key)
+	}
+	t, err := ParseType(ts)
+	if err != nil {
+		return "", 0, err
+	}
+	id, err := strconv.Atoi(ids)
+	if err != nil || id < MinId || id > MaxId {
+		return "", 0, fmt.Errorf("invalid virtual component id in %q (expected %d-%d)", key, MinId, MaxId)
+	}
+	return t, id, nil
+}
+
+// IsVirtual tells whether key is the key of a virtual component.
+func IsVirtual(key string) bool {
+	_, _, err := ParseKey(key)
+	return err == nil
+}
+
+type Config struct {
+	Id           int      `json:"id,omitempty"`            // Id of the component instance (not set on Virtual.Add)
+	Name         *string  `json:"name,omitempty"`          // Name of the component instance
+	Owner        string   `json:"owner,omitempty"`         // Owner of the component (e.g. script:1), read-only
+	Persisted    *bool    `json:"persisted,omitempty"`     // True if the value is kept across reboots (boolean, number, text & enum)
+	DefaultValue any      `json:"default_value,omitempty"` // Value on boot, when not persisted (boolean, number, text & enum)
+	Min          *float64 `json:"min,omitempty"`           // Minimum value (number)
+	Max          *float64 `json:"max,omitempty"`           // Maximum value (number)
+	MaxLen       *int     `json:"max_len,omitempty"`       // Maximum length of the value (text)
+	Options      []string `json:"options,omitempty"`       // Allowed values (enum)
+	Meta         *Meta    `json:"meta,omitempty"`          // How the component is shown in the device web UI & Shelly app
+}
+
+type Meta struct {
+	UI *struct {
+		View   string            `json:"view,omitempty"`   // e.g. toggle, label, field, slider, progressbar, select, dropdown
+		Unit   string            `json:"unit,omitempty"`   // Unit shown next to a number value
+		Step   *float64          `json:"step,omitempty"`   // Step of a number slider
+		Icon   *string           `json:"icon,omitempty"`   // URL of an icon
+		Titles map[string]string `json:"titles,omitempty"` // Titles of boolean values (true, false) or enum options
+	} `json:"ui,omitempty"`
+}
+
+type Status struct {
+	Value        any     `json:"value"`                    // Current value: bool, number, string, or list of component keys for a group
+	Source       string  `json:"source,omitempty"`         // Source of the last value change
+	LastUpdateTs float64 `json:"last_update_ts,omitempty"` // Unix timestamp of the last value change
+}
+
+// Component is a virtual component as listed by Shelly.GetComponents.
+type Component struct {
+	Key    string  `json:"key"`              // e.g. boolean:200
+	Config *Config `json:"config,omitempty"` // Configuration, if requested
+	Status *Status `json:"status,omitempty"` // Status, if requested
+}
+
+type AddRequest struct {
+	Type   Type    `json:"type"`             // Type of the virtual component to add
+	Id     *int    `json:"id,omitempty"`     // Id of the new instance, MinId-MaxId (default: first free)
+	Config *Config `json:"config,omitempty"` // Configuration of the new instance
+}
+
+type AddResponse struct {
+	Id int `json:"id"` // Id of the added instance
+}
+
+type DeleteRequest struct {
+	Key string `json:"key"` // Key of the virtual component to delete, e.g. boolean:200
+}
+
+type IdRequest struct {
+	Id int `json:"id"` // Id of the component instance
+}
+
+type ConfigurationRequest struct {
+	Id            int    `json:"id"`     // Id of the component instance
+	Configuration Config `json:"config"` // Configuration that the method takes
+}
+
+type ConfigurationResponse struct {
+	RestartRequired bool `json:"restart_required"` // True if the device needs to be restarted for the changes to take effect
+}
+
+type SetRequest struct {
+	Id    int `json:"id"`    // Id of the component instance
+	Value any `json:"value"` // New value: bool, number, string, or list of component keys for a group
+}
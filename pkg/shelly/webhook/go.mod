@@ -0,0 +1,5 @@
+module github.com/asnowfix/home-automation/pkg/shelly/webhook
+
+go 1.25.0
+
+require github.com/go-logr/logr v1.4.3
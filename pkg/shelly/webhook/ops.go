@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+var log logr.Logger
+
+type empty struct{}
+
+type Verb string
+
+func (v Verb) String() string {
+	return string(v) // Convert Verb to string
+}
+
+const (
+	listSupported Verb = "Webhook.ListSupported"
+	list          Verb = "Webhook.List"
+	create        Verb = "Webhook.Create"
+	update        Verb = "Webhook.Update"
+	deleteHook    Verb = "Webhook.Delete"
+	deleteAll     Verb = "Webhook.DeleteAll"
+)
+
+func Init(l logr.Logger, r types.MethodsRegistrar) {
+	log = l
+	log.Info("Init", "package", reflect.TypeOf(empty{}).PkgPath())
+
+	r.RegisterMethodHandler(listSupported.String(), types.MethodHandler{
+		Allocate:   func() any { return new(SupportedResponse) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(list.String(), types.MethodHandler{
+		Allocate:   func() any { return new(ListResponse) },
+		HttpMethod: http.MethodGet,
+	})
+	r.RegisterMethodHandler(create.String(), types.MethodHandler{
+		Allocate:   func() any { return new(CreateResponse) },
+		HttpMethod: http.MethodPost,
+	})
+	for _, verb := range []Verb{update, deleteHook, deleteAll} {
+		r.RegisterMethodHandler(verb.String(), types.MethodHandler{
+			Allocate:   func() any { return new(RevResponse) },
+			HttpMethod: http.MethodPost,
+		})
+	}
+}
+
+func doCall[reqT any, resT any](ctx context.Context, device types.Device, via types.Channel, verb Verb, req *reqT) (*resT, error) {
+	out, err := device.CallE(ctx, via, verb.String(), req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s on device %s: %w", verb, device.Id(), err)
+	}
+
+	result, ok := out.(*resT)
+	if !ok {
+		var expected resT
+		return nil, fmt.Errorf("unexpected response type %T (should be *%T)", out, expected)
+	}
+	return result, nil
+}
+
+// ListSupported returns the events the device can trigger webhooks on.
+func ListSupported(ctx context.Context, device types.Device, via types.Channel) (*SupportedResponse, error) {
+	out, err := device.CallE(ctx, via, listSupported.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s on device %s: %w", listSupported, device.Id(), err)
+	}
+	res, ok := out.(*SupportedResponse)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response type %T (should be *SupportedResponse)", out)
+	}
+	return res, nil
+}
+
+func List(ctx context.Context, device types.Device, via types.Channel) (*ListResponse, error) {
+	out, err := device.CallE(ctx, via, list.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s on device %s: %w", list, device.Id(), err)
+	}
+	res, ok := out.(*ListResponse)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response type %T (should be *ListResponse)", out)
+	}
+	return res, nil
+}
+
+// Create adds the webhook hook (whose Id is ignored) and returns its id.
+func Create(ctx context.Context, device types.Device, via types.Channel, hook *Hook) (int, error) {
+	h := *hook
+	h.Id = 0
+	res, err := doCall[Hook, CreateResponse](ctx, device, via, create, &h)
+	if err != nil {
+		return 0, err
+	}
+	return res.Id, nil
+}
+
+// Update replaces the webhook with id hook.Id.
+func Update(ctx context.Context, device types.Device, via types.Channel, hook *Hook) error {
+	if hook.Id == 0 {
+		return fmt.Errorf("cannot update webhook %q without id", hook.Name)
+	}
+	_, err := doCall[Hook, RevResponse](ctx, device, via, update, hook)
+	return err
+}
+
+func Delete(ctx context.Context, device types.Device, via types.Channel, id int) error {
+	_, err := doCall[IdRequest, RevResponse](ctx, device, via, deleteHook, &IdRequest{Id: id})
+	return err
+}
+
+func DeleteAll(ctx context.Context, device types.Device, via types.Channel) error {
+	_, err := device.CallE(ctx, via, deleteAll.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to call %s on device %s: %w", deleteAll, device.Id(), err)
+	}
+	return nil
+}
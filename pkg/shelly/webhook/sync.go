@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+// Plan is what Sync does to make the webhooks of a device match a declared
+// list.
+type Plan struct {
+	Create []Hook `json:"create,omitempty"` // Declared webhooks missing on the device
+	Update []Hook `json:"update,omitempty"` // Declared webhooks that differ on the device, with the device's id
+	Delete []Hook `json:"delete,omitempty"` // Device webhooks that are not (or no longer) declared
+}
+
+// Empty tells whether the device already matches the declaration.
+func (p *Plan) Empty() bool {
+	return len(p.Create) == 0 && len(p.Update) == 0 && len(p.Delete) == 0
+}
+
+// Diff plans the changes that turn the current webhooks of a device into
+// the desired ones. Webhooks are matched by name, which must be unique in
+// desired. Device webhooks with an undeclared name are deleted only if
+// prune is set, so that hooks configured by hand in the web UI survive.
+func Diff(current []Hook, desired []Hook, prune bool) (*Plan, error) {
+	declared := make(map[string]Hook, len(desired))
+	for _, d := range desired {
+		if d.Name == "" {
+			return nil, fmt.Errorf("webhook on %s:%d has no name", d.Event, d.Cid)
+		}
+		if _, dup := declared[d.Name]; dup {
+			return nil, fmt.Errorf("webhook %q is declared twice", d.Name)
+		}
+		declared[d.Name] = d
+	}
+
+	plan := &Plan{}
+	found := make(map[string]bool, len(desired))
+	for _, c := range current {
+		d, ok := declared[c.Name]
+		switch {
+		case !ok:
+			if prune {
+				plan.Delete = append(plan.Delete, c)
+			}
+		case found[c.Name]:
+			// A duplicate of a declared webhook
+			plan.Delete = append(plan.Delete, c)
+		default:
+			found[c.Name] = true
+			if !same(c, d) {
+				d.Id = c.Id
+				plan.Update = append(plan.Update, d)
+			}
+		}
+	}
+	for _, d := range desired {
+		if !found[d.Name] {
+			plan.Create = append(plan.Create, d)
+		}
+	}
+	return plan, nil
+}
+
+// same compares a device webhook with a declared one. Optional fields
+// the declaration leaves empty take the device's defaults.
+func same(c Hook, d Hook) bool {
+	if c.Cid != d.Cid || c.Enable != d.Enable || c.Event != d.Event || c.RepeatPeriod != d.RepeatPeriod {
+		return false
+	}
+	if !slices.Equal(c.Urls, d.Urls) || !slices.Equal(c.ActiveBetween, d.ActiveBetween) {
+		return false
+	}
+	if d.SslCa != "" && c.SslCa != d.SslCa {
+		return false
+	}
+	if (c.Condition == nil) != (d.Condition == nil) || (c.Condition != nil && *c.Condition != *d.Condition) {
+		return false
+	}
+	return true
+}
+
+// Sync makes the webhooks of the device match desired (see Diff), unless
+// dryRun is set, and returns the plan.
+func Sync(ctx context.Context, log logr.Logger, device types.Device, via types.Channel, desired []Hook, prune bool, dryRun bool) (*Plan, error) {
+	current, err := List(ctx, device, via)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := Diff(current.Hooks, desired, prune)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun || plan.Empty() {
+		return plan, nil
+	}
+
+	// Delete first, as devices have a limited number of webhooks
+	for _, h := range plan.Delete {
+		if err := Delete(ctx, device, via, h.Id); err != nil {
+			return plan, err
+		}
+		log.Info("Deleted webhook", "device", device.Id(), "id", h.Id, "name", h.Name)
+	}
+	for i := range plan.Update {
+		if err := Update(ctx, device, via, &plan.Update[i]); err != nil {
+			return plan, err
+		}
+		log.Info("Updated webhook", "device", device.Id(), "id", plan.Update[i].Id, "name", plan.Update[i].Name)
+	}
+	for i := range plan.Create {
+		id, err := Create(ctx, device, via, &plan.Create[i])
+		if err != nil {
+			return plan, err
+		}
+		plan.Create[i].Id = id
+		log.Info("Created webhook", "device", device.Id(), "id", id, "name", plan.Create[i].Name)
+	}
+	return plan, nil
+}
@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asnowfix/home-automation/pkg/shelly/types"
+
+	"github.com/go-logr/logr"
+)
+
+func hook(id int, name string, url string) Hook {
+	return Hook{Id: id, Name: name, Event: "input.toggle_on", Enable: true, Urls: []string{url}}
+}
+
+func TestDiff(t *testing.T) {
+	current := []Hook{
+		hook(1, "light-on", "http://192.168.1.10/rpc/Switch.Set?id=0&on=true"),
+		hook(2, "light-off", "http://192.168.1.10/rpc/Switch.Set?id=0&on=false"),
+		hook(3, "by-hand", "http://example.com/"),
+		hook(4, "light-on", "http://192.168.1.10/rpc/Switch.Set?id=0&on=true"),
+	}
+	current[0].SslCa = "ca.pem" // a device default
+	desired := []Hook{
+		hook(0, "light-on", "http://192.168.1.10/rpc/Switch.Set?id=0&on=true"),
+		hook(0, "light-off", "http://192.168.1.11/rpc/Switch.Set?id=0&on=false"),
+		hook(0, "fan-on", "http://192.168.1.12/rpc/Switch.Set?id=0&on=true"),
+	}
+
+	plan, err := Diff(current, desired, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Create) != 1 || plan.Create[0].Name != "fan-on" {
+		t.Errorf("create: got %+v", plan.Create)
+	}
+	if len(plan.Update) != 1 || plan.Update[0].Name != "light-off" || plan.Update[0].Id != 2 {
+		t.Errorf("update: got %+v", plan.Update)
+	}
+	if len(plan.Delete) != 1 || plan.Delete[0].Id != 4 {
+		t.Errorf("delete (duplicate only): got %+v", plan.Delete)
+	}
+
+	plan, err = Diff(current, desired, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Delete) != 2 || plan.Delete[0].Id != 3 || plan.Delete[1].Id != 4 {
+		t.Errorf("delete (prune): got %+v", plan.Delete)
+	}
+
+	if _, err := Diff(nil, []Hook{hook(0, "x", "a"), hook(0, "x", "b")}, false); err == nil {
+		t.Error("expected an error for a webhook declared twice")
+	}
+	if _, err := Diff(nil, []Hook{hook(0, "", "a")}, false); err == nil {
+		t.Error("expected an error for a webhook without name")
+	}
+}
+
+func TestSync(t *testing.T) {
+	d := types.NewFakeDevice()
+	d.SetResult(list.String(), &ListResponse{Hooks: []Hook{
+		hook(1, "light-on", "http://old/"),
+		hook(2, "by-hand", "http://example.com/"),
+	}})
+	d.SetResult(deleteHook.String(), &RevResponse{Rev: 2})
+	d.SetResult(update.String(), &RevResponse{Rev: 3})
+	d.SetResult(create.String(), &CreateResponse{Id: 5, Rev: 4})
+
+	desired := []Hook{hook(0, "light-on", "http://new/"), hook(0, "fan-on", "http://fan/")}
+
+	plan, err := Sync(context.Background(), logr.Discard(), d, types.ChannelDefault, desired, false, true)
+	if err != nil {
+		t.Fatalf("dry run: unexpected error: %v", err)
+	}
+	if len(d.Calls) != 1 || plan.Empty() {
+		t.Fatalf("dry run: expected only %s and a non-empty plan, got %v, %+v", list, d.Calls, plan)
+	}
+
+	plan, err = Sync(context.Background(), logr.Discard(), d, types.ChannelDefault, desired, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"Webhook.List", "Webhook.List", "Webhook.Delete", "Webhook.Update", "Webhook.Create"}
+	if len(d.Calls) != len(want) {
+		t.Fatalf("expected calls %v, got %v", want, d.Calls)
+	}
+	for i, m := range want {
+		if d.Calls[i].Method != m {
+			t.Errorf("call %d: expected %s, got %s", i, m, d.Calls[i].Method)
+		}
+	}
+	if req := d.Calls[2].Params.(*IdRequest); req.Id != 2 {
+		t.Errorf("expected to delete webhook 2, got %d", req.Id)
+	}
+	if req := d.Calls[3].Params.(*Hook); req.Id != 1 || req.Urls[0] != "http://new/" {
+		t.Errorf("unexpected update %+v", req)
+	}
+	if req := d.Calls[4].Params.(*Hook); req.Id != 0 || req.Name != "fan-on" {
+		t.Errorf("unexpected create %+v", req)
+	}
+	if plan.Create[0].Id != 5 {
+		t.Errorf("expected created webhook id 5, got %d", plan.Create[0].Id)
+	}
+}
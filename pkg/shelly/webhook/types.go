@@ -0,0 +1,40 @@
+package webhook
+
+// https://shelly-api-docs.shelly.cloud/gen2/ComponentsAndServices/Webhook
+
+// Hook is a webhook (a.k.a. action): the URLs the device calls when a
+// component instance emits an event, e.g. input.toggle_on on input:0.
+type Hook struct {
+	Id            int      `json:"id,omitempty"`             // Id of the webhook, assigned by the device
+	Cid           int      `json:"cid"`                      // Id of the component instance that emits the event
+	Enable        bool     `json:"enable"`                   // True if the webhook is enabled
+	Event         string   `json:"event"`                    // Event that triggers the webhook, e.g. switch.on, input.toggle_on
+	Name          string   `json:"name"`                     // Name of the webhook
+	SslCa         string   `json:"ssl_ca,omitempty"`         // CA for https URLs: "*" (none), "user_ca.pem" or "ca.pem" (default)
+	Urls          []string `json:"urls"`                     // URLs to call, with optional ${...} token substitutions
+	ActiveBetween []string `json:"active_between,omitempty"` // Start and end times (HH:MM) when the webhook is active
+	Condition     *string  `json:"condition,omitempty"`      // JavaScript-like condition on the event, e.g. "ev.tC > 25"
+	RepeatPeriod  int      `json:"repeat_period,omitempty"`  // Seconds before the webhook can fire again for the same condition
+}
+
+type ListResponse struct {
+	Hooks []Hook `json:"hooks"` // Webhooks configured on the device
+	Rev   int    `json:"rev"`   // Revision of the webhooks configuration
+}
+
+type CreateResponse struct {
+	Id  int `json:"id"`  // Id of the created webhook
+	Rev int `json:"rev"` // Revision of the webhooks configuration
+}
+
+type RevResponse struct {
+	Rev int `json:"rev"` // Revision of the webhooks configuration
+}
+
+type IdRequest struct {
+	Id int `json:"id"` // Id of the webhook
+}
+
+type SupportedResponse struct {
+	Types map[string]any `json:"types"` // Supported events, with their attributes
+}
@@ -67,6 +67,21 @@ type ZoneField struct {
 	Description string `json:"description,omitempty"`
 }
 
+// VirtualComponent declares one Shelly virtual component (Virtual.Add) that
+// the script uses, e.g. a number:200 slider for a set point. Setup creates
+// it on the device alongside the script upload. It is not used by the
+// generators, only validated here.
+type VirtualComponent struct {
+	// Type is one of "boolean" | "number" | "text" | "enum" | "group".
+	Type string `json:"type"`
+	// Id is the instance id, 200-299. It is fixed so that setup is
+	// idempotent and the script can find its components.
+	Id int `json:"id"`
+	// Config is the Virtual.Add configuration (name, min, max, options,
+	// meta.ui, ...), passed through as-is.
+	Config map[string]any `json:"config,omitempty"`
+}
+
 // Schema is the single source of truth for one script's configuration:
 // parsed directly by Go (encoding/json) and used to generate both the JS
 // CONFIG_SCHEMA block and the Go KVS-key maps/Default constants.
@@ -86,6 +101,8 @@ type Schema struct {
 	// ZoneFieldKeysVar is the generated Go map variable name for
 	// ZoneFields, e.g. "ZoneFieldKeys".
 	ZoneFieldKeysVar string `json:"zoneFieldKeysVar,omitempty"`
+	// VirtualComponents, if present, are created on the device by setup.
+	VirtualComponents []VirtualComponent `json:"virtualComponents,omitempty"`
 }
 
 // LoadSchema reads and validates a schema JSON file.
@@ -163,6 +180,22 @@ func (s *Schema) Validate() error {
 				zf.Field, s.KVSPrefix, zoneInfix, zf.Key, total, s.MaxKVSKeyLen)
 		}
 	}
+	seenVirtual := map[string]bool{}
+	for _, vc := range s.VirtualComponents {
+		switch vc.Type {
+		case "boolean", "number", "text", "enum", "group":
+		default:
+			return fmt.Errorf("virtualComponent %d: unknown type %q (want boolean|number|text|enum|group)", vc.Id, vc.Type)
+		}
+		if vc.Id < 200 || vc.Id > 299 {
+			return fmt.Errorf("virtualComponent %s:%d: id must be 200-299", vc.Type, vc.Id)
+		}
+		key := fmt.Sprintf("%s:%d", vc.Type, vc.Id)
+		if seenVirtual[key] {
+			return fmt.Errorf("virtualComponent %s: duplicate", key)
+		}
+		seenVirtual[key] = true
+	}
 	return nil
 }
 
@@ -120,6 +120,28 @@ func TestSchemaValidate_UnknownType(t *testing.T) {
 	}
 }
 
+func TestSchemaValidate_VirtualComponents(t *testing.T) {
+	valid := []VirtualComponent{
+		{Type: "number", Id: 200, Config: map[string]any{"name": "Set point", "min": 5.0, "max": 25.0}},
+		{Type: "boolean", Id: 200},
+	}
+	for _, tt := range []struct {
+		name    string
+		vcs     []VirtualComponent
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"unknown type", []VirtualComponent{{Type: "switch", Id: 200}}, true},
+		{"id out of range", []VirtualComponent{{Type: "number", Id: 100}}, true},
+		{"duplicate", append(valid, VirtualComponent{Type: "number", Id: 200}), true},
+	} {
+		s := &Schema{Script: "x.js", KVSPrefix: "script/x/", KVSKeysVar: "XKeys", VirtualComponents: tt.vcs}
+		if err := s.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
 func TestLoadSchema_PoolPump(t *testing.T) {
 	s, err := LoadSchema("../../internal/shelly/scripts/pool-pump.schema.json")
 	if err != nil {